@@ -0,0 +1,335 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCA is a minimal ACME server issuing from a throwaway root. It checks
+// nonces and that challenges were presented with the right key
+// authorization before marking authorizations valid.
+type fakeCA struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *ecdsa.PrivateKey
+	root   *x509.Certificate
+	solver *fakeSolver
+
+	mu         sync.Mutex
+	nonces     map[string]bool
+	nonce      int
+	thumbprint string
+	valid      map[string]bool
+	chain      []byte
+	badNonce   bool
+}
+
+func newFakeCA(t *testing.T, solver *fakeSolver) *fakeCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := x509.ParseCertificate(der)
+	ca := &fakeCA{t: t, key: key, root: root, solver: solver, nonces: map[string]bool{}, valid: map[string]bool{}, badNonce: true}
+	ca.srv = httptest.NewServer(http.HandlerFunc(ca.serve))
+	t.Cleanup(ca.srv.Close)
+	return ca
+}
+
+func (ca *fakeCA) newNonce(w http.ResponseWriter) {
+	ca.nonce++
+	n := fmt.Sprintf("nonce-%d", ca.nonce)
+	ca.nonces[n] = true
+	w.Header().Set("Replay-Nonce", n)
+}
+
+func (ca *fakeCA) problem(w http.ResponseWriter, kind, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(Problem{Type: "urn:ietf:params:acme:error:" + kind, Detail: detail})
+}
+
+func (ca *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	base := ca.srv.URL
+	if r.URL.Path == "/directory" {
+		_ = json.NewEncoder(w).Encode(directory{NewNonce: base + "/nonce", NewAccount: base + "/account", NewOrder: base + "/order"})
+		return
+	}
+	ca.newNonce(w)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	var jws struct{ Protected, Payload string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		ca.problem(w, "malformed", err.Error())
+		return
+	}
+	var header struct {
+		Nonce string
+		URL   string
+		Kid   string
+		JWK   map[string]string
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	_ = json.Unmarshal(raw, &header)
+	if !ca.nonces[header.Nonce] {
+		ca.problem(w, "badNonce", "unknown nonce")
+		return
+	}
+	delete(ca.nonces, header.Nonce)
+	if header.URL != base+r.URL.Path {
+		ca.problem(w, "malformed", "url mismatch")
+		return
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+
+	switch {
+	case r.URL.Path == "/account":
+		sum := sha256.Sum256([]byte(fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, header.JWK["x"], header.JWK["y"])))
+		ca.thumbprint = base64.RawURLEncoding.EncodeToString(sum[:])
+		w.Header().Set("Location", base+"/acct/1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"status":"valid"}`))
+	case header.Kid != base+"/acct/1":
+		ca.problem(w, "accountDoesNotExist", "bad kid")
+	case r.URL.Path == "/order":
+		// Reject the first order with a bad nonce to exercise the retry
+		if ca.badNonce {
+			ca.badNonce = false
+			ca.problem(w, "badNonce", "stale nonce")
+			return
+		}
+		var req struct{ Identifiers []identifier }
+		_ = json.Unmarshal(payload, &req)
+		var authz []string
+		for _, id := range req.Identifiers {
+			authz = append(authz, base+"/authz/"+id.Value)
+		}
+		w.Header().Set("Location", base+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(ca.order(authz))
+	case strings.HasPrefix(r.URL.Path, "/authz/"):
+		domain := strings.TrimPrefix(r.URL.Path, "/authz/")
+		status := "pending"
+		if ca.valid[domain] {
+			status = "valid"
+		}
+		_ = json.NewEncoder(w).Encode(authorization{
+			Status:     status,
+			Identifier: identifier{Type: "dns", Value: domain},
+			Challenges: []challenge{
+				{Type: DNS01, URL: base + "/chall/dns/" + domain, Token: "dns-token-" + domain},
+				{Type: HTTP01, URL: base + "/chall/http/" + domain, Token: "token-" + domain},
+			},
+		})
+	case strings.HasPrefix(r.URL.Path, "/chall/http/"):
+		domain := strings.TrimPrefix(r.URL.Path, "/chall/http/")
+		token := "token-" + domain
+		if ca.solver.presented[token] != token+"."+ca.thumbprint {
+			ca.problem(w, "unauthorized", "key authorization not presented")
+			return
+		}
+		ca.valid[domain] = true
+		_, _ = w.Write([]byte(`{"status":"valid"}`))
+	case r.URL.Path == "/finalize":
+		var req struct{ CSR string }
+		_ = json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || csr.CheckSignature() != nil {
+			ca.problem(w, "badCSR", "invalid CSR")
+			return
+		}
+		leaf := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca.root, csr.PublicKey, ca.key)
+		if err != nil {
+			ca.t.Error(err)
+		}
+		ca.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.root.Raw})...)
+		// Processing; the client has to poll the order
+		_ = json.NewEncoder(w).Encode(order{Status: "processing", Finalize: base + "/finalize"})
+	case r.URL.Path == "/order/1":
+		_ = json.NewEncoder(w).Encode(ca.order(nil))
+	case r.URL.Path == "/cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(ca.chain)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (ca *fakeCA) order(authz []string) order {
+	o := order{Status: "pending", Authorizations: authz, Finalize: ca.srv.URL + "/finalize"}
+	if ca.chain != nil {
+		o.Status, o.Certificate = "valid", ca.srv.URL+"/cert"
+	}
+	return o
+}
+
+type fakeSolver struct {
+	presented map[string]string
+	cleaned   []string
+}
+
+func (s *fakeSolver) Type() string { return HTTP01 }
+
+func (s *fakeSolver) Present(domain, token, keyAuth string) error {
+	s.presented[token] = keyAuth
+	return nil
+}
+
+func (s *fakeSolver) CleanUp(domain, token, keyAuth string) error {
+	s.cleaned = append(s.cleaned, token)
+	return nil
+}
+
+func TestObtain(t *testing.T) {
+	solver := &fakeSolver{presented: map[string]string{}}
+	ca := newFakeCA(t, solver)
+
+	storage := &Storage{Dir: filepath.Join(t.TempDir(), "acme")}
+	account, err := storage.AccountKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := storage.AccountKey()
+	if err != nil || !again.Equal(account) {
+		t.Fatalf("account key not reused: %v", err)
+	}
+
+	client := NewClient(ca.srv.URL+"/directory", account, ca.srv.Client())
+	client.PollInterval = time.Millisecond
+	if err := client.Register("admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey(KeyECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	domains := []string{"www.example.com", "example.com"}
+	chain, err := client.Obtain(domains, key, solver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 || !chain[1].Equal(ca.root) {
+		t.Fatalf("chain = %d certificates", len(chain))
+	}
+	if len(solver.cleaned) != 2 {
+		t.Errorf("cleaned up %d challenges, want 2", len(solver.cleaned))
+	}
+
+	if err := storage.Save("web", &Certificate{Chain: chain, Key: key}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := storage.Load("web")
+	if err != nil || stored == nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !stored.Leaf().Equal(chain[0]) {
+		t.Error("stored leaf differs")
+	}
+	if stored.Due([]string{"example.com", "www.example.com"}, 30*24*time.Hour) {
+		t.Error("new certificate due")
+	}
+	if !stored.Due([]string{"example.com"}, 30*24*time.Hour) {
+		t.Error("certificate not due after its domains changed")
+	}
+	if !stored.Due(domains, 100*24*time.Hour) {
+		t.Error("certificate not due near expiry")
+	}
+	if missing, err := storage.Load("other"); missing != nil || err != nil {
+		t.Errorf("missing certificate: %v, %v", missing, err)
+	}
+}
+
+func TestObtainSolverFailure(t *testing.T) {
+	solver := &fakeSolver{presented: map[string]string{}}
+	ca := newFakeCA(t, solver)
+	account, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	client := NewClient(ca.srv.URL+"/directory", account, ca.srv.Client())
+	if err := client.Register(""); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := NewKey("")
+	_, err := client.Obtain([]string{"example.com"}, key, &DNSCommandSolver{})
+	if err == nil {
+		t.Fatal("expected the DNS command solver to fail without a command")
+	}
+}
+
+func TestStandaloneSolver(t *testing.T) {
+	s := &StandaloneSolver{Addr: "127.0.0.1:0"}
+	if err := s.Present("example.com", "abc", "abc.thumb"); err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + s.listener.Addr().String() + challengePath
+	resp, err := http.Get(url + "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "abc.thumb" {
+		t.Errorf("body = %q", body)
+	}
+	if resp, err := http.Get(url + "other"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown token: %v", err)
+	}
+	if err := s.CleanUp("example.com", "abc", "abc.thumb"); err != nil {
+		t.Fatal(err)
+	}
+	if s.server != nil {
+		t.Error("listener still running after the last challenge")
+	}
+}
+
+func TestDNSRecord(t *testing.T) {
+	if got := DNSRecordName("*.example.com"); got != "_acme-challenge.example.com" {
+		t.Errorf("name = %s", got)
+	}
+	sum := sha256.Sum256([]byte("token.thumb"))
+	if got := DNSRecordValue("token.thumb"); got != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("value = %s", got)
+	}
+}
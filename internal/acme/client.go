@@ -0,0 +1,427 @@
+// Package acme is a minimal ACME (RFC 8555) client for obtaining the leaf
+// certificates applications serve, from Let's Encrypt or an internal ACME
+// CA such as step-ca. Challenges are answered by pluggable solvers.
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LetsEncrypt is the directory of Let's Encrypt's production CA
+const LetsEncrypt = "https://acme-v02.api.letsencrypt.org/directory"
+
+// maxResponseSize bounds ACME responses; certificate chains are the largest
+const maxResponseSize = 1 << 20
+
+// Problem is an ACME error document
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("acme: %s: %s", strings.TrimPrefix(p.Type, "urn:ietf:params:acme:error:"), p.Detail)
+}
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *Problem `json:"error"`
+}
+
+type authorization struct {
+	Status     string      `json:"status"`
+	Identifier identifier  `json:"identifier"`
+	Wildcard   bool        `json:"wildcard"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *Problem `json:"error"`
+}
+
+// Client talks to one ACME directory with one account key
+type Client struct {
+	directoryURL string
+	key          *ecdsa.PrivateKey
+	http         *http.Client
+
+	// PollInterval is the wait between status checks when the server
+	// doesn't send Retry-After; PollTimeout bounds each wait for a status
+	PollInterval time.Duration
+	PollTimeout  time.Duration
+
+	dir    *directory
+	kid    string
+	nonces []string
+}
+
+// NewClient returns a client for the directory at directoryURL using the
+// P-256 account key. httpClient may be nil for http.DefaultClient.
+func NewClient(directoryURL string, key *ecdsa.PrivateKey, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		directoryURL: directoryURL,
+		key:          key,
+		http:         httpClient,
+		PollInterval: 2 * time.Second,
+		PollTimeout:  2 * time.Minute,
+	}
+}
+
+// Register creates the account for the client's key, or finds the existing
+// one, agreeing to the CA's terms of service
+func (c *Client) Register(email string) error {
+	if err := c.discover(); err != nil {
+		return err
+	}
+	req := map[string]any{"termsOfServiceAgreed": true}
+	if email != "" {
+		req["contact"] = []string{"mailto:" + email}
+	}
+	resp, _, err := c.post(c.dir.NewAccount, req, nil)
+	if err != nil {
+		return fmt.Errorf("failed to register ACME account: %w", err)
+	}
+	c.kid = resp.Header.Get("Location")
+	if c.kid == "" {
+		return fmt.Errorf("ACME server returned no account URL")
+	}
+	return nil
+}
+
+// Obtain orders a certificate for domains, answers each authorization with
+// solver, and finalizes the order with a CSR signed by key. It returns the
+// issued chain, leaf first.
+func (c *Client) Obtain(domains []string, key crypto.Signer, solver Solver) ([]*x509.Certificate, error) {
+	if c.kid == "" {
+		return nil, fmt.Errorf("ACME account not registered")
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains to order a certificate for")
+	}
+
+	var ids []identifier
+	for _, d := range domains {
+		ids = append(ids, identifier{Type: "dns", Value: d})
+	}
+	var o order
+	resp, _, err := c.post(c.dir.NewOrder, map[string]any{"identifiers": ids}, &o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+	orderURL := resp.Header.Get("Location")
+
+	for _, authzURL := range o.Authorizations {
+		if err := c.authorize(authzURL, solver); err != nil {
+			return nil, err
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	if _, _, err := c.post(o.Finalize, map[string]string{"csr": encode(csr)}, &o); err != nil {
+		return nil, fmt.Errorf("failed to finalize order: %w", err)
+	}
+	if err := c.poll(orderURL, &o, func() (bool, error) {
+		switch o.Status {
+		case "valid":
+			return true, nil
+		case "invalid":
+			return false, orderError(o)
+		}
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	_, body, err := c.post(o.Certificate, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download certificate: %w", err)
+	}
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(body); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse issued certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("ACME server returned no certificate")
+	}
+	return chain, nil
+}
+
+// authorize completes one authorization with solver, unless the server
+// already considers it valid
+func (c *Client) authorize(authzURL string, solver Solver) error {
+	var authz authorization
+	if _, _, err := c.post(authzURL, nil, &authz); err != nil {
+		return fmt.Errorf("failed to fetch authorization: %w", err)
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	var chal *challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == solver.Type() {
+			chal = &authz.Challenges[i]
+		}
+	}
+	domain := authz.Identifier.Value
+	if chal == nil {
+		return fmt.Errorf("%s: the ACME server offers no %s challenge", domain, solver.Type())
+	}
+
+	keyAuth := chal.Token + "." + c.thumbprint()
+	if err := solver.Present(domain, chal.Token, keyAuth); err != nil {
+		return fmt.Errorf("%s: failed to present %s challenge: %w", domain, solver.Type(), err)
+	}
+	defer func() {
+		_ = solver.CleanUp(domain, chal.Token, keyAuth)
+	}()
+
+	if _, _, err := c.post(chal.URL, struct{}{}, nil); err != nil {
+		return fmt.Errorf("%s: failed to accept challenge: %w", domain, err)
+	}
+	return c.poll(authzURL, &authz, func() (bool, error) {
+		switch authz.Status {
+		case "valid":
+			return true, nil
+		case "pending", "processing":
+			return false, nil
+		}
+		for _, ch := range authz.Challenges {
+			if ch.Error != nil {
+				return false, fmt.Errorf("%s: %w", domain, ch.Error)
+			}
+		}
+		return false, fmt.Errorf("%s: authorization is %s", domain, authz.Status)
+	})
+}
+
+// poll fetches url into v until done reports completion or an error
+func (c *Client) poll(url string, v any, done func() (bool, error)) error {
+	deadline := time.Now().Add(c.PollTimeout)
+	for {
+		if ok, err := done(); ok || err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s", url)
+		}
+		resp, _, err := c.post(url, nil, v)
+		if err != nil {
+			return err
+		}
+		if ok, err := done(); ok || err != nil {
+			return err
+		}
+		wait := c.PollInterval
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			wait = time.Duration(s) * time.Second
+		}
+		time.Sleep(wait)
+	}
+}
+
+func orderError(o order) error {
+	if o.Error != nil {
+		return o.Error
+	}
+	return fmt.Errorf("order is invalid")
+}
+
+func (c *Client) discover() error {
+	if c.dir != nil {
+		return nil
+	}
+	resp, err := c.http.Get(c.directoryURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch ACME directory: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch ACME directory: %s", resp.Status)
+	}
+	var dir directory
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&dir); err != nil {
+		return fmt.Errorf("failed to parse ACME directory: %w", err)
+	}
+	c.dir = &dir
+	return nil
+}
+
+func (c *Client) nonce() (string, error) {
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		return nonce, nil
+	}
+	resp, err := c.http.Head(c.dir.NewNonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to get nonce: %w", err)
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("ACME server returned no nonce")
+	}
+	return nonce, nil
+}
+
+// post sends a JWS signed request, retrying once on a bad nonce. A nil
+// payload is a POST-as-GET. The response body is decoded into v when given.
+func (c *Client) post(url string, payload, v any) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		resp, body, err := c.postOnce(url, payload)
+		var problem *Problem
+		if errors.As(err, &problem) && problem.Type == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if v != nil {
+			if err := json.Unmarshal(body, v); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse response from %s: %w", url, err)
+			}
+		}
+		return resp, body, nil
+	}
+}
+
+func (c *Client) postOnce(url string, payload any) (*http.Response, []byte, error) {
+	nonce, err := c.nonce()
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := c.sign(url, nonce, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.http.Post(url, "application/jose+json", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if n := resp.Header.Get("Replay-Nonce"); n != "" {
+		c.nonces = append(c.nonces, n)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 400 {
+		problem := &Problem{Status: resp.StatusCode}
+		if json.Unmarshal(data, problem) != nil || problem.Type == "" {
+			return nil, nil, fmt.Errorf("%s: %s", url, resp.Status)
+		}
+		return nil, nil, problem
+	}
+	return resp, data, nil
+}
+
+// sign wraps payload in a flattened JWS signed with ES256. Requests before
+// the account exists carry the public key, later ones the account URL.
+func (c *Client) sign(url, nonce string, payload any) ([]byte, error) {
+	protected := map[string]any{"alg": "ES256", "nonce": nonce, "url": url}
+	if c.kid != "" {
+		protected["kid"] = c.kid
+	} else {
+		protected["jwk"] = c.jwk()
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	var body string
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = encode(data)
+	}
+
+	signingInput := encode(header) + "." + body
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return json.Marshal(map[string]string{
+		"protected": encode(header),
+		"payload":   body,
+		"signature": encode(sig),
+	})
+}
+
+// jwk returns the account public key as a JWK, members in the order the
+// thumbprint is computed over
+func (c *Client) jwk() map[string]string {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	c.key.X.FillBytes(x)
+	c.key.Y.FillBytes(y)
+	return map[string]string{"crv": "P-256", "kty": "EC", "x": encode(x), "y": encode(y)}
+}
+
+// thumbprint is the RFC 7638 thumbprint of the account key, which key
+// authorizations end with
+func (c *Client) thumbprint() string {
+	jwk := c.jwk()
+	data := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, jwk["x"], jwk["y"])
+	sum := sha256.Sum256([]byte(data))
+	return encode(sum[:])
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,181 @@
+package acme
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// Challenge types
+const (
+	HTTP01 = "http-01"
+	DNS01  = "dns-01"
+)
+
+// challengePath is where HTTP-01 responses are served from
+const challengePath = "/.well-known/acme-challenge/"
+
+// Solver answers one type of ACME challenge
+type Solver interface {
+	// Type is the challenge type the solver answers, e.g. http-01
+	Type() string
+	// Present makes the key authorization for token visible to the CA
+	Present(domain, token, keyAuth string) error
+	// CleanUp removes what Present set up
+	CleanUp(domain, token, keyAuth string) error
+}
+
+// WebrootSolver answers HTTP-01 challenges by writing the response into the
+// document root of a web server already serving the domains on port 80
+type WebrootSolver struct {
+	Root string
+}
+
+// Type returns http-01
+func (s *WebrootSolver) Type() string { return HTTP01 }
+
+// Present writes the response file
+func (s *WebrootSolver) Present(domain, token, keyAuth string) error {
+	dir := filepath.Join(s.Root, filepath.FromSlash(strings.Trim(challengePath, "/")))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, token), []byte(keyAuth), 0644)
+}
+
+// CleanUp removes the response file
+func (s *WebrootSolver) CleanUp(domain, token, keyAuth string) error {
+	err := os.Remove(filepath.Join(s.Root, filepath.FromSlash(strings.Trim(challengePath, "/")), token))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// StandaloneSolver answers HTTP-01 challenges from its own listener, for
+// hosts with nothing else on port 80. It listens only while a challenge is
+// pending.
+type StandaloneSolver struct {
+	// Addr is the listen address, ":80" when empty
+	Addr string
+
+	mu       sync.Mutex
+	tokens   map[string]string
+	server   *http.Server
+	listener net.Listener
+}
+
+// Type returns http-01
+func (s *StandaloneSolver) Type() string { return HTTP01 }
+
+// Present starts the listener if needed and serves the response
+func (s *StandaloneSolver) Present(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = map[string]string{}
+	}
+	s.tokens[token] = keyAuth
+	if s.server != nil {
+		return nil
+	}
+	addr := s.Addr
+	if addr == "" {
+		addr = ":80"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		delete(s.tokens, token)
+		return err
+	}
+	s.listener = l
+	s.server = &http.Server{Handler: http.HandlerFunc(s.serve), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = s.server.Serve(l)
+	}()
+	return nil
+}
+
+// CleanUp stops serving the response, and the listener after the last one
+func (s *StandaloneSolver) CleanUp(domain, token, keyAuth string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+	if len(s.tokens) > 0 || s.server == nil {
+		return nil
+	}
+	err := s.server.Close()
+	s.server, s.listener = nil, nil
+	return err
+}
+
+func (s *StandaloneSolver) serve(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.URL.Path, challengePath)
+	s.mu.Lock()
+	keyAuth, found := s.tokens[token]
+	s.mu.Unlock()
+	if !ok || !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(keyAuth))
+}
+
+// DNSCommandSolver answers DNS-01 challenges by running a command that
+// creates or deletes the TXT record, so any DNS provider can be scripted.
+// The command is run as
+//
+//	Command... present|cleanup _acme-challenge.<domain> <value>
+type DNSCommandSolver struct {
+	Command []string
+	// Propagation is how long to wait after present for the record to
+	// reach the authoritative servers
+	Propagation time.Duration
+	Runner      certstore.CommandRunner
+}
+
+// Type returns dns-01
+func (s *DNSCommandSolver) Type() string { return DNS01 }
+
+// Present creates the TXT record and waits for it to propagate
+func (s *DNSCommandSolver) Present(domain, token, keyAuth string) error {
+	if err := s.run("present", domain, keyAuth); err != nil {
+		return err
+	}
+	time.Sleep(s.Propagation)
+	return nil
+}
+
+// CleanUp deletes the TXT record
+func (s *DNSCommandSolver) CleanUp(domain, token, keyAuth string) error {
+	return s.run("cleanup", domain, keyAuth)
+}
+
+func (s *DNSCommandSolver) run(action, domain, keyAuth string) error {
+	if len(s.Command) == 0 {
+		return fmt.Errorf("no DNS command configured")
+	}
+	args := append(append([]string{}, s.Command[1:]...), action, DNSRecordName(domain), DNSRecordValue(keyAuth))
+	_, err := s.Runner.Run(s.Command[0], args...)
+	return err
+}
+
+// DNSRecordName returns the name of the TXT record validating domain
+func DNSRecordName(domain string) string {
+	return "_acme-challenge." + strings.TrimPrefix(domain, "*.")
+}
+
+// DNSRecordValue returns the TXT record value for a key authorization
+func DNSRecordValue(keyAuth string) string {
+	sum := sha256.Sum256([]byte(keyAuth))
+	return encode(sum[:])
+}
@@ -0,0 +1,178 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// Certificate key types
+const (
+	KeyECDSAP256 = "ecdsa-p256"
+	KeyRSA2048   = "rsa-2048"
+)
+
+const (
+	accountKeyFile = "account-key.pem"
+	chainFile      = "chain.pem"
+	keyFile        = "key.pem"
+)
+
+// Storage keeps the account key and each certificate's key and chain under
+// one directory, readable by the owner only:
+//
+//	<dir>/account-key.pem
+//	<dir>/<name>/chain.pem
+//	<dir>/<name>/key.pem
+type Storage struct {
+	Dir string
+}
+
+// Certificate is an issued chain, leaf first, and the leaf's key
+type Certificate struct {
+	Chain []*x509.Certificate
+	Key   crypto.Signer
+}
+
+// Leaf returns the end-entity certificate
+func (c *Certificate) Leaf() *x509.Certificate {
+	return c.Chain[0]
+}
+
+// Due reports whether the certificate expires within before, or no longer
+// covers exactly the configured domains
+func (c *Certificate) Due(domains []string, before time.Duration) bool {
+	if time.Until(c.Leaf().NotAfter) < before {
+		return true
+	}
+	have := slices.Clone(c.Leaf().DNSNames)
+	want := slices.Clone(domains)
+	slices.Sort(have)
+	slices.Sort(want)
+	return !slices.Equal(have, want)
+}
+
+// AccountKey returns the ACME account key, generating it on first use
+func (s *Storage) AccountKey() (*ecdsa.PrivateKey, error) {
+	path := filepath.Join(s.Dir, accountKeyFile)
+	key, err := readKey(path)
+	if err == nil {
+		account, ok := key.(*ecdsa.PrivateKey)
+		if !ok || account.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ACME account key %s is not a P-256 key", path)
+		}
+		return account, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	account, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ACME account key: %w", err)
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create ACME storage directory: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ACME account key: %w", err)
+	}
+	// O_EXCL so an account key created concurrently is never overwritten
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ACME account key: %w", err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, fmt.Errorf("failed to write ACME account key: %w", err)
+	}
+	return account, nil
+}
+
+// Load returns the stored certificate called name, or nil when none has
+// been issued yet
+func (s *Storage) Load(name string) (*Certificate, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir, name, chainFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate %s: %w", name, err)
+	}
+	chain, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", name, err)
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	key, err := readKey(filepath.Join(s.Dir, name, keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key of certificate %s: %w", name, err)
+	}
+	return &Certificate{Chain: chain, Key: key}, nil
+}
+
+// Save stores the certificate called name, key first so that a stored
+// chain always has its key
+func (s *Storage) Save(name string, c *Certificate) error {
+	dir := filepath.Join(s.Dir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(c.Key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+	if err := atomicfile.WriteFile(filepath.Join(dir, keyFile), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := atomicfile.WriteFile(filepath.Join(dir, chainFile), certstore.EncodePEMBundle(c.Chain), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
+
+// NewKey generates a certificate key of keyType, ECDSA P-256 when empty
+func NewKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case "", KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", keyType)
+}
+
+func readKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key in %s", path)
+	}
+	return key, nil
+}
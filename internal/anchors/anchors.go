@@ -0,0 +1,144 @@
+// Package anchors implements the sealed trust anchor list: the fingerprints
+// of the only certificates the tool may install. The list is a plain file,
+// and a digest of it is sealed in hardware (a TPM NV index, or the macOS
+// System keychain) so that editing the file without re-sealing is detected.
+package anchors
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+)
+
+// ErrSealMismatch is returned when the list no longer matches its sealed digest
+var ErrSealMismatch = errors.New("trust anchor list does not match its sealed digest")
+
+// List is a set of allowed SHA-256 certificate fingerprints
+type List struct {
+	entries map[string]string // subject comment keyed by lower-case fingerprint
+}
+
+// NewList returns an empty list
+func NewList() *List {
+	return &List{entries: make(map[string]string)}
+}
+
+// Add allows the certificate with the given fingerprint; subject is kept as a
+// comment for reviewers
+func (l *List) Add(fingerprint, subject string) {
+	l.entries[normalize(fingerprint)] = subject
+}
+
+// Contains reports whether fingerprint is allowed
+func (l *List) Contains(fingerprint string) bool {
+	_, ok := l.entries[normalize(fingerprint)]
+	return ok
+}
+
+// Len returns the number of allowed fingerprints
+func (l *List) Len() int {
+	return len(l.entries)
+}
+
+// Fingerprints returns the allowed fingerprints in sorted order
+func (l *List) Fingerprints() []string {
+	fps := make([]string, 0, len(l.entries))
+	for fp := range l.entries {
+		fps = append(fps, fp)
+	}
+	sort.Strings(fps)
+	return fps
+}
+
+// Digest is the SHA-256 of the sorted fingerprints, which is what gets
+// sealed; comments can be edited freely
+func (l *List) Digest() []byte {
+	h := sha256.New()
+	for _, fp := range l.Fingerprints() {
+		h.Write([]byte(fp + "\n"))
+	}
+	return h.Sum(nil)
+}
+
+// ReadList parses a list file: one fingerprint per line, optionally followed
+// by "# subject"; blank lines and lines starting with # are ignored
+func ReadList(path string) (*List, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust anchor list: %w", err)
+	}
+
+	l := NewList()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fp, comment, _ := strings.Cut(text, "#")
+		fp = normalize(strings.TrimSpace(fp))
+		if len(fp) != sha256.Size*2 || strings.Trim(fp, "0123456789abcdef") != "" {
+			return nil, fmt.Errorf("%s:%d: expected a SHA-256 fingerprint, got %q", path, line, strings.TrimSpace(text))
+		}
+		l.entries[fp] = strings.TrimSpace(comment)
+	}
+	return l, scanner.Err()
+}
+
+// Write saves the list in the format read by ReadList
+func (l *List) Write(path string) error {
+	var b strings.Builder
+	b.WriteString("# Trust anchors sealed by trust-store-updater; run 'trust-store-updater anchors seal' after editing\n")
+	for _, fp := range l.Fingerprints() {
+		b.WriteString(fp)
+		if subject := l.entries[fp]; subject != "" {
+			b.WriteString("  # " + subject)
+		}
+		b.WriteString("\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create trust anchor list directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write trust anchor list: %w", err)
+	}
+	return nil
+}
+
+// Open reads the list at path and checks it against the digest held by sealer
+func Open(path string, sealer Sealer) (*List, error) {
+	l, err := ReadList(path)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealer.Unseal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sealed digest from %s: %w", sealer.Name(), err)
+	}
+	if subtle.ConstantTimeCompare(sealed, l.Digest()) != 1 {
+		return nil, fmt.Errorf("%w: %s was changed without re-sealing", ErrSealMismatch, path)
+	}
+	return l, nil
+}
+
+// Seal stores the list's digest with sealer, making it the enforced list
+func Seal(l *List, sealer Sealer) error {
+	if err := sealer.Seal(l.Digest()); err != nil {
+		return fmt.Errorf("failed to seal trust anchor list with %s: %w", sealer.Name(), err)
+	}
+	return nil
+}
+
+func normalize(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
@@ -0,0 +1,111 @@
+package anchors
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+// memorySealer keeps the sealed digest in memory
+type memorySealer struct {
+	digest []byte
+}
+
+func (m *memorySealer) Name() string             { return "memory" }
+func (m *memorySealer) Seal(digest []byte) error { m.digest = digest; return nil }
+func (m *memorySealer) Unseal() ([]byte, error)  { return m.digest, nil }
+
+const (
+	fpA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	fpB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+func TestSealedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anchors.txt")
+	list := NewList()
+	list.Add(strings.ToUpper(fpA), "CN=Root A")
+	if err := list.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	sealer := &memorySealer{}
+	if err := Seal(list, sealer); err != nil {
+		t.Fatal(err)
+	}
+	opened, err := Open(path, sealer)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !opened.Contains(fpA) || opened.Contains(fpB) {
+		t.Errorf("unexpected list contents %v", opened.Fingerprints())
+	}
+
+	// Comments may change without re-sealing, fingerprints may not
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), "CN=Root A", "CN=Renamed", 1)), 0644)
+	if _, err := Open(path, sealer); err != nil {
+		t.Errorf("comment edit rejected: %v", err)
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(fpB + "\n")
+	f.Close()
+	if _, err := Open(path, sealer); !errors.Is(err, ErrSealMismatch) {
+		t.Errorf("expected ErrSealMismatch after adding a fingerprint, got %v", err)
+	}
+}
+
+func TestReadListRejectsMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anchors.txt")
+	os.WriteFile(path, []byte("# comment\nnot-a-fingerprint\n"), 0644)
+	if _, err := ReadList(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("expected a line 2 error, got %v", err)
+	}
+}
+
+func TestTPMSealerPassesOwnerAuthOnStdin(t *testing.T) {
+	t.Setenv(OwnerAuthEnv, "s3cret")
+	runner := &certstoretest.Runner{}
+	runner.Fail("tpm2_nvreadpublic 0x1500016", "not defined")
+	runner.Handle = func(call certstoretest.Call) certstoretest.Response {
+		if call.Name == "tpm2_nvread" {
+			// tpm2_nvread -P file:- -C o -s 32 -o <path> <index>
+			if err := os.WriteFile(call.Args[7], []byte("digest"), 0600); err != nil {
+				return certstoretest.Response{Err: err}
+			}
+		}
+		return certstoretest.Response{}
+	}
+	sealer := &tpmSealer{index: "0x1500016", runner: runner}
+
+	if err := sealer.Seal([]byte("digest")); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := sealer.Unseal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(digest) != "digest" {
+		t.Errorf("unsealed %q", digest)
+	}
+
+	owner := 0
+	for _, call := range runner.Calls() {
+		if strings.Contains(call.String(), "s3cret") {
+			t.Errorf("owner password on the command line: %s", call)
+		}
+		if call.Name == "tpm2_nvreadpublic" {
+			continue
+		}
+		owner++
+		if call.Args[0] != "-P" || call.Args[1] != "file:-" || string(call.Input) != "s3cret" {
+			t.Errorf("%s: owner password not passed on stdin", call)
+		}
+	}
+	if owner != 3 {
+		t.Errorf("ran %d owner commands, want nvdefine, nvwrite and nvread", owner)
+	}
+}
@@ -0,0 +1,150 @@
+package anchors
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// Sealer holds the list digest somewhere the list file's owner can't simply
+// rewrite alongside it
+type Sealer interface {
+	Name() string
+	Seal(digest []byte) error
+	Unseal() ([]byte, error)
+}
+
+// DefaultNVIndex is the TPM NV index used when none is configured
+const DefaultNVIndex = "0x1500016"
+
+// sealerTimeout bounds each tpm2-tools or security command
+const sealerTimeout = time.Minute
+
+// OwnerAuthEnv names the environment variable holding the TPM owner
+// hierarchy password, when one has been set with tpm2_changeauth
+const OwnerAuthEnv = "TRUST_STORE_UPDATER_TPM_OWNER_AUTH"
+
+// NewSealer returns the sealer for backend: "tpm", "keychain", or empty for
+// the platform default (keychain on macOS, TPM elsewhere)
+func NewSealer(backend, nvIndex string) (Sealer, error) {
+	if backend == "" {
+		backend = "tpm"
+		if runtime.GOOS == "darwin" {
+			backend = "keychain"
+		}
+	}
+
+	switch backend {
+	case "tpm":
+		if nvIndex == "" {
+			nvIndex = DefaultNVIndex
+		}
+		if _, err := strconv.ParseUint(strings.TrimPrefix(nvIndex, "0x"), 16, 32); err != nil || !strings.HasPrefix(nvIndex, "0x") {
+			return nil, fmt.Errorf("invalid TPM NV index %q", nvIndex)
+		}
+		return &tpmSealer{index: nvIndex, runner: certstore.CommandRunner{Timeout: sealerTimeout}}, nil
+	case "keychain":
+		if runtime.GOOS != "darwin" {
+			return nil, fmt.Errorf("the keychain sealing backend is only available on macOS")
+		}
+		return keychainSealer{runner: certstore.CommandRunner{Timeout: sealerTimeout}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported sealing backend %q (expected tpm or keychain)", backend)
+	}
+}
+
+// tpmSealer keeps the digest in an owner-controlled TPM NV index through
+// tpm2-tools. With an owner password set, re-sealing requires it.
+type tpmSealer struct {
+	index  string
+	runner certstore.Runner
+}
+
+func (t *tpmSealer) Name() string {
+	return "TPM NV index " + t.index
+}
+
+func (t *tpmSealer) Seal(digest []byte) error {
+	// Define the index on first use; an existing one of the right size is reused
+	if _, err := t.runner.Run("tpm2_nvreadpublic", t.index); err != nil {
+		if err := t.runOwner("tpm2_nvdefine", "-C", "o", "-s", strconv.Itoa(len(digest)), "-a", "ownerread|ownerwrite", t.index); err != nil {
+			return err
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "tsu-anchors")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	digestPath := filepath.Join(dir, "digest")
+	if err := atomicfile.WriteFile(digestPath, digest, 0600); err != nil {
+		return err
+	}
+	return t.runOwner("tpm2_nvwrite", "-C", "o", "-i", digestPath, t.index)
+}
+
+func (t *tpmSealer) Unseal() ([]byte, error) {
+	dir, err := os.MkdirTemp("", "tsu-anchors")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	digestPath := filepath.Join(dir, "digest")
+	if err := t.runOwner("tpm2_nvread", "-C", "o", "-s", "32", "-o", digestPath, t.index); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(digestPath)
+}
+
+// runOwner runs a tpm2-tools command authorized by the owner hierarchy. The
+// owner password is passed on standard input (-P file:-), never on the
+// command line, where other users could read it from the process list.
+func (t *tpmSealer) runOwner(name string, args ...string) error {
+	var input []byte
+	if auth := os.Getenv(OwnerAuthEnv); auth != "" {
+		args = append([]string{"-P", "file:-"}, args...)
+		input = []byte(auth)
+	}
+	_, err := t.runner.RunWithInput(input, name, args...)
+	return err
+}
+
+// keychainSealer keeps the digest as a generic password in the macOS System
+// keychain, which only root can modify
+type keychainSealer struct {
+	runner certstore.Runner
+}
+
+const (
+	keychainService = "com.webprofusion.trust-store-updater.anchors"
+	keychainAccount = "sealed-digest"
+	systemKeychain  = "/Library/Keychains/System.keychain"
+)
+
+func (keychainSealer) Name() string {
+	return "System keychain"
+}
+
+func (k keychainSealer) Seal(digest []byte) error {
+	_, err := k.runner.Run("security", "add-generic-password", "-U",
+		"-s", keychainService, "-a", keychainAccount, "-w", hex.EncodeToString(digest), systemKeychain)
+	return err
+}
+
+func (k keychainSealer) Unseal() ([]byte, error) {
+	out, err := k.runner.Run("security", "find-generic-password",
+		"-s", keychainService, "-a", keychainAccount, "-w", systemKeychain)
+	if err != nil {
+		return nil, fmt.Errorf("no sealed digest in the System keychain: %v", err)
+	}
+	return hex.DecodeString(strings.TrimSpace(string(out)))
+}
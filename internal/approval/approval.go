@@ -0,0 +1,195 @@
+// Package approval implements signed approvals for trust changes. An
+// approver signs the digest of the certificate bundle, or of one-off changes
+// such as an ad hoc addition or a restore, with an OpenSSH key,
+// typically a FIDO hardware key (ed25519-sk or ecdsa-sk) that requires a
+// touch, and hosts that require approval verify the signature against an
+// allowed_signers file before changing any store.
+package approval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// Namespace is the ssh-keygen signature namespace, so approvals can't be
+// confused with signatures made by the same key for other purposes
+const Namespace = "trust-store-updater-approval"
+
+// PlanNamespace is the namespace of signed plans, so a plan signature can't
+// be passed off as a bundle approval or the other way round
+const PlanNamespace = "trust-store-updater-plan"
+
+// Operations that change a store outside an update, bound into their
+// approval digests by OperationDigest
+const (
+	OpAdd      = "add"
+	OpRemove   = "remove"
+	OpRestore  = "restore"
+	OpRollback = "rollback"
+	OpACME     = "acme"
+)
+
+// signTimeout leaves the approver time to touch a hardware key
+const signTimeout = 5 * time.Minute
+
+// verifyTimeout bounds ssh-keygen when checking a signature
+const verifyTimeout = 30 * time.Second
+
+// ErrNotApproved is returned when a required approval is missing or invalid
+var ErrNotApproved = errors.New("trust changes are not approved")
+
+// Approval is the signed artifact placed alongside the bundle
+type Approval struct {
+	BundleDigest string    `json:"bundle_digest,omitempty"` // see BundleDigest
+	Certificates int       `json:"certificates"`
+	Operations   []string  `json:"operations,omitempty"` // one-off changes approved, see OperationDigest
+	Approver     string    `json:"approver"`             // principal in the allowed_signers file
+	ApprovedAt   time.Time `json:"approved_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// BundleDigest identifies a certificate set: the hex SHA-256 of its sorted
+// lower-case fingerprints, one per line
+func BundleDigest(fingerprints []string) string {
+	sorted := make([]string, len(fingerprints))
+	for i, fp := range fingerprints {
+		sorted[i] = strings.ToLower(fp)
+	}
+	sort.Strings(sorted)
+	h := sha256.New()
+	for _, fp := range sorted {
+		h.Write([]byte(fp + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// OperationDigest identifies a one-off change: the hex SHA-256 of the
+// operation, the store and the sorted items it applies, such as certificate
+// fingerprints or a version ID, one per line. Binding the operation and store
+// means an approval to add a certificate to one store can't authorize
+// removing it, or adding it to another.
+func OperationDigest(op, store string, items []string) string {
+	sorted := append([]string(nil), items...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	h.Write([]byte(op + "\n" + store + "\n"))
+	for _, item := range sorted {
+		h.Write([]byte(item + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Covers reports whether the approval covers the bundle or operation with
+// the given digest
+func (a *Approval) Covers(digest string) bool {
+	if digest == "" {
+		return false
+	}
+	if a.BundleDigest == digest {
+		return true
+	}
+	for _, op := range a.Operations {
+		if op == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// Required reports whether a host with hostTags needs approval
+func Required(hostTags, requiredFor []string) bool {
+	for _, tag := range hostTags {
+		for _, required := range requiredFor {
+			if strings.EqualFold(tag, required) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SignaturePath returns the detached signature file for an approval file
+func SignaturePath(path string) string {
+	return path + ".sig"
+}
+
+// Sign writes a to path and signs it with the OpenSSH private key at keyPath,
+// leaving the signature in SignaturePath(path). ssh-keygen prompts for the
+// hardware key touch or passphrase itself.
+func Sign(a *Approval, path, keyPath string) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode approval: %w", err)
+	}
+	return SignData(data, path, keyPath, Namespace)
+}
+
+// SignData writes data to path and signs it in namespace with the OpenSSH
+// private key at keyPath, leaving the signature in SignaturePath(path)
+func SignData(data []byte, path, keyPath, namespace string) error {
+	if err := atomicfile.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	// ssh-keygen refuses to overwrite an existing signature
+	if err := os.Remove(SignaturePath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Verbose passes the touch and passphrase prompts through to the approver
+	runner := certstore.CommandRunner{Timeout: signTimeout, Verbose: true}
+	if _, err := runner.Run("ssh-keygen", "-Y", "sign", "-f", keyPath, "-n", namespace, path); err != nil {
+		return fmt.Errorf("ssh-keygen failed to sign %s: %w", path, err)
+	}
+	return nil
+}
+
+// VerifyData checks that SignaturePath(path) is principal's signature of data
+// in namespace according to allowedSigners
+func VerifyData(data []byte, path, allowedSigners, principal, namespace string) error {
+	runner := certstore.CommandRunner{Timeout: verifyTimeout}
+	if _, err := runner.RunWithInput(data, "ssh-keygen", "-Y", "verify", "-f", allowedSigners, "-I", principal,
+		"-n", namespace, "-s", SignaturePath(path)); err != nil {
+		return fmt.Errorf("%w: signature by %s not valid: %v", ErrNotApproved, principal, err)
+	}
+	return nil
+}
+
+// Verify checks the approval at path: its signature must come from the
+// approver named in it according to allowedSigners, it must not have
+// expired, and it must cover exactly the bundle or operation with the given
+// digest
+func Verify(path, allowedSigners, digest string, now time.Time) (*Approval, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotApproved, err)
+	}
+	var a Approval
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("%w: malformed approval %s: %v", ErrNotApproved, path, err)
+	}
+	if a.Approver == "" {
+		return nil, fmt.Errorf("%w: approval %s names no approver", ErrNotApproved, path)
+	}
+
+	if err := VerifyData(data, path, allowedSigners, a.Approver, Namespace); err != nil {
+		return nil, err
+	}
+
+	if now.After(a.ExpiresAt) {
+		return nil, fmt.Errorf("%w: approval by %s expired at %s", ErrNotApproved, a.Approver, a.ExpiresAt.Format(time.RFC3339))
+	}
+	if !a.Covers(digest) {
+		return nil, fmt.Errorf("%w: approval by %s covers a different certificate bundle or operation", ErrNotApproved, a.Approver)
+	}
+	return &a, nil
+}
@@ -0,0 +1,86 @@
+package approval
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequired(t *testing.T) {
+	if !Required([]string{"eu-west", "Production"}, []string{"production"}) {
+		t.Error("tagged host should require approval")
+	}
+	if Required([]string{"staging"}, []string{"production"}) || Required(nil, []string{"production"}) {
+		t.Error("untagged host should not require approval")
+	}
+}
+
+func TestBundleDigestIgnoresOrder(t *testing.T) {
+	if BundleDigest([]string{"AA", "bb"}) != BundleDigest([]string{"bb", "aa"}) {
+		t.Error("digest depends on order or case")
+	}
+	if BundleDigest([]string{"aa"}) == BundleDigest([]string{"aa", "bb"}) {
+		t.Error("digest ignores added certificate")
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	dir := t.TempDir()
+	key := filepath.Join(dir, "approver")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	pub, _ := os.ReadFile(key + ".pub")
+	signers := filepath.Join(dir, "allowed_signers")
+	os.WriteFile(signers, []byte("alice@example.com "+string(pub)), 0644)
+
+	digest := BundleDigest([]string{"aa", "bb"})
+	path := filepath.Join(dir, "approval.json")
+	now := time.Now()
+	a := &Approval{BundleDigest: digest, Certificates: 2, Approver: "alice@example.com", ApprovedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if err := Sign(a, path, key); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	if _, err := Verify(path, signers, digest, now); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if _, err := Verify(path, signers, BundleDigest([]string{"aa", "bb", "cc"}), now); !errors.Is(err, ErrNotApproved) {
+		t.Errorf("expected different bundle to be rejected, got %v", err)
+	}
+	if _, err := Verify(path, signers, digest, now.Add(2*time.Hour)); !errors.Is(err, ErrNotApproved) {
+		t.Errorf("expected expired approval to be rejected, got %v", err)
+	}
+
+	// Any edit of the approval invalidates its signature
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), `"certificates": 2`, `"certificates": 3`, 1)), 0644)
+	if _, err := Verify(path, signers, digest, now); !errors.Is(err, ErrNotApproved) {
+		t.Errorf("expected edited approval to be rejected, got %v", err)
+	}
+}
+
+func TestOperationDigestBindsOperationAndStore(t *testing.T) {
+	add := OperationDigest(OpAdd, "system", []string{"aa", "bb"})
+	if add != OperationDigest(OpAdd, "system", []string{"bb", "aa"}) {
+		t.Error("digest depends on item order")
+	}
+	if add == OperationDigest(OpRemove, "system", []string{"aa", "bb"}) {
+		t.Error("digest ignores the operation")
+	}
+	if add == OperationDigest(OpAdd, "java", []string{"aa", "bb"}) {
+		t.Error("digest ignores the store")
+	}
+
+	a := &Approval{Operations: []string{add}}
+	if !a.Covers(add) || a.Covers(OperationDigest(OpRemove, "system", []string{"aa", "bb"})) || a.Covers("") {
+		t.Error("Covers does not match the listed operations only")
+	}
+}
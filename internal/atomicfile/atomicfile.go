@@ -0,0 +1,72 @@
+// Package atomicfile replaces files so that a crash or power loss at any
+// point leaves either the old contents or the new ones, never a truncated
+// certificate file or half-written bundle in a trust path.
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// WriteFile atomically replaces path with data. The data is written to a
+// temporary file in the same directory, flushed to disk, renamed over path,
+// and the directory is flushed so the rename itself survives a crash. The
+// file gets exactly perm; the process umask doesn't apply.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	return WriteFileFunc(path, data, perm, nil)
+}
+
+// WriteFileFunc is WriteFile with prepare run on the complete temporary file
+// before it replaces path, e.g. to set its owner, so path never has the new
+// contents with the wrong attributes
+func WriteFileFunc(path string, data []byte, perm os.FileMode, prepare func(tmpPath string) error) (err error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Chmod(perm); err != nil && runtime.GOOS != "windows" {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if prepare != nil {
+		if err = prepare(tmpPath); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes a directory's entries to disk. Windows can't open a
+// directory for this; NTFS journals the rename instead.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package atomicfile
+
+import "os"
+
+// KeepOwner is a no-op: new files inherit the directory's ACL
+func KeepOwner(path string, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package atomicfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// KeepOwner gives path the owner and group of the file described by info,
+// for a prepare func of WriteFileFunc replacing that file
+func KeepOwner(path string, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return os.Lchown(path, int(st.Uid), int(st.Gid))
+}
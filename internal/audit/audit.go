@@ -0,0 +1,218 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operation identifies the kind of mutating operation being audited
+type Operation string
+
+const (
+	OpAdd     Operation = "add"
+	OpRemove  Operation = "remove"
+	OpRestore Operation = "restore"
+)
+
+// Outcomes recorded for each operation
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Entry is a single line in the audit log
+type Entry struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Operation   Operation `json:"operation"`
+	Store       string    `json:"store"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Subject     string    `json:"subject,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	// Provenance of added certificates: where and when the bundle was retrieved
+	SourceLocation string     `json:"source_location,omitempty"`
+	RetrievedAt    *time.Time `json:"retrieved_at,omitempty"`
+	BundleSHA256   string     `json:"bundle_sha256,omitempty"`
+	User           string     `json:"user"`
+	Outcome        string     `json:"outcome"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// Forwarder receives a copy of every recorded entry (e.g. syslog)
+type Forwarder interface {
+	Forward(entry Entry) error
+	Close() error
+}
+
+// Logger appends audit entries to a JSONL file
+type Logger struct {
+	mu        sync.Mutex
+	path      string
+	user      string
+	forwarder Forwarder
+}
+
+// NewLogger creates an audit logger writing to path. When forwardSyslog is
+// set, entries are also sent to the local syslog/journald.
+func NewLogger(path string, forwardSyslog bool) (*Logger, error) {
+	if path == "" {
+		return nil, fmt.Errorf("audit log path must be specified")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	l := &Logger{
+		path: path,
+		user: currentUser(),
+	}
+
+	if forwardSyslog {
+		fwd, err := newSyslogForwarder()
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		l.forwarder = fwd
+	}
+
+	return l, nil
+}
+
+// Record appends an entry to the audit log. Timestamp and user are filled in
+// when not already set.
+func (l *Logger) Record(entry Entry) error {
+	if l == nil {
+		return nil
+	}
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	if entry.User == "" {
+		entry.User = l.user
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	if l.forwarder != nil {
+		if err := l.forwarder.Forward(entry); err != nil {
+			return fmt.Errorf("failed to forward audit entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Close releases any forwarding resources
+func (l *Logger) Close() error {
+	if l == nil || l.forwarder == nil {
+		return nil
+	}
+	return l.forwarder.Close()
+}
+
+// Filter selects entries when reading the audit log. Zero values match everything.
+type Filter struct {
+	Store       string
+	Operation   Operation
+	Outcome     string
+	Fingerprint string
+	Subject     string
+	Source      string
+	Since       time.Time
+	Until       time.Time
+}
+
+// Matches reports whether the entry satisfies the filter
+func (f Filter) Matches(e Entry) bool {
+	if f.Store != "" && e.Store != f.Store {
+		return false
+	}
+	if f.Source != "" && e.Source != f.Source {
+		return false
+	}
+	if f.Operation != "" && e.Operation != f.Operation {
+		return false
+	}
+	if f.Outcome != "" && e.Outcome != f.Outcome {
+		return false
+	}
+	if f.Fingerprint != "" && !strings.HasPrefix(strings.ToLower(e.Fingerprint), strings.ToLower(f.Fingerprint)) {
+		return false
+	}
+	if f.Subject != "" && !strings.Contains(strings.ToLower(e.Subject), strings.ToLower(f.Subject)) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Read returns all entries in the audit log matching the filter, oldest first
+func Read(path string, filter Filter) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil // nothing has been recorded yet
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("malformed audit entry on line %d: %w", line, err)
+		}
+		if filter.Matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	return entries, nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return fmt.Sprintf("uid:%d", os.Getuid())
+}
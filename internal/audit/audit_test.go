@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingForwarder stands in for syslog, keeping what it was given
+type failingForwarder struct {
+	forwarded []Entry
+	err       error
+}
+
+func (f *failingForwarder) Forward(entry Entry) error {
+	f.forwarded = append(f.forwarded, entry)
+	return f.err
+}
+
+func (f *failingForwarder) Close() error { return nil }
+
+func TestRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	l, err := NewLogger(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for _, e := range []Entry{
+		{Timestamp: base, Operation: OpAdd, Store: "system", Fingerprint: "AABB01", Subject: "CN=Corp Root", Outcome: OutcomeSuccess},
+		{Timestamp: base.Add(time.Hour), Operation: OpRemove, Store: "java", Fingerprint: "CCDD02", Subject: "CN=Old Root", Outcome: OutcomeFailure, Error: "keytool failed"},
+		{Operation: OpRestore, Store: "system", Outcome: OutcomeSuccess},
+	} {
+		if err := l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	all, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("read %d entries, want 3", len(all))
+	}
+	if all[1].Error != "keytool failed" || all[1].Operation != OpRemove {
+		t.Errorf("entry not read back as recorded: %+v", all[1])
+	}
+	// Timestamp and user are filled in when the caller leaves them unset
+	if all[2].Timestamp.IsZero() || all[2].User == "" {
+		t.Errorf("defaults not filled in: %+v", all[2])
+	}
+
+	system, err := Read(path, Filter{Store: "system"})
+	if err != nil || len(system) != 2 {
+		t.Errorf("store filter returned %d entries, %v; want 2", len(system), err)
+	}
+	window, err := Read(path, Filter{Since: base.Add(30 * time.Minute), Until: base.Add(90 * time.Minute)})
+	if err != nil || len(window) != 1 || window[0].Store != "java" {
+		t.Errorf("time range returned %+v, %v; want only the java removal", window, err)
+	}
+}
+
+func TestReadMissingAndMalformed(t *testing.T) {
+	dir := t.TempDir()
+	entries, err := Read(filepath.Join(dir, "missing.jsonl"), Filter{})
+	if err != nil || entries != nil {
+		t.Errorf("missing log = %v, %v; want nothing", entries, err)
+	}
+
+	path := filepath.Join(dir, "audit.jsonl")
+	if err := os.WriteFile(path, []byte("{\"store\":\"system\"}\n\nnot json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path, Filter{}); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("malformed line error = %v, want one naming line 3", err)
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	e := Entry{
+		Timestamp:   at,
+		Operation:   OpAdd,
+		Store:       "system",
+		Fingerprint: "AABBCCDD",
+		Subject:     "CN=Corp Root CA",
+		Source:      "corp",
+		Outcome:     OutcomeSuccess,
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"store", Filter{Store: "system"}, true},
+		{"other store", Filter{Store: "java"}, false},
+		{"source", Filter{Source: "corp"}, true},
+		{"other source", Filter{Source: "mozilla"}, false},
+		{"operation", Filter{Operation: OpRemove}, false},
+		{"outcome", Filter{Outcome: OutcomeFailure}, false},
+		{"fingerprint prefix, any case", Filter{Fingerprint: "aabb"}, true},
+		{"fingerprint not a prefix", Filter{Fingerprint: "ccdd"}, false},
+		{"subject substring, any case", Filter{Subject: "corp root"}, true},
+		{"other subject", Filter{Subject: "Other"}, false},
+		{"since before", Filter{Since: at.Add(-time.Minute)}, true},
+		{"since at", Filter{Since: at}, true},
+		{"since after", Filter{Since: at.Add(time.Minute)}, false},
+		{"until after", Filter{Until: at.Add(time.Minute)}, true},
+		{"until before", Filter{Until: at.Add(-time.Minute)}, false},
+		{"range around", Filter{Since: at.Add(-time.Hour), Until: at.Add(time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(e); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordForwardError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := NewLogger(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd := &failingForwarder{err: errors.New("syslog unavailable")}
+	l.forwarder = fwd
+
+	err = l.Record(Entry{Operation: OpAdd, Store: "system", Outcome: OutcomeSuccess})
+	if err == nil || !strings.Contains(err.Error(), "failed to forward audit entry") {
+		t.Errorf("Record error = %v, want the forwarding failure", err)
+	}
+	if len(fwd.forwarded) != 1 || fwd.forwarded[0].User == "" {
+		t.Errorf("forwarded %+v, want the completed entry", fwd.forwarded)
+	}
+	// The entry is kept locally even though forwarding failed
+	if entries, err := Read(path, Filter{}); err != nil || len(entries) != 1 {
+		t.Errorf("local log holds %d entries, %v; want 1", len(entries), err)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	if err := l.Record(Entry{Operation: OpAdd}); err != nil {
+		t.Errorf("nil logger Record = %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("nil logger Close = %v", err)
+	}
+	if _, err := NewLogger("", false); err == nil {
+		t.Error("expected an error for an empty path")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package audit
+
+import "fmt"
+
+func newSyslogForwarder() (Forwarder, error) {
+	return nil, fmt.Errorf("syslog forwarding is not supported on this platform")
+}
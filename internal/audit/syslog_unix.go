@@ -0,0 +1,37 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// syslogForwarder sends audit entries to the local syslog daemon, which
+// journald also collects on systemd hosts
+type syslogForwarder struct {
+	writer *syslog.Writer
+}
+
+func newSyslogForwarder() (Forwarder, error) {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTH, "trust-store-updater")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogForwarder{writer: w}, nil
+}
+
+func (s *syslogForwarder) Forward(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if entry.Outcome == OutcomeFailure {
+		return s.writer.Warning(string(data))
+	}
+	return s.writer.Notice(string(data))
+}
+
+func (s *syslogForwarder) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,158 @@
+package authroot
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Cabinet compression types this reader supports
+const (
+	cabCompressNone  = 0
+	cabCompressMSZIP = 1
+)
+
+// cabBlockSize is the most a CFDATA block expands to; MSZIP blocks use the
+// previous block's output as their deflate dictionary
+const cabBlockSize = 32768
+
+// ExtractCAB returns the contents of the named file in a Microsoft Cabinet
+// archive, such as authroot.stl in authrootstl.cab. Only uncompressed and
+// MSZIP folders are supported, which is what Windows Update publishes.
+func ExtractCAB(cab []byte, name string) ([]byte, error) {
+	errTruncated := errors.New("truncated cabinet")
+	if len(cab) < 36 || string(cab[:4]) != "MSCF" {
+		return nil, errors.New("not a cabinet file")
+	}
+	le := binary.LittleEndian
+	filesOffset := int(le.Uint32(cab[16:20]))
+	folders := int(le.Uint16(cab[26:28]))
+	files := int(le.Uint16(cab[28:30]))
+	flags := le.Uint16(cab[30:32])
+
+	off := 36
+	folderReserve, dataReserve := 0, 0
+	if flags&0x0004 != 0 { // cfhdrRESERVE_PRESENT
+		if !cabHas(cab, off, 4) {
+			return nil, errTruncated
+		}
+		headerReserve := int(le.Uint16(cab[off:]))
+		folderReserve = int(cab[off+2])
+		dataReserve = int(cab[off+3])
+		off += 4 + headerReserve
+	}
+	// Previous and next cabinet names of multi-cabinet sets
+	for _, flag := range []uint16{0x0001, 0x0002} {
+		if flags&flag != 0 {
+			for i := 0; i < 2; i++ {
+				if !cabHas(cab, off, 1) {
+					return nil, errTruncated
+				}
+				end := bytes.IndexByte(cab[off:], 0)
+				if end < 0 {
+					return nil, errTruncated
+				}
+				off += end + 1
+			}
+		}
+	}
+
+	type folder struct {
+		dataOffset  int
+		blocks      int
+		compression uint16
+	}
+	var fs []folder
+	for i := 0; i < folders; i++ {
+		if !cabHas(cab, off, 8) {
+			return nil, errTruncated
+		}
+		fs = append(fs, folder{
+			dataOffset:  int(le.Uint32(cab[off:])),
+			blocks:      int(le.Uint16(cab[off+4:])),
+			compression: le.Uint16(cab[off+6:]) & 0x000f,
+		})
+		off += 8 + folderReserve
+	}
+
+	off = filesOffset
+	for i := 0; i < files; i++ {
+		if !cabHas(cab, off, 17) {
+			return nil, errTruncated
+		}
+		size := int(le.Uint32(cab[off:]))
+		start := int(le.Uint32(cab[off+4:]))
+		folderIndex := int(le.Uint16(cab[off+8:]))
+		end := bytes.IndexByte(cab[off+16:], 0)
+		if end < 0 {
+			return nil, errTruncated
+		}
+		fileName := string(cab[off+16 : off+16+end])
+		off += 16 + end + 1
+		if !strings.EqualFold(fileName, name) {
+			continue
+		}
+		if folderIndex >= len(fs) {
+			return nil, fmt.Errorf("cabinet file %s is in a missing folder", fileName)
+		}
+		f := fs[folderIndex]
+		data, err := readCABFolder(cab, f.dataOffset, f.blocks, f.compression, dataReserve)
+		if err != nil {
+			return nil, err
+		}
+		if start < 0 || size < 0 || start > len(data) || size > len(data)-start {
+			return nil, errTruncated
+		}
+		return data[start : start+size], nil
+	}
+	return nil, fmt.Errorf("cabinet has no file %s", name)
+}
+
+// cabHas reports whether n bytes are available at offset at. Every offset in
+// a cabinet comes from the file itself, so each is checked before slicing.
+func cabHas(cab []byte, at, n int) bool {
+	return at >= 0 && n >= 0 && at <= len(cab) && n <= len(cab)-at
+}
+
+// readCABFolder decompresses a folder's CFDATA blocks
+func readCABFolder(cab []byte, off, blocks int, compression uint16, reserve int) ([]byte, error) {
+	if compression != cabCompressNone && compression != cabCompressMSZIP {
+		return nil, fmt.Errorf("unsupported cabinet compression type %d", compression)
+	}
+	le := binary.LittleEndian
+	var out []byte
+	var dict []byte
+	for i := 0; i < blocks; i++ {
+		if !cabHas(cab, off, 8) {
+			return nil, errors.New("truncated cabinet data block")
+		}
+		compressed := int(le.Uint16(cab[off+4:]))
+		off += 8 + reserve
+		if !cabHas(cab, off, compressed) {
+			return nil, errors.New("truncated cabinet data block")
+		}
+		block := cab[off : off+compressed]
+		off += compressed
+
+		if compression == cabCompressNone {
+			out = append(out, block...)
+			continue
+		}
+		if len(block) < 2 || string(block[:2]) != "CK" {
+			return nil, errors.New("invalid MSZIP block signature")
+		}
+		r := flate.NewReaderDict(bytes.NewReader(block[2:]), dict)
+		expanded, err := io.ReadAll(io.LimitReader(r, cabBlockSize+1))
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid MSZIP block: %w", err)
+		}
+		out = append(out, expanded...)
+		dict = expanded
+	}
+	return out, nil
+}
@@ -0,0 +1,469 @@
+// Package authroot reads Microsoft's trusted root program, published by
+// Windows Update as a signed certificate trust list (authroot.stl) inside
+// authrootstl.cab. The list names each root by SHA-1 hash; the certificates
+// themselves are downloaded one by one next to the cabinet.
+package authroot
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// DefaultURL is where Windows Update publishes the trusted root list
+const DefaultURL = "http://ctldl.windowsupdate.com/msdownload/update/v3/static/trustedr/en/authrootstl.cab"
+
+// STLName is the certificate trust list's name inside the cabinet
+const STLName = "authroot.stl"
+
+// CertificateURL is where a root listed in the trust list is downloaded
+// from: <hash>.crt next to the cabinet
+func CertificateURL(cabURL, sha1 string) string {
+	base := cabURL[:strings.LastIndex(cabURL, "/")+1]
+	return base + strings.ToUpper(sha1) + ".crt"
+}
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidCTL        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 1}
+
+	// Certificate properties Windows attaches to each trusted subject
+	oidPropEKU          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 11, 9}
+	oidPropFriendlyName = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 11, 11}
+	oidPropDisallowed   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 11, 104}
+	oidPropNotBefore    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 11, 126}
+
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	// Extended key usage of certificates Microsoft signs root lists with
+	oidRootListSigner = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 9}
+)
+
+// Entry is one root in the trust list
+type Entry struct {
+	SHA1         string // lowercase hex
+	FriendlyName string
+	// EKUs the root is trusted for; empty means every purpose
+	EKUs []asn1.ObjectIdentifier
+	// Disallowed is when Microsoft removed trust in the root; zero if never
+	Disallowed time.Time
+	// NotBefore is the date from which certificates the root issues are no
+	// longer trusted, for roots being phased out; zero if not set
+	NotBefore time.Time
+}
+
+// Trusted reports whether the root is still trusted, i.e. not disallowed
+func (e Entry) Trusted(now time.Time) bool {
+	return e.Disallowed.IsZero() || e.Disallowed.After(now)
+}
+
+// TrustedFor reports whether the root may issue for eku
+func (e Entry) TrustedFor(eku asn1.ObjectIdentifier) bool {
+	if len(e.EKUs) == 0 {
+		return true
+	}
+	for _, allowed := range e.EKUs {
+		if allowed.Equal(eku) {
+			return true
+		}
+	}
+	return false
+}
+
+// CTL is a parsed certificate trust list
+type CTL struct {
+	SequenceNumber *big.Int
+	ThisUpdate     time.Time
+	Entries        []Entry
+
+	content     []byte // the signed content: the CTL's DER encoding
+	signerCerts []*x509.Certificate
+	signedAttrs []byte // DER of the signed attributes as a SET, if present
+	digest      asn1.ObjectIdentifier
+	signature   []byte
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    algorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm algorithmIdentifier
+	Signature          []byte
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// Parse reads a certificate trust list: PKCS#7 signed data wrapping the CTL
+func Parse(stl []byte) (*CTL, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(stl, &ci); err != nil {
+		return nil, fmt.Errorf("not a certificate trust list: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("not a certificate trust list: content type %v", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid signed data: %w", err)
+	}
+	if !sd.ContentInfo.ContentType.Equal(oidCTL) {
+		return nil, fmt.Errorf("signed content is %v, not a certificate trust list", sd.ContentInfo.ContentType)
+	}
+
+	// PKCS#7 puts the CTL itself here; CMS wraps it in an OCTET STRING
+	content := sd.ContentInfo.Content.Bytes
+	var wrapped []byte
+	if rest, err := asn1.Unmarshal(content, &wrapped); err == nil && len(rest) == 0 {
+		content = wrapped
+	}
+
+	ctl, err := parseCTL(content)
+	if err != nil {
+		return nil, err
+	}
+	ctl.content = content
+
+	if len(sd.Certificates.Bytes) > 0 {
+		if ctl.signerCerts, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, fmt.Errorf("invalid signer certificates: %w", err)
+		}
+	}
+	if len(sd.SignerInfos) > 0 {
+		si := sd.SignerInfos[0]
+		ctl.digest = si.DigestAlgorithm.Algorithm
+		ctl.signature = si.Signature
+		if len(si.SignedAttrs.FullBytes) > 0 {
+			// Signed as a SET, though encoded with an implicit [0] tag
+			attrs := append([]byte(nil), si.SignedAttrs.FullBytes...)
+			attrs[0] = 0x31
+			ctl.signedAttrs = attrs
+		}
+	}
+	return ctl, nil
+}
+
+// parseCTL reads the CertificateTrustList structure:
+//
+//	SEQUENCE { version INTEGER OPTIONAL, subjectUsage, listIdentifier
+//	  OPTIONAL, sequenceNumber OPTIONAL, thisUpdate, nextUpdate OPTIONAL,
+//	  subjectAlgorithm, trustedSubjects OPTIONAL, [0] extensions OPTIONAL }
+//
+// Field by field, as the optional fields can't all be told apart by tag.
+func parseCTL(der []byte) (*CTL, error) {
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &seq); err != nil || seq.Tag != asn1.TagSequence {
+		return nil, errors.New("invalid certificate trust list")
+	}
+	var fields []asn1.RawValue
+	for rest := seq.Bytes; len(rest) > 0; {
+		var field asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return nil, fmt.Errorf("invalid certificate trust list: %w", err)
+		}
+		fields = append(fields, field)
+	}
+
+	ctl := &CTL{}
+	i := 0
+	next := func() *asn1.RawValue {
+		if i < len(fields) {
+			return &fields[i]
+		}
+		return nil
+	}
+	if f := next(); f != nil && f.Class == asn1.ClassUniversal && f.Tag == asn1.TagInteger {
+		i++ // version
+	}
+	if f := next(); f == nil || f.Tag != asn1.TagSequence {
+		return nil, errors.New("certificate trust list has no subject usage")
+	}
+	i++
+	if f := next(); f != nil && f.Tag == asn1.TagOctetString {
+		i++ // list identifier
+	}
+	if f := next(); f != nil && f.Class == asn1.ClassUniversal && f.Tag == asn1.TagInteger {
+		ctl.SequenceNumber = new(big.Int).SetBytes(f.Bytes)
+		i++
+	}
+	if f := next(); f != nil && (f.Tag == asn1.TagUTCTime || f.Tag == asn1.TagGeneralizedTime) {
+		var t time.Time
+		if _, err := asn1.Unmarshal(f.FullBytes, &t); err == nil {
+			ctl.ThisUpdate = t
+		}
+		i++
+	}
+	if f := next(); f != nil && (f.Tag == asn1.TagUTCTime || f.Tag == asn1.TagGeneralizedTime) {
+		i++ // next update
+	}
+	if f := next(); f != nil && f.Tag == asn1.TagSequence {
+		i++ // subject algorithm
+	}
+	f := next()
+	if f == nil || f.Class != asn1.ClassUniversal || f.Tag != asn1.TagSequence {
+		return ctl, nil
+	}
+
+	for rest := f.Bytes; len(rest) > 0; {
+		var subject struct {
+			Identifier []byte
+			Attributes []attribute `asn1:"set,optional"`
+		}
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &subject); err != nil {
+			return nil, fmt.Errorf("invalid trusted subject: %w", err)
+		}
+		entry := Entry{SHA1: hex.EncodeToString(subject.Identifier)}
+		for _, attr := range subject.Attributes {
+			value, ok := attributeValue(attr)
+			if !ok {
+				continue
+			}
+			switch {
+			case attr.Type.Equal(oidPropEKU):
+				var ekus []asn1.ObjectIdentifier
+				if _, err := asn1.Unmarshal(value, &ekus); err == nil {
+					entry.EKUs = ekus
+				}
+			case attr.Type.Equal(oidPropFriendlyName):
+				entry.FriendlyName = decodeUTF16(value)
+			case attr.Type.Equal(oidPropDisallowed):
+				entry.Disallowed = fileTime(value)
+			case attr.Type.Equal(oidPropNotBefore):
+				entry.NotBefore = fileTime(value)
+			}
+		}
+		ctl.Entries = append(ctl.Entries, entry)
+	}
+	return ctl, nil
+}
+
+// attributeValue returns the contents of an attribute's single OCTET STRING
+func attributeValue(attr attribute) ([]byte, bool) {
+	var value []byte
+	if _, err := asn1.Unmarshal(attr.Values.Bytes, &value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// decodeUTF16 decodes a NUL terminated little-endian UTF-16 string
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+// fileTime decodes a Windows FILETIME: 100ns intervals since 1601
+func fileTime(b []byte) time.Time {
+	if len(b) != 8 {
+		return time.Time{}
+	}
+	ticks := int64(binary.LittleEndian.Uint64(b))
+	if ticks == 0 {
+		return time.Time{}
+	}
+	const epochDelta = 116444736000000000 // 1601-01-01 to 1970-01-01
+	return time.Unix(0, (ticks-epochDelta)*100).UTC()
+}
+
+// Verify checks the list's signature, that the signing certificate is a
+// Microsoft root list signer and that it chains to one of roots, which for
+// Windows Update is the Microsoft Root Certificate Authority 2010 or 2011
+func (c *CTL) Verify(roots *x509.CertPool) error {
+	if len(c.signature) == 0 || len(c.signerCerts) == 0 {
+		return errors.New("certificate trust list is not signed")
+	}
+	hash, ok := map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}[c.digest.String()]
+	if !ok || !hash.Available() {
+		return fmt.Errorf("unsupported digest algorithm %v", c.digest)
+	}
+
+	// Without signed attributes the signature covers the content itself
+	signed := c.contentCandidates()
+	if c.signedAttrs != nil {
+		if err := c.checkMessageDigest(hash); err != nil {
+			return err
+		}
+		signed = [][]byte{c.signedAttrs}
+	}
+
+	algorithm := signatureAlgorithm(hash, c.signerCerts[0])
+	var lastErr error
+	for _, signer := range c.signerCerts {
+		if lastErr = checkAnySignature(signer, algorithm, signed, c.signature); lastErr != nil {
+			continue
+		}
+		if !isRootListSigner(signer) {
+			return fmt.Errorf("certificate trust list signer %q is not a root list signer (extended key usage %v)", signer.Subject.CommonName, oidRootListSigner)
+		}
+		intermediates := x509.NewCertPool()
+		for _, other := range c.signerCerts {
+			intermediates.AddCert(other)
+		}
+		_, err := signer.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("certificate trust list signer %q is not trusted: %w", signer.Subject.CommonName, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("certificate trust list signature is invalid: %w", lastErr)
+}
+
+// isRootListSigner reports whether c may sign root lists. Go doesn't know
+// the usage, so it is among the unknown ones.
+func isRootListSigner(c *x509.Certificate) bool {
+	for _, eku := range c.UnknownExtKeyUsage {
+		if eku.Equal(oidRootListSigner) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMessageDigest compares the signed messageDigest attribute with the
+// content's digest
+func (c *CTL) checkMessageDigest(hash crypto.Hash) error {
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(c.signedAttrs, &attrs, "set"); err != nil {
+		return fmt.Errorf("invalid signed attributes: %w", err)
+	}
+	for _, attr := range attrs {
+		if !attr.Type.Equal(oidMessageDigest) {
+			continue
+		}
+		want, ok := attributeValue(attr)
+		if !ok {
+			break
+		}
+		for _, candidate := range c.contentCandidates() {
+			h := hash.New()
+			h.Write(candidate)
+			if bytes.Equal(h.Sum(nil), want) {
+				return nil
+			}
+		}
+		return errors.New("certificate trust list digest does not match its signature")
+	}
+	return errors.New("certificate trust list signature has no message digest")
+}
+
+// contentCandidates are the bytes the signature may cover: CMS signs the
+// content's whole encoding, PKCS#7 only its value octets
+func (c *CTL) contentCandidates() [][]byte {
+	candidates := [][]byte{c.content}
+	var inner asn1.RawValue
+	if _, err := asn1.Unmarshal(c.content, &inner); err == nil {
+		candidates = append(candidates, inner.Bytes)
+	}
+	return candidates
+}
+
+func checkAnySignature(signer *x509.Certificate, algorithm x509.SignatureAlgorithm, candidates [][]byte, signature []byte) error {
+	var err error
+	for _, signed := range candidates {
+		if err = signer.CheckSignature(algorithm, signed, signature); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// signatureAlgorithm maps the digest and the signer's key type to the x509
+// algorithm, since PKCS#7 often names only rsaEncryption as the signature
+// algorithm
+func signatureAlgorithm(hash crypto.Hash, signer *x509.Certificate) x509.SignatureAlgorithm {
+	ecdsa := signer.PublicKeyAlgorithm == x509.ECDSA
+	switch hash {
+	case crypto.SHA1:
+		if ecdsa {
+			return x509.ECDSAWithSHA1
+		}
+		return x509.SHA1WithRSA
+	case crypto.SHA384:
+		if ecdsa {
+			return x509.ECDSAWithSHA384
+		}
+		return x509.SHA384WithRSA
+	case crypto.SHA512:
+		if ecdsa {
+			return x509.ECDSAWithSHA512
+		}
+		return x509.SHA512WithRSA
+	default:
+		if ecdsa {
+			return x509.ECDSAWithSHA256
+		}
+		return x509.SHA256WithRSA
+	}
+}
+
+// purposeOIDs are the EKU names the configuration uses, as in validation.allowed_ekus
+var purposeOIDs = map[string]asn1.ObjectIdentifier{
+	"server-auth":      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	"client-auth":      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	"code-signing":     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	"email-protection": {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	"time-stamping":    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	"ocsp-signing":     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+}
+
+// ParsePurposes converts EKU names such as server-auth to their OIDs
+func ParsePurposes(names []string) ([]asn1.ObjectIdentifier, error) {
+	var oids []asn1.ObjectIdentifier
+	for _, name := range names {
+		oid, ok := purposeOIDs[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown purpose: %s", name)
+		}
+		oids = append(oids, oid)
+	}
+	return oids, nil
+}
@@ -0,0 +1,313 @@
+package authroot
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey crypto.Signer, eku ...asn1.ObjectIdentifier) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		UnknownExtKeyUsage:    eku,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, key
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func octetAttribute(t *testing.T, oid asn1.ObjectIdentifier, value []byte) attribute {
+	return attribute{Type: oid, Values: asn1.RawValue{FullBytes: mustMarshal(t, asn1.RawValue{
+		Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(t, value),
+	})}}
+}
+
+func fileTimeBytes(at time.Time) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(at.UnixNano()/100+116444736000000000))
+	return b
+}
+
+type trustedSubject struct {
+	Identifier []byte
+	Attributes []attribute `asn1:"set"`
+}
+
+// buildSTL signs a trust list of the given roots, the first of which is
+// disallowed, with signer's key
+func buildSTL(t *testing.T, roots []*x509.Certificate, signer *x509.Certificate, signerKey crypto.Signer) []byte {
+	t.Helper()
+	var subjects []trustedSubject
+	for i, root := range roots {
+		sum := sha1.Sum(root.Raw)
+		attrs := []attribute{
+			octetAttribute(t, oidPropEKU, mustMarshal(t, []asn1.ObjectIdentifier{purposeOIDs["server-auth"]})),
+		}
+		if i == 0 {
+			attrs = append(attrs, octetAttribute(t, oidPropDisallowed, fileTimeBytes(time.Now().Add(-24*time.Hour))))
+		}
+		subjects = append(subjects, trustedSubject{Identifier: sum[:], Attributes: attrs})
+	}
+	ctl := mustMarshal(t, struct {
+		SubjectUsage     []asn1.ObjectIdentifier
+		SequenceNumber   *big.Int
+		ThisUpdate       time.Time `asn1:"utc"`
+		SubjectAlgorithm algorithmIdentifier
+		TrustedSubjects  []trustedSubject
+	}{
+		SubjectUsage:     []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 311, 10, 3, 9}},
+		SequenceNumber:   big.NewInt(42),
+		ThisUpdate:       time.Now().UTC().Truncate(time.Second),
+		SubjectAlgorithm: algorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}},
+		TrustedSubjects:  subjects,
+	})
+
+	// PKCS#7 digests the CTL's value octets
+	var inner asn1.RawValue
+	asn1.Unmarshal(ctl, &inner)
+	contentDigest := sha256.Sum256(inner.Bytes)
+	attrs := mustMarshal(t, struct {
+		A []attribute `asn1:"set"`
+	}{[]attribute{octetAttribute(t, oidMessageDigest, contentDigest[:])}})
+	// The SEQUENCE wrapper above holds the SET of attributes
+	var set asn1.RawValue
+	asn1.Unmarshal(attrs, &set)
+	signedAttrs := set.Bytes
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := signerKey.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	implicit := append([]byte(nil), signedAttrs...)
+	implicit[0] = 0xa0
+
+	sha256OID := algorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}}
+	sd := mustMarshal(t, struct {
+		Version          int
+		DigestAlgorithms []algorithmIdentifier `asn1:"set"`
+		ContentInfo      struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue
+		}
+		Certificates asn1.RawValue
+		SignerInfos  []struct {
+			Version            int
+			SID                asn1.RawValue
+			DigestAlgorithm    algorithmIdentifier
+			SignedAttrs        asn1.RawValue
+			SignatureAlgorithm algorithmIdentifier
+			Signature          []byte
+		} `asn1:"set"`
+	}{
+		Version:          1,
+		DigestAlgorithms: []algorithmIdentifier{sha256OID},
+		ContentInfo: struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue
+		}{oidCTL, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: ctl}},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signer.Raw},
+		SignerInfos: []struct {
+			Version            int
+			SID                asn1.RawValue
+			DigestAlgorithm    algorithmIdentifier
+			SignedAttrs        asn1.RawValue
+			SignatureAlgorithm algorithmIdentifier
+			Signature          []byte
+		}{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: mustMarshal(t, struct{ Serial *big.Int }{signer.SerialNumber})},
+			DigestAlgorithm:    sha256OID,
+			SignedAttrs:        asn1.RawValue{FullBytes: implicit},
+			SignatureAlgorithm: algorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          signature,
+		}},
+	})
+	return mustMarshal(t, struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+}
+
+// buildCAB packs one file into an MSZIP cabinet
+func buildCAB(t testing.TB, name string, data []byte) []byte {
+	t.Helper()
+	var blocks [][]byte
+	for off := 0; off < len(data); off += cabBlockSize {
+		end := off + cabBlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		var buf bytes.Buffer
+		var dict []byte
+		if off > 0 {
+			dict = data[off-cabBlockSize : off]
+		}
+		w, _ := flate.NewWriterDict(&buf, flate.DefaultCompression, dict)
+		w.Write(data[off:end])
+		w.Close()
+		blocks = append(blocks, append([]byte("CK"), buf.Bytes()...))
+	}
+
+	le := binary.LittleEndian
+	header := make([]byte, 36)
+	folder := make([]byte, 8)
+	file := make([]byte, 16)
+	file = append(file, name...)
+	file = append(file, 0)
+	filesOffset := len(header) + len(folder)
+	dataOffset := filesOffset + len(file)
+
+	copy(header, "MSCF")
+	le.PutUint32(header[16:], uint32(filesOffset))
+	header[24], header[25] = 3, 1
+	le.PutUint16(header[26:], 1)
+	le.PutUint16(header[28:], 1)
+	le.PutUint32(folder[0:], uint32(dataOffset))
+	le.PutUint16(folder[4:], uint16(len(blocks)))
+	le.PutUint16(folder[6:], cabCompressMSZIP)
+	le.PutUint32(file[0:], uint32(len(data)))
+
+	cab := append(append(header, folder...), file...)
+	for i, block := range blocks {
+		h := make([]byte, 8)
+		le.PutUint16(h[4:], uint16(len(block)))
+		size := cabBlockSize
+		if i == len(blocks)-1 {
+			size = len(data) - i*cabBlockSize
+		}
+		le.PutUint16(h[6:], uint16(size))
+		cab = append(append(cab, h...), block...)
+	}
+	return cab
+}
+
+func TestParseSignedCTLFromCAB(t *testing.T) {
+	msRoot, msRootKey := newCertificate(t, "Microsoft Root Certificate Authority (test)", nil, nil)
+	signer, signerKey := newCertificate(t, "Microsoft Certificate Trust List PCA (test)", msRoot, msRootKey, oidRootListSigner)
+	disallowed, _ := newCertificate(t, "Distrusted Root", nil, nil)
+	trusted, _ := newCertificate(t, "Trusted Root", nil, nil)
+
+	stl := buildSTL(t, []*x509.Certificate{disallowed, trusted}, signer, signerKey)
+	// Pad past one MSZIP block so the dictionary carries across blocks
+	padded := append(stl, bytes.Repeat([]byte{0}, 2*cabBlockSize)...)
+	cab := buildCAB(t, STLName, padded)
+
+	extracted, err := ExtractCAB(cab, STLName)
+	if err != nil {
+		t.Fatalf("ExtractCAB: %v", err)
+	}
+	if !bytes.Equal(extracted, padded) {
+		t.Fatal("extracted file differs from the original")
+	}
+
+	ctl, err := Parse(stl)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if ctl.SequenceNumber.Int64() != 42 || len(ctl.Entries) != 2 {
+		t.Fatalf("sequence %v, %d entries", ctl.SequenceNumber, len(ctl.Entries))
+	}
+	sum := sha1.Sum(trusted.Raw)
+	if ctl.Entries[1].SHA1 != hex.EncodeToString(sum[:]) {
+		t.Errorf("entry hash = %s", ctl.Entries[1].SHA1)
+	}
+	now := time.Now()
+	if ctl.Entries[0].Trusted(now) || !ctl.Entries[1].Trusted(now) {
+		t.Error("disallowed date not applied")
+	}
+	if !ctl.Entries[1].TrustedFor(purposeOIDs["server-auth"]) || ctl.Entries[1].TrustedFor(purposeOIDs["code-signing"]) {
+		t.Error("EKU property not applied")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(msRoot)
+	if err := ctl.Verify(roots); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	other, _ := newCertificate(t, "Other Root", nil, nil)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other)
+	if err := ctl.Verify(otherRoots); err == nil {
+		t.Error("verified against the wrong root")
+	}
+
+	// A certificate the root issued for something else can't sign the list
+	codeSigner, codeSignerKey := newCertificate(t, "Microsoft Code Signing PCA (test)", msRoot, msRootKey)
+	if ctl, err := Parse(buildSTL(t, []*x509.Certificate{trusted}, codeSigner, codeSignerKey)); err != nil {
+		t.Fatalf("Parse: %v", err)
+	} else if err := ctl.Verify(roots); err == nil || !strings.Contains(err.Error(), "not a root list signer") {
+		t.Errorf("Verify of a list signed without the root list signer usage = %v", err)
+	}
+
+	tampered := bytes.Replace(stl, []byte{42}, []byte{43}, 1)
+	if ctl, err := Parse(tampered); err == nil {
+		if err := ctl.Verify(roots); err == nil {
+			t.Error("tampered list verified")
+		}
+	}
+}
+
+func TestCertificateURL(t *testing.T) {
+	got := CertificateURL(DefaultURL, "abcdef")
+	want := "http://ctldl.windowsupdate.com/msdownload/update/v3/static/trustedr/en/ABCDEF.crt"
+	if got != want {
+		t.Errorf("CertificateURL = %s, want %s", got, want)
+	}
+}
+
+func FuzzExtractCAB(f *testing.F) {
+	f.Add(buildCAB(f, STLName, []byte("certificate trust list")))
+	f.Add([]byte("MSCF"))
+	// Reserve and multi-cabinet flags with a header reserve past the end
+	seed := make([]byte, 40)
+	copy(seed, "MSCF")
+	seed[30] = 0x07
+	seed[36], seed[37] = 0xff, 0xff
+	f.Add(seed)
+	f.Fuzz(func(t *testing.T, cab []byte) {
+		ExtractCAB(cab, STLName)
+	})
+}
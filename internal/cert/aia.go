@@ -0,0 +1,169 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+)
+
+// maxAIAResponseBytes bounds the size of a single issuer certificate download
+const maxAIAResponseBytes = 1 << 20
+
+// aiaCache caches issuer certificates fetched via Authority Information
+// Access URLs, in memory for the current run and optionally on disk
+type aiaCache struct {
+	mu      sync.Mutex
+	dir     string
+	ttl     time.Duration
+	entries map[string][]*x509.Certificate
+}
+
+// SetAIACache enables a persistent on-disk cache for AIA downloads. Entries
+// older than ttl are fetched again.
+func (f *Fetcher) SetAIACache(dir string, ttl time.Duration) {
+	f.aia.mu.Lock()
+	defer f.aia.mu.Unlock()
+	f.aia.dir = dir
+	f.aia.ttl = ttl
+}
+
+// CompleteChain follows the AIA "CA Issuers" URLs of certificates whose issuer
+// is not present in certs, fetching missing intermediates up to maxDepth hops
+// per chain. Only the newly found intermediates are returned; self-signed
+// roots are not followed.
+func (f *Fetcher) CompleteChain(certs []*x509.Certificate, maxDepth int) []*x509.Certificate {
+	known := make(map[string]bool)
+	for _, c := range certs {
+		known[GetCertificateFingerprint(c)] = true
+	}
+
+	var added []*x509.Certificate
+	for _, c := range certs {
+		current := c
+		for depth := 0; depth < maxDepth; depth++ {
+			if isSelfSigned(current) || hasIssuer(current, certs) || hasIssuer(current, added) {
+				break
+			}
+
+			issuer := f.fetchIssuer(current)
+			if issuer == nil {
+				break
+			}
+
+			fp := GetCertificateFingerprint(issuer)
+			if !known[fp] {
+				known[fp] = true
+				if !isSelfSigned(issuer) {
+					added = append(added, issuer)
+				}
+			}
+			current = issuer
+		}
+	}
+
+	if f.verbose && len(added) > 0 {
+		fmt.Printf("Fetched %d missing intermediate certificates via AIA\n", len(added))
+	}
+
+	return added
+}
+
+// fetchIssuer tries each CA Issuers URL of cert and returns the first certificate that signed it
+func (f *Fetcher) fetchIssuer(cert *x509.Certificate) *x509.Certificate {
+	for _, url := range cert.IssuingCertificateURL {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue // e.g. ldap:// URLs are not supported
+		}
+
+		candidates, err := f.fetchAIA(url)
+		if err != nil {
+			f.warnf("AIA fetch failed for %s: %v", url, err)
+			continue
+		}
+
+		for _, candidate := range candidates {
+			if cert.CheckSignatureFrom(candidate) == nil {
+				return candidate
+			}
+		}
+	}
+	return nil
+}
+
+// fetchAIA downloads (or loads from cache) the certificates published at an AIA URL
+func (f *Fetcher) fetchAIA(url string) ([]*x509.Certificate, error) {
+	f.aia.mu.Lock()
+	if certs, ok := f.aia.entries[url]; ok {
+		f.aia.mu.Unlock()
+		return certs, nil
+	}
+	dir, ttl := f.aia.dir, f.aia.ttl
+	f.aia.mu.Unlock()
+
+	var data []byte
+	cachePath := ""
+	if dir != "" {
+		hash := sha256.Sum256([]byte(url))
+		cachePath = filepath.Join(dir, hex.EncodeToString(hash[:])+".crt")
+		if info, err := os.Stat(cachePath); err == nil && time.Since(info.ModTime()) < ttl {
+			data, _ = os.ReadFile(cachePath)
+		}
+	}
+
+	if data == nil {
+		if f.verbose {
+			fmt.Printf("Fetching issuer certificate from AIA URL: %s\n", url)
+		}
+
+		resp, err := f.open(f.httpClient, url, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxAIAResponseBytes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		if cachePath != "" {
+			if err := os.MkdirAll(dir, 0755); err == nil {
+				_ = atomicfile.WriteFile(cachePath, data, 0644)
+			}
+		}
+	}
+
+	certs, err := f.ParseCertificates(bytes.TrimSpace(data))
+	if err != nil {
+		return nil, err
+	}
+
+	f.aia.mu.Lock()
+	f.aia.entries[url] = certs
+	f.aia.mu.Unlock()
+
+	return certs, nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+func hasIssuer(cert *x509.Certificate, pool []*x509.Certificate) bool {
+	for _, candidate := range pool {
+		if bytes.Equal(cert.RawIssuer, candidate.RawSubject) && cert.CheckSignatureFrom(candidate) == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newAIACertificate returns a certificate for cn signed by parent, or a
+// self-signed root when parent is nil, whose AIA CA Issuers URL is issuerURL
+func newAIACertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, issuerURL string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	if issuerURL != "" {
+		template.IssuingCertificateURL = []string{issuerURL}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, key
+}
+
+// aiaServer publishes DER certificates by path and counts the requests made
+type aiaServer struct {
+	*httptest.Server
+	certs    map[string][]byte
+	requests atomic.Int32
+}
+
+func newAIAServer(t *testing.T) *aiaServer {
+	s := &aiaServer{certs: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		data, ok := s.certs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newAIAChain publishes a root and n intermediates below it, and returns
+// them with a leaf issued by the last intermediate, leaf first
+func newAIAChain(t *testing.T, s *aiaServer, n int) []*x509.Certificate {
+	t.Helper()
+	issuer, key := newAIACertificate(t, "AIA Root", nil, nil, "")
+	s.certs["/root.crt"] = issuer.Raw
+	url := s.URL + "/root.crt"
+	chain := []*x509.Certificate{issuer}
+	for i := 0; i < n; i++ {
+		path := "/intermediate" + string(rune('a'+i)) + ".crt"
+		issuer, key = newAIACertificate(t, "AIA Intermediate "+path, issuer, key, url)
+		s.certs[path] = issuer.Raw
+		url = s.URL + path
+		chain = append([]*x509.Certificate{issuer}, chain...)
+	}
+	leaf, _ := newAIACertificate(t, "AIA Leaf", issuer, key, url)
+	return append([]*x509.Certificate{leaf}, chain...)
+}
+
+func TestCompleteChain(t *testing.T) {
+	s := newAIAServer(t)
+	chain := newAIAChain(t, s, 1)
+	leaf, intermediate := chain[0], chain[1]
+
+	f := NewFetcher(5, false)
+	added := f.CompleteChain([]*x509.Certificate{leaf}, 4)
+	if len(added) != 1 || !added[0].Equal(intermediate) {
+		t.Fatalf("added %d certificates, want only the intermediate (roots are not added)", len(added))
+	}
+
+	// An issuer already in the set is not fetched
+	before := s.requests.Load()
+	if added := f.CompleteChain([]*x509.Certificate{leaf, intermediate}, 4); len(added) != 0 {
+		t.Errorf("added %d certificates to a complete chain", len(added))
+	}
+	if s.requests.Load() != before {
+		t.Error("fetched an issuer that was already present")
+	}
+}
+
+func TestCompleteChainDepthLimit(t *testing.T) {
+	s := newAIAServer(t)
+	chain := newAIAChain(t, s, 3)
+	leaf := chain[0]
+
+	added := NewFetcher(5, false).CompleteChain([]*x509.Certificate{leaf}, 2)
+	if len(added) != 2 || !added[0].Equal(chain[1]) || !added[1].Equal(chain[2]) {
+		t.Errorf("depth 2 added %d certificates, want the two nearest intermediates", len(added))
+	}
+	if n := s.requests.Load(); n != 2 {
+		t.Errorf("made %d requests with a depth of 2", n)
+	}
+
+	added = NewFetcher(5, false).CompleteChain([]*x509.Certificate{leaf}, 10)
+	if len(added) != 3 {
+		t.Errorf("added %d certificates without a binding limit, want all 3 intermediates", len(added))
+	}
+}
+
+func TestCompleteChainCache(t *testing.T) {
+	s := newAIAServer(t)
+	chain := newAIAChain(t, s, 1)
+	leaf := chain[0]
+	dir := t.TempDir()
+
+	// Repeat lookups in one run come from memory. The chain is followed up
+	// to the root, so each run needs two downloads.
+	f := NewFetcher(5, false)
+	f.SetAIACache(dir, time.Hour)
+	f.CompleteChain([]*x509.Certificate{leaf}, 4)
+	f.CompleteChain([]*x509.Certificate{leaf}, 4)
+	if n := s.requests.Load(); n != 2 {
+		t.Errorf("made %d requests for two issuers in one run", n)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 2 {
+		t.Errorf("cache directory holds %d files, want 2", len(files))
+	}
+
+	// A later run reads the download from disk while it is fresh
+	f = NewFetcher(5, false)
+	f.SetAIACache(dir, time.Hour)
+	if added := f.CompleteChain([]*x509.Certificate{leaf}, 4); len(added) != 1 {
+		t.Fatalf("added %d certificates from the disk cache", len(added))
+	}
+	if n := s.requests.Load(); n != 2 {
+		t.Error("fetched an issuer held in the disk cache")
+	}
+
+	// and downloads it again once it has expired
+	f = NewFetcher(5, false)
+	f.SetAIACache(dir, 0)
+	f.CompleteChain([]*x509.Certificate{leaf}, 4)
+	if n := s.requests.Load(); n != 4 {
+		t.Errorf("made %d requests in total, want fresh downloads of the expired entries", n)
+	}
+}
+
+func TestCompleteChainNonCertificateResponse(t *testing.T) {
+	s := newAIAServer(t)
+	chain := newAIAChain(t, s, 1)
+	s.certs["/intermediatea.crt"] = []byte("<html>Not found</html>")
+
+	f := NewFetcher(5, false)
+	var warnings []string
+	f.SetWarningHandler(func(message string) { warnings = append(warnings, message) })
+	if added := f.CompleteChain([]*x509.Certificate{chain[0]}, 4); len(added) != 0 {
+		t.Errorf("added %d certificates from a page that isn't one", len(added))
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "AIA fetch failed") {
+		t.Errorf("warnings = %q, want one AIA fetch failure", warnings)
+	}
+}
@@ -0,0 +1,140 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/authroot"
+)
+
+// AuthRootOptions controls how Microsoft's trusted root list is mirrored
+type AuthRootOptions struct {
+	Headers map[string]string
+	// Purposes keeps only roots Microsoft trusts for one of these EKUs;
+	// empty keeps every trusted root
+	Purposes []asn1.ObjectIdentifier
+	// SignerCAs are the roots the list's signature must chain to. The list
+	// is refused without them unless InsecureSkipVerify is set, as anyone on
+	// the path of the plain HTTP download could otherwise pick the roots.
+	SignerCAs          *x509.CertPool
+	InsecureSkipVerify bool
+	// CacheDir keeps downloaded roots, which never change for a given hash
+	CacheDir string
+}
+
+// FetchAuthRoot downloads Microsoft's trusted root list (authrootstl.cab, or
+// a bare authroot.stl) and the roots it still trusts. Disallowed roots are
+// left out. Each root is checked against the SHA-1 hash the list names it by.
+func (f *Fetcher) FetchAuthRoot(url string, opts AuthRootOptions) (*Bundle, error) {
+	if f.verbose {
+		fmt.Printf("Fetching Microsoft trusted root list from URL: %s\n", url)
+	}
+	data, err := f.FetchRaw(url, opts.Headers)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+
+	stl := data
+	if bytes.HasPrefix(data, []byte("MSCF")) {
+		if stl, err = authroot.ExtractCAB(data, authroot.STLName); err != nil {
+			return nil, err
+		}
+	}
+	ctl, err := authroot.Parse(stl)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.SignerCAs != nil:
+		if err := ctl.Verify(opts.SignerCAs); err != nil {
+			return nil, err
+		}
+	case opts.InsecureSkipVerify:
+		f.warnf("the signature of %s was not verified; set signer_ca to the Microsoft root that signs it", url)
+	default:
+		return nil, fmt.Errorf("the signature of %s can't be verified: set signer_ca to the Microsoft root that signs it, "+
+			"or insecure_skip_verify to use the list unverified", url)
+	}
+
+	now := time.Now()
+	var certs []*x509.Certificate
+	for _, entry := range ctl.Entries {
+		if !entry.Trusted(now) || !trustedForAny(entry, opts.Purposes) {
+			continue
+		}
+		c, err := f.authRootCertificate(url, entry.SHA1, opts)
+		if err != nil {
+			f.warnf("skipping Microsoft root %s: %v", entry.SHA1, err)
+			continue
+		}
+		certs = append(certs, c)
+	}
+
+	return &Bundle{
+		Location:     url,
+		SHA256:       hex.EncodeToString(digest[:]),
+		RetrievedAt:  now.UTC(),
+		Certificates: certs,
+	}, nil
+}
+
+func trustedForAny(entry authroot.Entry, purposes []asn1.ObjectIdentifier) bool {
+	if len(purposes) == 0 {
+		return true
+	}
+	for _, purpose := range purposes {
+		if entry.TrustedFor(purpose) {
+			return true
+		}
+	}
+	return false
+}
+
+// authRootCertificate returns the root with the given SHA-1 hash, from the
+// cache or downloaded next to the list
+func (f *Fetcher) authRootCertificate(listURL, hash string, opts AuthRootOptions) (*x509.Certificate, error) {
+	var cachePath string
+	var data []byte
+	if opts.CacheDir != "" {
+		cachePath = filepath.Join(opts.CacheDir, hash+".crt")
+		data, _ = os.ReadFile(cachePath)
+	}
+	cached := data != nil
+	if !cached {
+		var err error
+		if data, err = f.FetchRaw(authroot.CertificateURL(listURL, hash), opts.Headers); err != nil {
+			return nil, err
+		}
+	}
+
+	// Windows Update serves DER
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	c, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(c.Raw)
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("certificate does not match its SHA-1 hash")
+	}
+
+	if !cached && cachePath != "" {
+		if err := os.MkdirAll(opts.CacheDir, 0755); err == nil {
+			_ = atomicfile.WriteFile(cachePath, c.Raw, 0644)
+		}
+	}
+	return c, nil
+}
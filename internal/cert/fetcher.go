@@ -5,19 +5,31 @@ import (
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
 // Fetcher handles fetching certificates from various sources
 type Fetcher struct {
-	httpClient *http.Client
-	verbose    bool
+	httpClient     *http.Client
+	aia            *aiaCache
+	maxBundleBytes int64
+	verbose        bool
+	warnMu         sync.Mutex
+	onWarning      func(message string)
+	userAgent      string
+	limiter        *rateLimiter // settings.requests_per_minute
+	retries        int          // for 429 and 503 responses
+	maxRetryAfter  time.Duration
+	workers        int // directory files parsed at once; 0 is one per CPU
 }
 
 // NewFetcher creates a new certificate fetcher
@@ -26,75 +38,294 @@ func NewFetcher(timeoutSeconds int, verbose bool) *Fetcher {
 		httpClient: &http.Client{
 			Timeout: time.Duration(timeoutSeconds) * time.Second,
 		},
-		verbose: verbose,
+		aia:            &aiaCache{entries: make(map[string][]*x509.Certificate)},
+		maxBundleBytes: DefaultMaxBundleBytes,
+		verbose:        verbose,
+		userAgent:      DefaultUserAgent,
+		maxRetryAfter:  DefaultMaxRetryAfter,
 	}
 }
 
-// FetchFromURL fetches certificates from a URL
-func (f *Fetcher) FetchFromURL(url string, headers map[string]string, verifyTLS bool) ([]*x509.Certificate, error) {
+// SetMaxBundleSize limits how many bytes are read from a single URL or file source
+func (f *Fetcher) SetMaxBundleSize(maxBytes int64) {
+	if maxBytes > 0 {
+		f.maxBundleBytes = maxBytes
+	}
+}
+
+// SetWorkers limits how many files of a directory source are parsed at
+// once; 0 parses one per CPU
+func (f *Fetcher) SetWorkers(n int) {
+	f.workers = n
+}
+
+// SetWarningHandler receives the non-fatal problems met while fetching, such
+// as unparseable certificates or unreadable files; nil removes the handler
+func (f *Fetcher) SetWarningHandler(handler func(message string)) {
+	f.warnMu.Lock()
+	defer f.warnMu.Unlock()
+	f.onWarning = handler
+}
+
+// warnf reports a non-fatal problem to the warning handler and, when verbose, stdout
+func (f *Fetcher) warnf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
 	if f.verbose {
-		fmt.Printf("Fetching certificates from URL: %s\n", url)
+		fmt.Printf("Warning: %s\n", message)
+	}
+	f.warnMu.Lock()
+	defer f.warnMu.Unlock()
+	if f.onWarning != nil {
+		f.onWarning(message)
 	}
+}
+
+// FetchOptions controls how a URL source is downloaded
+type FetchOptions struct {
+	Headers      map[string]string
+	VerifyTLS    bool
+	MaxBytes     int64    // overrides the fetcher's bundle size limit when > 0
+	ContentTypes []string // accepted media types; empty accepts anything but HTML
+	// PinnedCAs, when set, is the only set of roots the server's TLS chain may
+	// verify against, so a bundle served through an intercepting proxy is refused
+	PinnedCAs *x509.CertPool
+	// SHA256 is the expected hex digest of the downloaded bundle, if known
+	SHA256 string
+	// RequestsPerMinute limits requests to this URL, on top of the fetcher's limit
+	RequestsPerMinute int
+	// Resolve maps host names to the IP addresses to connect to instead of
+	// looking them up; DoHResolver is an RFC 8484 DNS-over-HTTPS endpoint
+	// used for other hosts
+	Resolve     map[string]string
+	DoHResolver string
+}
 
-	// Create request
-	req, err := http.NewRequest("GET", url, nil)
+// FetchFromURL fetches certificates from a URL
+func (f *Fetcher) FetchFromURL(url string, headers map[string]string, verifyTLS bool) ([]*x509.Certificate, error) {
+	return f.FetchURL(url, FetchOptions{Headers: headers, VerifyTLS: verifyTLS})
+}
+
+// Bundle is the certificates read from one URL or file, with where and when
+// they were retrieved and the SHA-256 digest of the bytes they were read from
+type Bundle struct {
+	Location     string
+	SHA256       string
+	RetrievedAt  time.Time
+	Certificates []*x509.Certificate
+}
+
+// FetchURL fetches certificates from a URL, rejecting responses that are too
+// large or of the wrong content type (e.g. an HTML login or error page)
+func (f *Fetcher) FetchURL(url string, opts FetchOptions) ([]*x509.Certificate, error) {
+	bundle, err := f.FetchURLBundle(url, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
+	return bundle.Certificates, nil
+}
 
-	// Add headers
-	for key, value := range headers {
-		req.Header.Set(key, value)
+// FetchURLBundle is FetchURL returning the bundle's provenance as well
+func (f *Fetcher) FetchURLBundle(url string, opts FetchOptions) (*Bundle, error) {
+	if f.verbose {
+		fmt.Printf("Fetching certificates from URL: %s\n", url)
 	}
 
 	// Configure TLS verification
-	if !verifyTLS {
+	if !opts.VerifyTLS {
 		// This would require modifying the http client's transport
 		// For now, we'll always verify TLS
 	}
 
-	// Make request
-	resp, err := f.httpClient.Do(req)
+	client := f.sourceClient(opts)
+	resp, err := f.open(client, url, opts.Headers, opts.RequestsPerMinute)
+	if err != nil {
+		if opts.PinnedCAs != nil && isTLSVerificationError(err) {
+			return nil, fmt.Errorf("server certificate for %s does not chain to the pinned CA; the connection may be intercepted: %w", url, err)
+		}
+		return nil, err
+	}
+	body := f.newResumingBody(client, url, opts, resp)
+	defer body.Close()
+
+	if err := checkContentType(url, resp, opts.ContentTypes); err != nil {
+		return nil, err
+	}
+
+	maxBytes := f.maxBundleBytes
+	if opts.MaxBytes > 0 {
+		maxBytes = opts.MaxBytes
+	}
+
+	bundle, err := f.readBundle(body, maxBytes, url)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SHA256 != "" && bundle.SHA256 != normalizeFingerprint(opts.SHA256) {
+		return nil, fmt.Errorf("bundle SHA-256 %s does not match the expected %s; refusing to use it", bundle.SHA256, normalizeFingerprint(opts.SHA256))
+	}
+	return bundle, nil
+}
+
+// FetchRaw downloads the body of a URL, e.g. for sources that aren't X.509 certificates
+func (f *Fetcher) FetchRaw(url string, headers map[string]string) ([]byte, error) {
+	resp, err := f.open(f.httpClient, url, headers, 0)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch from URL: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP request failed with status %d", resp.StatusCode)
+	if err := checkContentType(url, resp, nil); err != nil {
+		return nil, err
 	}
 
 	// Read response body
-	data, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(&limitedReader{r: resp.Body, remaining: f.maxBundleBytes})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, readError(err, f.maxBundleBytes)
+	}
+
+	return data, nil
+}
+
+// open issues a GET request and returns the response if it was successful,
+// including a partial one for a Range request.
+// Requests wait for the global limit and perMinute for this URL, and 429 and
+// 503 responses are retried after the delay the server asks for.
+func (f *Fetcher) open(client *http.Client, url string, headers map[string]string, perMinute int) (*http.Response, error) {
+	source := limiterFor("url:"+url, perMinute)
+	for attempt := 0; ; attempt++ {
+		// Create request
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		// Add headers
+		req.Header.Set("User-Agent", f.userAgent)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		f.limiter.wait()
+		source.wait()
+
+		// Make request
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch from URL: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent && req.Header.Get("Range") != "" {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if !retryable(resp.StatusCode) {
+			return nil, fmt.Errorf("HTTP request failed with status %d%s", resp.StatusCode, redirectNote(url, resp))
+		}
+
+		wait := retryAfter(resp, attempt, time.Now())
+		if attempt >= f.retries || wait > f.maxRetryAfter {
+			return nil, retryError(resp.StatusCode, wait, f.maxRetryAfter)
+		}
+		f.warnf("%s answered %d, retrying in %s", url, resp.StatusCode, wait)
+		// Hold back every request to this URL, not just this one
+		source.delay(wait)
+		sleep(wait)
 	}
+}
 
-	return f.ParseCertificates(data)
+// readBundle reads certificates from r, recording the digest of what was read
+func (f *Fetcher) readBundle(r io.Reader, maxBytes int64, location string) (*Bundle, error) {
+	hash := sha256.New()
+	certs, err := f.readCertificates(io.TeeReader(r, hash), maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{
+		Location:     location,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+		RetrievedAt:  time.Now().UTC(),
+		Certificates: certs,
+	}, nil
+}
+
+// readCertificates streams every certificate from r within maxBytes
+func (f *Fetcher) readCertificates(r io.Reader, maxBytes int64) ([]*x509.Certificate, error) {
+	head := &headRecorder{r: r}
+	var certs []*x509.Certificate
+	_, err := f.StreamCertificates(head, maxBytes, func(c *x509.Certificate) error {
+		certs = append(certs, c)
+		return nil
+	})
+	if err != nil {
+		return nil, readError(err, maxBytes)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no valid certificates found%s", head.describe())
+	}
+
+	if f.verbose {
+		fmt.Printf("Parsed %d certificates\n", len(certs))
+	}
+
+	return certs, nil
+}
+
+// readError adds the limit to ErrBundleTooLarge
+func readError(err error, maxBytes int64) error {
+	if errors.Is(err, ErrBundleTooLarge) {
+		return fmt.Errorf("%w (limit %d bytes)", err, maxBytes)
+	}
+	return fmt.Errorf("failed to read source: %w", err)
 }
 
 // FetchFromFile fetches certificates from a file
 func (f *Fetcher) FetchFromFile(filePath string) ([]*x509.Certificate, error) {
+	bundle, err := f.FetchFileBundle(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return bundle.Certificates, nil
+}
+
+// FetchFileBundle is FetchFromFile returning the bundle's provenance as well
+func (f *Fetcher) FetchFileBundle(filePath string) (*Bundle, error) {
 	if f.verbose {
 		fmt.Printf("Fetching certificates from file: %s\n", filePath)
 	}
 
-	data, err := os.ReadFile(filePath)
+	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	defer file.Close()
 
-	return f.ParseCertificates(data)
+	return f.readBundle(file, f.maxBundleBytes, filePath)
 }
 
 // FetchFromDirectory fetches certificates from all files in a directory
 func (f *Fetcher) FetchFromDirectory(dirPath string, filters []string) ([]*x509.Certificate, error) {
+	bundles, err := f.FetchDirectoryBundles(dirPath, filters)
+	if err != nil {
+		return nil, err
+	}
+	var allCerts []*x509.Certificate
+	for _, bundle := range bundles {
+		allCerts = append(allCerts, bundle.Certificates...)
+	}
+	return allCerts, nil
+}
+
+// FetchDirectoryBundles reads every matching file in a directory as a bundle.
+// Files are read and parsed by a pool of workers; results are returned in
+// walk (lexical path) order regardless of which worker finished first.
+func (f *Fetcher) FetchDirectoryBundles(dirPath string, filters []string) ([]*Bundle, error) {
 	if f.verbose {
 		fmt.Printf("Fetching certificates from directory: %s\n", dirPath)
 	}
 
-	var allCerts []*x509.Certificate
-
+	var paths []string
 	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -109,15 +340,7 @@ func (f *Fetcher) FetchFromDirectory(dirPath string, filters []string) ([]*x509.
 			return nil
 		}
 
-		certs, err := f.FetchFromFile(path)
-		if err != nil {
-			if f.verbose {
-				fmt.Printf("Warning: Failed to parse certificates from %s: %v\n", path, err)
-			}
-			return nil // Continue processing other files
-		}
-
-		allCerts = append(allCerts, certs...)
+		paths = append(paths, path)
 		return nil
 	})
 
@@ -125,7 +348,49 @@ func (f *Fetcher) FetchFromDirectory(dirPath string, filters []string) ([]*x509.
 		return nil, fmt.Errorf("failed to walk directory: %w", err)
 	}
 
-	return allCerts, nil
+	results := make([]*Bundle, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < directoryWorkers(len(paths), f.workers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				bundle, err := f.FetchFileBundle(paths[i])
+				if err != nil {
+					f.warnf("Failed to parse certificates from %s: %v", paths[i], err)
+					continue // Continue processing other files
+				}
+				results[i] = bundle
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var bundles []*Bundle
+	for _, bundle := range results {
+		if bundle != nil {
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles, nil
+}
+
+// directoryWorkers sizes the parse pool: one worker per CPU, or limit when
+// set, at most one per file
+func directoryWorkers(files, limit int) int {
+	workers := runtime.GOMAXPROCS(0)
+	if limit > 0 {
+		workers = limit
+	}
+	if files < workers {
+		workers = files
+	}
+	return workers
 }
 
 // ParseCertificates parses certificates from PEM data
@@ -144,9 +409,7 @@ func (f *Fetcher) ParseCertificates(data []byte) ([]*x509.Certificate, error) {
 		if block.Type == "CERTIFICATE" {
 			cert, err := x509.ParseCertificate(block.Bytes)
 			if err != nil {
-				if f.verbose {
-					fmt.Printf("Warning: Failed to parse certificate: %v\n", err)
-				}
+				f.warnf("Failed to parse certificate: %v", err)
 				continue
 			}
 			certs = append(certs, cert)
@@ -172,8 +435,8 @@ func (f *Fetcher) ParseCertificates(data []byte) ([]*x509.Certificate, error) {
 	return certs, nil
 }
 
-// ValidateCertificate validates a certificate
-func (f *Fetcher) ValidateCertificate(cert *x509.Certificate) error {
+// ValidateCertificate validates a certificate against the basic CA rules and the given policy
+func (f *Fetcher) ValidateCertificate(cert *x509.Certificate, policy ValidationPolicy) error {
 	// Check if certificate is expired
 	now := time.Now()
 	if now.Before(cert.NotBefore) {
@@ -183,17 +446,19 @@ func (f *Fetcher) ValidateCertificate(cert *x509.Certificate) error {
 		return fmt.Errorf("certificate has expired (expired on %v)", cert.NotAfter)
 	}
 
-	// Check if it's a CA certificate
-	if !cert.IsCA {
-		return fmt.Errorf("certificate is not a CA certificate")
-	}
+	if policy.RequireCA {
+		// Check if it's a CA certificate
+		if !cert.IsCA {
+			return fmt.Errorf("certificate is not a CA certificate")
+		}
 
-	// Check basic constraints
-	if !cert.BasicConstraintsValid {
-		return fmt.Errorf("certificate has invalid basic constraints")
+		// Check basic constraints
+		if !cert.BasicConstraintsValid {
+			return fmt.Errorf("certificate has invalid basic constraints")
+		}
 	}
 
-	return nil
+	return policy.Check(cert)
 }
 
 // GetCertificateFingerprint returns the SHA-256 fingerprint of a certificate
@@ -202,6 +467,13 @@ func GetCertificateFingerprint(cert *x509.Certificate) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// GetSPKIFingerprint returns the SHA-256 hash of the certificate's SubjectPublicKeyInfo.
+// Re-issued and cross-signed variants of the same CA share this value.
+func GetSPKIFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(hash[:])
+}
+
 // GetCertificateInfo extracts information from a certificate
 func GetCertificateInfo(cert *x509.Certificate) map[string]interface{} {
 	return map[string]interface{}{
@@ -211,6 +483,7 @@ func GetCertificateInfo(cert *x509.Certificate) map[string]interface{} {
 		"not_before":    cert.NotBefore,
 		"not_after":     cert.NotAfter,
 		"fingerprint":   GetCertificateFingerprint(cert),
+		"spki_sha256":   GetSPKIFingerprint(cert),
 		"is_ca":         cert.IsCA,
 		"key_usage":     cert.KeyUsage,
 		"ext_key_usage": cert.ExtKeyUsage,
@@ -0,0 +1,55 @@
+package cert
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchFromDirectoryKeepsWalkOrder(t *testing.T) {
+	dir := t.TempDir()
+	var want []string
+	for i := 0; i < 40; i++ {
+		c := newRSACertificate(t, 1024, nil)
+		want = append(want, GetCertificateFingerprint(c))
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("cert-%02d.pem", i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// One worker, as in low memory mode, gives the same result
+	for _, workers := range []int{0, 1} {
+		f := NewFetcher(5, false)
+		f.SetWorkers(workers)
+		certs, err := f.FetchFromDirectory(dir, nil)
+		if err != nil {
+			t.Fatalf("FetchFromDirectory: %v", err)
+		}
+		if len(certs) != len(want) {
+			t.Fatalf("got %d certificates, want %d", len(certs), len(want))
+		}
+		for i, c := range certs {
+			if GetCertificateFingerprint(c) != want[i] {
+				t.Fatalf("certificate %d out of order with %d workers", i, workers)
+			}
+		}
+	}
+}
+
+func TestDirectoryWorkers(t *testing.T) {
+	if n := directoryWorkers(100, 1); n != 1 {
+		t.Errorf("limit 1 gave %d workers", n)
+	}
+	if n := directoryWorkers(2, 8); n != 2 {
+		t.Errorf("2 files gave %d workers", n)
+	}
+	if n := directoryWorkers(1000, 0); n < 1 {
+		t.Errorf("no limit gave %d workers", n)
+	}
+}
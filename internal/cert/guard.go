@@ -0,0 +1,90 @@
+package cert
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// htmlMediaTypes are never certificate bundles; they are almost always an
+// error page or a captive portal / SSO login page served in place of the bundle
+var htmlMediaTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+}
+
+// checkContentType rejects HTML responses and, when allowed is non-empty,
+// any media type not listed in it
+func checkContentType(url string, resp *http.Response, allowed []string) error {
+	header := resp.Header.Get("Content-Type")
+	if header == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(header))
+	}
+
+	if htmlMediaTypes[mediaType] {
+		return fmt.Errorf("server returned an HTML page (%s) instead of certificates%s; check the URL and whether a proxy, captive portal or login page intercepted the request", mediaType, redirectNote(url, resp))
+	}
+
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimSpace(a), mediaType) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected content type %s (allowed: %s)%s", mediaType, strings.Join(allowed, ", "), redirectNote(url, resp))
+}
+
+// redirectNote names the final URL when the request was redirected
+func redirectNote(url string, resp *http.Response) string {
+	if resp.Request == nil || resp.Request.URL == nil || resp.Request.URL.String() == url {
+		return ""
+	}
+	return fmt.Sprintf(" after redirect to %s", resp.Request.URL.String())
+}
+
+// headRecorder keeps the first bytes read so a source that contained no
+// certificates can be described in the error
+type headRecorder struct {
+	r    io.Reader
+	head []byte
+}
+
+const headRecorderSize = 64
+
+func (h *headRecorder) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if room := headRecorderSize - len(h.head); room > 0 && n > 0 {
+		if n < room {
+			room = n
+		}
+		h.head = append(h.head, p[:room]...)
+	}
+	return n, err
+}
+
+// describe summarizes the recorded content, e.g. ` (content starts with "<!DOCTYPE html>")`
+func (h *headRecorder) describe() string {
+	text := strings.TrimSpace(string(h.head))
+	if text == "" {
+		return " (source is empty)"
+	}
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return ' '
+	}, text)
+	if lower := strings.ToLower(text); strings.HasPrefix(lower, "<!doctype html") || strings.HasPrefix(lower, "<html") {
+		return fmt.Sprintf(" (content is an HTML page: %q)", text)
+	}
+	return fmt.Sprintf(" (content starts with %q)", text)
+}
@@ -0,0 +1,60 @@
+package cert
+
+import (
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchURLGuards(t *testing.T) {
+	c := newRSACertificate(t, 1024, nil)
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bundle.pem", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		_, _ = w.Write(bundle)
+	})
+	mux.HandleFunc("/portal", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<!DOCTYPE html><html>Sign in</html>"))
+	})
+	mux.HandleFunc("/intercepted.pem", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/portal", http.StatusFound)
+	})
+	mux.HandleFunc("/mislabelled.pem", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("<html><body>Not Found</body></html>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := NewFetcher(5, false)
+
+	if certs, err := f.FetchURL(server.URL+"/bundle.pem", FetchOptions{ContentTypes: []string{"application/x-pem-file"}}); err != nil || len(certs) != 1 {
+		t.Fatalf("FetchURL = %d, %v", len(certs), err)
+	}
+
+	_, err := f.FetchURL(server.URL+"/intercepted.pem", FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "HTML page") || !strings.Contains(err.Error(), "redirect to "+server.URL+"/portal") {
+		t.Errorf("expected HTML redirect diagnostic, got %v", err)
+	}
+
+	_, err = f.FetchURL(server.URL+"/bundle.pem", FetchOptions{ContentTypes: []string{"text/plain"}})
+	if err == nil || !strings.Contains(err.Error(), "unexpected content type application/x-pem-file") {
+		t.Errorf("expected content type rejection, got %v", err)
+	}
+
+	_, err = f.FetchURL(server.URL+"/mislabelled.pem", FetchOptions{})
+	if err == nil || !strings.Contains(err.Error(), "content is an HTML page") {
+		t.Errorf("expected sniffed HTML diagnostic, got %v", err)
+	}
+
+	_, err = f.FetchURL(server.URL+"/bundle.pem", FetchOptions{MaxBytes: 100})
+	if !errors.Is(err, ErrBundleTooLarge) {
+		t.Errorf("expected ErrBundleTooLarge, got %v", err)
+	}
+}
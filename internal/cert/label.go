@@ -0,0 +1,85 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// LabelData is the data available to label templates, e.g.
+// "corp-{{.CommonName}}-{{.ShortFingerprint}}"
+type LabelData struct {
+	CommonName       string
+	Subject          string
+	Organization     string
+	Serial           string
+	Fingerprint      string // SHA-256, lowercase hex
+	ShortFingerprint string // first 16 hex characters of Fingerprint
+	Source           string // configured source name
+}
+
+// Labeler assigns the alias/friendly name a certificate is installed under in
+// stores that support one (Java keystore aliases, Windows friendly names,
+// keychain labels). Explicit labels keyed by fingerprint take precedence over
+// the template; a nil Labeler assigns no labels.
+type Labeler struct {
+	tmpl     *template.Template
+	explicit map[string]string
+}
+
+// NewLabeler parses a label template and the explicit fingerprint to label
+// mapping. Both may be empty.
+func NewLabeler(tmpl string, explicit map[string]string) (*Labeler, error) {
+	if tmpl == "" && len(explicit) == 0 {
+		return nil, nil
+	}
+
+	l := &Labeler{explicit: make(map[string]string, len(explicit))}
+	for fp, label := range explicit {
+		l.explicit[normalizeFingerprint(fp)] = label
+	}
+	if tmpl != "" {
+		parsed, err := template.New("label").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label template: %w", err)
+		}
+		l.tmpl = parsed
+	}
+	return l, nil
+}
+
+// Label returns the label for a certificate from the named source, or "" when
+// none is configured for it
+func (l *Labeler) Label(c *x509.Certificate, source string) (string, error) {
+	if l == nil {
+		return "", nil
+	}
+
+	fingerprint := GetCertificateFingerprint(c)
+	if label, ok := l.explicit[fingerprint]; ok {
+		return label, nil
+	}
+	if l.tmpl == nil {
+		return "", nil
+	}
+
+	data := LabelData{
+		CommonName:       c.Subject.CommonName,
+		Subject:          c.Subject.String(),
+		Serial:           c.SerialNumber.String(),
+		Fingerprint:      fingerprint,
+		ShortFingerprint: fingerprint[:16],
+		Source:           source,
+	}
+	if len(c.Subject.Organization) > 0 {
+		data.Organization = c.Subject.Organization[0]
+	}
+
+	var buf bytes.Buffer
+	if err := l.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render label: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
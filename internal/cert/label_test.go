@@ -0,0 +1,34 @@
+package cert
+
+import "testing"
+
+func TestLabeler(t *testing.T) {
+	c := newRSACertificate(t, 2048, nil)
+	fingerprint := GetCertificateFingerprint(c)
+
+	labeler, err := NewLabeler("corp-{{.CommonName}}-{{.ShortFingerprint}}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	label, err := labeler.Label(c, "corp")
+	if err != nil || label != "corp-Policy Test Root-"+fingerprint[:16] {
+		t.Errorf("Label = %q, %v", label, err)
+	}
+
+	labeler, err = NewLabeler("{{.CommonName}}", map[string]string{"  " + fingerprint + " ": "pinned"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label, _ := labeler.Label(c, "corp"); label != "pinned" {
+		t.Errorf("explicit label not preferred, got %q", label)
+	}
+
+	if _, err := NewLabeler("{{.Unknown", nil); err == nil {
+		t.Error("expected error for malformed template")
+	}
+
+	var none *Labeler
+	if label, err := none.Label(c, "corp"); label != "" || err != nil {
+		t.Errorf("nil Labeler = %q, %v", label, err)
+	}
+}
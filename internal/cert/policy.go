@@ -0,0 +1,104 @@
+package cert
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// ValidationPolicy controls which certificates are acceptable for installation
+type ValidationPolicy struct {
+	RequireCA         bool
+	RejectSHA1        bool
+	MinRSAKeyBits     int
+	RejectUnusualEKUs bool
+	AllowedEKUs       []x509.ExtKeyUsage
+	AllowList         []string // SHA-256 fingerprints exempt from the algorithm and EKU checks
+}
+
+// extKeyUsageNames maps configuration names to extended key usages
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"any":              x509.ExtKeyUsageAny,
+	"server-auth":      x509.ExtKeyUsageServerAuth,
+	"client-auth":      x509.ExtKeyUsageClientAuth,
+	"code-signing":     x509.ExtKeyUsageCodeSigning,
+	"email-protection": x509.ExtKeyUsageEmailProtection,
+	"time-stamping":    x509.ExtKeyUsageTimeStamping,
+	"ocsp-signing":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// ParseExtKeyUsages converts configured EKU names to x509 extended key usages
+func ParseExtKeyUsages(names []string) ([]x509.ExtKeyUsage, error) {
+	var usages []x509.ExtKeyUsage
+	for _, name := range names {
+		usage, ok := extKeyUsageNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown extended key usage: %s", name)
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// IsAllowListed reports whether the certificate is exempt from the policy checks
+func (p ValidationPolicy) IsAllowListed(cert *x509.Certificate) bool {
+	fp := GetCertificateFingerprint(cert)
+	for _, allowed := range p.AllowList {
+		if strings.EqualFold(normalizeFingerprint(allowed), fp) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check applies the algorithm, key size and EKU rules to a certificate
+func (p ValidationPolicy) Check(cert *x509.Certificate) error {
+	if p.IsAllowListed(cert) {
+		return nil
+	}
+
+	switch cert.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA:
+		return fmt.Errorf("certificate uses a broken signature algorithm (%s)", cert.SignatureAlgorithm)
+	case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		if p.RejectSHA1 {
+			return fmt.Errorf("certificate uses a SHA-1 signature (%s)", cert.SignatureAlgorithm)
+		}
+	}
+
+	if rsaKey, ok := cert.PublicKey.(*rsa.PublicKey); ok && p.MinRSAKeyBits > 0 {
+		if bits := rsaKey.N.BitLen(); bits < p.MinRSAKeyBits {
+			return fmt.Errorf("certificate RSA key is %d bits, minimum is %d", bits, p.MinRSAKeyBits)
+		}
+	}
+
+	if p.RejectUnusualEKUs {
+		if len(cert.UnknownExtKeyUsage) > 0 {
+			return fmt.Errorf("certificate has unrecognized extended key usages %v", cert.UnknownExtKeyUsage)
+		}
+		for _, usage := range cert.ExtKeyUsage {
+			if !containsExtKeyUsage(p.AllowedEKUs, usage) {
+				return fmt.Errorf("certificate has disallowed extended key usage %d", usage)
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsExtKeyUsage(usages []x509.ExtKeyUsage, usage x509.ExtKeyUsage) bool {
+	for _, u := range usages {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeFingerprint strips separators so "AB:CD" and "abcd" compare equal
+func normalizeFingerprint(fp string) string {
+	fp = strings.ReplaceAll(fp, ":", "")
+	fp = strings.ReplaceAll(fp, " ", "")
+	return strings.ToLower(strings.TrimSpace(fp))
+}
@@ -0,0 +1,69 @@
+package cert
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newRSACertificate(t *testing.T, bits int, ekus []x509.ExtKeyUsage) *x509.Certificate {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Policy Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtKeyUsage:           ekus,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return c
+}
+
+func TestValidationPolicyCheck(t *testing.T) {
+	policy := ValidationPolicy{
+		RejectSHA1:        true,
+		MinRSAKeyBits:     2048,
+		RejectUnusualEKUs: true,
+		AllowedEKUs:       []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	strong := newRSACertificate(t, 2048, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+	if err := policy.Check(strong); err != nil {
+		t.Fatalf("expected 2048-bit server-auth root to pass: %v", err)
+	}
+
+	weak := newRSACertificate(t, 1024, nil)
+	if err := policy.Check(weak); err == nil {
+		t.Fatalf("expected 1024-bit RSA key to be rejected")
+	}
+
+	unusual := newRSACertificate(t, 2048, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning})
+	if err := policy.Check(unusual); err == nil {
+		t.Fatalf("expected disallowed EKU to be rejected")
+	}
+
+	policy.AllowList = []string{GetCertificateFingerprint(weak)}
+	if err := policy.Check(weak); err != nil {
+		t.Fatalf("expected allow-listed certificate to pass: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// LoadPinnedCAs reads the PEM file of CA certificates a source's TLS server
+// chain must verify against
+func LoadPinnedCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pinned CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in pinned CA file %s", path)
+	}
+	return pool, nil
+}
+
+// CheckCaptivePortal requests a connectivity check URL that must answer
+// 204 No Content with an empty body, such as
+// http://connectivitycheck.gstatic.com/generate_204. A redirect or any other
+// answer means a captive portal or intercepting proxy is in the path, and
+// sources fetched over this network should not be trusted.
+func (f *Fetcher) CheckCaptivePortal(url string) error {
+	client := &http.Client{
+		Timeout:   f.httpClient.Timeout,
+		Transport: f.httpClient.Transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("connectivity check %s failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if location := resp.Header.Get("Location"); resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return fmt.Errorf("captive portal detected: connectivity check %s redirected to %s", url, location)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1))
+	if resp.StatusCode != http.StatusNoContent || len(body) > 0 {
+		return fmt.Errorf("captive portal or intercepting proxy detected: connectivity check %s returned HTTP %d with content", url, resp.StatusCode)
+	}
+	return nil
+}
+
+func isTLSVerificationError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	return errors.As(err, &verifyErr) || errors.As(err, &authorityErr)
+}
@@ -0,0 +1,62 @@
+package cert
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckCaptivePortal(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate_204", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/portal_204", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://portal.example/login", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := NewFetcher(5, false)
+	if err := f.CheckCaptivePortal(server.URL + "/generate_204"); err != nil {
+		t.Errorf("clean network reported as intercepted: %v", err)
+	}
+	if err := f.CheckCaptivePortal(server.URL + "/portal_204"); err == nil || !strings.Contains(err.Error(), "portal.example") {
+		t.Errorf("expected captive portal detection, got %v", err)
+	}
+}
+
+func TestFetchURLPinnedCAAndDigest(t *testing.T) {
+	c := newRSACertificate(t, 1024, nil)
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bundle)
+	}))
+	defer server.Close()
+
+	f := NewFetcher(5, false)
+	serverRoots := x509.NewCertPool()
+	serverRoots.AddCert(server.Certificate())
+	digest := sha256.Sum256(bundle)
+
+	certs, err := f.FetchURL(server.URL, FetchOptions{PinnedCAs: serverRoots, SHA256: hex.EncodeToString(digest[:])})
+	if err != nil || len(certs) != 1 {
+		t.Fatalf("FetchURL with matching pin = %d, %v", len(certs), err)
+	}
+
+	// The test server's certificate doesn't chain to an unrelated root, as with a MITM proxy
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(c)
+	if _, err := f.FetchURL(server.URL, FetchOptions{PinnedCAs: otherRoots}); err == nil || !strings.Contains(err.Error(), "intercepted") {
+		t.Errorf("expected interception error, got %v", err)
+	}
+
+	if _, err := f.FetchURL(server.URL, FetchOptions{PinnedCAs: serverRoots, SHA256: strings.Repeat("0", 64)}); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected digest mismatch, got %v", err)
+	}
+}
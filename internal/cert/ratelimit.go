@@ -0,0 +1,140 @@
+package cert
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent identifies the tool to bundle endpoints when no
+// settings.user_agent is configured
+const DefaultUserAgent = "trust-store-updater"
+
+// DefaultMaxRetryAfter is the longest Retry-After the fetcher waits out
+// before giving up on a source
+const DefaultMaxRetryAfter = 5 * time.Minute
+
+// sleep is replaced in tests
+var sleep = time.Sleep
+
+// rateLimiter spaces requests at least interval apart
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// limiters are shared by every fetcher in the process, so a daemon running
+// an update on a schedule stays within the limits across runs
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*rateLimiter)
+)
+
+// limiterFor returns the process-wide limiter for key allowing perMinute
+// requests a minute, or nil when perMinute is 0
+func limiterFor(key string, perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[key]
+	if !ok {
+		l = &rateLimiter{}
+		limiters[key] = l
+	}
+	l.mu.Lock()
+	l.interval = time.Minute / time.Duration(perMinute)
+	l.mu.Unlock()
+	return l
+}
+
+// wait blocks until the next request may be made and reserves its slot
+func (l *rateLimiter) wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	if d := at.Sub(now); d > 0 {
+		sleep(d)
+	}
+}
+
+// delay pushes the next request back by d, as when a server asks callers to
+// retry later
+func (l *rateLimiter) delay(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if at := time.Now().Add(d); at.After(l.next) {
+		l.next = at
+	}
+}
+
+// SetUserAgent sets the User-Agent header sent with every request
+func (f *Fetcher) SetUserAgent(userAgent string) {
+	if userAgent != "" {
+		f.userAgent = userAgent
+	}
+}
+
+// SetRateLimit limits requests from all fetchers in the process to
+// perMinute a minute; 0 removes the limit
+func (f *Fetcher) SetRateLimit(perMinute int) {
+	f.limiter = limiterFor("global", perMinute)
+}
+
+// SetRetries sets how many times a request answered 429 Too Many Requests
+// or 503 Service Unavailable is retried, and the longest Retry-After waited
+// out before giving up instead
+func (f *Fetcher) SetRetries(retries int, maxRetryAfter time.Duration) {
+	if retries >= 0 {
+		f.retries = retries
+	}
+	if maxRetryAfter > 0 {
+		f.maxRetryAfter = maxRetryAfter
+	}
+}
+
+// retryable reports whether a status asks the client to come back later
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryAfter is how long a response asks to wait before retrying: its
+// Retry-After in seconds or as an HTTP date, or else an exponential backoff
+// from one second for the given attempt
+func retryAfter(resp *http.Response, attempt int, now time.Time) time.Duration {
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			if d := at.Sub(now); d > 0 {
+				return d
+			}
+			return 0
+		}
+	}
+	return time.Second << attempt
+}
+
+// retryError reports a source that stayed rate limited or unavailable
+func retryError(status int, wait, maxWait time.Duration) error {
+	if wait > maxWait {
+		return fmt.Errorf("HTTP request failed with status %d; the server asked to retry after %s, longer than the %s allowed", status, wait, maxWait)
+	}
+	return fmt.Errorf("HTTP request failed with status %d after retrying", status)
+}
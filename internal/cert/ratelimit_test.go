@@ -0,0 +1,95 @@
+package cert
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterHonored(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	c := newRSACertificate(t, 1024, nil)
+	requests := 0
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		userAgent = r.Header.Get("User-Agent")
+		if requests == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(5, false)
+	f.SetUserAgent("fleet-agent/2")
+	f.SetRetries(3, time.Minute)
+	certs, err := f.FetchURL(server.URL, FetchOptions{})
+	if err != nil {
+		t.Fatalf("FetchURL: %v", err)
+	}
+	if len(certs) != 1 || requests != 2 {
+		t.Errorf("got %d certificates after %d requests, want 1 after 2", len(certs), requests)
+	}
+	if len(slept) == 0 || slept[len(slept)-1] != 7*time.Second {
+		t.Errorf("slept %v, want the 7s Retry-After", slept)
+	}
+	if userAgent != "fleet-agent/2" {
+		t.Errorf("User-Agent = %q", userAgent)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	sleep = func(time.Duration) { t.Error("waited out a Retry-After beyond the limit") }
+	defer func() { sleep = time.Sleep }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	f := NewFetcher(5, false)
+	f.SetRetries(3, time.Minute)
+	if _, err := f.FetchURL(server.URL, FetchOptions{}); err == nil || !strings.Contains(err.Error(), "retry after 1h0m0s") {
+		t.Errorf("expected the long Retry-After to fail the fetch, got %v", err)
+	}
+}
+
+func TestRetryAfterDate(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	resp := &http.Response{Header: http.Header{"Retry-After": {now.Add(90 * time.Second).Format(http.TimeFormat)}}}
+	if got := retryAfter(resp, 0, now); got != 90*time.Second {
+		t.Errorf("retryAfter = %s, want 1m30s", got)
+	}
+	if got := retryAfter(&http.Response{Header: http.Header{}}, 2, now); got != 4*time.Second {
+		t.Errorf("backoff = %s, want 4s", got)
+	}
+}
+
+func TestRateLimiterSpacesRequests(t *testing.T) {
+	var slept time.Duration
+	sleep = func(d time.Duration) { slept += d }
+	defer func() { sleep = time.Sleep }()
+
+	l := limiterFor("test:spacing", 60)
+	for i := 0; i < 3; i++ {
+		l.wait()
+	}
+	// The first request goes at once; with the clock standing still the
+	// second waits 1s and the third 2s for their slots
+	if slept < 3*time.Second-100*time.Millisecond || slept > 3*time.Second {
+		t.Errorf("slept %s for 3 requests at 60/minute, want 3s", slept)
+	}
+	if limiterFor("test:none", 0) != nil {
+		t.Error("a zero limit should not limit")
+	}
+}
@@ -0,0 +1,208 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Resolver options let a url source be fetched on hosts whose normal DNS
+// path is broken until the CA the tool installs is trusted, e.g. a resolver
+// or proxy behind TLS inspection during provisioning. Only the connection
+// address changes: TLS is still verified against the URL's host name.
+
+// sourceClient returns the client for a url source: the fetcher's own, or
+// one that trusts only the pinned CAs and resolves through the configured
+// static addresses or DNS-over-HTTPS resolver
+func (f *Fetcher) sourceClient(opts FetchOptions) *http.Client {
+	if opts.PinnedCAs == nil && len(opts.Resolve) == 0 && opts.DoHResolver == "" {
+		return f.httpClient
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.PinnedCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: opts.PinnedCAs}
+	}
+	if len(opts.Resolve) > 0 || opts.DoHResolver != "" {
+		lookup := func(ctx context.Context, host string) ([]string, error) {
+			if addr, ok := opts.Resolve[strings.ToLower(host)]; ok {
+				return []string{addr}, nil
+			}
+			if opts.DoHResolver != "" {
+				return f.lookupDoH(ctx, opts.DoHResolver, host)
+			}
+			return net.DefaultResolver.LookupHost(ctx, host)
+		}
+		transport.DialContext = dialVia(lookup)
+	}
+	return &http.Client{Timeout: f.httpClient.Timeout, Transport: transport}
+}
+
+// dialVia dials the first reachable address lookup returns for the host
+func dialVia(lookup func(ctx context.Context, host string) ([]string, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		ips, err := lookup(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses for %s", host)
+		}
+		return nil, lastErr
+	}
+}
+
+// DNS record types looked up over DoH
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+// lookupDoH resolves host's IPv4 and IPv6 addresses with an RFC 8484
+// DNS-over-HTTPS resolver such as https://1.1.1.1/dns-query. Naming the
+// resolver by IP address keeps the lookup itself off the system DNS.
+func (f *Fetcher) lookupDoH(ctx context.Context, resolver, host string) ([]string, error) {
+	var addrs []string
+	var errs []error
+	for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		found, err := f.queryDoH(ctx, resolver, host, qtype)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		addrs = append(addrs, found...)
+	}
+	if len(addrs) == 0 {
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+		return nil, fmt.Errorf("DNS-over-HTTPS resolver %s returned no addresses for %s", resolver, host)
+	}
+	return addrs, nil
+}
+
+func (f *Fetcher) queryDoH(ctx context.Context, resolver, host string, qtype uint16) ([]string, error) {
+	query, err := dnsQuery(host, qtype)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", resolver, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("User-Agent", f.userAgent)
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DNS-over-HTTPS query to %s failed: %w", resolver, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS resolver %s answered %d", resolver, resp.StatusCode)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	return parseDNSAnswer(answer, qtype)
+}
+
+// dnsQuery encodes a recursive query for one record type of host
+func dnsQuery(host string, qtype uint16) ([]byte, error) {
+	// ID 0 as RFC 8484 recommends for caching; RD set; one question
+	msg := []byte{0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid host name %q", host)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, 1), nil // class IN
+}
+
+// parseDNSAnswer returns the addresses of qtype records in a DNS response
+func parseDNSAnswer(msg []byte, qtype uint16) ([]string, error) {
+	errMalformed := errors.New("malformed DNS response")
+	if len(msg) < 12 {
+		return nil, errMalformed
+	}
+	if rcode := msg[3] & 0x0f; rcode != 0 {
+		if rcode == 3 {
+			return nil, errors.New("no such host")
+		}
+		return nil, fmt.Errorf("DNS query failed with rcode %d", rcode)
+	}
+	questions := binary.BigEndian.Uint16(msg[4:6])
+	answers := binary.BigEndian.Uint16(msg[6:8])
+
+	off := 12
+	for i := 0; i < int(questions); i++ {
+		if off = skipDNSName(msg, off); off < 0 || off+4 > len(msg) {
+			return nil, errMalformed
+		}
+		off += 4
+	}
+
+	var addrs []string
+	for i := 0; i < int(answers); i++ {
+		if off = skipDNSName(msg, off); off < 0 || off+10 > len(msg) {
+			return nil, errMalformed
+		}
+		rtype := binary.BigEndian.Uint16(msg[off:])
+		length := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+length > len(msg) {
+			return nil, errMalformed
+		}
+		// CNAME records come first and are followed by the target's addresses
+		if rtype == qtype && (length == net.IPv4len || length == net.IPv6len) {
+			addrs = append(addrs, net.IP(msg[off:off+length]).String())
+		}
+		off += length
+	}
+	return addrs, nil
+}
+
+// skipDNSName returns the offset after the name at off, or -1
+func skipDNSName(msg []byte, off int) int {
+	for off < len(msg) {
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			return off + 1
+		case n&0xc0 == 0xc0: // compression pointer ends the name
+			return off + 2
+		default:
+			off += n + 1
+		}
+	}
+	return -1
+}
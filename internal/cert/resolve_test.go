@@ -0,0 +1,80 @@
+package cert
+
+import (
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// dohAnswer answers a DNS query with one A record for 127.0.0.1
+func dohAnswer(query []byte) []byte {
+	resp := append([]byte(nil), query...)
+	resp[2] |= 0x80                          // QR: response
+	binary.BigEndian.PutUint16(resp[6:8], 1) // one answer
+	if binary.BigEndian.Uint16(query[len(query)-4:]) != dnsTypeA {
+		binary.BigEndian.PutUint16(resp[6:8], 0)
+		return resp
+	}
+	resp = append(resp, 0xc0, 12)          // name: pointer to the question
+	resp = append(resp, 0, dnsTypeA, 0, 1) // type A, class IN
+	resp = append(resp, 0, 0, 0, 60, 0, 4) // TTL, length
+	return append(resp, 127, 0, 0, 1)
+}
+
+func TestFetchURLResolvers(t *testing.T) {
+	c := newRSACertificate(t, 1024, nil)
+	bundle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}))
+	defer bundle.Close()
+	u, _ := url.Parse(bundle.URL)
+	_, port, _ := net.SplitHostPort(u.Host)
+	// .invalid never resolves through the system DNS
+	source := "http://bundle.invalid:" + port + "/ca.pem"
+
+	var dohQueries int
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dohQueries++
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(dohAnswer(query))
+	}))
+	defer doh.Close()
+
+	f := NewFetcher(5, false)
+	if _, err := f.FetchURL(source, FetchOptions{}); err == nil {
+		t.Fatal("fetched from a .invalid host without a resolver override")
+	}
+	if certs, err := f.FetchURL(source, FetchOptions{Resolve: map[string]string{"bundle.invalid": "127.0.0.1"}}); err != nil || len(certs) != 1 {
+		t.Errorf("static resolve: %d certificates, %v", len(certs), err)
+	}
+	if certs, err := f.FetchURL(source, FetchOptions{DoHResolver: doh.URL}); err != nil || len(certs) != 1 {
+		t.Errorf("DoH: %d certificates, %v", len(certs), err)
+	}
+	if dohQueries == 0 {
+		t.Error("the DoH resolver was never queried")
+	}
+}
+
+func TestParseDNSAnswerNXDomain(t *testing.T) {
+	query, err := dnsQuery("missing.example", dnsTypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query[3] |= 3 // NXDOMAIN
+	if _, err := parseDNSAnswer(query, dnsTypeA); err == nil {
+		t.Error("NXDOMAIN parsed as an answer")
+	}
+	if _, err := parseDNSAnswer(query[:5], dnsTypeA); err == nil {
+		t.Error("truncated response parsed")
+	}
+}
@@ -0,0 +1,119 @@
+package cert
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// resumingBody reads a URL source's response body and, when the connection
+// drops part way, requests the rest with a Range request instead of starting
+// over, up to max_retries times, so large bundles still arrive over flaky
+// links. The resumed bytes continue the same stream, so the bundle's SHA-256
+// covers the whole download and is checked against the source's sha256 as
+// usual.
+type resumingBody struct {
+	f         *Fetcher
+	client    *http.Client
+	url       string
+	headers   map[string]string
+	perMinute int
+
+	body      io.ReadCloser
+	read      int64
+	validator string // ETag or Last-Modified, so a changed file isn't spliced
+	resumes   int
+}
+
+// newResumingBody wraps resp's body; resumption is only attempted when the
+// server accepts byte ranges and identifies the version being downloaded
+func (f *Fetcher) newResumingBody(client *http.Client, url string, opts FetchOptions, resp *http.Response) io.ReadCloser {
+	validator := resp.Header.Get("ETag")
+	if strings.HasPrefix(validator, "W/") {
+		validator = "" // weak validators can't be used with If-Range
+	}
+	if validator == "" {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" || validator == "" {
+		return resp.Body
+	}
+	return &resumingBody{
+		f:         f,
+		client:    client,
+		url:       url,
+		headers:   opts.Headers,
+		perMinute: opts.RequestsPerMinute,
+		body:      resp.Body,
+		validator: validator,
+	}
+}
+
+func (r *resumingBody) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.read += int64(n)
+		if err == nil || errors.Is(err, io.EOF) || r.resumes >= r.f.retries {
+			return n, err
+		}
+		r.f.warnf("download of %s interrupted after %d bytes (%v), resuming", r.url, r.read, err)
+		if resumeErr := r.resume(); resumeErr != nil {
+			return n, fmt.Errorf("%w; resuming failed: %v", err, resumeErr)
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume requests the bytes after those already read
+func (r *resumingBody) resume() error {
+	r.resumes++
+	r.body.Close()
+	r.body = http.NoBody
+
+	headers := map[string]string{
+		"Range":    fmt.Sprintf("bytes=%d-", r.read),
+		"If-Range": r.validator,
+	}
+	for key, value := range r.headers {
+		headers[key] = value
+	}
+	resp, err := r.f.open(r.client, r.url, headers, r.perMinute)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		// The bundle changed since the download started, so the ranges
+		// can't be joined
+		resp.Body.Close()
+		return fmt.Errorf("%s changed during the download", r.url)
+	}
+	if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != r.read {
+		resp.Body.Close()
+		return fmt.Errorf("server resumed %s at the wrong offset (%q)", r.url, resp.Header.Get("Content-Range"))
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *resumingBody) Close() error {
+	return r.body.Close()
+}
+
+// contentRangeStart parses the first byte position of "bytes 100-199/200"
+func contentRangeStart(value string) (int64, bool) {
+	rest, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	return start, err == nil
+}
@@ -0,0 +1,85 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchURLResumesInterruptedDownload(t *testing.T) {
+	var bundle []byte
+	for i := 0; i < 20; i++ {
+		c := newRSACertificate(t, 1024, nil)
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	digest := sha256.Sum256(bundle)
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("Range") == "" {
+			// Promise the whole bundle, send a third and drop the connection
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(bundle)))
+			_, _ = w.Write(bundle[:len(bundle)/3])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "ca.pem", time.Time{}, bytes.NewReader(bundle))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(5, false)
+	f.SetRetries(2, time.Minute)
+	got, err := f.FetchURLBundle(server.URL, FetchOptions{SHA256: hex.EncodeToString(digest[:])})
+	if err != nil {
+		t.Fatalf("FetchURLBundle: %v", err)
+	}
+	if len(got.Certificates) != 20 {
+		t.Errorf("got %d certificates, want 20", len(got.Certificates))
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes="+strconv.Itoa(len(bundle)/3)+"-" {
+		t.Errorf("range requests = %v, want one from byte %d", ranges, len(bundle)/3)
+	}
+}
+
+func TestFetchURLRefusesChangedBundleOnResume(t *testing.T) {
+	bundle := bytes.Repeat([]byte("# comment line\n"), 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "" {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(bundle)))
+			_, _ = w.Write(bundle[:100])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		// A new version: If-Range no longer matches, so the whole file is sent
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "ca.pem", time.Time{}, bytes.NewReader(bundle))
+	}))
+	defer server.Close()
+
+	f := NewFetcher(5, false)
+	f.SetRetries(2, time.Minute)
+	if _, err := f.FetchURLBundle(server.URL, FetchOptions{}); err == nil || !strings.Contains(err.Error(), "changed during the download") {
+		t.Errorf("expected ranges of two versions to be refused, got %v", err)
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	if start, ok := contentRangeStart("bytes 100-199/200"); !ok || start != 100 {
+		t.Errorf("got %d, %v", start, ok)
+	}
+	if _, ok := contentRangeStart("items 1-2/3"); ok {
+		t.Error("parsed a non-byte range")
+	}
+}
@@ -0,0 +1,108 @@
+package cert
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+// DefaultMaxBundleBytes bounds how much of a source is read when no limit is configured
+const DefaultMaxBundleBytes = 50 << 20
+
+// ErrBundleTooLarge is returned when a source exceeds the configured maximum bundle size
+var ErrBundleTooLarge = errors.New("certificate bundle exceeds maximum size")
+
+// StreamCertificates decodes certificates from r one at a time, calling fn for
+// each, so only the certificate being decoded is held in memory. Input is
+// treated as a PEM bundle unless it starts with a DER SEQUENCE. Reading stops
+// with ErrBundleTooLarge after maxBytes (DefaultMaxBundleBytes if <= 0).
+// Unparseable certificates are skipped; an error from fn stops the stream.
+// It returns the number of certificates passed to fn.
+func (f *Fetcher) StreamCertificates(r io.Reader, maxBytes int64, fn func(*x509.Certificate) error) (int, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBundleBytes
+	}
+	br := bufio.NewReader(&limitedReader{r: r, remaining: maxBytes})
+
+	// A single DER certificate rather than a PEM bundle
+	if first, err := br.Peek(1); err == nil && first[0] == 0x30 {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return 0, err
+		}
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return 0, nil
+		}
+		return 1, fn(cert)
+	}
+
+	count := 0
+	var body bytes.Buffer
+	inBlock := false
+	for {
+		line, readErr := br.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return count, readErr
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "-----BEGIN CERTIFICATE-----":
+			inBlock = true
+			body.Reset()
+		case inBlock && strings.HasPrefix(trimmed, "-----END "):
+			inBlock = false
+			der, err := base64.StdEncoding.DecodeString(body.String())
+			if err != nil {
+				f.warnf("Failed to decode certificate: %v", err)
+				break
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				f.warnf("Failed to parse certificate: %v", err)
+				break
+			}
+			count++
+			if err := fn(cert); err != nil {
+				return count, err
+			}
+		case inBlock && !strings.Contains(trimmed, ":"):
+			// Lines with a colon are RFC 1421 headers, not base64
+			body.WriteString(trimmed)
+		}
+
+		if readErr == io.EOF {
+			return count, nil
+		}
+	}
+}
+
+// limitedReader is io.LimitedReader that fails instead of reporting EOF when
+// the limit is exceeded, so truncated bundles are never mistaken for complete ones
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Distinguish "exactly at the limit" from "more data follows"
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			return 0, ErrBundleTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,50 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestStreamCertificates(t *testing.T) {
+	first := newRSACertificate(t, 1024, nil)
+	second := newRSACertificate(t, 1024, nil)
+
+	var bundle bytes.Buffer
+	bundle.WriteString("# Mozilla CA bundle\r\n\r\n")
+	_ = pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: first.Raw})
+	_ = pem.Encode(&bundle, &pem.Block{Type: "X509 CRL", Bytes: []byte("ignored")})
+	bundle.WriteString("-----BEGIN CERTIFICATE-----\nnot base64!\n-----END CERTIFICATE-----\n")
+	_ = pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: second.Raw})
+
+	f := NewFetcher(5, false)
+	var got []*x509.Certificate
+	n, err := f.StreamCertificates(bytes.NewReader(bundle.Bytes()), 0, func(c *x509.Certificate) error {
+		got = append(got, c)
+		return nil
+	})
+	if err != nil || n != 2 || !got[0].Equal(first) || !got[1].Equal(second) {
+		t.Fatalf("StreamCertificates = %d, %v", n, err)
+	}
+
+	stop := errors.New("stop")
+	n, err = f.StreamCertificates(bytes.NewReader(bundle.Bytes()), 0, func(*x509.Certificate) error { return stop })
+	if n != 1 || err != stop {
+		t.Errorf("callback error did not stop the stream: %d, %v", n, err)
+	}
+
+	limit := int64(bundle.Len() - 1)
+	if _, err := f.StreamCertificates(bytes.NewReader(bundle.Bytes()), limit, func(*x509.Certificate) error { return nil }); !errors.Is(err, ErrBundleTooLarge) {
+		t.Errorf("expected ErrBundleTooLarge, got %v", err)
+	}
+	if _, err := f.StreamCertificates(bytes.NewReader(bundle.Bytes()), int64(bundle.Len()), func(*x509.Certificate) error { return nil }); err != nil {
+		t.Errorf("bundle exactly at the limit rejected: %v", err)
+	}
+
+	n, err = f.StreamCertificates(bytes.NewReader(first.Raw), 0, func(c *x509.Certificate) error { return nil })
+	if err != nil || n != 1 {
+		t.Errorf("DER certificate = %d, %v", n, err)
+	}
+}
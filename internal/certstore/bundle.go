@@ -0,0 +1,109 @@
+package certstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+)
+
+// BundleEntry is a certificate written to an annotated bundle along with the
+// source it came from, if known
+type BundleEntry struct {
+	Certificate *x509.Certificate
+	Source      string
+	Label       string // alias from the source's label template, if any
+}
+
+// EncodePEMBundle concatenates certificates into a PEM bundle
+func EncodePEMBundle(certs []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, c := range certs {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	return buf.Bytes()
+}
+
+// EncodeAnnotatedBundle writes a PEM bundle with a comment header per
+// certificate (subject, expiry, fingerprint and source) in a stable order, by
+// subject then fingerprint, so that diffs of a bundle kept in version control
+// show only real changes. Parsers skip the comment lines.
+func EncodeAnnotatedBundle(entries []BundleEntry) []byte {
+	sorted := make([]BundleEntry, len(entries))
+	copy(sorted, entries)
+	SortBundleEntries(sorted)
+
+	var buf bytes.Buffer
+	for i, e := range sorted {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "# Subject: %s\n", e.Certificate.Subject.String())
+		fmt.Fprintf(&buf, "# Not After: %s\n", e.Certificate.NotAfter.UTC().Format("2006-01-02"))
+		fmt.Fprintf(&buf, "# SHA256 Fingerprint: %s\n", bundleFingerprint(e.Certificate))
+		if e.Source != "" {
+			fmt.Fprintf(&buf, "# Source: %s\n", e.Source)
+		}
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: e.Certificate.Raw})
+	}
+	return buf.Bytes()
+}
+
+// EncodeManagedBundle is EncodeAnnotatedBundle for certificates without source information
+func EncodeManagedBundle(certs []*x509.Certificate) []byte {
+	entries := make([]BundleEntry, len(certs))
+	for i, c := range certs {
+		entries[i] = BundleEntry{Certificate: c}
+	}
+	return EncodeAnnotatedBundle(entries)
+}
+
+// SortBundleEntries orders entries by subject, then by fingerprint
+func SortBundleEntries(entries []BundleEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		si, sj := entries[i].Certificate.Subject.String(), entries[j].Certificate.Subject.String()
+		if si != sj {
+			return si < sj
+		}
+		return bundleFingerprint(entries[i].Certificate) < bundleFingerprint(entries[j].Certificate)
+	})
+}
+
+func bundleFingerprint(c *x509.Certificate) string {
+	hash := sha256.Sum256(c.Raw)
+	return hex.EncodeToString(hash[:])
+}
+
+// ParsePEMBundle parses every CERTIFICATE block in data, ignoring other block types
+func ParsePEMBundle(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in bundle: %w", err)
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+// ContainsCertificate reports whether certs holds a certificate byte-identical to c
+func ContainsCertificate(certs []*x509.Certificate, c *x509.Certificate) bool {
+	for _, existing := range certs {
+		if existing.Equal(c) {
+			return true
+		}
+	}
+	return false
+}
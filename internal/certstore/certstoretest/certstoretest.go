@@ -0,0 +1,168 @@
+// Package certstoretest provides fakes for testing stores on any OS: a
+// scripted Runner standing in for the tools a store shells out to, and
+// throwaway certificates to feed it
+package certstoretest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// Call is a command a Runner was asked to run
+type Call struct {
+	Name  string
+	Args  []string
+	Input []byte
+}
+
+// String returns the command line, as Runner.Responses keys it
+func (c Call) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Response is what a scripted command prints and returns
+type Response struct {
+	Stdout string
+	Stderr string
+	Err    error
+}
+
+// Runner is a certstore.Runner that answers commands from a script instead
+// of running them, recording each call
+type Runner struct {
+	// Responses answers commands by their full command line
+	Responses map[string]Response
+	// Handle answers commands missing from Responses; when nil they fail
+	Handle func(call Call) Response
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Respond scripts the output of a command line
+func (r *Runner) Respond(commandLine, stdout string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Responses == nil {
+		r.Responses = make(map[string]Response)
+	}
+	r.Responses[commandLine] = Response{Stdout: stdout}
+}
+
+// Fail scripts a command line to exit with an error, printing stderr
+func (r *Runner) Fail(commandLine, stderr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Responses == nil {
+		r.Responses = make(map[string]Response)
+	}
+	r.Responses[commandLine] = Response{Stderr: stderr, Err: errors.New("exit status 1")}
+}
+
+// Calls returns the commands run so far, in order
+func (r *Runner) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Ran reports whether a command line was run
+func (r *Runner) Ran(commandLine string) bool {
+	for _, call := range r.Calls() {
+		if call.String() == commandLine {
+			return true
+		}
+	}
+	return false
+}
+
+// Run implements certstore.Runner
+func (r *Runner) Run(name string, args ...string) ([]byte, error) {
+	return r.RunWithInput(nil, name, args...)
+}
+
+// RunWithInput implements certstore.Runner
+func (r *Runner) RunWithInput(input []byte, name string, args ...string) ([]byte, error) {
+	stdout, _, err := r.run(Call{Name: name, Args: args, Input: input})
+	return stdout, err
+}
+
+// RunCaptured implements certstore.Runner
+func (r *Runner) RunCaptured(name string, args ...string) (stdout, stderr []byte, err error) {
+	return r.run(Call{Name: name, Args: args})
+}
+
+func (r *Runner) run(call Call) ([]byte, []byte, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	response, ok := r.Responses[call.String()]
+	handle := r.Handle
+	r.mu.Unlock()
+
+	if !ok {
+		if handle == nil {
+			response = Response{Err: errors.New("no response scripted")}
+		} else {
+			response = handle(call)
+		}
+	}
+	if response.Err != nil {
+		return []byte(response.Stdout), []byte(response.Stderr), &certstore.CommandError{
+			Command: call.String(),
+			Stdout:  response.Stdout,
+			Stderr:  response.Stderr,
+			Err:     response.Err,
+		}
+	}
+	return []byte(response.Stdout), []byte(response.Stderr), nil
+}
+
+// NewCertificate returns a self-signed CA certificate named cn
+func NewCertificate(t testing.TB, cn string) *x509.Certificate {
+	t.Helper()
+	return NewCertificateWithSubject(t, pkix.Name{CommonName: cn})
+}
+
+// NewCertificateWithSubject returns a self-signed CA certificate with the
+// given subject, which is also its issuer
+func NewCertificateWithSubject(t testing.TB, subject pkix.Name) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return cert
+}
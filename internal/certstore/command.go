@@ -0,0 +1,185 @@
+package certstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultCommandTimeout bounds external store tooling when no timeout is configured
+const DefaultCommandTimeout = 5 * time.Minute
+
+// maxCapturedOutput limits how much command output is kept for error reports
+const maxCapturedOutput = 4096
+
+// CommandTimeoutSetter is implemented by stores that run external commands
+// such as update-ca-certificates, security or keytool
+type CommandTimeoutSetter interface {
+	// SetCommandTimeout bounds each external command run by the store
+	SetCommandTimeout(timeout time.Duration)
+}
+
+// Runner runs external tools. Stores take one so their command handling can
+// be tested on any OS with a scripted runner in place of CommandRunner.
+type Runner interface {
+	// Run executes name with args and returns its standard output
+	Run(name string, args ...string) ([]byte, error)
+	// RunWithInput is like Run but feeds input to the command's standard input
+	RunWithInput(input []byte, name string, args ...string) ([]byte, error)
+	// RunCaptured is like Run but also returns standard error
+	RunCaptured(name string, args ...string) (stdout, stderr []byte, err error)
+}
+
+// CommandRunner runs external tools with a timeout, capturing their output.
+// On timeout the whole process group is killed so helpers spawned by the tool
+// cannot keep it hanging.
+type CommandRunner struct {
+	Timeout time.Duration
+	Verbose bool
+	// Env adds KEY=value variables to the environment the tool inherits
+	Env []string
+}
+
+// CommandError is returned when an external command fails or times out. It
+// carries the captured output so the cause ends up in the run report.
+type CommandError struct {
+	Command  string
+	TimedOut bool
+	Stdout   string
+	Stderr   string
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("%s failed: %v", e.Command, e.Err)
+	if e.TimedOut {
+		msg = fmt.Sprintf("%s timed out", e.Command)
+	}
+
+	output := strings.TrimSpace(e.Stderr)
+	if output == "" {
+		output = strings.TrimSpace(e.Stdout)
+	}
+	if output != "" {
+		msg += ": " + strings.Join(strings.Fields(output), " ")
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// SetCommandTimeout bounds each command run from now on
+func (r *CommandRunner) SetCommandTimeout(timeout time.Duration) {
+	r.Timeout = timeout
+}
+
+// SetRunnerTimeout sets the timeout of runners that have one
+func SetRunnerTimeout(runner Runner, timeout time.Duration) {
+	if setter, ok := runner.(CommandTimeoutSetter); ok {
+		setter.SetCommandTimeout(timeout)
+	}
+}
+
+// WithEnv returns runner with vars added to the environment of the commands
+// it runs. Runners other than CommandRunner are returned as they are.
+func WithEnv(runner Runner, vars ...string) Runner {
+	switch r := runner.(type) {
+	case CommandRunner:
+		r.Env = append(append([]string{}, r.Env...), vars...)
+		return r
+	case *CommandRunner:
+		copied := *r
+		copied.Env = append(append([]string{}, r.Env...), vars...)
+		return copied
+	}
+	return runner
+}
+
+// Run executes name with args and returns its standard output
+func (r CommandRunner) Run(name string, args ...string) ([]byte, error) {
+	return r.RunWithInput(nil, name, args...)
+}
+
+// RunWithInput is like Run but feeds input to the command's standard input
+func (r CommandRunner) RunWithInput(input []byte, name string, args ...string) ([]byte, error) {
+	stdout, _, err := r.run(input, name, args...)
+	return stdout, err
+}
+
+// RunCaptured is like Run but also returns standard error, for tools that
+// report warnings there while still succeeding
+func (r CommandRunner) RunCaptured(name string, args ...string) (stdout, stderr []byte, err error) {
+	return r.run(nil, name, args...)
+}
+
+func (r CommandRunner) run(input []byte, name string, args ...string) ([]byte, []byte, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	configureProcessGroup(cmd)
+	if len(r.Env) > 0 {
+		cmd.Env = append(os.Environ(), r.Env...)
+	}
+	// Don't wait forever on pipes held open by orphaned grandchildren
+	cmd.WaitDelay = 5 * time.Second
+
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if r.Verbose {
+		cmd.Stdout = io.MultiWriter(&stdout, os.Stdout)
+		cmd.Stderr = io.MultiWriter(&stderr, os.Stderr)
+	}
+
+	if r.Verbose {
+		fmt.Printf("Running %s %s (timeout %s)\n", name, strings.Join(args, " "), timeout)
+	}
+	err := cmd.Run()
+	if err == nil {
+		return stdout.Bytes(), stderr.Bytes(), nil
+	}
+
+	cmdErr := &CommandError{
+		Command: strings.TrimSpace(name + " " + strings.Join(args, " ")),
+		Stdout:  tail(stdout.String()),
+		Stderr:  tail(stderr.String()),
+		Err:     err,
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		cmdErr.TimedOut = true
+		cmdErr.Err = fmt.Errorf("killed after %s: %w", timeout, ctx.Err())
+	}
+	return stdout.Bytes(), stderr.Bytes(), cmdErr
+}
+
+// tail keeps the end of long output, which usually holds the actual error
+func tail(s string) string {
+	if len(s) <= maxCapturedOutput {
+		return s
+	}
+	return "..." + s[len(s)-maxCapturedOutput:]
+}
+
+// ShellQuote quotes s as a single word for a POSIX shell, e.g. for commands
+// run over SSH
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
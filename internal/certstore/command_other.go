@@ -0,0 +1,8 @@
+//go:build !unix
+
+package certstore
+
+import "os/exec"
+
+// configureProcessGroup is a no-op; exec.CommandContext kills the process itself on timeout
+func configureProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package certstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandRunnerCapturesOutputOnFailure(t *testing.T) {
+	runner := CommandRunner{Timeout: 10 * time.Second}
+
+	_, err := runner.Run("sh", "-c", "echo bad anchor >&2; exit 3")
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("expected CommandError, got %v", err)
+	}
+	if cmdErr.TimedOut {
+		t.Error("failure should not be reported as a timeout")
+	}
+	if !strings.Contains(err.Error(), "bad anchor") {
+		t.Errorf("error should include stderr, got %q", err.Error())
+	}
+}
+
+func TestCommandRunnerKillsProcessGroupOnTimeout(t *testing.T) {
+	runner := CommandRunner{Timeout: 200 * time.Millisecond}
+
+	// The background child keeps stdout open; without killing the group Run would block
+	start := time.Now()
+	_, err := runner.Run("sh", "-c", "sleep 30 & sleep 30")
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || !cmdErr.TimedOut {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run returned after %s, expected prompt kill", elapsed)
+	}
+}
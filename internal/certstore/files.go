@@ -0,0 +1,105 @@
+package certstore
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+)
+
+// DefaultFileMode is the mode of certificate files and bundles a store
+// writes: trust anchors are public, so every user's TLS clients may read
+// them, but only the owner may change them
+const DefaultFileMode os.FileMode = 0644
+
+// FilePolicy is the mode, owner and group given to the certificate files
+// and bundles a store writes, from its options file_mode (octal), owner and
+// group (names or numeric IDs). The mode is set explicitly so the process
+// umask doesn't decide it. Without owner or group the writing user's is kept.
+type FilePolicy struct {
+	Mode os.FileMode
+	UID  int // -1 keeps the owner
+	GID  int // -1 keeps the group
+}
+
+// ParseFilePolicy reads the file policy from store options. Modes that let
+// group or other users write are refused: anyone who can write a trust
+// anchor can make every client on the machine trust their CA.
+func ParseFilePolicy(options map[string]string) (FilePolicy, error) {
+	policy := FilePolicy{Mode: DefaultFileMode, UID: -1, GID: -1}
+
+	if value := options["file_mode"]; value != "" {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || mode > 0777 {
+			return policy, fmt.Errorf("invalid file_mode %q: must be octal permissions such as 0644", value)
+		}
+		if mode&0022 != 0 {
+			return policy, fmt.Errorf("file_mode %s would let other users change trusted certificates", value)
+		}
+		policy.Mode = os.FileMode(mode)
+	}
+
+	owner, group := options["owner"], options["group"]
+	if (owner != "" || group != "") && runtime.GOOS == "windows" {
+		return policy, fmt.Errorf("owner and group are not supported on Windows")
+	}
+	if owner != "" {
+		uid, err := lookupID(owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return policy, fmt.Errorf("invalid owner %q: %w", owner, err)
+		}
+		policy.UID = uid
+	}
+	if group != "" {
+		gid, err := lookupID(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return policy, fmt.Errorf("invalid group %q: %w", group, err)
+		}
+		policy.GID = gid
+	}
+	return policy, nil
+}
+
+// lookupID resolves a numeric ID as is and a name with lookup
+func lookupID(value string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(value); err == nil && id >= 0 {
+		return id, nil
+	}
+	id, err := lookup(value)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(id)
+}
+
+// Apply sets the policy's mode, owner and group on path
+func (p FilePolicy) Apply(path string) error {
+	if err := os.Chmod(path, p.Mode); err != nil {
+		return err
+	}
+	if p.UID == -1 && p.GID == -1 {
+		return nil
+	}
+	return os.Chown(path, p.UID, p.GID)
+}
+
+// WriteFile atomically replaces path with data carrying the policy's mode,
+// owner and group
+func (p FilePolicy) WriteFile(path string, data []byte) error {
+	return atomicfile.WriteFileFunc(path, data, p.Mode, p.Apply)
+}
@@ -0,0 +1,54 @@
+package certstore
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseFilePolicy(t *testing.T) {
+	policy, err := ParseFilePolicy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy != (FilePolicy{Mode: DefaultFileMode, UID: -1, GID: -1}) {
+		t.Errorf("default policy = %+v", policy)
+	}
+
+	policy, err = ParseFilePolicy(map[string]string{"file_mode": "0640", "owner": "0", "group": "0"})
+	if runtime.GOOS == "windows" {
+		if err == nil {
+			t.Error("owner accepted on Windows")
+		}
+	} else if err != nil || policy != (FilePolicy{Mode: 0640, UID: 0, GID: 0}) {
+		t.Errorf("policy = %+v, %v", policy, err)
+	}
+
+	for _, mode := range []string{"0664", "0666", "0602", "rw-r--r--", "01777"} {
+		if _, err := ParseFilePolicy(map[string]string{"file_mode": mode}); err == nil {
+			t.Errorf("file_mode %s accepted", mode)
+		}
+	}
+	if _, err := ParseFilePolicy(map[string]string{"owner": "no-such-user-tsu"}); err == nil {
+		t.Error("unknown owner accepted")
+	}
+}
+
+func TestFilePolicyApplyIgnoresUmask(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, _ := ParseFilePolicy(nil)
+	if err := policy.Apply(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != DefaultFileMode {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), DefaultFileMode)
+	}
+}
@@ -2,51 +2,83 @@ package certstore
 
 import (
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/webprofusion/trust-store-updater/pkg/certstore"
 )
 
-// CertificateStore defines the interface for certificate store operations
-type CertificateStore interface {
-	// Name returns the name of the certificate store
-	Name() string
-	
-	// IsSupported checks if this store is supported on the current platform
-	IsSupported() bool
-	
-	// RequiresRoot returns true if root privileges are required
-	RequiresRoot() bool
-	
-	// ListCertificates returns all certificates currently in the store
-	ListCertificates() ([]*x509.Certificate, error)
-	
-	// AddCertificate adds a certificate to the store
-	AddCertificate(cert *x509.Certificate) error
-	
-	// RemoveCertificate removes a certificate from the store
-	RemoveCertificate(cert *x509.Certificate) error
-	
-	// Backup creates a backup of the current store state
-	Backup(backupPath string) error
-	
-	// Restore restores the store from a backup
-	Restore(backupPath string) error
-	
-	// Validate checks if the store is in a valid state
-	Validate() error
+// CertificateStore defines the interface for certificate store operations. It
+// is defined in pkg/certstore so third-party implementations can satisfy it.
+type CertificateStore = certstore.CertificateStore
+
+// HealthChecker is implemented by stores that can diagnose platform specific problems
+type HealthChecker interface {
+	// CheckHealth returns any problems found with the store
+	CheckHealth() []HealthIssue
+}
+
+// HealthIssue describes a problem found by a store health check. Fix is nil
+// when the problem cannot be repaired automatically.
+type HealthIssue struct {
+	Check   string
+	Message string
+	Path    string
+	Fix     func() error
+}
+
+// ManagedFileLister is implemented by file based stores that can enumerate
+// the certificate files written by this tool
+type ManagedFileLister interface {
+	// ManagedFiles returns the certificates in files carrying the managed marker, keyed by path
+	ManagedFiles() (map[string]*x509.Certificate, error)
+}
+
+// CertificateFilter is implemented by stores that hold only some kinds of
+// certificate, e.g. intermediates. Certificates a store doesn't accept are
+// left out of its updates.
+type CertificateFilter interface {
+	// Accepts reports whether the store can hold the certificate
+	Accepts(cert *x509.Certificate) bool
+}
+
+// Committer is implemented by stores that buffer changes, e.g. a bundle
+// uploaded once after all additions. Commit is called after each update.
+type Committer interface {
+	// Commit applies buffered changes
+	Commit() error
+}
+
+// LabeledAdder is implemented by stores that can install a certificate under
+// an alias or friendly name. Certificates with a configured label are added
+// through it; other stores receive them via AddCertificate.
+type LabeledAdder interface {
+	// AddCertificateWithLabel adds a certificate to the store under label
+	AddCertificateWithLabel(cert *x509.Certificate, label string) error
+}
+
+// TrustSettingsLister is implemented by stores that keep trust settings
+// apart from the certificates, e.g. macOS keychains. Drift detection compares
+// them so trust changed in place is reported.
+type TrustSettingsLister interface {
+	// TrustSettings returns a digest of the trust settings of each certificate
+	// that has any, keyed by SHA-256 fingerprint
+	TrustSettings() (map[string]string, error)
 }
 
 // CertificateInfo contains metadata about a certificate
 type CertificateInfo struct {
-	Certificate   *x509.Certificate
-	Subject       string
-	Issuer        string
-	SerialNumber  string
-	NotBefore     time.Time
-	NotAfter      time.Time
-	Fingerprint   string
-	IsCA          bool
-	Source        string
+	Certificate  *x509.Certificate
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	Fingerprint  string
+	IsCA         bool
+	Source       string
+	Label        string
 }
 
 // StoreType represents different types of certificate stores
@@ -55,7 +87,11 @@ type StoreType string
 const (
 	StoreTypeSystem      StoreType = "system"
 	StoreTypeApplication StoreType = "application"
-	StoreTypeCustom      StoreType = "custom"
+	StoreTypeCustom      StoreType = "custom"    // implementation registered with RegisterStoreProvider
+	StoreTypePlugin      StoreType = "plugin"    // external executable speaking the JSON plugin protocol
+	StoreTypeVault       StoreType = "vault"     // HashiCorp Vault KV secret or PKI mount
+	StoreTypeAWS         StoreType = "aws"       // S3 hosted bundle or AWS IoT Core CA registrations
+	StoreTypeAppliance   StoreType = "appliance" // appliance reached over SSH, e.g. Proxmox or ESXi
 )
 
 // StoreFactory creates certificate store instances
@@ -67,7 +103,9 @@ type StoreFactory interface {
 // StoreManager manages multiple certificate stores
 type StoreManager struct {
 	stores   map[string]CertificateStore
+	order    []string // store names in insertion order
 	factory  StoreFactory
+	readOnly bool
 	verbose  bool
 }
 
@@ -80,8 +118,20 @@ func NewStoreManager(factory StoreFactory, verbose bool) *StoreManager {
 	}
 }
 
-// AddStore adds a certificate store to the manager
+// SetReadOnly makes the manager guard every store added afterwards so that
+// additions, removals and restores fail with ErrReadOnly
+func (sm *StoreManager) SetReadOnly(readOnly bool) {
+	sm.readOnly = readOnly
+}
+
+// AddStore adds a certificate store to the manager. Stores are processed in the order they are added.
 func (sm *StoreManager) AddStore(name string, store CertificateStore) {
+	if sm.readOnly {
+		store = NewReadOnlyStore(store)
+	}
+	if _, exists := sm.stores[name]; !exists {
+		sm.order = append(sm.order, name)
+	}
 	sm.stores[name] = store
 }
 
@@ -96,6 +146,13 @@ func (sm *StoreManager) ListStores() map[string]CertificateStore {
 	return sm.stores
 }
 
+// StoreNames returns the names of all managed stores in processing order
+func (sm *StoreManager) StoreNames() []string {
+	names := make([]string, len(sm.order))
+	copy(names, sm.order)
+	return names
+}
+
 // CreateAndAddStore creates a new store and adds it to the manager
 func (sm *StoreManager) CreateAndAddStore(name string, storeType StoreType, target string, options map[string]string) error {
 	store, err := sm.factory.CreateStore(storeType, target, options)
@@ -111,26 +168,112 @@ func (sm *StoreManager) CreateAndAddStore(name string, storeType StoreType, targ
 	return nil
 }
 
-// ValidateAllStores validates all managed stores
-func (sm *StoreManager) ValidateAllStores() error {
-	for name, store := range sm.stores {
-		if err := store.Validate(); err != nil {
-			return fmt.Errorf("validation failed for store %s: %w", name, err)
-		}
+// CreateAndAddProviderStore creates a store from a provider registered with
+// RegisterStoreProvider and adds it to the manager
+func (sm *StoreManager) CreateAndAddProviderStore(name, provider, target string, options map[string]string) error {
+	store, err := newProviderStore(provider, target, options, sm.verbose)
+	if err != nil {
+		return fmt.Errorf("failed to create store %s: %w", name, err)
 	}
+
+	if !store.IsSupported() {
+		return fmt.Errorf("store %s is not supported on this platform", name)
+	}
+
+	sm.AddStore(name, store)
 	return nil
 }
 
-// BackupAllStores creates backups for all managed stores
-func (sm *StoreManager) BackupAllStores(backupDir string) error {
-	for name, store := range sm.stores {
-		backupPath := fmt.Sprintf("%s/%s_backup_%d", backupDir, name, time.Now().Unix())
-		if err := store.Backup(backupPath); err != nil {
-			return fmt.Errorf("backup failed for store %s: %w", name, err)
+// StoreError associates an error with the store and operation it came from
+type StoreError struct {
+	Store     string
+	Operation string
+	Err       error
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("%s failed for store %s: %v", e.Operation, e.Store, e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// OperationResult summarizes an operation applied to every managed store
+type OperationResult struct {
+	Operation string
+	Succeeded []string
+	Failures  []*StoreError
+	Outputs   map[string]string // per-store output, e.g. the backup path
+}
+
+func newOperationResult(operation string) *OperationResult {
+	return &OperationResult{Operation: operation, Outputs: make(map[string]string)}
+}
+
+// Failed reports whether the operation failed for the named store
+func (r *OperationResult) Failed(name string) bool {
+	for _, f := range r.Failures {
+		if f.Store == name {
+			return true
 		}
-		if sm.verbose {
-			fmt.Printf("Created backup for store %s at %s\n", name, backupPath)
+	}
+	return false
+}
+
+// Err returns nil when every store succeeded, otherwise an error joining all store failures
+func (r *OperationResult) Err() error {
+	if len(r.Failures) == 0 {
+		return nil
+	}
+	errs := make([]error, len(r.Failures))
+	for i, f := range r.Failures {
+		errs[i] = f
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateAllStores validates all managed stores, continuing past failures
+func (sm *StoreManager) ValidateAllStores() *OperationResult {
+	result := newOperationResult("validate")
+	for _, name := range sm.order {
+		store := sm.stores[name]
+		if err := store.Validate(); err != nil {
+			result.Failures = append(result.Failures, &StoreError{Store: name, Operation: result.Operation, Err: err})
+			continue
 		}
+		result.Succeeded = append(result.Succeeded, name)
 	}
-	return nil
+	return result
+}
+
+// BackupAllStores creates backups for all managed stores, continuing past failures
+func (sm *StoreManager) BackupAllStores(backupDir string) *OperationResult {
+	result := newOperationResult("backup")
+	for _, name := range sm.order {
+		backupPath, err := sm.BackupStore(name, backupDir)
+		if err != nil {
+			result.Failures = append(result.Failures, &StoreError{Store: name, Operation: result.Operation, Err: err})
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, name)
+		result.Outputs[name] = backupPath
+	}
+	return result
+}
+
+// BackupStore creates a backup of one managed store and returns its path
+func (sm *StoreManager) BackupStore(name, backupDir string) (string, error) {
+	store, exists := sm.stores[name]
+	if !exists {
+		return "", fmt.Errorf("store %s not found", name)
+	}
+	backupPath := fmt.Sprintf("%s/%s_backup_%d", backupDir, name, time.Now().Unix())
+	if err := store.Backup(backupPath); err != nil {
+		return "", err
+	}
+	if sm.verbose {
+		fmt.Printf("Created backup for store %s at %s\n", name, backupPath)
+	}
+	return backupPath, nil
 }
@@ -0,0 +1,16 @@
+package certstore
+
+import (
+	"crypto"
+	"crypto/x509"
+)
+
+// KeyedAdder is implemented by stores that can hold a certificate together
+// with its private key, such as Java keystores and the Windows Personal
+// store, for the leaf certificates applications serve
+type KeyedAdder interface {
+	// AddCertificateWithKey stores chain, leaf first, and the leaf's key
+	// under label. Stores that key entries by label, such as Java
+	// keystores, replace an earlier entry with that label.
+	AddCertificateWithKey(chain []*x509.Certificate, key crypto.Signer, label string) error
+}
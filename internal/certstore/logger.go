@@ -3,6 +3,7 @@ package certstore
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 type LogLevel int
@@ -11,28 +12,103 @@ const (
 	LogError LogLevel = iota
 	LogWarn
 	LogInfo
+	LogDebug
 )
 
 var currentLevel = LogInfo
 
+// LogSink receives formatted log messages in addition to the console, e.g.
+// syslog or the Windows Event Log
+type LogSink interface {
+	Write(level LogLevel, msg string) error
+	Close() error
+}
+
+var sinks []LogSink
+
 func SetLogLevel(level LogLevel) {
 	currentLevel = level
 }
 
+// ParseLogLevel converts a configured level name ("error", "warn", "info",
+// "debug") to a LogLevel. Unknown names are warned about and log at info.
+func ParseLogLevel(name string) LogLevel {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "error":
+		return LogError
+	case "warn", "warning":
+		return LogWarn
+	case "info", "":
+		return LogInfo
+	case "debug":
+		return LogDebug
+	default:
+		LogWarnf("Unknown log level %q, logging at info", name)
+		return LogInfo
+	}
+}
+
+// AddSink registers an additional destination for log messages
+func AddSink(sink LogSink) {
+	sinks = append(sinks, sink)
+}
+
+// NewSink creates a platform log sink by name ("syslog", "eventlog")
+func NewSink(name string) (LogSink, error) {
+	switch name {
+	case "syslog":
+		return newSyslogSink()
+	case "eventlog":
+		return newEventLogSink()
+	default:
+		return nil, fmt.Errorf("unknown log sink: %s", name)
+	}
+}
+
+// CloseSinks flushes and closes all registered sinks
+func CloseSinks() {
+	for _, sink := range sinks {
+		_ = sink.Close()
+	}
+	sinks = nil
+}
+
+func LogDebugf(format string, args ...interface{}) {
+	if currentLevel >= LogDebug {
+		fmt.Fprintf(os.Stdout, "DEBUG: "+format+"\n", args...)
+		writeSinks(LogDebug, format, args...)
+	}
+}
+
 func LogInfof(format string, args ...interface{}) {
 	if currentLevel >= LogInfo {
 		fmt.Fprintf(os.Stdout, "INFO: "+format+"\n", args...)
+		writeSinks(LogInfo, format, args...)
 	}
 }
 
 func LogWarnf(format string, args ...interface{}) {
 	if currentLevel >= LogWarn {
 		fmt.Fprintf(os.Stdout, "WARN: "+format+"\n", args...)
+		writeSinks(LogWarn, format, args...)
 	}
 }
 
 func LogErrorf(format string, args ...interface{}) {
 	if currentLevel >= LogError {
 		fmt.Fprintf(os.Stderr, "ERROR: "+format+"\n", args...)
+		writeSinks(LogError, format, args...)
+	}
+}
+
+func writeSinks(level LogLevel, format string, args ...interface{}) {
+	if len(sinks) == 0 {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	for _, sink := range sinks {
+		if err := sink.Write(level, msg); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: failed to write to log sink: %v\n", err)
+		}
 	}
 }
@@ -0,0 +1,20 @@
+package certstore
+
+import "testing"
+
+func TestParseLogLevel(t *testing.T) {
+	tests := map[string]LogLevel{
+		"error":   LogError,
+		"Warn":    LogWarn,
+		"warning": LogWarn,
+		"":        LogInfo,
+		"info":    LogInfo,
+		" debug ": LogDebug,
+		"verbose": LogInfo, // unknown: warned about and logged at info
+	}
+	for name, want := range tests {
+		if got := ParseLogLevel(name); got != want {
+			t.Errorf("ParseLogLevel(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
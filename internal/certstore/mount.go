@@ -0,0 +1,41 @@
+package certstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrReadOnlyFilesystem is returned before changing a store whose files are
+// on a read-only filesystem, e.g. a container image or an OSTree deployment
+var ErrReadOnlyFilesystem = errors.New("store is on a read-only filesystem")
+
+// WritePather is implemented by stores that change local files, so that a
+// read-only filesystem is found before a change is attempted rather than
+// failing with EROFS part way through a run
+type WritePather interface {
+	// WritePaths returns the files and directories the store changes
+	WritePaths() []string
+}
+
+// ReadOnlyPath returns the first of paths on a read-only filesystem. Paths
+// that don't exist yet are checked at their nearest existing parent.
+func ReadOnlyPath(paths []string) (string, bool) {
+	for _, path := range paths {
+		p := filepath.Clean(path)
+		for {
+			if _, err := os.Stat(p); err == nil {
+				break
+			}
+			parent := filepath.Dir(p)
+			if parent == p {
+				break
+			}
+			p = parent
+		}
+		if readOnlyMount(p) {
+			return path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package certstore
+
+// readOnlyMount is false; Windows stores aren't on read-only mounts
+func readOnlyMount(path string) bool {
+	return false
+}
@@ -0,0 +1,10 @@
+//go:build unix
+
+package certstore
+
+import "golang.org/x/sys/unix"
+
+// readOnlyMount reports whether path is on a filesystem mounted read-only
+func readOnlyMount(path string) bool {
+	return unix.Access(path, unix.W_OK) == unix.EROFS
+}
@@ -0,0 +1,38 @@
+package certstore
+
+import "crypto/x509"
+
+// Trust purposes a certificate's trust can be limited to with
+// trust_purposes
+const (
+	PurposeServerAuth  = "server-auth"
+	PurposeClientAuth  = "client-auth"
+	PurposeCodeSigning = "code-signing"
+	PurposeSMIME       = "smime"
+)
+
+// TrustPurposes lists the supported trust_purposes values
+var TrustPurposes = []string{PurposeServerAuth, PurposeClientAuth, PurposeCodeSigning, PurposeSMIME}
+
+// IsTrustPurpose reports whether name is a supported trust_purposes value
+func IsTrustPurpose(name string) bool {
+	for _, p := range TrustPurposes {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PurposeAdder is implemented by stores that can limit what a certificate
+// is trusted for, e.g. with trust settings or certificate properties.
+// Certificates with trust_purposes are only added to stores implementing it.
+type PurposeAdder interface {
+	// SupportedPurposes returns the trust purposes the store can limit
+	// trust to; none means it can't limit trust
+	SupportedPurposes() []string
+	// AddCertificateForPurposes adds a certificate trusted only for
+	// purposes, all of which are supported. Label is the alias to install
+	// it under, or empty.
+	AddCertificateForPurposes(cert *x509.Certificate, label string, purposes []string) error
+}
@@ -0,0 +1,74 @@
+package certstore
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrReadOnly is returned for mutations of a store guarded by read-only mode
+var ErrReadOnly = errors.New("store is read-only")
+
+// readOnlyStore wraps a store so that every mutation is rejected, whatever
+// the caller. Listing, validation and backups still reach the wrapped store,
+// as do the optional interfaces that only configure or inspect it.
+type readOnlyStore struct {
+	CertificateStore
+}
+
+// NewReadOnlyStore guards store against additions, removals and restores
+func NewReadOnlyStore(store CertificateStore) CertificateStore {
+	if _, ok := store.(readOnlyStore); ok {
+		return store
+	}
+	return readOnlyStore{store}
+}
+
+func (r readOnlyStore) reject(operation string) error {
+	return fmt.Errorf("%s rejected for %s: %w", operation, r.Name(), ErrReadOnly)
+}
+
+func (r readOnlyStore) AddCertificate(*x509.Certificate) error {
+	return r.reject("add")
+}
+
+func (r readOnlyStore) RemoveCertificate(*x509.Certificate) error {
+	return r.reject("remove")
+}
+
+func (r readOnlyStore) Restore(string) error {
+	return r.reject("restore")
+}
+
+// CheckHealth reports the wrapped store's problems without their repairs
+func (r readOnlyStore) CheckHealth() []HealthIssue {
+	checker, ok := r.CertificateStore.(HealthChecker)
+	if !ok {
+		return nil
+	}
+	issues := checker.CheckHealth()
+	for i := range issues {
+		issues[i].Fix = nil
+	}
+	return issues
+}
+
+func (r readOnlyStore) ManagedFiles() (map[string]*x509.Certificate, error) {
+	if lister, ok := r.CertificateStore.(ManagedFileLister); ok {
+		return lister.ManagedFiles()
+	}
+	return nil, nil
+}
+
+func (r readOnlyStore) SetCommandTimeout(timeout time.Duration) {
+	if setter, ok := r.CertificateStore.(CommandTimeoutSetter); ok {
+		setter.SetCommandTimeout(timeout)
+	}
+}
+
+func (r readOnlyStore) SetScanCache(cache *ScanCache) {
+	if setter, ok := r.CertificateStore.(ScanCacheSetter); ok {
+		setter.SetScanCache(cache)
+	}
+}
@@ -0,0 +1,55 @@
+package certstore
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// healthyFakeStore adds optional interfaces to fakeStore
+type healthyFakeStore struct {
+	fakeStore
+	timeout time.Duration
+}
+
+func (h *healthyFakeStore) CheckHealth() []HealthIssue {
+	return []HealthIssue{{Check: "symlink", Message: "broken", Fix: func() error { return nil }}}
+}
+
+func (h *healthyFakeStore) SetCommandTimeout(timeout time.Duration) { h.timeout = timeout }
+
+func TestReadOnlyStore(t *testing.T) {
+	inner := &healthyFakeStore{fakeStore: fakeStore{target: "ro"}}
+	sm := NewStoreManager(nil, false)
+	sm.SetReadOnly(true)
+	sm.AddStore("guarded", inner)
+	store, _ := sm.GetStore("guarded")
+
+	if err := store.AddCertificate(nil); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("AddCertificate: expected ErrReadOnly, got %v", err)
+	}
+	if err := store.RemoveCertificate(nil); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("RemoveCertificate: expected ErrReadOnly, got %v", err)
+	}
+	if err := store.Restore("backup"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Restore: expected ErrReadOnly, got %v", err)
+	}
+	if err := store.Backup("backup"); err != nil {
+		t.Errorf("Backup should pass through: %v", err)
+	}
+	if store.Name() != "fake-ro" {
+		t.Errorf("Name() = %q", store.Name())
+	}
+
+	if _, ok := store.(LabeledAdder); ok {
+		t.Error("read-only store must not expose a mutating optional interface")
+	}
+	issues := store.(HealthChecker).CheckHealth()
+	if len(issues) != 1 || issues[0].Fix != nil {
+		t.Errorf("expected the health issue without its repair, got %+v", issues)
+	}
+	store.(CommandTimeoutSetter).SetCommandTimeout(time.Minute)
+	if inner.timeout != time.Minute {
+		t.Error("command timeout was not forwarded")
+	}
+}
@@ -0,0 +1,9 @@
+package certstore
+
+// RebootNotifier is implemented by stores whose changes may not reach the
+// system until a reboot, e.g. on image based systems with pending deployments
+type RebootNotifier interface {
+	// PendingReboot returns why a reboot or deployment switch is needed for
+	// the store's changes to take full effect, empty if none is
+	PendingReboot() string
+}
@@ -0,0 +1,37 @@
+package certstore
+
+// Rebuilder is implemented by stores that regenerate a system bundle with a
+// platform tool, such as update-ca-certificates, after each change
+type Rebuilder interface {
+	// RebuildSummary returns the combined results of the tool's runs since
+	// the store was created, or nil if it hasn't run
+	RebuildSummary() *RebuildSummary
+}
+
+// RebuildSummary is what a bundle rebuild tool reported across its runs
+type RebuildSummary struct {
+	Tool     string
+	Runs     int
+	Added    int
+	Removed  int
+	Warnings []string // distinct warnings that did not fail the rebuild
+}
+
+// Record adds the results of one run, skipping warnings already seen
+func (r *RebuildSummary) Record(added, removed int, warnings []string) {
+	r.Runs++
+	r.Added += added
+	r.Removed += removed
+	for _, w := range warnings {
+		seen := false
+		for _, existing := range r.Warnings {
+			if existing == w {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			r.Warnings = append(r.Warnings, w)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package certstore
+
+import (
+	"github.com/webprofusion/trust-store-updater/pkg/certstore"
+)
+
+// StoreConstructor creates a store instance for a registered provider. It is
+// an alias of the public pkg/certstore type so downstream builds can register
+// providers without importing internal packages.
+type StoreConstructor = certstore.StoreConstructor
+
+// RegisterStoreProvider makes a custom store implementation available to
+// configuration as type "custom"; see pkg/certstore.RegisterStoreProvider
+func RegisterStoreProvider(name string, constructor StoreConstructor) {
+	certstore.RegisterStoreProvider(name, constructor)
+}
+
+// StoreProviders returns the names of all registered providers, sorted
+func StoreProviders() []string {
+	return certstore.StoreProviders()
+}
+
+// newProviderStore creates a store using a registered provider
+func newProviderStore(provider, target string, options map[string]string, verbose bool) (CertificateStore, error) {
+	return certstore.NewProviderStore(provider, target, options, verbose)
+}
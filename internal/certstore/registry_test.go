@@ -0,0 +1,39 @@
+package certstore
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+type fakeStore struct {
+	target string
+}
+
+func (f *fakeStore) Name() string                                   { return "fake-" + f.target }
+func (f *fakeStore) IsSupported() bool                              { return true }
+func (f *fakeStore) RequiresRoot() bool                             { return false }
+func (f *fakeStore) ListCertificates() ([]*x509.Certificate, error) { return nil, nil }
+func (f *fakeStore) AddCertificate(*x509.Certificate) error         { return nil }
+func (f *fakeStore) RemoveCertificate(*x509.Certificate) error      { return nil }
+func (f *fakeStore) Backup(string) error                            { return nil }
+func (f *fakeStore) Restore(string) error                           { return nil }
+func (f *fakeStore) Validate() error                                { return nil }
+
+func TestRegisterStoreProvider(t *testing.T) {
+	RegisterStoreProvider("test-appliance", func(target string, options map[string]string, verbose bool) (CertificateStore, error) {
+		return &fakeStore{target: target}, nil
+	})
+
+	sm := NewStoreManager(nil, false)
+	if err := sm.CreateAndAddProviderStore("lb", "test-appliance", "lb01", nil); err != nil {
+		t.Fatalf("CreateAndAddProviderStore: %v", err)
+	}
+	store, exists := sm.GetStore("lb")
+	if !exists || store.Name() != "fake-lb01" {
+		t.Errorf("expected provider store to be added, got %v", store)
+	}
+
+	if err := sm.CreateAndAddProviderStore("other", "not-registered", "", nil); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
@@ -0,0 +1,184 @@
+package certstore
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ScanCacheSetter is implemented by stores that list certificates by reading
+// directories, such as /etc/ssl/certs
+type ScanCacheSetter interface {
+	// SetScanCache provides the cache used to skip unchanged files when listing
+	SetScanCache(cache *ScanCache)
+}
+
+// ScanCache remembers which certificates each file in a scanned directory
+// held, keyed by file size and modification time, so repeat scans only read
+// and parse files that changed. It is persisted in the state file.
+type ScanCache struct {
+	Dirs         map[string]map[string]*ScanEntry `json:"dirs"`         // directory -> file name -> entry
+	Certificates map[string][]byte                `json:"certificates"` // DER keyed by SHA-256 fingerprint
+
+	parsed map[string]*x509.Certificate
+}
+
+// ScanEntry records the certificates found in one file
+type ScanEntry struct {
+	ModTime      time.Time `json:"mod_time"`
+	Size         int64     `json:"size"`
+	Fingerprints []string  `json:"fingerprints"`
+}
+
+// NewScanCache creates an empty scan cache
+func NewScanCache() *ScanCache {
+	return &ScanCache{
+		Dirs:         make(map[string]map[string]*ScanEntry),
+		Certificates: make(map[string][]byte),
+	}
+}
+
+// ScanDir returns the certificates in the files of dir accepted by match,
+// following symlinks. Files whose size and modification time are unchanged
+// since the last scan are served from the cache; each distinct certificate is
+// parsed at most once per run. A nil cache scans without caching.
+func (c *ScanCache) ScanDir(dir string, match func(name string) bool) ([]*x509.Certificate, error) {
+	if c == nil {
+		c = NewScanCache()
+	}
+	if c.Dirs == nil {
+		c.Dirs = make(map[string]map[string]*ScanEntry)
+	}
+	if c.Certificates == nil {
+		c.Certificates = make(map[string][]byte)
+	}
+	if c.parsed == nil {
+		c.parsed = make(map[string]*x509.Certificate)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cert dir: %w", err)
+	}
+
+	previous := c.Dirs[dir]
+	current := make(map[string]*ScanEntry)
+	var certs []*x509.Certificate
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !match(name) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			LogWarnf("Skipping unreadable file: %s (%v)", path, err)
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		if entry, ok := previous[name]; ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+			if cached, ok := c.cachedCertificates(entry); ok {
+				current[name] = entry
+				certs = append(certs, cached...)
+				continue
+			}
+		}
+
+		fileCerts, entry, err := c.scanFile(path, info)
+		if err != nil {
+			LogWarnf("Skipping unreadable file: %s (%v)", path, err)
+			continue
+		}
+		current[name] = entry
+		certs = append(certs, fileCerts...)
+	}
+
+	c.Dirs[dir] = current
+	c.prune()
+	return certs, nil
+}
+
+// scanFile parses every certificate in a file and records it in the cache
+func (c *ScanCache) scanFile(path string, info os.FileInfo) ([]*x509.Certificate, *ScanEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := &ScanEntry{ModTime: info.ModTime(), Size: info.Size()}
+	var certs []*x509.Certificate
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		hash := sha256.Sum256(block.Bytes)
+		fp := hex.EncodeToString(hash[:])
+		cert, ok := c.parsed[fp]
+		if !ok {
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				LogWarnf("Failed to parse certificate in %s: %v", path, err)
+				continue
+			}
+			c.parsed[fp] = cert
+		}
+		c.Certificates[fp] = cert.Raw
+		entry.Fingerprints = append(entry.Fingerprints, fp)
+		certs = append(certs, cert)
+	}
+	return certs, entry, nil
+}
+
+// cachedCertificates returns the certificates recorded for an unchanged file,
+// or false if any of them is missing from the cache
+func (c *ScanCache) cachedCertificates(entry *ScanEntry) ([]*x509.Certificate, bool) {
+	certs := make([]*x509.Certificate, 0, len(entry.Fingerprints))
+	for _, fp := range entry.Fingerprints {
+		cert, ok := c.parsed[fp]
+		if !ok {
+			der, exists := c.Certificates[fp]
+			if !exists {
+				return nil, false
+			}
+			var err error
+			if cert, err = x509.ParseCertificate(der); err != nil {
+				return nil, false
+			}
+			c.parsed[fp] = cert
+		}
+		certs = append(certs, cert)
+	}
+	return certs, true
+}
+
+// prune drops certificates no longer referenced by any scanned file
+func (c *ScanCache) prune() {
+	referenced := make(map[string]bool)
+	for _, files := range c.Dirs {
+		for _, entry := range files {
+			for _, fp := range entry.Fingerprints {
+				referenced[fp] = true
+			}
+		}
+	}
+	for fp := range c.Certificates {
+		if !referenced[fp] {
+			delete(c.Certificates, fp)
+		}
+	}
+}
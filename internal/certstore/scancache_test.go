@@ -0,0 +1,67 @@
+package certstore_test
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestScanCacheSkipsUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	c := certstoretest.NewCertificate(t, "Scan Test Root")
+	data := certstore.EncodePEMBundle([]*x509.Certificate{c})
+	path := filepath.Join(dir, "root.pem")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	isPEM := func(name string) bool { return strings.HasSuffix(name, ".pem") }
+
+	cache := certstore.NewScanCache()
+	certs, err := cache.ScanDir(dir, isPEM)
+	if err != nil || len(certs) != 1 {
+		t.Fatalf("first scan = %d certs, %v", len(certs), err)
+	}
+
+	// Round-trip through JSON as the state file does
+	encoded, err := json.Marshal(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = &certstore.ScanCache{}
+	if err := json.Unmarshal(encoded, cache); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size and mtime: the file must not be re-read
+	info, _ := os.Stat(path)
+	if err := os.WriteFile(path, make([]byte, len(data)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	certs, err = cache.ScanDir(dir, isPEM)
+	if err != nil || len(certs) != 1 || !certs[0].Equal(c) {
+		t.Fatalf("cached scan = %d certs, %v", len(certs), err)
+	}
+
+	// A changed mtime forces a re-parse, and the dropped certificate is pruned
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	certs, err = cache.ScanDir(dir, isPEM)
+	if err != nil || len(certs) != 0 {
+		t.Fatalf("rescan = %d certs, %v", len(certs), err)
+	}
+	if len(cache.Certificates) != 0 {
+		t.Errorf("unreferenced certificates kept: %d", len(cache.Certificates))
+	}
+}
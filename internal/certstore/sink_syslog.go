@@ -0,0 +1,42 @@
+//go:build !windows
+
+package certstore
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// syslogSink writes log messages to the local syslog daemon (and journald on systemd hosts)
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink() (LogSink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, "trust-store-updater")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &syslogSink{writer: w}, nil
+}
+
+func (s *syslogSink) Write(level LogLevel, msg string) error {
+	switch level {
+	case LogError:
+		return s.writer.Err(msg)
+	case LogWarn:
+		return s.writer.Warning(msg)
+	case LogDebug:
+		return s.writer.Debug(msg)
+	default:
+		return s.writer.Info(msg)
+	}
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
+
+func newEventLogSink() (LogSink, error) {
+	return nil, fmt.Errorf("the Windows Event Log sink is only available on windows")
+}
@@ -0,0 +1,60 @@
+//go:build windows
+
+package certstore
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// EventLogSource is the Application log source name registered for this tool,
+// also used as the Windows service name
+const EventLogSource = "TrustStoreUpdater"
+
+// Event IDs used when writing to the Windows Event Log
+const (
+	eventIDInfo    = 1000
+	eventIDWarning = 2000
+	eventIDError   = 3000
+)
+
+// eventLogSink writes log messages to the Windows Application Event Log
+type eventLogSink struct {
+	log *eventlog.Log
+}
+
+func newEventLogSink() (LogSink, error) {
+	// Registering the source requires administrator rights and fails if it
+	// already exists, so an error here is not fatal
+	err := eventlog.InstallAsEventCreate(EventLogSource, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil && !strings.Contains(err.Error(), "registry key already exists") {
+		LogWarnf("Could not register event log source %s: %v", EventLogSource, err)
+	}
+
+	l, err := eventlog.Open(EventLogSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	return &eventLogSink{log: l}, nil
+}
+
+func (e *eventLogSink) Write(level LogLevel, msg string) error {
+	switch level {
+	case LogError:
+		return e.log.Error(eventIDError, msg)
+	case LogWarn:
+		return e.log.Warning(eventIDWarning, msg)
+	default:
+		return e.log.Info(eventIDInfo, msg)
+	}
+}
+
+func (e *eventLogSink) Close() error {
+	return e.log.Close()
+}
+
+func newSyslogSink() (LogSink, error) {
+	return nil, fmt.Errorf("the syslog sink is not available on windows, use eventlog instead")
+}
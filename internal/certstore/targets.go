@@ -0,0 +1,19 @@
+package certstore
+
+// TargetReporter is implemented by stores that apply changes to several
+// underlying targets, such as the cacerts of each installed JVM, so each
+// target's outcome can be reported
+type TargetReporter interface {
+	// TargetResults returns the outcome for each target since the store was created
+	TargetResults() []TargetResult
+}
+
+// TargetResult is the outcome of changes to one underlying target of a store
+type TargetResult struct {
+	Target  string // e.g. a keystore path
+	Detail  string // e.g. the JVMs using the keystore
+	Added   int
+	Removed int
+	Failed  int
+	Errors  []string
+}
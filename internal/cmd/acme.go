@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var acmeRenewForce bool
+
+// acmeCmd groups commands for ACME issued application certificates
+var acmeCmd = &cobra.Command{
+	Use:   "acme",
+	Short: "Manage application certificates obtained from an ACME CA",
+}
+
+// acmeRenewCmd obtains or renews the configured ACME certificates
+var acmeRenewCmd = &cobra.Command{
+	Use:   "renew",
+	Short: "Obtain or renew the configured ACME certificates and install them",
+	Long: `Obtains each certificate configured under acme.certificates that hasn't been
+issued yet, expires within renew_before_days or no longer matches its domains,
+and installs it with its key into its stores with the same backup, audit log
+and manifest as an update. Certificates that are current are only installed
+into stores that don't hold them yet. Updates and the daemon do the same on
+each run; use --force to renew every certificate now.`,
+	Args: cobra.NoArgs,
+	RunE: runACMERenew,
+}
+
+func init() {
+	acmeRenewCmd.Flags().BoolVar(&acmeRenewForce, "force", false, "renew every configured certificate")
+	acmeCmd.AddCommand(acmeRenewCmd)
+	rootCmd.AddCommand(acmeCmd)
+}
+
+func runACMERenew(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	return updaterService.RenewACMECertificates(acmeRenewForce)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	addStore string
+	addFile  string
+)
+
+// addCmd installs certificates from a file into one store
+var addCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add the certificates in a file to one trust store",
+	Long: `Installs the certificates in a PEM or DER file into a configured store without
+editing the configuration. They go through the same validation, sealed trust
+anchor check, approval, backup, audit log and manifest as an update, with
+"manual" as their source. Certificates already in the store are skipped.
+Hosts that require approval need one made with approve --add for this file
+and store.`,
+	RunE: runAdd,
+}
+
+func init() {
+	addCmd.Flags().StringVar(&addStore, "store", "", "name of the configured store to add to")
+	addCmd.Flags().StringVar(&addFile, "file", "", "PEM or DER certificate file")
+	_ = addCmd.MarkFlagRequired("store")
+	_ = addCmd.MarkFlagRequired("file")
+	_ = addCmd.RegisterFlagCompletionFunc("store", completeStoreNames)
+	addConfirmFlags(addCmd)
+	rootCmd.AddCommand(addCmd)
+}
+
+func runAdd(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	setConfirm(updaterService)
+	return updaterService.AddToStore(addStore, addFile)
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/anchors"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var anchorsFromSources bool
+
+// anchorsCmd groups commands for the sealed trust anchor list
+var anchorsCmd = &cobra.Command{
+	Use:   "anchors",
+	Short: "Manage the sealed list of certificates allowed to be installed",
+}
+
+// anchorsSealCmd seals the trust anchor list
+var anchorsSealCmd = &cobra.Command{
+	Use:   "seal",
+	Short: "Seal the trust anchor list in the TPM or System keychain",
+	Long: `Seals the digest of anchors.file so that, with anchors.sealed enabled, only the
+certificates it lists are installed and any later edit of the file stops every
+run until it is sealed again. Use --from-sources to first replace the list with
+the certificates the configured sources currently provide.`,
+	RunE: runAnchorsSeal,
+}
+
+// anchorsVerifyCmd checks the list against its sealed digest
+var anchorsVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the trust anchor list against its sealed digest",
+	RunE:  runAnchorsVerify,
+}
+
+func init() {
+	anchorsSealCmd.Flags().BoolVar(&anchorsFromSources, "from-sources", false, "write the list from the certificates fetched from the configured sources before sealing")
+	anchorsCmd.AddCommand(anchorsSealCmd, anchorsVerifyCmd)
+	rootCmd.AddCommand(anchorsCmd)
+}
+
+func runAnchorsSeal(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	sealer, err := anchors.NewSealer(cfg.Anchors.Backend, cfg.Anchors.NVIndex)
+	if err != nil {
+		return err
+	}
+
+	var list *anchors.List
+	if anchorsFromSources {
+		updaterService, err := updater.New(cfg, verbose, dryRun)
+		if err != nil {
+			return err
+		}
+		defer updaterService.Close()
+
+		certs, err := updaterService.MergedCertificates()
+		if err != nil {
+			return err
+		}
+		list = anchors.NewList()
+		for _, c := range certs {
+			list.Add(cert.GetCertificateFingerprint(c.X509Cert), c.X509Cert.Subject.String())
+		}
+	} else if list, err = anchors.ReadList(cfg.Anchors.File); err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Printf("DRY RUN: would seal %d fingerprints from %s with %s\n", list.Len(), cfg.Anchors.File, sealer.Name())
+		return nil
+	}
+	if anchorsFromSources {
+		if err := list.Write(cfg.Anchors.File); err != nil {
+			return err
+		}
+	}
+	if err := anchors.Seal(list, sealer); err != nil {
+		return err
+	}
+	fmt.Printf("Sealed %d fingerprints from %s with %s\n", list.Len(), cfg.Anchors.File, sealer.Name())
+	return nil
+}
+
+func runAnchorsVerify(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	sealer, err := anchors.NewSealer(cfg.Anchors.Backend, cfg.Anchors.NVIndex)
+	if err != nil {
+		return err
+	}
+	list, err := anchors.Open(cfg.Anchors.File, sealer)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s matches its sealed digest (%d fingerprints, %s)\n", cfg.Anchors.File, list.Len(), sealer.Name())
+	return nil
+}
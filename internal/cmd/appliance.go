@@ -0,0 +1,27 @@
+//go:build !no_appliance
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/platform/appliance"
+)
+
+// appliancePluginCmd serves the appliance store: appliance stores run this
+// binary with it as their plugin, one request per run
+var appliancePluginCmd = &cobra.Command{
+	Use:    appliance.PluginCommand,
+	Short:  "Serve one appliance store plugin request on stdin",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return appliance.Serve(os.Stdin, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(appliancePluginCmd)
+	configFreeCommands = append(configFreeCommands, appliancePluginCmd)
+}
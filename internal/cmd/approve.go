@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	approveKey      string
+	approveApprover string
+	approveValidFor time.Duration
+	approveOutput   string
+	approvePlan     string
+	approveStores   []string
+	approveAdd      string
+	approveRemove   string
+	approveRestore  string
+	approveRollback string
+	approveACME     string
+	approveBundle   bool
+)
+
+// approveCmd signs an approval of the current certificate bundle
+var approveCmd = &cobra.Command{
+	Use:   "approve",
+	Short: "Sign an approval of the current certificate bundle",
+	Long: `Fetches the certificate sources and signs an approval of exactly the resulting
+bundle with an OpenSSH key, normally a FIDO hardware key (ssh-keygen -t
+ed25519-sk) so every approval needs a touch. Hosts whose settings.host_tags
+match approval.required_for_tags refuse to change their stores without a valid,
+unexpired approval at approval.file whose approver is listed in
+approval.allowed_signers. Distribute the approval and its .sig alongside the
+bundle.
+
+With --plan, signs a plan saved by diff -o json instead, in place, so that
+apply --plan accepts it.
+
+Changes made outside an update need their own approval, bound to the
+operation and the stores it changes: --add FILE for adding the certificates
+in a file, --remove FINGERPRINT for removing one certificate (by its full
+SHA-256 fingerprint), --restore BACKUP for restoring a backup (by its name
+in settings.backup_directory), --rollback VERSION for rollback to a
+version (its full ID approves it without this host's state) and --acme NAME
+for installing an ACME certificate, whose renewals keep the approval valid
+while it lasts. --store names the stores; --bundle also approves the current
+bundle in the same file, for hosts whose updates renew ACME certificates.`,
+	RunE: runApprove,
+}
+
+func init() {
+	approveCmd.Flags().StringVar(&approveKey, "key", "", "OpenSSH private key (or FIDO key handle) to sign with")
+	approveCmd.Flags().StringVar(&approveApprover, "approver", "", "principal the key is listed under in allowed_signers")
+	approveCmd.Flags().DurationVar(&approveValidFor, "valid-for", 24*time.Hour, "how long the approval stays valid")
+	approveCmd.Flags().StringVarP(&approveOutput, "output", "o", "", "approval file to write (default approval.file)")
+	approveCmd.Flags().StringVar(&approvePlan, "plan", "", "sign this plan file instead of the current bundle")
+	approveCmd.Flags().StringSliceVar(&approveStores, "store", nil, "stores a one-off change is approved for")
+	approveCmd.Flags().StringVar(&approveAdd, "add", "", "approve adding the certificates in this file to --store")
+	approveCmd.Flags().StringVar(&approveRemove, "remove", "", "approve removing the certificate with this fingerprint from --store")
+	approveCmd.Flags().StringVar(&approveRestore, "restore", "", "approve restoring --store from this backup")
+	approveCmd.Flags().StringVar(&approveRollback, "rollback", "", "approve rolling --store back to this version")
+	approveCmd.Flags().StringVar(&approveACME, "acme", "", "approve installing this ACME certificate")
+	approveCmd.Flags().BoolVar(&approveBundle, "bundle", false, "also approve the current bundle when approving a one-off change")
+	approveCmd.MarkFlagsMutuallyExclusive("plan", "output")
+	approveCmd.MarkFlagsMutuallyExclusive("plan", "add", "remove", "restore", "rollback", "acme")
+	_ = approveCmd.MarkFlagRequired("key")
+	_ = approveCmd.MarkFlagRequired("approver")
+	rootCmd.AddCommand(approveCmd)
+}
+
+func runApprove(cmd *cobra.Command, args []string) error {
+	if approvePlan != "" {
+		return approvePlanFile()
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	output := approveOutput
+	if output == "" {
+		output = cfg.Approval.File
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	a, err := newApproval(updaterService)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Printf("DRY RUN: would write and sign %s\n", output)
+		return nil
+	}
+	if err := approval.Sign(a, output, approveKey); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s and %s\n", output, approval.SignaturePath(output))
+	return nil
+}
+
+// newApproval returns the approval the flags ask for: of the current bundle,
+// of a one-off change, or of both
+func newApproval(updaterService *updater.Service) (*approval.Approval, error) {
+	var op *updater.OperationApproval
+	switch {
+	case approveAdd != "":
+		op = &updater.OperationApproval{Op: approval.OpAdd, Arg: approveAdd}
+	case approveRemove != "":
+		op = &updater.OperationApproval{Op: approval.OpRemove, Arg: approveRemove}
+	case approveRestore != "":
+		op = &updater.OperationApproval{Op: approval.OpRestore, Arg: approveRestore}
+	case approveRollback != "":
+		op = &updater.OperationApproval{Op: approval.OpRollback, Arg: approveRollback}
+	case approveACME != "":
+		op = &updater.OperationApproval{Op: approval.OpACME, Arg: approveACME}
+	}
+
+	var a *approval.Approval
+	if op == nil || approveBundle {
+		var err error
+		if a, err = updaterService.NewApproval(approveApprover, approveValidFor); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Approving %d certificates (bundle %s) as %s until %s\n",
+			a.Certificates, a.BundleDigest, a.Approver, a.ExpiresAt.Format(time.RFC3339))
+	}
+	if op == nil {
+		return a, nil
+	}
+
+	op.Stores = approveStores
+	opApproval, err := updaterService.NewOperationApproval(approveApprover, approveValidFor, *op)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		a = opApproval
+	} else {
+		a.Operations = opApproval.Operations
+	}
+	fmt.Printf("Approving %s %s on %d store(s) as %s until %s\n",
+		op.Op, op.Arg, len(a.Operations), a.Approver, a.ExpiresAt.Format(time.RFC3339))
+	return a, nil
+}
+
+// approvePlanFile signs the plan at approvePlan in place
+func approvePlanFile() error {
+	data, err := os.ReadFile(approvePlan)
+	if err != nil {
+		return fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan updater.Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return fmt.Errorf("failed to parse plan %s: %w", approvePlan, err)
+	}
+	now := time.Now().UTC()
+	expires := now.Add(approveValidFor)
+	plan.Approver, plan.ApprovedAt, plan.ExpiresAt = approveApprover, &now, &expires
+	fmt.Printf("Approving %d changes to %d stores as %s until %s\n",
+		len(plan.Changes), len(plan.Stores), plan.Approver, expires.Format(time.RFC3339))
+
+	if dryRun {
+		fmt.Printf("DRY RUN: would sign %s\n", approvePlan)
+		return nil
+	}
+	data, err = json.MarshalIndent(&plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := approval.SignData(append(data, '\n'), approvePlan, approveKey, approval.PlanNamespace); err != nil {
+		return err
+	}
+	fmt.Printf("Signed %s; the signature is in %s\n", approvePlan, approval.SignaturePath(approvePlan))
+	return nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/audit"
+)
+
+var (
+	auditStore       string
+	auditOperation   string
+	auditOutcome     string
+	auditFingerprint string
+	auditSubject     string
+	auditSince       string
+	auditUntil       string
+	auditSource      string
+	auditJSON        bool
+)
+
+// auditCmd groups audit log commands
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log of mutating operations",
+}
+
+// auditShowCmd prints audit log entries matching the given filters
+var auditShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show audit log entries",
+	Long: `Shows entries from the audit log, optionally filtered by store, source, operation,
+outcome, certificate fingerprint prefix, subject substring and time range.
+Times accept RFC3339 timestamps or durations relative to now (e.g. 24h).`,
+	RunE: runAuditShow,
+}
+
+func init() {
+	auditShowCmd.Flags().StringVar(&auditStore, "store", "", "only show entries for this store")
+	auditShowCmd.Flags().StringVar(&auditOperation, "operation", "", "only show this operation (add, remove, restore)")
+	auditShowCmd.Flags().StringVar(&auditOutcome, "outcome", "", "only show this outcome (success, failure)")
+	auditShowCmd.Flags().StringVar(&auditFingerprint, "fingerprint", "", "only show certificates whose SHA-256 fingerprint starts with this value")
+	auditShowCmd.Flags().StringVar(&auditSubject, "subject", "", "only show certificates whose subject contains this value")
+	auditShowCmd.Flags().StringVar(&auditSince, "since", "", "only show entries at or after this time")
+	auditShowCmd.Flags().StringVar(&auditUntil, "until", "", "only show entries at or before this time")
+	auditShowCmd.Flags().StringVar(&auditSource, "source", "", "only show entries for certificates from this source")
+	auditShowCmd.Flags().BoolVar(&auditJSON, "json", false, "output entries as JSON lines")
+	_ = auditShowCmd.RegisterFlagCompletionFunc("store", completeStoreNames)
+	_ = auditShowCmd.RegisterFlagCompletionFunc("source", completeSourceNames)
+	_ = auditShowCmd.RegisterFlagCompletionFunc("operation", completeValues("add", "remove", "restore"))
+	_ = auditShowCmd.RegisterFlagCompletionFunc("outcome", completeValues("success", "failure"))
+
+	auditCmd.AddCommand(auditShowCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+func runAuditShow(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	filter := audit.Filter{
+		Store:       auditStore,
+		Operation:   audit.Operation(auditOperation),
+		Outcome:     auditOutcome,
+		Fingerprint: auditFingerprint,
+		Subject:     auditSubject,
+		Source:      auditSource,
+	}
+	if filter.Since, err = parseTimeFlag(auditSince); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseTimeFlag(auditUntil); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+
+	entries, err := audit.Read(cfg.Audit.Path, filter)
+	if err != nil {
+		return err
+	}
+
+	if auditJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, e := range entries {
+		line := fmt.Sprintf("%s  %-7s  %-8s  %s  %s", e.Timestamp.Local().Format(time.RFC3339), e.Operation, e.Outcome, e.Store, e.User)
+		if e.Fingerprint != "" {
+			line += fmt.Sprintf("  %s  %s", shortFingerprint(e.Fingerprint), e.Subject)
+		}
+		if e.Source != "" {
+			line += fmt.Sprintf("  (source: %s)", e.Source)
+		}
+		if e.Error != "" {
+			line += fmt.Sprintf("  error: %s", e.Error)
+		}
+		fmt.Println(line)
+	}
+
+	if verbose {
+		fmt.Printf("%d entries\n", len(entries))
+	}
+	return nil
+}
+
+// shortFingerprint abbreviates a hex fingerprint for tabular output
+func shortFingerprint(fp string) string {
+	if len(fp) > 16 {
+		return fp[:16]
+	}
+	return fp
+}
+
+// parseTimeFlag accepts an RFC3339 timestamp, a date, or a duration relative to now
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	commitStores  []string
+	commitDiscard bool
+	commitList    bool
+)
+
+// commitCmd applies the changes staged for critical stores
+var commitCmd = &cobra.Command{
+	Use:   "commit",
+	Short: "Apply the changes staged for critical stores",
+	Long: `Updates don't change stores marked critical: they write the certificates to
+add to settings.staging_directory, with <store>.pem holding every certificate
+the store will trust afterwards, so smoke tests can run against it first.
+commit then applies the staged changes with the same backup, hooks, audit log
+and manifest as an update. Stores that write a single bundle publish it in one
+step. --discard drops the staged changes instead and --list shows them.`,
+	Args: cobra.NoArgs,
+	RunE: runCommit,
+}
+
+func init() {
+	commitCmd.Flags().StringSliceVar(&commitStores, "store", nil, "only commit this store (repeatable; default every store with staged changes)")
+	commitCmd.Flags().BoolVar(&commitDiscard, "discard", false, "drop the staged changes instead of applying them")
+	commitCmd.Flags().BoolVar(&commitList, "list", false, "list the staged changes")
+	commitCmd.MarkFlagsMutuallyExclusive("discard", "list")
+	_ = commitCmd.RegisterFlagCompletionFunc("store", completeStoreNames)
+	rootCmd.AddCommand(commitCmd)
+}
+
+func runCommit(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	switch {
+	case commitList:
+		changes, err := updaterService.StagedChanges()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "STORE\tSTAGED\tCERTIFICATES\tBUNDLE")
+		for _, change := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", change.Store, change.StagedAt.Local().Format(time.RFC3339), len(change.Certificates), updaterService.StagedBundlePath(change.Store))
+		}
+		return w.Flush()
+	case commitDiscard:
+		return updaterService.DiscardStaged(commitStores)
+	}
+	return updaterService.CommitStaged(commitStores)
+}
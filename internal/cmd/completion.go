@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// Dynamic shell completion for flags that take configured names. Cobra's
+// built-in `completion` command generates the bash, zsh, fish and PowerShell
+// scripts that call back into these.
+
+// completionConfig loads the configuration named by --config on the line being
+// completed. Errors yield no suggestions rather than noise in the shell.
+func completionConfig() *config.Config {
+	if err := config.ReadConfig(cfgFile); err != nil {
+		return nil
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil
+	}
+	return cfg
+}
+
+func completeStoreNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg := completionConfig()
+	if cfg == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, store := range cfg.TrustStores {
+		names = append(names, store.Name+"\t"+store.Type+" "+store.Target)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeSourceNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg := completionConfig()
+	if cfg == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, source := range cfg.CertificateSources {
+		names = append(names, source.Name+"\t"+source.Type+" "+source.Source)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeGroupNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg := completionConfig()
+	if cfg == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return cfg.Groups(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBackups lists backups in the configured backup directory, newest
+// first, limited to the store given by --store when it is already set
+func completeBackups(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg := completionConfig()
+	if cfg == nil || cfg.Settings.BackupDirectory == "" {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	entries, err := os.ReadDir(cfg.Settings.BackupDirectory)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	prefix := ""
+	if store, _ := cmd.Flags().GetString("store"); store != "" {
+		prefix = store + "_backup_"
+	}
+	var backups []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), prefix) && strings.Contains(entry.Name(), "_backup_") {
+			backups = append(backups, entry.Name())
+		}
+	}
+	// Backup names end in a Unix timestamp
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeValues offers a fixed set of flag values
+func completeValues(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
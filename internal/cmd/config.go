@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+var (
+	lintOutput string
+	lintStrict bool
+)
+
+// configCmd groups commands that work on the configuration file
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Check the configuration",
+}
+
+// configLintCmd flags risky combinations of settings
+var configLintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Flag risky combinations of settings, with a hint for each",
+	Long: `Checks the configuration for settings that are valid but risky, such as
+verify_tls disabled on a public URL source, distrusted certificates removed
+without backups, filters that match nothing and an agent API taking keys over
+plain HTTP. Each finding has a severity (error, warning or info), a rule name
+and a remediation hint. Exits with an error when any finding is an error, or
+with --strict when any is a warning.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigLint,
+}
+
+func init() {
+	configLintCmd.Flags().StringVarP(&lintOutput, "output", "o", "text", "output format: text or json")
+	configLintCmd.Flags().BoolVar(&lintStrict, "strict", false, "fail on warnings as well as errors")
+	configCmd.AddCommand(configLintCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func runConfigLint(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	findings := config.Lint(cfg)
+
+	switch lintOutput {
+	case "json":
+		if findings == nil {
+			findings = []config.Finding{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	case "text":
+		if len(findings) == 0 {
+			fmt.Println("No problems found")
+		}
+		for _, f := range findings {
+			fmt.Printf("%-7s %s [%s]: %s\n", f.Severity, f.Subject, f.Rule, f.Message)
+			fmt.Printf("        hint: %s\n", f.Hint)
+		}
+	default:
+		return fmt.Errorf("unsupported output format %q (expected text or json)", lintOutput)
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, f := range findings {
+		switch f.Severity {
+		case config.SeverityError:
+			errorCount++
+		case config.SeverityWarning:
+			warningCount++
+		}
+	}
+	if errorCount > 0 || lintStrict && warningCount > 0 {
+		return fmt.Errorf("configuration lint found %d errors and %d warnings", errorCount, warningCount)
+	}
+	return nil
+}
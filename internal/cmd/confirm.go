@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+// addConfirmFlags adds --interactive and --yes to a command that changes stores
+func addConfirmFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&interactive, "interactive", false, "show the plan for each store and ask before applying it")
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "answer yes to all confirmation prompts")
+}
+
+// setConfirm installs the terminal prompt as the service's confirmation gate
+// when --interactive is set
+func setConfirm(updaterService *updater.Service) {
+	if interactive {
+		updaterService.SetConfirm(newPrompter(os.Stdin, os.Stdout, assumeYes).confirm)
+	}
+}
+
+// prompter asks for approval of each store's plan on the terminal
+type prompter struct {
+	in         *bufio.Reader
+	out        io.Writer
+	approveAll bool
+}
+
+func newPrompter(in io.Reader, out io.Writer, assumeYes bool) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out, approveAll: assumeYes}
+}
+
+// confirm prints the plan and reads y/N/all/quit. End of input counts as no.
+func (p *prompter) confirm(plan updater.StorePlan) (bool, error) {
+	fmt.Fprintf(p.out, "\nStore %s: %d certificates to add, %d to remove\n", plan.Store, len(plan.Add), len(plan.Remove))
+	for _, c := range plan.Add {
+		fmt.Fprintf(p.out, "  + %s (%s) from %s\n", c.X509Cert.Subject.CommonName, cert.GetCertificateFingerprint(c.X509Cert)[:16], c.Source)
+	}
+	for _, c := range plan.Remove {
+		fmt.Fprintf(p.out, "  - %s (%s) from %s\n", c.X509Cert.Subject.CommonName, cert.GetCertificateFingerprint(c.X509Cert)[:16], c.Source)
+	}
+	if p.approveAll {
+		return true, nil
+	}
+
+	for {
+		fmt.Fprintf(p.out, "Apply changes to %s? [y/N/all/quit] ", plan.Store)
+		answer, err := p.in.ReadString('\n')
+		if err != nil && answer == "" {
+			fmt.Fprintln(p.out)
+			return false, nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		case "", "n", "no":
+			return false, nil
+		case "a", "all":
+			p.approveAll = true
+			return true, nil
+		case "q", "quit":
+			return false, updater.ErrAborted
+		default:
+			fmt.Fprintln(p.out, "Please answer y, n, all or quit.")
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+// newTestPlan returns a plan adding one self-signed root to the system store
+func newTestPlan(t *testing.T) updater.StorePlan {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "Corp Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return updater.StorePlan{Store: "system", Add: []*updater.Certificate{{X509Cert: c, Source: "corp"}}}
+}
+
+func TestPrompterConfirm(t *testing.T) {
+	plan := newTestPlan(t)
+	tests := []struct {
+		name      string
+		input     string
+		assumeYes bool
+		want      []bool // answer to each of a run of plans
+		wantErr   error
+		prompts   int
+		retry     bool // whether the valid answers are listed after a bad one
+	}{
+		{name: "yes", input: "y\n", want: []bool{true}, prompts: 1},
+		{name: "yes in capitals with spaces", input: "  YES \r\n", want: []bool{true}, prompts: 1},
+		{name: "no", input: "No\n", want: []bool{false}, prompts: 1},
+		{name: "empty answer is no", input: "\n", want: []bool{false}, prompts: 1},
+		{name: "all applies to later stores", input: "All\n", want: []bool{true, true, true}, prompts: 1},
+		{name: "quit aborts", input: "q\n", want: []bool{false}, wantErr: updater.ErrAborted, prompts: 1},
+		{name: "unknown answer asks again", input: "maybe\ny\n", want: []bool{true}, prompts: 2, retry: true},
+		{name: "last answer without newline", input: "y", want: []bool{true}, prompts: 1},
+		// stdin that isn't a terminal and has nothing on it, without --yes
+		{name: "end of input is no", input: "", want: []bool{false, false}, prompts: 2},
+		// --interactive with --yes shows each plan but never asks
+		{name: "assume yes", input: "", assumeYes: true, want: []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := newPrompter(strings.NewReader(tt.input), &out, tt.assumeYes)
+			for i, want := range tt.want {
+				got, err := p.confirm(plan)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("confirm %d error = %v, want %v", i, err, tt.wantErr)
+				}
+				if got != want {
+					t.Errorf("confirm %d = %v, want %v", i, got, want)
+				}
+			}
+			if n := strings.Count(out.String(), "Apply changes to system?"); n != tt.prompts {
+				t.Errorf("prompted %d times, want %d:\n%s", n, tt.prompts, out.String())
+			}
+			if n := strings.Count(out.String(), "+ Corp Root"); n != len(tt.want) {
+				t.Errorf("listed the plan %d times, want %d", n, len(tt.want))
+			}
+			if got := strings.Contains(out.String(), "Please answer y, n, all or quit."); got != tt.retry {
+				t.Errorf("retry hint shown = %v, want %v", got, tt.retry)
+			}
+		})
+	}
+}
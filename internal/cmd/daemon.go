@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/lock"
+	"github.com/webprofusion/trust-store-updater/internal/platform"
+	"github.com/webprofusion/trust-store-updater/internal/server"
+)
+
+// shutdownTimeout bounds how long requests in flight may finish on stop
+const shutdownTimeout = 30 * time.Second
+
+// watchSettle is how long the system stores must be quiet after a change
+// before the daemon responds, so an install touching many entries is one change
+const watchSettle = 2 * time.Second
+
+// daemon is serve's long-running mode: the agent API plus, with an interval,
+// scheduled updates. Service managers drive it through run, pause and resume.
+type daemon struct {
+	srv      *server.Server
+	backend  *serviceBackend
+	interval time.Duration
+	// watch is settings.watch_stores: how to respond to system store changes
+	watch string
+}
+
+// run serves until ctx is cancelled or the API fails
+func (d *daemon) run(ctx context.Context) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- d.srv.ListenAndServe()
+	}()
+
+	var tick <-chan time.Time
+	if d.interval > 0 {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var changed <-chan struct{}
+	if d.watch != "" {
+		var err error
+		if changed, err = platform.WatchSystemStores(ctx); err != nil {
+			certstore.LogWarnf("Not watching the system stores: %v", err)
+		}
+	}
+	settle := time.NewTimer(watchSettle)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case err := <-serveErr:
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		case <-tick:
+			d.update()
+			ignoreChanges(changed)
+		case <-changed:
+			settle.Reset(watchSettle)
+		case <-settle.C:
+			d.storesChanged()
+			ignoreChanges(changed)
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			return d.srv.Shutdown(shutdownCtx)
+		}
+	}
+}
+
+// update runs one scheduled update unless the daemon is paused
+func (d *daemon) update() {
+	if d.srv.Paused() {
+		certstore.LogInfof("Skipping scheduled update: paused")
+		return
+	}
+	_, err := d.srv.Sync("")
+	switch {
+	case errors.Is(err, lock.ErrHeld):
+		certstore.LogInfof("Skipping scheduled update: %v", err)
+	case err != nil:
+		certstore.LogErrorf("Scheduled update failed: %v", err)
+	}
+}
+
+// storesChanged responds to a change to the system stores made while the
+// daemon runs
+func (d *daemon) storesChanged() {
+	if d.srv.Paused() {
+		certstore.LogInfof("System store changed; ignored while paused")
+		return
+	}
+	if d.watch == "sync" {
+		certstore.LogInfof("System store changed; updating")
+		d.update()
+		return
+	}
+	changes, err := d.backend.Drift()
+	if err != nil {
+		certstore.LogErrorf("Drift check failed: %v", err)
+		return
+	}
+	if len(changes) == 0 {
+		certstore.LogInfof("System store changed; no drift from baseline")
+	}
+}
+
+// ignoreChanges discards a change signalled while the daemon updated the
+// stores itself
+func ignoreChanges(changed <-chan struct{}) {
+	select {
+	case <-changed:
+	default:
+	}
+}
+
+// runUntilSignal runs the daemon in the foreground until interrupted
+func (d *daemon) runUntilSignal() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return d.run(ctx)
+}
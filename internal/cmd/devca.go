@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/devca"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+// devCASource is the source recorded for the development root in the manifest
+const devCASource = "dev-ca"
+
+var (
+	devCADir        string
+	devCANoInstall  bool
+	devCAName       string
+	devCASANs       []string
+	devCAFormat     string
+	devCACertFile   string
+	devCAKeyFile    string
+	devCAPassword   string
+	devCARenewHook  string
+	devCARenewDays  int
+	devCARenewForce bool
+)
+
+// devCACmd groups commands for the local development CA
+var devCACmd = &cobra.Command{
+	Use:   "dev-ca",
+	Short: "Manage a local development CA for HTTPS on this machine",
+	Long: `Creates a development root for the current user, installs it into the
+configured trust stores, and issues certificates for local HTTPS from it. The
+root's key is kept in the user's config directory and readable by that user
+only.`,
+}
+
+// devCACreateCmd generates the development root and installs it
+var devCACreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create the development root and install it into the configured stores",
+	Long: `Generates the development root and its key, then adds the root to every
+configured store available on this host with the same validation, backup,
+audit log and manifest as add. Use --no-install to only create it, e.g. to
+install it later with elevated privileges.`,
+	Args: cobra.NoArgs,
+	RunE: runDevCACreate,
+}
+
+// devCAInstallCmd installs an existing development root
+var devCAInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the development root into the configured stores",
+	Args:  cobra.NoArgs,
+	RunE:  runDevCAInstall,
+}
+
+// devCAIssueCmd issues a certificate from the development root
+var devCAIssueCmd = &cobra.Command{
+	Use:   "issue [NAME...]",
+	Short: "Issue a certificate for host names, IP addresses or email addresses",
+	Long: `Issues a TLS server and client certificate from the development root for
+--name and each --san, or the names given as arguments, e.g. --name localhost
+--san 127.0.0.1 --san ::1 --san "*.app.test". The first name is the subject.
+
+--format pem writes a certificate and a key file; pfx and jks write one
+PKCS#12 or Java keystore file holding the key, certificate and root,
+protected by --password (jks also needs keytool). Files go
+to the current directory unless --cert-file (and --key-file) are given; keys
+and keystores are readable by the current user only.
+
+The certificate is recorded so that dev-ca renew can reissue it to the same
+files; --renew-hook names a command to run after each renewal.`,
+	RunE: runDevCAIssue,
+}
+
+// devCARenewCmd reissues recorded certificates that are due
+var devCARenewCmd = &cobra.Command{
+	Use:   "renew",
+	Short: "Reissue issued certificates that expire soon or predate the current root",
+	Long: `Reissues each certificate recorded by dev-ca issue that expires within --days,
+or was issued by an earlier development root, to the same files and format,
+then runs its renew hook. Run it from cron or a scheduled task to keep local
+certificates current.`,
+	Args: cobra.NoArgs,
+	RunE: runDevCARenew,
+}
+
+// devCAListCmd lists the recorded certificates
+var devCAListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the certificates issued by the development root",
+	Args:  cobra.NoArgs,
+	RunE:  runDevCAList,
+}
+
+func init() {
+	devCACmd.PersistentFlags().StringVar(&devCADir, "dir", "", "directory of the development CA (default is the user's config directory)")
+	devCACreateCmd.Flags().BoolVar(&devCANoInstall, "no-install", false, "create the root without installing it")
+	devCAIssueCmd.Flags().StringVar(&devCAName, "name", "", "subject name of the certificate")
+	devCAIssueCmd.Flags().StringArrayVar(&devCASANs, "san", nil, "additional host name, IP address or email address (repeatable)")
+	devCAIssueCmd.Flags().StringVar(&devCAFormat, "format", devca.FormatPEM, "output format: pem, pfx or jks")
+	devCAIssueCmd.Flags().StringVar(&devCACertFile, "cert-file", "", "certificate, PKCS#12 or keystore output file")
+	devCAIssueCmd.Flags().StringVar(&devCAKeyFile, "key-file", "", "key output file for pem")
+	devCAIssueCmd.Flags().StringVar(&devCAPassword, "password", "changeit", "password of pfx and jks output")
+	devCAIssueCmd.Flags().StringVar(&devCARenewHook, "renew-hook", "", `command run after the certificate is renewed, e.g. "systemctl reload nginx"`)
+	devCARenewCmd.Flags().IntVar(&devCARenewDays, "days", 30, "renew certificates expiring within this many days")
+	devCARenewCmd.Flags().BoolVar(&devCARenewForce, "force", false, "renew every recorded certificate")
+	addConfirmFlags(devCACreateCmd)
+	addConfirmFlags(devCAInstallCmd)
+	devCACmd.AddCommand(devCACreateCmd, devCAInstallCmd, devCAIssueCmd, devCARenewCmd, devCAListCmd)
+	rootCmd.AddCommand(devCACmd)
+}
+
+// devCADirectory returns --dir or the per-user default
+func devCADirectory() (string, error) {
+	if devCADir != "" {
+		return devCADir, nil
+	}
+	return devca.DefaultDir()
+}
+
+func runDevCACreate(cmd *cobra.Command, args []string) error {
+	dir, err := devCADirectory()
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Printf("DRY RUN: would create a development CA in %s\n", dir)
+		return nil
+	}
+	ca, err := devca.Create(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created development CA %s (%s) in %s\n", ca.Certificate().Subject.CommonName, cert.GetCertificateFingerprint(ca.Certificate()), dir)
+	if devCANoInstall {
+		return nil
+	}
+	return installDevCA(ca)
+}
+
+func runDevCAInstall(cmd *cobra.Command, args []string) error {
+	dir, err := devCADirectory()
+	if err != nil {
+		return err
+	}
+	ca, err := devca.Load(dir)
+	if err != nil {
+		return err
+	}
+	return installDevCA(ca)
+}
+
+// installDevCA adds the development root to every available store
+func installDevCA(ca *devca.CA) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	setConfirm(updaterService)
+	return updaterService.AddToAllStores(ca.CertificatePath(), devCASource)
+}
+
+func runDevCAIssue(cmd *cobra.Command, args []string) error {
+	var names []string
+	if devCAName != "" {
+		names = append(names, devCAName)
+	}
+	names = append(append(names, devCASANs...), args...)
+	if len(names) == 0 {
+		return fmt.Errorf("give the certificate's names with --name and --san, or as arguments")
+	}
+
+	dir, err := devCADirectory()
+	if err != nil {
+		return err
+	}
+	ca, err := devca.Load(dir)
+	if err != nil {
+		return err
+	}
+
+	req := devca.Request{
+		Names:    names,
+		Format:   devCAFormat,
+		CertFile: devCACertFile,
+		KeyFile:  devCAKeyFile,
+		Hook:     strings.Fields(devCARenewHook),
+	}
+	base := strings.ReplaceAll(names[0], "*", "_wildcard")
+	if len(names) > 1 {
+		base += fmt.Sprintf("+%d", len(names)-1)
+	}
+	switch devCAFormat {
+	case devca.FormatPEM:
+		if req.CertFile == "" {
+			req.CertFile = base + ".pem"
+		}
+		if req.KeyFile == "" {
+			req.KeyFile = base + "-key.pem"
+		}
+	case devca.FormatPFX, devca.FormatJKS:
+		if req.KeyFile != "" {
+			return fmt.Errorf("--key-file only applies to pem output; %s files hold the key", devCAFormat)
+		}
+		if req.CertFile == "" {
+			req.CertFile = base + "." + devCAFormat
+		}
+		req.Password = devCAPassword
+	default:
+		return fmt.Errorf("unsupported format %q (expected pem, pfx or jks)", devCAFormat)
+	}
+	if dryRun {
+		fmt.Printf("DRY RUN: would issue a certificate for %s to %s\n", strings.Join(names, ", "), req.CertFile)
+		return nil
+	}
+
+	issued, err := ca.IssueTo(req, certstore.CommandRunner{Verbose: verbose})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Issued a certificate for %s, valid until %s\n", strings.Join(names, ", "), issued.NotAfter.Format("2006-01-02"))
+	fmt.Printf("Certificate: %s\n", issued.CertFile)
+	if issued.KeyFile != "" {
+		fmt.Printf("Key: %s\n", issued.KeyFile)
+	}
+	return nil
+}
+
+func runDevCARenew(cmd *cobra.Command, args []string) error {
+	dir, err := devCADirectory()
+	if err != nil {
+		return err
+	}
+	ca, err := devca.Load(dir)
+	if err != nil {
+		return err
+	}
+	before := time.Duration(devCARenewDays) * 24 * time.Hour
+
+	if dryRun {
+		records, err := ca.Issued()
+		if err != nil {
+			return err
+		}
+		root := cert.GetCertificateFingerprint(ca.Certificate())
+		for _, r := range records {
+			if devCARenewForce || r.Due(root, before) {
+				fmt.Printf("DRY RUN: would renew %s (%s)\n", r.CertFile, strings.Join(r.Names, ", "))
+			}
+		}
+		return nil
+	}
+
+	results, err := ca.Renew(before, devCARenewForce, certstore.CommandRunner{Verbose: verbose})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("Failed to renew %s: %v\n", r.Issued.CertFile, r.Err)
+			continue
+		}
+		fmt.Printf("Renewed %s (%s), valid until %s\n", r.Issued.CertFile, strings.Join(r.Issued.Names, ", "), r.Issued.NotAfter.Format("2006-01-02"))
+	}
+	if len(results) == 0 {
+		fmt.Println("No certificates are due for renewal")
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d certificates failed to renew", failed, len(results))
+	}
+	return nil
+}
+
+func runDevCAList(cmd *cobra.Command, args []string) error {
+	dir, err := devCADirectory()
+	if err != nil {
+		return err
+	}
+	ca, err := devca.Load(dir)
+	if err != nil {
+		return err
+	}
+	records, err := ca.Issued()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Println("No certificates have been issued")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMES\tFORMAT\tEXPIRES\tFILE")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", strings.Join(r.Names, ","), r.Format, r.NotAfter.Format("2006-01-02"), r.CertFile)
+	}
+	return w.Flush()
+}
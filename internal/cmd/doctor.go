@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var doctorFix bool
+
+// doctorCmd checks configured stores for common problems
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check configured trust stores for problems",
+	Long: `Checks each configured store for missing update tooling, broken symlinks,
+duplicate certificates, expired managed certificates and managed files that are
+missing from the state manifest. Use --fix to apply the safe repairs; removing
+an expired certificate takes the same lock, maintenance window, approval,
+confirmation and backup steps as an update.`,
+	RunE: runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "apply safe repairs for problems that support it")
+	addConfirmFlags(doctorCmd)
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+	setConfirm(updaterService)
+
+	issues, err := updaterService.Diagnose()
+	if err != nil {
+		return err
+	}
+
+	if len(issues) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	unresolved := 0
+	var fixable []updater.Issue
+	for _, issue := range issues {
+		marker := ""
+		if issue.Fix != nil {
+			marker = " [fixable]"
+		}
+		fmt.Printf("%s: %s: %s%s\n", issue.Store, issue.Check, issue.Message, marker)
+
+		if issue.Fix == nil || !doctorFix || dryRun {
+			if issue.Fix != nil && doctorFix {
+				fmt.Println("  DRY RUN: would apply fix")
+			}
+			unresolved++
+			continue
+		}
+		fixable = append(fixable, issue)
+	}
+
+	if len(fixable) > 0 {
+		err := updaterService.Repair(fixable, func(issue updater.Issue, err error) {
+			if err != nil {
+				fmt.Printf("%s: %s: fix failed: %v\n", issue.Store, issue.Check, err)
+				unresolved++
+				return
+			}
+			fmt.Printf("%s: %s: fixed\n", issue.Store, issue.Check)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if unresolved > 0 {
+		return fmt.Errorf("%d of %d problems remain", unresolved, len(issues))
+	}
+	return nil
+}
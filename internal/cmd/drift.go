@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var driftAccept bool
+
+// driftCmd compares stores with their baselines
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Report certificates changed outside trust-store-updater",
+	Long: `Compares each configured store with the baseline snapshot taken after the
+last successful update and lists certificates added or removed since then by
+anything other than this tool. Exits with an error when drift is found, so it
+can be scheduled as a monitoring check. Use --accept to take a new baseline of
+the stores as they are now.`,
+	RunE: runDrift,
+}
+
+func init() {
+	driftCmd.Flags().BoolVar(&driftAccept, "accept", false, "accept the current store contents as the new baseline")
+	rootCmd.AddCommand(driftCmd)
+}
+
+func runDrift(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	if driftAccept {
+		if dryRun {
+			fmt.Println("DRY RUN: would take a new baseline of each store")
+			return nil
+		}
+		if err := updaterService.AcceptDrift(); err != nil {
+			return err
+		}
+		fmt.Println("Baseline updated")
+		return nil
+	}
+
+	changes, err := updaterService.DetectDrift()
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("No drift from baseline")
+		return nil
+	}
+
+	for _, change := range changes {
+		fmt.Printf("%s: %s %s (%s)\n", change.Store, change.Action(), change.Subject, change.Fingerprint)
+	}
+	return fmt.Errorf("%d certificate(s) changed outside trust-store-updater", len(changes))
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/facts"
+)
+
+var factsEval string
+
+// factsCmd shows the host facts available to when: conditions
+var factsCmd = &cobra.Command{
+	Use:   "facts",
+	Short: "Show the host facts used by when: conditions",
+	Long: `Prints the facts gathered about this host and which well-known applications
+were found, as used by the when: conditions of stores and sources. Use --eval
+to check what a condition evaluates to here.`,
+	RunE: runFacts,
+}
+
+func init() {
+	factsCmd.Flags().StringVar(&factsEval, "eval", "", "evaluate a when: condition on this host")
+	rootCmd.AddCommand(factsCmd)
+}
+
+func runFacts(cmd *cobra.Command, args []string) error {
+	f := facts.Gather()
+
+	if factsEval != "" {
+		cond, err := facts.Compile(factsEval)
+		if err != nil {
+			return err
+		}
+		fmt.Println(cond.Eval(f))
+		return nil
+	}
+
+	fmt.Printf("hostname:       %s\n", f.Hostname)
+	fmt.Printf("os:             %s\n", f.OS)
+	fmt.Printf("arch:           %s\n", f.Arch)
+	fmt.Printf("distro:         %s\n", f.Distro)
+	fmt.Printf("distro_like:    %s\n", strings.Join(f.DistroLike, " "))
+	fmt.Printf("distro_version: %s\n", f.DistroVersion)
+	fmt.Printf("domain:         %s\n", f.Domain)
+	fmt.Printf("domain_joined:  %v\n", f.Domain != "")
+
+	var found []string
+	for _, app := range f.Applications() {
+		if f.Installed(app) {
+			found = append(found, app)
+		}
+	}
+	fmt.Printf("installed:      %s\n", strings.Join(found, ", "))
+	return nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/history"
+)
+
+var (
+	historyStore       string
+	historyOutcome     string
+	historySince       string
+	historyUntil       string
+	historyFingerprint string
+	historyLimit       int
+	historyJSON        bool
+)
+
+// historyCmd queries the run history database
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show past update runs and when certificates were installed",
+	Long: `Lists recorded update runs, newest first, optionally filtered by store, outcome
+(success, partial, failure) and time range. With --fingerprint, lists every
+recorded install of the matching certificates instead, oldest first, so the
+first line per store is when it was first installed there. Times accept
+RFC3339 timestamps, dates or durations relative to now (e.g. 720h).`,
+	RunE: runHistory,
+}
+
+func init() {
+	historyCmd.Flags().StringVar(&historyStore, "store", "", "only show runs that updated this store")
+	historyCmd.Flags().StringVar(&historyOutcome, "outcome", "", "only show runs with this outcome (success, partial, failure)")
+	historyCmd.Flags().StringVar(&historySince, "since", "", "only show runs started at or after this time")
+	historyCmd.Flags().StringVar(&historyUntil, "until", "", "only show runs started at or before this time")
+	historyCmd.Flags().StringVar(&historyFingerprint, "fingerprint", "", "show installs of certificates whose SHA-256 fingerprint starts with this value")
+	historyCmd.Flags().IntVar(&historyLimit, "limit", 50, "maximum number of runs to show (0 for all)")
+	historyCmd.Flags().BoolVar(&historyJSON, "json", false, "output as JSON")
+	_ = historyCmd.RegisterFlagCompletionFunc("store", completeStoreNames)
+	_ = historyCmd.RegisterFlagCompletionFunc("outcome", completeValues(history.OutcomeSuccess, history.OutcomePartial, history.OutcomeFailure))
+	rootCmd.AddCommand(historyCmd)
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Settings.HistoryDatabase == "" {
+		return fmt.Errorf("settings.history_database is not configured")
+	}
+	db, err := history.Open(cfg.Settings.HistoryDatabase)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if historyFingerprint != "" {
+		installs, err := db.Installs(historyFingerprint, historyStore)
+		if err != nil {
+			return err
+		}
+		if historyJSON {
+			return json.NewEncoder(os.Stdout).Encode(installs)
+		}
+		if len(installs) == 0 {
+			fmt.Println("No recorded installs")
+		}
+		for _, in := range installs {
+			fmt.Printf("%s  run %-5d  %s  %s  %s  (source: %s)\n", in.InstalledAt.Local().Format(time.RFC3339),
+				in.RunID, in.Store, shortFingerprint(in.Fingerprint), in.Subject, in.Source)
+		}
+		return nil
+	}
+
+	filter := history.Filter{Store: historyStore, Outcome: historyOutcome, Limit: historyLimit}
+	if filter.Since, err = parseTimeFlag(historySince); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseTimeFlag(historyUntil); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+	runs, err := db.Runs(filter)
+	if err != nil {
+		return err
+	}
+
+	if historyJSON {
+		return json.NewEncoder(os.Stdout).Encode(runs)
+	}
+	for _, r := range runs {
+		line := fmt.Sprintf("%s  run %-5d  %-7s  %s  fetched %d", r.StartedAt.Local().Format(time.RFC3339),
+			r.ID, r.Outcome, r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond), r.Fetched)
+		if r.Error != "" {
+			line += "  error: " + r.Error
+		}
+		fmt.Println(line)
+		for _, sr := range r.Stores {
+			if historyStore != "" && sr.Store != historyStore {
+				continue
+			}
+			storeLine := fmt.Sprintf("    %s: %d added, %d already present, %d failed", sr.Store, sr.Added, sr.Skipped, sr.Failed)
+			if sr.Error != "" {
+				storeLine += " (error: " + sr.Error + ")"
+			}
+			fmt.Println(storeLine)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+var (
+	initOutput string
+	initForce  bool
+)
+
+// initCmd writes a configuration file tailored to this machine
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a configuration file for this machine",
+	Long: `Probes this machine for the system trust stores and installed applications
+(Java, Firefox, Docker) that can be managed, asks which certificate sources and
+stores to use, and writes a commented configuration file. With --yes the
+suggested answers are used without prompting.`,
+	RunE: runInit,
+}
+
+func init() {
+	initCmd.Flags().StringVarP(&initOutput, "output", "o", "./trust-store-config.yaml", "configuration file to write")
+	initCmd.Flags().BoolVar(&initForce, "force", false, "overwrite an existing configuration file")
+	initCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "accept the suggested answers without prompting")
+	rootCmd.AddCommand(initCmd)
+}
+
+func runInit(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(initOutput); err == nil && !initForce {
+		return fmt.Errorf("%s already exists; use --force to overwrite it", initOutput)
+	}
+
+	p := newPrompter(os.Stdin, os.Stdout, assumeYes)
+	opts := config.DefaultGenerateOptions()
+	opts.TrustStores = nil
+
+	fmt.Println("Probing trust stores on this machine...")
+	for _, d := range discoverStores() {
+		if !d.available {
+			continue
+		}
+		root := ""
+		if d.requiresRoot {
+			root = ", requires root"
+		}
+		if !p.askYesNo(fmt.Sprintf("Manage %s store %s%s?", d.storeType, d.target, root), true) {
+			continue
+		}
+		opts.TrustStores = append(opts.TrustStores, config.TrustStore{
+			Name:        d.name(),
+			Type:        string(d.storeType),
+			Platform:    []string{runtime.GOOS},
+			Target:      d.target,
+			Enabled:     true,
+			RequireRoot: d.requiresRoot,
+		})
+	}
+	if len(opts.TrustStores) == 0 {
+		fmt.Println("No stores selected; add trust_stores entries before running the updater (see the stores command).")
+	}
+
+	opts.MozillaBundle = p.askYesNo("Trust the Mozilla CA bundle from curl.se?", true)
+	if dir := p.ask("Directory of additional certificates to install (blank for none)", ""); dir != "" {
+		opts.LocalDirectory = dir
+		opts.LocalDirectoryEnabled = true
+	}
+	opts.BackupDirectory = p.ask("Backup directory", opts.BackupDirectory)
+	opts.AuditEnabled = p.askYesNo("Record changes in the audit log?", true)
+
+	data, err := config.Generate(opts)
+	if err != nil {
+		return fmt.Errorf("failed to generate configuration: %w", err)
+	}
+	if err := atomicfile.WriteFile(initOutput, data, 0644); err != nil {
+		return fmt.Errorf("failed to write configuration: %w", err)
+	}
+
+	fmt.Printf("Wrote %s\n", initOutput)
+	fmt.Printf("Check the sources with `trust-store-updater --config %s sources test`, then preview changes with --dry-run.\n", initOutput)
+	return nil
+}
+
+// ask prints question and returns the trimmed answer, or def when the answer
+// is empty, input has ended or prompts are being skipped
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		question = fmt.Sprintf("%s [%s]", question, def)
+	}
+	fmt.Fprintf(p.out, "%s: ", question)
+	if p.approveAll {
+		fmt.Fprintln(p.out, def)
+		return def
+	}
+
+	answer, err := p.in.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(p.out)
+		return def
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def
+	}
+	return answer
+}
+
+// askYesNo asks a yes/no question, returning def for an empty answer
+func (p *prompter) askYesNo(question string, def bool) bool {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	for {
+		switch strings.ToLower(p.ask(fmt.Sprintf("%s [%s]", question, choices), "")) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		default:
+			fmt.Fprintln(p.out, "Please answer y or n.")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/sbom"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	listStore   string
+	listManaged bool
+	listOutput  string
+)
+
+// listCmd lists store contents with their provenance
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List certificates in the configured stores and where they came from",
+	Long: `Lists the certificates in each available store, marking those installed by
+trust-store-updater with the source they came from. With --managed, lists the
+manifest of installed certificates only, without opening the stores. JSON
+output (-o json) includes the full provenance of each managed certificate: the
+source name, the URL or file it was read from, when it was retrieved and the
+SHA-256 digest of the bundle.
+
+-o cyclonedx and -o spdx describe the trust anchors in this host's stores as
+a CycloneDX 1.6 BOM (certificates as cryptographic-asset components) or an
+SPDX 2.3 document (certificates as packages), for security tooling that
+ingests software inventories.`,
+	RunE: runList,
+}
+
+func init() {
+	listCmd.Flags().StringVar(&listStore, "store", "", "only list this store")
+	listCmd.Flags().BoolVar(&listManaged, "managed", false, "only list certificates installed by trust-store-updater")
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", "text", "output format (text, json, cyclonedx, spdx)")
+	_ = listCmd.RegisterFlagCompletionFunc("store", completeStoreNames)
+	_ = listCmd.RegisterFlagCompletionFunc("output", completeValues("text", "json", sbom.FormatCycloneDX, sbom.FormatSPDX))
+	rootCmd.AddCommand(listCmd)
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	inventory := listOutput == sbom.FormatCycloneDX || listOutput == sbom.FormatSPDX
+	if listOutput != "text" && listOutput != "json" && !inventory {
+		return fmt.Errorf("unknown output format %q (expected text, json, %s or %s)", listOutput, sbom.FormatCycloneDX, sbom.FormatSPDX)
+	}
+	if inventory && listManaged {
+		return fmt.Errorf("-o %s lists the stores themselves and can't be used with --managed", listOutput)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	listed, err := updaterService.List(listStore, listManaged)
+	if err != nil {
+		return err
+	}
+
+	if inventory {
+		return writeInventory(listed)
+	}
+	if listOutput == "json" {
+		if listed == nil {
+			listed = []updater.ListedCertificate{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listed)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STORE\tFINGERPRINT\tEXPIRES\tSUBJECT\tSOURCE\tRETRIEVED")
+	for _, c := range listed {
+		source, retrieved := "-", "-"
+		if m := c.Managed; m != nil {
+			source = m.Source
+			if p := m.Provenance; p != nil {
+				if p.Location != "" {
+					source += " (" + p.Location + ")"
+				}
+				retrieved = p.RetrievedAt.Local().Format(time.RFC3339)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Store, shortFingerprint(c.Fingerprint), c.NotAfter, c.Subject, source, retrieved)
+	}
+	return w.Flush()
+}
+
+// writeInventory prints the listing as a CycloneDX or SPDX document
+func writeInventory(listed []updater.ListedCertificate) error {
+	host, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	doc := &sbom.Document{Host: host, ToolVersion: version, Created: time.Now()}
+	for _, c := range listed {
+		entry := sbom.Entry{Store: c.Store, Certificate: c.Certificate}
+		if c.Managed != nil {
+			entry.Source = c.Managed.Source
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	data, err := doc.Marshal(listOutput)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/osquery"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	osquerySocket   string
+	osqueryTimeout  int
+	osqueryInterval int
+)
+
+// osqueryCmd serves the store contents to osquery as a table
+var osqueryCmd = &cobra.Command{
+	Use:   "osquery-extension",
+	Short: "Serve store contents to osquery as the trust_store_certificates table",
+	Long: `Runs as an osquery extension, adding a trust_store_certificates table with a
+row for each certificate in each available store, so trust stores can be
+queried with SQL wherever osquery is deployed:
+
+  SELECT store, subject, not_after FROM trust_store_certificates WHERE managed = 0;
+
+osquery starts extensions with --socket, --timeout and --interval. To autoload
+it, list an executable wrapper such as
+
+  #!/bin/sh
+  exec /usr/local/bin/trust-store-updater osquery-extension --config /etc/trust-store-updater/config.yaml "$@"
+
+in osquery's extensions.load file; osquery requires it to be owned by root
+and named with a .ext extension. Linux and macOS only.`,
+	Args: cobra.NoArgs,
+	RunE: runOsqueryExtension,
+}
+
+func init() {
+	osqueryCmd.Flags().StringVar(&osquerySocket, "socket", "", "osquery extension manager socket")
+	osqueryCmd.Flags().IntVar(&osqueryTimeout, "timeout", 3, "seconds to wait for the extension manager")
+	osqueryCmd.Flags().IntVar(&osqueryInterval, "interval", 3, "seconds between checks that osquery is still running")
+	_ = osqueryCmd.MarkFlagRequired("socket")
+	rootCmd.AddCommand(osqueryCmd)
+}
+
+func runOsqueryExtension(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	ext := &osquery.Extension{
+		Name:     "trust-store-updater",
+		Version:  version,
+		Socket:   osquerySocket,
+		Timeout:  time.Duration(osqueryTimeout) * time.Second,
+		Interval: time.Duration(osqueryInterval) * time.Second,
+		Verbose:  verbose,
+		Tables: []osquery.Table{{
+			Name: "trust_store_certificates",
+			Columns: []osquery.Column{
+				{Name: "store", Type: osquery.TypeText},
+				{Name: "fingerprint", Type: osquery.TypeText},
+				{Name: "subject", Type: osquery.TypeText},
+				{Name: "issuer", Type: osquery.TypeText},
+				{Name: "serial", Type: osquery.TypeText},
+				{Name: "not_before", Type: osquery.TypeBigInt},
+				{Name: "not_after", Type: osquery.TypeBigInt},
+				{Name: "ca", Type: osquery.TypeInteger},
+				{Name: "managed", Type: osquery.TypeInteger},
+				{Name: "source", Type: osquery.TypeText},
+			},
+			Generate: func() ([]map[string]string, error) {
+				updaterService, err := updater.New(cfg, false, true)
+				if err != nil {
+					return nil, err
+				}
+				defer updaterService.Close()
+				listed, err := updaterService.List("", false)
+				if err != nil {
+					return nil, err
+				}
+				return certificateRows(listed), nil
+			},
+		}},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return ext.Run(ctx)
+}
+
+// certificateRows returns a trust_store_certificates row for each listed
+// certificate, with times as Unix seconds
+func certificateRows(listed []updater.ListedCertificate) []map[string]string {
+	rows := make([]map[string]string, 0, len(listed))
+	for _, c := range listed {
+		if c.Certificate == nil {
+			continue
+		}
+		row := map[string]string{
+			"store":       c.Store,
+			"fingerprint": c.Fingerprint,
+			"subject":     c.Certificate.Subject.String(),
+			"issuer":      c.Certificate.Issuer.String(),
+			"serial":      c.Certificate.SerialNumber.Text(16),
+			"not_before":  fmt.Sprint(c.Certificate.NotBefore.Unix()),
+			"not_after":   fmt.Sprint(c.Certificate.NotAfter.Unix()),
+			"ca":          boolColumn(c.Certificate.IsCA),
+			"managed":     boolColumn(c.Managed != nil),
+			"source":      "",
+		}
+		if c.Managed != nil {
+			row["source"] = c.Managed.Source
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func boolColumn(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/lock"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	diffOutput string
+	applyPlan  string
+)
+
+// diffCmd prints the changes an update would make
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes an update would make to each store",
+	Long: `Runs an update as a dry run and prints the certificates it would add to or
+remove from each store, with the source or reason for each. With -o json the
+plan is printed as a JSON document that apply --plan accepts, so a change can
+be reviewed before it is made:
+
+  trust-store-updater diff -o json > plan.json
+  trust-store-updater apply --plan plan.json
+
+The dry run's own output goes to stderr.`,
+	RunE: runDiff,
+}
+
+// applyCmd applies a plan saved by diff
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply a plan saved by diff -o json",
+	Long: `Runs an update that makes only the changes in the plan. Changes the update
+finds that aren't in the plan are left out and reported; planned changes that
+no longer apply are ignored. The plan is refused if the configuration file or
+any store it changes changed since it was made. A plan signed with approve
+--plan must carry a valid, unexpired signature by an approver in
+approval.allowed_signers; hosts that require approval, or set
+approval.signed_plans, refuse unsigned plans. SSH and GPG stores and ACME
+certificates aren't part of plans and are left alone.`,
+	RunE: runApply,
+}
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "text", "output format (text, json)")
+	diffCmd.Flags().StringSliceVar(&groups, "group", nil, "only plan the stores in this group (repeatable)")
+	_ = diffCmd.RegisterFlagCompletionFunc("output", completeValues("text", "json"))
+	_ = diffCmd.RegisterFlagCompletionFunc("group", completeGroupNames)
+	applyCmd.Flags().StringVar(&applyPlan, "plan", "", "plan file written by diff -o json")
+	applyCmd.Flags().StringSliceVar(&groups, "group", nil, "only apply the plan to the stores in this group (repeatable)")
+	_ = applyCmd.MarkFlagRequired("plan")
+	_ = applyCmd.RegisterFlagCompletionFunc("group", completeGroupNames)
+	rootCmd.AddCommand(diffCmd, applyCmd)
+}
+
+// configDigest returns the SHA-256 digest of the configuration file
+func configDigest() (string, error) {
+	path := config.GetConfigPath()
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read configuration: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// newPlanService returns the updater for diff and apply
+func newPlanService(dryRun bool) (*updater.Service, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) > 0 {
+		if cfg, err = cfg.ForGroups(groups); err != nil {
+			return nil, err
+		}
+	}
+	return updater.New(cfg, verbose, dryRun)
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	if diffOutput != "text" && diffOutput != "json" {
+		return fmt.Errorf("unknown output format %q (expected text or json)", diffOutput)
+	}
+	digest, err := configDigest()
+	if err != nil {
+		return err
+	}
+	updaterService, err := newPlanService(true)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	// The dry run prints its progress and summary; keep stdout for the plan
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	err = updaterService.UpdateTrustStores()
+	os.Stdout = stdout
+	if err != nil {
+		return err
+	}
+
+	plan := updaterService.Plan()
+	plan.ConfigSHA256 = digest
+	if diffOutput == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+	if len(plan.Changes) == 0 {
+		fmt.Println("No changes")
+		return nil
+	}
+	for _, c := range plan.Changes {
+		sign := "+"
+		if c.Op == updater.OpRemove {
+			sign = "-"
+		}
+		fmt.Printf("%s %s %s %s (%s)\n", sign, c.Store, shortFingerprint(c.Fingerprint), c.Subject, c.Reason)
+	}
+	return nil
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+	updaterService, err := newPlanService(dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	plan, err := updaterService.LoadPlan(applyPlan)
+	if err != nil {
+		return err
+	}
+	digest, err := configDigest()
+	if err != nil {
+		return err
+	}
+	if plan.ConfigSHA256 != digest {
+		return fmt.Errorf("the configuration changed since the plan was made; run diff again")
+	}
+
+	err = updaterService.UpdateTrustStores()
+	if errors.Is(err, lock.ErrHeld) {
+		return fmt.Errorf("plan not applied: %w", err)
+	}
+	return err
+}
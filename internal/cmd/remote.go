@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/remote"
+)
+
+var (
+	remoteHosts    []string
+	inventoryFile  string
+	remoteParallel int
+	remoteTimeout  time.Duration
+)
+
+func init() {
+	rootCmd.Flags().StringSliceVar(&remoteHosts, "remote", nil, "update these hosts over SSH instead of this one ([user@]host[:port], repeatable)")
+	rootCmd.Flags().StringVar(&inventoryFile, "inventory", "", "update the hosts listed in this inventory file instead of this one")
+	rootCmd.Flags().IntVar(&remoteParallel, "remote-parallel", 4, "how many remote hosts to update at once")
+	rootCmd.Flags().DurationVar(&remoteTimeout, "remote-timeout", 30*time.Minute, "bound each step on a remote host, including the update")
+}
+
+// remoteMode reports whether the run updates remote hosts
+func remoteMode() bool {
+	return len(remoteHosts) > 0 || inventoryFile != ""
+}
+
+// runRemote uploads the tool and this configuration to each host and runs
+// the update there with the same flags
+func runRemote() error {
+	if interactive {
+		return fmt.Errorf("--interactive can't be used with remote hosts")
+	}
+	path := config.GetConfigPath()
+	if path == "" {
+		return fmt.Errorf("remote mode needs a configuration file to send to the hosts")
+	}
+	cfgData, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
+
+	runner := remote.NewRunner(remoteTimeout, verbose)
+	runner.Parallel = remoteParallel
+	var hosts []remote.Host
+	if inventoryFile != "" {
+		inv, err := remote.LoadInventory(inventoryFile)
+		if err != nil {
+			return err
+		}
+		hosts, runner.Binaries = inv.Hosts, inv.Binaries
+	}
+	for _, spec := range remoteHosts {
+		h, err := remote.ParseHost(spec)
+		if err != nil {
+			return err
+		}
+		hosts = append(hosts, h)
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("no remote hosts to update")
+	}
+
+	args := []string{"update"}
+	for _, group := range groups {
+		args = append(args, "--group", group)
+	}
+	if label != "" {
+		args = append(args, "--label", label)
+	}
+	if preset != "" {
+		if _, ok := config.Presets[preset]; !ok {
+			return fmt.Errorf("unknown preset %q (expected one of %s)", preset, strings.Join(config.PresetNames(), ", "))
+		}
+		args = append(args, "--preset", preset)
+	}
+	if verbose {
+		args = append(args, "--verbose")
+	}
+	if readOnly {
+		args = append(args, "--read-only")
+	}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+
+	results := runner.Run(hosts, cfgData, args, printRemoteResult)
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	fmt.Printf("Remote update: %d of %d hosts succeeded\n", len(results)-failed, len(results))
+	if failed > 0 {
+		return fmt.Errorf("%d remote host(s) failed", failed)
+	}
+	return nil
+}
+
+// printRemoteResult prints a host's output as it finishes, each line prefixed
+// with the host so interleaved hosts stay readable
+func printRemoteResult(r remote.Result) {
+	status := "ok"
+	if r.Err != nil {
+		status = "failed: " + r.Err.Error()
+	}
+	platform := r.Platform
+	if platform == "" {
+		platform = "unknown platform"
+	}
+	fmt.Printf("==> %s (%s, %s): %s\n", r.Host, platform, r.Duration.Round(time.Second), status)
+	for _, line := range strings.Split(strings.TrimRight(r.Output, "\n"), "\n") {
+		if line != "" {
+			fmt.Printf("[%s] %s\n", r.Host, line)
+		}
+	}
+}
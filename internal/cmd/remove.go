@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	removeStore       string
+	removeFingerprint string
+	removeSubject     string
+)
+
+// removeCmd removes a single certificate from one store
+var removeCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove a certificate from one trust store",
+	Long: `Removes one certificate from a configured store, identified by its SHA-256
+fingerprint (or a unique prefix of it) or by its subject or common name. The
+store is backed up first when backups are enabled, and the removal is recorded
+in the audit log and the manifest. Fails without changing anything when more
+than one certificate matches. Hosts that require approval need one made with
+approve --remove for the certificate's fingerprint and this store.`,
+	RunE: runRemove,
+}
+
+func init() {
+	removeCmd.Flags().StringVar(&removeStore, "store", "", "name of the configured store to remove from")
+	removeCmd.Flags().StringVar(&removeFingerprint, "fingerprint", "", "SHA-256 fingerprint of the certificate, or a unique prefix")
+	removeCmd.Flags().StringVar(&removeSubject, "subject", "", "subject or common name of the certificate")
+	_ = removeCmd.MarkFlagRequired("store")
+	removeCmd.MarkFlagsOneRequired("fingerprint", "subject")
+	removeCmd.MarkFlagsMutuallyExclusive("fingerprint", "subject")
+	_ = removeCmd.RegisterFlagCompletionFunc("store", completeStoreNames)
+	addConfirmFlags(removeCmd)
+	rootCmd.AddCommand(removeCmd)
+}
+
+func runRemove(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	setConfirm(updaterService)
+	return updaterService.RemoveFromStore(removeStore, removeFingerprint, removeSubject)
+}
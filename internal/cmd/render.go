@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/render"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	renderTarget string
+	renderOutput string
+	renderDistro string
+	renderFormat string
+
+	renderProfileID   string
+	renderSigningCert string
+	renderSigningKey  string
+)
+
+// renderCmd writes the merged trust set in formats consumed by other tools
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render the merged trust set for use outside this host",
+	Long: `Fetches and validates all configured sources and writes the resulting trust
+set without modifying any store.
+
+Targets:
+  bundle        ca-bundle.pem with a comment header per certificate, ordered by subject
+  docker-build  certs/ directory plus a Dockerfile.snippet (COPY + update RUN line)
+  mobileconfig  Apple configuration profile for MDM managed macOS/iOS devices, signed
+                with --signing-cert and --signing-key when given
+  gpo           Registry.pol for a Group Policy object's Machine folder plus an
+                equivalent PowerShell DSC configuration (CertificateDsc module)
+  inventory     variables file (--format yaml or json) listing each certificate with
+                fingerprints and PEM, for Ansible, Chef or Puppet to install
+  onc           Open Network Configuration for ChromeOS (Google Admin console or
+                the OpenNetworkConfiguration policy), roots trusted for Web`,
+	RunE: runRender,
+}
+
+func init() {
+	renderCmd.Flags().StringVar(&renderTarget, "target", "", "output format (bundle, docker-build, mobileconfig, gpo, inventory, onc)")
+	renderCmd.Flags().StringVarP(&renderOutput, "output", "o", "./render", "output directory")
+	renderCmd.Flags().StringVar(&renderDistro, "distro", "debian", "docker-build: base image family (debian, alpine, rhel)")
+	renderCmd.Flags().StringVar(&renderFormat, "format", "yaml", "inventory: variables file format (yaml, json)")
+	renderCmd.Flags().StringVar(&renderProfileID, "profile-id", render.DefaultProfileIdentifier, "mobileconfig: profile PayloadIdentifier")
+	renderCmd.Flags().StringVar(&renderSigningCert, "signing-cert", "", "mobileconfig: PEM signing certificate, followed by any intermediates")
+	renderCmd.Flags().StringVar(&renderSigningKey, "signing-key", "", "mobileconfig: PEM private key for --signing-cert")
+	renderCmd.MarkFlagsRequiredTogether("signing-cert", "signing-key")
+	_ = renderCmd.MarkFlagRequired("target")
+	_ = renderCmd.RegisterFlagCompletionFunc("target", completeValues("bundle", "docker-build", "mobileconfig", "gpo", "inventory", "onc"))
+	_ = renderCmd.RegisterFlagCompletionFunc("distro", completeValues("debian", "alpine", "rhel"))
+	_ = renderCmd.RegisterFlagCompletionFunc("format", completeValues("yaml", "json"))
+	rootCmd.AddCommand(renderCmd)
+}
+
+func runRender(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Fail on a bad signing identity before fetching anything
+	var signer *render.SigningIdentity
+	if renderSigningCert != "" {
+		if signer, err = render.LoadSigningIdentity(renderSigningCert, renderSigningKey); err != nil {
+			return err
+		}
+	}
+
+	updaterService, err := updater.New(cfg, verbose, true)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	merged, err := updaterService.MergedCertificates()
+	if err != nil {
+		return err
+	}
+
+	// Trust bundles and image trust stores only take CA certificates
+	var entries []certstore.BundleEntry
+	var certs []*x509.Certificate
+	for _, c := range merged {
+		if c.X509Cert.IsCA {
+			entries = append(entries, certstore.BundleEntry{Certificate: c.X509Cert, Source: c.Source, Label: c.Label})
+			certs = append(certs, c.X509Cert)
+		}
+	}
+
+	var files []string
+	switch renderTarget {
+	case "bundle":
+		files, err = render.Bundle(entries, renderOutput)
+	case "docker-build":
+		files, err = render.DockerBuild(certs, renderOutput, renderDistro)
+	case "mobileconfig":
+		if signer == nil {
+			fmt.Println("Warning: profile is unsigned; devices will show it as unverified")
+		}
+		files, err = render.Mobileconfig(certs, renderOutput, renderProfileID, signer)
+	case "gpo":
+		files, err = render.GPO(certs, renderOutput)
+	case "inventory":
+		files, err = render.Inventory(entries, renderOutput, renderFormat)
+	case "onc":
+		files, err = render.ONC(certs, renderOutput)
+	default:
+		return fmt.Errorf("unknown render target: %s", renderTarget)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rendered %d certificates to %s (%d files)\n", len(certs), renderOutput, len(files))
+	return nil
+}
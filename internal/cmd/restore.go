@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	restoreStore  string
+	restoreBackup string
+)
+
+// restoreCmd restores a single store from a previously created backup
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a trust store from a backup",
+	Long: `Restores a configured store from one of its backups, named as it appears in
+settings.backup_directory. The store is backed up first, and certificates the
+restore brings back must pass validation and the sealed trust anchor list, or
+the store is returned to how it was. Hosts that require approval need one made
+with approve --restore for the backup and store.`,
+	RunE: runRestore,
+}
+
+func init() {
+	restoreCmd.Flags().StringVar(&restoreStore, "store", "", "name of the configured store to restore")
+	restoreCmd.Flags().StringVar(&restoreBackup, "backup", "", "name of the backup in the backup directory to restore from")
+	_ = restoreCmd.MarkFlagRequired("store")
+	_ = restoreCmd.MarkFlagRequired("backup")
+	_ = restoreCmd.RegisterFlagCompletionFunc("store", completeStoreNames)
+	_ = restoreCmd.RegisterFlagCompletionFunc("backup", completeBackups)
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	return updaterService.RestoreStore(restoreStore, restoreBackup)
+}
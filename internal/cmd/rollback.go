@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	rollbackVersion string
+	rollbackStores  []string
+	rollbackList    bool
+)
+
+// rollbackCmd returns stores to an earlier trust set version
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Return trust stores to an earlier trust set version",
+	Long: `Each update records the trust set it evaluated as a version, identified by
+the SHA-256 of the set (and by the label given with update --label), and which
+version each store reached. rollback --to-version takes a label or an ID
+prefix and applies the reverse delta from each store's version: managed
+certificates added since are removed and certificates dropped since are added
+back, with the same backup, audit log and manifest as an update. Certificates
+added outside updates are left alone. --list shows the versions and the
+stores at each.`,
+	Args: cobra.NoArgs,
+	RunE: runRollback,
+}
+
+func init() {
+	rollbackCmd.Flags().StringVar(&rollbackVersion, "to-version", "", "label or ID prefix of the version to return to")
+	rollbackCmd.Flags().StringSliceVar(&rollbackStores, "store", nil, "only roll back this store (repeatable; default every store with a recorded version)")
+	rollbackCmd.Flags().BoolVar(&rollbackList, "list", false, "list the recorded versions")
+	rollbackCmd.MarkFlagsOneRequired("to-version", "list")
+	rollbackCmd.MarkFlagsMutuallyExclusive("to-version", "list")
+	_ = rollbackCmd.RegisterFlagCompletionFunc("store", completeStoreNames)
+	rootCmd.AddCommand(rollbackCmd)
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	if rollbackList {
+		printVersions(cfg, updaterService)
+		return nil
+	}
+	return updaterService.RollbackToVersion(rollbackVersion, rollbackStores)
+}
+
+func printVersions(cfg *config.Config, updaterService *updater.Service) {
+	atVersion := make(map[string][]string)
+	for _, storeConfig := range cfg.TrustStores {
+		if v := updaterService.StoreVersion(storeConfig.Name); v != nil {
+			atVersion[v.ID] = append(atVersion[v.ID], storeConfig.Name)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tLABEL\tCREATED\tCERTIFICATES\tSTORES")
+	for _, v := range updaterService.Versions() {
+		label, stores := v.Label, atVersion[v.ID]
+		if label == "" {
+			label = "-"
+		}
+		sort.Strings(stores)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", v.ShortID(), label, v.CreatedAt.Local().Format(time.RFC3339), v.Certificates, strings.Join(stores, ", "))
+	}
+	w.Flush()
+}
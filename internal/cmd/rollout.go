@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/rollout"
+)
+
+var (
+	rolloutVersion string
+	rolloutRestart bool
+)
+
+// rolloutCmd groups commands for staged rollouts to a fleet of agents
+var rolloutCmd = &cobra.Command{
+	Use:   "rollout",
+	Short: "Roll a trust bundle change out to a fleet of agents in stages",
+}
+
+// rolloutRunCmd runs or resumes a rollout
+var rolloutRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Sync the agents stage by stage, halting when too many fail",
+	Long: `Syncs the agents under rollout.agents through their APIs in stages: each
+stage syncs the next share of the fleet given by rollout.stages, waits
+soak_seconds and then checks each synced agent's /readyz. When more than
+max_failures agents of a stage fail to sync or aren't ready the rollout
+halts, leaving the rest of the fleet untouched.
+
+The first canary syncs alone and the digest of the bundle it installed pins
+the rollout: every later agent is sent the digest and refuses to install a
+different bundle.
+
+Running the same --version again resumes a halted or interrupted rollout with
+the same pin, skipping agents that are already healthy; --restart starts over
+and pins a new bundle. The agents are taken in an order derived from the
+version, so each version has its own canaries. With --dry-run the stages are
+listed without syncing.`,
+	Args: cobra.NoArgs,
+	RunE: runRollout,
+}
+
+// rolloutStatusCmd shows the last rollout's progress
+var rolloutStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the progress of the last rollout",
+	Args:  cobra.NoArgs,
+	RunE:  runRolloutStatus,
+}
+
+func init() {
+	rolloutRunCmd.Flags().StringVar(&rolloutVersion, "version", "", "label of the change being rolled out, e.g. the bundle version (required)")
+	rolloutRunCmd.Flags().BoolVar(&rolloutRestart, "restart", false, "start over instead of resuming a rollout of the same version")
+	_ = rolloutRunCmd.MarkFlagRequired("version")
+	rolloutCmd.AddCommand(rolloutRunCmd, rolloutStatusCmd)
+	rootCmd.AddCommand(rolloutCmd)
+}
+
+func newRolloutController() (*rollout.Controller, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return rollout.New(cfg.Rollout)
+}
+
+func runRollout(cmd *cobra.Command, args []string) error {
+	controller, err := newRolloutController()
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		for i, agents := range controller.Plan(rolloutVersion) {
+			fmt.Printf("DRY RUN: stage %d would sync %d agents\n", i+1, len(agents))
+			for _, agent := range agents {
+				fmt.Printf("  %s (%s)\n", agent.Name, agent.URL)
+			}
+		}
+		return nil
+	}
+
+	st, err := controller.Run(rolloutVersion, rolloutRestart)
+	if st != nil {
+		printRolloutState(st)
+	}
+	return err
+}
+
+func runRolloutStatus(cmd *cobra.Command, args []string) error {
+	controller, err := newRolloutController()
+	if err != nil {
+		return err
+	}
+	st, err := controller.Load()
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		fmt.Println("No rollout has run")
+		return nil
+	}
+	printRolloutState(st)
+	return nil
+}
+
+func printRolloutState(st *rollout.State) {
+	fmt.Printf("Rollout %s: %s, %d stages completed, updated %s\n", st.Version, st.Status, st.Stage, st.UpdatedAt.Local().Format(time.RFC3339))
+	if st.BundleDigest != "" {
+		fmt.Printf("Pinned bundle: %s\n", st.BundleDigest)
+	}
+
+	names := make([]string, 0, len(st.Agents))
+	for name := range st.Agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "AGENT\tSTAGE\tSYNCED\tHEALTHY\tERROR")
+	for _, name := range names {
+		r := st.Agents[name]
+		fmt.Fprintf(w, "%s\t%d\t%s\t%t\t%s\n", name, r.Stage, r.SyncedAt.Local().Format(time.RFC3339), r.Healthy, r.Error)
+	}
+	w.Flush()
+}
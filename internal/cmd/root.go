@@ -1,17 +1,39 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
 	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/lock"
 	"github.com/webprofusion/trust-store-updater/internal/updater"
 )
 
+// version is set at build time via -ldflags "-X .../internal/cmd.version=x.y.z"
+var version = "dev"
+
 var (
-	cfgFile string
-	dryRun  bool
-	verbose bool
+	cfgFile     string
+	dryRun      bool
+	verbose     bool
+	interactive bool
+	assumeYes   bool
+	readOnly    bool
+	groups      []string
+	label       string
+	preset      string
+
+	installScheduledTask bool
+	removeScheduledTask  bool
+	taskInterval         time.Duration
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -21,7 +43,16 @@ var rootCmd = &cobra.Command{
 	Long: `Trust Store Updater is a cross-platform tool that can update operating system 
 and application trust stores with new root certificates. It supports Linux, macOS, 
 and Windows, and uses configuration to determine which target stores to update.`,
-	RunE: runUpdate,
+	Version: version,
+	RunE:    runUpdate,
+}
+
+// updateCmd is the explicit form of the root command, e.g. for
+// "update --group browsers" in per-group schedules
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update the configured trust stores (the default command)",
+	RunE:  runUpdate,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -31,22 +62,167 @@ func Execute() error {
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	cobra.OnFinalize(certstore.CloseSinks)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./trust-store-config.yaml)")
 	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "show what would be updated without making changes")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", false, "reject every change to trust stores (same as settings.read_only)")
+	rootCmd.PersistentFlags().StringVar(&preset, "preset", "", "layer a role preset under the configuration: "+strings.Join(config.PresetNames(), ", "))
+	_ = rootCmd.RegisterFlagCompletionFunc("preset", cobra.FixedCompletions(config.PresetNames(), cobra.ShellCompDirectiveNoFileComp))
+	addConfirmFlags(rootCmd)
+	rootCmd.Flags().StringSliceVar(&groups, "group", nil, "only update the stores in this group (repeatable)")
+	_ = rootCmd.RegisterFlagCompletionFunc("group", completeGroupNames)
+	rootCmd.Flags().StringVar(&label, "label", "", "label the trust set version this run records, e.g. 2026.10")
+	rootCmd.Flags().BoolVar(&installScheduledTask, "install-task", false, "Windows: install a scheduled task running update with these flags every --task-interval")
+	rootCmd.Flags().BoolVar(&removeScheduledTask, "remove-task", false, "Windows: remove the installed scheduled task")
+	rootCmd.Flags().DurationVar(&taskInterval, "task-interval", time.Hour, "how often the scheduled task runs")
+	rootCmd.MarkFlagsMutuallyExclusive("install-task", "remove-task")
+	rootCmd.MarkFlagsMutuallyExclusive("install-task", "remote")
+	rootCmd.MarkFlagsMutuallyExclusive("install-task", "inventory")
+
+	// update shares the root command's run flags
+	updateCmd.Flags().AddFlagSet(rootCmd.Flags())
+	rootCmd.AddCommand(updateCmd)
 }
 
+// configFreeCommands don't load the configuration, like init, which writes
+// its own: the appliance plugin gets everything it needs in its request
+var configFreeCommands []*cobra.Command
+
+// policyErr is why the managed policy could not be read; commands that load
+// the configuration fail with it rather than run without the policy
+var policyErr error
+
 func initConfig() {
+	// Completion requests must not write a default config or print to stdout;
+	// completion functions read the config themselves
+	if len(os.Args) > 1 && (os.Args[1] == cobra.ShellCompRequestCmd || os.Args[1] == cobra.ShellCompNoDescRequestCmd) {
+		return
+	}
+	if cmd, _, err := rootCmd.Find(os.Args[1:]); err == nil && (cmd == initCmd || slices.Contains(configFreeCommands, cmd)) {
+		return
+	}
 	config.InitConfig(cfgFile)
+
+	// Centrally managed settings (Group Policy, MDM) win over the file
+	policy, err := config.ReadPolicy()
+	if err != nil {
+		policyErr = fmt.Errorf("failed to read managed policy: %w", err)
+		return
+	}
+	if policy != nil {
+		policy.Apply()
+		if verbose {
+			fmt.Printf("Applied managed policy from %s: %s\n", policy.Source, strings.Join(policy.Keys(), ", "))
+		}
+	}
 }
 
-func runUpdate(cmd *cobra.Command, args []string) error {
+// lowMemoryGCPercent is the GOGC used with settings.low_memory
+const lowMemoryGCPercent = 25
+
+// loadConfig loads the configuration and applies the logging and memory
+// settings from it
+func loadConfig() (*config.Config, error) {
+	if policyErr != nil {
+		return nil, policyErr
+	}
+	if preset != "" {
+		if err := config.UsePreset(preset); err != nil {
+			return nil, err
+		}
+	}
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if readOnly {
+		cfg.Settings.ReadOnly = true
 	}
 
-	updaterService := updater.New(cfg, verbose, dryRun)
-	return updaterService.UpdateTrustStores()
+	certstore.SetLogLevel(certstore.ParseLogLevel(cfg.Settings.LogLevel))
+
+	// Collect garbage sooner on small hosts, unless GOGC says otherwise
+	if cfg.Settings.LowMemory && os.Getenv("GOGC") == "" {
+		debug.SetGCPercent(lowMemoryGCPercent)
+	}
+
+	certstore.CloseSinks()
+	for _, name := range cfg.Settings.LogSinks {
+		sink, err := certstore.NewSink(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize log sink %s: %w", name, err)
+		}
+		certstore.AddSink(sink)
+	}
+
+	return cfg, nil
+}
+
+func runUpdate(cmd *cobra.Command, args []string) error {
+	if removeScheduledTask {
+		return removeTask()
+	}
+	if installScheduledTask {
+		return installTask(taskArgs(), taskInterval)
+	}
+	if remoteMode() {
+		return runRemote()
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if len(groups) > 0 {
+		if cfg, err = cfg.ForGroups(groups); err != nil {
+			return err
+		}
+	}
+
+	updaterService, err := updater.New(cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	updaterService.SetVersionLabel(label)
+	setConfirm(updaterService)
+
+	err = updaterService.UpdateTrustStores()
+	if errors.Is(err, lock.ErrHeld) {
+		// Scheduled runs overlapping another instance's are expected
+		certstore.LogInfof("Skipping update: %v", err)
+		return nil
+	}
+	return err
+}
+
+// taskArgs is the command line the scheduled task runs: update with the
+// configuration file made absolute and the update flags given at install
+func taskArgs() []string {
+	args := []string{"update"}
+	if path := config.GetConfigPath(); path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		args = append(args, "--config", path)
+	}
+	for _, group := range groups {
+		args = append(args, "--group", group)
+	}
+	if preset != "" {
+		args = append(args, "--preset", preset)
+	}
+	if verbose {
+		args = append(args, "--verbose")
+	}
+	if readOnly {
+		args = append(args, "--read-only")
+	}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	return args
 }
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/selfupdate"
+)
+
+var (
+	updateChannel string
+	checkOnly     bool
+)
+
+// selfUpdateCmd replaces the running binary with the latest signed release
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update trust-store-updater to the latest signed release",
+	Long: `Checks the configured release endpoint for a newer build on the selected channel,
+verifies its SHA-256 checksum and ed25519 signature, and atomically replaces the
+running binary. The signature covers the release's version, channel, OS and
+architecture along with the checksum, and a release that is not newer than the
+running version is never installed.`,
+	RunE: runSelfUpdate,
+}
+
+func init() {
+	selfUpdateCmd.Flags().StringVar(&updateChannel, "channel", "", "release channel to follow (stable, beta)")
+	selfUpdateCmd.Flags().BoolVar(&checkOnly, "check", false, "only report whether an update is available")
+	_ = selfUpdateCmd.RegisterFlagCompletionFunc("channel", completeValues("stable", "beta"))
+	rootCmd.AddCommand(selfUpdateCmd)
+}
+
+func runSelfUpdate(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	channel := cfg.SelfUpdate.Channel
+	if updateChannel != "" {
+		channel = updateChannel
+	}
+
+	updater, err := selfupdate.New(cfg.SelfUpdate.Endpoint, cfg.SelfUpdate.PublicKey, cfg.Settings.TimeoutSeconds, verbose)
+	if err != nil {
+		return fmt.Errorf("self-update is not configured: %w", err)
+	}
+
+	release, newer, err := updater.Check(version, channel)
+	if err != nil {
+		return err
+	}
+
+	if !newer {
+		fmt.Printf("Already up to date (current: %s, latest %s: %s)\n", version, channel, release.Version)
+		return nil
+	}
+
+	fmt.Printf("Update available: %s -> %s (%s)\n", version, release.Version, channel)
+	if checkOnly || dryRun {
+		return nil
+	}
+
+	if err := updater.Apply(release, version); err != nil {
+		return fmt.Errorf("self-update failed: %w", err)
+	}
+
+	fmt.Printf("Updated to version %s\n", release.Version)
+	return nil
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/history"
+	"github.com/webprofusion/trust-store-updater/internal/server"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var (
+	serveListen         string
+	serveInterval       time.Duration
+	serveInstallService bool
+	serveRemoveService  bool
+
+	serveAuthorizeKeychain bool
+)
+
+// serveCmd runs the agent API
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the agent API for dashboards and fleet controllers",
+	Long: `Serves an HTTP API for querying and driving this agent:
+
+  GET  /v1/inventory  managed certificates per store     (viewer, operator, admin)
+  POST /v1/sync       run an update of all stores        (operator, admin)
+  POST /v1/restore    {"store": ..., "backup": ...}      (admin)
+  GET  /healthz       liveness and the last run's outcome (no authentication)
+  GET  /readyz        503 unless the configuration is valid, every store is
+                      reachable and the last run didn't fail (no authentication)
+
+Callers authenticate with "Authorization: Bearer <key>" for keys listed in
+server.api_keys, or with a TLS client certificate listed in
+server.client_certificates, and may only perform what their role grants.
+
+With --interval the agent also runs an update on that schedule. On Windows,
+--install-service registers "serve" with the given flags as a service that
+starts at boot; stop, pause and continue it from the Service Control Manager
+(pausing suspends updates). On macOS it installs a launch daemon in
+/Library/LaunchDaemons instead; add --authorize-keychain to let root change
+System keychain trust, which otherwise prompts for an administrator and
+fails unattended. --remove-service unregisters either.`,
+	RunE: runServe,
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "", "address to listen on (default server.listen)")
+	serveCmd.Flags().DurationVar(&serveInterval, "interval", 0, "also run an update this often, e.g. 6h (default: only on request)")
+	serveCmd.Flags().BoolVar(&serveInstallService, "install-service", false, "install serve with these flags as a Windows service or macOS launch daemon")
+	serveCmd.Flags().BoolVar(&serveRemoveService, "remove-service", false, "stop and remove the installed service")
+	serveCmd.Flags().BoolVar(&serveAuthorizeKeychain, "authorize-keychain", false, "macOS: with --install-service, let root change System keychain trust without a prompt")
+	serveCmd.MarkFlagsMutuallyExclusive("install-service", "remove-service")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	if serveRemoveService {
+		return removeService()
+	}
+	if serveInstallService {
+		return installService(serviceArgs())
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if serveListen != "" {
+		cfg.Server.Listen = serveListen
+	}
+
+	backend := &serviceBackend{cfg: cfg}
+	srv, err := server.New(cfg.Server, backend)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Serving API on %s\n", cfg.Server.Listen)
+	if serveInterval > 0 {
+		fmt.Printf("Updating every %s\n", serveInterval)
+	}
+	if cfg.Settings.WatchStores != "" {
+		fmt.Printf("Watching the system stores (%s on change)\n", cfg.Settings.WatchStores)
+	}
+	return runDaemon(&daemon{srv: srv, backend: backend, interval: serveInterval, watch: cfg.Settings.WatchStores}, cfg)
+}
+
+// serviceArgs is the command line a service manager runs: serve with the
+// configuration file made absolute and the serve flags given at install
+func serviceArgs() []string {
+	args := []string{"serve"}
+	if path := config.GetConfigPath(); path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		args = append(args, "--config", path)
+	}
+	if serveListen != "" {
+		args = append(args, "--listen", serveListen)
+	}
+	if serveInterval > 0 {
+		args = append(args, "--interval", serveInterval.String())
+	}
+	if verbose {
+		args = append(args, "--verbose")
+	}
+	if readOnly {
+		args = append(args, "--read-only")
+	}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	return args
+}
+
+// serviceBackend runs each API operation with a fresh updater service, as
+// the equivalent command would
+type serviceBackend struct {
+	cfg *config.Config
+
+	mu      sync.Mutex
+	lastRun *history.Run // last sync served, for when history is disabled
+}
+
+func (b *serviceBackend) Inventory() (map[string][]*state.ManagedCertificate, error) {
+	svc, err := updater.New(b.cfg, verbose, true)
+	if err != nil {
+		return nil, err
+	}
+	defer svc.Close()
+	return svc.Inventory(), nil
+}
+
+// Drift checks every store against its baseline, logging each change
+func (b *serviceBackend) Drift() ([]updater.DriftChange, error) {
+	svc, err := updater.New(b.cfg, verbose, true)
+	if err != nil {
+		return nil, err
+	}
+	defer svc.Close()
+	return svc.DetectDrift()
+}
+
+func (b *serviceBackend) Sync(bundleDigest string) (*updater.Report, error) {
+	svc, err := updater.New(b.cfg, verbose, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	defer svc.Close()
+	svc.SetBundleDigest(bundleDigest)
+	err = svc.UpdateTrustStores()
+
+	b.mu.Lock()
+	b.lastRun = updater.HistoryRun(svc.Report(), err)
+	b.mu.Unlock()
+	return svc.Report(), err
+}
+
+func (b *serviceBackend) Restore(store, backup string) error {
+	svc, err := updater.New(b.cfg, verbose, dryRun)
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+	return svc.RestoreStore(store, backup)
+}
+
+// LastRun returns the newest run in the history database, which includes
+// scheduled runs outside the API, or else the last sync served
+func (b *serviceBackend) LastRun() (*history.Run, error) {
+	if path := b.cfg.Settings.HistoryDatabase; path != "" {
+		db, err := history.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		runs, err := db.Runs(history.Filter{Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) > 0 {
+			return runs[0], nil
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastRun, nil
+}
+
+func (b *serviceBackend) Readiness() []server.Check {
+	if err := config.ValidateConfig(b.cfg); err != nil {
+		return []server.Check{{Name: "config", Detail: err.Error()}}
+	}
+	checks := []server.Check{{Name: "config", OK: true}}
+
+	svc, err := updater.New(b.cfg, false, true)
+	if err != nil {
+		return append(checks, server.Check{Name: "stores", Detail: err.Error()})
+	}
+	defer svc.Close()
+	stores, err := svc.CheckStores()
+	if err != nil {
+		return append(checks, server.Check{Name: "stores", Detail: err.Error()})
+	}
+	for _, st := range stores {
+		checks = append(checks, server.Check{Name: "store:" + st.Store, OK: st.Reachable, Detail: st.Error})
+	}
+	return checks
+}
@@ -0,0 +1,124 @@
+//go:build darwin
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/platform/darwin"
+)
+
+// launchdLabel names the launch daemon and its property list
+const launchdLabel = "com.webprofusion.trust-store-updater"
+
+var (
+	launchdPlist = filepath.Join("/Library/LaunchDaemons", launchdLabel+".plist")
+	launchdLog   = "/Library/Logs/trust-store-updater.log"
+)
+
+// runDaemon runs in the foreground under launchd as from a terminal, first
+// warning when System keychain changes would wait on a prompt nobody sees
+func runDaemon(d *daemon, cfg *config.Config) error {
+	if authorized, err := darwin.TrustSettingsAuthorized(); err == nil && !authorized {
+		certstore.LogWarnf("%s is not pre-authorized; System keychain updates will fail until it is granted (see serve --authorize-keychain)", darwin.TrustSettingsRight)
+	}
+	return d.runUntilSignal()
+}
+
+// installService writes a launch daemon that runs serve with args at boot
+// and keeps it running, then loads it
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	dir := "/"
+	if path := config.GetConfigPath(); path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			dir = filepath.Dir(abs)
+		}
+	}
+
+	if serveAuthorizeKeychain {
+		if err := darwin.PreauthorizeTrustSettings(); err != nil {
+			return err
+		}
+		fmt.Printf("Pre-authorized %s\n", darwin.TrustSettingsRight)
+	} else if authorized, err := darwin.TrustSettingsAuthorized(); err == nil && !authorized {
+		fmt.Printf("Warning: %s is not pre-authorized, so System keychain updates will fail unattended;\n"+
+			"grant it with an MDM profile or reinstall with --authorize-keychain\n", darwin.TrustSettingsRight)
+	}
+
+	// Replace an existing daemon so changed flags take effect
+	runner := certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout, Verbose: verbose}
+	if _, err := os.Stat(launchdPlist); err == nil {
+		_, _ = runner.Run("launchctl", "bootout", "system/"+launchdLabel)
+	}
+	if err := atomicfile.WriteFile(launchdPlist, launchdPropertyList(append([]string{exe}, args...), dir), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", launchdPlist, err)
+	}
+	if _, err := runner.Run("launchctl", "bootstrap", "system", launchdPlist); err != nil {
+		return fmt.Errorf("failed to load %s: %w", launchdPlist, err)
+	}
+	fmt.Printf("Installed launch daemon %s running: %s %v\n", launchdLabel, exe, args)
+	return nil
+}
+
+// removeService unloads the launch daemon and deletes its property list
+func removeService() error {
+	if _, err := os.Stat(launchdPlist); os.IsNotExist(err) {
+		return fmt.Errorf("launch daemon %s is not installed", launchdLabel)
+	}
+	runner := certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout, Verbose: verbose}
+	if _, err := runner.Run("launchctl", "bootout", "system/"+launchdLabel); err != nil {
+		fmt.Printf("Warning: failed to unload %s: %v\n", launchdLabel, err)
+	}
+	if err := os.Remove(launchdPlist); err != nil {
+		return err
+	}
+	fmt.Printf("Removed launch daemon %s\n", launchdLabel)
+	return nil
+}
+
+// launchdPropertyList is the launch daemon definition: start at boot, restart
+// on exit, and run from the configuration directory so relative paths such
+// as ./state resolve as they do from a terminal
+func launchdPropertyList(argv []string, dir string) []byte {
+	var b bytes.Buffer
+	str := func(s string) {
+		b.WriteString("\t<string>")
+		xml.EscapeText(&b, []byte(s))
+		b.WriteString("</string>\n")
+	}
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	b.WriteString("\t<key>Label</key>\n")
+	str(launchdLabel)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range argv {
+		b.WriteString("\t")
+		str(arg)
+	}
+	b.WriteString("\t</array>\n")
+	b.WriteString("\t<key>WorkingDirectory</key>\n")
+	str(dir)
+	b.WriteString("\t<key>StandardOutPath</key>\n")
+	str(launchdLog)
+	b.WriteString("\t<key>StandardErrorPath</key>\n")
+	str(launchdLog)
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<true/>\n")
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
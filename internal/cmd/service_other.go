@@ -0,0 +1,21 @@
+//go:build !windows && !darwin
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+func runDaemon(d *daemon, cfg *config.Config) error {
+	return d.runUntilSignal()
+}
+
+func installService(args []string) error {
+	return fmt.Errorf("--install-service is only supported on Windows and macOS")
+}
+
+func removeService() error {
+	return fmt.Errorf("--remove-service is only supported on Windows and macOS")
+}
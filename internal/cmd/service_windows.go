@@ -0,0 +1,180 @@
+//go:build windows
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// serviceName is the Service Control Manager name, shared with the event
+// log source so service status and run logs appear together
+const serviceName = certstore.EventLogSource
+
+// runDaemon runs under the Service Control Manager when started by it, or in
+// the foreground otherwise
+func runDaemon(d *daemon, cfg *config.Config) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to detect the service control manager: %w", err)
+	}
+	if !isService {
+		return d.runUntilSignal()
+	}
+
+	// Services start in System32; resolve relative paths in the configuration
+	// such as ./state against the configuration file instead
+	if path := config.GetConfigPath(); path != "" {
+		if err := os.Chdir(filepath.Dir(path)); err != nil {
+			return err
+		}
+	}
+	if !slices.Contains(cfg.Settings.LogSinks, "eventlog") {
+		if sink, err := certstore.NewSink("eventlog"); err == nil {
+			certstore.AddSink(sink)
+		}
+	}
+	return svc.Run(serviceName, &windowsService{d: d})
+}
+
+// windowsService adapts the daemon to Service Control Manager requests
+type windowsService struct {
+	d *daemon
+}
+
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.d.run(ctx)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: accepts}
+	certstore.LogInfof("Service %s started", serviceName)
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				certstore.LogErrorf("Service %s stopped: %v", serviceName, err)
+				return true, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				if err := <-done; err != nil {
+					certstore.LogErrorf("Service %s stopped: %v", serviceName, err)
+					return true, 1
+				}
+				certstore.LogInfof("Service %s stopped", serviceName)
+				return false, 0
+			case svc.Pause:
+				s.d.srv.SetPaused(true)
+				status <- svc.Status{State: svc.Paused, Accepts: accepts}
+				certstore.LogInfof("Service %s paused; updates are suspended", serviceName)
+			case svc.Continue:
+				s.d.srv.SetPaused(false)
+				status <- svc.Status{State: svc.Running, Accepts: accepts}
+				certstore.LogInfof("Service %s resumed", serviceName)
+			}
+		}
+	}
+}
+
+// installService registers this executable with the Service Control Manager
+// to run "serve" with args at boot, restarting it if it fails
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if existing, err := m.OpenService(serviceName); err == nil {
+		existing.Close()
+		return fmt.Errorf("service %s is already installed", serviceName)
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Trust Store Updater",
+		Description: "Keeps operating system and application trust stores up to date",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	recovery := []mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Minute},
+		{Type: mgr.NoAction},
+	}
+	if err := s.SetRecoveryActions(recovery, uint32((24 * time.Hour).Seconds())); err != nil {
+		certstore.LogWarnf("Could not set service recovery actions: %v", err)
+	}
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		certstore.LogWarnf("Could not register event log source %s: %v", serviceName, err)
+	}
+
+	fmt.Printf("Installed service %s: %s %v\n", serviceName, exe, args)
+	fmt.Printf("Start it with: sc start %s\n", serviceName)
+	return nil
+}
+
+// removeService stops and unregisters the service and its event log source
+func removeService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if st, err := s.Control(svc.Stop); err == nil {
+		deadline := time.Now().Add(shutdownTimeout)
+		for st.State != svc.Stopped && time.Now().Before(deadline) {
+			time.Sleep(500 * time.Millisecond)
+			if st, err = s.Query(); err != nil {
+				break
+			}
+		}
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to remove service: %w", err)
+	}
+	if err := eventlog.Remove(serviceName); err != nil {
+		certstore.LogWarnf("Could not remove event log source %s: %v", serviceName, err)
+	}
+
+	fmt.Printf("Removed service %s\n", serviceName)
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+var sourcesTestNames []string
+
+// sourcesCmd groups commands that work on certificate sources
+var sourcesCmd = &cobra.Command{
+	Use:   "sources",
+	Short: "Work with configured certificate sources",
+}
+
+// sourcesTestCmd fetches sources without touching any store
+var sourcesTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Fetch certificate sources and report what they contain",
+	Long: `Fetches each enabled certificate source (or only those named with --source,
+even if disabled) without touching any trust store, and reports reachability,
+latency, certificate counts, certificates dropped by filters or rejected by the
+validation policy, and parse warnings. Useful when authoring configuration.`,
+	RunE: runSourcesTest,
+}
+
+func init() {
+	sourcesTestCmd.Flags().StringSliceVar(&sourcesTestNames, "source", nil, "only test the named source (repeatable)")
+	_ = sourcesTestCmd.RegisterFlagCompletionFunc("source", completeSourceNames)
+	sourcesCmd.AddCommand(sourcesTestCmd)
+	rootCmd.AddCommand(sourcesCmd)
+}
+
+func runSourcesTest(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	updaterService, err := updater.New(cfg, verbose, true)
+	if err != nil {
+		return err
+	}
+	defer updaterService.Close()
+
+	results, err := updaterService.TestSources(sourcesTestNames)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Println("No enabled certificate sources")
+		return nil
+	}
+
+	failed := 0
+	for _, result := range results {
+		fmt.Printf("%s (%s %s)\n", result.Name, result.Type, result.Source)
+		if result.Err != nil {
+			failed++
+			fmt.Printf("  FAILED after %s: %v\n", result.Duration.Round(time.Millisecond), result.Err)
+		} else {
+			fmt.Printf("  OK in %s: %d certificates, %d accepted, %d filtered, %d rejected\n",
+				result.Duration.Round(time.Millisecond), result.Fetched, len(result.Accepted), result.Filtered, len(result.Rejected))
+		}
+		for _, rej := range result.Rejected {
+			fmt.Printf("  rejected: %s: %s\n", rej.Subject, rej.Reason)
+		}
+		for _, warning := range result.Warnings {
+			fmt.Printf("  warning: %s\n", warning)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sources failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/lock"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// stateCmd groups commands that operate on the managed-state manifest
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Manage the state manifest of installed certificates",
+}
+
+// stateSignCmd signs the current state file without verifying it
+var stateSignCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign the state file with settings.state_signing_key",
+	Long: `Signs the state file as it is now, without verifying any existing signature.
+Use this once after enabling settings.state_signing_key, or after rotating the
+key, having first reviewed the state file: every later run refuses to load it
+if it is changed outside trust-store-updater.`,
+	RunE: runStateSign,
+}
+
+func init() {
+	stateCmd.AddCommand(stateSignCmd)
+	rootCmd.AddCommand(stateCmd)
+}
+
+func runStateSign(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Settings.StateSigningKey == "" {
+		return fmt.Errorf("settings.state_signing_key is not configured")
+	}
+
+	signer, err := state.NewSigner(cfg.Settings.StateSigningKey)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Printf("DRY RUN: would sign %s\n", cfg.Settings.StateFile)
+		return nil
+	}
+
+	// Hold the update lock so a run can't save the state between load and sign
+	if path := cfg.Settings.LockFile; path != "" {
+		instanceID := cfg.Settings.InstanceID
+		if instanceID == "" {
+			instanceID = lock.DefaultInstanceID()
+		}
+		l, err := lock.Acquire(path, instanceID)
+		if err != nil {
+			return err
+		}
+		defer l.Release()
+	}
+	st, err := state.Load(cfg.Settings.StateFile)
+	if err != nil {
+		return err
+	}
+	st.SetSigner(signer)
+	if err := st.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Signed %s (signature in %s)\n", cfg.Settings.StateFile, state.SignaturePath(cfg.Settings.StateFile))
+	return nil
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform"
+)
+
+var storesAll bool
+
+// storesCmd lists the store targets this machine supports
+var storesCmd = &cobra.Command{
+	Use:   "stores",
+	Short: "List the trust store targets available on this machine",
+	Long: `Probes every system and application store target known on this platform and
+reports whether it is available here and whether updating it requires root,
+followed by a configuration snippet for each available store (every store with
+--all). Does not need a configuration file.`,
+	RunE: runStores,
+}
+
+func init() {
+	storesCmd.Flags().BoolVar(&storesAll, "all", false, "print configuration snippets for unavailable stores too")
+	rootCmd.AddCommand(storesCmd)
+}
+
+// discoveredStore is the result of probing one target
+type discoveredStore struct {
+	storeType    certstore.StoreType
+	target       string
+	available    bool
+	requiresRoot bool
+}
+
+// discoverStores probes every system and application target on this platform
+func discoverStores() []discoveredStore {
+	factory := platform.NewFactory(verbose)
+
+	var found []discoveredStore
+	for _, storeType := range []certstore.StoreType{certstore.StoreTypeSystem, certstore.StoreTypeApplication} {
+		for _, target := range factory.Targets(storeType) {
+			d := discoveredStore{storeType: storeType, target: target}
+			if store, err := factory.CreateStore(storeType, target, nil); err == nil {
+				d.available = store.IsSupported()
+				d.requiresRoot = store.RequiresRoot()
+			}
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+func runStores(cmd *cobra.Command, args []string) error {
+	found := discoverStores()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tTARGET\tAVAILABLE\tREQUIRES ROOT")
+	for _, d := range found {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.storeType, d.target, yesNo(d.available), yesNo(d.requiresRoot))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println("\nPlatform-neutral store types (see README):")
+	fmt.Println("  plugin: external executable named by target")
+	for _, storeType := range []certstore.StoreType{certstore.StoreTypeVault, certstore.StoreTypeAWS} {
+		if targets, ok := platform.NeutralTargets(storeType); ok {
+			fmt.Printf("  %s: %s\n", storeType, strings.Join(targets, ", "))
+		}
+	}
+	if providers := certstore.StoreProviders(); len(providers) > 0 {
+		fmt.Printf("  custom: %s\n", strings.Join(providers, ", "))
+	}
+
+	fmt.Println("\n# Sample trust_stores entries")
+	fmt.Println("trust_stores:")
+	for _, d := range found {
+		if d.available || storesAll {
+			fmt.Print(storeSnippet(d))
+		}
+	}
+	return nil
+}
+
+// name is the trust_stores name suggested for a discovered store
+func (d discoveredStore) name() string {
+	return fmt.Sprintf("%s-%s", d.storeType, d.target)
+}
+
+// storeSnippet renders a trust_stores entry for a discovered store
+func storeSnippet(d discoveredStore) string {
+	enabled := "true"
+	comment := ""
+	if !d.available {
+		enabled = "false"
+		comment = "  # not available on this machine"
+	}
+	return fmt.Sprintf(`  - name: "%s"
+    type: "%s"
+    platform: ["%s"]
+    target: "%s"
+    enabled: %s%s
+    require_root: %t
+`, d.name(), d.storeType, runtime.GOOS, d.target, enabled, comment, d.requiresRoot)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
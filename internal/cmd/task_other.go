@@ -0,0 +1,16 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+func installTask(args []string, interval time.Duration) error {
+	return fmt.Errorf("--install-task is only supported on Windows; schedule update with cron or a systemd timer")
+}
+
+func removeTask() error {
+	return fmt.Errorf("--remove-task is only supported on Windows")
+}
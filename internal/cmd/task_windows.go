@@ -0,0 +1,62 @@
+//go:build windows
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// installTask registers a scheduled task that runs this executable with args
+// every interval as SYSTEM. Runs outside a store's maintenance windows only
+// report, so the task can run often and apply changes once a window opens.
+func installTask(args []string, interval time.Duration) error {
+	schedule, err := taskSchedule(interval)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	command := []string{syscall.EscapeArg(exe)}
+	for _, arg := range args {
+		command = append(command, syscall.EscapeArg(arg))
+	}
+	runner := certstore.CommandRunner{Verbose: verbose}
+	taskArgs := append([]string{"/Create", "/F", "/TN", serviceName, "/TR", strings.Join(command, " "), "/RU", "SYSTEM", "/RL", "HIGHEST"}, schedule...)
+	if _, err := runner.Run("schtasks", taskArgs...); err != nil {
+		return fmt.Errorf("failed to create scheduled task: %w", err)
+	}
+	fmt.Printf("Installed scheduled task %s, every %s: %s %v\n", serviceName, interval, exe, args)
+	return nil
+}
+
+// removeTask unregisters the scheduled task
+func removeTask() error {
+	runner := certstore.CommandRunner{Verbose: verbose}
+	if _, err := runner.Run("schtasks", "/Delete", "/F", "/TN", serviceName); err != nil {
+		return fmt.Errorf("failed to remove scheduled task: %w", err)
+	}
+	fmt.Printf("Removed scheduled task %s\n", serviceName)
+	return nil
+}
+
+// taskSchedule returns the schtasks schedule arguments for interval
+func taskSchedule(interval time.Duration) ([]string, error) {
+	switch {
+	case interval%(24*time.Hour) == 0 && interval > 0:
+		return []string{"/SC", "DAILY", "/MO", strconv.Itoa(int(interval / (24 * time.Hour)))}, nil
+	case interval%time.Hour == 0 && interval > 0:
+		return []string{"/SC", "HOURLY", "/MO", strconv.Itoa(int(interval / time.Hour))}, nil
+	case interval%time.Minute == 0 && interval > 0 && interval < 24*time.Hour:
+		return []string{"/SC", "MINUTE", "/MO", strconv.Itoa(int(interval / time.Minute))}, nil
+	}
+	return nil, fmt.Errorf("--task-interval must be whole minutes under a day, whole hours or whole days, not %s", interval)
+}
@@ -1,10 +1,19 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"os"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/spf13/viper"
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/maintenance"
 )
 
 // Config represents the application configuration
@@ -12,44 +21,546 @@ type Config struct {
 	CertificateSources []CertificateSource `mapstructure:"certificate_sources"`
 	TrustStores        []TrustStore        `mapstructure:"trust_stores"`
 	Settings           Settings            `mapstructure:"settings"`
+	SelfUpdate         SelfUpdate          `mapstructure:"self_update"`
+	Audit              Audit               `mapstructure:"audit"`
+	Validation         Validation          `mapstructure:"validation"`
+	SSH                SSH                 `mapstructure:"ssh"`
+	GPG                GPG                 `mapstructure:"gpg"`
+	Server             Server              `mapstructure:"server"`
+	Anchors            Anchors             `mapstructure:"anchors"`
+	Approval           Approval            `mapstructure:"approval"`
+	// Distrusted lists compromised CAs removed from every store on each run
+	Distrusted []DistrustedCertificate `mapstructure:"distrusted_certificates"`
+	// Composition combines root programs into the trust set all stores get
+	Composition Composition `mapstructure:"composition"`
+	// ACME keeps application leaf certificates issued and renewed
+	ACME ACME `mapstructure:"acme"`
+	// MaintenanceWindows limit when stores may be changed
+	MaintenanceWindows []MaintenanceWindow `mapstructure:"maintenance_windows"`
+	// Rollout configures the rollout command driving a fleet of agents
+	Rollout Rollout `mapstructure:"rollout"`
 }
 
 // CertificateSource defines where to fetch new certificates from
 type CertificateSource struct {
 	Name        string            `mapstructure:"name"`
-	Type        string            `mapstructure:"type"` // "url", "file", "directory"
+	Type        string            `mapstructure:"type"` // "url", "file", "directory", "authroot", "apple"
 	Source      string            `mapstructure:"source"`
 	Enabled     bool              `mapstructure:"enabled"`
 	Headers     map[string]string `mapstructure:"headers,omitempty"`
 	VerifyTLS   bool              `mapstructure:"verify_tls"`
 	Filters     []string          `mapstructure:"filters,omitempty"`
+	RequireCA   *bool             `mapstructure:"require_ca"`  // default true; false allows end-entity certificates
+	AIAChasing  bool              `mapstructure:"aia_chasing"` // fetch missing intermediates via Authority Information Access
+	AIAMaxDepth int               `mapstructure:"aia_max_depth"`
+	// Label is a template for the alias/friendly name certificates are installed under,
+	// e.g. "corp-{{.CommonName}}"; Labels assigns explicit labels by SHA-256 fingerprint
+	Label  string            `mapstructure:"label,omitempty"`
+	Labels map[string]string `mapstructure:"labels,omitempty"`
+	// MaxSizeMB overrides settings.max_bundle_size_mb; ContentTypes restricts the
+	// media types accepted from url sources (HTML is always rejected)
+	MaxSizeMB    int      `mapstructure:"max_size_mb"`
+	ContentTypes []string `mapstructure:"content_types,omitempty"`
+	// PinnedCA is a PEM file of the only CAs the url source's TLS chain may use;
+	// SHA256 is the expected digest of the downloaded bundle
+	PinnedCA string `mapstructure:"pinned_ca,omitempty"`
+	SHA256   string `mapstructure:"sha256,omitempty"`
+	// Groups limits the source to runs of these groups; a source without
+	// groups is shared by every group
+	Groups []string `mapstructure:"groups,omitempty"`
+	// When is a host facts condition, e.g. `domain_joined`; the source is
+	// skipped on hosts where it is false
+	When string `mapstructure:"when,omitempty"`
+	// RequestsPerMinute limits requests to a url source, on top of
+	// settings.requests_per_minute
+	RequestsPerMinute int `mapstructure:"requests_per_minute"`
+	// Resolve maps host names to IP addresses that a url source connects to
+	// without DNS; DoHResolver is a DNS-over-HTTPS endpoint (e.g.
+	// https://1.1.1.1/dns-query) for other hosts. Both bootstrap hosts whose
+	// DNS or proxy path only works once the CA is installed.
+	Resolve     map[string]string `mapstructure:"resolve,omitempty"`
+	DoHResolver string            `mapstructure:"doh_resolver,omitempty"`
+	// Purposes keeps only the authroot roots Microsoft trusts for one of
+	// these EKUs, e.g. ["server-auth"]; SignerCA is a PEM file of the roots
+	// the authroot list's signature must chain to. Without it the list is
+	// refused unless InsecureSkipVerify accepts it unverified.
+	Purposes           []string `mapstructure:"purposes,omitempty"`
+	SignerCA           string   `mapstructure:"signer_ca,omitempty"`
+	InsecureSkipVerify bool     `mapstructure:"insecure_skip_verify"`
+	// TrustPurposes limits what stores trust the source's certificates for:
+	// server-auth, client-auth, code-signing or smime
+	TrustPurposes []string `mapstructure:"trust_purposes,omitempty"`
+	// NameConstraints re-wraps the source's self-signed roots under a local,
+	// name constrained root before they are installed
+	NameConstraints *NameConstraints `mapstructure:"name_constraints,omitempty"`
+}
+
+// NameConstraints limits the names a private root may issue for. Directory
+// holds the local constraining root's key and the cross-signed certificates.
+type NameConstraints struct {
+	Directory           string   `mapstructure:"directory"`
+	PermittedDNSDomains []string `mapstructure:"permitted_dns_domains,omitempty"`
+	ExcludedDNSDomains  []string `mapstructure:"excluded_dns_domains,omitempty"`
+	PermittedIPRanges   []string `mapstructure:"permitted_ip_ranges,omitempty"` // CIDR
+	ExcludedIPRanges    []string `mapstructure:"excluded_ip_ranges,omitempty"`
+}
+
+// RequiresCA reports whether certificates from this source must be CA certificates
+func (s CertificateSource) RequiresCA() bool {
+	return s.RequireCA == nil || *s.RequireCA
 }
 
 // TrustStore defines a target trust store to update
 type TrustStore struct {
 	Name        string            `mapstructure:"name"`
-	Type        string            `mapstructure:"type"` // "system", "application"
-	Platform    []string          `mapstructure:"platform"` // ["linux", "darwin", "windows"]
-	Target      string            `mapstructure:"target"` // specific store identifier
+	Type        string            `mapstructure:"type"`               // "system", "application", "plugin", "custom"
+	Provider    string            `mapstructure:"provider,omitempty"` // registered provider name for "custom" stores
+	Platform    []string          `mapstructure:"platform"`           // ["linux", "darwin", "windows"]
+	Target      string            `mapstructure:"target"`             // specific store identifier
 	Enabled     bool              `mapstructure:"enabled"`
 	Options     map[string]string `mapstructure:"options,omitempty"`
 	RequireRoot bool              `mapstructure:"require_root"`
+	RequireCA   *bool             `mapstructure:"require_ca"` // default true; false accepts end-entity certificates (e.g. windows "my", IIS)
+	Priority    int               `mapstructure:"priority"`   // lower values are processed first; ties keep config order
+	// CommandTimeout overrides settings.command_timeout_seconds for this store's external tooling
+	CommandTimeout int `mapstructure:"command_timeout_seconds"`
+	// Groups names the groups (e.g. "browsers") whose runs update this store
+	Groups []string `mapstructure:"groups,omitempty"`
+	// Include limits the store to hosts matching any of its constraints, and
+	// Exclude skips it on hosts matching any of its constraints
+	Include []HostConstraint `mapstructure:"include,omitempty"`
+	Exclude []HostConstraint `mapstructure:"exclude,omitempty"`
+	// When is a host facts condition, e.g. `installed("iis")`; the store is
+	// skipped on hosts where it is false
+	When string `mapstructure:"when,omitempty"`
+	// PreUpdate runs before an update run first changes the store; if it
+	// fails the store is left unchanged. PostUpdate runs after a run changed,
+	// or tried to change, the store.
+	PreUpdate  *Hook `mapstructure:"pre_update,omitempty"`
+	PostUpdate *Hook `mapstructure:"post_update,omitempty"`
+	// ReloadServices are reloaded once at the end of a run that changed the
+	// store: systemd units on Linux, launchd job labels on macOS and service
+	// names on Windows
+	ReloadServices []string `mapstructure:"reload_services,omitempty"`
+	// ReloadAction is "reload" (default; systemd units that can't reload are
+	// restarted) or "restart". launchd jobs and Windows services always restart.
+	ReloadAction string `mapstructure:"reload_action,omitempty"`
+	// TrustPurposes limits what the store trusts certificates for, on top
+	// of any limit their source sets. Certificates are only added to
+	// stores that can limit trust.
+	TrustPurposes []string `mapstructure:"trust_purposes,omitempty"`
+	// Critical stores are changed in two phases: updates stage the additions
+	// in settings.staging_directory and the commit command applies them
+	Critical bool `mapstructure:"critical,omitempty"`
+	// Verify probes run after a run changed the store. When one fails the
+	// run's additions are removed again, unless VerifyFailure is "report".
+	Verify        []VerifyProbe `mapstructure:"verify,omitempty"`
+	VerifyFailure string        `mapstructure:"verify_failure,omitempty"` // "rollback" (default) or "report"
+	// ReadOnlyOutput is a PEM bundle written with the certificates the store
+	// would hold when its files are on a read-only filesystem, e.g. on a
+	// writable volume; without it such stores are skipped
+	ReadOnlyOutput string `mapstructure:"read_only_output,omitempty"`
+}
+
+// VerifyProbe checks that a store works after it changed: either Command
+// exits with status 0, or a TLS connection to TLS verifies against the
+// store's certificates
+type VerifyProbe struct {
+	Name           string   `mapstructure:"name"`
+	Command        []string `mapstructure:"command,omitempty"`     // program and arguments, run without a shell
+	TLS            string   `mapstructure:"tls,omitempty"`         // host:port
+	ServerName     string   `mapstructure:"server_name,omitempty"` // default the host of TLS
+	TimeoutSeconds int      `mapstructure:"timeout_seconds,omitempty"`
+}
+
+// Hook is an external command run around a store's update. Command is the
+// program and its arguments, run without a shell.
+type Hook struct {
+	Command        []string          `mapstructure:"command"`
+	TimeoutSeconds int               `mapstructure:"timeout_seconds,omitempty"` // default settings.command_timeout_seconds
+	Env            map[string]string `mapstructure:"env,omitempty"`
+}
+
+// HostConstraint matches hosts on every field that is set, each of which
+// lists the accepted values
+type HostConstraint struct {
+	OS            []string `mapstructure:"os"`             // "linux", "darwin", "windows"
+	Arch          []string `mapstructure:"arch"`           // "amd64", "arm64", ...
+	Distro        []string `mapstructure:"distro"`         // os-release ID or ID_LIKE, e.g. "ubuntu", "rhel"
+	DistroVersion []string `mapstructure:"distro_version"` // os-release VERSION_ID, e.g. "22.04"
+}
+
+// RequiresCA reports whether only CA certificates may be installed into this store
+func (t TrustStore) RequiresCA() bool {
+	return t.RequireCA == nil || *t.RequireCA
 }
 
 // Settings contains global application settings
 type Settings struct {
-	BackupEnabled    bool   `mapstructure:"backup_enabled"`
-	BackupDirectory  string `mapstructure:"backup_directory"`
-	LogLevel         string `mapstructure:"log_level"`
-	MaxRetries       int    `mapstructure:"max_retries"`
-	TimeoutSeconds   int    `mapstructure:"timeout_seconds"`
-	ValidateAfter    bool   `mapstructure:"validate_after"`
+	BackupEnabled   bool     `mapstructure:"backup_enabled"`
+	BackupDirectory string   `mapstructure:"backup_directory"`
+	StateFile       string   `mapstructure:"state_file"`
+	LogLevel        string   `mapstructure:"log_level"`
+	LogSinks        []string `mapstructure:"log_sinks"` // "syslog", "eventlog"
+	MaxRetries      int      `mapstructure:"max_retries"`
+	TimeoutSeconds  int      `mapstructure:"timeout_seconds"`
+	CommandTimeout  int      `mapstructure:"command_timeout_seconds"` // limit for external tools such as update-ca-certificates
+	MaxBundleSizeMB int      `mapstructure:"max_bundle_size_mb"`      // largest URL or file source read
+	ValidateAfter   bool     `mapstructure:"validate_after"`
+	DuplicatePolicy string   `mapstructure:"duplicate_policy"` // "all", "shortest", "longest"
+	AIACacheDir     string   `mapstructure:"aia_cache_directory"`
+	AIACacheHours   int      `mapstructure:"aia_cache_hours"`
+	// CaptivePortalCheckURL must answer 204 No Content before any url source is fetched
+	CaptivePortalCheckURL string `mapstructure:"captive_portal_check_url"`
+	// ReadOnly rejects every store mutation, for audit-only and monitoring deployments
+	ReadOnly bool `mapstructure:"read_only"`
+	// DriftDetection snapshots each store after a successful run and reports
+	// certificates added or removed outside the tool on the next run
+	DriftDetection bool `mapstructure:"drift_detection"`
+	// WatchStores reacts to changes to the system stores while serve runs:
+	// "report" checks them for drift and "sync" runs an update; empty ignores them
+	WatchStores string `mapstructure:"watch_stores"`
+	// LowMemory trades speed for a smaller footprint on embedded hosts:
+	// directory sources are parsed one file at a time, store listings aren't
+	// cached and garbage is collected sooner
+	LowMemory bool `mapstructure:"low_memory"`
+	// StateSigningKey signs the state file: an Ed25519 key path (created if
+	// missing) or "tpm:<persistent handle>"; empty leaves the state unsigned
+	StateSigningKey string `mapstructure:"state_signing_key"`
+	// HostTags describe this host, e.g. "production"; see Approval
+	HostTags []string `mapstructure:"host_tags"`
+	// HistoryDatabase is the SQLite database runs are recorded in; empty disables it
+	HistoryDatabase string `mapstructure:"history_database"`
+	// LockFile is locked while stores are changed so only one instance writes
+	// at a time, including across hosts sharing it over NFS; empty disables it
+	LockFile string `mapstructure:"lock_file"`
+	// InstanceID names this instance in the lock file (default hostname-pid)
+	InstanceID string `mapstructure:"instance_id"`
+	// UserAgent is sent with every HTTP request
+	UserAgent string `mapstructure:"user_agent"`
+	// RequestsPerMinute limits all HTTP requests together; 0 is unlimited.
+	// Responses of 429 or 503 are retried up to max_retries times, honoring
+	// Retry-After up to MaxRetryAfterSeconds.
+	RequestsPerMinute    int `mapstructure:"requests_per_minute"`
+	MaxRetryAfterSeconds int `mapstructure:"max_retry_after_seconds"`
+	// StagingDirectory holds the changes staged for critical stores
+	StagingDirectory string `mapstructure:"staging_directory"`
+}
+
+// SelfUpdate configures where the tool checks for new releases of itself
+type SelfUpdate struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	Channel   string `mapstructure:"channel"`    // "stable", "beta"
+	PublicKey string `mapstructure:"public_key"` // base64 ed25519 release signing key
+}
+
+// Audit configures the append-only log of mutating operations
+type Audit struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Path          string `mapstructure:"path"`
+	ForwardSyslog bool   `mapstructure:"forward_syslog"`
+}
+
+// Validation configures the policy applied to fetched certificates before installation
+type Validation struct {
+	RejectSHA1        bool     `mapstructure:"reject_sha1"`
+	MinRSAKeyBits     int      `mapstructure:"min_rsa_key_bits"`
+	RejectUnusualEKUs bool     `mapstructure:"reject_unusual_ekus"`
+	AllowedEKUs       []string `mapstructure:"allowed_ekus"`
+	AllowList         []string `mapstructure:"allow_list"` // SHA-256 fingerprints exempt from the policy
+}
+
+// SSH configures management of SSH certificate authority keys alongside X.509 trust
+type SSH struct {
+	Authorities []SSHAuthority `mapstructure:"authorities"`
+	Stores      []SSHStore     `mapstructure:"stores"`
+}
+
+// SSHAuthority is a source of SSH CA public keys in authorized_keys format
+type SSHAuthority struct {
+	Name    string            `mapstructure:"name"`
+	Type    string            `mapstructure:"type"` // "url", "file"
+	Source  string            `mapstructure:"source"`
+	Enabled bool              `mapstructure:"enabled"`
+	Headers map[string]string `mapstructure:"headers,omitempty"`
+}
+
+// SSHStore is a file holding trusted SSH CA keys. Only a marked block of the
+// file is managed; other lines are preserved.
+type SSHStore struct {
+	Name        string   `mapstructure:"name"`
+	Type        string   `mapstructure:"type"` // "trusted_user_ca_keys", "known_hosts"
+	Path        string   `mapstructure:"path"`
+	Enabled     bool     `mapstructure:"enabled"`
+	Hosts       string   `mapstructure:"hosts"`       // known_hosts host patterns, default "*"
+	Authorities []string `mapstructure:"authorities"` // authority names to install; empty means all
+}
+
+// GPG configures package signing keys installed into system keyrings
+type GPG struct {
+	Keys   []GPGKey   `mapstructure:"keys"`
+	Stores []GPGStore `mapstructure:"stores"`
+}
+
+// GPGKey is an ASCII armored OpenPGP public key pinned by fingerprint
+type GPGKey struct {
+	Name        string            `mapstructure:"name"`
+	Type        string            `mapstructure:"type"` // "url", "file"
+	Source      string            `mapstructure:"source"`
+	Fingerprint string            `mapstructure:"fingerprint"` // required; the fetched key must match
+	Enabled     bool              `mapstructure:"enabled"`
+	Headers     map[string]string `mapstructure:"headers,omitempty"`
+}
+
+// GPGStore is a system keyring that keys are installed into
+type GPGStore struct {
+	Name    string   `mapstructure:"name"`
+	Type    string   `mapstructure:"type"` // "apt", "rpm"
+	Path    string   `mapstructure:"path"` // apt: keyring directory, default /etc/apt/trusted.gpg.d
+	Enabled bool     `mapstructure:"enabled"`
+	Keys    []string `mapstructure:"keys"` // key names to install; empty means all
+}
+
+// Server configures the HTTP API served by the serve command. Callers are
+// identified by API key or TLS client certificate and granted a role:
+// "viewer" (read inventory), "operator" (also trigger sync) or "admin" (also
+// restore backups).
+type Server struct {
+	Listen             string              `mapstructure:"listen"`
+	TLSCert            string              `mapstructure:"tls_cert"`
+	TLSKey             string              `mapstructure:"tls_key"`
+	ClientCA           string              `mapstructure:"client_ca"` // CA bundle verifying client certificates
+	APIKeys            []APIKey            `mapstructure:"api_keys"`
+	ClientCertificates []ClientCertificate `mapstructure:"client_certificates"`
+}
+
+// APIKey grants a role to bearers of a key, stored only as its SHA-256 digest
+type APIKey struct {
+	Name   string `mapstructure:"name"`
+	SHA256 string `mapstructure:"sha256"` // hex digest of the key
+	Role   string `mapstructure:"role"`
+}
+
+// ClientCertificate grants a role to a verified TLS client certificate,
+// matched by SHA-256 fingerprint or, if no fingerprint is set, common name
+type ClientCertificate struct {
+	Name        string `mapstructure:"name"`
+	Fingerprint string `mapstructure:"fingerprint"`
+	CommonName  string `mapstructure:"common_name"`
+	Role        string `mapstructure:"role"`
+}
+
+// Anchors restricts installs to a list of certificate fingerprints whose
+// digest is sealed in a TPM or the macOS System keychain. Editing the list
+// has no effect until it is re-sealed with the anchors seal command.
+type Anchors struct {
+	Sealed  bool   `mapstructure:"sealed"`
+	File    string `mapstructure:"file"`
+	Backend string `mapstructure:"backend"`  // "tpm", "keychain"; empty for the platform default
+	NVIndex string `mapstructure:"nv_index"` // TPM NV index holding the digest
+}
+
+// Composition defines the trust set across several root programs. A CA is
+// identified by its public key, so re-issued and cross-signed variants of a
+// root count as the same CA in every program.
+type Composition struct {
+	Mode string `mapstructure:"mode"` // "union" (default), "intersection" or "weighted"
+	// Sources are the composed programs; other sources are added unchanged.
+	// Empty composes every source.
+	Sources []string `mapstructure:"sources,omitempty"`
+	// Weights and Threshold apply to the weighted mode: a CA is trusted when
+	// the weights of the programs including it add up to at least Threshold.
+	// Sources default to a weight of 1.
+	Weights   map[string]int `mapstructure:"weights,omitempty"`
+	Threshold int            `mapstructure:"threshold,omitempty"`
+}
+
+// Rollout configures staged syncs of a fleet of agents through their APIs:
+// each stage syncs a larger share of the agents and checks their health
+// before the next, halting when too many fail
+type Rollout struct {
+	Agents []RolloutAgent `mapstructure:"agents"`
+	// Stages are the cumulative percentages of agents synced by each stage
+	Stages      []int  `mapstructure:"stages"`
+	SoakSeconds int    `mapstructure:"soak_seconds"` // wait after a stage's syncs before checking health
+	MaxFailures int    `mapstructure:"max_failures"` // failed agents tolerated per stage
+	APIKeyEnv   string `mapstructure:"api_key_env"`  // environment variable holding an operator API key
+	CAFile      string `mapstructure:"ca_file"`      // CA bundle verifying the agents' TLS certificates
+	ClientCert  string `mapstructure:"client_cert"`  // client certificate, instead of an API key
+	ClientKey   string `mapstructure:"client_key"`
+	StateFile   string `mapstructure:"state_file"`
+}
+
+// RolloutAgent is an agent running serve
+type RolloutAgent struct {
+	Name string `mapstructure:"name"`
+	URL  string `mapstructure:"url"` // e.g. https://agent01:8443
+}
+
+// MaintenanceWindow allows changes to the stores in Groups only while it is
+// open. A store with windows is only changed inside one of them; runs at
+// other times report what they would change, as a dry run does.
+type MaintenanceWindow struct {
+	Name   string   `mapstructure:"name"`
+	Groups []string `mapstructure:"groups,omitempty"` // store groups; empty applies to every store
+	// Cron gives the times windows open, "minute hour day month weekday",
+	// each staying open for Duration, e.g. "2h"
+	Cron     string `mapstructure:"cron,omitempty"`
+	Duration string `mapstructure:"duration,omitempty"`
+	// Days, Start and End give a weekly window, e.g. ["sat"] from "22:00"
+	// to "04:00"; an end before the start is on the next day
+	Days     []string `mapstructure:"days,omitempty"`
+	Start    string   `mapstructure:"start,omitempty"`
+	End      string   `mapstructure:"end,omitempty"`
+	Timezone string   `mapstructure:"timezone,omitempty"` // IANA zone, default local time
+}
+
+// Covers reports whether the window applies to store
+func (w MaintenanceWindow) Covers(store TrustStore) bool {
+	return len(w.Groups) == 0 || inGroups(store.Groups, w.Groups)
+}
+
+// Spec returns the window's schedule
+func (w MaintenanceWindow) Spec() maintenance.Spec {
+	return maintenance.Spec{Cron: w.Cron, Duration: w.Duration, Days: w.Days, Start: w.Start, End: w.End, Timezone: w.Timezone}
+}
+
+// ACME obtains leaf certificates for applications on this host from an ACME
+// CA, such as Let's Encrypt or step-ca, renews them before they expire and
+// installs them with their keys into stores that can hold keys
+type ACME struct {
+	Directory       string            `mapstructure:"directory"` // ACME directory URL, default Let's Encrypt
+	Email           string            `mapstructure:"email"`
+	StorageDir      string            `mapstructure:"storage_dir"` // account key, certificates and their keys
+	RenewBeforeDays int               `mapstructure:"renew_before_days"`
+	Certificates    []ACMECertificate `mapstructure:"certificates"`
+}
+
+// ACMECertificate is one certificate kept fresh from the ACME CA
+type ACMECertificate struct {
+	Name    string   `mapstructure:"name"`
+	Domains []string `mapstructure:"domains"`
+	KeyType string   `mapstructure:"key_type"` // "ecdsa-p256" (default) or "rsa-2048"
+	// Solver answers the CA's challenges: "http-01" from Webroot or, without
+	// one, a listener on Listen; "dns-01" by running DNSCommand
+	Solver                string   `mapstructure:"solver"`
+	Webroot               string   `mapstructure:"webroot,omitempty"`
+	Listen                string   `mapstructure:"listen,omitempty"` // default ":80"
+	DNSCommand            []string `mapstructure:"dns_command,omitempty"`
+	DNSPropagationSeconds int      `mapstructure:"dns_propagation_seconds,omitempty"`
+	// Stores are the names of the trust stores the certificate and key are
+	// installed into, under Label
+	Stores []string `mapstructure:"stores"`
+	Label  string   `mapstructure:"label,omitempty"`
+}
+
+// Approval requires hosts carrying one of RequiredForTags to have a signed
+// approval of the exact certificate bundle before any store is changed
+// DistrustedCertificate names certificates to remove from every store: by
+// SHA-256 fingerprint, by subject (or common name), or by a list fetched from
+// URL on each run holding PEM certificates or one fingerprint per line
+type DistrustedCertificate struct {
+	Fingerprint string `mapstructure:"fingerprint,omitempty"`
+	Subject     string `mapstructure:"subject,omitempty"`
+	URL         string `mapstructure:"url,omitempty"`
+	Reason      string `mapstructure:"reason,omitempty"`
+}
+
+type Approval struct {
+	RequiredForTags []string `mapstructure:"required_for_tags"`
+	File            string   `mapstructure:"file"`            // written by the approve command
+	AllowedSigners  string   `mapstructure:"allowed_signers"` // OpenSSH allowed_signers file listing approvers
+	// SignedPlans makes apply --plan refuse plans not signed by an approver
+	SignedPlans bool `mapstructure:"signed_plans"`
 }
 
 var globalConfig *Config
 
+// ForGroups returns a copy of the configuration limited to the named groups:
+// the stores in any of them and the sources that are in one of them or in no
+// group. SSH and GPG stores belong to no group and are left out.
+func (c *Config) ForGroups(groups []string) (*Config, error) {
+	known := make(map[string]bool)
+	for _, store := range c.TrustStores {
+		for _, g := range store.Groups {
+			known[g] = true
+		}
+	}
+	for _, group := range groups {
+		if !known[group] {
+			return nil, fmt.Errorf("no trust store is in group %q", group)
+		}
+	}
+
+	limited := *c
+	limited.TrustStores = nil
+	for _, store := range c.TrustStores {
+		if inGroups(store.Groups, groups) {
+			limited.TrustStores = append(limited.TrustStores, store)
+		}
+	}
+	limited.CertificateSources = nil
+	for _, source := range c.CertificateSources {
+		if len(source.Groups) == 0 || inGroups(source.Groups, groups) {
+			limited.CertificateSources = append(limited.CertificateSources, source)
+		}
+	}
+	limited.SSH.Stores = nil
+	limited.GPG.Stores = nil
+	return &limited, nil
+}
+
+// Groups returns the names of all store groups in configuration order
+func (c *Config) Groups() []string {
+	var groups []string
+	seen := make(map[string]bool)
+	for _, store := range c.TrustStores {
+		for _, g := range store.Groups {
+			if !seen[g] {
+				seen[g] = true
+				groups = append(groups, g)
+			}
+		}
+	}
+	return groups
+}
+
+func inGroups(memberOf, selected []string) bool {
+	for _, m := range memberOf {
+		for _, s := range selected {
+			if m == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OrderedTrustStores returns the trust stores sorted by priority, keeping
+// configuration order for stores with equal priority
+func (c *Config) OrderedTrustStores() []TrustStore {
+	stores := make([]TrustStore, len(c.TrustStores))
+	copy(stores, c.TrustStores)
+	sort.SliceStable(stores, func(i, j int) bool {
+		return stores[i].Priority < stores[j].Priority
+	})
+	return stores
+}
+
 // InitConfig initializes the configuration with the given config file path
 func InitConfig(cfgFile string) {
+	// Try to read config file
+	if err := ReadConfig(cfgFile); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+			// Config file not found; create a default one
+			createDefaultConfig()
+		}
+	}
+}
+
+// ReadConfig reads the given config file (or ./trust-store-config.yaml)
+// without creating a default when it is missing
+func ReadConfig(cfgFile string) error {
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
 	} else {
@@ -66,13 +577,7 @@ func InitConfig(cfgFile string) {
 	viper.SetEnvPrefix("TSU")
 	viper.AutomaticEnv()
 
-	// Try to read config file
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// Config file not found; create a default one
-			createDefaultConfig()
-		}
-	}
+	return viper.ReadInConfig()
 }
 
 // LoadConfig loads and returns the configuration
@@ -82,6 +587,9 @@ func LoadConfig() (*Config, error) {
 		if err := viper.Unmarshal(&cfg); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 		}
+		if activePreset != nil {
+			cfg.TrustStores = layerStores(activePreset.TrustStores, cfg.TrustStores)
+		}
 		globalConfig = &cfg
 	}
 	return globalConfig, nil
@@ -90,90 +598,55 @@ func LoadConfig() (*Config, error) {
 func setDefaults() {
 	viper.SetDefault("settings.backup_enabled", true)
 	viper.SetDefault("settings.backup_directory", "./backups")
+	viper.SetDefault("settings.state_file", "./state/state.json")
+	viper.SetDefault("settings.staging_directory", "./state/staged")
+	viper.SetDefault("settings.history_database", "./state/history.db")
+	viper.SetDefault("settings.lock_file", "./state/update.lock")
 	viper.SetDefault("settings.log_level", "info")
 	viper.SetDefault("settings.max_retries", 3)
 	viper.SetDefault("settings.timeout_seconds", 30)
+	viper.SetDefault("settings.command_timeout_seconds", 300)
+	viper.SetDefault("settings.max_bundle_size_mb", 50)
 	viper.SetDefault("settings.validate_after", true)
+	viper.SetDefault("settings.duplicate_policy", "all")
+	viper.SetDefault("settings.aia_cache_directory", "./cache/aia")
+	viper.SetDefault("settings.aia_cache_hours", 24)
+	viper.SetDefault("settings.user_agent", "trust-store-updater")
+	viper.SetDefault("settings.max_retry_after_seconds", 300)
+	viper.SetDefault("self_update.channel", "stable")
+	viper.SetDefault("validation.reject_sha1", true)
+	viper.SetDefault("validation.min_rsa_key_bits", 2048)
+	viper.SetDefault("validation.reject_unusual_ekus", true)
+	viper.SetDefault("validation.allowed_ekus", []string{"any", "server-auth", "client-auth", "code-signing", "email-protection", "time-stamping", "ocsp-signing"})
+	viper.SetDefault("audit.enabled", true)
+	viper.SetDefault("audit.path", "./audit/audit.jsonl")
+	viper.SetDefault("audit.forward_syslog", false)
+	viper.SetDefault("server.listen", "127.0.0.1:8443")
+	viper.SetDefault("anchors.file", "./state/trust-anchors.txt")
+	viper.SetDefault("approval.required_for_tags", []string{"production"})
+	viper.SetDefault("approval.file", "./approval.json")
+	viper.SetDefault("acme.directory", "https://acme-v02.api.letsencrypt.org/directory")
+	viper.SetDefault("acme.storage_dir", "./state/acme")
+	viper.SetDefault("acme.renew_before_days", 30)
+	viper.SetDefault("rollout.stages", []int{5, 25, 100})
+	viper.SetDefault("rollout.soak_seconds", 60)
+	viper.SetDefault("rollout.state_file", "./state/rollout.json")
 }
 
 func createDefaultConfig() {
 	configPath := "./trust-store-config.yaml"
-	
+
 	// Check if config already exists
 	if _, err := os.Stat(configPath); err == nil {
 		return
 	}
 
-	defaultConfig := `# Trust Store Updater Configuration
-# This file defines certificate sources and target trust stores to update
-
-# Certificate sources - where to fetch new root certificates from
-certificate_sources:
-  - name: "mozilla-ca-bundle"
-    type: "url"
-    source: "https://curl.se/ca/cacert.pem"
-    enabled: true
-    verify_tls: true
-    filters: []
-
-  - name: "local-certificates"
-    type: "directory"
-    source: "./certificates"
-    enabled: false
-    filters:
-      - "*.crt"
-      - "*.pem"
-
-# Trust stores - target stores to update with new certificates
-trust_stores:
-  # System trust stores
-  - name: "system-ca-certificates"
-    type: "system"
-    platform: ["linux"]
-    target: "ca-certificates"
-    enabled: true
-    require_root: true
-
-  - name: "system-keychain"
-    type: "system"
-    platform: ["darwin"]
-    target: "system-keychain"
-    enabled: true
-    require_root: true
-
-  - name: "system-cert-store"
-    type: "system"
-    platform: ["windows"]
-    target: "root"
-    enabled: true
-    require_root: true
-
-  # Application trust stores
-  - name: "docker-ca-certificates"
-    type: "application"
-    platform: ["linux", "darwin", "windows"]
-    target: "docker"
-    enabled: false
-    require_root: false
-
-  - name: "java-cacerts"
-    type: "application"
-    platform: ["linux", "darwin", "windows"]
-    target: "java-cacerts"
-    enabled: false
-    require_root: false
-
-# Global settings
-settings:
-  backup_enabled: true
-  backup_directory: "./backups"
-  log_level: "info"
-  max_retries: 3
-  timeout_seconds: 30
-  validate_after: true
-`
-
-	if err := os.WriteFile(configPath, []byte(defaultConfig), 0644); err == nil {
+	defaultConfig, err := Generate(DefaultGenerateOptions())
+	if err != nil {
+		return
+	}
+
+	if err := atomicfile.WriteFile(configPath, defaultConfig, 0644); err == nil {
 		fmt.Printf("Created default configuration file: %s\n", configPath)
 		fmt.Println("Please review and customize the configuration before running the updater.")
 	}
@@ -184,6 +657,54 @@ func GetConfigPath() string {
 	return viper.ConfigFileUsed()
 }
 
+// validateTrustPurposes checks trust_purposes values
+func validateTrustPurposes(purposes []string) error {
+	for _, p := range purposes {
+		if !certstore.IsTrustPurpose(p) {
+			return fmt.Errorf("unsupported trust purpose %q (expected %s)", p, strings.Join(certstore.TrustPurposes, ", "))
+		}
+	}
+	return nil
+}
+
+// validateVerifyProbes checks that each probe has a name and one check
+func validateVerifyProbes(store TrustStore) error {
+	if store.VerifyFailure != "" && store.VerifyFailure != "rollback" && store.VerifyFailure != "report" {
+		return fmt.Errorf("unsupported verify_failure %q (expected rollback or report)", store.VerifyFailure)
+	}
+	for _, probe := range store.Verify {
+		if probe.Name == "" {
+			return fmt.Errorf("verify probes need a name")
+		}
+		if (len(probe.Command) > 0) == (probe.TLS != "") {
+			return fmt.Errorf("verify probe %s: set either command or tls", probe.Name)
+		}
+		if probe.TLS != "" {
+			if _, _, err := net.SplitHostPort(probe.TLS); err != nil {
+				return fmt.Errorf("verify probe %s: tls must be host:port: %w", probe.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateNameConstraints checks that a name_constraints block has a
+// directory, constrains something, and has valid CIDR ranges
+func validateNameConstraints(nc *NameConstraints) error {
+	if nc.Directory == "" {
+		return fmt.Errorf("directory is required")
+	}
+	if len(nc.PermittedDNSDomains)+len(nc.ExcludedDNSDomains)+len(nc.PermittedIPRanges)+len(nc.ExcludedIPRanges) == 0 {
+		return fmt.Errorf("no constraints set")
+	}
+	for _, r := range append(append([]string{}, nc.PermittedIPRanges...), nc.ExcludedIPRanges...) {
+		if _, _, err := net.ParseCIDR(r); err != nil {
+			return fmt.Errorf("%q is not a CIDR range", r)
+		}
+	}
+	return nil
+}
+
 // ValidateConfig validates the loaded configuration
 func ValidateConfig(cfg *Config) error {
 	if len(cfg.CertificateSources) == 0 {
@@ -194,12 +715,128 @@ func ValidateConfig(cfg *Config) error {
 		return fmt.Errorf("no trust stores configured")
 	}
 
+	switch cfg.Settings.DuplicatePolicy {
+	case "", "all", "shortest", "longest":
+	default:
+		return fmt.Errorf("unsupported duplicate_policy: %s (expected all, shortest or longest)", cfg.Settings.DuplicatePolicy)
+	}
+
+	switch cfg.Settings.WatchStores {
+	case "", "sync":
+	case "report":
+		if !cfg.Settings.DriftDetection {
+			return fmt.Errorf("watch_stores: report needs drift_detection, which takes the baselines drift is reported against")
+		}
+	default:
+		return fmt.Errorf("unsupported watch_stores: %s (expected report or sync)", cfg.Settings.WatchStores)
+	}
+
+	for _, source := range cfg.CertificateSources {
+		for host, addr := range source.Resolve {
+			if net.ParseIP(addr) == nil {
+				return fmt.Errorf("certificate source %s: resolve %s: %q is not an IP address", source.Name, host, addr)
+			}
+		}
+		if source.DoHResolver != "" && !strings.HasPrefix(source.DoHResolver, "https://") {
+			return fmt.Errorf("certificate source %s: doh_resolver must be an https:// URL", source.Name)
+		}
+		if err := validateTrustPurposes(source.TrustPurposes); err != nil {
+			return fmt.Errorf("certificate source %s: %w", source.Name, err)
+		}
+		if nc := source.NameConstraints; nc != nil {
+			if err := validateNameConstraints(nc); err != nil {
+				return fmt.Errorf("certificate source %s: name_constraints: %w", source.Name, err)
+			}
+		}
+	}
+
+	if err := validateComposition(cfg); err != nil {
+		return err
+	}
+
+	for _, store := range cfg.TrustStores {
+		if store.Type == "custom" && store.Provider == "" {
+			return fmt.Errorf("trust store %s: custom stores must name a provider", store.Name)
+		}
+		if store.PreUpdate != nil && len(store.PreUpdate.Command) == 0 {
+			return fmt.Errorf("trust store %s: pre_update needs a command", store.Name)
+		}
+		if store.PostUpdate != nil && len(store.PostUpdate.Command) == 0 {
+			return fmt.Errorf("trust store %s: post_update needs a command", store.Name)
+		}
+		if store.ReloadAction != "" && store.ReloadAction != "reload" && store.ReloadAction != "restart" {
+			return fmt.Errorf("trust store %s: unsupported reload_action %q (expected reload or restart)", store.Name, store.ReloadAction)
+		}
+		if err := validateTrustPurposes(store.TrustPurposes); err != nil {
+			return fmt.Errorf("trust store %s: %w", store.Name, err)
+		}
+		if err := validateVerifyProbes(store); err != nil {
+			return fmt.Errorf("trust store %s: %w", store.Name, err)
+		}
+	}
+
+	for _, store := range cfg.SSH.Stores {
+		switch store.Type {
+		case "trusted_user_ca_keys", "known_hosts":
+		default:
+			return fmt.Errorf("ssh store %s: unsupported type %q (expected trusted_user_ca_keys or known_hosts)", store.Name, store.Type)
+		}
+		if store.Path == "" {
+			return fmt.Errorf("ssh store %s: path is required", store.Name)
+		}
+	}
+
+	for _, key := range cfg.GPG.Keys {
+		// Key names become keyring file names
+		if key.Name == "" || strings.ContainsAny(key.Name, `/\`) || strings.Contains(key.Name, "..") {
+			return fmt.Errorf("gpg key %q: names can't be empty or contain path separators or \"..\"", key.Name)
+		}
+		if key.Fingerprint == "" {
+			return fmt.Errorf("gpg key %s: fingerprint is required", key.Name)
+		}
+	}
+	for _, store := range cfg.GPG.Stores {
+		if store.Type != "apt" && store.Type != "rpm" {
+			return fmt.Errorf("gpg store %s: unsupported type %q (expected apt or rpm)", store.Name, store.Type)
+		}
+	}
+
+	if err := validateACME(cfg); err != nil {
+		return err
+	}
+
+	for i, w := range cfg.MaintenanceWindows {
+		if _, err := maintenance.New(w.Spec()); err != nil {
+			return fmt.Errorf("maintenance_windows[%d] %s: %w", i, w.Name, err)
+		}
+		for _, group := range w.Groups {
+			if !slices.Contains(cfg.Groups(), group) {
+				return fmt.Errorf("maintenance_windows[%d] %s: no trust store is in group %q", i, w.Name, group)
+			}
+		}
+	}
+
+	for i, d := range cfg.Distrusted {
+		set := 0
+		for _, v := range []string{d.Fingerprint, d.Subject, d.URL} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("distrusted_certificates[%d]: exactly one of fingerprint, subject or url is required", i)
+		}
+		if digest, err := hex.DecodeString(strings.ReplaceAll(d.Fingerprint, ":", "")); d.Fingerprint != "" && (err != nil || len(digest) != sha256.Size) {
+			return fmt.Errorf("distrusted_certificates[%d]: fingerprint must be a SHA-256 digest in hex", i)
+		}
+	}
+
 	// Validate backup directory
 	if cfg.Settings.BackupEnabled {
 		if cfg.Settings.BackupDirectory == "" {
 			return fmt.Errorf("backup directory must be specified when backup is enabled")
 		}
-		
+
 		// Create backup directory if it doesn't exist
 		if err := os.MkdirAll(cfg.Settings.BackupDirectory, 0755); err != nil {
 			return fmt.Errorf("failed to create backup directory: %w", err)
@@ -208,3 +845,84 @@ func ValidateConfig(cfg *Config) error {
 
 	return nil
 }
+
+// validateACME checks each ACME certificate has domains, a usable solver
+// and configured stores to go into
+func validateACME(cfg *Config) error {
+	stores := make(map[string]bool)
+	for _, store := range cfg.TrustStores {
+		stores[store.Name] = true
+	}
+	names := make(map[string]bool)
+	for _, c := range cfg.ACME.Certificates {
+		if c.Name == "" || strings.ContainsAny(c.Name, `/\`) {
+			return fmt.Errorf("acme certificate %q: name is required and must not contain path separators", c.Name)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("acme certificate %s: duplicate name", c.Name)
+		}
+		names[c.Name] = true
+		if len(c.Domains) == 0 {
+			return fmt.Errorf("acme certificate %s: no domains", c.Name)
+		}
+		switch c.KeyType {
+		case "", "ecdsa-p256", "rsa-2048":
+		default:
+			return fmt.Errorf("acme certificate %s: unsupported key_type %q (expected ecdsa-p256 or rsa-2048)", c.Name, c.KeyType)
+		}
+		switch c.Solver {
+		case "http-01":
+			for _, d := range c.Domains {
+				if strings.HasPrefix(d, "*.") {
+					return fmt.Errorf("acme certificate %s: wildcard %s needs the dns-01 solver", c.Name, d)
+				}
+			}
+		case "dns-01":
+			if len(c.DNSCommand) == 0 {
+				return fmt.Errorf("acme certificate %s: dns-01 needs a dns_command", c.Name)
+			}
+		default:
+			return fmt.Errorf("acme certificate %s: unsupported solver %q (expected http-01 or dns-01)", c.Name, c.Solver)
+		}
+		for _, name := range c.Stores {
+			if !stores[name] {
+				return fmt.Errorf("acme certificate %s: unknown trust store %q", c.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateComposition checks the composition names configured sources and
+// that a weighted composition has a threshold it can reach
+func validateComposition(cfg *Config) error {
+	c := cfg.Composition
+	switch c.Mode {
+	case "", "union", "intersection":
+	case "weighted":
+		if c.Threshold <= 0 {
+			return fmt.Errorf("composition: weighted mode needs a positive threshold")
+		}
+	default:
+		return fmt.Errorf("composition: unsupported mode %q (expected union, intersection or weighted)", c.Mode)
+	}
+
+	known := make(map[string]bool)
+	for _, source := range cfg.CertificateSources {
+		known[source.Name] = true
+	}
+	for _, name := range c.Sources {
+		if !known[name] {
+			return fmt.Errorf("composition: unknown certificate source %q", name)
+		}
+	}
+	for name, weight := range c.Weights {
+		if !known[name] {
+			return fmt.Errorf("composition: weight for unknown certificate source %q", name)
+		}
+		if weight < 0 {
+			return fmt.Errorf("composition: weight for %s must not be negative", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestForGroups(t *testing.T) {
+	cfg := &Config{
+		CertificateSources: []CertificateSource{
+			{Name: "mozilla"},
+			{Name: "corp", Groups: []string{"browsers"}},
+			{Name: "registry", Groups: []string{"containers"}},
+		},
+		TrustStores: []TrustStore{
+			{Name: "system"},
+			{Name: "firefox", Groups: []string{"browsers"}},
+			{Name: "chrome", Groups: []string{"browsers"}},
+			{Name: "docker", Groups: []string{"containers"}},
+		},
+		SSH: SSH{Stores: []SSHStore{{Name: "sshd"}}},
+	}
+
+	limited, err := cfg.ForGroups([]string{"browsers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(limited.TrustStores); got != "firefox,chrome" {
+		t.Errorf("stores = %s", got)
+	}
+	var sources string
+	for _, s := range limited.CertificateSources {
+		sources += s.Name + ","
+	}
+	if sources != "mozilla,corp," {
+		t.Errorf("sources = %s", sources)
+	}
+	if len(limited.SSH.Stores) != 0 || len(cfg.SSH.Stores) != 1 || len(cfg.TrustStores) != 4 {
+		t.Error("expected SSH stores dropped from the copy only")
+	}
+
+	if _, err := cfg.ForGroups([]string{"brwosers"}); err == nil {
+		t.Error("expected an error for an unknown group")
+	}
+	if got := cfg.Groups(); len(got) != 2 || got[0] != "browsers" || got[1] != "containers" {
+		t.Errorf("Groups() = %v", got)
+	}
+}
+
+func names(stores []TrustStore) string {
+	var s string
+	for i, store := range stores {
+		if i > 0 {
+			s += ","
+		}
+		s += store.Name
+	}
+	return s
+}
+
+func TestValidateTrustPurposes(t *testing.T) {
+	cfg := &Config{
+		CertificateSources: []CertificateSource{{Name: "internal", TrustPurposes: []string{"server-auth", "smime"}}},
+		TrustStores:        []TrustStore{{Name: "keychain", TrustPurposes: []string{"code-signing"}}},
+	}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("valid trust purposes rejected: %v", err)
+	}
+	cfg.TrustStores[0].TrustPurposes = []string{"email-protection"}
+	if err := ValidateConfig(cfg); err == nil {
+		t.Error("unknown trust purpose accepted")
+	}
+}
+
+func TestValidateVerifyProbes(t *testing.T) {
+	cfg := &Config{CertificateSources: []CertificateSource{{Name: "internal"}}, TrustStores: []TrustStore{{Name: "system", Verify: []VerifyProbe{
+		{Name: "registry", Command: []string{"docker", "pull", "registry.internal/ping"}},
+		{Name: "intranet", TLS: "intranet.example:443"},
+	}}}}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("valid probes rejected: %v", err)
+	}
+	for _, probe := range []VerifyProbe{
+		{Name: "both", Command: []string{"true"}, TLS: "intranet.example:443"},
+		{Name: "neither"},
+		{Name: "no-port", TLS: "intranet.example"},
+		{Command: []string{"true"}},
+	} {
+		cfg.TrustStores[0].Verify = []VerifyProbe{probe}
+		if err := ValidateConfig(cfg); err == nil {
+			t.Errorf("probe %+v accepted", probe)
+		}
+	}
+}
+
+func TestValidateNameConstraints(t *testing.T) {
+	cases := []struct {
+		nc NameConstraints
+		ok bool
+	}{
+		{NameConstraints{Directory: "nc", PermittedDNSDomains: []string{"corp.example"}}, true},
+		{NameConstraints{Directory: "nc", ExcludedIPRanges: []string{"10.0.0.0/8"}}, true},
+		{NameConstraints{PermittedDNSDomains: []string{"corp.example"}}, false},
+		{NameConstraints{Directory: "nc"}, false},
+		{NameConstraints{Directory: "nc", PermittedIPRanges: []string{"10.0.0.1"}}, false},
+	}
+	for _, c := range cases {
+		if err := validateNameConstraints(&c.nc); (err == nil) != c.ok {
+			t.Errorf("%+v: err = %v", c.nc, err)
+		}
+	}
+}
+
+func TestValidateComposition(t *testing.T) {
+	sources := []CertificateSource{{Name: "mozilla"}, {Name: "microsoft"}}
+	cases := []struct {
+		composition Composition
+		ok          bool
+	}{
+		{Composition{}, true},
+		{Composition{Mode: "intersection", Sources: []string{"mozilla", "microsoft"}}, true},
+		{Composition{Mode: "intersection", Sources: []string{"apple"}}, false},
+		{Composition{Mode: "weighted", Weights: map[string]int{"mozilla": 2}, Threshold: 2}, true},
+		{Composition{Mode: "weighted"}, false},
+		{Composition{Mode: "majority"}, false},
+	}
+	for _, c := range cases {
+		err := validateComposition(&Config{CertificateSources: sources, Composition: c.composition})
+		if (err == nil) != c.ok {
+			t.Errorf("%+v: err = %v", c.composition, err)
+		}
+	}
+}
+
+func TestValidateACME(t *testing.T) {
+	stores := []TrustStore{{Name: "java"}}
+	cases := []struct {
+		cert ACMECertificate
+		ok   bool
+	}{
+		{ACMECertificate{Name: "web", Domains: []string{"example.com"}, Solver: "http-01", Stores: []string{"java"}}, true},
+		{ACMECertificate{Name: "wild", Domains: []string{"*.example.com"}, Solver: "dns-01", DNSCommand: []string{"dns-hook"}}, true},
+		{ACMECertificate{Name: "wild", Domains: []string{"*.example.com"}, Solver: "http-01"}, false},
+		{ACMECertificate{Name: "dns", Domains: []string{"example.com"}, Solver: "dns-01"}, false},
+		{ACMECertificate{Name: "web", Domains: []string{"example.com"}, Solver: "tls-alpn-01"}, false},
+		{ACMECertificate{Name: "web", Solver: "http-01"}, false},
+		{ACMECertificate{Name: "../web", Domains: []string{"example.com"}, Solver: "http-01"}, false},
+		{ACMECertificate{Name: "web", Domains: []string{"example.com"}, Solver: "http-01", Stores: []string{"iis"}}, false},
+		{ACMECertificate{Name: "web", Domains: []string{"example.com"}, Solver: "http-01", KeyType: "ed25519"}, false},
+	}
+	for _, c := range cases {
+		cfg := &Config{TrustStores: stores, ACME: ACME{Certificates: []ACMECertificate{c.cert}}}
+		if err := validateACME(cfg); (err == nil) != c.ok {
+			t.Errorf("%+v: err = %v", c.cert, err)
+		}
+	}
+}
+
+func TestValidateMaintenanceWindows(t *testing.T) {
+	base := Config{
+		CertificateSources: []CertificateSource{{Name: "mozilla"}},
+		TrustStores:        []TrustStore{{Name: "browsers", Groups: []string{"browsers"}}},
+	}
+	cases := []struct {
+		window MaintenanceWindow
+		ok     bool
+	}{
+		{MaintenanceWindow{Name: "nightly", Cron: "0 2 * * *", Duration: "2h"}, true},
+		{MaintenanceWindow{Name: "weekend", Groups: []string{"browsers"}, Days: []string{"sat", "sun"}, Start: "22:00", End: "04:00"}, true},
+		{MaintenanceWindow{Name: "unknown-group", Groups: []string{"servers"}, Cron: "0 2 * * *", Duration: "2h"}, false},
+		{MaintenanceWindow{Name: "no-duration", Cron: "0 2 * * *"}, false},
+		{MaintenanceWindow{Name: "empty"}, false},
+	}
+	for _, c := range cases {
+		cfg := base
+		cfg.MaintenanceWindows = []MaintenanceWindow{c.window}
+		if err := ValidateConfig(&cfg); (err == nil) != c.ok {
+			t.Errorf("%s: err = %v", c.window.Name, err)
+		}
+	}
+}
+
+func TestValidateWatchStores(t *testing.T) {
+	cases := []struct {
+		watch string
+		drift bool
+		ok    bool
+	}{
+		{"", false, true},
+		{"sync", false, true},
+		{"report", true, true},
+		{"report", false, false},
+		{"remediate", true, false},
+	}
+	for _, c := range cases {
+		cfg := &Config{CertificateSources: []CertificateSource{{Name: "mozilla"}}, TrustStores: []TrustStore{{Name: "system"}}}
+		cfg.Settings.WatchStores, cfg.Settings.DriftDetection = c.watch, c.drift
+		if err := ValidateConfig(cfg); (err == nil) != c.ok {
+			t.Errorf("watch_stores %q with drift_detection %v: err = %v", c.watch, c.drift, err)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "corp-root.pem"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		CertificateSources: []CertificateSource{
+			{Name: "public", Type: "url", Source: "https://certs.example.com/bundle.pem", Enabled: true},
+			{Name: "internal", Type: "url", Source: "https://pki.corp/bundle.pem", Enabled: true, VerifyTLS: true, PinnedCA: "pki.pem", Filters: []string{"Corp"}},
+			{Name: "dir", Type: "directory", Source: dir, Enabled: true, Filters: []string{"corp-*.pem", "*.crt"}},
+		},
+		TrustStores: []TrustStore{{Name: "system", Type: "system", Enabled: true}},
+		Settings:    Settings{BackupEnabled: true, BackupDirectory: "./backups"},
+	}
+
+	rules := make(map[string]string)
+	for _, f := range Lint(cfg) {
+		rules[f.Subject+" "+f.Rule] = f.Severity
+	}
+	want := map[string]string{
+		"certificate source public tls-verify-disabled":    SeverityError,
+		"certificate source public unpinned-system-source": SeverityInfo,
+		"certificate source internal ignored-filters":      SeverityWarning,
+		"certificate source dir filter-matches-nothing":    SeverityWarning,
+	}
+	for rule, severity := range want {
+		if rules[rule] != severity {
+			t.Errorf("%s: severity %q, want %q", rule, rules[rule], severity)
+		}
+	}
+	if len(rules) != len(want) {
+		t.Errorf("findings = %v", rules)
+	}
+
+	cfg.Settings.BackupEnabled = false
+	cfg.Distrusted = []DistrustedCertificate{{Fingerprint: strings.Repeat("ab", 32)}}
+	found := false
+	for _, f := range Lint(cfg) {
+		found = found || f.Rule == "no-backups" && f.Severity == SeverityError
+	}
+	if !found {
+		t.Error("removing distrusted certificates without backups not reported as an error")
+	}
+}
+
+func TestLayerStores(t *testing.T) {
+	preset := Presets["server"].TrustStores
+	configured := []TrustStore{
+		{Name: "java-cacerts", Type: "application", Target: "java-cacerts", Enabled: false},
+		{Name: "nginx", Type: "application", Target: "nginx", Enabled: true},
+	}
+	stores := layerStores(preset, configured)
+	if len(stores) != len(preset)+1 {
+		t.Fatalf("got %d stores, want %d", len(stores), len(preset)+1)
+	}
+	for i, store := range preset {
+		if stores[i].Name != store.Name {
+			t.Errorf("store %d = %s, want %s", i, stores[i].Name, store.Name)
+		}
+		if store.Name == "java-cacerts" && stores[i].Enabled {
+			t.Error("the configured java-cacerts store should replace the preset's")
+		}
+	}
+	if stores[len(stores)-1].Name != "nginx" {
+		t.Errorf("last store = %s, want nginx", stores[len(stores)-1].Name)
+	}
+
+	if err := UsePreset("laptop"); err == nil {
+		t.Error("UsePreset accepted an unknown preset")
+	}
+}
@@ -0,0 +1,354 @@
+package config
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// GenerateOptions tailors a generated configuration file
+type GenerateOptions struct {
+	MozillaBundle         bool   // enable the curl.se Mozilla CA bundle source
+	LocalDirectory        string // directory of local certificates
+	LocalDirectoryEnabled bool
+	TrustStores           []TrustStore
+	BackupDirectory       string
+	AuditEnabled          bool
+}
+
+// DefaultGenerateOptions returns the options used for the default
+// configuration: the Mozilla bundle and each platform's system store, with
+// application stores present but disabled
+func DefaultGenerateOptions() GenerateOptions {
+	return GenerateOptions{
+		MozillaBundle:   true,
+		LocalDirectory:  "./certificates",
+		BackupDirectory: "./backups",
+		AuditEnabled:    true,
+		TrustStores: []TrustStore{
+			{Name: "system-ca-certificates", Type: "system", Platform: []string{"linux"}, Target: "ca-certificates", Enabled: true, RequireRoot: true},
+			{Name: "system-keychain", Type: "system", Platform: []string{"darwin"}, Target: "system-keychain", Enabled: true, RequireRoot: true},
+			{Name: "system-cert-store", Type: "system", Platform: []string{"windows"}, Target: "root", Enabled: true, RequireRoot: true},
+			{Name: "docker-ca-certificates", Type: "application", Platform: []string{"linux", "darwin", "windows"}, Target: "docker"},
+			{Name: "java-cacerts", Type: "application", Platform: []string{"linux", "darwin", "windows"}, Target: "java-cacerts"},
+		},
+	}
+}
+
+// Generate renders a commented configuration file for opts
+func Generate(opts GenerateOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := configTemplate.Execute(&buf, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var configTemplate = template.Must(template.New("config").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+	"quoteList": func(values []string) string {
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = strconv.Quote(v)
+		}
+		return strings.Join(quoted, ", ")
+	},
+}).Parse(`# Trust Store Updater Configuration
+# This file defines certificate sources and target trust stores to update
+
+# Certificate sources - where to fetch new root certificates from
+certificate_sources:
+  - name: "mozilla-ca-bundle"
+    type: "url"
+    source: "https://curl.se/ca/cacert.pem"
+    enabled: {{.MozillaBundle}}
+    verify_tls: true
+    filters: []
+    # max_size_mb: 5  # overrides settings.max_bundle_size_mb
+    # content_types: ["application/x-pem-file", "text/plain"]  # HTML is always rejected
+    # pinned_ca: "/etc/trust-store-updater/curl-se-ca.pem"  # refuse the bundle if TLS is intercepted
+    # sha256: "<expected bundle digest>"
+    # requests_per_minute: 2  # politeness limit for this source
+    # resolve: {"curl.se": "151.101.1.91"}  # connect without DNS while provisioning
+    # doh_resolver: "https://1.1.1.1/dns-query"  # or resolve over DNS-over-HTTPS
+
+  # Mirror Microsoft's trusted root program (source defaults to Windows Update's authrootstl.cab)
+  # - name: "microsoft-roots"
+  #   type: "authroot"
+  #   enabled: true
+  #   purposes: ["server-auth"]  # only roots trusted for these EKUs
+  #   signer_ca: "/etc/trust-store-updater/microsoft-root.pem"  # verify the list's signature (required)
+  #   insecure_skip_verify: false  # true uses the list unverified when signer_ca is unset
+
+  # Snapshot Apple's root store on a Mac, e.g. to render a bundle for other platforms
+  # - name: "apple-roots"
+  #   type: "apple"
+  #   enabled: true
+
+  - name: "local-certificates"
+    type: "directory"
+    source: {{quote .LocalDirectory}}
+    enabled: {{.LocalDirectoryEnabled}}
+    filters:
+      - "*.crt"
+      - "*.pem"
+    # Alias/friendly name for stores that support one (Java keystores, Windows,
+    # keychains, plugins). Explicit labels by SHA-256 fingerprint win.
+    # label: "corp-{{"{{.CommonName}}"}}-{{"{{.ShortFingerprint}}"}}"
+    # labels:
+    #   "<sha256 fingerprint>": "corp-root-2024"
+    # Opt-in: install a private root cross-signed by a local root that only
+    # permits these names; the directory holds the local root's key.
+    # name_constraints:
+    #   directory: "./state/name-constraints"
+    #   permitted_dns_domains: ["corp.example.com"]
+    #   excluded_ip_ranges: ["0.0.0.0/0", "::/0"]
+
+# Trust stores - target stores to update with new certificates
+# (groups: ["browsers"] on a store or source limits it to update --group browsers)
+# (include/exclude: [{os: [linux], arch: [arm64], distro: [ubuntu], distro_version: ["22.04"]}]
+#  limits a store to matching hosts, so one config can cover a mixed fleet)
+# (when: 'installed("iis")' on a store or source is a host facts condition; see the facts command)
+# (options: {file_mode: "0640", owner: "root", group: "ssl-cert"} sets the permissions of
+#  certificate files written by ca-certificates, update-ca-trust and flatpak stores)
+# (pre_update/post_update: {command: ["systemctl", "reload", "nginx"], timeout_seconds: 60,
+#  env: {KEY: "value"}} run around a run's changes to a store; a failing pre_update
+#  leaves the store unchanged)
+# (reload_services: ["nginx"] reloads systemd units, launchd jobs or Windows services
+#  once a run has changed the store; reload_action: "restart" restarts them instead)
+# (trust_purposes: ["server-auth", "client-auth", "code-signing", "smime"] on a store or
+#  source limits what certificates are trusted for; they only go to stores that can
+#  limit trust: the macOS System keychain, Windows system stores and java-cacerts for TLS)
+trust_stores:{{if not .TrustStores}} []
+{{end}}
+{{- range .TrustStores}}
+  - name: {{quote .Name}}
+    type: {{quote .Type}}
+    platform: [{{quoteList .Platform}}]
+    target: {{quote .Target}}
+    enabled: {{.Enabled}}
+    require_root: {{.RequireRoot}}
+{{end}}
+# Global settings
+settings:
+  backup_enabled: true
+  backup_directory: {{quote .BackupDirectory}}
+  state_file: "./state/state.json"
+  history_database: "./state/history.db"  # runs and installs, queried with the history command; "" disables
+  lock_file: "./state/update.lock"  # only one instance changes stores at a time; "" disables
+  # instance_id: "agent01"  # names this instance in the lock file (default hostname-pid)
+  state_signing_key: ""  # e.g. ./state/state.key or tpm:0x81010010; signs the state file so edits are detected
+  host_tags: []  # e.g. ["production"]; tagged hosts may require a signed approval (see approval)
+  log_level: "info"
+  log_sinks: []  # "syslog" (linux/macOS), "eventlog" (windows)
+  max_retries: 3
+  timeout_seconds: 30
+  max_bundle_size_mb: 50  # URL and file sources larger than this are rejected
+  command_timeout_seconds: 300  # external tools (update-ca-certificates, security, keytool) are killed after this
+  validate_after: true
+  duplicate_policy: "all"  # "all", "shortest" or "longest" for certificates sharing a public key
+  aia_cache_directory: "./cache/aia"
+  aia_cache_hours: 24
+  captive_portal_check_url: ""  # e.g. http://connectivitycheck.gstatic.com/generate_204
+  user_agent: "trust-store-updater"  # sent with every HTTP request
+  requests_per_minute: 0  # limit on all HTTP requests; 0 is unlimited
+  max_retry_after_seconds: 300  # 429/503 responses are retried (max_retries) after Retry-After, up to this long
+  read_only: false  # reject every store change (also --read-only); for audit-only deployments
+  drift_detection: false  # report certificates added or removed outside this tool since the last run
+  watch_stores: ""  # serve: "report" drift or "sync" as soon as a system store changes
+  low_memory: false  # embedded hosts: parse one file at a time, cache no store listings, collect garbage sooner
+
+# Self-update - where to check for new signed releases of this tool
+self_update:
+  endpoint: ""
+  channel: "stable"
+  public_key: ""
+
+# Audit log - append-only JSONL record of every add/remove/restore
+audit:
+  enabled: {{.AuditEnabled}}
+  path: "./audit/audit.jsonl"
+  forward_syslog: false
+
+# Validation policy - applied to every fetched certificate before installation
+validation:
+  reject_sha1: true
+  min_rsa_key_bits: 2048
+  reject_unusual_ekus: true
+  allowed_ekus: ["any", "server-auth", "client-auth", "code-signing", "email-protection", "time-stamping", "ocsp-signing"]
+  allow_list: []  # SHA-256 fingerprints exempt from the checks above
+
+# SSH certificate authorities - keys are kept in a marked block of each file;
+# other lines are left alone and rotated-out CA keys are removed
+ssh:
+  authorities: []
+  #  - name: "corp-user-ca"
+  #    type: "url"  # "url" or "file"
+  #    source: "https://pki.example.com/ssh/user_ca.pub"
+  #    enabled: true
+  stores: []
+  #  - name: "sshd-trusted-user-ca"
+  #    type: "trusted_user_ca_keys"  # or "known_hosts" (@cert-authority lines)
+  #    path: "/etc/ssh/trusted_user_ca_keys"
+  #    enabled: true
+  #    authorities: ["corp-user-ca"]  # default: all
+  #    hosts: "*.example.com"  # known_hosts only
+
+# Package signing keys - installed into apt's trusted.gpg.d or the rpm database.
+# Every key is pinned by fingerprint; a fetched key that doesn't match is rejected.
+gpg:
+  keys: []
+  #  - name: "internal-repo"
+  #    type: "url"  # "url" or "file"
+  #    source: "https://repo.example.com/signing-key.asc"
+  #    fingerprint: "81F0819808F53585BA32D093C10510E51D107960"
+  #    enabled: true
+  stores: []
+  #  - name: "apt-keys"
+  #    type: "apt"  # or "rpm"
+  #    path: "/etc/apt/trusted.gpg.d"
+  #    enabled: true
+  #    keys: ["internal-repo"]  # default: all
+
+# API server (serve command) - callers get a role: "viewer" reads inventory,
+# "operator" can also trigger a sync, "admin" can also restore backups
+server:
+  listen: "127.0.0.1:8443"
+  tls_cert: ""
+  tls_key: ""
+  client_ca: ""  # verify client certificates against this CA bundle
+  api_keys: []
+  #  - name: "dashboard"
+  #    sha256: "<hex SHA-256 of the key>"  # e.g. printf %s "$KEY" | sha256sum
+  #    role: "viewer"
+  client_certificates: []
+  #  - name: "fleet-controller"
+  #    common_name: "fleet-controller.example.com"  # or fingerprint: "<sha256>"
+  #    role: "operator"
+
+# Sealed trust anchors - only certificates listed in the file are installed,
+# and the list only takes effect once sealed (trust-store-updater anchors seal)
+anchors:
+  sealed: false
+  file: "./state/trust-anchors.txt"
+  backend: ""  # "tpm" (tpm2-tools) or "keychain" (macOS); empty for the platform default
+  nv_index: "0x1500016"  # TPM NV index holding the sealed digest
+
+# Approval gate - hosts tagged with one of required_for_tags only change their
+# stores when the file holds an approval of the exact bundle, signed (e.g. with
+# a FIDO key) by a principal in allowed_signers; see trust-store-updater approve
+approval:
+  required_for_tags: ["production"]
+  file: "./approval.json"
+  allowed_signers: ""  # OpenSSH allowed_signers file, e.g. alice@example.com sk-ssh-ed25519@openssh.com AAAA...
+  signed_plans: false  # apply --plan only accepts plans signed with approve --plan (always on tagged hosts)
+
+# Distrusted certificates - removed from every store on each run, whether or
+# not this tool installed them, and never installed from any source
+distrusted_certificates: []
+#  - fingerprint: "<sha256>"
+#    reason: "CA key compromise"
+#  - subject: "Example Compromised Root CA"  # subject or common name
+#  - url: "https://security.example.com/distrusted.txt"  # PEM certificates, or one fingerprint per line
+
+# Composition - how the sources combine into the trust set every store gets:
+# "union" (default), "intersection" or "weighted" over the listed sources
+# (all sources when empty); other sources are added unchanged
+# composition:
+#   mode: "intersection"
+#   sources: ["mozilla-ca-bundle", "microsoft-roots"]
+#   weights: {"mozilla-ca-bundle": 2}  # weighted: per-source weight, default 1
+#   threshold: 2                       # weighted: weight a CA needs to be trusted
+
+# ACME - leaf certificates for applications on this host, obtained from an
+# ACME CA and installed with their keys into stores that can hold keys
+# (java-cacerts keystores, Windows system target "my"); see acme renew
+# acme:
+#   directory: "https://acme-v02.api.letsencrypt.org/directory"  # or an internal ACME CA
+#   email: "ops@example.com"
+#   storage_dir: "./state/acme"  # account key, certificates and their keys
+#   renew_before_days: 30
+#   certificates:
+#     - name: "intranet"
+#       domains: ["intranet.example.com"]
+#       solver: "http-01"  # http-01 (webroot, or a listener on listen, default :80) or dns-01
+#       webroot: "/var/www/html"
+#       # dns_command: ["/usr/local/bin/dns-txt"]  # dns-01: run with present|cleanup, record name, value
+#       # dns_propagation_seconds: 60
+#       key_type: "ecdsa-p256"  # or rsa-2048
+#       stores: ["tomcat-keystore"]
+#       label: "tomcat"  # keystore alias, default acme-<name>
+
+# Maintenance windows - stores are only changed while one of their windows
+# is open; runs at other times report the changes as deferred
+# maintenance_windows:
+#   - name: "weekend"
+#     groups: ["browsers"]  # store groups; empty applies to every store
+#     days: ["sat"]         # weekly window; every day when empty
+#     start: "22:00"
+#     end: "04:00"          # before start: ends the next day
+#     timezone: "UTC"       # default local time
+#   - name: "nightly"
+#     cron: "30 2 * * 1-5"  # minute hour day month weekday the window opens
+#     duration: "90m"
+#
+# Staged rollouts to agents running serve (rollout run --version LABEL):
+# rollout:
+#   agents:
+#     - name: "agent01"
+#       url: "https://agent01:8443"
+#   stages: [5, 25, 100]    # cumulative percent of agents per stage
+#   soak_seconds: 60        # wait before checking /readyz
+#   max_failures: 0         # failed agents tolerated per stage
+#   api_key_env: "ROLLOUT_API_KEY"  # operator key; or client_cert and client_key
+#   ca_file: "./agents-ca.pem"
+#
+# Critical stores apply changes in two phases: updates stage them in
+# settings.staging_directory (default ./state/staged) and "commit" applies them
+# trust_stores:
+#   - name: "system-ca-certificates"
+#     critical: true
+#
+# Verification probes run after a run changed a store; a failure removes the
+# run's additions again (verify_failure: "report" only reports it)
+# trust_stores:
+#   - name: "docker-certs"
+#     verify:
+#       - name: "registry"
+#         command: ["docker", "pull", "registry.internal/ping"]
+#       - name: "intranet"
+#         tls: "intranet.example:443"   # must verify against the store
+#
+# Stores on a read-only filesystem (container images, OSTree) are skipped;
+# read_only_output writes the certificates they would hold to a bundle instead
+# trust_stores:
+#   - name: "system-ca-certificates"
+#     read_only_output: "/var/lib/trust/ca-bundle.pem"
+#
+# On OSTree systems (Fedora CoreOS, Silverblue) use the ostree target, which
+# writes to /etc and reports when a pending deployment needs a reboot
+# trust_stores:
+#   - name: "system-ostree"
+#     type: "system"
+#     target: "ostree"
+#
+# On ChromeOS, run in the termina VM to update the Crostini Linux containers;
+# render --target onc produces the matching policy for ChromeOS itself
+# trust_stores:
+#   - name: "crostini"
+#     type: "application"
+#     target: "crostini"
+#     options:
+#       containers: "penguin"   # default: every running container
+#
+# Appliances reached over SSH, with a profile for where they keep their CAs
+# trust_stores:
+#   - name: "pve1"
+#     type: "appliance"
+#     target: "pve1.lab.example"
+#     options:
+#       profile: "proxmox"   # proxmox or esxi; or anchor_dir/bundle + update_command
+#       user: "root"
+#       identity_file: "/etc/trust-store-updater/id_ed25519"
+`))
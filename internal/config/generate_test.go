@@ -0,0 +1,52 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestGenerate(t *testing.T) {
+	opts := GenerateOptions{
+		LocalDirectory:        "/etc/pki/corp",
+		LocalDirectoryEnabled: true,
+		BackupDirectory:       "/var/backups/trust-store-updater",
+		TrustStores: []TrustStore{
+			{Name: "application-firefox", Type: "application", Platform: []string{"linux"}, Target: "firefox", Enabled: true},
+		},
+	}
+	data, err := Generate(opts)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		t.Fatalf("generated configuration is not valid YAML: %v\n%s", err, data)
+	}
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if len(cfg.CertificateSources) != 2 || cfg.CertificateSources[0].Enabled || !cfg.CertificateSources[1].Enabled || cfg.CertificateSources[1].Source != opts.LocalDirectory {
+		t.Errorf("unexpected sources: %+v", cfg.CertificateSources)
+	}
+	if len(cfg.TrustStores) != 1 || cfg.TrustStores[0].Target != "firefox" || !cfg.TrustStores[0].Enabled || cfg.TrustStores[0].Platform[0] != "linux" {
+		t.Errorf("unexpected trust stores: %+v", cfg.TrustStores)
+	}
+	if cfg.Settings.BackupDirectory != opts.BackupDirectory || cfg.Audit.Enabled {
+		t.Errorf("settings not applied: backup %q audit %t", cfg.Settings.BackupDirectory, cfg.Audit.Enabled)
+	}
+
+	// No stores still yields an empty list rather than a null key
+	opts.TrustStores = nil
+	if data, err = Generate(opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("trust_stores: []\n")) {
+		t.Errorf("expected an empty trust_stores list")
+	}
+}
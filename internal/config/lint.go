@@ -0,0 +1,207 @@
+package config
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Lint severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Finding is a risky setting found by Lint
+type Finding struct {
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Subject  string `json:"subject"` // the source, store or section concerned
+	Message  string `json:"message"`
+	Hint     string `json:"hint"` // how to fix it
+}
+
+// Lint flags valid but risky combinations of settings, most severe first.
+// A configuration that fails validation yields a single error finding.
+func Lint(cfg *Config) []Finding {
+	if err := ValidateConfig(cfg); err != nil {
+		return []Finding{{Severity: SeverityError, Rule: "invalid", Subject: "configuration", Message: err.Error(),
+			Hint: "fix the configuration; no update can run with it"}}
+	}
+
+	var findings []Finding
+	add := func(severity, rule, subject, message, hint string) {
+		findings = append(findings, Finding{Severity: severity, Rule: rule, Subject: subject, Message: message, Hint: hint})
+	}
+
+	var systemStores []string
+	for _, store := range cfg.TrustStores {
+		if store.Enabled && store.Type == "system" {
+			systemStores = append(systemStores, store.Name)
+		}
+	}
+
+	for _, source := range cfg.CertificateSources {
+		if !source.Enabled {
+			continue
+		}
+		subject := "certificate source " + source.Name
+		if source.Type == "url" {
+			lintURLSource(source, systemStores, add)
+		}
+		if len(source.Filters) > 0 && source.Type != "directory" {
+			add(SeverityWarning, "ignored-filters", subject,
+				"filters only select files of directory sources; every certificate of this source is used",
+				"remove filters, or split the bundle and use a directory source")
+		}
+		if source.Type == "directory" {
+			lintDirectoryFilters(source, add)
+		}
+	}
+
+	for _, store := range cfg.TrustStores {
+		if !store.Enabled {
+			continue
+		}
+		subject := "trust store " + store.Name
+		if store.Type == "system" && !store.RequiresCA() && !strings.EqualFold(store.Target, "my") {
+			add(SeverityWarning, "end-entity-in-root-store", subject,
+				"require_ca is false, so end-entity certificates can become trusted roots",
+				"remove require_ca: false unless the store holds leaf certificates (e.g. Windows \"my\")")
+		}
+		if store.Critical && len(store.Verify) == 0 {
+			add(SeverityInfo, "critical-without-probes", subject,
+				"changes are staged for commit, but no verify probes check the store afterwards",
+				"add verify probes, or run smoke tests against the staged bundle before commit")
+		}
+	}
+
+	if !cfg.Settings.BackupEnabled && !cfg.Settings.ReadOnly {
+		severity, message := SeverityWarning, "stores are changed without backups, so restore has nothing to return to"
+		if len(cfg.Distrusted) > 0 {
+			severity, message = SeverityError, "distrusted_certificates remove certificates from every store, and backups are disabled"
+		}
+		add(severity, "no-backups", "settings", message, "set settings.backup_enabled: true")
+	}
+
+	if len(cfg.Server.APIKeys) > 0 && cfg.Server.TLSCert == "" && !isLoopbackListen(cfg.Server.Listen) {
+		add(SeverityError, "api-without-tls", "server",
+			"the agent API accepts API keys over plain HTTP on "+cfg.Server.Listen,
+			"set server.tls_cert and server.tls_key, or listen on 127.0.0.1")
+	}
+
+	groups := make(map[string]bool)
+	for _, store := range cfg.TrustStores {
+		for _, group := range store.Groups {
+			groups[group] = true
+		}
+	}
+	for _, window := range cfg.MaintenanceWindows {
+		for _, group := range window.Groups {
+			if !groups[group] {
+				add(SeverityWarning, "window-matches-nothing", "maintenance window "+window.Name,
+					"group "+group+" has no trust stores, so the window restricts nothing",
+					"fix the group name or add the group to the stores it should cover")
+			}
+		}
+	}
+
+	order := map[string]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+	slices.SortStableFunc(findings, func(a, b Finding) int { return order[a.Severity] - order[b.Severity] })
+	return findings
+}
+
+// lintURLSource checks how a url source is fetched
+func lintURLSource(source CertificateSource, systemStores []string, add func(severity, rule, subject, message, hint string)) {
+	subject := "certificate source " + source.Name
+	u, err := url.Parse(source.Source)
+	if err != nil {
+		return
+	}
+	public := isPublicHost(u.Hostname())
+
+	if u.Scheme == "https" && !source.VerifyTLS {
+		severity := SeverityWarning
+		if public {
+			severity = SeverityError
+		}
+		add(severity, "tls-verify-disabled", subject,
+			"verify_tls is false, so anyone on the network path can substitute the certificates",
+			"set verify_tls: true, with pinned_ca for a private CA")
+	}
+	if u.Scheme == "http" && source.SHA256 == "" {
+		add(SeverityWarning, "plain-http-source", subject,
+			"the bundle is fetched over plain HTTP without a sha256 digest",
+			"use https, or set sha256 to the bundle's expected digest")
+	}
+	if len(systemStores) > 0 && source.PinnedCA == "" && source.SHA256 == "" {
+		add(SeverityInfo, "unpinned-system-source", subject,
+			"certificates from this URL go into the system stores ("+strings.Join(systemStores, ", ")+") without a pin",
+			"set pinned_ca or sha256, or enable anchors.sealed with a trust anchor list")
+	}
+}
+
+// lintDirectoryFilters checks that each filter of a directory source is a
+// valid pattern matching some file
+func lintDirectoryFilters(source CertificateSource, add func(severity, rule, subject, message, hint string)) {
+	subject := "certificate source " + source.Name
+	var names []string
+	_ = filepath.Walk(source.Source, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			names = append(names, info.Name())
+		}
+		return nil
+	})
+	for _, filter := range source.Filters {
+		if _, err := filepath.Match(filter, ""); err != nil {
+			add(SeverityError, "bad-filter", subject, "filter "+filter+" is not a valid pattern",
+				"use shell patterns such as *.pem or corp-*.crt")
+			continue
+		}
+		if len(names) == 0 {
+			continue
+		}
+		matched := slices.ContainsFunc(names, func(name string) bool {
+			ok, _ := filepath.Match(filter, name)
+			return ok
+		})
+		if !matched {
+			add(SeverityWarning, "filter-matches-nothing", subject,
+				"filter "+filter+" matches no file in "+source.Source,
+				"patterns match file names, not paths or subjects")
+		}
+	}
+}
+
+// isPublicHost reports whether host looks reachable over the internet
+// rather than an internal name or address
+func isPublicHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+	}
+	host = strings.ToLower(host)
+	if !strings.Contains(host, ".") || host == "localhost" {
+		return false
+	}
+	for _, suffix := range []string{".local", ".internal", ".lan", ".corp", ".home.arpa", ".localhost"} {
+		if strings.HasSuffix(host, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLoopbackListen(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	return host == "localhost"
+}
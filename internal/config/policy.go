@@ -0,0 +1,71 @@
+package config
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Policy is configuration set centrally through the platform's management
+// channel: the Windows registry key HKLM\Software\Policies\TrustStoreUpdater
+// (Group Policy) or the macOS managed preferences domain
+// com.webprofusion.trust-store-updater (MDM configuration profiles).
+// Values are named by configuration key, either dotted ("settings.timeout_seconds")
+// or nested in subkeys/dictionaries (Settings -> timeout_seconds), and take
+// precedence over the configuration file.
+type Policy struct {
+	Source string                 // where the policy was read from
+	Values map[string]interface{} // flattened, lower-case dotted keys
+}
+
+// ReadPolicy returns the managed policy for this machine, or nil when none is set
+func ReadPolicy() (*Policy, error) {
+	source, values, err := readPlatformPolicy()
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+	return &Policy{Source: source, Values: flattenPolicy("", values)}, nil
+}
+
+// Keys returns the overridden configuration keys in sorted order
+func (p *Policy) Keys() []string {
+	keys := make([]string, 0, len(p.Values))
+	for key := range p.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Apply overrides the loaded configuration with the policy values
+func (p *Policy) Apply() {
+	p.applyTo(viper.GetViper())
+}
+
+func (p *Policy) applyTo(v *viper.Viper) {
+	for key, value := range p.Values {
+		v.Set(key, value)
+	}
+	globalConfig = nil
+}
+
+// flattenPolicy turns nested maps into dotted keys so that a policy setting a
+// single value does not replace the rest of its section
+func flattenPolicy(prefix string, values map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	for name, value := range values {
+		key := strings.ToLower(name)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			for k, v := range flattenPolicy(key, nested) {
+				flat[k] = v
+			}
+			continue
+		}
+		flat[key] = value
+	}
+	return flat
+}
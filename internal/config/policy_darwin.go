@@ -0,0 +1,34 @@
+//go:build darwin
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// policyPlistPath is where configuration profiles for the
+// com.webprofusion.trust-store-updater preference domain are installed
+const policyPlistPath = "/Library/Managed Preferences/com.webprofusion.trust-store-updater.plist"
+
+func readPlatformPolicy() (string, map[string]interface{}, error) {
+	if _, err := os.Stat(policyPlistPath); errors.Is(err, os.ErrNotExist) {
+		return "", nil, nil
+	}
+
+	// Managed preferences are binary plists; plutil converts them to JSON
+	runner := certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout}
+	out, err := runner.Run("plutil", "-convert", "json", "-o", "-", policyPlistPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read managed preferences %s: %w", policyPlistPath, err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(out, &values); err != nil {
+		return "", nil, fmt.Errorf("failed to parse managed preferences %s: %w", policyPlistPath, err)
+	}
+	return policyPlistPath, values, nil
+}
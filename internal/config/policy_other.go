@@ -0,0 +1,9 @@
+//go:build !windows && !darwin
+
+package config
+
+// readPlatformPolicy reports no policy; only Windows and macOS have a
+// management channel for configuration
+func readPlatformPolicy() (string, map[string]interface{}, error) {
+	return "", nil, nil
+}
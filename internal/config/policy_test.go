@@ -0,0 +1,41 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPolicyOverridesConfigFile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	file := []byte("settings:\n  backup_directory: ./backups\n  timeout_seconds: 30\naudit:\n  enabled: false\n")
+	if err := v.ReadConfig(bytes.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &Policy{Values: flattenPolicy("", map[string]interface{}{
+		"Settings": map[string]interface{}{
+			"Timeout_Seconds": int64(60),
+			"log_sinks":       []string{"eventlog"},
+		},
+		"audit.enabled": int64(1),
+	})}
+	if want := []string{"audit.enabled", "settings.log_sinks", "settings.timeout_seconds"}; !reflect.DeepEqual(policy.Keys(), want) {
+		t.Errorf("Keys() = %v, want %v", policy.Keys(), want)
+	}
+	policy.applyTo(v)
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Settings.TimeoutSeconds != 60 || !cfg.Audit.Enabled || !reflect.DeepEqual(cfg.Settings.LogSinks, []string{"eventlog"}) {
+		t.Errorf("policy not applied: %+v %+v", cfg.Settings, cfg.Audit)
+	}
+	if cfg.Settings.BackupDirectory != "./backups" {
+		t.Errorf("policy replaced unrelated setting: backup_directory = %q", cfg.Settings.BackupDirectory)
+	}
+}
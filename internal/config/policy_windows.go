@@ -0,0 +1,90 @@
+//go:build windows
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// policyKeyPath is the Group Policy key under HKEY_LOCAL_MACHINE
+const policyKeyPath = `Software\Policies\TrustStoreUpdater`
+
+func readPlatformPolicy() (string, map[string]interface{}, error) {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, policyKeyPath, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+	if errors.Is(err, registry.ErrNotExist) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open policy key: %w", err)
+	}
+	defer key.Close()
+
+	values, err := readPolicyKey(key, policyKeyPath)
+	if err != nil {
+		return "", nil, err
+	}
+	return `HKLM\` + policyKeyPath, values, nil
+}
+
+// readPolicyKey reads the values of key, recursing into subkeys as nested sections
+func readPolicyKey(key registry.Key, path string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	names, err := key.ReadValueNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy key %s: %w", path, err)
+	}
+	for _, name := range names {
+		value, err := readPolicyValue(key, name)
+		if err != nil {
+			return nil, fmt.Errorf("policy value %s\\%s: %w", path, name, err)
+		}
+		values[name] = value
+	}
+
+	subkeys, err := key.ReadSubKeyNames(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy key %s: %w", path, err)
+	}
+	for _, name := range subkeys {
+		sub, err := registry.OpenKey(key, name, registry.QUERY_VALUE|registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open policy key %s\\%s: %w", path, name, err)
+		}
+		nested, err := readPolicyKey(sub, path+`\`+name)
+		sub.Close()
+		if err != nil {
+			return nil, err
+		}
+		values[name] = nested
+	}
+	return values, nil
+}
+
+// readPolicyValue converts REG_SZ/REG_EXPAND_SZ to strings, REG_MULTI_SZ to
+// lists and REG_DWORD/REG_QWORD to integers (0/1 for booleans)
+func readPolicyValue(key registry.Key, name string) (interface{}, error) {
+	_, valtype, err := key.GetValue(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch valtype {
+	case registry.SZ, registry.EXPAND_SZ:
+		value, _, err := key.GetStringValue(name)
+		if err == nil && valtype == registry.EXPAND_SZ {
+			value, err = registry.ExpandString(value)
+		}
+		return value, err
+	case registry.MULTI_SZ:
+		value, _, err := key.GetStringsValue(name)
+		return value, err
+	case registry.DWORD, registry.QWORD:
+		value, _, err := key.GetIntegerValue(name)
+		return int64(value), err
+	default:
+		return nil, fmt.Errorf("unsupported registry value type %d", valtype)
+	}
+}
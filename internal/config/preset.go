@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Preset is a built-in configuration for a host role. It is layered under
+// the configuration file: its settings are defaults the file can override,
+// and its trust stores are used unless the file has a store of the same name.
+type Preset struct {
+	Description string
+	Settings    map[string]interface{} // keys as in the file, e.g. "settings.backup_enabled"
+	TrustStores []TrustStore
+}
+
+// Stores shared by the presets. The system stores use the names of the
+// generated configuration so a default file overrides them rather than
+// adding duplicates.
+var (
+	presetSystemStores = []TrustStore{
+		{Name: "system-ca-certificates", Type: "system", Platform: []string{"linux"}, Target: "ca-certificates", Enabled: true, RequireRoot: true, Groups: []string{"system"}},
+		{Name: "system-keychain", Type: "system", Platform: []string{"darwin"}, Target: "system-keychain", Enabled: true, RequireRoot: true, Groups: []string{"system"}},
+		{Name: "system-cert-store", Type: "system", Platform: []string{"windows"}, Target: "root", Enabled: true, RequireRoot: true, Groups: []string{"system"}},
+	}
+	presetJava    = TrustStore{Name: "java-cacerts", Type: "application", Platform: []string{"linux", "darwin", "windows"}, Target: "java-cacerts", Enabled: true, Groups: []string{"runtimes"}}
+	presetDocker  = TrustStore{Name: "docker-ca-certificates", Type: "application", Platform: []string{"linux", "darwin", "windows"}, Target: "docker", Enabled: true, Groups: []string{"runtimes"}}
+	presetFirefox = TrustStore{Name: "firefox", Type: "application", Platform: []string{"linux", "darwin", "windows"}, Target: "firefox", Enabled: true, Groups: []string{"browsers"}}
+	presetChrome  = TrustStore{Name: "chrome", Type: "application", Platform: []string{"linux", "darwin", "windows"}, Target: "chrome", Enabled: true, Groups: []string{"browsers"}}
+)
+
+// presetStores returns the system stores followed by extra
+func presetStores(extra ...TrustStore) []TrustStore {
+	return append(append([]TrustStore(nil), presetSystemStores...), extra...)
+}
+
+// Presets are the built-in role presets
+var Presets = map[string]Preset{
+	"server": {
+		Description: "system stores, Java and Docker",
+		TrustStores: presetStores(presetJava, presetDocker),
+	},
+	"workstation": {
+		Description: "system stores, browsers and Java",
+		TrustStores: presetStores(presetFirefox, presetChrome, presetJava),
+	},
+	// CI runners are discarded after their jobs, so nothing is kept for later
+	"ci": {
+		Description: "system stores, Java and Docker, without backups or audit log",
+		Settings: map[string]interface{}{
+			"settings.backup_enabled": false,
+			"audit.enabled":           false,
+		},
+		TrustStores: presetStores(presetJava, presetDocker),
+	},
+	// Kiosks run unattended, often on networks that come and go
+	"kiosk": {
+		Description: "system stores and browsers, retrying downloads longer",
+		Settings: map[string]interface{}{
+			"settings.max_retries": 10,
+		},
+		TrustStores: presetStores(presetFirefox, presetChrome),
+	},
+}
+
+// PresetNames returns the built-in preset names in order
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// activePreset is layered under the configuration by LoadConfig
+var (
+	activePreset     *Preset
+	activePresetName string
+)
+
+// UsePreset layers the named preset under the configuration
+func UsePreset(name string) error {
+	if name == activePresetName {
+		return nil
+	}
+	preset, ok := Presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %q (expected one of %s)", name, strings.Join(PresetNames(), ", "))
+	}
+	for key, value := range preset.Settings {
+		viper.SetDefault(key, value)
+	}
+	activePreset, activePresetName = &preset, name
+	globalConfig = nil
+	return nil
+}
+
+// layerStores returns the preset's stores, each replaced by the configured
+// store of the same name, followed by the other configured stores
+func layerStores(preset, configured []TrustStore) []TrustStore {
+	byName := make(map[string]int, len(configured))
+	for i, store := range configured {
+		byName[store.Name] = i
+	}
+	used := make(map[int]bool)
+	stores := make([]TrustStore, 0, len(preset)+len(configured))
+	for _, store := range preset {
+		if i, ok := byName[store.Name]; ok {
+			store = configured[i]
+			used[i] = true
+		}
+		stores = append(stores, store)
+	}
+	for i, store := range configured {
+		if !used[i] {
+			stores = append(stores, store)
+		}
+	}
+	return stores
+}
@@ -0,0 +1,322 @@
+// Package constrain re-wraps unconstrained private roots under a locally
+// generated root that carries X.509 name constraints. Each private root is
+// cross-signed by the local root with the same subject and key, so existing
+// intermediates and leaves still chain, but only for the permitted names.
+// The local root's key never leaves the directory it is created in.
+package constrain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+)
+
+const (
+	keyFile  = "root.key"
+	rootFile = "root.pem"
+
+	// rootLifetime is the validity of the local root; it is reissued with
+	// the same key once less than rootRenewBefore remains
+	rootLifetime    = 10 * 365 * 24 * time.Hour
+	rootRenewBefore = 90 * 24 * time.Hour
+)
+
+// Constraints are the names the wrapped roots may issue for. IP ranges are
+// in CIDR notation.
+type Constraints struct {
+	PermittedDNSDomains []string
+	ExcludedDNSDomains  []string
+	PermittedIPRanges   []string
+	ExcludedIPRanges    []string
+}
+
+// digest identifies a set of constraints independently of their order
+func (c Constraints) digest() string {
+	h := sha256.New()
+	for _, list := range [][]string{c.PermittedDNSDomains, c.ExcludedDNSDomains, c.PermittedIPRanges, c.ExcludedIPRanges} {
+		sorted := slices.Clone(list)
+		slices.Sort(sorted)
+		fmt.Fprintf(h, "%s\n", strings.Join(sorted, ","))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// constraintsOf returns the name constraints a certificate carries
+func constraintsOf(c *x509.Certificate) Constraints {
+	ranges := func(nets []*net.IPNet) []string {
+		var s []string
+		for _, n := range nets {
+			s = append(s, n.String())
+		}
+		return s
+	}
+	return Constraints{
+		PermittedDNSDomains: c.PermittedDNSDomains,
+		ExcludedDNSDomains:  c.ExcludedDNSDomains,
+		PermittedIPRanges:   ranges(c.PermittedIPRanges),
+		ExcludedIPRanges:    ranges(c.ExcludedIPRanges),
+	}
+}
+
+// apply sets the constraints on a certificate template, marked critical
+func (c Constraints) apply(template *x509.Certificate) error {
+	parse := func(ranges []string) ([]*net.IPNet, error) {
+		var nets []*net.IPNet
+		for _, r := range ranges {
+			_, n, err := net.ParseCIDR(r)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a CIDR range", r)
+			}
+			nets = append(nets, n)
+		}
+		return nets, nil
+	}
+	permitted, err := parse(c.PermittedIPRanges)
+	if err != nil {
+		return err
+	}
+	excluded, err := parse(c.ExcludedIPRanges)
+	if err != nil {
+		return err
+	}
+	template.PermittedDNSDomainsCritical = true
+	template.PermittedDNSDomains = c.PermittedDNSDomains
+	template.ExcludedDNSDomains = c.ExcludedDNSDomains
+	template.PermittedIPRanges = permitted
+	template.ExcludedIPRanges = excluded
+	return nil
+}
+
+// Wrapper cross-signs private roots with a local constrained root
+type Wrapper struct {
+	dir         string
+	constraints Constraints
+	key         *ecdsa.PrivateKey
+	root        *x509.Certificate
+}
+
+// Open loads the local root from dir, creating its key and certificate on
+// first use. The root is reissued with the same key when the constraints
+// change or it nears expiry.
+func Open(dir string, constraints Constraints) (*Wrapper, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create name constraints directory: %w", err)
+	}
+	key, err := loadOrCreateKey(filepath.Join(dir, keyFile))
+	if err != nil {
+		return nil, err
+	}
+	w := &Wrapper{dir: dir, constraints: constraints, key: key}
+
+	root, err := readCertificate(filepath.Join(dir, rootFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if root == nil || !w.current(root) {
+		if root, err = w.issueRoot(); err != nil {
+			return nil, err
+		}
+	}
+	w.root = root
+	return w, nil
+}
+
+// Root returns the local constrained root, the trust anchor of the wrapped
+// certificates
+func (w *Wrapper) Root() *x509.Certificate {
+	return w.root
+}
+
+// current reports whether root can be kept: it was issued for this key and
+// these constraints and isn't close to expiry
+func (w *Wrapper) current(root *x509.Certificate) bool {
+	pub, ok := root.PublicKey.(*ecdsa.PublicKey)
+	return ok && pub.Equal(&w.key.PublicKey) &&
+		constraintsOf(root).digest() == w.constraints.digest() &&
+		time.Until(root.NotAfter) > rootRenewBefore
+}
+
+func (w *Wrapper) issueRoot() (*x509.Certificate, error) {
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   "Trust Store Updater Name Constraints Root",
+			Organization: []string{"trust-store-updater"},
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(rootLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if err := w.constraints.apply(template); err != nil {
+		return nil, err
+	}
+	root, err := w.sign(template, template, &w.key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue name constraints root: %w", err)
+	}
+	if err := writeCertificate(filepath.Join(w.dir, rootFile), root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// Wrap returns the cross-signed copy of the CA certificate x: its subject,
+// key and key identifier with the local root as issuer and the constraints
+// added. The copy is cached in the directory so that the same certificate
+// is installed on every run.
+func (w *Wrapper) Wrap(x *x509.Certificate) (*x509.Certificate, error) {
+	if !x.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", x.Subject)
+	}
+	notAfter := x.NotAfter
+	if w.root.NotAfter.Before(notAfter) {
+		notAfter = w.root.NotAfter
+	}
+
+	path := filepath.Join(w.dir, fmt.Sprintf("cross-%s-%s.pem", cert.GetCertificateFingerprint(x)[:16], w.constraints.digest()[:8]))
+	cached, err := readCertificate(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if cached != nil && cached.NotAfter.Equal(notAfter) && cached.CheckSignatureFrom(w.root) == nil {
+		return cached, nil
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		RawSubject:            x.RawSubject,
+		SubjectKeyId:          x.SubjectKeyId,
+		NotBefore:             x.NotBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           x.ExtKeyUsage,
+		UnknownExtKeyUsage:    x.UnknownExtKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            x.MaxPathLen,
+		MaxPathLenZero:        x.MaxPathLenZero,
+	}
+	if err := w.constraints.apply(template); err != nil {
+		return nil, err
+	}
+	cross, err := w.sign(template, w.root, x.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cross-sign %s: %w", x.Subject, err)
+	}
+	if err := writeCertificate(path, cross); err != nil {
+		return nil, err
+	}
+	return cross, nil
+}
+
+// sign issues template, setting a serial number when it has none
+func (w *Wrapper) sign(template, parent *x509.Certificate, pub any) (*x509.Certificate, error) {
+	if template.SerialNumber == nil {
+		serial, err := randomSerial()
+		if err != nil {
+			return nil, err
+		}
+		template.SerialNumber = serial
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, w.key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+func loadOrCreateKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return createKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read name constraints key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in name constraints key %s", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse name constraints key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("name constraints key %s is not an ECDSA key", path)
+	}
+	return key, nil
+}
+
+func createKey(path string) (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate name constraints key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode name constraints key: %w", err)
+	}
+	// O_EXCL so a key created concurrently is never overwritten
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create name constraints key: %w", err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, fmt.Errorf("failed to write name constraints key: %w", err)
+	}
+	return key, nil
+}
+
+// readCertificate reads a single PEM certificate; a missing file is
+// returned as an os.IsNotExist error
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func writeCertificate(path string, c *x509.Certificate) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	if err := atomicfile.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
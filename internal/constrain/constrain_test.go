@@ -0,0 +1,122 @@
+package constrain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// issue creates a certificate signed by parent's key, or self-signed when
+// parent is nil
+func issue(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, key
+}
+
+func caTemplate(cn string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+func TestWrapConstrainsExistingChain(t *testing.T) {
+	root, rootKey := issue(t, caTemplate("Internal Root"), nil, nil)
+	intermediate, intKey := issue(t, caTemplate("Internal Issuing CA"), root, rootKey)
+	leaf := func(name string) *x509.Certificate {
+		c, _ := issue(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: name},
+			DNSNames:    []string{name},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, intermediate, intKey)
+		return c
+	}
+
+	w, err := Open(t.TempDir(), Constraints{PermittedDNSDomains: []string{"corp.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := w.Wrap(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+	}
+	opts.Roots.AddCert(w.Root())
+	opts.Intermediates.AddCert(cross)
+	opts.Intermediates.AddCert(intermediate)
+
+	if _, err := leaf("app.corp.example").Verify(opts); err != nil {
+		t.Errorf("permitted name rejected: %v", err)
+	}
+	if _, err := leaf("bank.example").Verify(opts); err == nil {
+		t.Error("name outside the constraints accepted")
+	}
+}
+
+func TestWrapIsCached(t *testing.T) {
+	root, _ := issue(t, caTemplate("Internal Root"), nil, nil)
+	dir := t.TempDir()
+	constraints := Constraints{PermittedDNSDomains: []string{"corp.example"}, ExcludedIPRanges: []string{"0.0.0.0/0"}}
+
+	w, err := Open(dir, constraints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := w.Wrap(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = Open(dir, constraints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := w.Wrap(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Equal(second) {
+		t.Error("cross-signed certificate was reissued on reopening")
+	}
+
+	w, err = Open(dir, Constraints{PermittedDNSDomains: []string{"other.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := w.Wrap(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Equal(third) || third.PermittedDNSDomains[0] != "other.example" {
+		t.Error("cross-signed certificate not reissued for new constraints")
+	}
+}
@@ -0,0 +1,258 @@
+// Package devca implements a local development CA: a per-user root whose
+// key stays in the user's config directory, installed into the configured
+// trust stores like any other certificate, and used to issue certificates
+// for local HTTPS.
+package devca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+)
+
+const (
+	rootFile    = "rootCA.pem"
+	rootKeyFile = "rootCA-key.pem"
+
+	rootLifetime = 10 * 365 * 24 * time.Hour
+	// leafLifetime stays within the 825 days Apple platforms accept for TLS
+	// server certificates
+	leafLifetime = 825 * 24 * time.Hour
+)
+
+var (
+	// ErrNotCreated is returned when no development CA exists in the directory
+	ErrNotCreated = errors.New("the development CA has not been created yet; run dev-ca create")
+	// ErrExists is returned when creating a development CA over an existing one
+	ErrExists = errors.New("a development CA already exists")
+)
+
+// DefaultDir returns the per-user directory the development CA is kept in
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the user config directory: %w", err)
+	}
+	return filepath.Join(dir, "trust-store-updater", "dev-ca"), nil
+}
+
+// CA is a development root and its key
+type CA struct {
+	dir  string
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+// Create generates a development root in dir. The directory is created
+// readable by the user only and the key is written with mode 0600.
+func Create(dir string) (*CA, error) {
+	if _, err := os.Stat(filepath.Join(dir, rootFile)); err == nil {
+		return nil, fmt.Errorf("%w in %s", ErrExists, dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create development CA directory: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate development CA key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         "trust-store-updater development CA " + owner(),
+			Organization:       []string{"trust-store-updater development CA"},
+			OrganizationalUnit: []string{owner()},
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(rootLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create development CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	// The key goes first, so a root is never left without one
+	if err := writeKey(filepath.Join(dir, rootKeyFile), key); err != nil {
+		return nil, err
+	}
+	if err := atomicfile.WriteFile(filepath.Join(dir, rootFile), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write development CA certificate: %w", err)
+	}
+	return &CA{dir: dir, key: key, cert: cert}, nil
+}
+
+// Load reads the development root and key from dir
+func Load(dir string) (*CA, error) {
+	data, err := os.ReadFile(filepath.Join(dir, rootFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read development CA certificate: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", filepath.Join(dir, rootFile))
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse development CA certificate: %w", err)
+	}
+	key, err := readKey(filepath.Join(dir, rootKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, fmt.Errorf("development CA key in %s does not match its certificate", dir)
+	}
+	return &CA{dir: dir, key: key, cert: cert}, nil
+}
+
+// Certificate returns the development root
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// CertificatePath returns the PEM file of the development root
+func (ca *CA) CertificatePath() string {
+	return filepath.Join(ca.dir, rootFile)
+}
+
+// Leaf is a certificate issued by the development CA and its key
+type Leaf struct {
+	Certificate *x509.Certificate
+	Key         *ecdsa.PrivateKey
+}
+
+// Issue creates a TLS server and client certificate for names: host names,
+// wildcards, IP addresses or email addresses
+func (ca *CA) Issue(names []string) (*Leaf, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one name is required")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(leafLifetime)
+	if ca.cert.NotAfter.Before(notAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         names[0],
+			Organization:       []string{"trust-store-updater development certificate"},
+			OrganizationalUnit: []string{owner()},
+		},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, name := range names {
+		switch {
+		case net.ParseIP(name) != nil:
+			template.IPAddresses = append(template.IPAddresses, net.ParseIP(name))
+		case strings.Contains(name, "@"):
+			template.EmailAddresses = append(template.EmailAddresses, name)
+		default:
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Leaf{Certificate: cert, Key: key}, nil
+}
+
+// owner describes the user and host the CA belongs to, so that roots made
+// by different developers can be told apart in a store
+func owner() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+	if err := atomicfile.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	return nil
+}
+
+func readKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read development CA key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse development CA key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("development CA key %s is not an ECDSA key", path)
+	}
+	return key, nil
+}
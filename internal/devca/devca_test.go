@@ -0,0 +1,142 @@
+package devca
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+func TestCreateLoadAndIssue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dev-ca")
+	ca, err := Create(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(dir); !errors.Is(err, ErrExists) {
+		t.Errorf("second create: err = %v, want ErrExists", err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dir, rootKeyFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("key mode = %v, want 0600", info.Mode().Perm())
+		}
+	}
+
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Certificate().Equal(ca.Certificate()) {
+		t.Error("loaded root differs from the created one")
+	}
+
+	leaf, err := loaded.Issue([]string{"localhost", "127.0.0.1", "*.app.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	for _, name := range []string{"localhost", "127.0.0.1", "api.app.test"} {
+		if _, err := leaf.Certificate.Verify(x509.VerifyOptions{Roots: roots, DNSName: name}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := leaf.Certificate.Verify(x509.VerifyOptions{Roots: roots, DNSName: "example.com"}); err == nil {
+		t.Error("certificate valid for a name it wasn't issued for")
+	}
+
+	certFile, keyFile := filepath.Join(t.TempDir(), "localhost.pem"), filepath.Join(t.TempDir(), "localhost-key.pem")
+	if err := leaf.WritePEM(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	if _, err := Load(t.TempDir()); !errors.Is(err, ErrNotCreated) {
+		t.Errorf("err = %v, want ErrNotCreated", err)
+	}
+}
+
+func TestIssueToAndRenew(t *testing.T) {
+	ca, err := Create(filepath.Join(t.TempDir(), "dev-ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	req := Request{
+		Names:    []string{"localhost", "::1"},
+		Format:   FormatPEM,
+		CertFile: filepath.Join(out, "localhost.pem"),
+		KeyFile:  filepath.Join(out, "localhost-key.pem"),
+	}
+	first, err := ca.IssueTo(req, certstore.CommandRunner{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Issuing to the same file replaces the record
+	if _, err := ca.IssueTo(req, certstore.CommandRunner{}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ca.Issued()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Fingerprint == first.Fingerprint {
+		t.Fatalf("records = %+v", records)
+	}
+
+	root := cert.GetCertificateFingerprint(ca.Certificate())
+	if records[0].Due(root, 30*24*time.Hour) {
+		t.Error("new certificate due for renewal")
+	}
+	if !records[0].Due(root, 1000*24*time.Hour) || !records[0].Due("other-root", 0) {
+		t.Error("certificate not due near expiry or under another root")
+	}
+
+	results, err := ca.Renew(30*24*time.Hour, false, certstore.CommandRunner{})
+	if err != nil || len(results) != 0 {
+		t.Fatalf("renew of current certificates: %v, %+v", err, results)
+	}
+	results, err = ca.Renew(30*24*time.Hour, true, certstore.CommandRunner{})
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("forced renew: %v, %+v", err, results)
+	}
+	if results[0].Issued.Fingerprint == records[0].Fingerprint {
+		t.Error("forced renew did not reissue the certificate")
+	}
+}
+
+func TestIssueToPKCS12(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not found")
+	}
+	ca, err := Create(filepath.Join(t.TempDir(), "dev-ca"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "localhost.pfx")
+	_, err = ca.IssueTo(Request{Names: []string{"localhost"}, Format: FormatPFX, CertFile: path, Password: "changeit"}, certstore.CommandRunner{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := certstore.CommandRunner{Env: []string{"PFX_PASS=changeit"}}
+	out, err := runner.Run("openssl", "pkcs12", "-in", path, "-nokeys", "-passin", "env:PFX_PASS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), "BEGIN CERTIFICATE"); n != 2 {
+		t.Errorf("expected the certificate and root in the PKCS#12 file, found %d certificates", n)
+	}
+}
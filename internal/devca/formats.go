@@ -0,0 +1,85 @@
+package devca
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/pkcs12"
+)
+
+// Output formats for issued certificates
+const (
+	FormatPEM = "pem" // certificate and key files
+	FormatPFX = "pfx" // PKCS#12 file with the key, certificate and root
+	FormatJKS = "jks" // Java keystore with the same entry
+)
+
+// Formats lists the supported output formats
+var Formats = []string{FormatPEM, FormatPFX, FormatJKS}
+
+// WritePEM writes the leaf's certificate and, with mode 0600, its key
+func (l *Leaf) WritePEM(certPath, keyPath string) error {
+	if err := writeKey(keyPath, l.Key); err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: l.Certificate.Raw})
+	if err := atomicfile.WriteFile(certPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
+
+// WritePKCS12 writes the leaf's key, certificate and the root to a PKCS#12
+// (.pfx/.p12) file protected by password
+func (l *Leaf) WritePKCS12(root *x509.Certificate, path, password string) error {
+	data, err := l.encodePKCS12(root, password)
+	if err != nil {
+		return err
+	}
+	return writePrivate(path, data)
+}
+
+// WriteJKS writes the leaf's key, certificate and the root to a Java
+// keystore protected by password, using keytool
+func (l *Leaf) WriteJKS(runner certstore.CommandRunner, root *x509.Certificate, path, password string) error {
+	data, err := l.encodePKCS12(root, password)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp("", "dev-ca-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	p12, jks := filepath.Join(tmp, "keystore.p12"), filepath.Join(tmp, "keystore.jks")
+	if err := atomicfile.WriteFile(p12, data, 0600); err != nil {
+		return err
+	}
+	runner.Env = append(append([]string{}, runner.Env...), pkcs12.PasswordEnv+"="+password)
+	if _, err := runner.Run("keytool", "-importkeystore", "-noprompt",
+		"-srckeystore", p12, "-srcstoretype", "PKCS12", "-srcstorepass:env", pkcs12.PasswordEnv,
+		"-destkeystore", jks, "-deststoretype", "JKS", "-deststorepass:env", pkcs12.PasswordEnv); err != nil {
+		return err
+	}
+	if data, err = os.ReadFile(jks); err != nil {
+		return err
+	}
+	return writePrivate(path, data)
+}
+
+func (l *Leaf) encodePKCS12(root *x509.Certificate, password string) ([]byte, error) {
+	return pkcs12.Encode(l.Key, []*x509.Certificate{l.Certificate, root}, l.Certificate.Subject.CommonName, password)
+}
+
+// writePrivate writes a file holding a key with mode 0600
+func writePrivate(path string, data []byte) error {
+	if err := atomicfile.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package devca
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// issuedFile records the certificates issued by the CA, for renewal
+const issuedFile = "issued.json"
+
+// Request describes a certificate to issue and where to write it
+type Request struct {
+	Names    []string `json:"names"`     // the first is the subject common name
+	Format   string   `json:"format"`    // pem, pfx or jks
+	CertFile string   `json:"cert_file"` // the certificate, or the PKCS#12 or JKS file
+	KeyFile  string   `json:"key_file,omitempty"`
+	// Password protects pfx and jks output. It is kept with the record in
+	// the CA's private directory so renewals can reuse it.
+	Password string `json:"password,omitempty"`
+	// Hook is run, without a shell, after the certificate is renewed,
+	// e.g. to reload the server using it
+	Hook []string `json:"hook,omitempty"`
+}
+
+// Issued is a certificate the CA issued, keyed by its output file
+type Issued struct {
+	Request
+	Fingerprint     string    `json:"fingerprint"`
+	RootFingerprint string    `json:"root_fingerprint"`
+	IssuedAt        time.Time `json:"issued_at"`
+	NotAfter        time.Time `json:"not_after"`
+}
+
+// Due reports whether the certificate expires within before, or was issued
+// by a root other than the current one
+func (i Issued) Due(root string, before time.Duration) bool {
+	return i.RootFingerprint != root || time.Until(i.NotAfter) < before
+}
+
+// IssueTo issues a certificate for req.Names, writes it in req.Format and
+// records it for renewal. runner runs keytool for jks.
+func (ca *CA) IssueTo(req Request, runner certstore.CommandRunner) (*Issued, error) {
+	if !slices.Contains(Formats, req.Format) {
+		return nil, fmt.Errorf("unsupported format %q (expected pem, pfx or jks)", req.Format)
+	}
+	if req.Format == FormatPEM && req.KeyFile == "" {
+		return nil, fmt.Errorf("pem output needs a key file")
+	}
+	var err error
+	if req.CertFile, err = filepath.Abs(req.CertFile); err != nil {
+		return nil, err
+	}
+	if req.KeyFile != "" {
+		if req.KeyFile, err = filepath.Abs(req.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	leaf, err := ca.Issue(req.Names)
+	if err != nil {
+		return nil, err
+	}
+	switch req.Format {
+	case FormatPEM:
+		err = leaf.WritePEM(req.CertFile, req.KeyFile)
+	case FormatPFX:
+		err = leaf.WritePKCS12(ca.cert, req.CertFile, req.Password)
+	case FormatJKS:
+		err = leaf.WriteJKS(runner, ca.cert, req.CertFile, req.Password)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	issued := Issued{
+		Request:         req,
+		Fingerprint:     cert.GetCertificateFingerprint(leaf.Certificate),
+		RootFingerprint: cert.GetCertificateFingerprint(ca.cert),
+		IssuedAt:        time.Now().UTC(),
+		NotAfter:        leaf.Certificate.NotAfter,
+	}
+	records, err := ca.Issued()
+	if err != nil {
+		return nil, err
+	}
+	records = slices.DeleteFunc(records, func(r Issued) bool { return r.CertFile == req.CertFile })
+	records = append(records, issued)
+	if err := ca.saveIssued(records); err != nil {
+		return nil, err
+	}
+	return &issued, nil
+}
+
+// Issued returns the recorded certificates, ordered by expiry
+func (ca *CA) Issued() ([]Issued, error) {
+	data, err := os.ReadFile(filepath.Join(ca.dir, issuedFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issued certificates: %w", err)
+	}
+	var records []Issued
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", issuedFile, err)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].NotAfter.Before(records[j].NotAfter) })
+	return records, nil
+}
+
+func (ca *CA) saveIssued(records []Issued) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(filepath.Join(ca.dir, issuedFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write issued certificates: %w", err)
+	}
+	return nil
+}
+
+// RenewResult is the outcome of renewing one recorded certificate
+type RenewResult struct {
+	Issued Issued
+	Err    error // issuing or running the hook failed
+}
+
+// Renew reissues every recorded certificate that is due, or all of them
+// with force, to the same files, then runs each one's hook. A failure is
+// reported in its result and doesn't stop the others.
+func (ca *CA) Renew(before time.Duration, force bool, runner certstore.CommandRunner) ([]RenewResult, error) {
+	records, err := ca.Issued()
+	if err != nil {
+		return nil, err
+	}
+	root := cert.GetCertificateFingerprint(ca.cert)
+	var results []RenewResult
+	for _, r := range records {
+		if !force && !r.Due(root, before) {
+			continue
+		}
+		issued, err := ca.IssueTo(r.Request, runner)
+		if err != nil {
+			results = append(results, RenewResult{Issued: r, Err: err})
+			continue
+		}
+		if len(r.Hook) > 0 {
+			if _, err := runner.Run(r.Hook[0], r.Hook[1:]...); err != nil {
+				results = append(results, RenewResult{Issued: *issued, Err: fmt.Errorf("renew hook: %w", err)})
+				continue
+			}
+		}
+		results = append(results, RenewResult{Issued: *issued})
+	}
+	return results, nil
+}
@@ -0,0 +1,73 @@
+package facts
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// appProbes returns the install checks for well-known applications on goos
+func appProbes(goos string) map[string]func() bool {
+	switch goos {
+	case "windows":
+		programFiles := os.Getenv("ProgramFiles")
+		programFilesX86 := os.Getenv("ProgramFiles(x86)")
+		windir := os.Getenv("windir")
+		return map[string]func() bool{
+			"iis": exists(filepath.Join(windir, `System32\inetsrv\w3wp.exe`)),
+			"firefox": exists(filepath.Join(programFiles, `Mozilla Firefox\firefox.exe`),
+				filepath.Join(programFilesX86, `Mozilla Firefox\firefox.exe`)),
+			"chrome": exists(filepath.Join(programFiles, `Google\Chrome\Application\chrome.exe`),
+				filepath.Join(programFilesX86, `Google\Chrome\Application\chrome.exe`)),
+			"java":   onPath("java"),
+			"docker": onPath("docker"),
+		}
+	case "darwin":
+		return map[string]func() bool{
+			"firefox": exists("/Applications/Firefox.app"),
+			"chrome":  exists("/Applications/Google Chrome.app"),
+			"java":    exists("/Library/Java/JavaVirtualMachines"),
+			"docker":  either(exists("/Applications/Docker.app"), onPath("docker")),
+		}
+	default:
+		return map[string]func() bool{
+			"firefox": either(onPath("firefox"), exists("/usr/lib/firefox", "/usr/lib64/firefox", "/snap/bin/firefox")),
+			"chrome":  onPath("google-chrome", "google-chrome-stable", "chromium", "chromium-browser"),
+			"java":    either(onPath("java"), exists("/usr/lib/jvm")),
+			"docker":  onPath("docker", "podman"),
+		}
+	}
+}
+
+func exists(paths ...string) func() bool {
+	return func() bool {
+		for _, p := range paths {
+			if _, err := os.Stat(p); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func onPath(commands ...string) func() bool {
+	return func() bool {
+		for _, c := range commands {
+			if _, err := exec.LookPath(c); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func either(probes ...func() bool) func() bool {
+	return func() bool {
+		for _, probe := range probes {
+			if probe() {
+				return true
+			}
+		}
+		return false
+	}
+}
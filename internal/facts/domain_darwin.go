@@ -0,0 +1,24 @@
+//go:build darwin
+
+package facts
+
+import (
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// joinedDomain reads the Active Directory domain from dsconfigad
+func joinedDomain() string {
+	runner := certstore.CommandRunner{Timeout: probeTimeout}
+	out, err := runner.Run("dsconfigad", "-show")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == "Active Directory Domain" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
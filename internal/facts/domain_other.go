@@ -0,0 +1,23 @@
+//go:build !windows && !darwin
+
+package facts
+
+import (
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// joinedDomain returns the first realm joined with realmd (SSSD or Winbind)
+func joinedDomain() string {
+	runner := certstore.CommandRunner{Timeout: probeTimeout}
+	out, err := runner.Run("realm", "list", "--name-only")
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
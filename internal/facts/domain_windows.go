@@ -0,0 +1,23 @@
+//go:build windows
+
+package facts
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// joinedDomain asks the workstation service which domain the host is in
+func joinedDomain() string {
+	var name *uint16
+	var status uint32
+	if err := windows.NetGetJoinInformation(nil, &name, &status); err != nil {
+		return ""
+	}
+	defer windows.NetApiBufferFree((*byte)(unsafe.Pointer(name)))
+	if status != windows.NetSetupDomainName {
+		return ""
+	}
+	return windows.UTF16PtrToString(name)
+}
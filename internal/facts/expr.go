@@ -0,0 +1,284 @@
+package facts
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Condition is a compiled when: expression, for example
+//
+//	os == "windows" && installed("iis")
+//	domain_joined && hostname =~ "^web-"
+//	!(distro == "alpine")
+//
+// Operands are fact names (see Names), quoted strings and installed("app").
+// == and != compare case-insensitively, =~ matches a regular expression, and
+// a bare fact is true when it is non-empty.
+type Condition struct {
+	source string
+	root   node
+}
+
+// Compile parses a when: expression
+func Compile(expr string) (*Condition, error) {
+	p := &parser{tokens: tokenize(expr)}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", expr, err)
+	}
+	return &Condition{source: expr, root: root}, nil
+}
+
+// Eval reports whether the condition holds for f
+func (c *Condition) Eval(f *Facts) bool {
+	return truthy(c.root.eval(f))
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
+
+type node interface {
+	eval(f *Facts) interface{}
+}
+
+type literal string
+
+func (l literal) eval(*Facts) interface{} { return string(l) }
+
+type fact string
+
+func (n fact) eval(f *Facts) interface{} { return f.value(string(n)) }
+
+type installed string
+
+func (n installed) eval(f *Facts) interface{} { return f.Installed(string(n)) }
+
+type not struct{ operand node }
+
+func (n not) eval(f *Facts) interface{} { return !truthy(n.operand.eval(f)) }
+
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (n logical) eval(f *Facts) interface{} {
+	if n.and {
+		return truthy(n.left.eval(f)) && truthy(n.right.eval(f))
+	}
+	return truthy(n.left.eval(f)) || truthy(n.right.eval(f))
+}
+
+type comparison struct {
+	negate      bool
+	left, right node
+}
+
+func (n comparison) eval(f *Facts) interface{} {
+	equal := strings.EqualFold(text(n.left.eval(f)), text(n.right.eval(f)))
+	return equal != n.negate
+}
+
+type match struct {
+	left node
+	re   *regexp.Regexp
+}
+
+func (n match) eval(f *Facts) interface{} { return n.re.MatchString(text(n.left.eval(f))) }
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != "" && !strings.EqualFold(v, "false")
+	}
+	return false
+}
+
+func text(v interface{}) string {
+	if b, ok := v.(bool); ok {
+		if b {
+			return "true"
+		}
+		return "false"
+	}
+	s, _ := v.(string)
+	return s
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokOp
+	tokInvalid
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var operators = []string{"&&", "||", "==", "!=", "=~", "!", "(", ")"}
+
+func tokenize(expr string) []token {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		r := rune(expr[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			end := strings.IndexByte(expr[i+1:], expr[i])
+			if end < 0 {
+				return append(tokens, token{tokInvalid, expr[i:]})
+			}
+			tokens = append(tokens, token{tokString, expr[i+1 : i+1+end]})
+			i += end + 2
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(expr) && (unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i])) || expr[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, expr[start:i]})
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return append(tokens, token{tokInvalid, expr[i:]})
+			}
+			tokens = append(tokens, token{tokOp, op})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF})
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var right node
+		if right, err = p.parseAnd(); err == nil {
+			left = logical{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.accept("&&") {
+		var right node
+		if right, err = p.parseUnary(); err == nil {
+			left = logical{and: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		return not{operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.accept("=="), p.accept("!="):
+		negate := p.tokens[p.pos-1].text == "!="
+		right, err := p.parsePrimary()
+		return comparison{negate: negate, left: left, right: right}, err
+	case p.accept("=~"):
+		t := p.next()
+		if t.kind != tokString {
+			return nil, fmt.Errorf("=~ needs a quoted regular expression")
+		}
+		re, err := regexp.Compile(t.text)
+		if err != nil {
+			return nil, err
+		}
+		return match{left: left, re: re}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literal(t.text), nil
+	case tokIdent:
+		if t.text == "installed" {
+			if !p.accept("(") {
+				return nil, fmt.Errorf("installed needs an application name, e.g. installed(\"iis\")")
+			}
+			name := p.next()
+			if name.kind != tokString || !p.accept(")") {
+				return nil, fmt.Errorf("installed needs an application name, e.g. installed(\"iis\")")
+			}
+			return installed(strings.ToLower(name.text)), nil
+		}
+		for _, known := range Names() {
+			if t.text == known {
+				return fact(t.text), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown fact %q (expected one of %s)", t.text, strings.Join(Names(), ", "))
+	case tokOp:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+			if err == nil && !p.accept(")") {
+				err = fmt.Errorf("missing )")
+			}
+			return inner, err
+		}
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
@@ -0,0 +1,59 @@
+package facts
+
+import "testing"
+
+func testFacts() *Facts {
+	return &Facts{
+		Hostname: "WEB-01",
+		OS:       "windows",
+		Arch:     "amd64",
+		Domain:   "corp.example.com",
+		apps:     make(map[string]bool),
+		probes: map[string]func() bool{
+			"iis":     func() bool { return true },
+			"firefox": func() bool { return false },
+		},
+	}
+}
+
+func TestConditions(t *testing.T) {
+	tests := map[string]bool{
+		`os == "windows" && installed("iis")`:                true,
+		`os == "Windows"`:                                    true,
+		`installed("firefox")`:                               false,
+		`!installed("firefox")`:                              true,
+		`domain_joined && hostname =~ "^(?i)web-"`:           true,
+		`os != "windows" || domain == "corp.example.com"`:    true,
+		`(os == "linux" || os == "darwin") && domain_joined`: false,
+		`distro`:                  false,
+		`domain_joined == "true"`: true,
+	}
+	f := testFacts()
+	for expr, want := range tests {
+		c, err := Compile(expr)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", expr, err)
+			continue
+		}
+		if got := c.Eval(f); got != want {
+			t.Errorf("%s = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		`hostnme == "web"`,
+		`os ==`,
+		`installed(iis)`,
+		`(os == "linux"`,
+		`os == "linux" extra`,
+		`hostname =~ "("`,
+		`os = "linux"`,
+		`os == "linux`,
+	} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%s): expected an error", expr)
+		}
+	}
+}
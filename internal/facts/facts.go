@@ -0,0 +1,111 @@
+// Package facts gathers facts about the host (name, OS release, directory
+// domain, installed applications) for the when: conditions of stores and
+// sources.
+package facts
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/platform"
+)
+
+// probeTimeout bounds the commands run to gather facts, such as realm list
+const probeTimeout = 30 * time.Second
+
+// Facts describes the host. Installed applications are probed on first use.
+type Facts struct {
+	Hostname      string
+	OS            string
+	Arch          string
+	Distro        string
+	DistroLike    []string
+	DistroVersion string
+	Domain        string // directory (Active Directory/Kerberos) domain, empty when not joined
+
+	mu     sync.Mutex
+	apps   map[string]bool
+	probes map[string]func() bool
+}
+
+// Gather collects the facts for this host
+func Gather() *Facts {
+	host := platform.CurrentHost()
+	hostname, _ := os.Hostname()
+	return &Facts{
+		Hostname:      hostname,
+		OS:            host.OS,
+		Arch:          host.Arch,
+		Distro:        host.Distro,
+		DistroLike:    host.DistroLike,
+		DistroVersion: host.DistroVersion,
+		Domain:        joinedDomain(),
+		apps:          make(map[string]bool),
+		probes:        appProbes(runtime.GOOS),
+	}
+}
+
+// Installed reports whether an application is installed. Known applications
+// (see Applications) are found by their usual install locations; any other
+// name is looked up as a command on the PATH.
+func (f *Facts) Installed(app string) bool {
+	app = strings.ToLower(app)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if installed, ok := f.apps[app]; ok {
+		return installed
+	}
+
+	var installed bool
+	if probe, ok := f.probes[app]; ok {
+		installed = probe()
+	} else {
+		_, err := exec.LookPath(app)
+		installed = err == nil
+	}
+	f.apps[app] = installed
+	return installed
+}
+
+// Applications returns the names of the applications with specific probes
+func (f *Facts) Applications() []string {
+	names := make([]string, 0, len(f.probes))
+	for name := range f.probes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// value returns a named fact for expressions
+func (f *Facts) value(name string) interface{} {
+	switch name {
+	case "hostname":
+		return f.Hostname
+	case "os":
+		return f.OS
+	case "arch":
+		return f.Arch
+	case "distro":
+		return f.Distro
+	case "distro_like":
+		return strings.Join(f.DistroLike, " ")
+	case "distro_version":
+		return f.DistroVersion
+	case "domain":
+		return f.Domain
+	case "domain_joined":
+		return f.Domain != ""
+	}
+	return nil
+}
+
+// Names returns the fact names usable in expressions
+func Names() []string {
+	return []string{"hostname", "os", "arch", "distro", "distro_like", "distro_version", "domain", "domain_joined"}
+}
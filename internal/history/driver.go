@@ -0,0 +1,8 @@
+//go:build !no_sqlite
+
+package history
+
+import _ "modernc.org/sqlite" // pure Go driver, registered as "sqlite"
+
+// driverIncluded is false in builds that leave SQLite out
+const driverIncluded = true
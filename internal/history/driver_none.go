@@ -0,0 +1,6 @@
+//go:build no_sqlite
+
+package history
+
+// driverIncluded is false in builds that leave SQLite out
+const driverIncluded = false
@@ -0,0 +1,272 @@
+// Package history keeps a SQLite database of update runs and the
+// certificates each one installed, so questions such as "when was this root
+// first installed on this host" can be answered without reading old logs.
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Outcomes recorded for a run
+const (
+	OutcomeSuccess = "success"
+	OutcomePartial = "partial" // completed, but at least one store failed
+	OutcomeFailure = "failure"
+)
+
+// Run is one recorded update run
+type Run struct {
+	ID         int64
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Outcome    string
+	Error      string
+	Fetched    int
+	Stores     []StoreResult
+}
+
+// StoreResult is the outcome of a run for one store
+type StoreResult struct {
+	Store     string
+	Added     int
+	Skipped   int
+	Failed    int
+	Error     string
+	Installed []Install
+}
+
+// Install is a certificate added to a store during a run
+type Install struct {
+	Store       string
+	Fingerprint string
+	Subject     string
+	Source      string
+	RunID       int64
+	InstalledAt time.Time
+}
+
+// Filter selects runs; zero fields match everything
+type Filter struct {
+	Store   string // runs that touched this store
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at  INTEGER NOT NULL,
+	finished_at INTEGER NOT NULL,
+	outcome     TEXT NOT NULL,
+	error       TEXT NOT NULL DEFAULT '',
+	fetched     INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS store_results (
+	run_id  INTEGER NOT NULL REFERENCES runs(id),
+	store   TEXT NOT NULL,
+	added   INTEGER NOT NULL,
+	skipped INTEGER NOT NULL,
+	failed  INTEGER NOT NULL,
+	error   TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS installs (
+	run_id       INTEGER NOT NULL REFERENCES runs(id),
+	store        TEXT NOT NULL,
+	fingerprint  TEXT NOT NULL,
+	subject      TEXT NOT NULL,
+	source       TEXT NOT NULL,
+	installed_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS runs_started ON runs(started_at);
+CREATE INDEX IF NOT EXISTS store_results_store ON store_results(store);
+CREATE INDEX IF NOT EXISTS installs_fingerprint ON installs(fingerprint);
+`
+
+// DB is an open history database
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it and its schema if needed
+func Open(path string) (*DB, error) {
+	if !driverIncluded {
+		return nil, errors.New(`this build leaves out SQLite (no_sqlite); set settings.history_database to ""`)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	// One writer at a time; a busy timeout covers runs that overlap a query
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000; PRAGMA journal_mode = WAL;" + schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database %s: %w", path, err)
+	}
+	return &DB{db: db}, nil
+}
+
+// Close closes the database
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Record stores a run with its store results and installs, returning its ID
+func (d *DB) Record(run *Run) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record run: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO runs (started_at, finished_at, outcome, error, fetched) VALUES (?, ?, ?, ?, ?)",
+		run.StartedAt.UnixMilli(), run.FinishedAt.UnixMilli(), run.Outcome, run.Error, run.Fetched)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record run: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record run: %w", err)
+	}
+
+	for _, sr := range run.Stores {
+		if _, err := tx.Exec("INSERT INTO store_results (run_id, store, added, skipped, failed, error) VALUES (?, ?, ?, ?, ?, ?)",
+			id, sr.Store, sr.Added, sr.Skipped, sr.Failed, sr.Error); err != nil {
+			return 0, fmt.Errorf("failed to record store result: %w", err)
+		}
+		for _, in := range sr.Installed {
+			installedAt := in.InstalledAt
+			if installedAt.IsZero() {
+				installedAt = run.FinishedAt
+			}
+			if _, err := tx.Exec("INSERT INTO installs (run_id, store, fingerprint, subject, source, installed_at) VALUES (?, ?, ?, ?, ?, ?)",
+				id, sr.Store, strings.ToLower(in.Fingerprint), in.Subject, in.Source, installedAt.UnixMilli()); err != nil {
+				return 0, fmt.Errorf("failed to record install: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to record run: %w", err)
+	}
+	run.ID = id
+	return id, nil
+}
+
+// Runs returns the runs matching filter, newest first, with their store results
+func (d *DB) Runs(filter Filter) ([]*Run, error) {
+	query := "SELECT id, started_at, finished_at, outcome, error, fetched FROM runs WHERE 1=1"
+	var args []interface{}
+	if filter.Store != "" {
+		query += " AND id IN (SELECT run_id FROM store_results WHERE store = ?)"
+		args = append(args, filter.Store)
+	}
+	if filter.Outcome != "" {
+		query += " AND outcome = ?"
+		args = append(args, filter.Outcome)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND started_at >= ?"
+		args = append(args, filter.Since.UnixMilli())
+	}
+	if !filter.Until.IsZero() {
+		query += " AND started_at <= ?"
+		args = append(args, filter.Until.UnixMilli())
+	}
+	query += " ORDER BY started_at DESC, id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*Run
+	byID := make(map[int64]*Run)
+	for rows.Next() {
+		var r Run
+		var started, finished int64
+		if err := rows.Scan(&r.ID, &started, &finished, &r.Outcome, &r.Error, &r.Fetched); err != nil {
+			return nil, err
+		}
+		r.StartedAt, r.FinishedAt = time.UnixMilli(started), time.UnixMilli(finished)
+		runs = append(runs, &r)
+		byID[r.ID] = &r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(runs) == 0 {
+		return nil, nil
+	}
+	ids := make([]interface{}, len(runs))
+	for i, r := range runs {
+		ids[i] = r.ID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	results, err := d.db.Query("SELECT run_id, store, added, skipped, failed, error FROM store_results WHERE run_id IN ("+placeholders+") ORDER BY rowid", ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query store results: %w", err)
+	}
+	defer results.Close()
+	for results.Next() {
+		var runID int64
+		var sr StoreResult
+		if err := results.Scan(&runID, &sr.Store, &sr.Added, &sr.Skipped, &sr.Failed, &sr.Error); err != nil {
+			return nil, err
+		}
+		if r, ok := byID[runID]; ok {
+			r.Stores = append(r.Stores, sr)
+		}
+	}
+	return runs, results.Err()
+}
+
+// Installs returns every recorded install of certificates whose fingerprint
+// starts with prefix, oldest first, optionally limited to one store. The
+// first entry per store is when the certificate was first installed there.
+func (d *DB) Installs(prefix, store string) ([]Install, error) {
+	query := "SELECT run_id, store, fingerprint, subject, source, installed_at FROM installs WHERE fingerprint LIKE ? ESCAPE '\\'"
+	args := []interface{}{escapeLike(strings.ToLower(strings.ReplaceAll(prefix, ":", ""))) + "%"}
+	if store != "" {
+		query += " AND store = ?"
+		args = append(args, store)
+	}
+	query += " ORDER BY installed_at, rowid"
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query installs: %w", err)
+	}
+	defer rows.Close()
+
+	var installs []Install
+	for rows.Next() {
+		var in Install
+		var at int64
+		if err := rows.Scan(&in.RunID, &in.Store, &in.Fingerprint, &in.Subject, &in.Source, &at); err != nil {
+			return nil, err
+		}
+		in.InstalledAt = time.UnixMilli(at)
+		installs = append(installs, in)
+	}
+	return installs, rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
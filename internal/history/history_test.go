@@ -0,0 +1,62 @@
+//go:build !no_sqlite
+
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordAndQuery(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	day := func(n int) time.Time { return time.Date(2024, 3, n, 12, 0, 0, 0, time.UTC) }
+	runs := []*Run{
+		{StartedAt: day(1), FinishedAt: day(1), Outcome: OutcomeSuccess, Fetched: 2, Stores: []StoreResult{
+			{Store: "system", Added: 1, Installed: []Install{{Fingerprint: "ABCDEF01", Subject: "CN=Corp Root", Source: "corp"}}},
+		}},
+		{StartedAt: day(2), FinishedAt: day(2), Outcome: OutcomePartial, Stores: []StoreResult{
+			{Store: "java", Added: 1, Failed: 1, Installed: []Install{{Fingerprint: "abcdef01", Subject: "CN=Corp Root", Source: "corp"}}},
+			{Store: "system", Skipped: 1},
+		}},
+		{StartedAt: day(3), FinishedAt: day(3), Outcome: OutcomeFailure, Error: "no sources"},
+	}
+	for _, r := range runs {
+		if _, err := db.Record(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := db.Runs(Filter{})
+	if err != nil || len(got) != 3 || got[0].Outcome != OutcomeFailure || len(got[1].Stores) != 2 {
+		t.Fatalf("Runs() = %+v, %v", got, err)
+	}
+	if got, _ := db.Runs(Filter{Store: "java"}); len(got) != 1 || got[0].ID != runs[1].ID {
+		t.Errorf("store filter returned %+v", got)
+	}
+	if got, _ := db.Runs(Filter{Since: day(2), Until: day(2)}); len(got) != 1 || got[0].Outcome != OutcomePartial {
+		t.Errorf("time filter returned %+v", got)
+	}
+	if got, _ := db.Runs(Filter{Limit: 1}); len(got) != 1 {
+		t.Errorf("limit returned %d runs", len(got))
+	}
+
+	installs, err := db.Installs("ABCD", "")
+	if err != nil || len(installs) != 2 {
+		t.Fatalf("Installs() = %+v, %v", installs, err)
+	}
+	if installs[0].Store != "system" || !installs[0].InstalledAt.Equal(day(1)) || installs[0].RunID != runs[0].ID {
+		t.Errorf("first install = %+v", installs[0])
+	}
+	if got, _ := db.Installs("abcd", "java"); len(got) != 1 || got[0].Store != "java" {
+		t.Errorf("store-limited installs = %+v", got)
+	}
+	if got, _ := db.Installs("ab_d", ""); len(got) != 0 {
+		t.Errorf("LIKE wildcards not escaped: %+v", got)
+	}
+}
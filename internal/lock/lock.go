@@ -0,0 +1,160 @@
+// Package lock keeps more than one instance from changing stores at the same
+// time. An instance holds an advisory lock on a lock file, which may sit on a
+// shared filesystem such as NFS, and writes its identity into the file so
+// that others can report who holds it and the holder can detect losing it.
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrHeld is returned when another instance holds the lock
+var ErrHeld = errors.New("another instance holds the update lock")
+
+// ErrLost is returned by Verify when the lock file names another instance
+var ErrLost = errors.New("update lock is no longer held by this instance")
+
+// Holder identifies the instance holding a lock
+type Holder struct {
+	InstanceID string    `json:"instance_id"`
+	Hostname   string    `json:"hostname"`
+	PID        int       `json:"pid"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+func (h Holder) String() string {
+	return fmt.Sprintf("%s (pid %d on %s since %s)", h.InstanceID, h.PID, h.Hostname, h.AcquiredAt.Local().Format(time.RFC3339))
+}
+
+// HeldError reports the instance holding the lock; it matches ErrHeld
+type HeldError struct {
+	Path   string
+	Holder *Holder // nil when the lock file couldn't be read
+}
+
+func (e *HeldError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%v (%s)", ErrHeld, e.Path)
+	}
+	return fmt.Sprintf("%v: %s", ErrHeld, e.Holder)
+}
+
+func (e *HeldError) Is(target error) bool {
+	return target == ErrHeld
+}
+
+// Lock is a held update lock
+type Lock struct {
+	file   *os.File
+	holder Holder
+}
+
+// DefaultInstanceID identifies this process when no instance ID is configured
+func DefaultInstanceID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// Acquire takes the lock at path for instanceID without waiting. If another
+// instance holds it, the error is a *HeldError naming that instance.
+func Acquire(path, instanceID string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	locked, err := tryLock(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	if !locked {
+		holder, _ := readHolder(f)
+		f.Close()
+		return nil, &HeldError{Path: path, Holder: holder}
+	}
+
+	hostname, _ := os.Hostname()
+	l := &Lock{file: f, holder: Holder{
+		InstanceID: instanceID,
+		Hostname:   hostname,
+		PID:        os.Getpid(),
+		AcquiredAt: time.Now().UTC(),
+	}}
+	if err := l.writeHolder(); err != nil {
+		l.Release()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Verify checks that the lock file still names this instance. Advisory locks
+// on network filesystems can be lost, for example when the server restarts,
+// and another instance may then have taken over.
+func (l *Lock) Verify() error {
+	holder, err := readHolder(l.file)
+	if err != nil {
+		return fmt.Errorf("failed to read lock file: %w", err)
+	}
+	if holder == nil || holder.InstanceID != l.holder.InstanceID || holder.PID != l.holder.PID || holder.Hostname != l.holder.Hostname {
+		if holder != nil {
+			return fmt.Errorf("%w: now held by %s", ErrLost, holder)
+		}
+		return ErrLost
+	}
+	return nil
+}
+
+// Release clears the holder and unlocks. It is safe to call on a nil Lock.
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	_ = l.file.Truncate(0)
+	err := unlock(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+func (l *Lock) writeHolder() error {
+	data, err := json.Marshal(l.holder)
+	if err != nil {
+		return err
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	if _, err := l.file.WriteAt(append(data, '\n'), 0); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return l.file.Sync()
+}
+
+// readHolder reads the holder through f. Closing another descriptor for the
+// file would drop a POSIX lock this process holds, so the file isn't reopened.
+func readHolder(f *os.File) (*Holder, error) {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var h Holder
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("invalid lock file: %w", err)
+	}
+	return &h, nil
+}
@@ -0,0 +1,91 @@
+package lock
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestHelperHolder holds the lock in a separate process, since POSIX locks
+// don't conflict within one process
+func TestHelperHolder(t *testing.T) {
+	path := os.Getenv("LOCK_HELPER_PATH")
+	if path == "" {
+		t.Skip("helper process")
+	}
+	l, err := Acquire(path, "helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout.WriteString("locked\n")
+	// Hold the lock until the parent closes stdin
+	_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+	l.Release()
+}
+
+func TestAcquireHeldByAnotherInstance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "update.lock")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperHolder$")
+	cmd.Env = append(os.Environ(), "LOCK_HELPER_PATH="+path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		t.Fatalf("helper did not take the lock: %q, %v", line, err)
+	}
+
+	_, err = Acquire(path, "second")
+	var held *HeldError
+	if !errors.Is(err, ErrHeld) || !errors.As(err, &held) {
+		t.Fatalf("expected ErrHeld, got %v", err)
+	}
+	if held.Holder == nil || held.Holder.InstanceID != "helper" || held.Holder.PID != cmd.Process.Pid {
+		t.Fatalf("expected the helper to be named as holder, got %+v", held.Holder)
+	}
+
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("helper: %v", err)
+	}
+
+	l, err := Acquire(path, "second")
+	if err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+	defer l.Release()
+	if err := l.Verify(); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+}
+
+func TestVerifyDetectsTakeover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "update.lock")
+	l, err := Acquire(path, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+
+	// Another instance took over after the lock was lost
+	if err := l.file.Truncate(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.file.WriteAt([]byte(`{"instance_id":"other","hostname":"nfs-peer","pid":1}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Verify(); !errors.Is(err, ErrLost) {
+		t.Fatalf("expected ErrLost, got %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+// Package maintenance implements maintenance windows: times at which stores
+// may be changed, given as a cron schedule of window starts with a duration
+// or as a weekly window on some days between two times of day.
+package maintenance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec describes a window. Either Cron and Duration, or Days with Start and
+// End, are set.
+type Spec struct {
+	Cron     string   // start times, "minute hour day-of-month month day-of-week"
+	Duration string   // how long a cron window stays open, e.g. "2h"
+	Days     []string // e.g. "sat"; every day when empty
+	Start    string   // "22:00"
+	End      string   // "04:00"; an end before the start is on the next day
+	Timezone string   // IANA zone; local time when empty
+}
+
+// Window is a parsed maintenance window
+type Window struct {
+	cron     *cron
+	duration time.Duration
+	days     map[time.Weekday]bool
+	start    int // minutes after midnight
+	end      int
+	loc      *time.Location
+}
+
+// maxDuration bounds windows so that Open and Next scan at most a week
+const maxDuration = 7 * 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// New parses a window
+func New(spec Spec) (*Window, error) {
+	w := &Window{loc: time.Local}
+	if spec.Timezone != "" {
+		loc, err := time.LoadLocation(spec.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", spec.Timezone)
+		}
+		w.loc = loc
+	}
+
+	weekly := len(spec.Days) > 0 || spec.Start != "" || spec.End != ""
+	switch {
+	case spec.Cron != "" && weekly:
+		return nil, fmt.Errorf("set either cron or days, start and end, not both")
+	case spec.Cron != "":
+		c, err := parseCron(spec.Cron)
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(spec.Duration)
+		if err != nil || d <= 0 || d > maxDuration {
+			return nil, fmt.Errorf("cron windows need a duration between 1m and 168h")
+		}
+		w.cron, w.duration = c, d
+	case weekly:
+		w.days = make(map[time.Weekday]bool)
+		for _, day := range spec.Days {
+			wd, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+			if !ok {
+				return nil, fmt.Errorf("unknown day %q", day)
+			}
+			w.days[wd] = true
+		}
+		if len(w.days) == 0 {
+			for _, wd := range weekdays {
+				w.days[wd] = true
+			}
+		}
+		var err error
+		if w.start, err = parseClock(spec.Start); err != nil {
+			return nil, fmt.Errorf("start: %w", err)
+		}
+		if w.end, err = parseClock(spec.End); err != nil {
+			return nil, fmt.Errorf("end: %w", err)
+		}
+		if w.start == w.end {
+			return nil, fmt.Errorf("start and end are the same time")
+		}
+	default:
+		return nil, fmt.Errorf("set cron and duration, or days, start and end")
+	}
+	return w, nil
+}
+
+// Open reports whether the window is open at t
+func (w *Window) Open(t time.Time) bool {
+	t = t.In(w.loc)
+	if w.cron != nil {
+		// Open when a window started within the duration before t
+		start := t.Truncate(time.Minute)
+		for s := start; t.Sub(s) < w.duration; s = s.Add(-time.Minute) {
+			if w.cron.matches(s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	// The window runs past midnight: the evening part is on a listed day,
+	// the morning part on the day after one
+	if minute >= w.start {
+		return w.days[t.Weekday()]
+	}
+	return minute < w.end && w.days[(t.Weekday()+6)%7]
+}
+
+// Next returns when a window next starts after t, or the zero time if none
+// starts within a week
+func (w *Window) Next(t time.Time) time.Time {
+	t = t.In(w.loc).Truncate(time.Minute)
+	for m := t.Add(time.Minute); m.Sub(t) <= maxDuration+time.Minute; m = m.Add(time.Minute) {
+		if w.cron != nil && w.cron.matches(m) || w.cron == nil && w.Open(m) && !w.Open(m.Add(-time.Minute)) {
+			return m
+		}
+	}
+	return time.Time{}
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day like 22:00", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// cron is a five field cron schedule
+type cron struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool
+}
+
+func (c *cron) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	// As in cron, when both day fields are restricted either may match
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+func parseCron(expr string) (*cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields (minute hour day month weekday)", expr)
+	}
+	c := &cron{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	for i, f := range []struct {
+		set      *map[int]bool
+		min, max int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.dom, 1, 31}, {&c.month, 1, 12}, {&c.dow, 0, 7}} {
+		if *f.set, err = parseField(fields[i], f.min, f.max); err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+	}
+	// 7 is another name for Sunday
+	if c.dow[7] {
+		c.dow[0] = true
+	}
+	return c, nil
+}
+
+// parseField parses a comma separated list of *, n, a-b, each with an
+// optional /step
+func parseField(field string, lo, hi int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			} else if hasStep {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,78 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronWindow(t *testing.T) {
+	// Weekdays from 02:30 for 90 minutes
+	w, err := New(Spec{Cron: "30 2 * * 1-5", Duration: "90m", Timezone: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	monday := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		at   time.Duration
+		open bool
+	}{
+		{2*time.Hour + 29*time.Minute, false},
+		{2*time.Hour + 30*time.Minute, true},
+		{3*time.Hour + 59*time.Minute, true},
+		{4 * time.Hour, false},
+		{5*24*time.Hour + 3*time.Hour, false}, // Saturday
+	}
+	for _, c := range cases {
+		if got := w.Open(monday.Add(c.at)); got != c.open {
+			t.Errorf("%s: open = %v, want %v", monday.Add(c.at), got, c.open)
+		}
+	}
+	if next := w.Next(monday.Add(5 * 24 * time.Hour)); !next.Equal(monday.Add(7*24*time.Hour + 2*time.Hour + 30*time.Minute)) {
+		t.Errorf("next = %s, want the following Monday 02:30", next)
+	}
+}
+
+func TestWeeklyWindow(t *testing.T) {
+	// Saturday 22:00 until Sunday 04:00
+	w, err := New(Spec{Days: []string{"Sat"}, Start: "22:00", End: "04:00", Timezone: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saturday := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		at   time.Duration
+		open bool
+	}{
+		{21 * time.Hour, false},
+		{22 * time.Hour, true},
+		{27 * time.Hour, true},   // Sunday 03:00
+		{28 * time.Hour, false},  // Sunday 04:00
+		{-21 * time.Hour, false}, // Friday 03:00
+	}
+	for _, c := range cases {
+		if got := w.Open(saturday.Add(c.at)); got != c.open {
+			t.Errorf("%s: open = %v, want %v", saturday.Add(c.at), got, c.open)
+		}
+	}
+	if next := w.Next(saturday.Add(23 * time.Hour)); !next.Equal(saturday.Add(7*24*time.Hour + 22*time.Hour)) {
+		t.Errorf("next = %s, want the following Saturday 22:00", next)
+	}
+}
+
+func TestInvalidWindows(t *testing.T) {
+	for _, spec := range []Spec{
+		{},
+		{Cron: "0 2 * *", Duration: "1h"},
+		{Cron: "0 25 * * *", Duration: "1h"},
+		{Cron: "0 2 * * *"},
+		{Cron: "0 2 * * *", Duration: "1h", Days: []string{"sat"}},
+		{Days: []string{"someday"}, Start: "22:00", End: "04:00"},
+		{Start: "22:00", End: "22:00"},
+		{Start: "25:00", End: "04:00"},
+		{Cron: "0 2 * * *", Duration: "1h", Timezone: "Mars/Olympus"},
+	} {
+		if _, err := New(spec); err == nil {
+			t.Errorf("%+v: expected an error", spec)
+		}
+	}
+}
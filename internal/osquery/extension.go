@@ -0,0 +1,460 @@
+// Package osquery serves tables to osquery as an extension. osquery starts
+// extensions with the path of its extension manager socket; an extension
+// registers its tables there over Thrift, then answers the manager's calls
+// on a socket of its own until osquery goes away.
+package osquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Column types
+const (
+	TypeText    = "TEXT"
+	TypeInteger = "INTEGER"
+	TypeBigInt  = "BIGINT"
+)
+
+// sdkVersion is the extension SDK version this package speaks
+const sdkVersion = "5.0.0"
+
+// Status codes
+const (
+	statusOK    = 0
+	statusError = 1
+)
+
+// Thrift application exception types
+const exceptionUnknownMethod = 1
+
+// Column is a table column
+type Column struct {
+	Name string
+	Type string
+}
+
+// Table is a virtual table. Generate returns its rows, each mapping column
+// names to values; osquery filters them.
+type Table struct {
+	Name     string
+	Columns  []Column
+	Generate func() ([]map[string]string, error)
+}
+
+// routes describes the table's columns to the manager
+func (t *Table) routes() []map[string]string {
+	routes := make([]map[string]string, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		routes = append(routes, map[string]string{"id": "column", "name": c.Name, "type": c.Type, "op": "0"})
+	}
+	return routes
+}
+
+// Extension registers tables with an osquery extension manager
+type Extension struct {
+	Name    string
+	Version string
+	// Socket is the manager's socket, the --socket osquery passes
+	Socket string
+	// Timeout is how long to wait for the manager's socket to appear
+	Timeout time.Duration
+	// Interval is how often the manager is pinged; the extension stops when
+	// a ping fails
+	Interval time.Duration
+	Tables   []Table
+	Verbose  bool
+
+	// generate serializes table generation
+	generate sync.Mutex
+}
+
+// Run registers the tables and serves them until the manager goes away or
+// ctx is done
+func (e *Extension) Run(ctx context.Context) error {
+	if runtime.GOOS == "windows" {
+		return errors.New("osquery extensions are only supported on Linux and macOS")
+	}
+	manager, err := e.dialManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	uuid, err := e.register(manager)
+	if err != nil {
+		return err
+	}
+	path := e.Socket + "." + strconv.FormatInt(uuid, 10)
+	_ = os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	defer os.Remove(path)
+	defer listener.Close()
+	e.logf("Registered extension %d, serving %s", uuid, path)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go e.serve(conn)
+		}
+	}()
+
+	interval := e.Interval
+	if interval <= 0 {
+		interval = 3 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := e.ping(manager); err != nil {
+				e.logf("Extension manager is gone: %v", err)
+				return nil
+			}
+		}
+	}
+}
+
+func (e *Extension) logf(format string, args ...any) {
+	if e.Verbose {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
+// dialManager connects to the manager, waiting up to Timeout for its socket
+func (e *Extension) dialManager(ctx context.Context) (*client, error) {
+	deadline := time.Now().Add(e.Timeout)
+	for {
+		conn, err := net.Dial("unix", e.Socket)
+		if err == nil {
+			return &client{conn: conn, r: newReader(conn)}, nil
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("failed to connect to the osquery extension manager at %s: %w", e.Socket, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// client calls the manager
+type client struct {
+	conn net.Conn
+	r    *reader
+	seq  int32
+}
+
+func (c *client) Close() error { return c.conn.Close() }
+
+// call sends a call whose arguments args writes and reads the reply's
+// header, leaving its result struct to be read
+func (c *client) call(name string, args func(w *writer)) error {
+	c.seq++
+	var w writer
+	w.messageBegin(name, messageCall, c.seq)
+	if args != nil {
+		args(&w)
+	}
+	w.fieldStop()
+	if _, err := c.conn.Write(w.Bytes()); err != nil {
+		return err
+	}
+	reply, typ, seq, err := c.r.messageBegin()
+	if err != nil {
+		return err
+	}
+	if typ == messageException {
+		msg, _ := readException(c.r)
+		return fmt.Errorf("%s failed: %s", name, msg)
+	}
+	if typ != messageReply || reply != name || seq != c.seq {
+		return fmt.Errorf("unexpected reply %q to %s", reply, name)
+	}
+	return nil
+}
+
+// status reads a result struct whose success field is an ExtensionStatus
+func (c *client) status() (code int32, message string, uuid int64, err error) {
+	for {
+		typ, id, err := c.r.fieldBegin()
+		if err != nil {
+			return 0, "", 0, err
+		}
+		if typ == typeStop {
+			return code, message, uuid, nil
+		}
+		if id != 0 || typ != typeStruct {
+			if err := c.r.skip(typ); err != nil {
+				return 0, "", 0, err
+			}
+			continue
+		}
+		if code, message, uuid, err = readStatus(c.r); err != nil {
+			return 0, "", 0, err
+		}
+	}
+}
+
+// register registers the tables and returns the extension's route UUID
+func (e *Extension) register(c *client) (int64, error) {
+	err := c.call("registerExtension", func(w *writer) {
+		w.fieldBegin(typeStruct, 1)
+		w.fieldBegin(typeString, 1)
+		w.string(e.Name)
+		w.fieldBegin(typeString, 2)
+		w.string(e.Version)
+		w.fieldBegin(typeString, 3)
+		w.string(sdkVersion)
+		w.fieldBegin(typeString, 4)
+		w.string(sdkVersion)
+		w.fieldStop()
+
+		w.fieldBegin(typeMap, 2)
+		w.byte(typeString)
+		w.byte(typeMap)
+		w.i32(1)
+		w.string("table")
+		w.byte(typeString)
+		w.byte(typeList)
+		w.i32(int32(len(e.Tables)))
+		for i := range e.Tables {
+			w.string(e.Tables[i].Name)
+			w.rows(e.Tables[i].routes())
+		}
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to register with the osquery extension manager: %w", err)
+	}
+	code, message, uuid, err := c.status()
+	if err != nil {
+		return 0, fmt.Errorf("failed to register with the osquery extension manager: %w", err)
+	}
+	if code != statusOK {
+		return 0, fmt.Errorf("the osquery extension manager refused the extension: %s", message)
+	}
+	return uuid, nil
+}
+
+// ping checks the manager is still there
+func (e *Extension) ping(c *client) error {
+	_ = c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.call("ping", nil); err != nil {
+		return err
+	}
+	code, message, _, err := c.status()
+	if err != nil {
+		return err
+	}
+	if code != statusOK {
+		return errors.New(message)
+	}
+	return nil
+}
+
+// serve answers the manager's calls on one connection
+func (e *Extension) serve(conn net.Conn) {
+	defer conn.Close()
+	r := newReader(conn)
+	for {
+		name, typ, seq, err := r.messageBegin()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				e.logf("Extension connection failed: %v", err)
+			}
+			return
+		}
+		var w writer
+		switch {
+		case typ != messageCall && typ != messageOneway:
+			e.logf("Unexpected message type %d", typ)
+			return
+		case name == "ping":
+			err = r.skip(typeStruct)
+			w.messageBegin(name, messageReply, seq)
+			writeStatus(&w, 0, statusOK, "OK", 0)
+			w.fieldStop()
+		case name == "call":
+			var registry, item string
+			var request map[string]string
+			if registry, item, request, err = readCallArgs(r); err != nil {
+				break
+			}
+			w.messageBegin(name, messageReply, seq)
+			w.fieldBegin(typeStruct, 0)
+			e.writeResponse(&w, registry, item, request)
+			w.fieldStop()
+		case name == "shutdown":
+			err = r.skip(typeStruct)
+			w.messageBegin(name, messageReply, seq)
+			w.fieldStop()
+		default:
+			err = r.skip(typeStruct)
+			w.messageBegin(name, messageException, seq)
+			w.fieldBegin(typeString, 1)
+			w.string("unknown method " + name)
+			w.fieldBegin(typeI32, 2)
+			w.i32(exceptionUnknownMethod)
+			w.fieldStop()
+		}
+		if err != nil {
+			e.logf("Failed to read %s call: %v", name, err)
+			return
+		}
+		if typ == messageOneway {
+			continue
+		}
+		if _, err := conn.Write(w.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+// writeResponse writes the ExtensionResponse to a plugin call
+func (e *Extension) writeResponse(w *writer, registry, item string, request map[string]string) {
+	rows, err := e.respond(registry, item, request)
+	if err != nil {
+		e.logf("%s %s: %v", registry, item, err)
+		writeStatus(w, 1, statusError, err.Error(), 0)
+		w.fieldBegin(typeList, 2)
+		w.rows(nil)
+		w.fieldStop()
+		return
+	}
+	writeStatus(w, 1, statusOK, "OK", 0)
+	w.fieldBegin(typeList, 2)
+	w.rows(rows)
+	w.fieldStop()
+}
+
+func (e *Extension) respond(registry, item string, request map[string]string) ([]map[string]string, error) {
+	if registry != "table" {
+		return nil, fmt.Errorf("unknown registry %q", registry)
+	}
+	var table *Table
+	for i := range e.Tables {
+		if e.Tables[i].Name == item {
+			table = &e.Tables[i]
+		}
+	}
+	if table == nil {
+		return nil, fmt.Errorf("unknown table %q", item)
+	}
+	switch action := request["action"]; action {
+	case "columns":
+		return table.routes(), nil
+	case "generate":
+		e.generate.Lock()
+		defer e.generate.Unlock()
+		return table.Generate()
+	default:
+		return nil, fmt.Errorf("unsupported table action %q", action)
+	}
+}
+
+// writeStatus writes an ExtensionStatus as field id of the enclosing struct
+func writeStatus(w *writer, id int16, code int32, message string, uuid int64) {
+	w.fieldBegin(typeStruct, id)
+	w.fieldBegin(typeI32, 1)
+	w.i32(code)
+	w.fieldBegin(typeString, 2)
+	w.string(message)
+	w.fieldBegin(typeI64, 3)
+	w.i64(uuid)
+	w.fieldStop()
+}
+
+// readStatus reads the fields of an ExtensionStatus
+func readStatus(r *reader) (code int32, message string, uuid int64, err error) {
+	for {
+		typ, id, err := r.fieldBegin()
+		if err != nil || typ == typeStop {
+			return code, message, uuid, err
+		}
+		switch {
+		case id == 1 && typ == typeI32:
+			code, err = r.i32()
+		case id == 2 && typ == typeString:
+			message, err = r.string()
+		case id == 3 && typ == typeI64:
+			uuid, err = r.i64()
+		default:
+			err = r.skip(typ)
+		}
+		if err != nil {
+			return 0, "", 0, err
+		}
+	}
+}
+
+// readException reads a Thrift application exception's message
+func readException(r *reader) (string, error) {
+	var message string
+	for {
+		typ, id, err := r.fieldBegin()
+		if err != nil || typ == typeStop {
+			return message, err
+		}
+		if id == 1 && typ == typeString {
+			message, err = r.string()
+		} else {
+			err = r.skip(typ)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// readCallArgs reads the arguments of Extension.call
+func readCallArgs(r *reader) (registry, item string, request map[string]string, err error) {
+	for {
+		typ, id, err := r.fieldBegin()
+		if err != nil || typ == typeStop {
+			return registry, item, request, err
+		}
+		switch {
+		case id == 1 && typ == typeString:
+			registry, err = r.string()
+		case id == 2 && typ == typeString:
+			item, err = r.string()
+		case id == 3 && typ == typeMap:
+			request, err = r.stringMap()
+		default:
+			err = r.skip(typ)
+		}
+		if err != nil {
+			return "", "", nil, err
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,253 @@
+//go:build unix
+
+package osquery
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readRegistry reads registerExtension's arguments, returning the extension
+// name and the columns of each table
+func readRegistry(t *testing.T, r *reader) (string, map[string][]map[string]string) {
+	t.Helper()
+	var name string
+	tables := make(map[string][]map[string]string)
+	for {
+		typ, id, err := r.fieldBegin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ == typeStop {
+			return name, tables
+		}
+		switch id {
+		case 1:
+			for {
+				ftype, fid, err := r.fieldBegin()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ftype == typeStop {
+					break
+				}
+				if fid == 1 {
+					name, _ = r.string()
+				} else if err := r.skip(ftype); err != nil {
+					t.Fatal(err)
+				}
+			}
+		case 2:
+			r.byte()
+			r.byte()
+			n, _ := r.size()
+			for i := 0; i < n; i++ {
+				if registry, _ := r.string(); registry != "table" {
+					t.Fatalf("registry %q", registry)
+				}
+				r.byte()
+				r.byte()
+				items, _ := r.size()
+				for j := 0; j < items; j++ {
+					table, _ := r.string()
+					r.byte()
+					columns, _ := r.size()
+					for k := 0; k < columns; k++ {
+						column, err := r.stringMap()
+						if err != nil {
+							t.Fatal(err)
+						}
+						tables[table] = append(tables[table], column)
+					}
+				}
+			}
+		}
+	}
+}
+
+// fakeManager accepts one extension, registers it as uuid and answers its
+// pings until stop is closed
+func fakeManager(t *testing.T, listener net.Listener, uuid int64, registered chan<- map[string][]map[string]string, stop <-chan struct{}) {
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+	go func() {
+		<-stop
+		conn.Close()
+	}()
+	r := newReader(conn)
+	for {
+		name, _, seq, err := r.messageBegin()
+		if err != nil {
+			return
+		}
+		var w writer
+		w.messageBegin(name, messageReply, seq)
+		switch name {
+		case "registerExtension":
+			ext, tables := readRegistry(t, r)
+			if ext != "trust-store-updater" {
+				t.Errorf("registered %q", ext)
+			}
+			registered <- tables
+			writeStatus(&w, 0, statusOK, "OK", uuid)
+		case "ping":
+			r.skip(typeStruct)
+			writeStatus(&w, 0, statusOK, "OK", 0)
+		}
+		w.fieldStop()
+		conn.Write(w.Bytes())
+	}
+}
+
+// callTable calls the extension as the manager does for a query
+func callTable(t *testing.T, conn net.Conn, table string) (int32, []map[string]string) {
+	t.Helper()
+	var w writer
+	w.messageBegin("call", messageCall, 1)
+	w.fieldBegin(typeString, 1)
+	w.string("table")
+	w.fieldBegin(typeString, 2)
+	w.string(table)
+	w.fieldBegin(typeMap, 3)
+	w.stringMap(map[string]string{"action": "generate", "context": "{}"})
+	w.fieldStop()
+	if _, err := conn.Write(w.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newReader(conn)
+	if name, typ, _, err := r.messageBegin(); err != nil || name != "call" || typ != messageReply {
+		t.Fatalf("reply %q %d %v", name, typ, err)
+	}
+	var code int32
+	var rows []map[string]string
+	for {
+		typ, id, err := r.fieldBegin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ == typeStop {
+			return code, rows
+		}
+		if id != 0 {
+			r.skip(typ)
+			continue
+		}
+		for {
+			ftype, fid, err := r.fieldBegin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ftype == typeStop {
+				break
+			}
+			switch fid {
+			case 1:
+				code, _, _, err = readStatus(r)
+			case 2:
+				r.byte()
+				n, _ := r.size()
+				for i := 0; i < n && err == nil; i++ {
+					var row map[string]string
+					row, err = r.stringMap()
+					rows = append(rows, row)
+				}
+			default:
+				err = r.skip(ftype)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestExtension(t *testing.T) {
+	// Unix socket paths are short; t.TempDir can be too long
+	dir, err := os.MkdirTemp("", "osq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "osquery.em")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	registered := make(chan map[string][]map[string]string, 1)
+	stop := make(chan struct{})
+	go fakeManager(t, listener, 42, registered, stop)
+
+	ext := &Extension{
+		Name:     "trust-store-updater",
+		Version:  "test",
+		Socket:   socket,
+		Timeout:  time.Second,
+		Interval: 20 * time.Millisecond,
+		Tables: []Table{{
+			Name:    "example",
+			Columns: []Column{{Name: "store", Type: TypeText}, {Name: "ca", Type: TypeInteger}},
+			Generate: func() ([]map[string]string, error) {
+				return []map[string]string{{"store": "system", "ca": "1"}}, nil
+			},
+		}},
+	}
+	done := make(chan error, 1)
+	go func() { done <- ext.Run(context.Background()) }()
+
+	tables := <-registered
+	columns := tables["example"]
+	if len(columns) != 2 || columns[0]["name"] != "store" || columns[1]["type"] != TypeInteger || columns[0]["id"] != "column" {
+		t.Fatalf("registered columns %v", columns)
+	}
+
+	// The extension listens on the manager's socket path plus its uuid
+	var conn net.Conn
+	for deadline := time.Now().Add(time.Second); ; {
+		if conn, err = net.Dial("unix", socket+".42"); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, rows := callTable(t, conn, "example")
+	if code != statusOK || len(rows) != 1 || rows[0]["store"] != "system" || rows[0]["ca"] != "1" {
+		t.Errorf("generate returned %d %v", code, rows)
+	}
+	conn.Close()
+
+	conn, err = net.Dial("unix", socket+".42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := callTable(t, conn, "missing"); code != statusError {
+		t.Errorf("unknown table returned status %d", code)
+	}
+	conn.Close()
+
+	// The extension stops once the manager stops answering pings
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("extension kept running without its manager")
+	}
+	if _, err := os.Stat(socket + ".42"); !os.IsNotExist(err) {
+		t.Errorf("extension socket left behind: %v", err)
+	}
+}
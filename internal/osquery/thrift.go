@@ -0,0 +1,256 @@
+package osquery
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The subset of the Thrift binary protocol osquery's extension API uses
+
+// Thrift types
+const (
+	typeStop   = 0
+	typeBool   = 2
+	typeByte   = 3
+	typeDouble = 4
+	typeI16    = 6
+	typeI32    = 8
+	typeI64    = 10
+	typeString = 11
+	typeStruct = 12
+	typeMap    = 13
+	typeSet    = 14
+	typeList   = 15
+)
+
+// Thrift message types
+const (
+	messageCall      = 1
+	messageReply     = 2
+	messageException = 3
+	messageOneway    = 4
+)
+
+const versionMask = 0xffff0000
+const version1 = 0x80010000
+
+// maxSize bounds strings and containers read from the peer
+const maxSize = 16 << 20
+
+type reader struct {
+	r *bufio.Reader
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{r: bufio.NewReader(r)}
+}
+
+func (r *reader) byte() (byte, error) {
+	return r.r.ReadByte()
+}
+
+func (r *reader) i16() (int16, error) {
+	var b [2]byte
+	_, err := io.ReadFull(r.r, b[:])
+	return int16(binary.BigEndian.Uint16(b[:])), err
+}
+
+func (r *reader) i32() (int32, error) {
+	var b [4]byte
+	_, err := io.ReadFull(r.r, b[:])
+	return int32(binary.BigEndian.Uint32(b[:])), err
+}
+
+func (r *reader) i64() (int64, error) {
+	var b [8]byte
+	_, err := io.ReadFull(r.r, b[:])
+	return int64(binary.BigEndian.Uint64(b[:])), err
+}
+
+func (r *reader) size() (int, error) {
+	n, err := r.i32()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > maxSize {
+		return 0, fmt.Errorf("thrift: invalid size %d", n)
+	}
+	return int(n), nil
+}
+
+func (r *reader) string() (string, error) {
+	n, err := r.size()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r.r, b)
+	return string(b), err
+}
+
+// messageBegin reads a strict message header
+func (r *reader) messageBegin() (name string, typ byte, seq int32, err error) {
+	v, err := r.i32()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if uint32(v)&versionMask != version1 {
+		return "", 0, 0, fmt.Errorf("thrift: unsupported message version %#x", uint32(v))
+	}
+	if name, err = r.string(); err != nil {
+		return "", 0, 0, err
+	}
+	seq, err = r.i32()
+	return name, byte(v), seq, err
+}
+
+// fieldBegin reads a field header, returning typeStop after the last field
+func (r *reader) fieldBegin() (typ byte, id int16, err error) {
+	if typ, err = r.byte(); err != nil || typ == typeStop {
+		return typ, 0, err
+	}
+	id, err = r.i16()
+	return typ, id, err
+}
+
+// stringMap reads a map<string,string>
+func (r *reader) stringMap() (map[string]string, error) {
+	ktype, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	vtype, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	n, err := r.size()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 && (ktype != typeString || vtype != typeString) {
+		return nil, fmt.Errorf("thrift: expected map<string,string>")
+	}
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k, err := r.string()
+		if err != nil {
+			return nil, err
+		}
+		if m[k], err = r.string(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// skip reads and discards a value of type typ
+func (r *reader) skip(typ byte) error {
+	var err error
+	switch typ {
+	case typeBool, typeByte:
+		_, err = r.byte()
+	case typeI16:
+		_, err = r.i16()
+	case typeI32:
+		_, err = r.i32()
+	case typeDouble, typeI64:
+		_, err = r.i64()
+	case typeString:
+		_, err = r.string()
+	case typeStruct:
+		for {
+			ftype, _, ferr := r.fieldBegin()
+			if ferr != nil || ftype == typeStop {
+				return ferr
+			}
+			if err = r.skip(ftype); err != nil {
+				return err
+			}
+		}
+	case typeMap:
+		var ktype, vtype byte
+		var n int
+		if ktype, err = r.byte(); err != nil {
+			return err
+		}
+		if vtype, err = r.byte(); err != nil {
+			return err
+		}
+		if n, err = r.size(); err != nil {
+			return err
+		}
+		for i := 0; i < n && err == nil; i++ {
+			if err = r.skip(ktype); err == nil {
+				err = r.skip(vtype)
+			}
+		}
+	case typeSet, typeList:
+		var etype byte
+		var n int
+		if etype, err = r.byte(); err != nil {
+			return err
+		}
+		if n, err = r.size(); err != nil {
+			return err
+		}
+		for i := 0; i < n && err == nil; i++ {
+			err = r.skip(etype)
+		}
+	default:
+		err = fmt.Errorf("thrift: unknown type %d", typ)
+	}
+	return err
+}
+
+// writer builds one message
+type writer struct {
+	bytes.Buffer
+}
+
+func (w *writer) byte(b byte) { w.WriteByte(b) }
+
+func (w *writer) i16(v int16) { w.Write(binary.BigEndian.AppendUint16(nil, uint16(v))) }
+
+func (w *writer) i32(v int32) { w.Write(binary.BigEndian.AppendUint32(nil, uint32(v))) }
+
+func (w *writer) i64(v int64) { w.Write(binary.BigEndian.AppendUint64(nil, uint64(v))) }
+
+func (w *writer) string(s string) {
+	w.i32(int32(len(s)))
+	w.WriteString(s)
+}
+
+func (w *writer) messageBegin(name string, typ byte, seq int32) {
+	w.i32(int32(uint32(version1) | uint32(typ)))
+	w.string(name)
+	w.i32(seq)
+}
+
+func (w *writer) fieldBegin(typ byte, id int16) {
+	w.byte(typ)
+	w.i16(id)
+}
+
+func (w *writer) fieldStop() { w.byte(typeStop) }
+
+func (w *writer) stringMap(m map[string]string) {
+	w.byte(typeString)
+	w.byte(typeString)
+	w.i32(int32(len(m)))
+	for _, k := range sortedKeys(m) {
+		w.string(k)
+		w.string(m[k])
+	}
+}
+
+// rows writes a list<map<string,string>>
+func (w *writer) rows(rows []map[string]string) {
+	w.byte(typeMap)
+	w.i32(int32(len(rows)))
+	for _, row := range rows {
+		w.stringMap(row)
+	}
+}
@@ -0,0 +1,201 @@
+package pgp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	armorBegin = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+	armorEnd   = "-----END PGP PUBLIC KEY BLOCK-----"
+
+	tagPublicKey = 6
+)
+
+// PublicKey is an OpenPGP transferable public key
+type PublicKey struct {
+	Armored     []byte // ASCII armored key as published
+	Fingerprint string // upper case hex v4 fingerprint of the primary key
+}
+
+// KeyID returns the short (32-bit) key ID used by rpm's gpg-pubkey packages
+func (k PublicKey) KeyID() string {
+	return strings.ToLower(k.Fingerprint[len(k.Fingerprint)-8:])
+}
+
+// ParseArmoredKey decodes an ASCII armored public key and computes the
+// fingerprint of its primary key. Only v4 keys are supported. Armored holds
+// that key alone, re-armored, so that keys appended to the published file,
+// in the same armor block or another, are never installed with it.
+func ParseArmoredKey(data []byte) (*PublicKey, error) {
+	body, err := dearmor(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, packet, rest, err := nextPacket(body)
+	if err != nil {
+		return nil, err
+	}
+	if tag != tagPublicKey {
+		return nil, fmt.Errorf("expected a public key packet, found packet tag %d", tag)
+	}
+	if len(packet) == 0 || packet[0] != 4 {
+		return nil, fmt.Errorf("unsupported OpenPGP key version (only v4 keys are supported)")
+	}
+
+	// The key's user IDs, signatures and subkeys follow it up to the next
+	// primary key
+	end := len(body) - len(rest)
+	for len(rest) > 0 {
+		tag, _, next, err := nextPacket(rest)
+		if err != nil {
+			return nil, err
+		}
+		if tag == tagPublicKey {
+			break
+		}
+		rest = next
+		end = len(body) - len(rest)
+	}
+
+	// v4 fingerprint: SHA-1 over 0x99, a two-octet length and the packet body
+	h := sha1.New()
+	h.Write([]byte{0x99, byte(len(packet) >> 8), byte(len(packet))})
+	h.Write(packet)
+
+	return &PublicKey{
+		Armored:     armor(body[:end]),
+		Fingerprint: strings.ToUpper(hex.EncodeToString(h.Sum(nil))),
+	}, nil
+}
+
+// armor encodes OpenPGP packets as a public key block with its checksum
+func armor(packets []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(armorBegin + "\n\n")
+	encoded := base64.StdEncoding.EncodeToString(packets)
+	for len(encoded) > 64 {
+		b.WriteString(encoded[:64] + "\n")
+		encoded = encoded[64:]
+	}
+	b.WriteString(encoded + "\n")
+	sum := crc24(packets)
+	b.WriteString("=" + base64.StdEncoding.EncodeToString([]byte{byte(sum >> 16), byte(sum >> 8), byte(sum)}) + "\n")
+	b.WriteString(armorEnd + "\n")
+	return b.Bytes()
+}
+
+// crc24 is the armor checksum of RFC 4880 section 6.1
+func crc24(data []byte) uint32 {
+	crc := uint32(0xB704CE)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864CFB
+			}
+		}
+	}
+	return crc & 0xFFFFFF
+}
+
+// NormalizeFingerprint strips spaces and "0x" and upper-cases a configured fingerprint
+func NormalizeFingerprint(fp string) string {
+	fp = strings.TrimPrefix(strings.TrimSpace(fp), "0x")
+	return strings.ToUpper(strings.ReplaceAll(fp, " ", ""))
+}
+
+// dearmor returns the binary content of the first public key armor block
+func dearmor(data []byte) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inBlock, inBody := false, false
+	var encoded strings.Builder
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == armorBegin:
+			inBlock = true
+		case !inBlock:
+		case line == armorEnd:
+			decoded, err := base64.StdEncoding.DecodeString(encoded.String())
+			if err != nil {
+				return nil, fmt.Errorf("invalid armored key data: %w", err)
+			}
+			return decoded, nil
+		case !inBody:
+			// Armor headers end at the first blank line
+			if line == "" {
+				inBody = true
+			} else if !strings.Contains(line, ":") {
+				inBody = true
+				encoded.WriteString(line)
+			}
+		case strings.HasPrefix(line, "="):
+			// CRC-24 checksum line
+		default:
+			encoded.WriteString(line)
+		}
+	}
+	return nil, fmt.Errorf("no armored PGP public key block found")
+}
+
+// nextPacket parses the first OpenPGP packet in data, returning its tag,
+// its body and the data after it
+func nextPacket(data []byte) (int, []byte, []byte, error) {
+	if len(data) < 2 || data[0]&0x80 == 0 {
+		return 0, nil, nil, fmt.Errorf("invalid OpenPGP packet header")
+	}
+
+	var tag, offset, length int
+	if data[0]&0x40 != 0 {
+		// New format
+		tag = int(data[0] & 0x3f)
+		switch first := int(data[1]); {
+		case first < 192:
+			offset, length = 2, first
+		case first < 224:
+			if len(data) < 3 {
+				return 0, nil, nil, fmt.Errorf("truncated OpenPGP packet")
+			}
+			offset, length = 3, (first-192)<<8+int(data[2])+192
+		case first == 255:
+			if len(data) < 6 {
+				return 0, nil, nil, fmt.Errorf("truncated OpenPGP packet")
+			}
+			offset, length = 6, int(data[2])<<24|int(data[3])<<16|int(data[4])<<8|int(data[5])
+		default:
+			return 0, nil, nil, fmt.Errorf("partial length packets are not supported in keys")
+		}
+	} else {
+		// Old format
+		tag = int(data[0]&0x3c) >> 2
+		switch data[0] & 0x03 {
+		case 0:
+			offset, length = 2, int(data[1])
+		case 1:
+			if len(data) < 3 {
+				return 0, nil, nil, fmt.Errorf("truncated OpenPGP packet")
+			}
+			offset, length = 3, int(data[1])<<8|int(data[2])
+		case 2:
+			if len(data) < 5 {
+				return 0, nil, nil, fmt.Errorf("truncated OpenPGP packet")
+			}
+			offset, length = 5, int(data[1])<<24|int(data[2])<<16|int(data[3])<<8|int(data[4])
+		default:
+			return 0, nil, nil, fmt.Errorf("indeterminate length packets are not supported")
+		}
+	}
+
+	if length < 0 || offset+length > len(data) {
+		return 0, nil, nil, fmt.Errorf("truncated OpenPGP packet")
+	}
+	return tag, data[offset : offset+length], data[offset+length:], nil
+}
@@ -0,0 +1,161 @@
+package pgp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// managedPrefix names the keyring files written by this tool
+const managedPrefix = "trust-store-updater-"
+
+// SyncResult counts the changes made to a keyring
+type SyncResult struct {
+	Added     int
+	Removed   int
+	Unchanged int
+}
+
+// ValidKeyName reports whether name can be part of a keyring file name: it
+// can't hold path separators or "..", which would write outside the keyring
+func ValidKeyName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return fmt.Errorf("invalid key name %q: names can't be empty or contain path separators or \"..\"", name)
+	}
+	return nil
+}
+
+// SyncAptDir writes each key as <dir>/trust-store-updater-<name>.asc (the
+// format apt reads from /etc/apt/trusted.gpg.d) and removes managed files for
+// keys no longer configured. Keys are keyed by their configured name.
+func SyncAptDir(dir string, keys map[string]*PublicKey, dryRun bool) (SyncResult, error) {
+	var result SyncResult
+
+	if !dryRun {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return result, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		if err := ValidKeyName(name); err != nil {
+			return result, err
+		}
+		file := managedPrefix + name + ".asc"
+		wanted[file] = true
+		path := filepath.Join(dir, file)
+
+		existing, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(existing, keys[name].Armored) {
+			result.Unchanged++
+			continue
+		}
+		result.Added++
+		if dryRun {
+			continue
+		}
+		if err := atomicfile.WriteFile(path, keys[name].Armored, 0644); err != nil {
+			return result, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !(dryRun && os.IsNotExist(err)) {
+		return result, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, managedPrefix) || wanted[name] {
+			continue
+		}
+		result.Removed++
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return result, fmt.Errorf("failed to remove rotated key %s: %w", name, err)
+		}
+	}
+
+	return result, nil
+}
+
+// ImportRPM imports keys into the rpm database with `rpm --import`, skipping
+// keys whose gpg-pubkey package is already installed. Keys are never removed
+// from the rpm database, as other repositories may rely on them.
+func ImportRPM(runner certstore.CommandRunner, keys map[string]*PublicKey, dryRun bool) (SyncResult, error) {
+	var result SyncResult
+
+	installed, err := installedRPMKeyIDs(runner)
+	if err != nil {
+		return result, err
+	}
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := keys[name]
+		if installed[key.KeyID()] {
+			result.Unchanged++
+			continue
+		}
+		result.Added++
+		if dryRun {
+			continue
+		}
+
+		tmp, err := os.CreateTemp("", managedPrefix+"*.asc")
+		if err != nil {
+			return result, err
+		}
+		_, err = tmp.Write(key.Armored)
+		tmp.Close()
+		if err == nil {
+			_, err = runner.Run("rpm", "--import", tmp.Name())
+		}
+		os.Remove(tmp.Name())
+		if err != nil {
+			return result, fmt.Errorf("failed to import key %s: %w", name, err)
+		}
+	}
+
+	return result, nil
+}
+
+// installedRPMKeyIDs returns the short key IDs of the installed gpg-pubkey packages
+func installedRPMKeyIDs(runner certstore.CommandRunner) (map[string]bool, error) {
+	output, err := runner.Run("rpm", "-q", "gpg-pubkey", "--qf", "%{VERSION}\\n")
+	installed := make(map[string]bool)
+	if err != nil {
+		// rpm exits non-zero when no gpg-pubkey package is installed
+		var cmdErr *certstore.CommandError
+		if errors.As(err, &cmdErr) && !cmdErr.TimedOut && strings.Contains(cmdErr.Stdout, "not installed") {
+			return installed, nil
+		}
+		return nil, fmt.Errorf("failed to query rpm keys: %w", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			installed[strings.ToLower(line)] = true
+		}
+	}
+	return installed, nil
+}
@@ -0,0 +1,101 @@
+package pgp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testKey is an ed25519 signing key generated with gpg for "Test Repo <repo@example.com>"
+const testKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
+
+mDMEatJjhBYJKwYBBAHaRw8BAQdA05JxjQXUNrbwlurOlCFq7oMXCD4WCuSipc7O
+m91socy0HFRlc3QgUmVwbyA8cmVwb0BleGFtcGxlLmNvbT6IkAQTFggAOBYhBIHw
+gZgI9TWFujLQk8EFEOUdEHlgBQJq0mOEAhsDBQsJCAcCBhUKCQgLAgQWAgMBAh4B
+AheAAAoJEMEFEOUdEHlgbtUBAMSB7RW8pqHwzHmAAnX8zAmiNfdnBFyoZ8FCrLKx
+6Um2AP9iuj59VrxnMxLZP+fjS0T6vlJJeIPRtpPj/gin4EsBAw==
+=ED1a
+-----END PGP PUBLIC KEY BLOCK-----
+`
+
+const testFingerprint = "81F0819808F53585BA32D093C10510E51D107960"
+
+func TestParseArmoredKey(t *testing.T) {
+	key, err := ParseArmoredKey([]byte(testKey))
+	if err != nil {
+		t.Fatalf("ParseArmoredKey: %v", err)
+	}
+	if key.Fingerprint != testFingerprint {
+		t.Errorf("Fingerprint = %s, want %s", key.Fingerprint, testFingerprint)
+	}
+	if key.KeyID() != "1d107960" {
+		t.Errorf("KeyID = %s, want 1d107960", key.KeyID())
+	}
+	if got := NormalizeFingerprint("81f0 8198 08f5 3585 ba32  d093 c105 10e5 1d10 7960"); got != testFingerprint {
+		t.Errorf("NormalizeFingerprint = %s", got)
+	}
+
+	if _, err := ParseArmoredKey([]byte("not a key")); err == nil {
+		t.Error("expected error for non-armored input")
+	}
+	if string(key.Armored) != testKey {
+		t.Errorf("re-armoring changed the key:\n%s", key.Armored)
+	}
+}
+
+func TestParseArmoredKeyKeepsOnlyThePinnedKey(t *testing.T) {
+	body, err := dearmor([]byte(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"second block":          testKey + "\n" + testKey,
+		"second key in a block": string(armor(append(append([]byte{}, body...), body...))),
+	} {
+		key, err := ParseArmoredKey([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(key.Armored) != testKey {
+			t.Errorf("%s: the appended key was kept:\n%s", name, key.Armored)
+		}
+	}
+}
+
+func TestSyncAptDir(t *testing.T) {
+	key, err := ParseArmoredKey([]byte(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	stale := filepath.Join(dir, managedPrefix+"old.asc")
+	unmanaged := filepath.Join(dir, "debian-archive.asc")
+	for _, path := range []string{stale, unmanaged} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := map[string]*PublicKey{"repo": key}
+	result, err := SyncAptDir(dir, keys, false)
+	if err != nil {
+		t.Fatalf("SyncAptDir: %v", err)
+	}
+	if result != (SyncResult{Added: 1, Removed: 1}) {
+		t.Errorf("first sync = %+v", result)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("stale managed key was not removed")
+	}
+	if _, err := os.Stat(unmanaged); err != nil {
+		t.Error("unmanaged key was removed")
+	}
+
+	result, err = SyncAptDir(dir, keys, false)
+	if err != nil || result != (SyncResult{Unchanged: 1}) {
+		t.Errorf("second sync = %+v, %v", result, err)
+	}
+	if _, err := SyncAptDir(dir, map[string]*PublicKey{"../../sources.list.d/evil": key}, false); err == nil {
+		t.Error("a key name with path separators was written")
+	}
+}
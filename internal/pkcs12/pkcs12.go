@@ -0,0 +1,343 @@
+// Package pkcs12 builds PKCS#12 (.pfx/.p12) files holding a private key and
+// its certificate chain, for stores and applications that import keys in
+// that form
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+	"unicode/utf16"
+)
+
+// PasswordEnv passes PKCS#12 passwords to keytool, so that they never appear
+// on a command line
+const PasswordEnv = "TRUST_STORE_UPDATER_PKCS12_PASSWORD"
+
+// iterations is the work factor for both the key encryption and the MAC
+const iterations = 10000
+
+var (
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidShroudedKeyBag  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBES2           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	asn1Null           = asn1.RawValue{Tag: asn1.TagNull}
+	sha256Algorithm    = pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1Null}
+)
+
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT, see explicit
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue // [0] EXPLICIT, see explicit
+	Attributes []attribute   `asn1:"set,optional,omitempty"`
+}
+
+type attribute struct {
+	ID     asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"explicit,tag:0"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+type pbes2Params struct {
+	KeyDerivation pkix.AlgorithmIdentifier
+	Encryption    pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int
+	PRF        pkix.AlgorithmIdentifier
+}
+
+// Encode returns a PKCS#12 file holding key and chain, leaf first, under
+// the friendly name name, protected by password. The key is encrypted with
+// AES-256 under a PBKDF2-SHA256 key and the file is integrity protected
+// with an HMAC-SHA256, as OpenSSL 3 and Windows 10 and later write them.
+func Encode(key crypto.Signer, chain []*x509.Certificate, name, password string) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificate to export")
+	}
+	keyID := sha1.Sum(chain[0].Raw)
+	leafAttributes, err := bagAttributes(name, keyID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	for i, c := range chain {
+		bag, err := asn1.Marshal(certBag{ID: oidX509Certificate, Data: c.Raw})
+		if err != nil {
+			return nil, err
+		}
+		sb := safeBag{ID: oidCertBag, Value: explicit(bag)}
+		if i == 0 {
+			sb.Attributes = leafAttributes
+		}
+		certBags = append(certBags, sb)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	shrouded, err := encryptKey(der, password)
+	if err != nil {
+		return nil, err
+	}
+	keyBag := safeBag{ID: oidShroudedKeyBag, Value: explicit(shrouded), Attributes: leafAttributes}
+
+	var authSafe []contentInfo
+	for _, bags := range [][]safeBag{certBags, {keyBag}} {
+		ci, err := dataContent(bags)
+		if err != nil {
+			return nil, err
+		}
+		authSafe = append(authSafe, ci)
+	}
+	authSafeDER, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	macKey := deriveKey(sha256.New, bmpString(password), salt, 3, iterations, sha256.Size)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(authSafeDER)
+
+	content, err := asn1.Marshal(authSafeDER)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pfx{
+		Version:  3,
+		AuthSafe: contentInfo{ContentType: oidData, Content: explicit(content)},
+		MacData: macData{
+			Mac:        digestInfo{Algorithm: sha256Algorithm, Digest: mac.Sum(nil)},
+			MacSalt:    salt,
+			Iterations: iterations,
+		},
+	})
+}
+
+// explicit tags der as [0] EXPLICIT. encoding/asn1 writes raw values as
+// they are, ignoring the field's tag options.
+func explicit(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// bagAttributes returns the friendlyName and localKeyId attributes that
+// pair the leaf certificate with its key
+func bagAttributes(name string, keyID []byte) ([]attribute, error) {
+	bmp := bmpString(name)
+	friendlyName, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: bmp[:len(bmp)-2]})
+	if err != nil {
+		return nil, err
+	}
+	localKeyID, err := asn1.Marshal(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return []attribute{
+		{ID: oidFriendlyName, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: friendlyName}},
+		{ID: oidLocalKeyID, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: localKeyID}},
+	}, nil
+}
+
+// dataContent wraps bags in an unencrypted data content info
+func dataContent(bags []safeBag) (contentInfo, error) {
+	der, err := asn1.Marshal(bags)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	content, err := asn1.Marshal(der)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	return contentInfo{ContentType: oidData, Content: explicit(content)}, nil
+}
+
+// encryptKey returns a PBES2 EncryptedPrivateKeyInfo for the PKCS#8 key der
+func encryptKey(der []byte, password string) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(pbkdf2([]byte(password), salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(append([]byte{}, der...), make([]byte, padding)...)
+	for i := len(der); i < len(data); i++ {
+		data[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdf, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: iterations,
+		KeyLength:  32,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1Null},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivDER, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivation: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+		Encryption:    pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivDER}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		Data:      data,
+	})
+}
+
+// bmpString returns s as a NUL-terminated big-endian UTF-16 string, the
+// password and friendly name encoding PKCS#12 uses
+func bmpString(s string) []byte {
+	var b []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return append(b, 0, 0)
+}
+
+// pbkdf2 derives a keyLen byte key from password with PBKDF2-HMAC-SHA256
+// (RFC 8018)
+func pbkdf2(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for n := 1; n < iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// deriveKey is the PKCS#12 key derivation function (RFC 7292 appendix B);
+// id 3 derives MAC keys
+func deriveKey(newHash func() hash.Hash, password, salt []byte, id byte, iter, size int) []byte {
+	h := newHash()
+	u, v := h.Size(), h.BlockSize()
+
+	fill := func(src []byte) []byte {
+		if len(src) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(src)+v-1)/v))
+		for i := range out {
+			out[i] = src[i%len(src)]
+		}
+		return out
+	}
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	in := append(fill(salt), fill(password)...)
+
+	var key []byte
+	for len(key) < size {
+		h.Reset()
+		h.Write(d)
+		h.Write(in)
+		a := h.Sum(nil)
+		for n := 1; n < iter; n++ {
+			h.Reset()
+			h.Write(a)
+			a = h.Sum(a[:0])
+		}
+		key = append(key, a...)
+		if len(key) >= size {
+			break
+		}
+		// Add B+1 to each v-byte block of the input, modulo 2^(8v)
+		b := make([]byte, v)
+		for i := range b {
+			b[i] = a[i%u]
+		}
+		for j := 0; j < len(in); j += v {
+			carry := 1
+			for i := v - 1; i >= 0; i-- {
+				sum := int(in[j+i]) + int(b[i]) + carry
+				in[j+i] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return key[:size]
+}
@@ -0,0 +1,192 @@
+package pkcs12
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// newTestChain returns a leaf key and a chain of a leaf and the root that issued it
+func newTestChain(t *testing.T) (*ecdsa.PrivateKey, []*x509.Certificate) {
+	t.Helper()
+	issue := func(cn string, key, parentKey *ecdsa.PrivateKey, parent *x509.Certificate) *x509.Certificate {
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(time.Now().UnixNano()),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  parent == nil,
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	root := issue("Test Root", rootKey, nil, nil)
+	return leafKey, []*x509.Certificate{issue("localhost", leafKey, rootKey, root), root}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// RFC 7914 section 11
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if got := hex.EncodeToString(pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)); got != want {
+		t.Errorf("pbkdf2 = %s, want %s", got, want)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	key, chain := newTestChain(t)
+	data, err := Encode(key, chain, "web-server", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p pfx
+	if _, err := asn1.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	var authSafeDER []byte
+	if _, err := asn1.Unmarshal(p.AuthSafe.Content.Bytes, &authSafeDER); err != nil {
+		t.Fatal(err)
+	}
+	macKey := deriveKey(sha256.New, bmpString("s3cret"), p.MacData.MacSalt, 3, p.MacData.Iterations, sha256.Size)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(authSafeDER)
+	if !hmac.Equal(mac.Sum(nil), p.MacData.Mac.Digest) {
+		t.Error("MAC does not verify")
+	}
+
+	var authSafe []contentInfo
+	if _, err := asn1.Unmarshal(authSafeDER, &authSafe); err != nil {
+		t.Fatal(err)
+	}
+	var certs [][]byte
+	var shrouded []byte
+	for _, ci := range authSafe {
+		var der []byte
+		if _, err := asn1.Unmarshal(ci.Content.Bytes, &der); err != nil {
+			t.Fatal(err)
+		}
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(der, &bags); err != nil {
+			t.Fatal(err)
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				var cb certBag
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &cb); err != nil {
+					t.Fatal(err)
+				}
+				certs = append(certs, cb.Data)
+			case bag.ID.Equal(oidShroudedKeyBag):
+				shrouded = bag.Value.Bytes
+				if len(bag.Attributes) != 2 {
+					t.Errorf("key bag has %d attributes, want friendlyName and localKeyId", len(bag.Attributes))
+				}
+			}
+		}
+	}
+	if len(certs) != 2 || !bytes.Equal(certs[0], chain[0].Raw) || !bytes.Equal(certs[1], chain[1].Raw) {
+		t.Errorf("found %d certificates, want the leaf then the root", len(certs))
+	}
+
+	// Decrypt the key with the PBES2 parameters the file names
+	var epki encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(shrouded, &epki); err != nil {
+		t.Fatal(err)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(epki.Algorithm.Parameters.FullBytes, &params); err != nil {
+		t.Fatal(err)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivation.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatal(err)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.Encryption.Parameters.FullBytes, &iv); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(pbkdf2([]byte("s3cret"), kdf.Salt, kdf.Iterations, kdf.KeyLength))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := make([]byte, len(epki.Data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, epki.Data)
+	plain = plain[:len(plain)-int(plain[len(plain)-1])]
+	want, _ := x509.MarshalPKCS8PrivateKey(key)
+	if !bytes.Equal(plain, want) {
+		t.Error("decrypted key differs from the encoded one")
+	}
+}
+
+func TestEncodeNoCertificate(t *testing.T) {
+	key, _ := newTestChain(t)
+	if _, err := Encode(key, nil, "empty", "s3cret"); err == nil {
+		t.Error("expected an error for an empty chain")
+	}
+}
+
+func TestEncodeReadByOpenSSL(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not found")
+	}
+	key, chain := newTestChain(t)
+	data, err := Encode(key, chain, "web-server", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keystore.p12")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := certstore.CommandRunner{Env: []string{"PFX_PASS=s3cret"}}
+	out, err := runner.Run("openssl", "pkcs12", "-in", path, "-nodes", "-passin", "env:PFX_PASS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"friendlyName: web-server", "BEGIN PRIVATE KEY"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("openssl output lacks %q:\n%s", want, out)
+		}
+	}
+	if n := strings.Count(string(out), "BEGIN CERTIFICATE"); n != 2 {
+		t.Errorf("openssl found %d certificates, want 2", n)
+	}
+
+	runner = certstore.CommandRunner{Env: []string{"PFX_PASS=wrong"}}
+	if _, err := runner.Run("openssl", "pkcs12", "-in", path, "-nodes", "-passin", "env:PFX_PASS"); err == nil {
+		t.Error("openssl accepted the wrong password")
+	}
+}
@@ -0,0 +1,356 @@
+// Package appliance manages the trusted CAs of appliances reached over SSH,
+// such as Proxmox VE hosts and VMware ESXi. Each appliance profile says where
+// the appliance keeps its CAs and which command applies a change. The store
+// is a plugin store whose plugin is this tool itself, run with PluginCommand,
+// so the work happens in the same JSON protocol external plugins speak.
+package appliance
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/linux"
+	"github.com/webprofusion/trust-store-updater/internal/platform/plugin"
+)
+
+// PluginCommand is the hidden subcommand that serves appliance plugin requests
+const PluginCommand = "appliance-plugin"
+
+// Profile describes where an appliance keeps its trusted CAs: either a
+// directory with one PEM file per certificate or a single PEM bundle
+type Profile struct {
+	AnchorDir string
+	Bundle    string
+	Update    string // shell command run on the appliance after a change
+}
+
+// Profiles are the built-in appliance profiles
+var Profiles = map[string]Profile{
+	// Proxmox VE is Debian based
+	"proxmox": {AnchorDir: "/usr/local/share/ca-certificates", Update: "update-ca-certificates"},
+	// auto-backup.sh persists /etc/vmware across ESXi reboots
+	"esxi": {Bundle: "/etc/vmware/ssl/castore.pem", Update: "/sbin/auto-backup.sh"},
+}
+
+// ProfileNames returns the built-in profile names in order
+func ProfileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Appliance runs commands on one appliance over SSH
+type Appliance struct {
+	host     string
+	user     string
+	port     string
+	identity string
+	ssh      string
+	profile  Profile
+	runner   certstore.CommandRunner
+}
+
+// New returns the appliance described by the store options: host, profile
+// and optionally user, port, identity_file and ssh_command. anchor_dir,
+// bundle and update_command override the profile or, without one, describe
+// the appliance.
+func New(options map[string]string) (*Appliance, error) {
+	a := &Appliance{
+		host:     options["host"],
+		user:     options["user"],
+		port:     options["port"],
+		identity: options["identity_file"],
+		ssh:      options["ssh_command"],
+	}
+	if a.host == "" {
+		return nil, fmt.Errorf("appliance store requires the host as target")
+	}
+	if a.ssh == "" {
+		a.ssh = "ssh"
+	}
+	if name := options["profile"]; name != "" {
+		profile, ok := Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown appliance profile %q (expected one of %s)", name, strings.Join(ProfileNames(), ", "))
+		}
+		a.profile = profile
+	}
+	if dir := options["anchor_dir"]; dir != "" {
+		a.profile.AnchorDir, a.profile.Bundle = dir, ""
+	}
+	if bundle := options["bundle"]; bundle != "" {
+		a.profile.Bundle, a.profile.AnchorDir = bundle, ""
+	}
+	if update, ok := options["update_command"]; ok {
+		a.profile.Update = update
+	}
+	if a.profile.AnchorDir == "" && a.profile.Bundle == "" {
+		return nil, fmt.Errorf("appliance %s: set a profile, anchor_dir or bundle", a.host)
+	}
+	return a, nil
+}
+
+// run runs script with sh on the appliance. args are available to the
+// script as $1, $2, ...
+func (a *Appliance) run(input []byte, script string, args ...string) ([]byte, error) {
+	remote := []string{"sh", "-c", certstore.ShellQuote("set -e\n" + script), "sh"}
+	for _, arg := range args {
+		remote = append(remote, certstore.ShellQuote(arg))
+	}
+	sshArgs := []string{"-o", "BatchMode=yes"}
+	if a.port != "" {
+		sshArgs = append(sshArgs, "-p", a.port)
+	}
+	if a.identity != "" {
+		sshArgs = append(sshArgs, "-i", a.identity)
+	}
+	dest := a.host
+	if a.user != "" {
+		dest = a.user + "@" + a.host
+	}
+	sshArgs = append(sshArgs, dest, strings.Join(remote, " "))
+
+	output, err := a.runner.RunWithInput(input, a.ssh, sshArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("appliance %s: %w", a.host, err)
+	}
+	return output, nil
+}
+
+// afterChange is appended to scripts that change the appliance's CAs
+func (a *Appliance) afterChange() string {
+	if a.profile.Update == "" {
+		return ""
+	}
+	return "\n" + a.profile.Update + " >/dev/null\n"
+}
+
+// fileMarker separates the files listed from an anchor directory
+const fileMarker = "# trust-store-updater file: "
+
+// anchorFiles returns the certificates in each file of the anchor directory
+func (a *Appliance) anchorFiles() (map[string][]*x509.Certificate, error) {
+	output, err := a.run(nil, `for f in "$1"/*; do [ -f "$f" ] || continue; printf '%s%s\n' "$2" "$f"; cat "$f"; echo; done`,
+		a.profile.AnchorDir, fileMarker)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]*x509.Certificate)
+	for _, part := range strings.Split(string(output), fileMarker)[1:] {
+		path, content, _ := strings.Cut(part, "\n")
+		certs, err := certstore.ParsePEMBundle([]byte(content))
+		if err != nil {
+			return nil, fmt.Errorf("appliance %s: %s: %w", a.host, path, err)
+		}
+		files[path] = certs
+	}
+	return files, nil
+}
+
+// List returns the certificates the appliance trusts
+func (a *Appliance) List() ([]*x509.Certificate, error) {
+	if a.profile.Bundle != "" {
+		output, err := a.run(nil, `cat "$1" 2>/dev/null || true`, a.profile.Bundle)
+		if err != nil {
+			return nil, err
+		}
+		return certstore.ParsePEMBundle(output)
+	}
+	files, err := a.anchorFiles()
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, fileCerts := range files {
+		certs = append(certs, fileCerts...)
+	}
+	return certs, nil
+}
+
+// writeBundle replaces the appliance's bundle
+func (a *Appliance) writeBundle(data []byte) error {
+	_, err := a.run(data, `mkdir -p "$(dirname "$1")"; cat > "$1.tmp"; mv "$1.tmp" "$1"`+a.afterChange(), a.profile.Bundle)
+	return err
+}
+
+// Add installs a certificate on the appliance
+func (a *Appliance) Add(cert *x509.Certificate) error {
+	if a.profile.Bundle == "" {
+		_, err := a.run(linux.ManagedCertificatePEM(cert), `mkdir -p "$1"; cat > "$1/$2"`+a.afterChange(),
+			a.profile.AnchorDir, linux.CertificateFilename(cert))
+		return err
+	}
+	current, err := a.List()
+	if err != nil {
+		return err
+	}
+	if certstore.ContainsCertificate(current, cert) {
+		return nil
+	}
+	return a.writeBundle(certstore.EncodePEMBundle(append(current, cert)))
+}
+
+// Remove removes a certificate from the appliance
+func (a *Appliance) Remove(cert *x509.Certificate) error {
+	if a.profile.Bundle != "" {
+		current, err := a.List()
+		if err != nil {
+			return err
+		}
+		var kept []*x509.Certificate
+		for _, c := range current {
+			if !c.Equal(cert) {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) == len(current) {
+			return nil
+		}
+		return a.writeBundle(certstore.EncodePEMBundle(kept))
+	}
+
+	files, err := a.anchorFiles()
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for path, certs := range files {
+		if certstore.ContainsCertificate(certs, cert) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	sort.Strings(paths)
+	_, err = a.run(nil, `rm -f "$@"`+a.afterChange(), paths...)
+	return err
+}
+
+// backupFile is the local file in a backup directory holding the appliance's CAs
+func (a *Appliance) backupFile(backupPath string) string {
+	if a.profile.Bundle != "" {
+		return filepath.Join(backupPath, "bundle.pem")
+	}
+	return filepath.Join(backupPath, "anchors.tar")
+}
+
+// Backup copies the appliance's CAs into the local backupPath
+func (a *Appliance) Backup(backupPath string) error {
+	var data []byte
+	var err error
+	if a.profile.Bundle != "" {
+		data, err = a.run(nil, `cat "$1" 2>/dev/null || true`, a.profile.Bundle)
+	} else {
+		data, err = a.run(nil, `mkdir -p "$1"; tar -C "$1" -cf - .`, a.profile.AnchorDir)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return atomicfile.WriteFile(a.backupFile(backupPath), data, 0600)
+}
+
+// Restore puts the appliance's CAs back from the local backupPath
+func (a *Appliance) Restore(backupPath string) error {
+	data, err := os.ReadFile(a.backupFile(backupPath))
+	if err != nil {
+		return fmt.Errorf("no backup for appliance %s: %w", a.host, err)
+	}
+	if a.profile.Bundle != "" {
+		return a.writeBundle(data)
+	}
+	_, err = a.run(data, `mkdir -p "$1"; tar -C "$1" -xf -`+a.afterChange(), a.profile.AnchorDir)
+	return err
+}
+
+// Validate checks that the appliance is reachable and its CA location exists
+func (a *Appliance) Validate() error {
+	location := a.profile.AnchorDir
+	if location == "" {
+		location = filepath.Dir(a.profile.Bundle)
+	}
+	_, err := a.run(nil, `[ -d "$1" ] || { echo "$1 does not exist" >&2; exit 1; }`, location)
+	return err
+}
+
+// Handle answers one plugin request
+func Handle(req plugin.Request) plugin.Response {
+	a, err := New(req.Options)
+	if err != nil {
+		return plugin.Response{Error: err.Error()}
+	}
+
+	switch req.Operation {
+	case plugin.OpDescribe:
+		_, err := exec.LookPath(a.ssh)
+		supported := err == nil
+		return plugin.Response{Supported: &supported}
+	case plugin.OpList:
+		certs, err := a.List()
+		if err != nil {
+			return plugin.Response{Error: err.Error()}
+		}
+		resp := plugin.Response{Certificates: []string{}}
+		for _, c := range certs {
+			resp.Certificates = append(resp.Certificates, string(certstore.EncodePEMBundle([]*x509.Certificate{c})))
+		}
+		return resp
+	}
+
+	if err := a.handle(req); err != nil {
+		return plugin.Response{Error: err.Error()}
+	}
+	return plugin.Response{}
+}
+
+// handle runs the requests that change or check the appliance
+func (a *Appliance) handle(req plugin.Request) error {
+	var cert *x509.Certificate
+	if req.Operation == plugin.OpAdd || req.Operation == plugin.OpRemove {
+		certs, err := certstore.ParsePEMBundle([]byte(req.Certificate))
+		if err != nil || len(certs) != 1 {
+			return fmt.Errorf("%s needs exactly one PEM certificate", req.Operation)
+		}
+		cert = certs[0]
+	}
+	switch req.Operation {
+	case plugin.OpAdd:
+		return a.Add(cert)
+	case plugin.OpRemove:
+		return a.Remove(cert)
+	case plugin.OpBackup:
+		return a.Backup(req.Path)
+	case plugin.OpRestore:
+		return a.Restore(req.Path)
+	case plugin.OpValidate:
+		return a.Validate()
+	}
+	return fmt.Errorf("unsupported operation %q", req.Operation)
+}
+
+// Serve reads one plugin request from r and writes the response to w
+func Serve(r io.Reader, w io.Writer) error {
+	var req plugin.Request
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return fmt.Errorf("failed to read plugin request: %w", err)
+	}
+	if req.Version != plugin.ProtocolVersion {
+		return json.NewEncoder(w).Encode(plugin.Response{Error: fmt.Sprintf("unsupported protocol version %d", req.Version)})
+	}
+	return json.NewEncoder(w).Encode(Handle(req))
+}
@@ -0,0 +1,87 @@
+//go:build unix
+
+package appliance
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+	"github.com/webprofusion/trust-store-updater/internal/platform/plugin"
+)
+
+// writeFakeSSH creates an ssh stand-in that runs the remote command locally
+func writeFakeSSH(t *testing.T) string {
+	t.Helper()
+	script := "#!/bin/sh\nfor arg; do remote=$arg; done\nexec sh -c \"$remote\"\n"
+	path := filepath.Join(t.TempDir(), "ssh")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplianceProfiles(t *testing.T) {
+	root := certstoretest.NewCertificate(t, "Appliance Root")
+	pemCert := string(certstore.EncodePEMBundle([]*x509.Certificate{root}))
+
+	for _, tc := range []struct {
+		name string
+		opt  string
+	}{{"anchor directory", "anchor_dir"}, {"bundle", "bundle"}} {
+		dir := t.TempDir()
+		location := filepath.Join(dir, "anchors")
+		if tc.opt == "bundle" {
+			location = filepath.Join(dir, "ssl", "castore.pem")
+		}
+		options := map[string]string{
+			"host":           "appliance.example",
+			"ssh_command":    writeFakeSSH(t),
+			tc.opt:           location,
+			"update_command": "touch " + filepath.Join(dir, "updated"),
+		}
+		call := func(req plugin.Request) plugin.Response {
+			req.Version, req.Options = plugin.ProtocolVersion, options
+			resp := Handle(req)
+			if resp.Error != "" {
+				t.Fatalf("%s: %s: %s", tc.name, req.Operation, resp.Error)
+			}
+			return resp
+		}
+
+		call(plugin.Request{Operation: plugin.OpAdd, Certificate: pemCert})
+		if resp := call(plugin.Request{Operation: plugin.OpList}); len(resp.Certificates) != 1 {
+			t.Fatalf("%s: list after add = %d certificates", tc.name, len(resp.Certificates))
+		}
+		if _, err := os.Stat(filepath.Join(dir, "updated")); err != nil {
+			t.Errorf("%s: update command didn't run: %v", tc.name, err)
+		}
+
+		backup := filepath.Join(dir, "backup")
+		call(plugin.Request{Operation: plugin.OpBackup, Path: backup})
+		call(plugin.Request{Operation: plugin.OpRemove, Certificate: pemCert})
+		if resp := call(plugin.Request{Operation: plugin.OpList}); len(resp.Certificates) != 0 {
+			t.Fatalf("%s: list after remove = %d certificates", tc.name, len(resp.Certificates))
+		}
+		call(plugin.Request{Operation: plugin.OpRestore, Path: backup})
+		if resp := call(plugin.Request{Operation: plugin.OpList}); len(resp.Certificates) != 1 {
+			t.Errorf("%s: list after restore = %d certificates", tc.name, len(resp.Certificates))
+		}
+		call(plugin.Request{Operation: plugin.OpValidate})
+	}
+}
+
+func TestNewRequiresProfile(t *testing.T) {
+	if _, err := New(map[string]string{"host": "pve1"}); err == nil {
+		t.Error("expected an error without a profile, anchor_dir or bundle")
+	}
+	if _, err := New(map[string]string{"host": "pve1", "profile": "netscaler"}); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+	if a, err := New(map[string]string{"host": "esx1", "profile": "esxi"}); err != nil || a.profile.Bundle == "" {
+		t.Errorf("esxi profile = %+v, %v", a, err)
+	}
+}
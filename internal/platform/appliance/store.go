@@ -0,0 +1,48 @@
+package appliance
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/plugin"
+)
+
+// Store is a plugin store served by this tool's PluginCommand
+type Store struct {
+	*plugin.Store
+	name string
+}
+
+// NewStore creates a store for the appliance whose host is target
+func NewStore(target string, options map[string]string, verbose bool) (certstore.CertificateStore, error) {
+	opts := make(map[string]string, len(options)+1)
+	for k, v := range options {
+		opts[k] = v
+	}
+	opts["host"] = target
+
+	// Fail on a bad profile now rather than on every request
+	a, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the appliance plugin: %w", err)
+	}
+
+	name := "appliance-" + a.host
+	if profile := options["profile"]; profile != "" {
+		name = fmt.Sprintf("appliance-%s-%s", profile, a.host)
+	}
+	return &Store{
+		Store: plugin.NewCommandStore(executable, []string{PluginCommand}, opts, verbose),
+		name:  name,
+	}, nil
+}
+
+// Name returns the name of the certificate store
+func (s *Store) Name() string {
+	return s.name
+}
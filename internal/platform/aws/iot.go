@@ -0,0 +1,223 @@
+package aws
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// IoTStore registers CA certificates with AWS IoT Core so devices presenting
+// certificates issued by them can authenticate
+type IoTStore struct {
+	region  string
+	options map[string]string
+	verbose bool
+	iot     *client
+}
+
+// iotCACertificate is a registered CA as returned by the IoT API
+type iotCACertificate struct {
+	ID   string
+	Cert *x509.Certificate
+}
+
+func newIoTStore(creds credentials, region string, options map[string]string, verbose bool) (*IoTStore, error) {
+	endpoint := options["endpoint"]
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://iot.%s.amazonaws.com", region)
+	}
+	return &IoTStore{
+		region:  region,
+		options: options,
+		verbose: verbose,
+		iot:     newClient(creds, region, "iot", endpoint),
+	}, nil
+}
+
+// Name returns the name of the certificate store
+func (s *IoTStore) Name() string {
+	return fmt.Sprintf("aws-iot-%s", s.region)
+}
+
+// IsSupported reports whether the IoT API is reachable with the configured credentials
+func (s *IoTStore) IsSupported() bool {
+	return s.Validate() == nil
+}
+
+// RequiresRoot returns false; access is governed by AWS credentials
+func (s *IoTStore) RequiresRoot() bool {
+	return false
+}
+
+// ListCertificates returns the registered CA certificates
+func (s *IoTStore) ListCertificates() ([]*x509.Certificate, error) {
+	registered, err := s.listRegistered()
+	if err != nil {
+		return nil, err
+	}
+	certs := make([]*x509.Certificate, 0, len(registered))
+	for _, r := range registered {
+		certs = append(certs, r.Cert)
+	}
+	return certs, nil
+}
+
+// AddCertificate registers a CA certificate in SNI_ONLY mode, which doesn't
+// require a proof-of-possession verification certificate, and activates it
+func (s *IoTStore) AddCertificate(cert *x509.Certificate) error {
+	body, err := json.Marshal(map[string]string{
+		"caCertificate":   string(certstore.EncodePEMBundle([]*x509.Certificate{cert})),
+		"certificateMode": "SNI_ONLY",
+	})
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"setAsActive": {"true"}}
+	if s.options["allow_auto_registration"] == "true" {
+		query.Set("allowAutoRegistration", "true")
+	}
+
+	if _, err := s.iot.do("POST", "/cacertificate?"+query.Encode(), body, "application/json"); err != nil {
+		return fmt.Errorf("failed to register CA certificate with AWS IoT: %w", err)
+	}
+	return nil
+}
+
+// RemoveCertificate deactivates and deletes a registered CA certificate
+func (s *IoTStore) RemoveCertificate(cert *x509.Certificate) error {
+	registered, err := s.listRegistered()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range registered {
+		if !r.Cert.Equal(cert) {
+			continue
+		}
+		path := "/cacertificate/" + url.PathEscape(r.ID)
+		if _, err := s.iot.do("PUT", path+"?newStatus=INACTIVE", nil, ""); err != nil {
+			return fmt.Errorf("failed to deactivate CA certificate %s: %w", r.ID, err)
+		}
+		if _, err := s.iot.do("DELETE", path, nil, ""); err != nil {
+			return fmt.Errorf("failed to delete CA certificate %s: %w", r.ID, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("certificate not registered with AWS IoT in %s", s.region)
+}
+
+// Backup saves the registered CA certificates as a PEM bundle at backupPath
+func (s *IoTStore) Backup(backupPath string) error {
+	certs, err := s.ListCertificates()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return atomicfile.WriteFile(backupPath, certstore.EncodePEMBundle(certs), 0600)
+}
+
+// Restore re-registers CA certificates from a backup that are no longer
+// registered. CAs registered since the backup are left in place, as devices
+// may already depend on them.
+func (s *IoTStore) Restore(backupPath string) error {
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	certs, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		return err
+	}
+
+	current, err := s.ListCertificates()
+	if err != nil {
+		return err
+	}
+	for _, c := range certs {
+		if certstore.ContainsCertificate(current, c) {
+			continue
+		}
+		if err := s.AddCertificate(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the IoT API can be called with the configured credentials
+func (s *IoTStore) Validate() error {
+	if _, err := s.iot.do("GET", "/cacertificates?pageSize=1", nil, ""); err != nil {
+		return fmt.Errorf("cannot access AWS IoT in %s: %w", s.region, err)
+	}
+	return nil
+}
+
+// listRegistered pages through the registered CA certificates and fetches each PEM
+func (s *IoTStore) listRegistered() ([]iotCACertificate, error) {
+	var registered []iotCACertificate
+	marker := ""
+	for {
+		query := url.Values{"pageSize": {"250"}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		data, err := s.iot.do("GET", "/cacertificates?"+query.Encode(), nil, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list AWS IoT CA certificates: %w", err)
+		}
+
+		var page struct {
+			Certificates []struct {
+				CertificateID string `json:"certificateId"`
+			} `json:"certificates"`
+			NextMarker string `json:"nextMarker"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("failed to decode AWS IoT response: %w", err)
+		}
+
+		for _, c := range page.Certificates {
+			cert, err := s.describe(c.CertificateID)
+			if err != nil {
+				return nil, err
+			}
+			registered = append(registered, iotCACertificate{ID: c.CertificateID, Cert: cert})
+		}
+
+		if page.NextMarker == "" {
+			return registered, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+func (s *IoTStore) describe(id string) (*x509.Certificate, error) {
+	data, err := s.iot.do("GET", "/cacertificate/"+url.PathEscape(id), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe CA certificate %s: %w", id, err)
+	}
+
+	var resp struct {
+		CertificateDescription struct {
+			CertificatePem string `json:"certificatePem"`
+		} `json:"certificateDescription"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode AWS IoT response: %w", err)
+	}
+
+	certs, err := certstore.ParsePEMBundle([]byte(resp.CertificateDescription.CertificatePem))
+	if err != nil || len(certs) == 0 {
+		return nil, fmt.Errorf("CA certificate %s has no valid PEM", id)
+	}
+	return certs[0], nil
+}
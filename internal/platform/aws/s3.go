@@ -0,0 +1,223 @@
+package aws
+
+import (
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// S3BundleStore publishes the managed certificates as a single PEM bundle
+// object in S3. Changes are buffered and uploaded once by Commit, which also
+// invalidates the object in CloudFront when a distribution is configured.
+type S3BundleStore struct {
+	bucket       string
+	key          string
+	distribution string
+	verbose      bool
+	s3           *client
+	cloudfront   *client
+
+	certs  []*x509.Certificate
+	loaded bool
+	dirty  bool
+}
+
+func newS3BundleStore(creds credentials, region string, options map[string]string, verbose bool) (*S3BundleStore, error) {
+	bucket, key := options["bucket"], strings.TrimLeft(options["key"], "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("s3-bundle store requires options.bucket and options.key")
+	}
+
+	endpoint := options["endpoint"]
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	}
+
+	store := &S3BundleStore{
+		bucket:       bucket,
+		key:          key,
+		distribution: options["cloudfront_distribution_id"],
+		verbose:      verbose,
+		s3:           newClient(creds, region, "s3", endpoint),
+	}
+	if store.distribution != "" {
+		// CloudFront is a global service signed in us-east-1
+		store.cloudfront = newClient(creds, "us-east-1", "cloudfront", "https://cloudfront.amazonaws.com")
+	}
+	return store, nil
+}
+
+// Name returns the name of the certificate store
+func (s *S3BundleStore) Name() string {
+	return fmt.Sprintf("aws-s3-%s/%s", s.bucket, s.key)
+}
+
+// IsSupported reports whether the bundle object can be read (or doesn't exist yet)
+func (s *S3BundleStore) IsSupported() bool {
+	return s.Validate() == nil
+}
+
+// RequiresRoot returns false; access is governed by AWS credentials
+func (s *S3BundleStore) RequiresRoot() bool {
+	return false
+}
+
+// ListCertificates returns the certificates in the bundle, including pending changes
+func (s *S3BundleStore) ListCertificates() ([]*x509.Certificate, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	certs := make([]*x509.Certificate, len(s.certs))
+	copy(certs, s.certs)
+	return certs, nil
+}
+
+// AddCertificate adds a certificate to the pending bundle
+func (s *S3BundleStore) AddCertificate(cert *x509.Certificate) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	if !certstore.ContainsCertificate(s.certs, cert) {
+		s.certs = append(s.certs, cert)
+		s.dirty = true
+	}
+	return nil
+}
+
+// RemoveCertificate removes a certificate from the pending bundle
+func (s *S3BundleStore) RemoveCertificate(cert *x509.Certificate) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	kept := s.certs[:0]
+	for _, c := range s.certs {
+		if c.Equal(cert) {
+			s.dirty = true
+			continue
+		}
+		kept = append(kept, c)
+	}
+	s.certs = kept
+	return nil
+}
+
+// Commit uploads the bundle if it changed and invalidates the CloudFront cache
+func (s *S3BundleStore) Commit() error {
+	if !s.dirty {
+		return nil
+	}
+	if err := s.upload(s.certs); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Backup saves the published bundle at backupPath
+func (s *S3BundleStore) Backup(backupPath string) error {
+	data, err := s.s3.do("GET", s.objectPath(), nil, "")
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to download s3://%s/%s: %w", s.bucket, s.key, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return atomicfile.WriteFile(backupPath, data, 0600)
+}
+
+// Restore uploads a backed up bundle
+func (s *S3BundleStore) Restore(backupPath string) error {
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	certs, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		return err
+	}
+	if err := s.upload(certs); err != nil {
+		return err
+	}
+	s.certs, s.loaded, s.dirty = certs, true, false
+	return nil
+}
+
+// Validate checks the bundle object can be read with the configured credentials
+func (s *S3BundleStore) Validate() error {
+	_, err := s.s3.do("HEAD", s.objectPath(), nil, "")
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("cannot access s3://%s/%s: %w", s.bucket, s.key, err)
+	}
+	return nil
+}
+
+func (s *S3BundleStore) objectPath() string {
+	return "/" + (&url.URL{Path: s.key}).EscapedPath()
+}
+
+// load downloads the current bundle once; a missing object is an empty bundle
+func (s *S3BundleStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	data, err := s.s3.do("GET", s.objectPath(), nil, "")
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to download s3://%s/%s: %w", s.bucket, s.key, err)
+	}
+	certs, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		return err
+	}
+	s.certs, s.loaded = certs, true
+	return nil
+}
+
+func (s *S3BundleStore) upload(certs []*x509.Certificate) error {
+	if s.verbose {
+		fmt.Printf("Uploading %d certificates to s3://%s/%s\n", len(certs), s.bucket, s.key)
+	}
+	if _, err := s.s3.do("PUT", s.objectPath(), certstore.EncodeManagedBundle(certs), "application/x-pem-file"); err != nil {
+		return fmt.Errorf("failed to upload s3://%s/%s: %w", s.bucket, s.key, err)
+	}
+
+	if s.cloudfront == nil {
+		return nil
+	}
+	if err := s.invalidate(); err != nil {
+		return fmt.Errorf("bundle uploaded but CloudFront invalidation failed: %w", err)
+	}
+	return nil
+}
+
+// invalidationBatch is the CloudFront CreateInvalidation request body
+type invalidationBatch struct {
+	XMLName         xml.Name `xml:"http://cloudfront.amazonaws.com/doc/2020-05-31/ InvalidationBatch"`
+	Quantity        int      `xml:"Paths>Quantity"`
+	Items           []string `xml:"Paths>Items>Path"`
+	CallerReference string   `xml:"CallerReference"`
+}
+
+func (s *S3BundleStore) invalidate() error {
+	body, err := xml.Marshal(invalidationBatch{
+		Quantity:        1,
+		Items:           []string{"/" + s.key},
+		CallerReference: fmt.Sprintf("trust-store-updater-%d", time.Now().UnixNano()),
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.verbose {
+		fmt.Printf("Invalidating /%s in CloudFront distribution %s\n", s.key, s.distribution)
+	}
+	_, err = s.cloudfront.do("POST", "/2020-05-31/distribution/"+url.PathEscape(s.distribution)+"/invalidation", body, "text/xml")
+	return err
+}
@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestS3BundleStoreUploadsOnceOnCommit(t *testing.T) {
+	var object []byte
+	puts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			if object == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(object)
+		case http.MethodPut:
+			object, _ = io.ReadAll(r.Body)
+			puts++
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewStore("s3-bundle", map[string]string{
+		"access_key_id":     "AKIDEXAMPLE",
+		"secret_access_key": "secret",
+		"region":            "eu-west-1",
+		"bucket":            "trust",
+		"key":               "bundles/ca.pem",
+		"endpoint":          server.URL,
+	}, false)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if !store.IsSupported() {
+		t.Fatal("a missing bundle object should not make the store unsupported")
+	}
+
+	for _, cn := range []string{"Root A", "Root B", "Root C"} {
+		if err := store.AddCertificate(certstoretest.NewCertificate(t, cn)); err != nil {
+			t.Fatalf("AddCertificate: %v", err)
+		}
+	}
+	if puts != 0 {
+		t.Fatalf("expected no upload before commit, got %d", puts)
+	}
+
+	if err := store.(*S3BundleStore).Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if puts != 1 {
+		t.Errorf("expected a single upload, got %d", puts)
+	}
+	if n := strings.Count(string(object), "BEGIN CERTIFICATE"); n != 3 {
+		t.Errorf("uploaded bundle has %d certificates, want 3", n)
+	}
+}
@@ -0,0 +1,36 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// NewStore creates an AWS publication target: "s3-bundle" keeps a PEM bundle
+// in S3 (optionally fronted by CloudFront) and "iot-ca" registers CA
+// certificates with AWS IoT Core
+func NewStore(target string, options map[string]string, verbose bool) (certstore.CertificateStore, error) {
+	creds, err := loadCredentials(options)
+	if err != nil {
+		return nil, err
+	}
+
+	region := optionOrEnv(options, "region", "AWS_REGION")
+	if region == "" {
+		return nil, fmt.Errorf("AWS region not configured (options.region or AWS_REGION)")
+	}
+
+	switch target {
+	case "s3-bundle":
+		return newS3BundleStore(creds, region, options, verbose)
+	case "iot-ca":
+		return newIoTStore(creds, region, options, verbose)
+	default:
+		return nil, fmt.Errorf("unsupported aws store target: %s", target)
+	}
+}
+
+// SupportedStores returns the AWS store targets
+func SupportedStores() []string {
+	return []string{"s3-bundle", "iot-ca"}
+}
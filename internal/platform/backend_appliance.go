@@ -0,0 +1,12 @@
+//go:build !no_appliance
+
+package platform
+
+import (
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/appliance"
+)
+
+func init() {
+	backends[certstore.StoreTypeAppliance] = backend{create: appliance.NewStore}
+}
@@ -0,0 +1,12 @@
+//go:build !no_aws
+
+package platform
+
+import (
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/aws"
+)
+
+func init() {
+	backends[certstore.StoreTypeAWS] = backend{create: aws.NewStore, targets: aws.SupportedStores}
+}
@@ -0,0 +1,12 @@
+//go:build !no_vault
+
+package platform
+
+import (
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/vault"
+)
+
+func init() {
+	backends[certstore.StoreTypeVault] = backend{create: vault.NewStore, targets: vault.SupportedStores}
+}
@@ -0,0 +1,32 @@
+package platform
+
+import (
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/plugin"
+)
+
+// backend creates stores of a platform neutral type
+type backend struct {
+	create  certstore.StoreConstructor
+	targets func() []string // known targets; nil when the target is free-form
+}
+
+// backends are the platform neutral store types in this build. The optional
+// ones register themselves from files that the no_vault, no_aws and
+// no_appliance build tags leave out, for builds that must stay small.
+var backends = map[certstore.StoreType]backend{
+	certstore.StoreTypePlugin: {create: plugin.NewStore},
+}
+
+// optionalTypes are the platform neutral store types a build may leave out
+var optionalTypes = []certstore.StoreType{certstore.StoreTypeVault, certstore.StoreTypeAWS, certstore.StoreTypeAppliance}
+
+// NeutralTargets returns the known targets of a platform neutral store type
+// and whether the type is included in this build
+func NeutralTargets(storeType certstore.StoreType) ([]string, bool) {
+	backend, ok := backends[storeType]
+	if !ok || backend.targets == nil {
+		return nil, ok
+	}
+	return backend.targets(), true
+}
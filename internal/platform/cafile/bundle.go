@@ -0,0 +1,114 @@
+package cafile
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+)
+
+// bundle is a CA file's contents, edited in place so comments, ordering and
+// certificates this tool doesn't manage survive
+type bundle struct {
+	path   string
+	data   []byte
+	blocks []block
+}
+
+// block is a certificate and where its PEM block lies in the data
+type block struct {
+	cert       *x509.Certificate
+	start, end int
+}
+
+// readBundle reads the certificates in a PEM CA file; a file that doesn't
+// exist yet is empty
+func readBundle(path string) (*bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	b := &bundle{path: path, data: data}
+	if err := b.parse(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *bundle) parse() error {
+	b.blocks = nil
+	rest := b.data
+	for {
+		start := bytes.Index(rest, []byte("-----BEGIN"))
+		if start < 0 {
+			return nil
+		}
+		offset := len(b.data) - len(rest) + start
+		p, next := pem.Decode(rest[start:])
+		if p == nil {
+			return fmt.Errorf("%s: malformed PEM block at byte %d", b.path, offset)
+		}
+		rest = next
+		if p.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(p.Bytes)
+		if err != nil {
+			return fmt.Errorf("%s: invalid certificate at byte %d: %w", b.path, offset, err)
+		}
+		b.blocks = append(b.blocks, block{cert: c, start: offset, end: len(b.data) - len(rest)})
+	}
+}
+
+func (b *bundle) certificates() []*x509.Certificate {
+	certs := make([]*x509.Certificate, len(b.blocks))
+	for i, blk := range b.blocks {
+		certs[i] = blk.cert
+	}
+	return certs
+}
+
+// add appends c unless the bundle holds it already
+func (b *bundle) add(c *x509.Certificate) bool {
+	for _, blk := range b.blocks {
+		if blk.cert.Equal(c) {
+			return false
+		}
+	}
+	data := append([]byte(nil), b.data...)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	b.data = data
+	b.parse()
+	return true
+}
+
+// remove cuts every copy of c out of the bundle
+func (b *bundle) remove(c *x509.Certificate) bool {
+	removed := false
+	for i := len(b.blocks) - 1; i >= 0; i-- {
+		blk := b.blocks[i]
+		if !blk.cert.Equal(c) {
+			continue
+		}
+		end := blk.end
+		if end < len(b.data) && b.data[end] == '\n' {
+			end++
+		}
+		b.data = append(b.data[:blk.start:blk.start], b.data[end:]...)
+		removed = true
+	}
+	if removed {
+		b.parse()
+	}
+	return removed
+}
+
+func fingerprint(c *x509.Certificate) string {
+	return cert.GetCertificateFingerprint(c)
+}
@@ -0,0 +1,184 @@
+package cafile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// discoverPostgreSQL reads a cluster's postgresql.conf and the files it
+// includes for ssl_ca_file. As in PostgreSQL the last setting wins, and a
+// relative path is relative to the data directory.
+func discoverPostgreSQL(config string) ([]CAFile, error) {
+	settings := make(map[string]string)
+	setIn := make(map[string]string)
+	visited := make(map[string]bool)
+
+	var walk func(path string, depth int, required bool) error
+	walk = func(path string, depth int, required bool) error {
+		if depth > maxIncludeDepth || visited[path] {
+			return nil
+		}
+		visited[path] = true
+		lines, err := readLines(path, false)
+		if err != nil {
+			if !required && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		dir := filepath.Dir(path)
+		for _, line := range lines {
+			key, value, ok := postgreSQLSetting(line)
+			if !ok {
+				continue
+			}
+			switch key {
+			case "include":
+				err = walk(absolute(dir, value), depth+1, true)
+			case "include_if_exists":
+				err = walk(absolute(dir, value), depth+1, false)
+			case "include_dir":
+				matches, _ := filepath.Glob(filepath.Join(absolute(dir, value), "*.conf"))
+				sort.Strings(matches)
+				for _, m := range matches {
+					if err = walk(m, depth+1, true); err != nil {
+						break
+					}
+				}
+			default:
+				settings[key] = value
+				setIn[key] = path
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(config, 0, true); err != nil {
+		return nil, err
+	}
+
+	caFile := settings["ssl_ca_file"]
+	if caFile == "" {
+		return nil, nil
+	}
+	dataDir := settings["data_directory"]
+	if dataDir == "" {
+		dataDir = filepath.Dir(config) // RHEL keeps the configuration in the data directory
+	}
+	return []CAFile{{Path: absolute(dataDir, caFile), ConfigFiles: []string{setIn["ssl_ca_file"]}}}, nil
+}
+
+// postgreSQLSetting parses a `name = value` or `name value` line, removing
+// the quotes around a value
+func postgreSQLSetting(line string) (string, string, bool) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		key, value, ok = strings.Cut(line, " ")
+	}
+	if !ok {
+		return "", "", false
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "'") {
+		if end := strings.Index(value[1:], "'"); end >= 0 {
+			value = value[1 : end+1]
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(key)), value, true
+}
+
+// postgreSQLClientFiles is libpq's default root certificate for the user
+// running the tool, when it exists
+func postgreSQLClientFiles() []CAFile {
+	var path string
+	if runtime.GOOS == "windows" {
+		path = filepath.Join(os.Getenv("APPDATA"), "postgresql", "root.crt")
+	} else if home, err := os.UserHomeDir(); err == nil {
+		path = filepath.Join(home, ".postgresql", "root.crt")
+	}
+	return existingClientFile(path, "libpq default sslrootcert")
+}
+
+// mySQLCAOptions name CA files in any option group; MySQL accepts dashes
+// and underscores interchangeably
+var mySQLCAOptions = map[string]bool{"ssl-ca": true, "ssl_ca": true}
+
+// discoverMySQL reads my.cnf and the files it includes with !include and
+// !includedir for ssl-ca, in the server's and the clients' option groups
+func discoverMySQL(config string) ([]CAFile, error) {
+	var found []CAFile
+	visited := make(map[string]bool)
+
+	var walk func(path string, depth int) error
+	walk = func(path string, depth int) error {
+		if depth > maxIncludeDepth || visited[path] {
+			return nil
+		}
+		visited[path] = true
+		lines, err := readLines(path, false)
+		if err != nil {
+			if depth > 0 && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		dir := filepath.Dir(path)
+		for _, line := range lines {
+			switch {
+			case strings.HasPrefix(line, ";"): // comment
+			case strings.HasPrefix(line, "!includedir "):
+				target := absolute(dir, strings.TrimSpace(strings.TrimPrefix(line, "!includedir ")))
+				for _, pattern := range []string{"*.cnf", "*.ini"} {
+					for _, included := range globFiles(filepath.Join(target, pattern)) {
+						if err := walk(included, depth+1); err != nil {
+							return err
+						}
+					}
+				}
+			case strings.HasPrefix(line, "!include "):
+				if err := walk(absolute(dir, strings.TrimSpace(strings.TrimPrefix(line, "!include "))), depth+1); err != nil {
+					return err
+				}
+			default:
+				key, value, ok := strings.Cut(line, "=")
+				if !ok || !mySQLCAOptions[strings.ToLower(strings.TrimSpace(key))] {
+					continue
+				}
+				value = strings.Trim(strings.TrimSpace(value), `"'`)
+				if value != "" {
+					found = append(found, CAFile{Path: absolute(dir, value), ConfigFiles: []string{path}})
+				}
+			}
+		}
+		return nil
+	}
+	return found, walk(config, 0)
+}
+
+// mySQLClientFiles reads the ssl-ca options of the running user's ~/.my.cnf
+func mySQLClientFiles() []CAFile {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	found, _ := discoverMySQL(filepath.Join(home, ".my.cnf"))
+	return found
+}
+
+// existingClientFile returns path as a CA file when it exists: a missing
+// per-user file means the user doesn't verify servers, which this tool
+// shouldn't change
+func existingClientFile(path, detail string) []CAFile {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	return []CAFile{{Path: path, ConfigFiles: []string{detail}}}
+}
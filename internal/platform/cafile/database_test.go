@@ -0,0 +1,42 @@
+package cafile
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverPostgreSQL(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "etc", "postgresql.conf")
+	writeFile(t, conf, `data_directory = '`+filepath.Join(dir, "data")+`'  # use data in another directory
+ssl = on
+ssl_ca_file = 'old-root.crt'
+include_dir 'conf.d'
+include_if_exists 'missing.conf'
+`)
+	writeFile(t, filepath.Join(dir, "etc", "conf.d", "10-tls.conf"), "ssl_ca_file = 'internal-root.crt'\n")
+	found, err := discoverPostgreSQL(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CAFile{{Path: filepath.Join(dir, "data", "internal-root.crt"), ConfigFiles: []string{filepath.Join(dir, "etc", "conf.d", "10-tls.conf")}}}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("found %+v, want %+v", found, want)
+	}
+}
+
+func TestDiscoverMySQL(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "my.cnf")
+	writeFile(t, conf, "[client]\nssl-ca = \"/etc/mysql/ca.pem\"\n; ssl-ca = /commented.pem\n!includedir "+filepath.Join(dir, "conf.d")+"\n")
+	writeFile(t, filepath.Join(dir, "conf.d", "server.cnf"), "[mysqld]\nssl_ca=/etc/mysql/server-ca.pem\nssl-capath=/etc/mysql/cas\n")
+	found, err := discoverMySQL(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/etc/mysql/ca.pem", "/etc/mysql/server-ca.pem"}
+	if got := paths(found); !reflect.DeepEqual(got, want) {
+		t.Errorf("found %q, want %q", got, want)
+	}
+}
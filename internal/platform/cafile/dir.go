@@ -0,0 +1,238 @@
+package cafile
+
+import (
+	"bufio"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+)
+
+// dirFilePrefix names the certificate files this tool adds to a directory
+const dirFilePrefix = "trust-store-updater-"
+
+// dirBackupIndex lists the entries of a directory backup that were links
+const dirBackupIndex = "links.txt"
+
+// hashLinkName matches the subject hash links that rehash maintains
+var hashLinkName = regexp.MustCompile(`^[0-9a-f]{8}\.r?[0-9]+$`)
+
+// dirEntries returns the certificate files of a CA directory, skipping the
+// OpenSSL hash links that only duplicate them. A directory that doesn't
+// exist yet is empty.
+func dirEntries(dir string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []os.DirEntry
+	for _, e := range entries {
+		if hashLinkName.MatchString(e.Name()) || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if e.Type().IsRegular() || e.Type()&os.ModeSymlink != 0 {
+			files = append(files, e)
+		}
+	}
+	return files, nil
+}
+
+// readDir reads the certificates of each file in dir. Files that aren't
+// certificates are skipped, as OpenSSL and strongSwan skip them.
+func readDir(dir string) ([]*x509.Certificate, error) {
+	entries, err := dirEntries(dir)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, e := range entries {
+		b, err := readDirFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		certs = append(certs, b.certificates()...)
+	}
+	return certs, nil
+}
+
+// readDirFile reads a PEM file of a CA directory, or a single DER encoded
+// certificate as strongSwan also accepts
+func readDirFile(path string) (*bundle, error) {
+	b, err := readBundle(path)
+	if err != nil || len(b.blocks) > 0 || len(b.data) == 0 {
+		return b, err
+	}
+	if c, err := x509.ParseCertificate(b.data); err == nil {
+		b.blocks = []block{{cert: c, start: 0, end: len(b.data)}}
+	}
+	return b, nil
+}
+
+// addToDir writes c to its own file in dir unless a file there holds it,
+// then rehashes the directory
+func (s *Store) addToDir(dir string, c *x509.Certificate) (bool, error) {
+	certs, err := readDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, existing := range certs {
+		if existing.Equal(c) {
+			return false, nil
+		}
+	}
+	name := dirFilePrefix + fingerprint(c)[:16] + ".pem"
+	b := &bundle{path: filepath.Join(dir, name)}
+	b.add(c)
+	if err := s.write(b.path, b.data); err != nil {
+		return false, err
+	}
+	return true, s.rehash(dir)
+}
+
+// removeFromDir cuts c out of every file in dir holding it, deleting files
+// and links left without certificates, then rehashes the directory
+func (s *Store) removeFromDir(dir string, c *x509.Certificate) (bool, error) {
+	entries, err := dirEntries(dir)
+	if err != nil {
+		return false, err
+	}
+	removed := false
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		b, err := readDirFile(path)
+		if err != nil || !b.remove(c) {
+			continue
+		}
+		removed = true
+		// A link points into a directory this store doesn't own, so only
+		// the link goes
+		if len(b.blocks) == 0 || e.Type()&os.ModeSymlink != 0 {
+			err = os.Remove(path)
+		} else {
+			err = s.write(path, b.data)
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+	if !removed {
+		return false, nil
+	}
+	return true, s.rehash(dir)
+}
+
+// rehash recreates the subject hash links OpenSSL looks certificates up by,
+// with `openssl rehash` or the older c_rehash script. Applications that load
+// every file in the directory, such as strongSwan, need no links.
+func (s *Store) rehash(dir string) error {
+	if !applications[s.app].rehash {
+		return nil
+	}
+	_, err := s.runner.Run("openssl", "rehash", dir)
+	if errors.Is(err, exec.ErrNotFound) {
+		_, err = s.runner.Run("c_rehash", dir)
+	}
+	return err
+}
+
+// backupDir copies the certificate files of dir into backupPath, recording
+// links rather than the files they point at
+func backupDir(dir, backupPath string) error {
+	entries, err := dirEntries(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0700); err != nil {
+		return err
+	}
+	var links strings.Builder
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if e.Type()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&links, "%s\t%s\n", e.Name(), target)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := atomicfile.WriteFile(filepath.Join(backupPath, e.Name()), data, 0600); err != nil {
+			return err
+		}
+	}
+	return atomicfile.WriteFile(filepath.Join(backupPath, dirBackupIndex), []byte(links.String()), 0600)
+}
+
+// restoreDir puts the files and links of a backup made by backupDir back,
+// removes certificate files this tool added since, and rehashes
+func (s *Store) restoreDir(backupPath, dir string) error {
+	links := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(backupPath, dirBackupIndex))
+	if err != nil {
+		return fmt.Errorf("not a CA directory backup: %w", err)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		if name, target, ok := strings.Cut(scanner.Text(), "\t"); ok {
+			links[name] = target
+		}
+	}
+
+	backedUp, err := os.ReadDir(backupPath)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	for _, e := range backedUp {
+		if e.Name() == dirBackupIndex {
+			continue
+		}
+		keep[e.Name()] = true
+		data, err := os.ReadFile(filepath.Join(backupPath, e.Name()))
+		if err != nil {
+			return err
+		}
+		if err := s.write(filepath.Join(dir, e.Name()), data); err != nil {
+			return err
+		}
+	}
+	for name, target := range links {
+		keep[name] = true
+		path := filepath.Join(dir, name)
+		if current, err := os.Readlink(path); err == nil && current == target {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Symlink(target, path); err != nil {
+			return err
+		}
+	}
+
+	entries, err := dirEntries(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !keep[e.Name()] && strings.HasPrefix(e.Name(), dirFilePrefix) {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return s.rehash(dir)
+}
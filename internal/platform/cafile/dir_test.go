@@ -0,0 +1,91 @@
+//go:build unix
+
+package cafile
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestStoreCADirectory(t *testing.T) {
+	dir := t.TempDir()
+	// Record rehash runs instead of needing openssl
+	bin := filepath.Join(dir, "bin")
+	log := filepath.Join(dir, "rehash.log")
+	writeFile(t, filepath.Join(bin, "openssl"), "#!/bin/sh\necho \"$@\" >> "+log+"\n")
+	if err := os.Chmod(filepath.Join(bin, "openssl"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	caDir := filepath.Join(dir, "cacerts")
+	partner := certstoretest.NewCertificate(t, "Partner CA")
+	retired := certstoretest.NewCertificate(t, "Retired CA")
+	managed := certstoretest.NewCertificate(t, "Managed Root")
+	encode := func(c ...[]byte) string {
+		var out string
+		for _, der := range c {
+			out += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+		}
+		return out
+	}
+	writeFile(t, filepath.Join(caDir, "partners.pem"), encode(partner.Raw, retired.Raw))
+	writeFile(t, filepath.Join(caDir, "retired.pem"), encode(retired.Raw))
+	if err := os.Symlink("partners.pem", filepath.Join(caDir, "1a2b3c4d.0")); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStore("ldap", map[string]string{"ca_file": caDir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Files()[0].Dir {
+		t.Fatal("expected an existing directory to be managed as a CA directory")
+	}
+	backup := filepath.Join(dir, "backup")
+	if err := s.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddCertificate(managed); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveCertificate(retired); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := s.ListCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || !listed[0].Equal(partner) || !listed[1].Equal(managed) {
+		t.Errorf("listed %d certificates, want the partner and managed ones", len(listed))
+	}
+	if _, err := os.Stat(filepath.Join(caDir, "retired.pem")); !os.IsNotExist(err) {
+		t.Error("a file left without certificates should be deleted")
+	}
+	if data, _ := os.ReadFile(filepath.Join(caDir, "partners.pem")); string(data) != encode(partner.Raw) {
+		t.Errorf("partners.pem = %q", data)
+	}
+	added := filepath.Join(caDir, dirFilePrefix+fingerprint(managed)[:16]+".pem")
+	if _, err := os.Stat(added); err != nil {
+		t.Errorf("added certificate file: %v", err)
+	}
+
+	if err := s.Restore(backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(added); !os.IsNotExist(err) {
+		t.Error("restore should remove certificate files added since the backup")
+	}
+	if data, _ := os.ReadFile(filepath.Join(caDir, "retired.pem")); string(data) != encode(retired.Raw) {
+		t.Errorf("retired.pem not restored: %q", data)
+	}
+	runs, _ := os.ReadFile(log)
+	if want := "rehash " + caDir + "\n"; string(runs) != want+want+want {
+		t.Errorf("rehash runs = %q", runs)
+	}
+}
@@ -0,0 +1,68 @@
+package cafile
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// systemTrustPaths are the OS trust store's bundles and directories. LDAP
+// clients commonly point at them, and the system target already keeps
+// them current, so references to them are left alone.
+var systemTrustPaths = []string{
+	"/etc/ssl/certs",
+	"/etc/ssl/cert.pem",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/certs",
+	"/etc/pki/tls/cert.pem",
+	"/etc/pki/ca-trust",
+}
+
+// discoverLDAP reads an OpenLDAP ldap.conf for TLS_CACERT and
+// TLS_CACERTDIR, or an sssd.conf for ldap_tls_cacert and
+// ldap_tls_cacertdir in any domain section. Files and directories of the
+// OS trust store are skipped.
+func discoverLDAP(config string) ([]CAFile, error) {
+	lines, err := readLines(config, false)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(config)
+	var found []CAFile
+	for _, line := range lines {
+		if strings.HasPrefix(line, ";") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		var key, value string
+		if k, v, ok := strings.Cut(line, "="); ok {
+			// sssd.conf: key = value
+			key, value = strings.TrimSpace(k), strings.TrimSpace(v)
+		} else if fields := splitQuoted(line); len(fields) == 2 {
+			// ldap.conf: KEYWORD value
+			key, value = fields[0], fields[1]
+		}
+		var isDir bool
+		switch strings.ToLower(key) {
+		case "tls_cacert", "ldap_tls_cacert":
+		case "tls_cacertdir", "ldap_tls_cacertdir":
+			isDir = true
+		default:
+			continue
+		}
+		path := absolute(dir, value)
+		if value == "" || isSystemTrustPath(path) {
+			continue
+		}
+		found = append(found, CAFile{Path: path, Dir: isDir, ConfigFiles: []string{config}})
+	}
+	return found, nil
+}
+
+// isSystemTrustPath reports whether path is in one of systemTrustPaths
+func isSystemTrustPath(path string) bool {
+	for _, p := range systemTrustPaths {
+		if path == p || strings.HasPrefix(path, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
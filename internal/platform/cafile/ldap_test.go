@@ -0,0 +1,49 @@
+package cafile
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverLDAP(t *testing.T) {
+	dir := t.TempDir()
+	ldapConf := filepath.Join(dir, "ldap.conf")
+	writeFile(t, ldapConf, `# system-wide LDAP client defaults
+BASE	dc=example,dc=com
+TLS_CACERT	/etc/openldap/internal-ca.pem
+tls_cacertdir	cacerts
+TLS_REQCERT demand
+`)
+	found, err := discoverLDAP(ldapConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CAFile{
+		{Path: "/etc/openldap/internal-ca.pem", ConfigFiles: []string{ldapConf}},
+		{Path: filepath.Join(dir, "cacerts"), Dir: true, ConfigFiles: []string{ldapConf}},
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("found %+v, want %+v", found, want)
+	}
+
+	sssdConf := filepath.Join(dir, "sssd.conf")
+	writeFile(t, sssdConf, `[sssd]
+domains = corp, legacy
+
+[domain/corp]
+ldap_tls_cacert = /etc/sssd/pki/corp-ca.pem
+; ldap_tls_cacert = /etc/sssd/pki/old-ca.pem
+
+[domain/legacy]
+ldap_tls_cacert = /etc/pki/tls/certs/ca-bundle.crt
+`)
+	found, err = discoverLDAP(sssdConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []CAFile{{Path: "/etc/sssd/pki/corp-ca.pem", ConfigFiles: []string{sssdConf}}}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("found %+v, want %+v (system bundle skipped)", found, want)
+	}
+}
@@ -0,0 +1,474 @@
+// Package cafile manages the CA bundle files that applications such as web
+// servers, reverse proxies and databases read directly instead of the OS
+// trust store.
+// The files are found through the application's own configuration, or
+// configured explicitly.
+package cafile
+
+import (
+	"bufio"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// backupIndex names the file in a backup that maps copies to bundle paths
+const backupIndex = "ca-files.txt"
+
+// CAFile is a bundle file, or a directory of certificate files, and the
+// configuration files referencing it
+type CAFile struct {
+	Path        string
+	Dir         bool // a directory of certificate files
+	ConfigFiles []string
+	result      certstore.TargetResult
+}
+
+// application describes where an application keeps its configuration and
+// how to find the CA files it references
+type application struct {
+	configs  []string // glob patterns of main configuration files
+	every    bool     // discover from every match, e.g. each database cluster, not the first
+	discover func(config string) ([]CAFile, error)
+	client   func() []CAFile // per-user client files of the user running the tool
+	rehash   bool            // CA directories are OpenSSL hashed directories
+}
+
+var applications = map[string]application{
+	"nginx":   {configs: []string{"/etc/nginx/nginx.conf", "/usr/local/etc/nginx/nginx.conf"}, discover: discoverNginx},
+	"apache":  {configs: []string{"/etc/apache2/apache2.conf", "/etc/httpd/conf/httpd.conf"}, discover: discoverApache},
+	"haproxy": {configs: []string{"/etc/haproxy/haproxy.cfg"}, discover: discoverHAProxy},
+	"ldap": {
+		configs:  []string{"/etc/openldap/ldap.conf", "/etc/ldap/ldap.conf", "/etc/sssd/sssd.conf", "/etc/sssd/conf.d/*.conf"},
+		every:    true,
+		discover: discoverLDAP,
+		rehash:   true,
+	},
+	"openvpn": {
+		configs: []string{
+			"/etc/openvpn/*.conf", "/etc/openvpn/client/*.conf", "/etc/openvpn/server/*.conf",
+			"/etc/NetworkManager/system-connections/*.nmconnection",
+		},
+		every:    true,
+		discover: discoverOpenVPN,
+		rehash:   true,
+	},
+	"strongswan": {
+		configs: []string{
+			"/etc/ipsec.d/cacerts", "/etc/strongswan/ipsec.d/cacerts",
+			"/etc/swanctl/x509ca", "/etc/strongswan/swanctl/x509ca",
+		},
+		every:    true,
+		discover: discoverStrongSwan,
+	},
+	"postgresql": {
+		configs:  []string{"/etc/postgresql/*/*/postgresql.conf", "/var/lib/pgsql/data/postgresql.conf", "/var/lib/pgsql/*/data/postgresql.conf"},
+		every:    true,
+		discover: discoverPostgreSQL,
+		client:   postgreSQLClientFiles,
+	},
+	"mysql": {
+		configs:  []string{"/etc/mysql/my.cnf", "/etc/my.cnf"},
+		every:    true,
+		discover: discoverMySQL,
+		client:   mySQLClientFiles,
+	},
+}
+
+// defaultConfigs returns the main configuration files present on this host
+func (a application) defaultConfigs() []string {
+	var configs []string
+	for _, pattern := range a.configs {
+		matches, _ := filepath.Glob(pattern)
+		sort.Strings(matches)
+		for _, m := range matches {
+			configs = append(configs, m)
+			if !a.every {
+				return configs
+			}
+		}
+	}
+	return configs
+}
+
+// Applications returns the applications whose CA files can be discovered
+func Applications() []string {
+	names := make([]string, 0, len(applications))
+	for name := range applications {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Store keeps the same trusted certificates in each CA file of an
+// application. Other certificates and comments in the files are preserved.
+//
+// Options:
+//   - ca_file: comma separated bundle paths, or certificate directories;
+//     when unset the paths are discovered from the application's configuration
+//   - config: the main configuration file to discover from, instead of the
+//     platform default
+//   - file_mode, owner, group: for new files, and to change existing ones;
+//     rewritten files otherwise keep their mode and owner
+type Store struct {
+	app      string
+	files    []*CAFile
+	policy   certstore.FilePolicy
+	override bool // file_mode, owner or group was configured
+	runner   certstore.Runner
+	verbose  bool
+}
+
+// NewStore creates a store for the CA files of app
+func NewStore(app string, options map[string]string, verbose bool) (*Store, error) {
+	a, ok := applications[app]
+	if !ok {
+		return nil, fmt.Errorf("unsupported application %q", app)
+	}
+	policy, err := certstore.ParseFilePolicy(options)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		app:      app,
+		policy:   policy,
+		override: options["file_mode"] != "" || options["owner"] != "" || options["group"] != "",
+		runner:   &certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout, Verbose: verbose},
+		verbose:  verbose,
+	}
+
+	if value := options["ca_file"]; value != "" {
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				info, err := os.Stat(path)
+				s.files = append(s.files, &CAFile{Path: path, Dir: err == nil && info.IsDir()})
+			}
+		}
+		return s, nil
+	}
+
+	configs := a.defaultConfigs()
+	if config := options["config"]; config != "" {
+		configs = []string{config}
+	}
+	var found []CAFile
+	for _, config := range configs {
+		refs, err := a.discover(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s configuration: %w", app, err)
+		}
+		found = append(found, refs...)
+	}
+	if a.client != nil {
+		found = append(found, a.client()...)
+	}
+	s.files = mergeCAFiles(found)
+	if verbose {
+		for _, f := range s.files {
+			fmt.Printf("Found %s CA file %s (referenced by %s)\n", app, f.Path, strings.Join(f.ConfigFiles, ", "))
+		}
+	}
+	return s, nil
+}
+
+// mergeCAFiles collapses references to the same file, in discovery order
+func mergeCAFiles(found []CAFile) []*CAFile {
+	var files []*CAFile
+	byPath := make(map[string]*CAFile)
+	for _, f := range found {
+		path := filepath.Clean(f.Path)
+		if existing, ok := byPath[path]; ok {
+			for _, config := range f.ConfigFiles {
+				if !contains(existing.ConfigFiles, config) {
+					existing.ConfigFiles = append(existing.ConfigFiles, config)
+				}
+			}
+			continue
+		}
+		merged := &CAFile{Path: path, Dir: f.Dir, ConfigFiles: append([]string(nil), f.ConfigFiles...)}
+		byPath[path] = merged
+		files = append(files, merged)
+	}
+	return files
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Files returns the managed CA files
+func (s *Store) Files() []*CAFile {
+	return s.files
+}
+
+// SetCommandTimeout bounds each openssl rehash run
+func (s *Store) SetCommandTimeout(timeout time.Duration) {
+	certstore.SetRunnerTimeout(s.runner, timeout)
+}
+
+// IsSupported reports whether there is a CA file to manage
+func (s *Store) IsSupported() bool {
+	return len(s.files) > 0
+}
+
+// TargetResults reports the changes made to each CA file and the
+// configuration referencing it
+func (s *Store) TargetResults() []certstore.TargetResult {
+	results := make([]certstore.TargetResult, 0, len(s.files))
+	for _, f := range s.files {
+		r := f.result
+		r.Target = f.Path
+		r.Detail = strings.Join(f.ConfigFiles, ", ")
+		results = append(results, r)
+	}
+	return results
+}
+
+func (s *Store) check() error {
+	if len(s.files) == 0 {
+		return fmt.Errorf("no CA files found in the %s configuration; set options.ca_file", s.app)
+	}
+	return nil
+}
+
+// ListCertificates returns the certificates in every CA file, so a
+// certificate missing from any of them is added again
+func (s *Store) ListCertificates() ([]*x509.Certificate, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	certs := make(map[string]*x509.Certificate)
+	var order []string
+	for _, f := range s.files {
+		found, err := f.certificates()
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, c := range found {
+			fp := fingerprint(c)
+			if seen[fp] {
+				continue
+			}
+			seen[fp] = true
+			if counts[fp] == 0 {
+				order = append(order, fp)
+			}
+			counts[fp]++
+			certs[fp] = c
+		}
+	}
+
+	var common []*x509.Certificate
+	for _, fp := range order {
+		if counts[fp] == len(s.files) {
+			common = append(common, certs[fp])
+		}
+	}
+	return common, nil
+}
+
+// AddCertificate appends the certificate to each CA file lacking it,
+// continuing past files that fail
+func (s *Store) AddCertificate(c *x509.Certificate) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	var errs []error
+	for _, f := range s.files {
+		var added bool
+		var err error
+		if f.Dir {
+			added, err = s.addToDir(f.Path, c)
+		} else {
+			added, err = s.update(f.Path, func(b *bundle) bool { return b.add(c) })
+		}
+		if err != nil {
+			f.result.Failed++
+			f.result.Errors = append(f.result.Errors, err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", f.Path, err))
+		} else if added {
+			f.result.Added++
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveCertificate deletes the certificate from every CA file holding it
+func (s *Store) RemoveCertificate(c *x509.Certificate) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	var errs []error
+	for _, f := range s.files {
+		var removed bool
+		var err error
+		if f.Dir {
+			removed, err = s.removeFromDir(f.Path, c)
+		} else {
+			removed, err = s.update(f.Path, func(b *bundle) bool { return b.remove(c) })
+		}
+		if err != nil {
+			f.result.Failed++
+			f.result.Errors = append(f.result.Errors, err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", f.Path, err))
+		} else if removed {
+			f.result.Removed++
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// update rewrites path when change modifies its bundle
+func (s *Store) update(path string, change func(b *bundle) bool) (bool, error) {
+	b, err := readBundle(path)
+	if err != nil {
+		return false, err
+	}
+	if !change(b) {
+		return false, nil
+	}
+	return true, s.write(path, b.data)
+}
+
+// write replaces path, keeping an existing file's mode and owner unless the
+// store options set them. A symlinked path is replaced at its target, so the
+// link is kept.
+func (s *Store) write(path string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	info, err := os.Stat(path)
+	if err != nil || s.override {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return s.policy.WriteFile(path, data)
+	}
+	return atomicfile.WriteFileFunc(path, data, info.Mode().Perm(), func(tmp string) error {
+		return atomicfile.KeepOwner(tmp, info)
+	})
+}
+
+// Backup copies each CA file into the backup directory, with an index of
+// where each copy belongs. Files that don't exist yet are recorded as such.
+func (s *Store) Backup(backupPath string) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	var index strings.Builder
+	for i, f := range s.files {
+		if f.Dir {
+			name := fmt.Sprintf("%02d-%s", i, filepath.Base(f.Path))
+			if err := backupDir(f.Path, filepath.Join(backupPath, name)); err != nil {
+				return fmt.Errorf("failed to back up CA directory %s: %w", f.Path, err)
+			}
+			fmt.Fprintf(&index, "%s/\t%s\n", name, f.Path)
+			continue
+		}
+		data, err := os.ReadFile(f.Path)
+		if os.IsNotExist(err) {
+			fmt.Fprintf(&index, "-\t%s\n", f.Path)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to back up CA file %s: %w", f.Path, err)
+		}
+		name := fmt.Sprintf("%02d-%s", i, filepath.Base(f.Path))
+		if err := atomicfile.WriteFile(filepath.Join(backupPath, name), data, 0600); err != nil {
+			return err
+		}
+		fmt.Fprintf(&index, "%s\t%s\n", name, f.Path)
+	}
+	return atomicfile.WriteFile(filepath.Join(backupPath, backupIndex), []byte(index.String()), 0600)
+}
+
+// Restore puts CA files back from a backup made by Backup, removing files
+// that didn't exist when it was taken
+func (s *Store) Restore(backupPath string) error {
+	f, err := os.Open(filepath.Join(backupPath, backupIndex))
+	if err != nil {
+		return fmt.Errorf("not a CA file backup: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, path, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(name, "/") {
+			if err := s.restoreDir(filepath.Join(backupPath, name), path); err != nil {
+				return fmt.Errorf("failed to restore CA directory %s: %w", path, err)
+			}
+			continue
+		}
+		if name == "-" {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove CA file %s: %w", path, err)
+			}
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(backupPath, name))
+		if err != nil {
+			return err
+		}
+		if err := s.write(path, data); err != nil {
+			return fmt.Errorf("failed to restore CA file %s: %w", path, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// WritePaths returns the CA files and directories
+func (s *Store) WritePaths() []string {
+	paths := make([]string, 0, len(s.files))
+	for _, f := range s.files {
+		paths = append(paths, f.Path)
+	}
+	return paths
+}
+
+// Validate parses every CA file
+func (s *Store) Validate() error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	for _, f := range s.files {
+		if _, err := f.certificates(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// certificates reads the certificates in the file or directory
+func (f *CAFile) certificates() ([]*x509.Certificate, error) {
+	if f.Dir {
+		return readDir(f.Path)
+	}
+	b, err := readBundle(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	return b.certificates(), nil
+}
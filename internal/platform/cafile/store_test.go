@@ -0,0 +1,170 @@
+package cafile
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func paths(files []CAFile) []string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Path)
+	}
+	return out
+}
+
+func TestDiscoverNginx(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "nginx.conf"), `
+http {
+    include conf.d/*.conf;
+    # ssl_trusted_certificate /commented/out.pem;
+}`)
+	writeFile(t, filepath.Join(dir, "conf.d", "api.conf"), `
+server {
+    ssl_client_certificate "/etc/ssl/clients ca.pem";
+    location / {
+        proxy_ssl_trusted_certificate upstream-ca.pem; proxy_pass https://backend;
+        proxy_ssl_trusted_certificate $ca_file;
+    }
+}`)
+	found, err := discoverNginx(filepath.Join(dir, "nginx.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/etc/ssl/clients ca.pem", filepath.Join(dir, "upstream-ca.pem")}
+	if got := paths(found); !reflect.DeepEqual(got, want) {
+		t.Errorf("found %q, want %q", got, want)
+	}
+}
+
+func TestDiscoverApache(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "conf", "httpd.conf"), "ServerRoot \""+dir+"\"\nIncludeOptional conf.d\nInclude missing/*.conf\n")
+	writeFile(t, filepath.Join(dir, "conf.d", "ssl.conf"), "<VirtualHost *:443>\n  sslcacertificatefile pki/clients.pem\n  SSLProxyCACertificateFile \\\n    /etc/pki/upstream.pem\n  SSLCACertificateFile ${APACHE_CA}\n</VirtualHost>\n")
+	found, err := discoverApache(filepath.Join(dir, "conf", "httpd.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "pki", "clients.pem"), "/etc/pki/upstream.pem"}
+	if got := paths(found); !reflect.DeepEqual(got, want) {
+		t.Errorf("found %q, want %q", got, want)
+	}
+}
+
+func TestDiscoverHAProxy(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "haproxy.cfg"), `global
+    ca-base /etc/ssl/haproxy
+frontend https
+    bind :443 ssl crt site.pem ca-file clients.pem verify optional
+backend app
+    server s1 10.0.0.1:443 ssl verify required ca-file @system-ca
+    server s2 10.0.0.2:443 ssl verify required ca-file /etc/ssl/internal.pem # internal
+`)
+	found, err := discoverHAProxy(filepath.Join(dir, "haproxy.cfg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/etc/ssl/haproxy/clients.pem", "/etc/ssl/internal.pem"}
+	if got := paths(found); !reflect.DeepEqual(got, want) {
+		t.Errorf("found %q, want %q", got, want)
+	}
+}
+
+func TestStoreKeepsUnmanagedContent(t *testing.T) {
+	dir := t.TempDir()
+	pinned := certstoretest.NewCertificate(t, "Pinned Partner CA")
+	managed := certstoretest.NewCertificate(t, "Managed Root")
+	pinnedPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pinned.Raw}))
+
+	first := filepath.Join(dir, "first.pem")
+	writeFile(t, first, "# partner CA, do not remove\n"+strings.TrimSuffix(pinnedPEM, "\n"))
+	second := filepath.Join(dir, "new", "second.pem") // referenced but not created yet
+	s, err := NewStore("nginx", map[string]string{"ca_file": first + ", " + second}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup := filepath.Join(dir, "backup")
+	if err := s.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddCertificate(managed); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddCertificate(managed); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := s.ListCertificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || !listed[0].Equal(managed) {
+		t.Errorf("expected only the certificate in both files, got %d", len(listed))
+	}
+	if results := s.TargetResults(); results[0].Added != 1 || results[1].Added != 1 {
+		t.Errorf("results = %+v", results)
+	}
+
+	if err := s.RemoveCertificate(managed); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(first)
+	if want := "# partner CA, do not remove\n" + pinnedPEM; string(data) != want {
+		t.Errorf("first file = %q, want %q", data, want)
+	}
+
+	if err := s.AddCertificate(managed); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restore(backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(second); !os.IsNotExist(err) {
+		t.Error("restore should remove the file that didn't exist at backup time")
+	}
+	if data, _ := os.ReadFile(first); !strings.HasPrefix(string(data), "# partner CA") || strings.Count(string(data), "BEGIN") != 1 {
+		t.Errorf("first file not restored: %q", data)
+	}
+}
+
+func TestStoreWritesThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "shared", "ca-bundle.pem")
+	writeFile(t, target, "")
+	link := filepath.Join(dir, "nginx-ca.pem")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	s, err := NewStore("nginx", map[string]string{"ca_file": link}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddCertificate(certstoretest.NewCertificate(t, "Managed Root")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the CA file symlink was replaced: %v", err)
+	}
+	if data, _ := os.ReadFile(target); strings.Count(string(data), "BEGIN CERTIFICATE") != 1 {
+		t.Errorf("symlink target not updated: %q", data)
+	}
+}
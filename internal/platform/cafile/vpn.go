@@ -0,0 +1,72 @@
+package cafile
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// discoverOpenVPN reads an OpenVPN configuration for its ca and capath
+// options, or a NetworkManager keyfile for those of an OpenVPN connection.
+// Relative paths are relative to the configuration's directory, which the
+// openvpn-client and openvpn-server units run in. Inline <ca> blocks are
+// part of the configuration and are left alone.
+func discoverOpenVPN(config string) ([]CAFile, error) {
+	if strings.HasSuffix(config, ".nmconnection") {
+		return discoverNetworkManagerVPN(config)
+	}
+	lines, err := readLines(config, false)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(config)
+	var found []CAFile
+	for _, line := range lines {
+		fields := splitQuoted(line)
+		if len(fields) != 2 || (fields[0] != "ca" && fields[0] != "capath") || fields[1] == "[[INLINE]]" {
+			continue
+		}
+		path := absolute(dir, fields[1])
+		if !isSystemTrustPath(path) {
+			found = append(found, CAFile{Path: path, Dir: fields[0] == "capath", ConfigFiles: []string{config}})
+		}
+	}
+	return found, nil
+}
+
+// discoverNetworkManagerVPN reads the ca of the [vpn] section of an OpenVPN
+// connection keyfile
+func discoverNetworkManagerVPN(config string) ([]CAFile, error) {
+	lines, err := readLines(config, false)
+	if err != nil {
+		return nil, err
+	}
+	var section, ca string
+	openvpn := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != "vpn" {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "service-type":
+			openvpn = strings.HasSuffix(strings.TrimSpace(value), ".openvpn")
+		case "ca":
+			ca = strings.TrimSpace(value)
+		}
+	}
+	if !openvpn || ca == "" || !filepath.IsAbs(ca) || isSystemTrustPath(ca) {
+		return nil, nil
+	}
+	return []CAFile{{Path: ca, ConfigFiles: []string{config}}}, nil
+}
+
+// discoverStrongSwan manages a strongSwan CA directory whole: the legacy
+// ipsec.d/cacerts of the stroke interface, or swanctl's x509ca. strongSwan
+// loads every certificate file in it.
+func discoverStrongSwan(dir string) ([]CAFile, error) {
+	return []CAFile{{Path: dir, Dir: true, ConfigFiles: []string{"strongSwan CA directory"}}}, nil
+}
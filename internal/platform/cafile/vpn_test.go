@@ -0,0 +1,81 @@
+package cafile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestDiscoverOpenVPN(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "client", "office.conf")
+	writeFile(t, conf, `client
+remote vpn.example.com 1194
+; ca old-ca.crt
+ca "keys/office ca.crt"
+capath /etc/openvpn/cas
+<ca>
+-----BEGIN CERTIFICATE-----
+-----END CERTIFICATE-----
+</ca>
+`)
+	found, err := discoverOpenVPN(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CAFile{
+		{Path: filepath.Join(dir, "client", "keys", "office ca.crt"), ConfigFiles: []string{conf}},
+		{Path: "/etc/openvpn/cas", Dir: true, ConfigFiles: []string{conf}},
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("found %+v, want %+v", found, want)
+	}
+
+	keyfile := filepath.Join(dir, "Office.nmconnection")
+	writeFile(t, keyfile, `[connection]
+id=Office
+type=vpn
+
+[vpn]
+ca=/home/alex/.cert/office-ca.crt
+service-type=org.freedesktop.NetworkManager.openvpn
+`)
+	found, err = discoverOpenVPN(keyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []CAFile{{Path: "/home/alex/.cert/office-ca.crt", ConfigFiles: []string{keyfile}}}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("found %+v, want %+v", found, want)
+	}
+}
+
+func TestStrongSwanDERCertificates(t *testing.T) {
+	dir := t.TempDir()
+	existing := certstoretest.NewCertificate(t, "VPN Gateway CA")
+	der := filepath.Join(dir, "gateway-ca.der")
+	if err := os.WriteFile(der, existing.Raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore("strongswan", map[string]string{"ca_file": dir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// strongSwan needs no hash links, so no openssl run is expected
+	if err := s.AddCertificate(existing); err != nil {
+		t.Fatal(err)
+	}
+	if results := s.TargetResults(); results[0].Added != 0 {
+		t.Errorf("a certificate in a DER file should count as present, results = %+v", results)
+	}
+	if err := s.RemoveCertificate(existing); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(der); !os.IsNotExist(err) {
+		t.Error("removing the only certificate of a DER file should delete it")
+	}
+}
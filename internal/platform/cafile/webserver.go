@@ -0,0 +1,310 @@
+package cafile
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxIncludeDepth stops include loops in hand-written configurations
+const maxIncludeDepth = 16
+
+// nginxDirectives name CA files: for client certificate verification and
+// for verifying upstream servers
+var nginxDirectives = map[string]bool{
+	"ssl_trusted_certificate":       true,
+	"ssl_client_certificate":        true,
+	"proxy_ssl_trusted_certificate": true,
+	"grpc_ssl_trusted_certificate":  true,
+	"uwsgi_ssl_trusted_certificate": true,
+}
+
+// discoverNginx follows config and its includes for CA file directives.
+// Relative paths are relative to the directory of the main configuration,
+// nginx's configuration prefix.
+func discoverNginx(config string) ([]CAFile, error) {
+	prefix := filepath.Dir(config)
+	var found []CAFile
+	visited := make(map[string]bool)
+
+	var walk func(path string, depth int) error
+	walk = func(path string, depth int) error {
+		if depth > maxIncludeDepth || visited[path] {
+			return nil
+		}
+		visited[path] = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if depth > 0 && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		for _, stmt := range nginxStatements(string(data)) {
+			if len(stmt) != 2 {
+				continue
+			}
+			value := stmt[1]
+			switch {
+			case stmt[0] == "include":
+				for _, included := range globFiles(absolute(prefix, value)) {
+					if err := walk(included, depth+1); err != nil {
+						return err
+					}
+				}
+			case nginxDirectives[stmt[0]] && !strings.Contains(value, "$"):
+				found = append(found, CAFile{Path: absolute(prefix, value), ConfigFiles: []string{path}})
+			}
+		}
+		return nil
+	}
+	return found, walk(config, 0)
+}
+
+// nginxStatements splits an nginx configuration into the words of each
+// simple directive, dropping comments, quotes and block structure
+func nginxStatements(text string) [][]string {
+	var statements [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == '\\' && i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			} else if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			flush()
+		case r == ';' || r == '{' || r == '}':
+			flush()
+			if r == ';' && len(words) > 0 {
+				statements = append(statements, words)
+			}
+			words = nil
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			flush()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	return statements
+}
+
+// apacheDirectives name CA files, matched case-insensitively
+var apacheDirectives = map[string]bool{
+	"sslcacertificatefile":      true,
+	"sslproxycacertificatefile": true,
+}
+
+// discoverApache follows config and its Include and IncludeOptional
+// directives for CA file directives. Relative paths are relative to
+// ServerRoot, which defaults to the main configuration's directory.
+func discoverApache(config string) ([]CAFile, error) {
+	serverRoot := filepath.Dir(config)
+	var found []CAFile
+	visited := make(map[string]bool)
+
+	var walk func(path string, depth int) error
+	walk = func(path string, depth int) error {
+		if depth > maxIncludeDepth || visited[path] {
+			return nil
+		}
+		visited[path] = true
+		lines, err := readLines(path, true)
+		if err != nil {
+			if depth > 0 && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		for _, line := range lines {
+			fields := splitQuoted(line)
+			if len(fields) != 2 || strings.Contains(fields[1], "${") {
+				continue
+			}
+			directive, value := strings.ToLower(fields[0]), fields[1]
+			switch {
+			case directive == "serverroot":
+				serverRoot = value
+			case directive == "include" || directive == "includeoptional":
+				target := absolute(serverRoot, value)
+				if info, err := os.Stat(target); err == nil && info.IsDir() {
+					target = filepath.Join(target, "*")
+				}
+				for _, included := range globFiles(target) {
+					if err := walk(included, depth+1); err != nil {
+						return err
+					}
+				}
+			case apacheDirectives[directive]:
+				found = append(found, CAFile{Path: absolute(serverRoot, value), ConfigFiles: []string{path}})
+			}
+		}
+		return nil
+	}
+	return found, walk(config, 0)
+}
+
+// discoverHAProxy reads the ca-file arguments of bind, server and
+// default-server lines. Relative paths are relative to the global ca-base,
+// or to the configuration's directory without one. When config is a
+// directory, each .cfg file in it is read.
+func discoverHAProxy(config string) ([]CAFile, error) {
+	configs := []string{config}
+	if info, err := os.Stat(config); err == nil && info.IsDir() {
+		configs, _ = filepath.Glob(filepath.Join(config, "*.cfg"))
+		sort.Strings(configs)
+	}
+
+	var found []CAFile
+	for _, path := range configs {
+		lines, err := readLines(path, false)
+		if err != nil {
+			return nil, err
+		}
+		base := filepath.Dir(path)
+		for _, line := range lines {
+			fields := splitQuoted(line)
+			if len(fields) == 2 && fields[0] == "ca-base" {
+				base = fields[1]
+				continue
+			}
+			for i := 1; i+1 < len(fields); i++ {
+				// @system-ca and other @ names are not files
+				if fields[i] == "ca-file" && !strings.HasPrefix(fields[i+1], "@") {
+					found = append(found, CAFile{Path: absolute(base, fields[i+1]), ConfigFiles: []string{path}})
+				}
+			}
+		}
+	}
+	return found, nil
+}
+
+// readLines returns the lines of a configuration file without comments and
+// blank lines, joining backslash continuations when continuations is set
+func readLines(path string, continuations bool) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	var pending string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if continuations && strings.HasSuffix(line, "\\") {
+			pending += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		line = strings.TrimSpace(pending + line)
+		pending = ""
+		line = stripComment(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// stripComment cuts a line at the first # outside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return strings.TrimSpace(line[:i])
+		}
+	}
+	return line
+}
+
+// splitQuoted splits a line into whitespace separated words, keeping quoted
+// words whole
+func splitQuoted(line string) []string {
+	var fields []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				fields = append(fields, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		fields = append(fields, word.String())
+	}
+	return fields
+}
+
+// absolute resolves a configured path against base
+func absolute(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
+
+// globFiles returns the regular files matching pattern in lexical order, as
+// nginx and Apache include them
+func globFiles(pattern string) []string {
+	matches, _ := filepath.Glob(pattern)
+	sort.Strings(matches)
+	var files []string
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil && !info.IsDir() {
+			files = append(files, m)
+		}
+	}
+	return files
+}
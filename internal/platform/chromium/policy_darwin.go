@@ -0,0 +1,108 @@
+//go:build darwin
+
+package chromium
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// managedPreferences is where macOS keeps machine-wide managed policies
+const managedPreferences = "/Library/Managed Preferences"
+
+// bundleIDs are the preference domains each browser reads policy from
+var bundleIDs = map[string]string{
+	"chrome":   "com.google.Chrome",
+	"chromium": "org.chromium.Chromium",
+	"edge":     "com.microsoft.Edge",
+	"brave":    "com.brave.Browser",
+}
+
+// emptyPlist starts a managed preferences file that doesn't exist yet
+const emptyPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict/>
+</plist>
+`
+
+// plistPolicy keeps the policy in the browser's managed preferences,
+// edited with plutil
+type plistPolicy struct {
+	browser string
+	path    string
+	runner  certstore.Runner
+}
+
+func platformPolicy(browser string) (policy, error) {
+	id, ok := bundleIDs[browser]
+	if !ok {
+		return nil, fmt.Errorf("unsupported browser %q (want chrome, edge, chromium or brave)", browser)
+	}
+	return &plistPolicy{
+		browser: browser,
+		path:    filepath.Join(managedPreferences, id+".plist"),
+		runner:  certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout},
+	}, nil
+}
+
+func policySupported() bool {
+	_, err := exec.LookPath("plutil")
+	return err == nil
+}
+
+func (p *plistPolicy) Browser() string  { return p.browser }
+func (p *plistPolicy) Location() string { return p.path }
+
+func (p *plistPolicy) Read() ([]*x509.Certificate, error) {
+	if _, err := os.Stat(p.path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	out, err := p.runner.Run("plutil", "-extract", PolicyName, "json", "-o", "-", p.path)
+	if err != nil {
+		// plutil fails when the key is absent
+		return nil, nil
+	}
+	var values []string
+	if err := json.Unmarshal(out, &values); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", PolicyName, p.path, err)
+	}
+	return Decode(values)
+}
+
+func (p *plistPolicy) Write(certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		if _, err := os.Stat(p.path); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		stdout, stderr, err := p.runner.RunCaptured("plutil", "-remove", PolicyName, p.path)
+		if err != nil && !strings.Contains(string(stdout)+string(stderr), "No value to remove") {
+			return err
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(p.path); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+			return fmt.Errorf("failed to create managed preferences directory: %w", err)
+		}
+		if err := atomicfile.WriteFile(p.path, []byte(emptyPlist), 0644); err != nil {
+			return err
+		}
+	}
+	values, err := json.Marshal(Encode(certs))
+	if err != nil {
+		return err
+	}
+	_, err = p.runner.Run("plutil", "-replace", PolicyName, "-json", string(values), p.path)
+	return err
+}
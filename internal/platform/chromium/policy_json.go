@@ -0,0 +1,93 @@
+package chromium
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+)
+
+// policyFile is the managed policy file this tool owns in each browser's
+// policy directory; Chromium merges every JSON file it finds there
+const policyFile = "trust-store-updater.json"
+
+// jsonPolicy keeps the policy in a managed policy JSON file, as Chromium
+// reads it on Linux
+type jsonPolicy struct {
+	browser string
+	path    string
+}
+
+func newJSONPolicy(browser, dir string) *jsonPolicy {
+	return &jsonPolicy{browser: browser, path: filepath.Join(dir, policyFile)}
+}
+
+func (p *jsonPolicy) Browser() string  { return p.browser }
+func (p *jsonPolicy) Location() string { return p.path }
+
+func (p *jsonPolicy) read() (map[string]any, error) {
+	data, err := os.ReadFile(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]any{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	policies := map[string]any{}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", p.path, err)
+	}
+	return policies, nil
+}
+
+func (p *jsonPolicy) Read() ([]*x509.Certificate, error) {
+	policies, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := policies[PolicyName].([]any)
+	if !ok {
+		return nil, nil
+	}
+	values := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return Decode(values)
+}
+
+// Write updates CACertificates, keeping any other policies in the file, and
+// removes the file once it holds nothing
+func (p *jsonPolicy) Write(certs []*x509.Certificate) error {
+	policies, err := p.read()
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		delete(policies, PolicyName)
+	} else {
+		policies[PolicyName] = Encode(certs)
+	}
+	if len(policies) == 0 {
+		if err := os.Remove(p.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Browsers run as the user, so the policy must stay world readable
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return fmt.Errorf("failed to create policy directory: %w", err)
+	}
+	return atomicfile.WriteFile(p.path, append(data, '\n'), 0644)
+}
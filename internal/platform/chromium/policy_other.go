@@ -0,0 +1,25 @@
+//go:build !windows && !darwin
+
+package chromium
+
+import "fmt"
+
+// policyDirs are the managed policy directories of each browser on Linux
+var policyDirs = map[string]string{
+	"chrome":   "/etc/opt/chrome/policies/managed",
+	"chromium": "/etc/chromium/policies/managed",
+	"edge":     "/etc/opt/edge/policies/managed",
+	"brave":    "/etc/brave/policies/managed",
+}
+
+func platformPolicy(browser string) (policy, error) {
+	dir, ok := policyDirs[browser]
+	if !ok {
+		return nil, fmt.Errorf("unsupported browser %q (want chrome, edge, chromium or brave)", browser)
+	}
+	return newJSONPolicy(browser, dir), nil
+}
+
+func policySupported() bool {
+	return true
+}
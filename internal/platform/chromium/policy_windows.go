@@ -0,0 +1,93 @@
+//go:build windows
+
+package chromium
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// policyKeys are the machine policy keys each browser reads policy from
+var policyKeys = map[string]string{
+	"chrome":   `SOFTWARE\Policies\Google\Chrome`,
+	"chromium": `SOFTWARE\Policies\Chromium`,
+	"edge":     `SOFTWARE\Policies\Microsoft\Edge`,
+	"brave":    `SOFTWARE\Policies\BraveSoftware\Brave`,
+}
+
+// registryPolicy keeps the policy as a list policy: a CACertificates subkey
+// with one numbered string value per certificate
+type registryPolicy struct {
+	browser string
+	key     string
+}
+
+func platformPolicy(browser string) (policy, error) {
+	key, ok := policyKeys[browser]
+	if !ok {
+		return nil, fmt.Errorf("unsupported browser %q (want chrome, edge, chromium or brave)", browser)
+	}
+	return &registryPolicy{browser: browser, key: key + `\` + PolicyName}, nil
+}
+
+func policySupported() bool {
+	return true
+}
+
+func (p *registryPolicy) Browser() string  { return p.browser }
+func (p *registryPolicy) Location() string { return `HKLM\` + p.key }
+
+func (p *registryPolicy) Read() ([]*x509.Certificate, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, p.key, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	names, err := k.ReadValueNames(0)
+	if err != nil {
+		return nil, err
+	}
+	// List policies are ordered by their numeric value names
+	sort.Slice(names, func(i, j int) bool {
+		a, _ := strconv.Atoi(names[i])
+		b, _ := strconv.Atoi(names[j])
+		return a < b
+	})
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		if v, _, err := k.GetStringValue(name); err == nil {
+			values = append(values, v)
+		}
+	}
+	return Decode(values)
+}
+
+// Write replaces the whole list so no stale numbered values are left behind
+func (p *registryPolicy) Write(certs []*x509.Certificate) error {
+	if err := registry.DeleteKey(registry.LOCAL_MACHINE, p.key); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return err
+	}
+	if len(certs) == 0 {
+		return nil
+	}
+	k, _, err := registry.CreateKey(registry.LOCAL_MACHINE, p.key, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	for i, v := range Encode(certs) {
+		if err := k.SetStringValue(strconv.Itoa(i+1), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// Package chromium trusts certificates in Chromium-based browsers through
+// their enterprise CACertificates policy, so Chrome, Edge and other browsers
+// and Electron apps that honor enterprise policy trust the managed roots even
+// where they don't read the OS store. Policies are written as managed JSON
+// files on Linux, managed preferences on macOS and registry policy keys on
+// Windows.
+package chromium
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// PolicyName is the Chromium policy listing additional trusted CAs
+const PolicyName = "CACertificates"
+
+// DefaultBrowsers are the browsers whose policy is written when options.browsers is unset
+var DefaultBrowsers = []string{"chrome", "edge"}
+
+// policy is one browser's CACertificates policy on this platform
+type policy interface {
+	Browser() string
+	Location() string
+	// Read returns the certificates in the policy; none if it isn't set
+	Read() ([]*x509.Certificate, error)
+	// Write replaces the certificates in the policy, removing it when empty
+	Write(certs []*x509.Certificate) error
+}
+
+// Store keeps the same certificates in the CACertificates policy of each
+// selected browser.
+//
+// Options:
+//   - browsers: comma separated list of chrome, edge, chromium and brave
+//     (default chrome,edge)
+type Store struct {
+	policies []policy
+}
+
+// NewStore creates a store for the browsers selected by options
+func NewStore(options map[string]string) (*Store, error) {
+	browsers := DefaultBrowsers
+	if configured := options["browsers"]; configured != "" {
+		browsers = nil
+		for _, b := range strings.Split(configured, ",") {
+			if b = strings.TrimSpace(b); b != "" {
+				browsers = append(browsers, b)
+			}
+		}
+	}
+
+	s := &Store{}
+	for _, browser := range browsers {
+		p, err := platformPolicy(browser)
+		if err != nil {
+			return nil, err
+		}
+		s.policies = append(s.policies, p)
+	}
+	return s, nil
+}
+
+// IsSupported reports whether policies can be written on this platform
+func (s *Store) IsSupported() bool {
+	return len(s.policies) > 0 && policySupported()
+}
+
+// ListCertificates returns the certificates in every selected browser's
+// policy, so one missing from any browser is added again
+func (s *Store) ListCertificates() ([]*x509.Certificate, error) {
+	counts := make(map[string]int)
+	certs := make(map[string]*x509.Certificate)
+	for _, p := range s.policies {
+		current, err := p.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s policy %s: %w", p.Browser(), p.Location(), err)
+		}
+		seen := make(map[string]bool)
+		for _, c := range current {
+			fp := cert.GetCertificateFingerprint(c)
+			if !seen[fp] {
+				seen[fp] = true
+				counts[fp]++
+				certs[fp] = c
+			}
+		}
+	}
+
+	var common []*x509.Certificate
+	for fp, n := range counts {
+		if n == len(s.policies) {
+			common = append(common, certs[fp])
+		}
+	}
+	sort.Slice(common, func(i, j int) bool { return common[i].Subject.String() < common[j].Subject.String() })
+	return common, nil
+}
+
+// AddCertificate adds the certificate to each browser policy lacking it
+func (s *Store) AddCertificate(c *x509.Certificate) error {
+	var errs []error
+	for _, p := range s.policies {
+		current, err := p.Read()
+		if err == nil && !certstore.ContainsCertificate(current, c) {
+			err = p.Write(append(current, c))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s policy: %w", p.Browser(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveCertificate drops the certificate from every browser policy
+func (s *Store) RemoveCertificate(c *x509.Certificate) error {
+	var errs []error
+	for _, p := range s.policies {
+		current, err := p.Read()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s policy: %w", p.Browser(), err))
+			continue
+		}
+		kept := make([]*x509.Certificate, 0, len(current))
+		for _, existing := range current {
+			if !existing.Equal(c) {
+				kept = append(kept, existing)
+			}
+		}
+		if len(kept) == len(current) {
+			continue
+		}
+		if err := p.Write(kept); err != nil {
+			errs = append(errs, fmt.Errorf("%s policy: %w", p.Browser(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backupFile is the file a backup directory holds each browser's policy in
+const backupFile = "cacertificates.json"
+
+// Backup saves each browser's policy, base64 DER by browser name
+func (s *Store) Backup(backupPath string) error {
+	saved := make(map[string][]string)
+	for _, p := range s.policies {
+		current, err := p.Read()
+		if err != nil {
+			return fmt.Errorf("failed to read %s policy %s: %w", p.Browser(), p.Location(), err)
+		}
+		saved[p.Browser()] = Encode(current)
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return atomicfile.WriteFile(filepath.Join(backupPath, backupFile), data, 0600)
+}
+
+// Restore writes back the policies saved by Backup
+func (s *Store) Restore(backupPath string) error {
+	data, err := os.ReadFile(filepath.Join(backupPath, backupFile))
+	if err != nil {
+		return fmt.Errorf("not a chromium policy backup: %w", err)
+	}
+	var saved map[string][]string
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid chromium policy backup: %w", err)
+	}
+	for _, p := range s.policies {
+		encoded, ok := saved[p.Browser()]
+		if !ok {
+			continue
+		}
+		certs, err := Decode(encoded)
+		if err != nil {
+			return err
+		}
+		if err := p.Write(certs); err != nil {
+			return fmt.Errorf("failed to restore %s policy: %w", p.Browser(), err)
+		}
+	}
+	return nil
+}
+
+// Encode formats certificates as the policy expects: base64 DER
+func Encode(certs []*x509.Certificate) []string {
+	encoded := make([]string, 0, len(certs))
+	for _, c := range certs {
+		encoded = append(encoded, base64.StdEncoding.EncodeToString(c.Raw))
+	}
+	return encoded
+}
+
+// Decode parses policy values, accepting PEM as well as base64 DER
+func Decode(values []string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, "-----BEGIN") {
+			parsed, err := certstore.ParsePEMBundle([]byte(v))
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, parsed...)
+			continue
+		}
+		der, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry: %w", PolicyName, err)
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry: %w", PolicyName, err)
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
@@ -0,0 +1,103 @@
+package chromium
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestJSONPolicies(t *testing.T) {
+	dir := t.TempDir()
+	chrome := newJSONPolicy("chrome", filepath.Join(dir, "chrome"))
+	edge := newJSONPolicy("edge", filepath.Join(dir, "edge"))
+	s := &Store{policies: []policy{chrome, edge}}
+
+	// Other policies an administrator put in the file are kept
+	if err := os.MkdirAll(filepath.Dir(edge.path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(edge.path, []byte(`{"HomepageLocation": "https://intranet.example"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := certstoretest.NewCertificate(t, "Example Root")
+	other := certstoretest.NewCertificate(t, "Other Root")
+	if err := s.AddCertificate(root); err != nil {
+		t.Fatalf("AddCertificate: %v", err)
+	}
+	if err := s.AddCertificate(root); err != nil {
+		t.Fatalf("AddCertificate again: %v", err)
+	}
+	// A certificate only one browser trusts isn't listed, so it is added again
+	if err := chrome.Write([]*x509.Certificate{root, other}); err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := s.ListCertificates()
+	if err != nil {
+		t.Fatalf("ListCertificates: %v", err)
+	}
+	if len(listed) != 1 || !listed[0].Equal(root) {
+		t.Fatalf("expected only the root trusted by both browsers, got %d certificates", len(listed))
+	}
+
+	data, err := os.ReadFile(edge.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var policies map[string]any
+	if err := json.Unmarshal(data, &policies); err != nil {
+		t.Fatal(err)
+	}
+	if policies["HomepageLocation"] != "https://intranet.example" {
+		t.Fatalf("other policies were not kept: %s", data)
+	}
+	if values, _ := policies[PolicyName].([]any); len(values) != 1 {
+		t.Fatalf("expected one %s entry, got %s", PolicyName, data)
+	}
+
+	backup := filepath.Join(dir, "backup")
+	if err := s.Backup(backup); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if err := s.RemoveCertificate(root); err != nil {
+		t.Fatalf("RemoveCertificate: %v", err)
+	}
+	if err := s.RemoveCertificate(other); err != nil {
+		t.Fatalf("RemoveCertificate: %v", err)
+	}
+	if _, err := os.Stat(chrome.path); !os.IsNotExist(err) {
+		t.Fatalf("expected the emptied policy file to be removed, got %v", err)
+	}
+	if _, err := os.Stat(edge.path); err != nil {
+		t.Fatalf("expected the file with other policies to stay: %v", err)
+	}
+
+	if err := s.Restore(backup); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	restored, err := chrome.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 {
+		t.Fatalf("expected chrome's two certificates back, got %d", len(restored))
+	}
+}
+
+func TestNewStoreBrowsers(t *testing.T) {
+	s, err := NewStore(map[string]string{"browsers": "chrome, brave"})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if len(s.policies) != 2 || s.policies[1].Browser() != "brave" {
+		t.Fatalf("unexpected policies for %d browsers", len(s.policies))
+	}
+	if _, err := NewStore(map[string]string{"browsers": "netscape"}); err == nil {
+		t.Fatal("expected an unknown browser to be rejected")
+	}
+}
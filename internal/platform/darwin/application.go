@@ -1,17 +1,23 @@
 package darwin
 
 import (
+	"crypto"
 	"crypto/x509"
 	"fmt"
+	"time"
 
 	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/chromium"
+	"github.com/webprofusion/trust-store-updater/internal/platform/java"
 )
 
 // ApplicationStore implements certificate store operations for macOS application stores
 type ApplicationStore struct {
-	target  string
-	options map[string]string
-	verbose bool
+	target   string
+	options  map[string]string
+	verbose  bool
+	java     *java.Store     // java-cacerts keystores
+	chromium *chromium.Store // chromium-policy browser policies
 }
 
 // NewApplicationStore creates a new macOS application certificate store
@@ -27,6 +33,22 @@ func NewApplicationStore(target string, options map[string]string, verbose bool)
 		return nil, fmt.Errorf("unsupported application store target: %s", target)
 	}
 
+	if target == "java-cacerts" {
+		javaStore, err := java.NewStore(options, verbose)
+		if err != nil {
+			return nil, err
+		}
+		store.java = javaStore
+	}
+
+	if target == "chromium-policy" {
+		chromiumStore, err := chromium.NewStore(options)
+		if err != nil {
+			return nil, err
+		}
+		store.chromium = chromiumStore
+	}
+
 	return store, nil
 }
 
@@ -48,6 +70,8 @@ func (a *ApplicationStore) IsSupported() bool {
 		return a.hasChrome()
 	case "safari":
 		return a.hasSafari()
+	case "chromium-policy":
+		return a.hasChromiumPolicy()
 	default:
 		return false
 	}
@@ -66,6 +90,8 @@ func (a *ApplicationStore) RequiresRoot() bool {
 		return false
 	case "safari":
 		return false // Safari uses system keychain
+	case "chromium-policy":
+		return true // Machine-wide browser policy
 	default:
 		return false
 	}
@@ -84,6 +110,8 @@ func (a *ApplicationStore) ListCertificates() ([]*x509.Certificate, error) {
 		return a.listChromeCertificates()
 	case "safari":
 		return a.listSafariCertificates()
+	case "chromium-policy":
+		return a.listChromiumPolicyCertificates()
 	default:
 		return nil, fmt.Errorf("unsupported target: %s", a.target)
 	}
@@ -102,11 +130,64 @@ func (a *ApplicationStore) AddCertificate(cert *x509.Certificate) error {
 		return a.addChromeCertificate(cert)
 	case "safari":
 		return a.addSafariCertificate(cert)
+	case "chromium-policy":
+		return a.addChromiumPolicyCertificate(cert)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
 }
 
+// AddCertificateWithLabel adds a certificate under an alias where the
+// application has one (java-cacerts); other targets ignore the label
+func (a *ApplicationStore) AddCertificateWithLabel(cert *x509.Certificate, label string) error {
+	if a.java != nil {
+		return a.java.AddCertificateWithLabel(cert, label)
+	}
+	return a.AddCertificate(cert)
+}
+
+// SupportedPurposes returns the trust purposes java-cacerts can limit trust
+// to; other targets can't limit trust
+func (a *ApplicationStore) SupportedPurposes() []string {
+	if a.java != nil {
+		return a.java.SupportedPurposes()
+	}
+	return nil
+}
+
+// AddCertificateForPurposes adds a certificate limited to purposes
+func (a *ApplicationStore) AddCertificateForPurposes(cert *x509.Certificate, label string, purposes []string) error {
+	if a.java != nil {
+		return a.java.AddCertificateForPurposes(cert, label, purposes)
+	}
+	return fmt.Errorf("application %s can't limit trust to purposes", a.target)
+}
+
+// AddCertificateWithKey stores a leaf certificate and its key in the
+// java-cacerts keystores; other targets hold no keys
+func (a *ApplicationStore) AddCertificateWithKey(chain []*x509.Certificate, key crypto.Signer, label string) error {
+	if a.java != nil {
+		return a.java.AddCertificateWithKey(chain, key, label)
+	}
+	return fmt.Errorf("application %s can't hold private keys", a.target)
+}
+
+// TargetResults reports each Java keystore's changes for java-cacerts
+func (a *ApplicationStore) TargetResults() []certstore.TargetResult {
+	if a.java == nil {
+		return nil
+	}
+	return a.java.TargetResults()
+}
+
+// WritePaths returns the Java keystores the store changes
+func (a *ApplicationStore) WritePaths() []string {
+	if a.java == nil {
+		return nil
+	}
+	return a.java.WritePaths()
+}
+
 // RemoveCertificate removes a certificate from the store
 func (a *ApplicationStore) RemoveCertificate(cert *x509.Certificate) error {
 	switch a.target {
@@ -120,6 +201,8 @@ func (a *ApplicationStore) RemoveCertificate(cert *x509.Certificate) error {
 		return a.removeChromeCertificate(cert)
 	case "safari":
 		return a.removeSafariCertificate(cert)
+	case "chromium-policy":
+		return a.removeChromiumPolicyCertificate(cert)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
@@ -138,6 +221,8 @@ func (a *ApplicationStore) Backup(backupPath string) error {
 		return a.backupChrome(backupPath)
 	case "safari":
 		return a.backupSafari(backupPath)
+	case "chromium-policy":
+		return a.backupChromiumPolicy(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
@@ -156,11 +241,20 @@ func (a *ApplicationStore) Restore(backupPath string) error {
 		return a.restoreChrome(backupPath)
 	case "safari":
 		return a.restoreSafari(backupPath)
+	case "chromium-policy":
+		return a.restoreChromiumPolicy(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
 }
 
+// SetCommandTimeout bounds keytool runs for java-cacerts
+func (a *ApplicationStore) SetCommandTimeout(timeout time.Duration) {
+	if a.java != nil {
+		a.java.SetCommandTimeout(timeout)
+	}
+}
+
 // Validate checks if the store is in a valid state
 func (a *ApplicationStore) Validate() error {
 	if !a.IsSupported() {
@@ -171,9 +265,14 @@ func (a *ApplicationStore) Validate() error {
 
 // Helper methods
 
+// ApplicationTargets returns every application store target known on this platform,
+// whether or not it is available on this machine
+func ApplicationTargets() []string {
+	return []string{"docker", "java-cacerts", "firefox", "chrome", "safari", "chromium-policy"}
+}
+
 func isValidApplicationTarget(target string) bool {
-	validTargets := []string{"docker", "java-cacerts", "firefox", "chrome", "safari"}
-	for _, valid := range validTargets {
+	for _, valid := range ApplicationTargets() {
 		if target == valid {
 			return true
 		}
@@ -186,7 +285,11 @@ func (a *ApplicationStore) hasDocker() bool {
 }
 
 func (a *ApplicationStore) hasJava() bool {
-	return false // Placeholder
+	return a.java.IsSupported()
+}
+
+func (a *ApplicationStore) hasChromiumPolicy() bool {
+	return a.chromium.IsSupported()
 }
 
 func (a *ApplicationStore) hasFirefox() bool {
@@ -224,23 +327,23 @@ func (a *ApplicationStore) restoreDocker(backupPath string) error {
 
 // Java operations
 func (a *ApplicationStore) listJavaCertificates() ([]*x509.Certificate, error) {
-	return nil, fmt.Errorf("java certificate listing not implemented")
+	return a.java.ListCertificates()
 }
 
 func (a *ApplicationStore) addJavaCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("java certificate addition not implemented")
+	return a.java.AddCertificate(cert)
 }
 
 func (a *ApplicationStore) removeJavaCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("java certificate removal not implemented")
+	return a.java.RemoveCertificate(cert)
 }
 
 func (a *ApplicationStore) backupJava(backupPath string) error {
-	return fmt.Errorf("java backup not implemented")
+	return a.java.Backup(backupPath)
 }
 
 func (a *ApplicationStore) restoreJava(backupPath string) error {
-	return fmt.Errorf("java restore not implemented")
+	return a.java.Restore(backupPath)
 }
 
 // Firefox operations
@@ -306,3 +409,24 @@ func (a *ApplicationStore) backupSafari(backupPath string) error {
 func (a *ApplicationStore) restoreSafari(backupPath string) error {
 	return fmt.Errorf("safari restore not implemented")
 }
+
+// Chromium policy operations
+func (a *ApplicationStore) listChromiumPolicyCertificates() ([]*x509.Certificate, error) {
+	return a.chromium.ListCertificates()
+}
+
+func (a *ApplicationStore) addChromiumPolicyCertificate(cert *x509.Certificate) error {
+	return a.chromium.AddCertificate(cert)
+}
+
+func (a *ApplicationStore) removeChromiumPolicyCertificate(cert *x509.Certificate) error {
+	return a.chromium.RemoveCertificate(cert)
+}
+
+func (a *ApplicationStore) backupChromiumPolicy(backupPath string) error {
+	return a.chromium.Backup(backupPath)
+}
+
+func (a *ApplicationStore) restoreChromiumPolicy(backupPath string) error {
+	return a.chromium.Restore(backupPath)
+}
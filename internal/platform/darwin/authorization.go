@@ -0,0 +1,78 @@
+package darwin
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// TrustSettingsRight is the authorization right macOS checks before admin
+// trust settings change. By default it asks for an administrator's password
+// in a dialog, even for root, so unattended runs can't change them.
+const TrustSettingsRight = "com.apple.trust-settings.admin"
+
+// ruleValue matches the rule or class of an authorizationdb plist
+var ruleValue = regexp.MustCompile(`<key>(rule|class)</key>\s*(?:<array>\s*)?<string>([^<]*)</string>`)
+
+// Grants of TrustSettingsRight that don't prompt
+const (
+	grantRoot     = "is-root" // root only, as PreauthorizeTrustSettings writes
+	grantEveryone = "allow"   // any process, unprivileged ones included
+)
+
+// trustSettingsGrant reads how TrustSettingsRight is granted without
+// interaction: grantRoot, grantEveryone, or "" when it prompts. MDM profiles
+// may grant it either way.
+func trustSettingsGrant(runner certstore.Runner) (string, error) {
+	output, err := runner.Run("security", "authorizationdb", "read", TrustSettingsRight)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the %s right: %w", TrustSettingsRight, err)
+	}
+	return authorizationGrant(output), nil
+}
+
+// trustSettingsAuthorized reads whether TrustSettingsRight is granted
+// without interaction
+func trustSettingsAuthorized(runner certstore.Runner) (bool, error) {
+	grant, err := trustSettingsGrant(runner)
+	return grant != "", err
+}
+
+// authorizationGrant returns how an authorizationdb definition grants the
+// right without a prompt: grantEveryone for class or rule allow, grantRoot
+// for the built-in is-root rule, or ""
+func authorizationGrant(plist []byte) string {
+	grant := ""
+	for _, m := range ruleValue.FindAllSubmatch(plist, -1) {
+		switch string(m[2]) {
+		case grantEveryone:
+			return grantEveryone
+		case grantRoot:
+			grant = grantRoot
+		}
+	}
+	return grant
+}
+
+// PreauthorizeTrustSettings lets root change TrustSettingsRight without a
+// prompt, so a daemon can change System keychain trust settings unattended.
+// Other users still authenticate. Managed Macs should prefer an MDM profile;
+// this changes the local policy database.
+func PreauthorizeTrustSettings() error {
+	return preauthorizeTrustSettings(&certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout})
+}
+
+// preauthorizeTrustSettings writes the root-only grant with runner
+func preauthorizeTrustSettings(runner certstore.Runner) error {
+	if _, err := runner.Run("security", "authorizationdb", "write", TrustSettingsRight, grantRoot); err != nil {
+		return fmt.Errorf("failed to pre-authorize %s: %w", TrustSettingsRight, err)
+	}
+	return nil
+}
+
+// TrustSettingsAuthorized reports whether System keychain trust settings can
+// be changed without a prompt
+func TrustSettingsAuthorized() (bool, error) {
+	return trustSettingsAuthorized(&certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout})
+}
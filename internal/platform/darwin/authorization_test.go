@@ -0,0 +1,43 @@
+package darwin
+
+import "testing"
+
+func TestAuthorizationGrant(t *testing.T) {
+	cases := []struct {
+		name  string
+		plist string
+		want  string
+	}{
+		{"default prompts", `<dict>
+	<key>class</key>
+	<string>rule</string>
+	<key>rule</key>
+	<array>
+		<string>authenticate-admin</string>
+	</array>
+</dict>`, ""},
+		{"allow rule", `<dict>
+	<key>class</key>
+	<string>rule</string>
+	<key>rule</key>
+	<array>
+		<string>allow</string>
+	</array>
+</dict>`, grantEveryone},
+		{"root rule", `<dict>
+	<key>class</key>
+	<string>rule</string>
+	<key>rule</key>
+	<array>
+		<string>is-root</string>
+	</array>
+</dict>`, grantRoot},
+		{"allow class", `<dict><key>class</key><string>allow</string></dict>`, grantEveryone},
+		{"comment mentions allow", `<dict><key>comment</key><string>allow</string><key>rule</key><string>authenticate-admin</string></dict>`, ""},
+	}
+	for _, c := range cases {
+		if got := authorizationGrant([]byte(c.plist)); got != c.want {
+			t.Errorf("%s: authorizationGrant = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package darwin
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// systemKeychain holds the administrator-added roots; Apple's own roots are
+// in the read-only SystemRootCertificates keychain
+const systemKeychain = "/Library/Keychains/System.keychain"
+
+// Files a System keychain backup directory holds
+const (
+	keychainBackupFile      = "System.keychain.pem"
+	trustSettingsBackupFile = "trust-settings.plist"
+)
+
+// allowPrompt reports whether options.allow_prompt lets security ask for an
+// administrator instead of failing when the trust settings right isn't
+// pre-authorized, for interactive use
+func (s *SystemStore) allowPrompt() bool {
+	return s.options["allow_prompt"] == "true"
+}
+
+// checkAuthorized fails fast with an actionable error rather than letting
+// security wait for a dialog nobody will answer
+func (s *SystemStore) checkAuthorized() error {
+	if s.allowPrompt() {
+		return nil
+	}
+	authorized, err := trustSettingsAuthorized(s.runner)
+	if err != nil {
+		return err
+	}
+	if !authorized {
+		return fmt.Errorf("changing System keychain trust requires the %s right, which would prompt for an administrator; "+
+			"grant it with an MDM profile, run `trust-store-updater doctor --fix`, or set options.allow_prompt: \"true\" to answer the prompt", TrustSettingsRight)
+	}
+	return nil
+}
+
+func (s *SystemStore) listSystemKeychainCertificates() ([]*x509.Certificate, error) {
+	output, err := s.runner.Run("security", "find-certificate", "-a", "-p", systemKeychain)
+	if err != nil {
+		return nil, err
+	}
+	return certstore.ParsePEMBundle(output)
+}
+
+// withCertificateFile writes certs to a temporary PEM file for security
+func withCertificateFile(certs []*x509.Certificate, fn func(path string) error) error {
+	f, err := os.CreateTemp("", "trust-store-updater-*.pem")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(certstore.EncodePEMBundle(certs))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return fn(f.Name())
+}
+
+func (s *SystemStore) addSystemKeychainCertificate(cert *x509.Certificate) error {
+	if err := s.checkAuthorized(); err != nil {
+		return err
+	}
+	return withCertificateFile([]*x509.Certificate{cert}, func(path string) error {
+		_, err := s.runner.Run("security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", systemKeychain, path)
+		return err
+	})
+}
+
+// removeSystemKeychainCertificate drops the certificate's admin trust
+// settings, then the certificate itself
+func (s *SystemStore) removeSystemKeychainCertificate(cert *x509.Certificate) error {
+	if err := s.checkAuthorized(); err != nil {
+		return err
+	}
+	err := withCertificateFile([]*x509.Certificate{cert}, func(path string) error {
+		_, err := s.runner.Run("security", "remove-trusted-cert", "-d", path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.runner.Run("security", "delete-certificate", "-Z", sha1Hash(cert), systemKeychain)
+	return err
+}
+
+// sha1Hash is how security delete-certificate identifies a certificate
+func sha1Hash(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// backupSystemKeychain saves the keychain's certificates and the admin
+// trust settings that make them trusted
+func (s *SystemStore) backupSystemKeychain(backupPath string) error {
+	certs, err := s.listSystemKeychainCertificates()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(filepath.Join(backupPath, keychainBackupFile), certstore.EncodePEMBundle(certs), 0600); err != nil {
+		return err
+	}
+	// Exporting fails when no admin trust settings exist, which is fine to back up as none
+	if _, err := s.runner.Run("security", "trust-settings-export", "-d", filepath.Join(backupPath, trustSettingsBackupFile)); err != nil && s.verbose {
+		fmt.Printf("No admin trust settings exported: %v\n", err)
+	}
+	return nil
+}
+
+// restoreSystemKeychain returns the keychain to the backed up certificates
+// and re-imports the backed up trust settings
+func (s *SystemStore) restoreSystemKeychain(backupPath string) error {
+	data, err := os.ReadFile(filepath.Join(backupPath, keychainBackupFile))
+	if err != nil {
+		return fmt.Errorf("not a System keychain backup: %w", err)
+	}
+	saved, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		return err
+	}
+	if err := s.checkAuthorized(); err != nil {
+		return err
+	}
+
+	current, err := s.listSystemKeychainCertificates()
+	if err != nil {
+		return err
+	}
+	for _, c := range current {
+		if !certstore.ContainsCertificate(saved, c) {
+			if err := s.removeSystemKeychainCertificate(c); err != nil {
+				return err
+			}
+		}
+	}
+	var missing []*x509.Certificate
+	for _, c := range saved {
+		if !certstore.ContainsCertificate(current, c) {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		err := withCertificateFile(missing, func(path string) error {
+			_, err := s.runner.Run("security", "add-certificates", "-k", systemKeychain, path)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	settings := filepath.Join(backupPath, trustSettingsBackupFile)
+	if _, err := os.Stat(settings); err == nil {
+		if _, err := s.runner.Run("security", "trust-settings-import", "-d", settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
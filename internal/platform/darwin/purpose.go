@@ -0,0 +1,64 @@
+package darwin
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// trustPolicies are the security add-trusted-cert policies of each trust
+// purpose. The SSL policy covers both ends of a TLS connection.
+var trustPolicies = map[string]string{
+	certstore.PurposeServerAuth:  "ssl",
+	certstore.PurposeClientAuth:  "ssl",
+	certstore.PurposeCodeSigning: "codeSign",
+	certstore.PurposeSMIME:       "smime",
+}
+
+// policyArgs returns the -p arguments limiting trust settings to purposes
+func policyArgs(purposes []string) []string {
+	var args []string
+	seen := make(map[string]bool)
+	for _, p := range purposes {
+		policy := trustPolicies[p]
+		if !seen[policy] {
+			seen[policy] = true
+			args = append(args, "-p", policy)
+		}
+	}
+	return args
+}
+
+// SupportedPurposes returns the trust purposes the store can limit trust
+// to, with per-policy trust settings
+func (s *SystemStore) SupportedPurposes() []string {
+	switch s.target {
+	case "system-keychain":
+		return certstore.TrustPurposes
+	case "smime":
+		return []string{certstore.PurposeSMIME}
+	default:
+		return nil
+	}
+}
+
+// AddCertificateForPurposes adds cert with admin trust settings for the
+// policies of purposes only. The keychain has no labels.
+func (s *SystemStore) AddCertificateForPurposes(cert *x509.Certificate, label string, purposes []string) error {
+	switch s.target {
+	case "system-keychain":
+	case "smime":
+		return s.addSMIMECertificate(cert)
+	default:
+		return fmt.Errorf("%s can't limit trust to purposes", s.target)
+	}
+	if err := s.checkAuthorized(); err != nil {
+		return err
+	}
+	return withCertificateFile([]*x509.Certificate{cert}, func(path string) error {
+		args := append([]string{"add-trusted-cert", "-d", "-r", "trustRoot"}, policyArgs(purposes)...)
+		_, err := s.runner.Run("security", append(args, "-k", systemKeychain, path)...)
+		return err
+	})
+}
@@ -0,0 +1,14 @@
+package darwin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicyArgs(t *testing.T) {
+	got := policyArgs([]string{"server-auth", "client-auth", "smime"})
+	want := []string{"-p", "ssl", "-p", "smime"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("policyArgs = %v, want %v", got, want)
+	}
+}
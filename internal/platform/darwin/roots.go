@@ -0,0 +1,81 @@
+package darwin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// SystemRootsKeychain holds the roots of Apple's root program as shipped
+// with the running macOS release
+const SystemRootsKeychain = "/System/Library/Keychains/SystemRootCertificates.keychain"
+
+// AppleRoots snapshots Apple's root store: the SystemRootCertificates
+// keychain less the roots the system trust settings deny, so Apple's root
+// program can be mirrored into bundles for other platforms
+func AppleRoots(runner certstore.Runner) ([]*x509.Certificate, error) {
+	if !securityAvailable() {
+		return nil, fmt.Errorf("the Apple root store can only be read on macOS; render a bundle there for other hosts")
+	}
+	output, err := runner.Run("security", "find-certificate", "-a", "-p", SystemRootsKeychain)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := certstore.ParsePEMBundle(output)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fails with "No Trust Settings were found" when Apple distrusts nothing
+	settings, _, err := runner.RunCaptured("security", "dump-trust-settings", "-s")
+	if err != nil {
+		return roots, nil
+	}
+	denied := deniedTrustSettings(settings)
+	var trusted []*x509.Certificate
+	for _, root := range roots {
+		if !denied[certificateName(root)] {
+			trusted = append(trusted, root)
+		}
+	}
+	return trusted, nil
+}
+
+// deniedTrustSettings returns the names of the certificates that
+// `security dump-trust-settings` lists with a Deny result for any policy
+func deniedTrustSettings(output []byte) map[string]bool {
+	denied := make(map[string]bool)
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Cert ") {
+			if _, name, ok := strings.Cut(line, ":"); ok {
+				current = strings.TrimSpace(name)
+			}
+			continue
+		}
+		if current != "" && strings.HasPrefix(line, "Result Type") && strings.HasSuffix(line, "kSecTrustSettingsResultDeny") {
+			denied[current] = true
+		}
+	}
+	return denied
+}
+
+// certificateName is the name security prints for a certificate: its
+// common name, or the first organizational unit or organization without one
+func certificateName(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.Subject.OrganizationalUnit) > 0:
+		return cert.Subject.OrganizationalUnit[0]
+	case len(cert.Subject.Organization) > 0:
+		return cert.Subject.Organization[0]
+	}
+	return ""
+}
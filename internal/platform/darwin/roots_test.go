@@ -0,0 +1,29 @@
+package darwin
+
+import "testing"
+
+func TestDeniedTrustSettings(t *testing.T) {
+	output := `Number of trusted certs = 2
+Cert 0: Distrusted Root CA
+   Number of trust settings : 2
+   Trust Setting 0:
+      Policy OID            : SSL
+      Allowed Error         : CSSMERR_TP_CERT_EXPIRED
+      Result Type           : kSecTrustSettingsResultDeny
+   Trust Setting 1:
+      Policy OID            : S/MIME
+      Result Type           : kSecTrustSettingsResultTrustRoot
+Cert 1: Restricted Root: Example
+   Number of trust settings : 1
+   Trust Setting 0:
+      Policy OID            : SSL
+      Result Type           : kSecTrustSettingsResultUnspecified
+`
+	denied := deniedTrustSettings([]byte(output))
+	if !denied["Distrusted Root CA"] {
+		t.Error("denied root not found")
+	}
+	if denied["Restricted Root: Example"] || len(denied) != 1 {
+		t.Errorf("unexpected denied roots: %v", denied)
+	}
+}
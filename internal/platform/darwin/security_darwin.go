@@ -0,0 +1,11 @@
+//go:build darwin
+
+package darwin
+
+import "os/exec"
+
+// securityAvailable reports whether the security tool can be run
+func securityAvailable() bool {
+	_, err := exec.LookPath("security")
+	return err == nil
+}
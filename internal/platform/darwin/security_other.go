@@ -0,0 +1,10 @@
+//go:build !darwin
+
+package darwin
+
+// securityAvailable is false off macOS, which has the only keychains
+// whatever security tool is on the PATH. The stores still build so their
+// command handling can be tested with a scripted runner.
+func securityAvailable() bool {
+	return false
+}
@@ -0,0 +1,81 @@
+package darwin
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// S/MIME intermediate operations. Intermediates are added to the System
+// keychain, where Apple Mail finds them when building a chain for a signed
+// or encrypted message, with admin trust settings for the S/MIME policy
+// only. TLS and code signing evaluation ignore those settings, so the
+// intermediate gains no trust there. Only System keychain intermediates
+// with S/MIME trust settings are listed.
+
+func (s *SystemStore) listSMIMECertificates() ([]*x509.Certificate, error) {
+	certs, err := s.listSystemKeychainCertificates()
+	if err != nil {
+		return nil, err
+	}
+	// Fails with "No Trust Settings were found" when there are none
+	output, _, err := s.runner.RunCaptured("security", "dump-trust-settings", "-d")
+	if err != nil {
+		return nil, nil
+	}
+	scoped := smimeTrustSettings(output)
+	var intermediates []*x509.Certificate
+	for _, c := range certs {
+		if !isSelfSigned(c) && scoped[certificateName(c)] {
+			intermediates = append(intermediates, c)
+		}
+	}
+	return intermediates, nil
+}
+
+func (s *SystemStore) addSMIMECertificate(cert *x509.Certificate) error {
+	if isSelfSigned(cert) {
+		return fmt.Errorf("%s is a root; publish roots with the system-keychain target", certificateName(cert))
+	}
+	if err := s.checkAuthorized(); err != nil {
+		return err
+	}
+	return withCertificateFile([]*x509.Certificate{cert}, func(path string) error {
+		_, err := s.runner.Run("security", "add-trusted-cert", "-d", "-r", "trustAsRoot", "-p", "smime", "-k", systemKeychain, path)
+		return err
+	})
+}
+
+// Accepts reports whether the store can hold cert: the smime target only
+// publishes intermediates, so roots are left out of its updates
+func (s *SystemStore) Accepts(cert *x509.Certificate) bool {
+	return s.target != "smime" || !isSelfSigned(cert)
+}
+
+// smimeTrustSettings returns the names of the certificates that
+// `security dump-trust-settings` lists with an S/MIME policy setting
+func smimeTrustSettings(output []byte) map[string]bool {
+	scoped := make(map[string]bool)
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Cert ") {
+			if _, name, ok := strings.Cut(line, ":"); ok {
+				current = strings.TrimSpace(name)
+			}
+			continue
+		}
+		if current != "" && strings.HasPrefix(line, "Policy OID") && strings.HasSuffix(line, "S/MIME") {
+			scoped[current] = true
+		}
+	}
+	return scoped
+}
+
+// isSelfSigned reports whether cert is a root rather than an intermediate
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
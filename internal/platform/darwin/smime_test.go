@@ -0,0 +1,22 @@
+package darwin
+
+import "testing"
+
+func TestSMIMETrustSettings(t *testing.T) {
+	output := `Number of trusted certs = 2
+Cert 0: Example Mail Issuing CA
+   Number of trust settings : 1
+   Trust Setting 0:
+      Policy OID            : S/MIME
+      Result Type           : kSecTrustSettingsResultTrustAsRoot
+Cert 1: Example TLS Root
+   Number of trust settings : 1
+   Trust Setting 0:
+      Policy OID            : SSL
+      Result Type           : kSecTrustSettingsResultTrustRoot
+`
+	scoped := smimeTrustSettings([]byte(output))
+	if !scoped["Example Mail Issuing CA"] || len(scoped) != 1 {
+		t.Errorf("scoped = %v, want only the mail intermediate", scoped)
+	}
+}
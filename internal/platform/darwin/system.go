@@ -3,7 +3,7 @@ package darwin
 import (
 	"crypto/x509"
 	"fmt"
-	"os/exec"
+	"time"
 
 	"github.com/webprofusion/trust-store-updater/internal/certstore"
 )
@@ -13,6 +13,7 @@ type SystemStore struct {
 	target  string
 	options map[string]string
 	verbose bool
+	runner  certstore.Runner
 }
 
 // NewSystemStore creates a new macOS system certificate store
@@ -21,6 +22,7 @@ func NewSystemStore(target string, options map[string]string, verbose bool) (cer
 		target:  target,
 		options: options,
 		verbose: verbose,
+		runner:  &certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout},
 	}
 
 	// Validate target
@@ -39,7 +41,7 @@ func (s *SystemStore) Name() string {
 // IsSupported checks if this store is supported on the current platform
 func (s *SystemStore) IsSupported() bool {
 	switch s.target {
-	case "system-keychain":
+	case "system-keychain", "smime":
 		return s.hasSystemKeychain()
 	case "login-keychain":
 		return s.hasLoginKeychain()
@@ -51,7 +53,7 @@ func (s *SystemStore) IsSupported() bool {
 // RequiresRoot returns true if root privileges are required
 func (s *SystemStore) RequiresRoot() bool {
 	switch s.target {
-	case "system-keychain":
+	case "system-keychain", "smime":
 		return true
 	case "login-keychain":
 		return false
@@ -65,6 +67,8 @@ func (s *SystemStore) ListCertificates() ([]*x509.Certificate, error) {
 	switch s.target {
 	case "system-keychain":
 		return s.listSystemKeychainCertificates()
+	case "smime":
+		return s.listSMIMECertificates()
 	case "login-keychain":
 		return s.listLoginKeychainCertificates()
 	default:
@@ -77,6 +81,8 @@ func (s *SystemStore) AddCertificate(cert *x509.Certificate) error {
 	switch s.target {
 	case "system-keychain":
 		return s.addSystemKeychainCertificate(cert)
+	case "smime":
+		return s.addSMIMECertificate(cert)
 	case "login-keychain":
 		return s.addLoginKeychainCertificate(cert)
 	default:
@@ -87,7 +93,7 @@ func (s *SystemStore) AddCertificate(cert *x509.Certificate) error {
 // RemoveCertificate removes a certificate from the store
 func (s *SystemStore) RemoveCertificate(cert *x509.Certificate) error {
 	switch s.target {
-	case "system-keychain":
+	case "system-keychain", "smime":
 		return s.removeSystemKeychainCertificate(cert)
 	case "login-keychain":
 		return s.removeLoginKeychainCertificate(cert)
@@ -99,7 +105,7 @@ func (s *SystemStore) RemoveCertificate(cert *x509.Certificate) error {
 // Backup creates a backup of the current store state
 func (s *SystemStore) Backup(backupPath string) error {
 	switch s.target {
-	case "system-keychain":
+	case "system-keychain", "smime":
 		return s.backupSystemKeychain(backupPath)
 	case "login-keychain":
 		return s.backupLoginKeychain(backupPath)
@@ -111,7 +117,7 @@ func (s *SystemStore) Backup(backupPath string) error {
 // Restore restores the store from a backup
 func (s *SystemStore) Restore(backupPath string) error {
 	switch s.target {
-	case "system-keychain":
+	case "system-keychain", "smime":
 		return s.restoreSystemKeychain(backupPath)
 	case "login-keychain":
 		return s.restoreLoginKeychain(backupPath)
@@ -120,6 +126,40 @@ func (s *SystemStore) Restore(backupPath string) error {
 	}
 }
 
+// SetCommandTimeout bounds each security run
+func (s *SystemStore) SetCommandTimeout(timeout time.Duration) {
+	certstore.SetRunnerTimeout(s.runner, timeout)
+}
+
+// CheckHealth reports when System keychain trust changes would prompt for
+// an administrator, which fails unattended runs
+func (s *SystemStore) CheckHealth() []certstore.HealthIssue {
+	if s.target == "login-keychain" || s.allowPrompt() {
+		return nil
+	}
+	grant, err := trustSettingsGrant(s.runner)
+	if err != nil {
+		return []certstore.HealthIssue{{Check: "authorization", Message: err.Error()}}
+	}
+	switch grant {
+	case grantRoot:
+		return nil
+	case grantEveryone:
+		return []certstore.HealthIssue{{
+			Check: "authorization",
+			Message: fmt.Sprintf("the %s right is granted to every process, so any user can change admin trust settings; "+
+				"restrict it to root with `security authorizationdb write %s %s`", TrustSettingsRight, TrustSettingsRight, grantRoot),
+		}}
+	}
+	// Changing the policy database isn't done automatically; see
+	// serve --authorize-keychain
+	return []certstore.HealthIssue{{
+		Check: "authorization",
+		Message: fmt.Sprintf("the %s right prompts for an administrator, so unattended updates fail; "+
+			"grant it to root with an MDM profile or serve --authorize-keychain", TrustSettingsRight),
+	}}
+}
+
 // Validate checks if the store is in a valid state
 func (s *SystemStore) Validate() error {
 	if !s.IsSupported() {
@@ -130,9 +170,14 @@ func (s *SystemStore) Validate() error {
 
 // Helper methods
 
+// SystemTargets returns every system store target known on this platform,
+// whether or not it is available on this machine
+func SystemTargets() []string {
+	return []string{"system-keychain", "login-keychain", "smime"}
+}
+
 func isValidSystemTarget(target string) bool {
-	validTargets := []string{"system-keychain", "login-keychain"}
-	for _, valid := range validTargets {
+	for _, valid := range SystemTargets() {
 		if target == valid {
 			return true
 		}
@@ -141,43 +186,11 @@ func isValidSystemTarget(target string) bool {
 }
 
 func (s *SystemStore) hasSystemKeychain() bool {
-	// Check if security command is available
-	_, err := exec.LookPath("security")
-	return err == nil
+	return securityAvailable()
 }
 
 func (s *SystemStore) hasLoginKeychain() bool {
-	// Check if security command is available
-	_, err := exec.LookPath("security")
-	return err == nil
-}
-
-// System keychain operations
-func (s *SystemStore) listSystemKeychainCertificates() ([]*x509.Certificate, error) {
-	// Use security command to list certificates in system keychain
-	// security find-certificate -a -p /System/Library/Keychains/SystemRootCertificates.keychain
-	return nil, fmt.Errorf("system keychain certificate listing not implemented")
-}
-
-func (s *SystemStore) addSystemKeychainCertificate(cert *x509.Certificate) error {
-	// Use security command to add certificate to system keychain
-	// security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain cert.pem
-	return fmt.Errorf("system keychain certificate addition not implemented")
-}
-
-func (s *SystemStore) removeSystemKeychainCertificate(cert *x509.Certificate) error {
-	// Use security command to remove certificate from system keychain
-	return fmt.Errorf("system keychain certificate removal not implemented")
-}
-
-func (s *SystemStore) backupSystemKeychain(backupPath string) error {
-	// Backup system keychain
-	return fmt.Errorf("system keychain backup not implemented")
-}
-
-func (s *SystemStore) restoreSystemKeychain(backupPath string) error {
-	// Restore system keychain
-	return fmt.Errorf("system keychain restore not implemented")
+	return securityAvailable()
 }
 
 // Login keychain operations
@@ -210,8 +223,8 @@ func (s *SystemStore) restoreLoginKeychain(backupPath string) error {
 func SupportedStores() []string {
 	var stores []string
 
-	if _, err := exec.LookPath("security"); err == nil {
-		stores = append(stores, "system-keychain", "login-keychain")
+	if securityAvailable() {
+		stores = append(stores, "system-keychain", "login-keychain", "smime")
 	}
 
 	return stores
@@ -0,0 +1,121 @@
+package darwin
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+const (
+	rootRight  = "<dict><key>rule</key><array><string>is-root</string></array></dict>"
+	adminRight = "<dict><key>rule</key><array><string>authenticate-admin</string></array></dict>"
+)
+
+func newKeychainStore(runner certstore.Runner) *SystemStore {
+	return &SystemStore{target: "system-keychain", options: map[string]string{}, runner: runner}
+}
+
+func TestSystemKeychainCommands(t *testing.T) {
+	root := certstoretest.NewCertificate(t, "Corp Root CA")
+	runner := &certstoretest.Runner{}
+	runner.Respond("security find-certificate -a -p "+systemKeychain, string(certstore.EncodePEMBundle([]*x509.Certificate{root})))
+	runner.Respond("security authorizationdb read "+TrustSettingsRight, adminRight)
+	store := newKeychainStore(runner)
+
+	certs, err := store.ListCertificates()
+	if err != nil || len(certs) != 1 || !certs[0].Equal(root) {
+		t.Fatalf("ListCertificates = %v, %v", certs, err)
+	}
+
+	// Without the right, security would wait on a dialog
+	if err := store.AddCertificate(root); err == nil || !strings.Contains(err.Error(), TrustSettingsRight) {
+		t.Fatalf("expected an authorization error, got %v", err)
+	}
+	for _, call := range runner.Calls() {
+		if call.Args[0] == "add-trusted-cert" {
+			t.Fatal("add-trusted-cert ran without the trust settings right")
+		}
+	}
+
+	runner.Respond("security authorizationdb read "+TrustSettingsRight, rootRight)
+	runner.Handle = func(call certstoretest.Call) certstoretest.Response {
+		return certstoretest.Response{}
+	}
+	if err := store.AddCertificate(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RemoveCertificate(root); err != nil {
+		t.Fatal(err)
+	}
+	var ran []string
+	for _, call := range runner.Calls() {
+		switch call.Args[0] {
+		case "add-trusted-cert", "remove-trusted-cert", "delete-certificate":
+			ran = append(ran, call.Args[0])
+		}
+	}
+	if strings.Join(ran, ",") != "add-trusted-cert,remove-trusted-cert,delete-certificate" {
+		t.Errorf("ran %v", ran)
+	}
+	if !runner.Ran("security delete-certificate -Z " + sha1Hash(root) + " " + systemKeychain) {
+		t.Error("the certificate wasn't deleted by its SHA-1 hash")
+	}
+}
+
+func TestSystemKeychainTrustSettings(t *testing.T) {
+	root := certstoretest.NewCertificate(t, "Corp Root CA")
+	other := certstoretest.NewCertificate(t, "Other Root")
+	runner := &certstoretest.Runner{}
+	runner.Respond("security find-certificate -a -p "+systemKeychain, string(certstore.EncodePEMBundle([]*x509.Certificate{root, other})))
+	runner.Fail("security dump-trust-settings -d", "SecTrustSettingsCopyCertificates: "+noTrustSettings)
+	store := newKeychainStore(runner)
+
+	settings, err := store.TrustSettings()
+	if err != nil || len(settings) != 0 {
+		t.Fatalf("a keychain without trust settings has %v, %v", settings, err)
+	}
+
+	runner.Respond("security dump-trust-settings -d", `Cert 0: Corp Root CA
+   Number of trust settings : 1
+   Trust Setting 0:
+      Result Type           : kSecTrustSettingsResultDeny
+`)
+	settings, err = store.TrustSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := settings[cert.GetCertificateFingerprint(root)]; !ok || len(settings) != 1 {
+		t.Errorf("expected settings for Corp Root CA only, got %v", settings)
+	}
+}
+
+func TestPollSystemKeychain(t *testing.T) {
+	runner := &certstoretest.Runner{}
+	runner.Respond("security find-certificate -a -Z "+systemKeychain, "SHA-1 hash: 01\n")
+	runner.Respond("security dump-trust-settings -d", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed, err := pollSystemKeychain(ctx, runner, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+		t.Fatal("signalled before the keychain changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	runner.Respond("security dump-trust-settings -d", "Cert 0: Corp Root CA\n")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a trust settings change wasn't signalled")
+	}
+}
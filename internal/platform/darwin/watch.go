@@ -0,0 +1,148 @@
+package darwin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// noTrustSettings is what security prints when a domain has no trust settings
+const noTrustSettings = "No Trust Settings were found"
+
+// pollInterval is how often WatchSystemStores reads the System keychain.
+// macOS only notifies changes to it through Endpoint Security, which needs
+// an entitlement, so it is polled instead.
+const pollInterval = 30 * time.Second
+
+// TrustSettings returns a digest of the trust settings of each certificate
+// in the store that has any, keyed by fingerprint, so drift detection sees
+// a certificate's trust changed in place
+func (s *SystemStore) TrustSettings() (map[string]string, error) {
+	certs, err := s.ListCertificates()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"dump-trust-settings", "-d"}
+	if s.target == "login-keychain" {
+		args = args[:1]
+	}
+	output, err := dumpTrustSettings(s.runner, args...)
+	if err != nil {
+		return nil, err
+	}
+	byName := trustSettingsByName(output)
+	settings := make(map[string]string)
+	for _, c := range certs {
+		if text, ok := byName[certificateName(c)]; ok {
+			sum := sha256.Sum256([]byte(text))
+			settings[cert.GetCertificateFingerprint(c)] = hex.EncodeToString(sum[:8])
+		}
+	}
+	return settings, nil
+}
+
+// dumpTrustSettings runs security dump-trust-settings, returning no output
+// rather than an error when the domain has no trust settings
+func dumpTrustSettings(runner certstore.Runner, args ...string) ([]byte, error) {
+	output, stderr, err := runner.RunCaptured("security", args...)
+	if err != nil {
+		if strings.Contains(string(stderr), noTrustSettings) || strings.Contains(string(output), noTrustSettings) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read trust settings: %w", err)
+	}
+	return output, nil
+}
+
+// trustSettingsByName returns the settings `security dump-trust-settings`
+// lists for each certificate, keyed by certificate name
+func trustSettingsByName(output []byte) map[string]string {
+	settings := make(map[string]string)
+	current := ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Cert ") {
+			if _, name, ok := strings.Cut(line, ":"); ok {
+				current = strings.TrimSpace(name)
+				if _, ok := settings[current]; !ok {
+					settings[current] = ""
+				}
+			}
+			continue
+		}
+		if current != "" && line != "" {
+			settings[current] += line + "\n"
+		}
+	}
+	return settings
+}
+
+// WatchSystemStores polls the System keychain and its admin trust settings
+// and signals on the returned channel when either changes, until ctx is done
+func WatchSystemStores(ctx context.Context) (<-chan struct{}, error) {
+	if !securityAvailable() {
+		return nil, fmt.Errorf("security is not available")
+	}
+	return pollSystemKeychain(ctx, &certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout}, pollInterval)
+}
+
+// pollSystemKeychain digests the System keychain every interval with runner
+func pollSystemKeychain(ctx context.Context, runner certstore.Runner, interval time.Duration) (<-chan struct{}, error) {
+	last, err := systemKeychainDigest(runner)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			digest, err := systemKeychainDigest(runner)
+			if err != nil {
+				certstore.LogWarnf("Failed to poll the System keychain: %v", err)
+				continue
+			}
+			if digest == last {
+				continue
+			}
+			last = digest
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changed, nil
+}
+
+// systemKeychainDigest digests the System keychain's certificates and admin
+// trust settings
+func systemKeychainDigest(runner certstore.Runner) (string, error) {
+	certs, err := runner.Run("security", "find-certificate", "-a", "-Z", systemKeychain)
+	if err != nil {
+		return "", fmt.Errorf("failed to list the System keychain: %w", err)
+	}
+	settings, err := dumpTrustSettings(runner, "dump-trust-settings", "-d")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(certs)
+	h.Write(settings)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
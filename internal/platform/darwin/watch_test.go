@@ -0,0 +1,38 @@
+package darwin
+
+import "testing"
+
+func TestTrustSettingsByName(t *testing.T) {
+	output := `Number of trusted certs = 2
+Cert 0: Corp Root CA
+   Number of trust settings : 1
+   Trust Setting 0:
+      Policy OID            : SSL
+      Result Type           : kSecTrustSettingsResultTrustRoot
+Cert 1: Other Root
+   Number of trust settings : 0
+`
+	settings := trustSettingsByName([]byte(output))
+	if len(settings) != 2 {
+		t.Fatalf("settings for %d certificates, want 2: %v", len(settings), settings)
+	}
+	if settings["Other Root"] != "Number of trust settings : 0\n" {
+		t.Errorf("Other Root settings %q", settings["Other Root"])
+	}
+
+	// Denying the root changes its settings and nothing else
+	denied := trustSettingsByName([]byte(`Cert 0: Corp Root CA
+   Number of trust settings : 1
+   Trust Setting 0:
+      Policy OID            : SSL
+      Result Type           : kSecTrustSettingsResultDeny
+Cert 1: Other Root
+   Number of trust settings : 0
+`))
+	if denied["Corp Root CA"] == settings["Corp Root CA"] {
+		t.Error("denying trust left the settings unchanged")
+	}
+	if denied["Other Root"] != settings["Other Root"] {
+		t.Error("unrelated settings changed")
+	}
+}
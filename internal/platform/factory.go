@@ -22,6 +22,16 @@ func NewFactory(verbose bool) *Factory {
 
 // CreateStore creates a certificate store based on the current platform
 func (f *Factory) CreateStore(storeType certstore.StoreType, target string, options map[string]string) (certstore.CertificateStore, error) {
+	// Plugin, remote and appliance stores are platform neutral
+	if backend, ok := backends[storeType]; ok {
+		return backend.create(target, options, f.verbose)
+	}
+	for _, optional := range optionalTypes {
+		if storeType == optional {
+			return nil, fmt.Errorf("%s stores are not included in this build", storeType)
+		}
+	}
+
 	switch runtime.GOOS {
 	case "linux":
 		return f.createLinuxStore(storeType, target, options)
@@ -48,6 +58,27 @@ func (f *Factory) SupportedStores() []string {
 	}
 }
 
+// Targets returns every target of a system or application store type known on
+// the current platform, including ones whose tooling isn't installed
+func (f *Factory) Targets(storeType certstore.StoreType) []string {
+	switch runtime.GOOS + "/" + string(storeType) {
+	case "linux/system":
+		return linux.SystemTargets()
+	case "linux/application":
+		return linux.ApplicationTargets()
+	case "darwin/system":
+		return darwin.SystemTargets()
+	case "darwin/application":
+		return darwin.ApplicationTargets()
+	case "windows/system":
+		return windows.SystemTargets()
+	case "windows/application":
+		return windows.ApplicationTargets()
+	default:
+		return nil
+	}
+}
+
 func (f *Factory) createLinuxStore(storeType certstore.StoreType, target string, options map[string]string) (certstore.CertificateStore, error) {
 	switch storeType {
 	case certstore.StoreTypeSystem:
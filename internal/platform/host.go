@@ -0,0 +1,127 @@
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Host describes the machine the tool is running on, for store constraints
+type Host struct {
+	OS            string   // runtime.GOOS
+	Arch          string   // runtime.GOARCH
+	Distro        string   // os-release ID on Linux, e.g. "ubuntu"
+	DistroLike    []string // os-release ID_LIKE, e.g. ["debian"]
+	DistroVersion string   // os-release VERSION_ID, e.g. "22.04"
+}
+
+var (
+	hostOnce    sync.Once
+	currentHost Host
+)
+
+// CurrentHost returns the facts about this machine, read once
+func CurrentHost() Host {
+	hostOnce.Do(func() {
+		currentHost = Host{OS: runtime.GOOS, Arch: runtime.GOARCH}
+		if runtime.GOOS != "linux" {
+			return
+		}
+		for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+			if data, err := os.ReadFile(path); err == nil {
+				fields := parseOSRelease(data)
+				currentHost.Distro = fields["ID"]
+				currentHost.DistroLike = strings.Fields(fields["ID_LIKE"])
+				currentHost.DistroVersion = fields["VERSION_ID"]
+				return
+			}
+		}
+	})
+	return currentHost
+}
+
+// parseOSRelease reads the KEY=value lines of an os-release file
+func parseOSRelease(data []byte) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		fields[key] = strings.Trim(value, `"'`)
+	}
+	return fields
+}
+
+// Constraint matches hosts on each field that is set; within a field any
+// listed value matches. Distro also matches the host's ID_LIKE entries, so
+// "debian" covers Ubuntu and "rhel" covers Rocky and Alma.
+type Constraint struct {
+	OS            []string
+	Arch          []string
+	Distro        []string
+	DistroVersion []string
+}
+
+// Matches reports whether h satisfies the constraint
+func (c Constraint) Matches(h Host) bool {
+	if len(c.OS) > 0 && !containsFold(c.OS, h.OS) {
+		return false
+	}
+	if len(c.Arch) > 0 && !containsFold(c.Arch, h.Arch) {
+		return false
+	}
+	if len(c.Distro) > 0 {
+		matched := containsFold(c.Distro, h.Distro)
+		for _, like := range h.DistroLike {
+			matched = matched || containsFold(c.Distro, like)
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(c.DistroVersion) > 0 && !containsFold(c.DistroVersion, h.DistroVersion) {
+		return false
+	}
+	return true
+}
+
+// Applies reports whether a store constrained by include and exclude should
+// be used on h: any include constraint must match (or there are none), and no
+// exclude constraint may match
+func Applies(h Host, include, exclude []Constraint) bool {
+	for _, c := range exclude {
+		if c.Matches(h) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, c := range include {
+		if c.Matches(h) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, want string) bool {
+	if want == "" {
+		return false
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package platform
+
+import "testing"
+
+func TestParseOSRelease(t *testing.T) {
+	fields := parseOSRelease([]byte("# comment\nNAME=\"Ubuntu\"\nID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"22.04\"\n"))
+	if fields["ID"] != "ubuntu" || fields["VERSION_ID"] != "22.04" || fields["NAME"] != "Ubuntu" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+func TestApplies(t *testing.T) {
+	ubuntuArm := Host{OS: "linux", Arch: "arm64", Distro: "ubuntu", DistroLike: []string{"debian"}, DistroVersion: "22.04"}
+	rocky := Host{OS: "linux", Arch: "amd64", Distro: "rocky", DistroLike: []string{"rhel", "centos", "fedora"}}
+	mac := Host{OS: "darwin", Arch: "arm64"}
+
+	tests := []struct {
+		name             string
+		include, exclude []Constraint
+		want             map[string]bool
+	}{
+		{"unconstrained", nil, nil, map[string]bool{"ubuntu": true, "rocky": true, "mac": true}},
+		{"debian family", []Constraint{{Distro: []string{"debian"}}}, nil, map[string]bool{"ubuntu": true}},
+		{"arm64 only", []Constraint{{Arch: []string{"arm64"}}}, nil, map[string]bool{"ubuntu": true, "mac": true}},
+		{"rhel or macOS", []Constraint{{Distro: []string{"rhel"}}, {OS: []string{"darwin"}}}, nil, map[string]bool{"rocky": true, "mac": true}},
+		{"not arm64 linux", nil, []Constraint{{OS: []string{"linux"}, Arch: []string{"arm64"}}}, map[string]bool{"rocky": true, "mac": true}},
+		{"ubuntu 22.04", []Constraint{{Distro: []string{"ubuntu"}, DistroVersion: []string{"22.04"}}}, nil, map[string]bool{"ubuntu": true}},
+	}
+	for _, tt := range tests {
+		for name, host := range map[string]Host{"ubuntu": ubuntuArm, "rocky": rocky, "mac": mac} {
+			if got := Applies(host, tt.include, tt.exclude); got != tt.want[name] {
+				t.Errorf("%s on %s: got %v", tt.name, name, got)
+			}
+		}
+	}
+}
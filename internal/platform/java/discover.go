@@ -0,0 +1,143 @@
+package java
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// discoverTimeout bounds the commands run to find JVMs
+const discoverTimeout = 30 * time.Second
+
+// JVM is an installed Java runtime and the CA keystore it uses
+type JVM struct {
+	Home    string
+	Cacerts string
+}
+
+// Discover finds the JVMs installed system-wide on this machine: JAVA_HOME,
+// the java on PATH, update-alternatives and Windows registry entries, and
+// the platform's common install locations. JDKs installed per user, such as
+// by SDKMAN or an IDE, are only managed when listed in options.jvm_homes, as
+// their owners control what they run. JVMs are returned in path order,
+// without duplicates.
+func Discover() []JVM {
+	return jvmsIn(discoverHomes(certstore.CommandRunner{Timeout: discoverTimeout}))
+}
+
+// discoverHomes returns the candidate JVM homes Discover checks, running
+// update-alternatives with runner
+func discoverHomes(runner certstore.Runner) []string {
+	var homes []string
+	if home := os.Getenv("JAVA_HOME"); home != "" {
+		homes = append(homes, home)
+	}
+	if java, err := exec.LookPath("java"); err == nil {
+		homes = append(homes, homeOfBinary(java))
+	}
+	homes = append(homes, alternativesHomes(runner)...)
+	homes = append(homes, registryHomes()...)
+	for _, pattern := range installPatterns() {
+		matches, _ := filepath.Glob(pattern)
+		sort.Strings(matches)
+		homes = append(homes, matches...)
+	}
+	return homes
+}
+
+// jvmsIn returns the homes that hold a JVM with a cacerts keystore,
+// resolving symlinks so each install is listed once
+func jvmsIn(homes []string) []JVM {
+	seen := make(map[string]bool)
+	var jvms []JVM
+	for _, home := range homes {
+		if resolved, err := filepath.EvalSymlinks(home); err == nil {
+			home = resolved
+		}
+		if home == "" || seen[home] {
+			continue
+		}
+		seen[home] = true
+		if cacerts := cacertsPath(home); cacerts != "" {
+			jvms = append(jvms, JVM{Home: home, Cacerts: cacerts})
+		}
+	}
+	return jvms
+}
+
+// cacertsPath returns the keystore of a JVM home: lib/security/cacerts since
+// Java 9, jre/lib/security/cacerts in older JDKs
+func cacertsPath(home string) string {
+	for _, rel := range []string{"lib/security/cacerts", "jre/lib/security/cacerts"} {
+		path := filepath.Join(home, filepath.FromSlash(rel))
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// homeOfBinary maps <home>/bin/java (following symlinks such as
+// /usr/bin/java -> /etc/alternatives/java) to <home>
+func homeOfBinary(java string) string {
+	if resolved, err := filepath.EvalSymlinks(java); err == nil {
+		java = resolved
+	}
+	home := filepath.Dir(filepath.Dir(java))
+	// Java 8 JDKs run jre/bin/java
+	if filepath.Base(home) == "jre" {
+		home = filepath.Dir(home)
+	}
+	return home
+}
+
+// alternativesHomes lists the JVMs registered with update-alternatives
+func alternativesHomes(runner certstore.Runner) []string {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	out, err := runner.Run("update-alternatives", "--list", "java")
+	if err != nil {
+		return nil
+	}
+	var homes []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			homes = append(homes, homeOfBinary(line))
+		}
+	}
+	return homes
+}
+
+// installPatterns are the platform's common JVM install locations
+func installPatterns() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{
+			"/Library/Java/JavaVirtualMachines/*/Contents/Home",
+			// Homebrew on Apple silicon and Intel
+			"/opt/homebrew/opt/openjdk*/libexec/openjdk.jdk/Contents/Home",
+			"/usr/local/opt/openjdk*/libexec/openjdk.jdk/Contents/Home",
+		}
+	case "windows":
+		var patterns []string
+		for _, root := range []string{os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)")} {
+			if root == "" {
+				continue
+			}
+			for _, vendor := range []string{"Java", "Eclipse Adoptium", "Microsoft", "Zulu", "Amazon Corretto", "BellSoft"} {
+				patterns = append(patterns, filepath.Join(root, vendor, "*"))
+			}
+		}
+		return patterns
+	default:
+		return []string{"/usr/lib/jvm/*", "/usr/java/*", "/usr/local/java/*", "/opt/java/*", "/opt/jdk*",
+			"/home/linuxbrew/.linuxbrew/opt/openjdk*/libexec"}
+	}
+}
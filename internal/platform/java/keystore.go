@@ -0,0 +1,323 @@
+package java
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/pkcs12"
+)
+
+// aliasPrefix marks keystore entries written by this tool
+const aliasPrefix = "trust-store-updater-"
+
+// StorePasswordEnv passes literal keystore passwords to keytool, so that they
+// never appear on a command line
+const StorePasswordEnv = "TRUST_STORE_UPDATER_STOREPASS"
+
+// Password says how keytool receives a keystore password: a literal value,
+// the name of an environment variable or a file holding it. keytool reads the
+// variable or file itself, and a literal value is passed in StorePasswordEnv
+// in keytool's environment only, so the password never appears on a command
+// line.
+type Password struct {
+	Value string
+	Env   string
+	File  string
+}
+
+// args returns the keytool arguments passing the password
+func (p Password) args() []string {
+	switch {
+	case p.Env != "":
+		return []string{"-storepass:env", p.Env}
+	case p.File != "":
+		return []string{"-storepass:file", p.File}
+	default:
+		return []string{"-storepass:env", StorePasswordEnv}
+	}
+}
+
+// env returns the environment keytool needs for args: StorePasswordEnv set
+// to a literal password
+func (p Password) env() []string {
+	if p.Env != "" || p.File != "" {
+		return nil
+	}
+	return []string{StorePasswordEnv + "=" + p.Value}
+}
+
+// destArgs returns the -importkeystore arguments passing the password of
+// the keystore being written to
+func (p Password) destArgs() []string {
+	args := p.args()
+	args[0] = strings.Replace(args[0], "-storepass", "-deststorepass", 1)
+	return args
+}
+
+// value returns the password itself, reading the variable or file. Key
+// entries are given the keystore's password, as servers such as Tomcat
+// expect.
+func (p Password) value() (string, error) {
+	switch {
+	case p.Env != "":
+		return os.Getenv(p.Env), nil
+	case p.File != "":
+		data, err := os.ReadFile(p.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read keystore password: %w", err)
+		}
+		// keytool reads the first line
+		line, _, _ := strings.Cut(string(data), "\n")
+		return strings.TrimRight(line, "\r"), nil
+	default:
+		return p.Value, nil
+	}
+}
+
+// Keystore is one Java keystore file, such as a JVM's cacerts
+type Keystore struct {
+	Path     string
+	Type     string   // "JKS" or "PKCS12"
+	Keytool  string   // keytool executable used to modify it
+	JVMs     []string // homes of the JVMs sharing this keystore
+	password Password
+	runner   certstore.Runner
+
+	entries map[string]*entry // by fingerprint; nil until listed
+	result  certstore.TargetResult
+}
+
+// entry is a trusted certificate and the aliases it is stored under
+type entry struct {
+	cert    *x509.Certificate
+	aliases []string
+}
+
+// DetectType identifies a keystore from its magic number: JKS and JCEKS files
+// start with 0xFEEDFEED and 0xCECECECE; anything else is taken as PKCS12,
+// the default since Java 9
+func DetectType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return "", fmt.Errorf("failed to read keystore %s: %w", path, err)
+	}
+	switch {
+	case bytes.Equal(magic, []byte{0xfe, 0xed, 0xfe, 0xed}):
+		return "JKS", nil
+	case bytes.Equal(magic, []byte{0xce, 0xce, 0xce, 0xce}):
+		return "JCEKS", nil
+	default:
+		return "PKCS12", nil
+	}
+}
+
+// keytool runs keytool against the keystore. Output is forced to English so
+// listings can be parsed whatever the host locale.
+func (k *Keystore) keytool(command string, args ...string) ([]byte, error) {
+	full := append([]string{"-J-Duser.language=en", command, "-keystore", k.Path, "-storetype", k.Type}, k.password.args()...)
+	full = append(full, args...)
+	return certstore.WithEnv(k.runner, k.password.env()...).Run(k.Keytool, full...)
+}
+
+// list loads the keystore's trusted certificates, once
+func (k *Keystore) list() (map[string]*entry, error) {
+	if k.entries != nil {
+		return k.entries, nil
+	}
+	out, err := k.keytool("-list", "-rfc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keystore %s: %w", k.Path, err)
+	}
+	entries, err := parseListing(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keystore %s: %w", k.Path, err)
+	}
+	k.entries = entries
+	return entries, nil
+}
+
+// parseListing parses `keytool -list -rfc` output: an "Alias name:" line
+// followed by the entry's certificate in PEM
+func parseListing(out []byte) (map[string]*entry, error) {
+	entries := make(map[string]*entry)
+	var alias string
+	var block strings.Builder
+	inBlock := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Alias name:"):
+			alias = strings.TrimSpace(strings.TrimPrefix(line, "Alias name:"))
+		case line == "-----BEGIN CERTIFICATE-----":
+			inBlock = true
+			block.Reset()
+			block.WriteString(line + "\n")
+		case inBlock:
+			block.WriteString(line + "\n")
+			if line != "-----END CERTIFICATE-----" {
+				continue
+			}
+			inBlock = false
+			der, _ := pem.Decode([]byte(block.String()))
+			if der == nil {
+				return nil, fmt.Errorf("invalid PEM for alias %s", alias)
+			}
+			c, err := x509.ParseCertificate(der.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("alias %s: %w", alias, err)
+			}
+			fp := cert.GetCertificateFingerprint(c)
+			if e, ok := entries[fp]; ok {
+				e.aliases = append(e.aliases, alias)
+			} else {
+				entries[fp] = &entry{cert: c, aliases: []string{alias}}
+			}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// contains reports whether the keystore trusts c
+func (k *Keystore) contains(c *x509.Certificate) (bool, error) {
+	entries, err := k.list()
+	if err != nil {
+		return false, err
+	}
+	_, ok := entries[cert.GetCertificateFingerprint(c)]
+	return ok, nil
+}
+
+// add imports c as a trusted certificate under alias unless it is already
+// present; an empty alias is derived from the fingerprint
+func (k *Keystore) add(c *x509.Certificate, alias string) error {
+	present, err := k.contains(c)
+	if err != nil || present {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "trust-store-updater-*.pem")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := pem.Encode(tmp, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	fp := cert.GetCertificateFingerprint(c)
+	if alias == "" {
+		alias = aliasPrefix + fp[:16]
+	}
+	if _, err := k.keytool("-importcert", "-noprompt", "-alias", alias, "-file", tmp.Name()); err != nil {
+		return fmt.Errorf("failed to import into keystore %s: %w", k.Path, err)
+	}
+	k.entries[fp] = &entry{cert: c, aliases: []string{alias}}
+	k.result.Added++
+	return nil
+}
+
+// addKey imports key and chain, leaf first, as a private key entry under
+// alias, replacing an existing entry with that alias
+func (k *Keystore) addKey(chain []*x509.Certificate, key crypto.Signer, alias string) error {
+	password, err := k.password.value()
+	if err != nil {
+		return err
+	}
+	data, err := pkcs12.Encode(key, chain, alias, password)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "trust-store-updater-*.p12")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	runner := certstore.WithEnv(k.runner, append(k.password.env(), pkcs12.PasswordEnv+"="+password)...)
+	args := []string{"-J-Duser.language=en", "-importkeystore", "-noprompt",
+		"-srckeystore", tmp.Name(), "-srcstoretype", "PKCS12", "-srcstorepass:env", pkcs12.PasswordEnv,
+		"-srcalias", alias, "-destalias", alias,
+		"-destkeystore", k.Path, "-deststoretype", k.Type}
+	if _, err := runner.Run(k.Keytool, append(args, k.password.destArgs()...)...); err != nil {
+		return fmt.Errorf("failed to import key entry into keystore %s: %w", k.Path, err)
+	}
+	k.entries = nil
+	k.result.Added++
+	return nil
+}
+
+// remove deletes every alias c is stored under
+func (k *Keystore) remove(c *x509.Certificate) error {
+	entries, err := k.list()
+	if err != nil {
+		return err
+	}
+	fp := cert.GetCertificateFingerprint(c)
+	e, ok := entries[fp]
+	if !ok {
+		return nil
+	}
+	for _, alias := range e.aliases {
+		if _, err := k.keytool("-delete", "-alias", alias); err != nil {
+			return fmt.Errorf("failed to delete %s from keystore %s: %w", alias, k.Path, err)
+		}
+	}
+	delete(entries, fp)
+	k.result.Removed++
+	return nil
+}
+
+// record counts a failed change against the keystore
+func (k *Keystore) record(err error) error {
+	if err != nil {
+		k.result.Failed++
+		k.result.Errors = append(k.result.Errors, err.Error())
+	}
+	return err
+}
+
+// copyFile copies src to dst, keeping its permissions
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(dst, data, info.Mode().Perm())
+}
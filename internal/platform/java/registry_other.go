@@ -0,0 +1,8 @@
+//go:build !windows
+
+package java
+
+// registryHomes is only meaningful on Windows
+func registryHomes() []string {
+	return nil
+}
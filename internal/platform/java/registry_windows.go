@@ -0,0 +1,52 @@
+//go:build windows
+
+package java
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// registryLocations are the keys vendors' installers register JVMs under:
+// one subkey per version, holding the install path in the named value
+var registryLocations = []struct {
+	key, subpath, value string
+}{
+	{`SOFTWARE\JavaSoft\JDK`, "", "JavaHome"},
+	{`SOFTWARE\JavaSoft\JRE`, "", "JavaHome"},
+	{`SOFTWARE\JavaSoft\Java Development Kit`, "", "JavaHome"},
+	{`SOFTWARE\JavaSoft\Java Runtime Environment`, "", "JavaHome"},
+	{`SOFTWARE\Eclipse Adoptium\JDK`, `hotspot\MSI`, "Path"},
+	{`SOFTWARE\Eclipse Adoptium\JRE`, `hotspot\MSI`, "Path"},
+	{`SOFTWARE\Microsoft\JDK`, `hotspot\MSI`, "Path"},
+	{`SOFTWARE\Azul Systems\Zulu`, "", "InstallationPath"},
+	{`SOFTWARE\Amazon\Corretto`, "", "InstallationPath"},
+}
+
+// registryHomes lists the JVM homes registered in HKLM
+func registryHomes() []string {
+	var homes []string
+	for _, loc := range registryLocations {
+		root, err := registry.OpenKey(registry.LOCAL_MACHINE, loc.key, registry.ENUMERATE_SUB_KEYS)
+		if err != nil {
+			continue
+		}
+		versions, _ := root.ReadSubKeyNames(-1)
+		root.Close()
+
+		for _, version := range versions {
+			path := loc.key + `\` + version
+			if loc.subpath != "" {
+				path += `\` + loc.subpath
+			}
+			k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+			if err != nil {
+				continue
+			}
+			if home, _, err := k.GetStringValue(loc.value); err == nil && home != "" {
+				homes = append(homes, home)
+			}
+			k.Close()
+		}
+	}
+	return homes
+}
@@ -0,0 +1,343 @@
+// Package java manages the trusted certificates in Java keystores with
+// keytool: a configured keystore, or the cacerts of every JVM found on the
+// machine.
+package java
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// DefaultPassword is the password JVMs ship their cacerts with
+const DefaultPassword = "changeit"
+
+// backupIndex names the file in a backup that maps copies to keystore paths
+const backupIndex = "keystores.txt"
+
+// Store keeps the same trusted certificates in one or more Java keystores.
+//
+// Options:
+//   - keystore: keystore path; when unset every discovered JVM's cacerts is managed
+//   - storepass, storepass_env, storepass_file: the keystore password, or the
+//     environment variable or file holding it (default "changeit")
+//   - storetype: JKS or PKCS12; detected from the file when unset
+//   - jvm_homes: comma-separated JVM homes to manage besides the discovered
+//     ones, such as JDKs installed per user
+//   - keytool: keytool executable; defaults to the JVM's own when it can
+//     only be changed by root or the running user, then PATH
+type Store struct {
+	keystores []*Keystore
+	runner    certstore.Runner
+	verbose   bool
+}
+
+// NewStore creates a store for the configured keystore or discovered JVMs
+func NewStore(options map[string]string, verbose bool) (*Store, error) {
+	password := Password{Value: options["storepass"], Env: options["storepass_env"], File: options["storepass_file"]}
+	if password.Value == "" && password.Env == "" && password.File == "" {
+		password.Value = DefaultPassword
+	}
+	storeType := strings.ToUpper(options["storetype"])
+	switch storeType {
+	case "", "JKS", "PKCS12":
+	default:
+		return nil, fmt.Errorf("unsupported java storetype %q (expected JKS or PKCS12)", options["storetype"])
+	}
+
+	if path := options["keystore"]; path != "" {
+		return newStore(options, []JVM{{Cacerts: path}}, password, storeType, verbose), nil
+	}
+	var homes []string
+	for _, home := range strings.Split(options["jvm_homes"], ",") {
+		if home = strings.TrimSpace(home); home != "" {
+			homes = append(homes, home)
+		}
+	}
+	discovered := discoverHomes(certstore.CommandRunner{Timeout: discoverTimeout})
+	return newStore(options, jvmsIn(append(homes, discovered...)), password, storeType, verbose), nil
+}
+
+// newStore manages the keystores of jvms, once each: distro JVMs commonly
+// link their cacerts to one shared file
+func newStore(options map[string]string, jvms []JVM, password Password, storeType string, verbose bool) *Store {
+	s := &Store{
+		runner:  &certstore.CommandRunner{Verbose: verbose},
+		verbose: verbose,
+	}
+	byPath := make(map[string]*Keystore)
+	for _, jvm := range jvms {
+		path := jvm.Cacerts
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		if ks, ok := byPath[path]; ok {
+			ks.JVMs = append(ks.JVMs, jvm.Home)
+			continue
+		}
+
+		ks := &Keystore{Path: path, Type: storeType, password: password, runner: s.runner}
+		if jvm.Home != "" {
+			ks.JVMs = []string{jvm.Home}
+		}
+		ks.Keytool = findKeytool(options["keytool"], jvm.Home)
+		byPath[path] = ks
+		s.keystores = append(s.keystores, ks)
+	}
+	return s
+}
+
+// findKeytool prefers the configured executable, then the JVM's own keytool.
+// A JVM's keytool is skipped when anyone but root or the running user could
+// replace it, so a planted JDK can't run code with the updater's privileges.
+func findKeytool(configured, home string) string {
+	if configured != "" {
+		return configured
+	}
+	if home != "" {
+		name := "keytool"
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+		if path := filepath.Join(home, "bin", name); fileExists(path) {
+			if trusted, ok := trustedExecutable(path); ok {
+				return trusted
+			}
+		}
+	}
+	if path, err := exec.LookPath("keytool"); err == nil {
+		return path
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// Keystores returns the managed keystores
+func (s *Store) Keystores() []*Keystore {
+	return s.keystores
+}
+
+// SetCommandTimeout bounds each keytool run
+func (s *Store) SetCommandTimeout(timeout time.Duration) {
+	certstore.SetRunnerTimeout(s.runner, timeout)
+}
+
+// TargetResults reports the changes made to each keystore and the JVMs using it
+func (s *Store) TargetResults() []certstore.TargetResult {
+	results := make([]certstore.TargetResult, 0, len(s.keystores))
+	for _, ks := range s.keystores {
+		r := ks.result
+		r.Target = ks.Path
+		r.Detail = strings.Join(ks.JVMs, ", ")
+		results = append(results, r)
+	}
+	return results
+}
+
+// IsSupported reports whether there is a keystore and keytool to manage it
+func (s *Store) IsSupported() bool {
+	for _, ks := range s.keystores {
+		if ks.Keytool != "" && fileExists(ks.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepare checks each keystore can be managed and detects its type
+func (s *Store) prepare() error {
+	if len(s.keystores) == 0 {
+		return fmt.Errorf("no java keystore found; set options.keystore or JAVA_HOME")
+	}
+	for _, ks := range s.keystores {
+		if ks.Keytool == "" {
+			return fmt.Errorf("keytool not found for keystore %s; set options.keytool", ks.Path)
+		}
+		if ks.Type == "" {
+			t, err := DetectType(ks.Path)
+			if err != nil {
+				return err
+			}
+			ks.Type = t
+		}
+	}
+	return nil
+}
+
+// ListCertificates returns the certificates trusted by every keystore, so a
+// certificate missing from any of them is added again
+func (s *Store) ListCertificates() ([]*x509.Certificate, error) {
+	if err := s.prepare(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	certs := make(map[string]*x509.Certificate)
+	for _, ks := range s.keystores {
+		entries, err := ks.list()
+		if err != nil {
+			return nil, err
+		}
+		for fp, e := range entries {
+			counts[fp]++
+			certs[fp] = e.cert
+		}
+	}
+
+	var common []*x509.Certificate
+	for fp, n := range counts {
+		if n == len(s.keystores) {
+			common = append(common, certs[fp])
+		}
+	}
+	return common, nil
+}
+
+// AddCertificate imports the certificate into each keystore lacking it,
+// continuing past keystores that fail
+func (s *Store) AddCertificate(c *x509.Certificate) error {
+	return s.AddCertificateWithLabel(c, "")
+}
+
+// SupportedPurposes returns the TLS purposes. Keystore entries carry no
+// usage limits, and TLS is what Java applications read cacerts for, so
+// certificates limited to TLS go in unchanged.
+func (s *Store) SupportedPurposes() []string {
+	return []string{certstore.PurposeServerAuth, certstore.PurposeClientAuth}
+}
+
+// AddCertificateForPurposes is AddCertificateWithLabel for certificates
+// limited to TLS purposes
+func (s *Store) AddCertificateForPurposes(c *x509.Certificate, label string, purposes []string) error {
+	return s.AddCertificateWithLabel(c, label)
+}
+
+// AddCertificateWithLabel is like AddCertificate but uses label as the alias
+func (s *Store) AddCertificateWithLabel(c *x509.Certificate, label string) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	var errs []error
+	for _, ks := range s.keystores {
+		if err := ks.record(ks.add(c, label)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AddCertificateWithKey imports chain and key as a private key entry under
+// label in each keystore, replacing the entry a renewal supersedes
+func (s *Store) AddCertificateWithKey(chain []*x509.Certificate, key crypto.Signer, label string) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	if label == "" {
+		label = aliasPrefix + cert.GetCertificateFingerprint(chain[0])[:16]
+	}
+	var errs []error
+	for _, ks := range s.keystores {
+		if err := ks.record(ks.addKey(chain, key, label)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveCertificate deletes the certificate from every keystore holding it
+func (s *Store) RemoveCertificate(c *x509.Certificate) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	var errs []error
+	for _, ks := range s.keystores {
+		if err := ks.record(ks.remove(c)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Backup copies each keystore into the backup directory, with an index of
+// where each copy belongs
+func (s *Store) Backup(backupPath string) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	var index strings.Builder
+	for i, ks := range s.keystores {
+		name := fmt.Sprintf("%02d-%s", i, filepath.Base(ks.Path))
+		if err := copyFile(ks.Path, filepath.Join(backupPath, name)); err != nil {
+			return fmt.Errorf("failed to back up keystore %s: %w", ks.Path, err)
+		}
+		fmt.Fprintf(&index, "%s\t%s\n", name, ks.Path)
+	}
+	return atomicfile.WriteFile(filepath.Join(backupPath, backupIndex), []byte(index.String()), 0600)
+}
+
+// Restore copies keystores back from a backup made by Backup
+func (s *Store) Restore(backupPath string) error {
+	f, err := os.Open(filepath.Join(backupPath, backupIndex))
+	if err != nil {
+		return fmt.Errorf("not a java keystore backup: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, path, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		if err := copyFile(filepath.Join(backupPath, name), path); err != nil {
+			return fmt.Errorf("failed to restore keystore %s: %w", path, err)
+		}
+	}
+	for _, ks := range s.keystores {
+		ks.entries = nil
+	}
+	return scanner.Err()
+}
+
+// WritePaths returns the keystore files
+func (s *Store) WritePaths() []string {
+	paths := make([]string, 0, len(s.keystores))
+	for _, ks := range s.keystores {
+		paths = append(paths, ks.Path)
+	}
+	return paths
+}
+
+// Validate lists every keystore, which fails on a wrong password or a
+// corrupt file
+func (s *Store) Validate() error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+	for _, ks := range s.keystores {
+		ks.entries = nil
+		if _, err := ks.list(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
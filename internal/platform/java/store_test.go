@@ -0,0 +1,172 @@
+package java
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestParseListing(t *testing.T) {
+	root := certstoretest.NewCertificate(t, "Example Root")
+	block := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))
+	listing := "Keystore type: PKCS12\nKeystore provider: SUN\n\nYour keystore contains 2 entries\n\n" +
+		"Alias name: exampleroot\nCreation date: Jan 1, 2024\nEntry type: trustedCertEntry\n\n" + block +
+		"\n\n*******************************************\n\n" +
+		"Alias name: trust-store-updater-0123456789abcdef\nCreation date: Jan 2, 2024\nEntry type: trustedCertEntry\n\n" + block
+
+	entries, err := parseListing([]byte(listing))
+	if err != nil {
+		t.Fatalf("parseListing: %v", err)
+	}
+	e, ok := entries[cert.GetCertificateFingerprint(root)]
+	if len(entries) != 1 || !ok {
+		t.Fatalf("expected one certificate, got %d", len(entries))
+	}
+	if want := []string{"exampleroot", "trust-store-updater-0123456789abcdef"}; !reflect.DeepEqual(e.aliases, want) {
+		t.Errorf("aliases = %q, want %q", e.aliases, want)
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	dir := t.TempDir()
+	for name, tt := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"jks":    {[]byte{0xfe, 0xed, 0xfe, 0xed, 0, 0, 0, 2}, "JKS"},
+		"pkcs12": {[]byte{0x30, 0x82, 0x01, 0x02}, "PKCS12"},
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := DetectType(path); err != nil || got != tt.want {
+			t.Errorf("%s: DetectType = %q, %v", name, got, err)
+		}
+	}
+}
+
+func TestDiscoverSharedKeystores(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "etc-cacerts")
+	if err := os.WriteFile(shared, []byte{0xfe, 0xed, 0xfe, 0xed}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two distro JVMs linking to one shared keystore, and a Java 8 JDK with its own
+	mkdir := func(rel string) string {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	for _, home := range []string{"jdk-17", "jdk-21"} {
+		if err := os.Symlink(shared, filepath.Join(mkdir(home+"/lib/security"), "cacerts")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(mkdir("jdk-8/jre/lib/security"), "cacerts"), []byte{0x30, 0x82}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mkdir("not-a-jvm")
+
+	var homes []string
+	for _, home := range []string{"jdk-17", "jdk-21", "jdk-8", "jdk-17", "not-a-jvm"} {
+		homes = append(homes, filepath.Join(dir, home))
+	}
+	jvms := jvmsIn(homes)
+	if len(jvms) != 3 {
+		t.Fatalf("expected 3 JVMs, got %+v", jvms)
+	}
+
+	s := newStore(map[string]string{"keytool": "keytool"}, jvms, Password{Value: DefaultPassword}, "", false)
+	keystores := s.Keystores()
+	if len(keystores) != 2 {
+		t.Fatalf("expected the distro JVMs to share one keystore, got %d keystores", len(keystores))
+	}
+	if len(keystores[0].JVMs) != 2 || len(keystores[1].JVMs) != 1 {
+		t.Errorf("JVMs per keystore: %v and %v", keystores[0].JVMs, keystores[1].JVMs)
+	}
+}
+
+func TestPasswordArgs(t *testing.T) {
+	for _, tt := range []struct {
+		p       Password
+		want    []string
+		wantEnv []string
+	}{
+		{Password{Value: DefaultPassword}, []string{"-storepass:env", StorePasswordEnv}, []string{StorePasswordEnv + "=changeit"}},
+		{Password{Env: "CACERTS_PASS"}, []string{"-storepass:env", "CACERTS_PASS"}, nil},
+		{Password{File: "/etc/cacerts.pass"}, []string{"-storepass:file", "/etc/cacerts.pass"}, nil},
+	} {
+		if got := tt.p.args(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("args = %q, want %q", got, tt.want)
+		}
+		if got := tt.p.env(); !reflect.DeepEqual(got, tt.wantEnv) {
+			t.Errorf("env = %q, want %q", got, tt.wantEnv)
+		}
+		if got := tt.p.destArgs(); got[0] != "-dest"+tt.want[0][1:] || got[1] != tt.want[1] {
+			t.Errorf("destArgs = %q", got)
+		}
+	}
+}
+
+func TestConfiguredJVMHomes(t *testing.T) {
+	home := filepath.Join(t.TempDir(), "temurin-21")
+	if err := os.MkdirAll(filepath.Join(home, "lib", "security"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "lib", "security", "cacerts"), []byte{0x30, 0x82}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStore(map[string]string{"jvm_homes": " " + home + ", "}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ks := range s.Keystores() {
+		if len(ks.JVMs) > 0 && ks.JVMs[0] == home {
+			return
+		}
+	}
+	t.Errorf("the configured JVM home wasn't managed: %+v", s.Keystores())
+}
+
+func TestTargetResults(t *testing.T) {
+	s := newStore(nil, []JVM{{Home: "/jdk-17", Cacerts: "/jdk-17/lib/security/cacerts"}}, Password{Value: DefaultPassword}, "PKCS12", false)
+	ks := s.Keystores()[0]
+	ks.result.Added = 2
+	_ = ks.record(os.ErrPermission)
+
+	results := s.TargetResults()
+	if len(results) != 1 || results[0].Target != ks.Path || results[0].Detail != "/jdk-17" {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[0].Added != 2 || results[0].Failed != 1 || len(results[0].Errors) != 1 {
+		t.Errorf("counts = %+v", results[0])
+	}
+}
+
+func TestAlternativesHomes(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("update-alternatives is only used on Linux")
+	}
+	runner := &certstoretest.Runner{}
+	runner.Respond("update-alternatives --list java", "/usr/lib/jvm/java-17-openjdk/bin/java\n/usr/lib/jvm/java-8-openjdk/jre/bin/java\n")
+	want := []string{"/usr/lib/jvm/java-17-openjdk", "/usr/lib/jvm/java-8-openjdk"}
+	if got := alternativesHomes(runner); !reflect.DeepEqual(got, want) {
+		t.Errorf("alternativesHomes = %q, want %q", got, want)
+	}
+
+	runner.Fail("update-alternatives --list java", "no alternatives for java")
+	if got := alternativesHomes(runner); got != nil {
+		t.Errorf("alternativesHomes = %q without update-alternatives, want none", got)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package java
+
+// trustedExecutable reports whether path can be trusted to run. Outside Unix
+// only system-wide installs are discovered, which need an administrator to
+// change.
+func trustedExecutable(path string) (string, bool) {
+	return path, true
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package java
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// trustedExecutable resolves path's symlinks and reports whether the file
+// and every directory above it belong to root or the running user and can't
+// be written by anyone else. The resolved path is the one to run, so a link
+// can't be repointed after the check.
+func trustedExecutable(path string) (string, bool) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", false
+	}
+	uid := uint32(os.Geteuid())
+	for dir := resolved; ; dir = filepath.Dir(dir) {
+		info, err := os.Lstat(dir)
+		if err != nil {
+			return "", false
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok || (st.Uid != 0 && st.Uid != uid) || info.Mode().Perm()&0022 != 0 {
+			return "", false
+		}
+		if filepath.Dir(dir) == dir {
+			return resolved, true
+		}
+	}
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package java
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrustedExecutable(t *testing.T) {
+	if _, ok := trustedExecutable("/bin/sh"); !ok {
+		t.Error("a system shell should be trusted")
+	}
+
+	// A JDK anyone can write to could have its keytool replaced
+	home := t.TempDir()
+	if err := os.Chmod(home, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(home, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	keytool := filepath.Join(home, "bin", "keytool")
+	if err := os.WriteFile(keytool, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := trustedExecutable(keytool); ok {
+		t.Error("a keytool in a world-writable directory was trusted")
+	}
+	if path := findKeytool("", home); path == keytool {
+		t.Error("findKeytool chose an untrusted keytool")
+	}
+}
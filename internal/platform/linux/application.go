@@ -1,17 +1,27 @@
 package linux
 
 import (
+	"crypto"
 	"crypto/x509"
 	"fmt"
+	"time"
 
 	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/cafile"
+	"github.com/webprofusion/trust-store-updater/internal/platform/chromium"
+	"github.com/webprofusion/trust-store-updater/internal/platform/java"
 )
 
 // ApplicationStore implements certificate store operations for Linux application stores
 type ApplicationStore struct {
-	target  string
-	options map[string]string
-	verbose bool
+	target   string
+	options  map[string]string
+	verbose  bool
+	runner   certstore.Runner
+	files    certstore.FilePolicy // flatpak bundles
+	java     *java.Store          // java-cacerts keystores
+	chromium *chromium.Store      // chromium-policy browser policies
+	cafiles  *cafile.Store        // web server, LDAP, VPN and database CA files
 }
 
 // NewApplicationStore creates a new Linux application certificate store
@@ -20,6 +30,7 @@ func NewApplicationStore(target string, options map[string]string, verbose bool)
 		target:  target,
 		options: options,
 		verbose: verbose,
+		runner:  &certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout},
 	}
 
 	// Validate target
@@ -27,6 +38,38 @@ func NewApplicationStore(target string, options map[string]string, verbose bool)
 		return nil, fmt.Errorf("unsupported application store target: %s", target)
 	}
 
+	if target == "java-cacerts" {
+		javaStore, err := java.NewStore(options, verbose)
+		if err != nil {
+			return nil, err
+		}
+		store.java = javaStore
+	}
+
+	if target == "flatpak" {
+		files, err := certstore.ParseFilePolicy(options)
+		if err != nil {
+			return nil, err
+		}
+		store.files = files
+	}
+
+	if target == "chromium-policy" {
+		chromiumStore, err := chromium.NewStore(options)
+		if err != nil {
+			return nil, err
+		}
+		store.chromium = chromiumStore
+	}
+
+	if isCAFileTarget(target) {
+		cafileStore, err := cafile.NewStore(target, options, verbose)
+		if err != nil {
+			return nil, err
+		}
+		store.cafiles = cafileStore
+	}
+
 	return store, nil
 }
 
@@ -46,6 +89,16 @@ func (a *ApplicationStore) IsSupported() bool {
 		return a.hasFirefox()
 	case "chrome":
 		return a.hasChrome()
+	case "chromium-policy":
+		return a.hasChromiumPolicy()
+	case "snap":
+		return a.hasSnap()
+	case "flatpak":
+		return a.hasFlatpak()
+	case "crostini":
+		return a.hasCrostini()
+	case "nginx", "apache", "haproxy", "ldap", "openvpn", "strongswan", "postgresql", "mysql":
+		return a.cafiles.IsSupported()
 	default:
 		return false
 	}
@@ -62,6 +115,16 @@ func (a *ApplicationStore) RequiresRoot() bool {
 		return false // User profile specific
 	case "chrome":
 		return false // User profile specific
+	case "chromium-policy":
+		return true // Machine-wide browser policy
+	case "snap":
+		return true // snapd system configuration
+	case "flatpak":
+		return true // System-wide overrides
+	case "crostini":
+		return false // lxc runs as the termina VM's user
+	case "nginx", "apache", "haproxy", "ldap", "openvpn", "strongswan", "postgresql", "mysql":
+		return true // Server configuration under /etc
 	default:
 		return false
 	}
@@ -78,6 +141,16 @@ func (a *ApplicationStore) ListCertificates() ([]*x509.Certificate, error) {
 		return a.listFirefoxCertificates()
 	case "chrome":
 		return a.listChromeCertificates()
+	case "chromium-policy":
+		return a.listChromiumPolicyCertificates()
+	case "snap":
+		return a.listSnapCertificates()
+	case "flatpak":
+		return a.listFlatpakCertificates()
+	case "crostini":
+		return a.listCrostiniCertificates()
+	case "nginx", "apache", "haproxy", "ldap", "openvpn", "strongswan", "postgresql", "mysql":
+		return a.cafiles.ListCertificates()
 	default:
 		return nil, fmt.Errorf("unsupported target: %s", a.target)
 	}
@@ -94,11 +167,79 @@ func (a *ApplicationStore) AddCertificate(cert *x509.Certificate) error {
 		return a.addFirefoxCertificate(cert)
 	case "chrome":
 		return a.addChromeCertificate(cert)
+	case "chromium-policy":
+		return a.addChromiumPolicyCertificate(cert)
+	case "snap":
+		return a.addSnapCertificate(cert)
+	case "flatpak":
+		return a.addFlatpakCertificate(cert)
+	case "crostini":
+		return a.addCrostiniCertificate(cert)
+	case "nginx", "apache", "haproxy", "ldap", "openvpn", "strongswan", "postgresql", "mysql":
+		return a.cafiles.AddCertificate(cert)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
 }
 
+// AddCertificateWithLabel adds a certificate under an alias where the
+// application has one (java-cacerts); other targets ignore the label
+func (a *ApplicationStore) AddCertificateWithLabel(cert *x509.Certificate, label string) error {
+	if a.java != nil {
+		return a.java.AddCertificateWithLabel(cert, label)
+	}
+	return a.AddCertificate(cert)
+}
+
+// SupportedPurposes returns the trust purposes java-cacerts can limit trust
+// to; other targets can't limit trust
+func (a *ApplicationStore) SupportedPurposes() []string {
+	if a.java != nil {
+		return a.java.SupportedPurposes()
+	}
+	return nil
+}
+
+// AddCertificateForPurposes adds a certificate limited to purposes
+func (a *ApplicationStore) AddCertificateForPurposes(cert *x509.Certificate, label string, purposes []string) error {
+	if a.java != nil {
+		return a.java.AddCertificateForPurposes(cert, label, purposes)
+	}
+	return fmt.Errorf("application %s can't limit trust to purposes", a.target)
+}
+
+// AddCertificateWithKey stores a leaf certificate and its key in the
+// java-cacerts keystores; other targets hold no keys
+func (a *ApplicationStore) AddCertificateWithKey(chain []*x509.Certificate, key crypto.Signer, label string) error {
+	if a.java != nil {
+		return a.java.AddCertificateWithKey(chain, key, label)
+	}
+	return fmt.Errorf("application %s can't hold private keys", a.target)
+}
+
+// TargetResults reports each Java keystore's changes for java-cacerts, and
+// each CA file's for web server and database targets
+func (a *ApplicationStore) TargetResults() []certstore.TargetResult {
+	switch {
+	case a.java != nil:
+		return a.java.TargetResults()
+	case a.cafiles != nil:
+		return a.cafiles.TargetResults()
+	}
+	return nil
+}
+
+// WritePaths returns the Java keystores or CA files the store changes
+func (a *ApplicationStore) WritePaths() []string {
+	switch {
+	case a.java != nil:
+		return a.java.WritePaths()
+	case a.cafiles != nil:
+		return a.cafiles.WritePaths()
+	}
+	return nil
+}
+
 // RemoveCertificate removes a certificate from the store
 func (a *ApplicationStore) RemoveCertificate(cert *x509.Certificate) error {
 	switch a.target {
@@ -110,6 +251,16 @@ func (a *ApplicationStore) RemoveCertificate(cert *x509.Certificate) error {
 		return a.removeFirefoxCertificate(cert)
 	case "chrome":
 		return a.removeChromeCertificate(cert)
+	case "chromium-policy":
+		return a.removeChromiumPolicyCertificate(cert)
+	case "snap":
+		return a.removeSnapCertificate(cert)
+	case "flatpak":
+		return a.removeFlatpakCertificate(cert)
+	case "crostini":
+		return a.removeCrostiniCertificate(cert)
+	case "nginx", "apache", "haproxy", "ldap", "openvpn", "strongswan", "postgresql", "mysql":
+		return a.cafiles.RemoveCertificate(cert)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
@@ -126,6 +277,16 @@ func (a *ApplicationStore) Backup(backupPath string) error {
 		return a.backupFirefox(backupPath)
 	case "chrome":
 		return a.backupChrome(backupPath)
+	case "chromium-policy":
+		return a.backupChromiumPolicy(backupPath)
+	case "snap":
+		return a.backupSnap(backupPath)
+	case "flatpak":
+		return a.backupFlatpak(backupPath)
+	case "crostini":
+		return a.backupCrostini(backupPath)
+	case "nginx", "apache", "haproxy", "ldap", "openvpn", "strongswan", "postgresql", "mysql":
+		return a.cafiles.Backup(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
@@ -142,24 +303,63 @@ func (a *ApplicationStore) Restore(backupPath string) error {
 		return a.restoreFirefox(backupPath)
 	case "chrome":
 		return a.restoreChrome(backupPath)
+	case "chromium-policy":
+		return a.restoreChromiumPolicy(backupPath)
+	case "snap":
+		return a.restoreSnap(backupPath)
+	case "flatpak":
+		return a.restoreFlatpak(backupPath)
+	case "crostini":
+		return a.restoreCrostini(backupPath)
+	case "nginx", "apache", "haproxy", "ldap", "openvpn", "strongswan", "postgresql", "mysql":
+		return a.cafiles.Restore(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
 }
 
+// SetCommandTimeout bounds external commands such as snap, flatpak, keytool and openssl
+func (a *ApplicationStore) SetCommandTimeout(timeout time.Duration) {
+	certstore.SetRunnerTimeout(a.runner, timeout)
+	if a.java != nil {
+		a.java.SetCommandTimeout(timeout)
+	}
+	if a.cafiles != nil {
+		a.cafiles.SetCommandTimeout(timeout)
+	}
+}
+
 // Validate checks if the store is in a valid state
 func (a *ApplicationStore) Validate() error {
 	if !a.IsSupported() {
 		return fmt.Errorf("application %s is not available on this system", a.target)
 	}
+	if a.cafiles != nil {
+		return a.cafiles.Validate()
+	}
 	return nil
 }
 
 // Helper methods
 
+// ApplicationTargets returns every application store target known on this platform,
+// whether or not it is available on this machine
+func ApplicationTargets() []string {
+	return []string{"docker", "java-cacerts", "firefox", "chrome", "chromium-policy", "snap", "flatpak", "crostini", "nginx", "apache", "haproxy", "ldap", "openvpn", "strongswan", "postgresql", "mysql"}
+}
+
+// isCAFileTarget reports whether target manages CA files found in an
+// application's configuration
+func isCAFileTarget(target string) bool {
+	switch target {
+	case "nginx", "apache", "haproxy", "ldap", "openvpn", "strongswan", "postgresql", "mysql":
+		return true
+	}
+	return false
+}
+
 func isValidApplicationTarget(target string) bool {
-	validTargets := []string{"docker", "java-cacerts", "firefox", "chrome"}
-	for _, valid := range validTargets {
+	for _, valid := range ApplicationTargets() {
 		if target == valid {
 			return true
 		}
@@ -173,8 +373,11 @@ func (a *ApplicationStore) hasDocker() bool {
 }
 
 func (a *ApplicationStore) hasJava() bool {
-	// Check if Java is installed and find cacerts
-	return false // Placeholder
+	return a.java.IsSupported()
+}
+
+func (a *ApplicationStore) hasChromiumPolicy() bool {
+	return a.chromium.IsSupported()
 }
 
 func (a *ApplicationStore) hasFirefox() bool {
@@ -210,23 +413,23 @@ func (a *ApplicationStore) restoreDocker(backupPath string) error {
 
 // Java certificate operations
 func (a *ApplicationStore) listJavaCertificates() ([]*x509.Certificate, error) {
-	return nil, fmt.Errorf("java certificate listing not implemented")
+	return a.java.ListCertificates()
 }
 
 func (a *ApplicationStore) addJavaCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("java certificate addition not implemented")
+	return a.java.AddCertificate(cert)
 }
 
 func (a *ApplicationStore) removeJavaCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("java certificate removal not implemented")
+	return a.java.RemoveCertificate(cert)
 }
 
 func (a *ApplicationStore) backupJava(backupPath string) error {
-	return fmt.Errorf("java backup not implemented")
+	return a.java.Backup(backupPath)
 }
 
 func (a *ApplicationStore) restoreJava(backupPath string) error {
-	return fmt.Errorf("java restore not implemented")
+	return a.java.Restore(backupPath)
 }
 
 // Firefox certificate operations
@@ -270,3 +473,24 @@ func (a *ApplicationStore) backupChrome(backupPath string) error {
 func (a *ApplicationStore) restoreChrome(backupPath string) error {
 	return fmt.Errorf("chrome restore not implemented")
 }
+
+// Chromium policy operations
+func (a *ApplicationStore) listChromiumPolicyCertificates() ([]*x509.Certificate, error) {
+	return a.chromium.ListCertificates()
+}
+
+func (a *ApplicationStore) addChromiumPolicyCertificate(cert *x509.Certificate) error {
+	return a.chromium.AddCertificate(cert)
+}
+
+func (a *ApplicationStore) removeChromiumPolicyCertificate(cert *x509.Certificate) error {
+	return a.chromium.RemoveCertificate(cert)
+}
+
+func (a *ApplicationStore) backupChromiumPolicy(backupPath string) error {
+	return a.chromium.Backup(backupPath)
+}
+
+func (a *ApplicationStore) restoreChromiumPolicy(backupPath string) error {
+	return a.chromium.Restore(backupPath)
+}
@@ -0,0 +1,175 @@
+package linux
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// AnchorScriptPrelude selects the CA tooling available inside a distro or
+// container, in the same order the Linux system store prefers it, setting
+// $dir to the anchor directory and $update to the rebuild command
+const AnchorScriptPrelude = `set -e
+if command -v update-ca-certificates >/dev/null 2>&1; then
+  dir=/usr/local/share/ca-certificates; update="update-ca-certificates"
+elif command -v update-ca-trust >/dev/null 2>&1; then
+  dir=/etc/pki/ca-trust/source/anchors; update="update-ca-trust extract"
+else
+  echo "no CA update tooling (update-ca-certificates or update-ca-trust) found" >&2; exit 3
+fi
+mkdir -p "$dir"
+`
+
+// Crostini operations. The tool runs in the termina VM of a ChromeOS device
+// (vsh termina) and applies certificates inside each selected Linux container
+// with lxc exec, so tools running in the containers trust the managed roots.
+// ChromeOS itself takes them from ONC policy, see render --target onc.
+
+func (a *ApplicationStore) hasCrostini() bool {
+	if _, err := exec.LookPath("lxc"); err != nil {
+		return false
+	}
+	containers, err := a.crostiniContainers()
+	return err == nil && len(containers) > 0
+}
+
+// crostiniContainers returns options["containers"] (comma separated) or every
+// running container
+func (a *ApplicationStore) crostiniContainers() ([]string, error) {
+	if configured := a.options["containers"]; configured != "" {
+		var containers []string
+		for _, c := range strings.Split(configured, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				containers = append(containers, c)
+			}
+		}
+		return containers, nil
+	}
+
+	output, err := a.runner.Run("lxc", "list", "--format", "csv", "-c", "ns")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Crostini containers: %w", err)
+	}
+	return parseLXCContainers(output), nil
+}
+
+// crostiniRun runs a shell script as root inside container with the tooling
+// prelude. args are available to the script as $1, $2, ...
+func (a *ApplicationStore) crostiniRun(container string, input []byte, script string, args ...string) ([]byte, error) {
+	cmdArgs := append([]string{"exec", container, "--", "sh", "-c", AnchorScriptPrelude + script, "sh"}, args...)
+	output, err := a.runner.RunWithInput(input, "lxc", cmdArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("Crostini container %s: %w", container, err)
+	}
+	return output, nil
+}
+
+// listCrostiniCertificates returns the anchor certificates present in every
+// selected container, so a container that is missing one gets it on the next
+// update
+func (a *ApplicationStore) listCrostiniCertificates() ([]*x509.Certificate, error) {
+	containers, err := a.crostiniContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	var common []*x509.Certificate
+	for i, container := range containers {
+		output, err := a.crostiniRun(container, nil, `for f in "$dir"/*; do [ -f "$f" ] && cat "$f"; echo; done`)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := certstore.ParsePEMBundle(output)
+		if err != nil {
+			return nil, fmt.Errorf("Crostini container %s: %w", container, err)
+		}
+
+		if i == 0 {
+			common = certs
+			continue
+		}
+		var kept []*x509.Certificate
+		for _, c := range common {
+			if certstore.ContainsCertificate(certs, c) {
+				kept = append(kept, c)
+			}
+		}
+		common = kept
+	}
+	return common, nil
+}
+
+func (a *ApplicationStore) addCrostiniCertificate(cert *x509.Certificate) error {
+	return a.forEachContainer("Adding certificate to", func(container string) error {
+		_, err := a.crostiniRun(container, ManagedCertificatePEM(cert), `cat > "$dir/$1"; $update >/dev/null`, CertificateFilename(cert))
+		return err
+	})
+}
+
+func (a *ApplicationStore) removeCrostiniCertificate(cert *x509.Certificate) error {
+	return a.forEachContainer("Removing certificate from", func(container string) error {
+		_, err := a.crostiniRun(container, nil, `rm -f "$dir/$1"; $update >/dev/null`, CertificateFilename(cert))
+		return err
+	})
+}
+
+// backupCrostini saves each container's anchor directory as
+// <backupPath>/<container>.tar
+func (a *ApplicationStore) backupCrostini(backupPath string) error {
+	if err := os.MkdirAll(backupPath, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return a.forEachContainer("Backing up", func(container string) error {
+		archive, err := a.crostiniRun(container, nil, `tar -C "$dir" -cf - .`)
+		if err != nil {
+			return err
+		}
+		return atomicfile.WriteFile(filepath.Join(backupPath, container+".tar"), archive, 0600)
+	})
+}
+
+func (a *ApplicationStore) restoreCrostini(backupPath string) error {
+	return a.forEachContainer("Restoring", func(container string) error {
+		archive, err := os.ReadFile(filepath.Join(backupPath, container+".tar"))
+		if err != nil {
+			return fmt.Errorf("no backup for Crostini container %s: %w", container, err)
+		}
+		_, err = a.crostiniRun(container, archive, `tar -C "$dir" -xf -; $update >/dev/null`)
+		return err
+	})
+}
+
+func (a *ApplicationStore) forEachContainer(action string, fn func(container string) error) error {
+	containers, err := a.crostiniContainers()
+	if err != nil {
+		return err
+	}
+	for _, container := range containers {
+		if a.verbose {
+			fmt.Printf("%s Crostini container %s\n", action, container)
+		}
+		if err := fn(container); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLXCContainers returns the running containers in `lxc list --format csv
+// -c ns` output, one "name,STATE" line per container
+func parseLXCContainers(output []byte) []string {
+	var containers []string
+	for _, line := range strings.Split(string(output), "\n") {
+		name, state, ok := strings.Cut(strings.TrimSpace(line), ",")
+		if ok && name != "" && strings.EqualFold(state, "RUNNING") {
+			containers = append(containers, name)
+		}
+	}
+	return containers
+}
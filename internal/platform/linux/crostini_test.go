@@ -0,0 +1,14 @@
+package linux
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLXCContainers(t *testing.T) {
+	output := []byte("penguin,RUNNING\ndev,STOPPED\nbuild,RUNNING\n\n")
+	want := []string{"penguin", "build"}
+	if got := parseLXCContainers(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
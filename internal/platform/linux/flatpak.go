@@ -0,0 +1,199 @@
+package linux
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// defaultFlatpakDir holds the bundle shared with Flatpak apps. Flatpak won't
+// expose host paths under /etc or /usr to apps, so it lives under /opt.
+const defaultFlatpakDir = "/opt/trust-store-updater/flatpak"
+
+const (
+	flatpakManagedFile = "managed.pem"
+	flatpakBundleFile  = "ca-certificates.crt"
+)
+
+// hostBundles are the host CA bundles, by distro family, the Flatpak bundle
+// starts from so apps keep trusting the public roots
+var hostBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+}
+
+// Flatpak operations. Apps see their runtime's CA bundle rather than the
+// host's, so the host bundle plus the managed certificates is written to a
+// shared directory and a system override exposes it read-only to apps with
+// SSL_CERT_FILE pointing at it.
+//
+// Options:
+//   - apps: comma separated app IDs to override (default every app)
+//   - directory: where the bundle is kept (default /opt/trust-store-updater/flatpak)
+//   - base_bundle: host bundle to start from (default the distro's bundle)
+//   - file_mode, owner, group: applied to the written bundles
+
+func (a *ApplicationStore) hasFlatpak() bool {
+	_, err := exec.LookPath("flatpak")
+	return err == nil
+}
+
+func (a *ApplicationStore) flatpakDir() string {
+	if dir := a.options["directory"]; dir != "" {
+		return dir
+	}
+	return defaultFlatpakDir
+}
+
+// flatpakApps returns options["apps"] (comma separated); none means the
+// override applies to every app
+func (a *ApplicationStore) flatpakApps() []string {
+	var apps []string
+	for _, app := range strings.Split(a.options["apps"], ",") {
+		if app = strings.TrimSpace(app); app != "" {
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+func (a *ApplicationStore) flatpakBaseBundle() string {
+	if base := a.options["base_bundle"]; base != "" {
+		return base
+	}
+	for _, path := range hostBundles {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// listFlatpakCertificates returns the managed certificates shared with apps
+func (a *ApplicationStore) listFlatpakCertificates() ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(filepath.Join(a.flatpakDir(), flatpakManagedFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return certstore.ParsePEMBundle(data)
+}
+
+func (a *ApplicationStore) addFlatpakCertificate(c *x509.Certificate) error {
+	managed, err := a.listFlatpakCertificates()
+	if err != nil {
+		return err
+	}
+	if certstore.ContainsCertificate(managed, c) {
+		return nil
+	}
+	return a.updateFlatpak(append(managed, c))
+}
+
+func (a *ApplicationStore) removeFlatpakCertificate(c *x509.Certificate) error {
+	managed, err := a.listFlatpakCertificates()
+	if err != nil {
+		return err
+	}
+	kept := make([]*x509.Certificate, 0, len(managed))
+	for _, existing := range managed {
+		if !existing.Equal(c) {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == len(managed) {
+		return nil
+	}
+	return a.updateFlatpak(kept)
+}
+
+// updateFlatpak rewrites the shared bundle and makes sure apps are pointed at it
+func (a *ApplicationStore) updateFlatpak(managed []*x509.Certificate) error {
+	if err := writeFlatpakBundle(a.flatpakDir(), a.flatpakBaseBundle(), managed, a.files); err != nil {
+		return err
+	}
+	return a.applyFlatpakOverrides()
+}
+
+// writeFlatpakBundle writes the managed certificates and the bundle apps
+// read: the base bundle followed by the managed certificates
+func writeFlatpakBundle(dir, baseBundle string, managed []*x509.Certificate, policy certstore.FilePolicy) error {
+	var base []byte
+	if baseBundle != "" {
+		data, err := os.ReadFile(baseBundle)
+		if err != nil {
+			return fmt.Errorf("failed to read host bundle: %w", err)
+		}
+		base = data
+		if len(base) > 0 && base[len(base)-1] != '\n' {
+			base = append(base, '\n')
+		}
+	}
+
+	// Apps run as the user, so the directory must stay world readable
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create flatpak bundle directory: %w", err)
+	}
+	managedPEM := certstore.EncodeManagedBundle(managed)
+	if err := policy.WriteFile(filepath.Join(dir, flatpakManagedFile), managedPEM); err != nil {
+		return err
+	}
+	return policy.WriteFile(filepath.Join(dir, flatpakBundleFile), append(base, managedPEM...))
+}
+
+// applyFlatpakOverrides exposes the bundle directory to the selected apps (or
+// all apps) and points OpenSSL based code at the bundle
+func (a *ApplicationStore) applyFlatpakOverrides() error {
+	dir := a.flatpakDir()
+	args := []string{"override", "--system",
+		"--filesystem=" + dir + ":ro",
+		"--env=SSL_CERT_FILE=" + filepath.Join(dir, flatpakBundleFile)}
+
+	apps := a.flatpakApps()
+	if len(apps) == 0 {
+		_, err := a.runner.Run("flatpak", args...)
+		return err
+	}
+	for _, app := range apps {
+		if a.verbose {
+			fmt.Printf("Overriding Flatpak app %s\n", app)
+		}
+		if _, err := a.runner.Run("flatpak", append(args, app)...); err != nil {
+			return fmt.Errorf("flatpak app %s: %w", app, err)
+		}
+	}
+	return nil
+}
+
+func (a *ApplicationStore) backupFlatpak(backupPath string) error {
+	managed, err := a.listFlatpakCertificates()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return atomicfile.WriteFile(filepath.Join(backupPath, flatpakManagedFile), certstore.EncodeManagedBundle(managed), 0600)
+}
+
+func (a *ApplicationStore) restoreFlatpak(backupPath string) error {
+	data, err := os.ReadFile(filepath.Join(backupPath, flatpakManagedFile))
+	if err != nil {
+		return fmt.Errorf("no flatpak backup: %w", err)
+	}
+	managed, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		return err
+	}
+	return a.updateFlatpak(managed)
+}
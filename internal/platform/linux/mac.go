@@ -0,0 +1,135 @@
+package linux
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// macStatus is the mandatory access control in force for this process:
+// SELinux on Fedora/RHEL, AppArmor on Debian/Ubuntu/SUSE. A denial from
+// either looks like a plain permission error even when running as root.
+type macStatus struct {
+	selinux  string // "enforcing", "permissive" or "" when disabled
+	apparmor string // this process's profile, "" when AppArmor is off
+}
+
+// detectMAC reads the SELinux mode and AppArmor profile under root, which is
+// "/" outside tests
+func detectMAC(root string) macStatus {
+	var m macStatus
+	if data, err := os.ReadFile(filepath.Join(root, "sys/fs/selinux/enforce")); err == nil {
+		m.selinux = "permissive"
+		if strings.TrimSpace(string(data)) == "1" {
+			m.selinux = "enforcing"
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "sys/module/apparmor")); err == nil {
+		// Newer kernels keep the AppArmor label apart from other LSMs'
+		data, err := os.ReadFile(filepath.Join(root, "proc/self/attr/apparmor/current"))
+		if err != nil {
+			data, err = os.ReadFile(filepath.Join(root, "proc/self/attr/current"))
+		}
+		if err == nil {
+			m.apparmor = strings.TrimRight(string(data), "\x00\n")
+		}
+	}
+	return m
+}
+
+// confined reports whether an AppArmor profile other than unconfined applies
+func (m macStatus) confined() bool {
+	return m.apparmor != "" && m.apparmor != "unconfined"
+}
+
+// explain turns a permission error from op on path into one naming the
+// policy that most likely denied it and how to allow it. Other errors, and
+// permission errors with no MAC in force, are returned unchanged.
+func (m macStatus) explain(op, path string, err error) error {
+	if err == nil || !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+	switch {
+	case m.selinux == "enforcing":
+		return fmt.Errorf("SELinux denied %s %s (%w); check `ausearch -m avc -ts recent` for the denial, "+
+			"run as a domain allowed to write certificate files (for example unconfined_t or a custom policy module), "+
+			"and relabel the directory with `restorecon -R %s`", op, path, err, filepath.Dir(path))
+	case m.confined():
+		return fmt.Errorf("AppArmor profile %q denied %s %s (%w); check `journalctl -k | grep apparmor=\"DENIED\"`, "+
+			"then allow the path in the profile (e.g. `%s/** rw,`) or run the tool unconfined", m.apparmor, op, path, err, filepath.Dir(path))
+	}
+	return err
+}
+
+// relabel restores the default SELinux context of paths written by this
+// tool, since a file created from a copy or a temp directory keeps the wrong
+// one and update-ca-trust then can't read it. It does nothing unless SELinux
+// is enabled and restorecon is installed.
+func (s *SystemStore) relabel(recursive bool, paths ...string) error {
+	if s.mac.selinux == "" || s.options["restorecon"] == "false" {
+		return nil
+	}
+	if _, err := exec.LookPath("restorecon"); err != nil {
+		return nil
+	}
+	args := []string{"-F"}
+	if recursive {
+		args = append(args, "-R")
+	}
+	if _, err := s.runner.Run("restorecon", append(args, paths...)...); err != nil {
+		return fmt.Errorf("failed to restore SELinux context of %s: %w", strings.Join(paths, ", "), err)
+	}
+	return nil
+}
+
+// mislabeled lists the files under dir whose SELinux context differs from
+// the policy default, as restorecon would report them
+func (s *SystemStore) mislabeled(dir string) ([]string, error) {
+	output, err := s.runner.Run("restorecon", "-R", "-n", "-v", dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, line := range strings.Split(string(output), "\n") {
+		// e.g. "Would relabel /etc/pki/ca-trust/source/anchors/x.crt from ... to ..."
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if f == "relabel" && i+1 < len(fields) {
+				paths = append(paths, fields[i+1])
+				break
+			}
+		}
+	}
+	return paths, nil
+}
+
+// checkLabels reports anchor files with the wrong SELinux context, fixed by
+// relabelling the directory
+func (s *SystemStore) checkLabels() []certstore.HealthIssue {
+	if s.mac.selinux == "" {
+		return nil
+	}
+	if _, err := exec.LookPath("restorecon"); err != nil {
+		return nil
+	}
+	dir := s.anchorDir()
+	paths, err := s.mislabeled(dir)
+	if err != nil || len(paths) == 0 {
+		return nil
+	}
+	return []certstore.HealthIssue{{
+		Check:   "selinux-context",
+		Message: fmt.Sprintf("%d file(s) in %s have the wrong SELinux context, so the trust tooling may not read them: %s", len(paths), dir, strings.Join(paths, ", ")),
+		Path:    dir,
+		Fix: func() error {
+			_, err := s.runner.Run("restorecon", "-R", "-F", dir)
+			return err
+		},
+	}}
+}
@@ -0,0 +1,66 @@
+package linux
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectMAC(t *testing.T) {
+	root := t.TempDir()
+	if m := detectMAC(root); m != (macStatus{}) {
+		t.Errorf("no MAC: got %+v", m)
+	}
+
+	writeTestFile(t, filepath.Join(root, "sys/fs/selinux/enforce"), "1")
+	if m := detectMAC(root); m.selinux != "enforcing" {
+		t.Errorf("selinux = %q, want enforcing", m.selinux)
+	}
+
+	root = t.TempDir()
+	writeTestFile(t, filepath.Join(root, "sys/module/apparmor/parameters/enabled"), "Y")
+	writeTestFile(t, filepath.Join(root, "proc/self/attr/current"), "/usr/bin/trust-store-updater (enforce)\n")
+	m := detectMAC(root)
+	if m.apparmor != "/usr/bin/trust-store-updater (enforce)" || !m.confined() {
+		t.Errorf("apparmor = %q, confined = %v", m.apparmor, m.confined())
+	}
+}
+
+func TestExplainDenial(t *testing.T) {
+	denied := &fs.PathError{Op: "open", Path: "/etc/pki/ca-trust/source/anchors/a.crt", Err: fs.ErrPermission}
+	path := denied.Path
+
+	if err := (macStatus{}).explain("writing", path, denied); err != denied {
+		t.Errorf("no MAC: got %v, want the error unchanged", err)
+	}
+	if err := (macStatus{apparmor: "unconfined"}).explain("writing", path, denied); err != denied {
+		t.Errorf("unconfined: got %v, want the error unchanged", err)
+	}
+	other := fmt.Errorf("disk full")
+	if err := (macStatus{selinux: "enforcing"}).explain("writing", path, other); err != other {
+		t.Errorf("non-permission error: got %v, want it unchanged", err)
+	}
+
+	err := (macStatus{selinux: "enforcing"}).explain("writing", path, denied)
+	if !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), "SELinux") || !strings.Contains(err.Error(), "restorecon") {
+		t.Errorf("selinux: got %v", err)
+	}
+	err = (macStatus{apparmor: "tsu (enforce)"}).explain("writing", path, denied)
+	if !errors.Is(err, fs.ErrPermission) || !strings.Contains(err.Error(), "AppArmor") {
+		t.Errorf("apparmor: got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package linux
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// ostreeTarget is the system store target for OSTree based systems such as
+// Fedora CoreOS and Silverblue. /usr is read-only there, so anchors go into
+// the writable /etc overlay and update-ca-trust rebuilds the bundle, as for
+// the update-ca-trust target, but pending deployments are checked as well.
+const ostreeTarget = "ostree"
+
+// ostreeBootedPath exists when the running system was booted from an OSTree
+// deployment
+var ostreeBootedPath = "/run/ostree-booted"
+
+func ostreeBooted() bool {
+	_, err := os.Stat(ostreeBootedPath)
+	return err == nil
+}
+
+// ostreeDeployment is an entry in the output of rpm-ostree status --json
+type ostreeDeployment struct {
+	Checksum string `json:"checksum"`
+	Version  string `json:"version"`
+	Booted   bool   `json:"booted"`
+	Staged   bool   `json:"staged"`
+}
+
+// pendingDeployment returns why the next boot would lose or lack changes made
+// to /etc now, from the output of rpm-ostree status --json. The first
+// deployment is the one booted next. A staged deployment merges /etc when
+// the system shuts down, so it carries the change; any other pending
+// deployment had its /etc merged when it was created and doesn't.
+func pendingDeployment(status []byte) (string, error) {
+	var parsed struct {
+		Deployments []ostreeDeployment `json:"deployments"`
+	}
+	if err := json.Unmarshal(status, &parsed); err != nil {
+		return "", fmt.Errorf("failed to parse rpm-ostree status: %w", err)
+	}
+	if len(parsed.Deployments) == 0 {
+		return "", nil
+	}
+	next := parsed.Deployments[0]
+	if next.Booted || next.Staged {
+		return "", nil
+	}
+	name := next.Version
+	if name == "" && len(next.Checksum) >= 12 {
+		name = next.Checksum[:12]
+	}
+	return fmt.Sprintf("deployment %s was created before this change and its /etc lacks it; "+
+		"run rpm-ostree cleanup --pending and upgrade again, or reboot into it and rerun the update", name), nil
+}
+
+// PendingReboot reports a pending OSTree deployment after the store changed.
+// Without rpm-ostree the deployments can't be checked and nothing is reported.
+func (s *SystemStore) PendingReboot() string {
+	if s.target != ostreeTarget || !s.changed {
+		return ""
+	}
+	if _, err := exec.LookPath("rpm-ostree"); err != nil {
+		return ""
+	}
+	status, err := s.runner.Run("rpm-ostree", "status", "--json")
+	if err != nil {
+		certstore.LogWarnf("Failed to check OSTree deployments: %v", err)
+		return ""
+	}
+	reason, err := pendingDeployment(status)
+	if err != nil {
+		certstore.LogWarnf("%v", err)
+	}
+	return reason
+}
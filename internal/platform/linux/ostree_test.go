@@ -0,0 +1,30 @@
+package linux
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPendingDeployment(t *testing.T) {
+	tests := []struct {
+		name, status, want string
+	}{
+		{"booted is next", `{"deployments":[{"checksum":"aaaa","booted":true},{"checksum":"bbbb","booted":false}]}`, ""},
+		{"staged", `{"deployments":[{"checksum":"bbbb","version":"40.20261010.3.0","staged":true},{"checksum":"aaaa","booted":true}]}`, ""},
+		{"pending", `{"deployments":[{"checksum":"0123456789abcdef","booted":false},{"checksum":"aaaa","booted":true}]}`, "deployment 0123456789ab was created before this change"},
+		{"pending with version", `{"deployments":[{"checksum":"bbbb","version":"40.20261010.3.0"},{"checksum":"aaaa","booted":true}]}`, "deployment 40.20261010.3.0 "},
+	}
+	for _, tt := range tests {
+		got, err := pendingDeployment([]byte(tt.status))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: pendingDeployment = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := pendingDeployment([]byte("not json")); err == nil {
+		t.Error("expected an error for output that isn't JSON")
+	}
+}
@@ -0,0 +1,108 @@
+package linux
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// rebuildCounts matches the summary line of update-ca-certificates, e.g.
+// "1 added, 0 removed; done."
+var rebuildCounts = regexp.MustCompile(`(\d+) added, (\d+) removed`)
+
+// rebuildPattern is a known problem reported by update-ca-certificates or
+// update-ca-trust. Fatal problems leave the system bundle out of step with
+// the certificate files even though the tool exits successfully.
+type rebuildPattern struct {
+	match *regexp.Regexp
+	fatal bool
+}
+
+var rebuildPatterns = []rebuildPattern{
+	{regexp.MustCompile(`(?i)skipping duplicate certificate`), false},
+	{regexp.MustCompile(`(?i)(broken|dangling) (sym)?link`), true},
+	{regexp.MustCompile(`(?i)ln: failed to create`), true},
+	{regexp.MustCompile(`(?i)does not contain (a|exactly one) certificate`), true},
+	{regexp.MustCompile(`(?i)no such file or directory`), true},
+	{regexp.MustCompile(`(?i)(p11-kit|trust): .*(couldn't|failed|cannot)`), true},
+}
+
+// rebuildOutput is the parsed output of one rebuild run
+type rebuildOutput struct {
+	added, removed int
+	warnings       []string
+	problems       []string
+}
+
+// parseRebuildOutput extracts the added/removed counts and known problems
+// from the combined output of a rebuild tool
+func parseRebuildOutput(output string) rebuildOutput {
+	var parsed rebuildOutput
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if m := rebuildCounts.FindStringSubmatch(line); m != nil {
+			added, _ := strconv.Atoi(m[1])
+			removed, _ := strconv.Atoi(m[2])
+			parsed.added += added
+			parsed.removed += removed
+			continue
+		}
+		// The bundle itself holds many certificates, so rehash always skips it
+		if strings.Contains(line, "ca-certificates.crt") {
+			continue
+		}
+		for _, p := range rebuildPatterns {
+			if !p.match.MatchString(line) {
+				continue
+			}
+			if p.fatal {
+				parsed.problems = append(parsed.problems, line)
+			} else {
+				parsed.warnings = append(parsed.warnings, line)
+			}
+			break
+		}
+	}
+	return parsed
+}
+
+// rebuild regenerates the system bundle after a change, records what the tool
+// reported and fails on known problems it doesn't signal with its exit status
+func (s *SystemStore) rebuild() error {
+	tool, args := "update-ca-certificates", []string(nil)
+	if s.target == "update-ca-trust" || s.target == ostreeTarget {
+		tool, args = "update-ca-trust", []string{"extract"}
+	}
+
+	stdout, stderr, err := s.runner.RunCaptured(tool, args...)
+	if err != nil {
+		return err
+	}
+
+	parsed := parseRebuildOutput(string(stdout) + "\n" + string(stderr))
+	if s.rebuilds == nil {
+		s.rebuilds = &certstore.RebuildSummary{Tool: tool}
+	}
+	s.rebuilds.Record(parsed.added, parsed.removed, parsed.warnings)
+	for _, w := range parsed.warnings {
+		certstore.LogWarnf("%s: %s", tool, w)
+	}
+
+	if len(parsed.problems) > 0 {
+		return fmt.Errorf("%s reported problems: %s", tool, strings.Join(parsed.problems, "; "))
+	}
+	s.changed = true
+	return nil
+}
+
+// RebuildSummary returns what update-ca-certificates or update-ca-trust
+// reported since the store was created
+func (s *SystemStore) RebuildSummary() *certstore.RebuildSummary {
+	return s.rebuilds
+}
@@ -0,0 +1,33 @@
+package linux
+
+import "testing"
+
+func TestParseRebuildOutput(t *testing.T) {
+	output := `Updating certificates in /etc/ssl/certs...
+rehash: warning: skipping ca-certificates.crt,it does not contain exactly one certificate or CRL
+rehash: warning: skipping duplicate certificate in Example_Root.pem
+2 added, 1 removed; done.
+Running hooks in /etc/ca-certificates/update.d...
+done.
+`
+	parsed := parseRebuildOutput(output)
+	if parsed.added != 2 || parsed.removed != 1 {
+		t.Errorf("counts = %d added, %d removed", parsed.added, parsed.removed)
+	}
+	if len(parsed.warnings) != 1 || len(parsed.problems) != 0 {
+		t.Errorf("warnings = %q, problems = %q", parsed.warnings, parsed.problems)
+	}
+
+	parsed = parseRebuildOutput(`Updating certificates in /etc/ssl/certs...
+ln: failed to create symbolic link '/etc/ssl/certs/Example_Root.pem': Permission denied
+0 added, 0 removed; done.
+`)
+	if len(parsed.problems) != 1 {
+		t.Errorf("expected the failed link to be a problem, got %q", parsed.problems)
+	}
+
+	parsed = parseRebuildOutput("p11-kit: couldn't create file: /etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem: Read-only file system\n")
+	if len(parsed.problems) != 1 {
+		t.Errorf("expected the update-ca-trust failure to be a problem, got %q", parsed.problems)
+	}
+}
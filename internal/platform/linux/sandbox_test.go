@@ -0,0 +1,69 @@
+package linux
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestParseSnapStoreCerts(t *testing.T) {
+	root := certstoretest.NewCertificate(t, "Example Root")
+	pemData := string(certstore.EncodePEMBundle([]*x509.Certificate{root}))
+	output, err := json.Marshal(map[string]map[string]string{"store-certs": {snapCertName(root): pemData}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := parseSnapStoreCerts(output)
+	if err != nil {
+		t.Fatalf("parseSnapStoreCerts: %v", err)
+	}
+	if len(entries) != 1 || entries[snapCertName(root)] != pemData {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if entries, err := parseSnapStoreCerts([]byte(`{}`)); err != nil || len(entries) != 0 {
+		t.Fatalf("expected no entries, got %v, %v", entries, err)
+	}
+}
+
+func TestWriteFlatpakBundle(t *testing.T) {
+	dir := t.TempDir()
+	public := certstoretest.NewCertificate(t, "Public Root")
+	base := filepath.Join(dir, "host.crt")
+	if err := os.WriteFile(base, bytes.TrimSuffix(certstore.EncodePEMBundle([]*x509.Certificate{public}), []byte("\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := certstoretest.NewCertificate(t, "Example Root")
+	shared := filepath.Join(dir, "flatpak")
+	if err := writeFlatpakBundle(shared, base, []*x509.Certificate{root}, certstore.FilePolicy{Mode: certstore.DefaultFileMode, UID: -1, GID: -1}); err != nil {
+		t.Fatalf("writeFlatpakBundle: %v", err)
+	}
+
+	store := &ApplicationStore{target: "flatpak", options: map[string]string{"directory": shared}}
+	managed, err := store.listFlatpakCertificates()
+	if err != nil {
+		t.Fatalf("listFlatpakCertificates: %v", err)
+	}
+	if len(managed) != 1 || !managed[0].Equal(root) {
+		t.Fatalf("expected only the managed root to be listed, got %d", len(managed))
+	}
+
+	data, err := os.ReadFile(filepath.Join(shared, flatpakBundleFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle) != 2 || !bundle[0].Equal(public) || !bundle[1].Equal(root) {
+		t.Fatalf("expected the host bundle followed by the managed root, got %d certificates", len(bundle))
+	}
+}
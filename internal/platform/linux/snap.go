@@ -0,0 +1,170 @@
+package linux
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// snapCertPrefix names the store-certs entries this tool manages
+const snapCertPrefix = "tsu-"
+
+// snapBackupFile holds the store-certs configuration in a backup directory
+const snapBackupFile = "store-certs.json"
+
+// Snap operations. snapd keeps its own trust for connections to the snap
+// store and store proxies, so certificates are added as
+// `snap set system store-certs.<name>`, which snapd writes under
+// /var/lib/snapd and trusts alongside the host bundle.
+
+func (a *ApplicationStore) hasSnap() bool {
+	_, err := exec.LookPath("snap")
+	return err == nil
+}
+
+// snapStoreCerts returns the configured store-certs by name
+func (a *ApplicationStore) snapStoreCerts() (map[string]string, error) {
+	output, err := a.runner.Run("snap", "get", "-d", "system", "store-certs")
+	if err != nil {
+		var cmdErr *certstore.CommandError
+		// snap get fails rather than printing {} when nothing is set
+		if errors.As(err, &cmdErr) && strings.Contains(cmdErr.Stderr, `has no "store-certs"`) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read snap store-certs: %w", err)
+	}
+	return parseSnapStoreCerts(output)
+}
+
+// parseSnapStoreCerts decodes `snap get -d system store-certs` output
+func parseSnapStoreCerts(output []byte) (map[string]string, error) {
+	var doc struct {
+		StoreCerts map[string]string `json:"store-certs"`
+	}
+	if err := json.Unmarshal(output, &doc); err != nil {
+		return nil, fmt.Errorf("invalid snap store-certs: %w", err)
+	}
+	if doc.StoreCerts == nil {
+		doc.StoreCerts = map[string]string{}
+	}
+	return doc.StoreCerts, nil
+}
+
+// snapCertName is the store-certs name for a certificate: lowercase letters,
+// digits and dashes, as snapd requires
+func snapCertName(c *x509.Certificate) string {
+	return snapCertPrefix + cert.GetCertificateFingerprint(c)[:16]
+}
+
+func (a *ApplicationStore) listSnapCertificates() ([]*x509.Certificate, error) {
+	entries, err := a.snapStoreCerts()
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, name := range sortedKeys(entries) {
+		parsed, err := certstore.ParsePEMBundle([]byte(entries[name]))
+		if err != nil {
+			return nil, fmt.Errorf("snap store-certs.%s: %w", name, err)
+		}
+		certs = append(certs, parsed...)
+	}
+	return certs, nil
+}
+
+func (a *ApplicationStore) addSnapCertificate(c *x509.Certificate) error {
+	return a.setSnapCert(snapCertName(c), string(certstore.EncodePEMBundle([]*x509.Certificate{c})))
+}
+
+func (a *ApplicationStore) setSnapCert(name, pemData string) error {
+	if a.verbose {
+		fmt.Printf("Setting snap store-certs.%s\n", name)
+	}
+	_, err := a.runner.Run("snap", "set", "system", "store-certs."+name+"="+pemData)
+	return err
+}
+
+// removeSnapCertificate unsets every entry holding the certificate, whatever
+// it was named
+func (a *ApplicationStore) removeSnapCertificate(c *x509.Certificate) error {
+	entries, err := a.snapStoreCerts()
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(entries) {
+		parsed, err := certstore.ParsePEMBundle([]byte(entries[name]))
+		if err != nil || !certstore.ContainsCertificate(parsed, c) {
+			continue
+		}
+		if _, err := a.runner.Run("snap", "unset", "system", "store-certs."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *ApplicationStore) backupSnap(backupPath string) error {
+	entries, err := a.snapStoreCerts()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return atomicfile.WriteFile(filepath.Join(backupPath, snapBackupFile), data, 0600)
+}
+
+// restoreSnap puts back the backed up entries and unsets any added since
+func (a *ApplicationStore) restoreSnap(backupPath string) error {
+	data, err := os.ReadFile(filepath.Join(backupPath, snapBackupFile))
+	if err != nil {
+		return fmt.Errorf("no snap store-certs backup: %w", err)
+	}
+	var saved map[string]string
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid snap store-certs backup: %w", err)
+	}
+
+	current, err := a.snapStoreCerts()
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(current) {
+		if _, ok := saved[name]; !ok {
+			if _, err := a.runner.Run("snap", "unset", "system", "store-certs."+name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range sortedKeys(saved) {
+		if current[name] != saved[name] {
+			if err := a.setSnapCert(name, saved[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
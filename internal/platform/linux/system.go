@@ -2,22 +2,28 @@ package linux
 
 import (
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/webprofusion/trust-store-updater/internal/certstore"
 )
 
 // SystemStore implements certificate store operations for Linux system stores
 type SystemStore struct {
-	target  string
-	options map[string]string
-	verbose bool
+	target    string
+	options   map[string]string
+	verbose   bool
+	runner    certstore.Runner
+	scanCache *certstore.ScanCache
+	rebuilds  *certstore.RebuildSummary
+	mac       macStatus
+	files     certstore.FilePolicy
+	changed   bool // the bundle was rebuilt after a change
 }
 
 // NewSystemStore creates a new Linux system certificate store
@@ -26,6 +32,8 @@ func NewSystemStore(target string, options map[string]string, verbose bool) (cer
 		target:  target,
 		options: options,
 		verbose: verbose,
+		runner:  &certstore.CommandRunner{Verbose: verbose},
+		mac:     detectMAC("/"),
 	}
 
 	// Validate target
@@ -33,6 +41,12 @@ func NewSystemStore(target string, options map[string]string, verbose bool) (cer
 		return nil, fmt.Errorf("unsupported system store target: %s", target)
 	}
 
+	files, err := certstore.ParseFilePolicy(options)
+	if err != nil {
+		return nil, err
+	}
+	store.files = files
+
 	return store, nil
 }
 
@@ -48,6 +62,8 @@ func (s *SystemStore) IsSupported() bool {
 		return s.hasCaCertificates()
 	case "update-ca-trust":
 		return s.hasUpdateCaTrust()
+	case ostreeTarget:
+		return s.hasUpdateCaTrust() && ostreeBooted()
 	default:
 		return false
 	}
@@ -58,6 +74,16 @@ func (s *SystemStore) RequiresRoot() bool {
 	return true
 }
 
+// SetCommandTimeout bounds update-ca-certificates, update-ca-trust and copy commands
+func (s *SystemStore) SetCommandTimeout(timeout time.Duration) {
+	certstore.SetRunnerTimeout(s.runner, timeout)
+}
+
+// SetScanCache lets repeat listings skip certificate files that haven't changed
+func (s *SystemStore) SetScanCache(cache *certstore.ScanCache) {
+	s.scanCache = cache
+}
+
 // ListCertificates returns all certificates currently in the store
 func (s *SystemStore) ListCertificates() ([]*x509.Certificate, error) {
 	var certs []*x509.Certificate
@@ -65,7 +91,7 @@ func (s *SystemStore) ListCertificates() ([]*x509.Certificate, error) {
 	switch s.target {
 	case "ca-certificates":
 		return s.listCaCertificates()
-	case "update-ca-trust":
+	case "update-ca-trust", ostreeTarget:
 		return s.listUpdateCaTrustCertificates()
 	default:
 		return certs, fmt.Errorf("unsupported target: %s", s.target)
@@ -77,7 +103,7 @@ func (s *SystemStore) AddCertificate(cert *x509.Certificate) error {
 	switch s.target {
 	case "ca-certificates":
 		return s.addCaCertificate(cert)
-	case "update-ca-trust":
+	case "update-ca-trust", ostreeTarget:
 		return s.addUpdateCaTrustCertificate(cert)
 	default:
 		return fmt.Errorf("unsupported target: %s", s.target)
@@ -89,7 +115,7 @@ func (s *SystemStore) RemoveCertificate(cert *x509.Certificate) error {
 	switch s.target {
 	case "ca-certificates":
 		return s.removeCaCertificate(cert)
-	case "update-ca-trust":
+	case "update-ca-trust", ostreeTarget:
 		return s.removeUpdateCaTrustCertificate(cert)
 	default:
 		return fmt.Errorf("unsupported target: %s", s.target)
@@ -101,7 +127,7 @@ func (s *SystemStore) Backup(backupPath string) error {
 	switch s.target {
 	case "ca-certificates":
 		return s.backupCaCertificates(backupPath)
-	case "update-ca-trust":
+	case "update-ca-trust", ostreeTarget:
 		return s.backupUpdateCaTrust(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", s.target)
@@ -113,7 +139,7 @@ func (s *SystemStore) Restore(backupPath string) error {
 	switch s.target {
 	case "ca-certificates":
 		return s.restoreCaCertificates(backupPath)
-	case "update-ca-trust":
+	case "update-ca-trust", ostreeTarget:
 		return s.restoreUpdateCaTrust(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", s.target)
@@ -134,11 +160,129 @@ func (s *SystemStore) Validate() error {
 	return nil
 }
 
+// CheckHealth looks for broken symlinks in the hashed certificate directory
+// and, under SELinux, anchor files with the wrong context
+func (s *SystemStore) CheckHealth() []certstore.HealthIssue {
+	issues := s.checkLabels()
+
+	links, err := findBrokenSymlinks(hashedCertDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			issues = append(issues, certstore.HealthIssue{
+				Check:   "broken-symlink",
+				Message: fmt.Sprintf("failed to scan %s: %v", hashedCertDir, err),
+				Path:    hashedCertDir,
+			})
+		}
+		return issues
+	}
+
+	for _, link := range links {
+		link := link
+		issues = append(issues, certstore.HealthIssue{
+			Check:   "broken-symlink",
+			Message: fmt.Sprintf("symlink %s points to a missing file", link),
+			Path:    link,
+			Fix: func() error {
+				return os.Remove(link)
+			},
+		})
+	}
+
+	return issues
+}
+
+// ManagedFiles returns the certificates written by this tool into the store's anchor directory
+func (s *SystemStore) ManagedFiles() (map[string]*x509.Certificate, error) {
+	return listManagedFiles(s.anchorDir())
+}
+
 // Helper methods
 
+// hashedCertDir is the OpenSSL hashed directory rebuilt by the update tooling
+const hashedCertDir = "/etc/ssl/certs/"
+
+// managedMarker is written at the top of every certificate file created by this tool
+const managedMarker = "# Managed by trust-store-updater"
+
+// WritePaths returns the anchor directory certificates are written to
+func (s *SystemStore) WritePaths() []string {
+	return []string{s.anchorDir()}
+}
+
+func (s *SystemStore) anchorDir() string {
+	if s.target == "update-ca-trust" || s.target == ostreeTarget {
+		return "/etc/pki/ca-trust/source/anchors/"
+	}
+	return "/usr/local/share/ca-certificates/"
+}
+
+// findBrokenSymlinks returns symlinks in dir whose targets do not exist
+func findBrokenSymlinks(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var broken []string
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			broken = append(broken, path)
+		}
+	}
+	return broken, nil
+}
+
+// listManagedFiles parses the certificate files in dir that carry the managed marker
+func listManagedFiles(dir string) (map[string]*x509.Certificate, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string]*x509.Certificate{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	managed := make(map[string]*x509.Certificate)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			certstore.LogWarnf("Skipping unreadable file: %s (%v)", path, err)
+			continue
+		}
+		if !strings.HasPrefix(string(data), managedMarker) {
+			continue
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			certstore.LogWarnf("Failed to parse certificate in %s: %v", path, err)
+			continue
+		}
+		managed[path] = cert
+	}
+	return managed, nil
+}
+
+// SystemTargets returns every system store target known on this platform,
+// whether or not it is available on this machine
+func SystemTargets() []string {
+	return []string{"ca-certificates", "update-ca-trust", ostreeTarget}
+}
+
 func isValidSystemTarget(target string) bool {
-	validTargets := []string{"ca-certificates", "update-ca-trust"}
-	for _, valid := range validTargets {
+	for _, valid := range SystemTargets() {
 		if target == valid {
 			return true
 		}
@@ -156,46 +300,13 @@ func (s *SystemStore) hasUpdateCaTrust() bool {
 	return err == nil
 }
 
-// listCaCertificatesFromDir lists all certificates from the specified directory (for testability)
-func listCaCertificatesFromDir(certDir string) ([]*x509.Certificate, error) {
-	files, err := os.ReadDir(certDir)
+// listCaCertificatesFromDir lists all certificates from the specified directory (for testability).
+// cache may be nil.
+func listCaCertificatesFromDir(certDir string, cache *certstore.ScanCache) ([]*x509.Certificate, error) {
+	certs, err := cache.ScanDir(certDir, isCertificateFilename)
 	if err != nil {
 		certstore.LogErrorf("Failed to read cert dir: %v", err)
-		return nil, fmt.Errorf("failed to read cert dir: %w", err)
-	}
-
-	var certs []*x509.Certificate
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		name := file.Name()
-		if !(strings.HasSuffix(name, ".crt") || strings.HasSuffix(name, ".pem")) {
-			continue
-		}
-		path := filepath.Join(certDir, name)
-		data, err := os.ReadFile(path)
-		if err != nil {
-			certstore.LogWarnf("Skipping unreadable file: %s (%v)", path, err)
-			continue // skip unreadable files
-		}
-		// Parse all PEM blocks in the file
-		rest := data
-		for {
-			var block *pem.Block
-			block, rest = pem.Decode(rest)
-			if block == nil {
-				break
-			}
-			if block.Type == "CERTIFICATE" {
-				cert, err := x509.ParseCertificate(block.Bytes)
-				if err == nil {
-					certs = append(certs, cert)
-				} else {
-					certstore.LogWarnf("Failed to parse certificate in %s: %v", path, err)
-				}
-			}
-		}
+		return nil, err
 	}
 	certstore.LogInfof("Found %d certificates in %s", len(certs), certDir)
 	if len(certs) == 0 {
@@ -204,83 +315,39 @@ func listCaCertificatesFromDir(certDir string) ([]*x509.Certificate, error) {
 	return certs, nil
 }
 
+func isCertificateFilename(name string) bool {
+	return strings.HasSuffix(name, ".crt") || strings.HasSuffix(name, ".pem")
+}
+
 func (s *SystemStore) listCaCertificates() ([]*x509.Certificate, error) {
-	return listCaCertificatesFromDir("/etc/ssl/certs/")
+	return listCaCertificatesFromDir("/etc/ssl/certs/", s.scanCache)
 }
 
 func (s *SystemStore) listUpdateCaTrustCertificates() ([]*x509.Certificate, error) {
 	// List all .pem/.crt files in /etc/pki/ca-trust/source/anchors/
-	certDir := "/etc/pki/ca-trust/source/anchors/"
-	files, err := os.ReadDir(certDir)
-	if err != nil {
-		certstore.LogErrorf("Failed to read anchors dir: %v", err)
-		return nil, fmt.Errorf("failed to read anchors dir: %w", err)
-	}
-
-	var certs []*x509.Certificate
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		name := file.Name()
-		if !(strings.HasSuffix(name, ".crt") || strings.HasSuffix(name, ".pem")) {
-			continue
-		}
-		path := filepath.Join(certDir, name)
-		data, err := os.ReadFile(path)
-		if err != nil {
-			certstore.LogWarnf("Skipping unreadable file: %s (%v)", path, err)
-			continue // skip unreadable files
-		}
-		// Parse all PEM blocks in the file
-		rest := data
-		for {
-			var block *pem.Block
-			block, rest = pem.Decode(rest)
-			if block == nil {
-				break
-			}
-			if block.Type == "CERTIFICATE" {
-				cert, err := x509.ParseCertificate(block.Bytes)
-				if err == nil {
-					certs = append(certs, cert)
-				} else {
-					certstore.LogWarnf("Failed to parse certificate in %s: %v", path, err)
-				}
-			}
-		}
-	}
-	certstore.LogInfof("Found %d certificates in %s", len(certs), certDir)
-	if len(certs) == 0 {
-		return nil, fmt.Errorf("no certificates found in %s", certDir)
-	}
-	return certs, nil
+	return listCaCertificatesFromDir("/etc/pki/ca-trust/source/anchors/", s.scanCache)
 }
 
 func (s *SystemStore) addCaCertificate(cert *x509.Certificate) error {
 	// Add certificate to /usr/local/share/ca-certificates/
 	certDir := "/usr/local/share/ca-certificates/"
 	if err := os.MkdirAll(certDir, 0755); err != nil {
-		return fmt.Errorf("failed to create certificate directory: %w", err)
+		return fmt.Errorf("failed to create certificate directory: %w", s.mac.explain("creating", certDir, err))
 	}
 
 	// Generate a filename based on certificate subject
-	filename := generateCertFilename(cert) + ".crt"
-	certPath := filepath.Join(certDir, filename)
+	certPath := filepath.Join(certDir, CertificateFilename(cert))
 
 	// Write certificate to file
-	if err := writeCertificateToFile(cert, certPath); err != nil {
-		return fmt.Errorf("failed to write certificate: %w", err)
+	if err := writeCertificateToFile(cert, certPath, s.files); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", s.mac.explain("writing", certPath, err))
 	}
-
-	// Update ca-certificates
-	cmd := exec.Command("update-ca-certificates")
-	if s.verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	if err := s.relabel(false, certPath); err != nil {
+		return err
 	}
 
-	if err := cmd.Run(); err != nil {
+	// Update ca-certificates
+	if err := s.rebuild(); err != nil {
 		return fmt.Errorf("failed to update ca-certificates: %w", err)
 	}
 
@@ -291,26 +358,22 @@ func (s *SystemStore) addUpdateCaTrustCertificate(cert *x509.Certificate) error
 	// Add certificate to /etc/pki/ca-trust/source/anchors/
 	certDir := "/etc/pki/ca-trust/source/anchors/"
 	if err := os.MkdirAll(certDir, 0755); err != nil {
-		return fmt.Errorf("failed to create certificate directory: %w", err)
+		return fmt.Errorf("failed to create certificate directory: %w", s.mac.explain("creating", certDir, err))
 	}
 
 	// Generate a filename based on certificate subject
-	filename := generateCertFilename(cert) + ".crt"
-	certPath := filepath.Join(certDir, filename)
+	certPath := filepath.Join(certDir, CertificateFilename(cert))
 
 	// Write certificate to file
-	if err := writeCertificateToFile(cert, certPath); err != nil {
-		return fmt.Errorf("failed to write certificate: %w", err)
+	if err := writeCertificateToFile(cert, certPath, s.files); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", s.mac.explain("writing", certPath, err))
 	}
-
-	// Update ca-trust
-	cmd := exec.Command("update-ca-trust", "extract")
-	if s.verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	if err := s.relabel(false, certPath); err != nil {
+		return err
 	}
 
-	if err := cmd.Run(); err != nil {
+	// Update ca-trust
+	if err := s.rebuild(); err != nil {
 		return fmt.Errorf("failed to update ca-trust: %w", err)
 	}
 
@@ -319,76 +382,64 @@ func (s *SystemStore) addUpdateCaTrustCertificate(cert *x509.Certificate) error
 
 func (s *SystemStore) removeCaCertificate(cert *x509.Certificate) error {
 	// Remove certificate from /usr/local/share/ca-certificates/
-	filename := generateCertFilename(cert) + ".crt"
-	certPath := filepath.Join("/usr/local/share/ca-certificates/", filename)
+	certPath := filepath.Join("/usr/local/share/ca-certificates/", CertificateFilename(cert))
 
 	if err := os.Remove(certPath); err != nil {
-		return fmt.Errorf("failed to remove certificate: %w", err)
+		return fmt.Errorf("failed to remove certificate: %w", s.mac.explain("removing", certPath, err))
 	}
 
 	// Update ca-certificates
-	cmd := exec.Command("update-ca-certificates")
-	if s.verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-
-	return cmd.Run()
+	return s.rebuild()
 }
 
 func (s *SystemStore) removeUpdateCaTrustCertificate(cert *x509.Certificate) error {
 	// Remove certificate from /etc/pki/ca-trust/source/anchors/
-	filename := generateCertFilename(cert) + ".crt"
-	certPath := filepath.Join("/etc/pki/ca-trust/source/anchors/", filename)
+	certPath := filepath.Join("/etc/pki/ca-trust/source/anchors/", CertificateFilename(cert))
 
 	if err := os.Remove(certPath); err != nil {
-		return fmt.Errorf("failed to remove certificate: %w", err)
+		return fmt.Errorf("failed to remove certificate: %w", s.mac.explain("removing", certPath, err))
 	}
 
 	// Update ca-trust
-	cmd := exec.Command("update-ca-trust", "extract")
-	if s.verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-
-	return cmd.Run()
+	return s.rebuild()
 }
 
 func (s *SystemStore) backupCaCertificates(backupPath string) error {
 	// Backup /usr/local/share/ca-certificates/
-	cmd := exec.Command("cp", "-r", "/usr/local/share/ca-certificates/", backupPath)
-	return cmd.Run()
+	_, err := s.runner.Run("cp", "-r", "/usr/local/share/ca-certificates/", backupPath)
+	return err
 }
 
 func (s *SystemStore) backupUpdateCaTrust(backupPath string) error {
 	// Backup /etc/pki/ca-trust/source/anchors/
-	cmd := exec.Command("cp", "-r", "/etc/pki/ca-trust/source/anchors/", backupPath)
-	return cmd.Run()
+	_, err := s.runner.Run("cp", "-r", "/etc/pki/ca-trust/source/anchors/", backupPath)
+	return err
 }
 
 func (s *SystemStore) restoreCaCertificates(backupPath string) error {
 	// Restore /usr/local/share/ca-certificates/
-	cmd := exec.Command("cp", "-r", backupPath, "/usr/local/share/ca-certificates/")
-	if err := cmd.Run(); err != nil {
+	if _, err := s.runner.Run("cp", "-r", backupPath, "/usr/local/share/ca-certificates/"); err != nil {
+		return err
+	}
+	if err := s.relabel(true, "/usr/local/share/ca-certificates/"); err != nil {
 		return err
 	}
 
 	// Update ca-certificates
-	cmd = exec.Command("update-ca-certificates")
-	return cmd.Run()
+	return s.rebuild()
 }
 
 func (s *SystemStore) restoreUpdateCaTrust(backupPath string) error {
 	// Restore /etc/pki/ca-trust/source/anchors/
-	cmd := exec.Command("cp", "-r", backupPath, "/etc/pki/ca-trust/source/anchors/")
-	if err := cmd.Run(); err != nil {
+	if _, err := s.runner.Run("cp", "-r", backupPath, "/etc/pki/ca-trust/source/anchors/"); err != nil {
+		return err
+	}
+	if err := s.relabel(true, "/etc/pki/ca-trust/source/anchors/"); err != nil {
 		return err
 	}
 
 	// Update ca-trust
-	cmd = exec.Command("update-ca-trust", "extract")
-	return cmd.Run()
+	return s.rebuild()
 }
 
 // Utility functions
@@ -409,13 +460,22 @@ func generateCertFilename(cert *x509.Certificate) string {
 	return filename
 }
 
-func writeCertificateToFile(cert *x509.Certificate, path string) error {
-	// Convert certificate to PEM format
-	certPEM := fmt.Sprintf("-----BEGIN CERTIFICATE-----\n%s-----END CERTIFICATE-----\n",
-		base64.StdEncoding.EncodeToString(cert.Raw))
+func writeCertificateToFile(cert *x509.Certificate, path string, policy certstore.FilePolicy) error {
+	return policy.WriteFile(path, ManagedCertificatePEM(cert))
+}
 
-	// Write to file
-	return os.WriteFile(path, []byte(certPEM), 0644)
+// CertificateFilename returns the anchor file name used for a managed certificate
+func CertificateFilename(cert *x509.Certificate) string {
+	return generateCertFilename(cert) + ".crt"
+}
+
+// ManagedCertificatePEM returns the contents of a managed anchor file: the
+// managed marker followed by the PEM encoded certificate
+func ManagedCertificatePEM(cert *x509.Certificate) []byte {
+	return append([]byte(managedMarker+"\n"), pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Raw,
+	})...)
 }
 
 // SupportedStores returns the list of supported stores for Linux
@@ -430,5 +490,9 @@ func SupportedStores() []string {
 		stores = append(stores, "update-ca-trust")
 	}
 
+	if _, err := exec.LookPath("update-ca-trust"); err == nil && ostreeBooted() {
+		stores = append(stores, ostreeTarget)
+	}
+
 	return stores
 }
@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
 )
 
 func TestListCaCertificates(t *testing.T) {
@@ -44,7 +47,7 @@ EcrmzTFYeYXmchynn9NM0GbQp7s=
 
 	t.Cleanup(func() { _ = os.Remove(pemPath) })
 
-	certs, err := listCaCertificatesFromDir(tmpDir)
+	certs, err := listCaCertificatesFromDir(tmpDir, nil)
 
 	if err != nil {
 		t.Fatalf("listCaCertificatesFromDir failed: %v", err)
@@ -53,3 +56,48 @@ EcrmzTFYeYXmchynn9NM0GbQp7s=
 		t.Fatalf("expected at least 1 certificate, got 0")
 	}
 }
+
+func TestFindBrokenSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "real.pem")
+	if err := os.WriteFile(target, []byte("x"), 0644); err != nil {
+		t.Fatalf("failed to write target: %v", err)
+	}
+	if err := os.Symlink(target, filepath.Join(tmpDir, "good.0")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(tmpDir, "missing.pem"), filepath.Join(tmpDir, "bad.0")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	broken, err := findBrokenSymlinks(tmpDir)
+	if err != nil {
+		t.Fatalf("findBrokenSymlinks failed: %v", err)
+	}
+	if len(broken) != 1 || filepath.Base(broken[0]) != "bad.0" {
+		t.Fatalf("expected only bad.0 to be reported, got %v", broken)
+	}
+}
+
+func TestListManagedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	cert := certstoretest.NewCertificate(t, "Managed Root")
+
+	if err := writeCertificateToFile(cert, filepath.Join(tmpDir, "managed.crt"), certstore.FilePolicy{Mode: certstore.DefaultFileMode, UID: -1, GID: -1}); err != nil {
+		t.Fatalf("writeCertificateToFile failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "other.crt"), []byte("not managed"), 0644); err != nil {
+		t.Fatalf("failed to write unmanaged file: %v", err)
+	}
+
+	managed, err := listManagedFiles(tmpDir)
+	if err != nil {
+		t.Fatalf("listManagedFiles failed: %v", err)
+	}
+	if len(managed) != 1 {
+		t.Fatalf("expected 1 managed file, got %d", len(managed))
+	}
+	if got := managed[filepath.Join(tmpDir, "managed.crt")]; got == nil || !got.Equal(cert) {
+		t.Fatalf("managed file did not round-trip the certificate")
+	}
+}
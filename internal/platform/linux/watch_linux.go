@@ -0,0 +1,132 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"golang.org/x/sys/unix"
+)
+
+// watchedDirs hold the system trust anchors: the local certificates of the
+// Debian and Red Hat families and the directory OpenSSL reads
+var watchedDirs = []string{
+	"/usr/local/share/ca-certificates",
+	"/etc/pki/ca-trust/source/anchors",
+	"/etc/ssl/certs",
+}
+
+const watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM |
+	unix.IN_MOVED_TO | unix.IN_ATTRIB | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+
+// WatchSystemStores signals on the returned channel whenever a file in the
+// system trust directories changes, until ctx is done. Bursts of changes may
+// be signalled once.
+func WatchSystemStores(ctx context.Context) (<-chan struct{}, error) {
+	return watchDirs(ctx, watchedDirs)
+}
+
+// watchDirs watches dirs and the directories below them with inotify.
+// Missing directories are skipped.
+func watchDirs(ctx context.Context, dirs []string) (<-chan struct{}, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+	// A non-blocking descriptor goes through the runtime poller, so closing
+	// the file interrupts a pending read
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	w := &dirWatcher{fd: fd, paths: make(map[int]string)}
+	for _, dir := range dirs {
+		if err := w.addTree(dir); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if len(w.paths) == 0 {
+		file.Close()
+		return nil, fmt.Errorf("none of the system trust directories exist")
+	}
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		file.Close()
+	}()
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				if !errors.Is(err, os.ErrClosed) {
+					certstore.LogWarnf("Stopped watching the system trust directories: %v", err)
+				}
+				return
+			}
+			w.handle(buf[:n])
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changed, nil
+}
+
+// dirWatcher tracks the directories an inotify descriptor watches
+type dirWatcher struct {
+	fd    int
+	paths map[int]string // by watch descriptor
+}
+
+// addTree watches dir and the directories below it
+func (w *dirWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		wd, err := unix.InotifyAddWatch(w.fd, path, watchMask)
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		w.paths[wd] = path
+		return nil
+	})
+}
+
+// handle reads a batch of events, watching directories created in watched
+// ones and forgetting watches the kernel removed
+func (w *dirWatcher) handle(buf []byte) {
+	for len(buf) >= unix.SizeofInotifyEvent {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := unix.SizeofInotifyEvent + int(event.Len)
+		if end > len(buf) {
+			return
+		}
+		name := string(bytes.TrimRight(buf[unix.SizeofInotifyEvent:end], "\x00"))
+		buf = buf[end:]
+
+		dir, ok := w.paths[int(event.Wd)]
+		switch {
+		case event.Mask&unix.IN_IGNORED != 0:
+			delete(w.paths, int(event.Wd))
+		case ok && event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+			if err := w.addTree(filepath.Join(dir, name)); err != nil {
+				certstore.LogWarnf("%v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package linux
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitChange reports whether changed signals within a second
+func waitChange(changed <-chan struct{}) bool {
+	select {
+	case <-changed:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestWatchDirs(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed, err := watchDirs(ctx, []string{dir, filepath.Join(dir, "missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "rogue.crt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !waitChange(changed) {
+		t.Fatal("no change signalled for a new certificate")
+	}
+
+	// Directories created later are watched too
+	sub := filepath.Join(dir, "vendor")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitChange(changed)
+	if err := os.WriteFile(filepath.Join(sub, "vendor.crt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !waitChange(changed) {
+		t.Fatal("no change signalled in a new directory")
+	}
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	os.Remove(filepath.Join(dir, "rogue.crt"))
+	select {
+	case <-changed:
+		t.Error("change signalled after the watch stopped")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := watchDirs(context.Background(), []string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("watching only missing directories succeeded")
+	}
+}
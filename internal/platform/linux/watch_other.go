@@ -0,0 +1,12 @@
+//go:build !linux
+
+package linux
+
+import (
+	"context"
+	"errors"
+)
+
+func WatchSystemStores(ctx context.Context) (<-chan struct{}, error) {
+	return nil, errors.New("inotify is only available on Linux")
+}
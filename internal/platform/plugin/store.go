@@ -0,0 +1,217 @@
+package plugin
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// ProtocolVersion is sent with every request so plugins can reject versions they don't understand
+const ProtocolVersion = 1
+
+// Operations understood by plugins
+const (
+	OpDescribe = "describe"
+	OpList     = "list"
+	OpAdd      = "add"
+	OpRemove   = "remove"
+	OpBackup   = "backup"
+	OpRestore  = "restore"
+	OpValidate = "validate"
+)
+
+// Request is written as JSON to the plugin's standard input. The plugin is run
+// once per request.
+type Request struct {
+	Version     int               `json:"version"`
+	Operation   string            `json:"operation"`
+	Options     map[string]string `json:"options,omitempty"`
+	Certificate string            `json:"certificate,omitempty"` // PEM, for add and remove
+	Label       string            `json:"label,omitempty"`       // configured alias, for add
+	Path        string            `json:"path,omitempty"`        // backup and restore location
+}
+
+// Response is read as JSON from the plugin's standard output. A non-empty
+// Error or a non-zero exit status fails the operation.
+type Response struct {
+	Error        string   `json:"error,omitempty"`
+	Supported    *bool    `json:"supported,omitempty"`     // describe
+	RequiresRoot bool     `json:"requires_root,omitempty"` // describe
+	Certificates []string `json:"certificates,omitempty"`  // list, PEM encoded
+}
+
+// Store delegates certificate store operations to an external executable
+type Store struct {
+	executable string
+	args       []string
+	options    map[string]string
+	verbose    bool
+	runner     certstore.CommandRunner
+	describe   *Response
+}
+
+// NewStore creates a store backed by the plugin executable named by target.
+// options["args"] holds extra space separated arguments for the executable;
+// all options are passed to the plugin with each request.
+func NewStore(target string, options map[string]string, verbose bool) (certstore.CertificateStore, error) {
+	if target == "" {
+		return nil, fmt.Errorf("plugin store requires the plugin executable as target")
+	}
+
+	executable, err := exec.LookPath(target)
+	if err != nil {
+		return nil, fmt.Errorf("plugin executable not found: %w", err)
+	}
+
+	return NewCommandStore(executable, strings.Fields(options["args"]), options, verbose), nil
+}
+
+// NewCommandStore creates a store that runs executable with args for each
+// request, for built-in stores implemented as plugins
+func NewCommandStore(executable string, args []string, options map[string]string, verbose bool) *Store {
+	return &Store{
+		executable: executable,
+		args:       args,
+		options:    options,
+		verbose:    verbose,
+	}
+}
+
+// Name returns the name of the certificate store
+func (p *Store) Name() string {
+	return fmt.Sprintf("plugin-%s", p.executable)
+}
+
+// IsSupported asks the plugin whether it can operate on this host. Plugins
+// that don't answer describe are assumed to be supported.
+func (p *Store) IsSupported() bool {
+	resp, err := p.describeOnce()
+	if err != nil {
+		if p.verbose {
+			fmt.Printf("Plugin %s describe failed: %v\n", p.executable, err)
+		}
+		return false
+	}
+	return resp.Supported == nil || *resp.Supported
+}
+
+// RequiresRoot reports what the plugin declared in its describe response
+func (p *Store) RequiresRoot() bool {
+	resp, err := p.describeOnce()
+	return err == nil && resp.RequiresRoot
+}
+
+// SetCommandTimeout bounds each plugin invocation
+func (p *Store) SetCommandTimeout(timeout time.Duration) {
+	p.runner.Timeout = timeout
+}
+
+// ListCertificates returns all certificates currently in the store
+func (p *Store) ListCertificates() ([]*x509.Certificate, error) {
+	resp, err := p.call(Request{Operation: OpList})
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for i, encoded := range resp.Certificates {
+		block, _ := pem.Decode([]byte(encoded))
+		if block == nil {
+			return nil, fmt.Errorf("plugin returned invalid PEM for certificate %d", i)
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("plugin returned unparseable certificate %d: %w", i, err)
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+// AddCertificate adds a certificate to the store
+func (p *Store) AddCertificate(cert *x509.Certificate) error {
+	_, err := p.call(Request{Operation: OpAdd, Certificate: encodePEM(cert)})
+	return err
+}
+
+// AddCertificateWithLabel adds a certificate, passing its alias to the plugin
+func (p *Store) AddCertificateWithLabel(cert *x509.Certificate, label string) error {
+	_, err := p.call(Request{Operation: OpAdd, Certificate: encodePEM(cert), Label: label})
+	return err
+}
+
+// RemoveCertificate removes a certificate from the store
+func (p *Store) RemoveCertificate(cert *x509.Certificate) error {
+	_, err := p.call(Request{Operation: OpRemove, Certificate: encodePEM(cert)})
+	return err
+}
+
+// Backup creates a backup of the current store state
+func (p *Store) Backup(backupPath string) error {
+	_, err := p.call(Request{Operation: OpBackup, Path: backupPath})
+	return err
+}
+
+// Restore restores the store from a backup
+func (p *Store) Restore(backupPath string) error {
+	_, err := p.call(Request{Operation: OpRestore, Path: backupPath})
+	return err
+}
+
+// Validate checks if the store is in a valid state
+func (p *Store) Validate() error {
+	_, err := p.call(Request{Operation: OpValidate})
+	return err
+}
+
+func (p *Store) describeOnce() (*Response, error) {
+	if p.describe != nil {
+		return p.describe, nil
+	}
+	resp, err := p.call(Request{Operation: OpDescribe})
+	if err != nil {
+		return nil, err
+	}
+	p.describe = resp
+	return resp, nil
+}
+
+// call runs the plugin for a single request and decodes its response
+func (p *Store) call(req Request) (*Response, error) {
+	req.Version = ProtocolVersion
+	req.Options = p.options
+
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plugin request: %w", err)
+	}
+
+	if p.verbose {
+		fmt.Printf("Calling plugin %s: %s\n", p.executable, req.Operation)
+	}
+
+	output, err := p.runner.RunWithInput(input, p.executable, p.args...)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s %s: %w", p.executable, req.Operation, err)
+	}
+
+	var resp Response
+	if err := json.Unmarshal(output, &resp); err != nil {
+		return nil, fmt.Errorf("plugin %s %s returned invalid response: %w", p.executable, req.Operation, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin %s %s: %s", p.executable, req.Operation, resp.Error)
+	}
+
+	return &resp, nil
+}
+
+func encodePEM(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
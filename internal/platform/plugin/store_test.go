@@ -0,0 +1,59 @@
+//go:build unix
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePlugin creates a shell plugin that answers describe and list and fails everything else
+func writePlugin(t *testing.T) string {
+	t.Helper()
+	script := `#!/bin/sh
+req=$(cat)
+case "$req" in
+  *'"operation":"describe"'*) echo '{"supported":true,"requires_root":true}' ;;
+  *'"operation":"list"'*) echo '{"certificates":[]}' ;;
+  *'"operation":"validate"'*) echo "appliance unreachable" >&2; exit 2 ;;
+  *) echo '{"error":"unsupported operation"}' ;;
+esac
+`
+	path := filepath.Join(t.TempDir(), "tsu-plugin")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPluginStore(t *testing.T) {
+	store, err := NewStore(writePlugin(t), map[string]string{"appliance": "lb01"}, false)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	if !store.IsSupported() || !store.RequiresRoot() {
+		t.Error("describe response was not honoured")
+	}
+
+	certs, err := store.ListCertificates()
+	if err != nil || len(certs) != 0 {
+		t.Errorf("ListCertificates = %d, %v; want empty list", len(certs), err)
+	}
+
+	if err := store.Backup("/tmp/backup"); err == nil || !strings.Contains(err.Error(), "unsupported operation") {
+		t.Errorf("expected plugin error to be surfaced, got %v", err)
+	}
+
+	if err := store.Validate(); err == nil || !strings.Contains(err.Error(), "appliance unreachable") {
+		t.Errorf("expected stderr in error for failed plugin, got %v", err)
+	}
+}
+
+func TestNewStoreRequiresExecutable(t *testing.T) {
+	if _, err := NewStore(filepath.Join(t.TempDir(), "missing"), nil, false); err == nil {
+		t.Error("expected error for missing plugin executable")
+	}
+}
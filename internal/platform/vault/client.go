@@ -0,0 +1,132 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds each call to the Vault API
+const requestTimeout = 30 * time.Second
+
+// errNotFound is returned for 404 responses, e.g. a KV secret that doesn't exist yet
+var errNotFound = fmt.Errorf("not found")
+
+// client is a minimal Vault HTTP API client
+type client struct {
+	address    string
+	token      string
+	namespace  string
+	httpClient *http.Client
+}
+
+// newClient builds a client from store options, falling back to the standard
+// VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables
+func newClient(options map[string]string) (*client, error) {
+	address := optionOrEnv(options, "address", "VAULT_ADDR")
+	if address == "" {
+		return nil, fmt.Errorf("vault address not configured (options.address or VAULT_ADDR)")
+	}
+
+	token := optionOrEnv(options, "token", "VAULT_TOKEN")
+	if tokenFile := options["token_file"]; tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return nil, fmt.Errorf("vault token not configured (options.token, options.token_file or VAULT_TOKEN)")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile := options["ca_cert"]; caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &client{
+		address:    strings.TrimRight(address, "/"),
+		token:      token,
+		namespace:  optionOrEnv(options, "namespace", "VAULT_NAMESPACE"),
+		httpClient: &http.Client{Timeout: requestTimeout, Transport: transport},
+	}, nil
+}
+
+// do calls the Vault API and decodes the JSON response into out (if non-nil)
+func (c *client) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.address+"/v1/"+strings.TrimLeft(path, "/"), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read vault response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && len(apiErr.Errors) > 0 {
+			return fmt.Errorf("vault %s %s: %s", method, path, strings.Join(apiErr.Errors, "; "))
+		}
+		return fmt.Errorf("vault %s %s: HTTP %d", method, path, resp.StatusCode)
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
+
+func optionOrEnv(options map[string]string, key, env string) string {
+	if value := options[key]; value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
@@ -0,0 +1,314 @@
+package vault
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// Store publishes trusted certificates into HashiCorp Vault, either as a PEM
+// bundle in a KV secret ("kv") or as issuers imported into a PKI mount ("pki")
+// so services that pull trust from Vault receive the managed set
+type Store struct {
+	target  string
+	options map[string]string
+	verbose bool
+	client  *client
+}
+
+// NewStore creates a new Vault store
+func NewStore(target string, options map[string]string, verbose bool) (certstore.CertificateStore, error) {
+	if !isValidTarget(target) {
+		return nil, fmt.Errorf("unsupported vault store target: %s", target)
+	}
+	if target == "kv" && options["path"] == "" {
+		return nil, fmt.Errorf("vault kv store requires options.path")
+	}
+
+	c, err := newClient(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		target:  target,
+		options: options,
+		verbose: verbose,
+		client:  c,
+	}, nil
+}
+
+// Name returns the name of the certificate store
+func (v *Store) Name() string {
+	return fmt.Sprintf("vault-%s-%s", v.target, v.mount())
+}
+
+// IsSupported reports whether the Vault server is reachable with the configured token
+func (v *Store) IsSupported() bool {
+	return v.Validate() == nil
+}
+
+// RequiresRoot returns false; access is governed by the Vault token
+func (v *Store) RequiresRoot() bool {
+	return false
+}
+
+// ListCertificates returns the certificates currently published in Vault
+func (v *Store) ListCertificates() ([]*x509.Certificate, error) {
+	switch v.target {
+	case "kv":
+		certs, _, _, err := v.readBundle()
+		return certs, err
+	case "pki":
+		issuers, err := v.listIssuers()
+		if err != nil {
+			return nil, err
+		}
+		certs := make([]*x509.Certificate, 0, len(issuers))
+		for _, c := range issuers {
+			certs = append(certs, c)
+		}
+		return certs, nil
+	default:
+		return nil, fmt.Errorf("unsupported target: %s", v.target)
+	}
+}
+
+// AddCertificate publishes a certificate
+func (v *Store) AddCertificate(cert *x509.Certificate) error {
+	switch v.target {
+	case "kv":
+		certs, fields, version, err := v.readBundle()
+		if err != nil {
+			return err
+		}
+		if certstore.ContainsCertificate(certs, cert) {
+			return nil
+		}
+		return v.writeBundle(append(certs, cert), fields, version)
+	case "pki":
+		body := map[string]string{"pem_bundle": string(certstore.EncodePEMBundle([]*x509.Certificate{cert}))}
+		return v.client.do("POST", v.mount()+"/issuers/import/cert", body, nil)
+	default:
+		return fmt.Errorf("unsupported target: %s", v.target)
+	}
+}
+
+// RemoveCertificate withdraws a certificate
+func (v *Store) RemoveCertificate(cert *x509.Certificate) error {
+	switch v.target {
+	case "kv":
+		certs, fields, version, err := v.readBundle()
+		if err != nil {
+			return err
+		}
+		kept := certs[:0]
+		for _, c := range certs {
+			if !c.Equal(cert) {
+				kept = append(kept, c)
+			}
+		}
+		return v.writeBundle(kept, fields, version)
+	case "pki":
+		issuers, err := v.listIssuers()
+		if err != nil {
+			return err
+		}
+		for id, c := range issuers {
+			if c.Equal(cert) {
+				return v.client.do("DELETE", v.mount()+"/issuer/"+id, nil, nil)
+			}
+		}
+		return fmt.Errorf("certificate not found in vault pki mount %s", v.mount())
+	default:
+		return fmt.Errorf("unsupported target: %s", v.target)
+	}
+}
+
+// Backup saves the published certificates as a PEM bundle at backupPath
+func (v *Store) Backup(backupPath string) error {
+	certs, err := v.ListCertificates()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return atomicfile.WriteFile(backupPath, certstore.EncodePEMBundle(certs), 0600)
+}
+
+// Restore republishes a backup. For KV the bundle is replaced; for PKI missing
+// issuers are re-imported but issuers added since the backup are kept.
+func (v *Store) Restore(backupPath string) error {
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	certs, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		return err
+	}
+
+	switch v.target {
+	case "kv":
+		fields, version, err := v.readSecret()
+		if err != nil {
+			return err
+		}
+		return v.writeBundle(certs, fields, version)
+	case "pki":
+		for _, c := range certs {
+			if err := v.AddCertificate(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported target: %s", v.target)
+	}
+}
+
+// Validate checks the server is reachable and the token is valid
+func (v *Store) Validate() error {
+	if err := v.client.do("GET", "auth/token/lookup-self", nil, nil); err != nil {
+		return fmt.Errorf("vault token check failed: %w", err)
+	}
+	return nil
+}
+
+func (v *Store) mount() string {
+	if mount := v.options["mount"]; mount != "" {
+		return strings.Trim(mount, "/")
+	}
+	if v.target == "pki" {
+		return "pki"
+	}
+	return "secret"
+}
+
+func (v *Store) field() string {
+	if field := v.options["field"]; field != "" {
+		return field
+	}
+	return "ca_bundle"
+}
+
+func (v *Store) kvV1() bool {
+	return v.options["kv_version"] == "1"
+}
+
+func (v *Store) kvPath() string {
+	path := strings.Trim(v.options["path"], "/")
+	if v.kvV1() {
+		return v.mount() + "/" + path
+	}
+	return v.mount() + "/data/" + path
+}
+
+// readSecret returns the fields of the KV secret and, for KV v2, the secret
+// version used for check-and-set on write (0 if it doesn't exist yet)
+func (v *Store) readSecret() (map[string]interface{}, int, error) {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err := v.client.do("GET", v.kvPath(), nil, &resp)
+	if err == errNotFound {
+		return map[string]interface{}{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fields := resp.Data
+	if !v.kvV1() {
+		fields, _ = resp.Data["data"].(map[string]interface{})
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	version := 0
+	if metadata, ok := resp.Data["metadata"].(map[string]interface{}); ok && !v.kvV1() {
+		if n, ok := metadata["version"].(float64); ok {
+			version = int(n)
+		}
+	}
+	return fields, version, nil
+}
+
+// readBundle returns the certificates in the bundle field along with the secret for writing back
+func (v *Store) readBundle() ([]*x509.Certificate, map[string]interface{}, int, error) {
+	fields, version, err := v.readSecret()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	bundle, _ := fields[v.field()].(string)
+	certs, err := certstore.ParsePEMBundle([]byte(bundle))
+	return certs, fields, version, err
+}
+
+// writeBundle replaces the bundle field, preserving the other fields of the secret
+func (v *Store) writeBundle(certs []*x509.Certificate, fields map[string]interface{}, version int) error {
+	fields[v.field()] = string(certstore.EncodeManagedBundle(certs))
+
+	if v.verbose {
+		fmt.Printf("Publishing %d certificates to vault %s\n", len(certs), v.kvPath())
+	}
+
+	if v.kvV1() {
+		return v.client.do("PUT", v.kvPath(), fields, nil)
+	}
+	// Check-and-set guards against overwriting a concurrent update
+	body := map[string]interface{}{
+		"options": map[string]int{"cas": version},
+		"data":    fields,
+	}
+	return v.client.do("POST", v.kvPath(), body, nil)
+}
+
+// listIssuers returns the certificates of the issuers in the PKI mount keyed by issuer ID
+func (v *Store) listIssuers() (map[string]*x509.Certificate, error) {
+	var list struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := v.client.do("GET", v.mount()+"/issuers?list=true", nil, &list)
+	if err == errNotFound {
+		return map[string]*x509.Certificate{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	issuers := make(map[string]*x509.Certificate)
+	for _, id := range list.Data.Keys {
+		var issuer struct {
+			Data struct {
+				Certificate string `json:"certificate"`
+			} `json:"data"`
+		}
+		if err := v.client.do("GET", v.mount()+"/issuer/"+id, nil, &issuer); err != nil {
+			return nil, err
+		}
+		certs, err := certstore.ParsePEMBundle([]byte(issuer.Data.Certificate))
+		if err != nil || len(certs) == 0 {
+			return nil, fmt.Errorf("vault issuer %s has no valid certificate", id)
+		}
+		issuers[id] = certs[0]
+	}
+	return issuers, nil
+}
+
+func isValidTarget(target string) bool {
+	return target == "kv" || target == "pki"
+}
+
+// SupportedStores returns the Vault store targets
+func SupportedStores() []string {
+	return []string{"kv", "pki"}
+}
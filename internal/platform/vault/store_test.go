@@ -0,0 +1,107 @@
+package vault
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+// fakeKV serves a single KV v2 secret, enforcing check-and-set
+type fakeKV struct {
+	mu      sync.Mutex
+	version int
+	data    map[string]interface{}
+}
+
+func (f *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "test-token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/auth/token/lookup-self":
+		_, _ = w.Write([]byte(`{"data":{}}`))
+	case r.URL.Path == "/v1/secret/data/trust/bundle" && r.Method == http.MethodGet:
+		if f.version == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": f.data, "metadata": map[string]interface{}{"version": f.version}},
+		})
+	case r.URL.Path == "/v1/secret/data/trust/bundle" && r.Method == http.MethodPost:
+		var body struct {
+			Options map[string]int         `json:"options"`
+			Data    map[string]interface{} `json:"data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Options["cas"] != f.version {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+			return
+		}
+		f.data = body.Data
+		f.version++
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestKVStore(t *testing.T) {
+	kv := &fakeKV{}
+	server := httptest.NewServer(kv)
+	defer server.Close()
+
+	store, err := NewStore("kv", map[string]string{
+		"address": server.URL,
+		"token":   "test-token",
+		"path":    "trust/bundle",
+	}, false)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if !store.IsSupported() {
+		t.Fatal("expected store to be supported with a valid token")
+	}
+
+	rootA := certstoretest.NewCertificate(t, "Root A")
+	rootB := certstoretest.NewCertificate(t, "Root B")
+	for _, c := range []*x509.Certificate{rootA, rootB, rootA} {
+		if err := store.AddCertificate(c); err != nil {
+			t.Fatalf("AddCertificate: %v", err)
+		}
+	}
+
+	certs, err := store.ListCertificates()
+	if err != nil || len(certs) != 2 {
+		t.Fatalf("ListCertificates = %d, %v; want 2 certificates", len(certs), err)
+	}
+
+	kv.data["owner"] = "platform-team"
+	if err := store.RemoveCertificate(rootA); err != nil {
+		t.Fatalf("RemoveCertificate: %v", err)
+	}
+	certs, _ = store.ListCertificates()
+	if len(certs) != 1 || !certs[0].Equal(rootB) {
+		t.Errorf("expected only Root B after removal, got %d certificates", len(certs))
+	}
+	if kv.data["owner"] != "platform-team" {
+		t.Error("other secret fields should be preserved")
+	}
+}
+
+func TestNewStoreRequiresToken(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+	if _, err := NewStore("kv", map[string]string{"address": "http://127.0.0.1:8200", "path": "x"}, false); err == nil {
+		t.Error("expected error without a vault token")
+	}
+}
@@ -0,0 +1,26 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/webprofusion/trust-store-updater/internal/platform/darwin"
+	"github.com/webprofusion/trust-store-updater/internal/platform/linux"
+	"github.com/webprofusion/trust-store-updater/internal/platform/windows"
+)
+
+// WatchSystemStores signals on the returned channel when this platform's
+// system stores change, until ctx is done
+func WatchSystemStores(ctx context.Context) (<-chan struct{}, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return darwin.WatchSystemStores(ctx)
+	case "linux":
+		return linux.WatchSystemStores(ctx)
+	case "windows":
+		return windows.WatchSystemStores(ctx)
+	default:
+		return nil, fmt.Errorf("watching the system stores is not supported on %s", runtime.GOOS)
+	}
+}
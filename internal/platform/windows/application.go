@@ -1,17 +1,24 @@
 package windows
 
 import (
+	"crypto"
 	"crypto/x509"
 	"fmt"
+	"time"
 
 	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/chromium"
+	"github.com/webprofusion/trust-store-updater/internal/platform/java"
 )
 
 // ApplicationStore implements certificate store operations for Windows application stores
 type ApplicationStore struct {
-	target  string
-	options map[string]string
-	verbose bool
+	target   string
+	options  map[string]string
+	verbose  bool
+	runner   certstore.Runner
+	java     *java.Store     // java-cacerts keystores
+	chromium *chromium.Store // chromium-policy browser policies
 }
 
 // NewApplicationStore creates a new Windows application certificate store
@@ -20,6 +27,7 @@ func NewApplicationStore(target string, options map[string]string, verbose bool)
 		target:  target,
 		options: options,
 		verbose: verbose,
+		runner:  &certstore.CommandRunner{Timeout: certstore.DefaultCommandTimeout},
 	}
 
 	// Validate target
@@ -27,6 +35,22 @@ func NewApplicationStore(target string, options map[string]string, verbose bool)
 		return nil, fmt.Errorf("unsupported application store target: %s", target)
 	}
 
+	if target == "java-cacerts" {
+		javaStore, err := java.NewStore(options, verbose)
+		if err != nil {
+			return nil, err
+		}
+		store.java = javaStore
+	}
+
+	if target == "chromium-policy" {
+		chromiumStore, err := chromium.NewStore(options)
+		if err != nil {
+			return nil, err
+		}
+		store.chromium = chromiumStore
+	}
+
 	return store, nil
 }
 
@@ -50,6 +74,10 @@ func (a *ApplicationStore) IsSupported() bool {
 		return a.hasEdge()
 	case "iis":
 		return a.hasIIS()
+	case "wsl":
+		return a.hasWSL()
+	case "chromium-policy":
+		return a.hasChromiumPolicy()
 	default:
 		return false
 	}
@@ -70,6 +98,10 @@ func (a *ApplicationStore) RequiresRoot() bool {
 		return false
 	case "iis":
 		return true // IIS requires admin privileges
+	case "wsl":
+		return false // wsl.exe can run as root inside each distro without admin
+	case "chromium-policy":
+		return true // Machine-wide browser policy
 	default:
 		return false
 	}
@@ -90,6 +122,10 @@ func (a *ApplicationStore) ListCertificates() ([]*x509.Certificate, error) {
 		return a.listEdgeCertificates()
 	case "iis":
 		return a.listIISCertificates()
+	case "wsl":
+		return a.listWSLCertificates()
+	case "chromium-policy":
+		return a.listChromiumPolicyCertificates()
 	default:
 		return nil, fmt.Errorf("unsupported target: %s", a.target)
 	}
@@ -110,11 +146,58 @@ func (a *ApplicationStore) AddCertificate(cert *x509.Certificate) error {
 		return a.addEdgeCertificate(cert)
 	case "iis":
 		return a.addIISCertificate(cert)
+	case "wsl":
+		return a.addWSLCertificate(cert)
+	case "chromium-policy":
+		return a.addChromiumPolicyCertificate(cert)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
 }
 
+// AddCertificateWithLabel adds a certificate under an alias where the
+// application has one (java-cacerts); other targets ignore the label
+func (a *ApplicationStore) AddCertificateWithLabel(cert *x509.Certificate, label string) error {
+	if a.java != nil {
+		return a.java.AddCertificateWithLabel(cert, label)
+	}
+	return a.AddCertificate(cert)
+}
+
+// SupportedPurposes returns the trust purposes java-cacerts can limit trust
+// to; other targets can't limit trust
+func (a *ApplicationStore) SupportedPurposes() []string {
+	if a.java != nil {
+		return a.java.SupportedPurposes()
+	}
+	return nil
+}
+
+// AddCertificateForPurposes adds a certificate limited to purposes
+func (a *ApplicationStore) AddCertificateForPurposes(cert *x509.Certificate, label string, purposes []string) error {
+	if a.java != nil {
+		return a.java.AddCertificateForPurposes(cert, label, purposes)
+	}
+	return fmt.Errorf("application %s can't limit trust to purposes", a.target)
+}
+
+// AddCertificateWithKey stores a leaf certificate and its key in the
+// java-cacerts keystores; other targets hold no keys
+func (a *ApplicationStore) AddCertificateWithKey(chain []*x509.Certificate, key crypto.Signer, label string) error {
+	if a.java != nil {
+		return a.java.AddCertificateWithKey(chain, key, label)
+	}
+	return fmt.Errorf("application %s can't hold private keys", a.target)
+}
+
+// TargetResults reports each Java keystore's changes for java-cacerts
+func (a *ApplicationStore) TargetResults() []certstore.TargetResult {
+	if a.java == nil {
+		return nil
+	}
+	return a.java.TargetResults()
+}
+
 // RemoveCertificate removes a certificate from the store
 func (a *ApplicationStore) RemoveCertificate(cert *x509.Certificate) error {
 	switch a.target {
@@ -130,6 +213,10 @@ func (a *ApplicationStore) RemoveCertificate(cert *x509.Certificate) error {
 		return a.removeEdgeCertificate(cert)
 	case "iis":
 		return a.removeIISCertificate(cert)
+	case "wsl":
+		return a.removeWSLCertificate(cert)
+	case "chromium-policy":
+		return a.removeChromiumPolicyCertificate(cert)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
@@ -150,6 +237,10 @@ func (a *ApplicationStore) Backup(backupPath string) error {
 		return a.backupEdge(backupPath)
 	case "iis":
 		return a.backupIIS(backupPath)
+	case "wsl":
+		return a.backupWSL(backupPath)
+	case "chromium-policy":
+		return a.backupChromiumPolicy(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
@@ -170,11 +261,23 @@ func (a *ApplicationStore) Restore(backupPath string) error {
 		return a.restoreEdge(backupPath)
 	case "iis":
 		return a.restoreIIS(backupPath)
+	case "wsl":
+		return a.restoreWSL(backupPath)
+	case "chromium-policy":
+		return a.restoreChromiumPolicy(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", a.target)
 	}
 }
 
+// SetCommandTimeout bounds external commands such as wsl.exe and keytool
+func (a *ApplicationStore) SetCommandTimeout(timeout time.Duration) {
+	certstore.SetRunnerTimeout(a.runner, timeout)
+	if a.java != nil {
+		a.java.SetCommandTimeout(timeout)
+	}
+}
+
 // Validate checks if the store is in a valid state
 func (a *ApplicationStore) Validate() error {
 	if !a.IsSupported() {
@@ -185,9 +288,14 @@ func (a *ApplicationStore) Validate() error {
 
 // Helper methods
 
+// ApplicationTargets returns every application store target known on this platform,
+// whether or not it is available on this machine
+func ApplicationTargets() []string {
+	return []string{"docker", "java-cacerts", "firefox", "chrome", "edge", "iis", "wsl", "chromium-policy"}
+}
+
 func isValidApplicationTarget(target string) bool {
-	validTargets := []string{"docker", "java-cacerts", "firefox", "chrome", "edge", "iis"}
-	for _, valid := range validTargets {
+	for _, valid := range ApplicationTargets() {
 		if target == valid {
 			return true
 		}
@@ -200,7 +308,11 @@ func (a *ApplicationStore) hasDocker() bool {
 }
 
 func (a *ApplicationStore) hasJava() bool {
-	return false // Placeholder - check if Java is installed
+	return a.java.IsSupported()
+}
+
+func (a *ApplicationStore) hasChromiumPolicy() bool {
+	return a.chromium.IsSupported()
 }
 
 func (a *ApplicationStore) hasFirefox() bool {
@@ -242,23 +354,23 @@ func (a *ApplicationStore) restoreDocker(backupPath string) error {
 
 // Java operations
 func (a *ApplicationStore) listJavaCertificates() ([]*x509.Certificate, error) {
-	return nil, fmt.Errorf("java certificate listing not implemented")
+	return a.java.ListCertificates()
 }
 
 func (a *ApplicationStore) addJavaCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("java certificate addition not implemented")
+	return a.java.AddCertificate(cert)
 }
 
 func (a *ApplicationStore) removeJavaCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("java certificate removal not implemented")
+	return a.java.RemoveCertificate(cert)
 }
 
 func (a *ApplicationStore) backupJava(backupPath string) error {
-	return fmt.Errorf("java backup not implemented")
+	return a.java.Backup(backupPath)
 }
 
 func (a *ApplicationStore) restoreJava(backupPath string) error {
-	return fmt.Errorf("java restore not implemented")
+	return a.java.Restore(backupPath)
 }
 
 // Firefox operations
@@ -346,3 +458,24 @@ func (a *ApplicationStore) backupIIS(backupPath string) error {
 func (a *ApplicationStore) restoreIIS(backupPath string) error {
 	return fmt.Errorf("IIS restore not implemented")
 }
+
+// Chromium policy operations
+func (a *ApplicationStore) listChromiumPolicyCertificates() ([]*x509.Certificate, error) {
+	return a.chromium.ListCertificates()
+}
+
+func (a *ApplicationStore) addChromiumPolicyCertificate(cert *x509.Certificate) error {
+	return a.chromium.AddCertificate(cert)
+}
+
+func (a *ApplicationStore) removeChromiumPolicyCertificate(cert *x509.Certificate) error {
+	return a.chromium.RemoveCertificate(cert)
+}
+
+func (a *ApplicationStore) backupChromiumPolicy(backupPath string) error {
+	return a.chromium.Backup(backupPath)
+}
+
+func (a *ApplicationStore) restoreChromiumPolicy(backupPath string) error {
+	return a.chromium.Restore(backupPath)
+}
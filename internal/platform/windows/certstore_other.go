@@ -0,0 +1,22 @@
+//go:build !windows
+
+package windows
+
+import (
+	"crypto/x509"
+	"errors"
+)
+
+var errNotWindows = errors.New("the Windows certificate store is only available on Windows")
+
+func storeCertificates(name string, machine bool, match func(usage []byte) bool) ([]*x509.Certificate, error) {
+	return nil, errNotWindows
+}
+
+func addToStore(name string, machine bool, cert *x509.Certificate, usage []byte, label string) error {
+	return errNotWindows
+}
+
+func deleteFromStore(name string, machine bool, cert *x509.Certificate) error {
+	return errNotWindows
+}
@@ -0,0 +1,155 @@
+//go:build windows
+
+package windows
+
+import (
+	"crypto/x509"
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// certEnhKeyUsagePropID is CERT_ENHKEY_USAGE_PROP_ID
+const certEnhKeyUsagePropID = 9
+
+// certFriendlyNamePropID is CERT_FRIENDLY_NAME_PROP_ID
+const certFriendlyNamePropID = 11
+
+const certEncoding = windows.X509_ASN_ENCODING | windows.PKCS_7_ASN_ENCODING
+
+var (
+	crypt32                               = windows.NewLazySystemDLL("crypt32.dll")
+	procCertGetCertificateContextProperty = crypt32.NewProc("CertGetCertificateContextProperty")
+	procCertSetCertificateContextProperty = crypt32.NewProc("CertSetCertificateContextProperty")
+)
+
+// openSystemStore opens a system store such as ROOT or CA of the machine
+// or of the running user
+func openSystemStore(name string, machine bool) (windows.Handle, error) {
+	location := uint32(windows.CERT_SYSTEM_STORE_CURRENT_USER)
+	if machine {
+		location = windows.CERT_SYSTEM_STORE_LOCAL_MACHINE
+	}
+	storeName, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	return windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM_W, 0, 0, location, uintptr(unsafe.Pointer(storeName)))
+}
+
+// enhancedKeyUsage reads a certificate's enhanced key usage property, or
+// nil when it has none
+func enhancedKeyUsage(ctx *windows.CertContext) []byte {
+	var size uint32
+	r, _, _ := procCertGetCertificateContextProperty.Call(uintptr(unsafe.Pointer(ctx)), certEnhKeyUsagePropID, 0, uintptr(unsafe.Pointer(&size)))
+	if r == 0 || size == 0 {
+		return nil
+	}
+	data := make([]byte, size)
+	r, _, _ = procCertGetCertificateContextProperty.Call(uintptr(unsafe.Pointer(ctx)), certEnhKeyUsagePropID, uintptr(unsafe.Pointer(&data[0])), uintptr(unsafe.Pointer(&size)))
+	if r == 0 {
+		return nil
+	}
+	return data[:size]
+}
+
+// storeCertificates lists a system store's certificates, only those whose
+// enhanced key usage property match accepts when match is set
+func storeCertificates(name string, machine bool, match func(usage []byte) bool) ([]*x509.Certificate, error) {
+	store, err := openSystemStore(name, machine)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	var certs []*x509.Certificate
+	var ctx *windows.CertContext
+	for {
+		ctx, err = windows.CertEnumCertificatesInStore(store, ctx)
+		if err != nil {
+			break
+		}
+		if match != nil && !match(enhancedKeyUsage(ctx)) {
+			continue
+		}
+		der := unsafe.Slice(ctx.EncodedCert, ctx.Length)
+		if c, err := x509.ParseCertificate(append([]byte(nil), der...)); err == nil {
+			certs = append(certs, c)
+		}
+	}
+	return certs, nil
+}
+
+// addToStore adds cert to a system store, or takes the copy already there,
+// and sets its enhanced key usage property when usage is set and its
+// friendly name when label is
+func addToStore(name string, machine bool, cert *x509.Certificate, usage []byte, label string) error {
+	store, err := openSystemStore(name, machine)
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	ctx, err := windows.CertCreateCertificateContext(certEncoding, &cert.Raw[0], uint32(len(cert.Raw)))
+	if err != nil {
+		return err
+	}
+	defer windows.CertFreeCertificateContext(ctx)
+	var stored *windows.CertContext
+	if err := windows.CertAddCertificateContextToStore(store, ctx, windows.CERT_STORE_ADD_USE_EXISTING, &stored); err != nil {
+		return err
+	}
+	defer windows.CertFreeCertificateContext(stored)
+	if usage != nil {
+		if err := setProperty(stored, certEnhKeyUsagePropID, usage); err != nil {
+			return err
+		}
+	}
+	if label != "" {
+		name, err := windows.UTF16FromString(label)
+		if err != nil {
+			return err
+		}
+		// The friendly name is a NUL-terminated UTF-16 string
+		data := unsafe.Slice((*byte)(unsafe.Pointer(&name[0])), len(name)*2)
+		if err := setProperty(stored, certFriendlyNamePropID, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setProperty sets a certificate context property held in a data blob
+func setProperty(ctx *windows.CertContext, propID uintptr, data []byte) error {
+	blob := windows.CryptDataBlob{Size: uint32(len(data)), Data: &data[0]}
+	r, _, err := procCertSetCertificateContextProperty.Call(uintptr(unsafe.Pointer(ctx)), propID, 0, uintptr(unsafe.Pointer(&blob)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// deleteFromStore deletes cert from a system store
+func deleteFromStore(name string, machine bool, cert *x509.Certificate) error {
+	store, err := openSystemStore(name, machine)
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	ctx, err := windows.CertCreateCertificateContext(certEncoding, &cert.Raw[0], uint32(len(cert.Raw)))
+	if err != nil {
+		return err
+	}
+	defer windows.CertFreeCertificateContext(ctx)
+	found, err := windows.CertFindCertificateInStore(store, certEncoding, 0, windows.CERT_FIND_EXISTING, unsafe.Pointer(ctx), nil)
+	if err != nil {
+		if errors.Is(err, windows.Errno(windows.CRYPT_E_NOT_FOUND)) {
+			return nil
+		}
+		return err
+	}
+	// CertDeleteCertificateFromStore frees the context it is given
+	return windows.CertDeleteCertificateFromStore(found)
+}
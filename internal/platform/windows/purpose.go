@@ -0,0 +1,47 @@
+package windows
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// purposeOIDs are the extended key usages of each trust purpose
+var purposeOIDs = map[string]asn1.ObjectIdentifier{
+	certstore.PurposeServerAuth:  {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	certstore.PurposeClientAuth:  {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	certstore.PurposeCodeSigning: {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	certstore.PurposeSMIME:       {1, 3, 6, 1, 5, 5, 7, 3, 4},
+}
+
+// enhancedKeyUsageFor encodes the enhanced key usage property limiting a
+// certificate to purposes. Windows intersects it with the usages of the
+// rest of the chain, so it narrows trust in the certificate and everything
+// it issues.
+func enhancedKeyUsageFor(purposes []string) []byte {
+	oids := make([]asn1.ObjectIdentifier, 0, len(purposes))
+	for _, p := range purposes {
+		oids = append(oids, purposeOIDs[p])
+	}
+	data, _ := asn1.Marshal(oids)
+	return data
+}
+
+// SupportedPurposes returns the trust purposes the store can limit trust
+// to, with an enhanced key usage property
+func (s *SystemStore) SupportedPurposes() []string {
+	if s.target == "smime" {
+		return []string{certstore.PurposeSMIME}
+	}
+	return certstore.TrustPurposes
+}
+
+// AddCertificateForPurposes adds cert with an enhanced key usage property
+// limiting it to purposes, and label as its friendly name
+func (s *SystemStore) AddCertificateForPurposes(cert *x509.Certificate, label string, purposes []string) error {
+	if s.target == "smime" {
+		return s.addSMIMECertificate(cert, label)
+	}
+	return s.stores.add(systemStoreNames[s.target], s.machineScope(), cert, enhancedKeyUsageFor(purposes), label)
+}
@@ -0,0 +1,107 @@
+package windows
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// S/MIME intermediate operations. Intermediates are published to the
+// Intermediate Certification Authorities store, where Outlook and other
+// CryptoAPI mail clients find them when building a chain for a signed or
+// encrypted message. Each gets an enhanced key usage property limiting it
+// to email protection, so chains through it aren't valid for TLS or code
+// signing whatever its issuer is trusted for. Only certificates carrying
+// that property are listed, so Windows Update's intermediates are left
+// alone.
+//
+// Options:
+//   - scope: machine (default, needs administrator) or user
+
+// smimeBackupFile holds the published intermediates in a backup
+const smimeBackupFile = "smime-intermediates.pem"
+
+// isSMIMEUsage reports whether an enhanced key usage property allows email
+// protection only
+func isSMIMEUsage(data []byte) bool {
+	var usages []asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(data, &usages); err != nil || len(rest) > 0 {
+		return false
+	}
+	return len(usages) == 1 && usages[0].Equal(purposeOIDs[certstore.PurposeSMIME])
+}
+
+// isSelfSigned reports whether cert is a root rather than an intermediate
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// Accepts reports whether the store can hold cert: the smime target only
+// publishes intermediates, so roots are left out of its updates
+func (s *SystemStore) Accepts(cert *x509.Certificate) bool {
+	return s.target != "smime" || !isSelfSigned(cert)
+}
+
+func (s *SystemStore) listSMIMECertificates() ([]*x509.Certificate, error) {
+	return s.stores.certificates("CA", s.machineScope(), isSMIMEUsage)
+}
+
+func (s *SystemStore) addSMIMECertificate(cert *x509.Certificate, label string) error {
+	if isSelfSigned(cert) {
+		return fmt.Errorf("%s is a root; publish roots with the root target", cert.Subject.CommonName)
+	}
+	return s.stores.add("CA", s.machineScope(), cert, enhancedKeyUsageFor([]string{certstore.PurposeSMIME}), label)
+}
+
+func (s *SystemStore) removeSMIMECertificate(cert *x509.Certificate) error {
+	return s.stores.remove("CA", s.machineScope(), cert)
+}
+
+func (s *SystemStore) backupSMIMEStore(backupPath string) error {
+	certs, err := s.listSMIMECertificates()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return atomicfile.WriteFile(filepath.Join(backupPath, smimeBackupFile), certstore.EncodePEMBundle(certs), 0600)
+}
+
+// restoreSMIMEStore unpublishes intermediates published since the backup
+// and publishes the backed up ones again
+func (s *SystemStore) restoreSMIMEStore(backupPath string) error {
+	data, err := os.ReadFile(filepath.Join(backupPath, smimeBackupFile))
+	if err != nil {
+		return fmt.Errorf("not an S/MIME intermediate backup: %w", err)
+	}
+	saved, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		return err
+	}
+	current, err := s.listSMIMECertificates()
+	if err != nil {
+		return err
+	}
+	for _, c := range current {
+		if !certstore.ContainsCertificate(saved, c) {
+			if err := s.removeSMIMECertificate(c); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range saved {
+		if !certstore.ContainsCertificate(current, c) {
+			if err := s.addSMIMECertificate(c, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
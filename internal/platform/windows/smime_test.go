@@ -0,0 +1,25 @@
+package windows
+
+import (
+	"encoding/asn1"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+func TestSMIMEUsage(t *testing.T) {
+	if !isSMIMEUsage(enhancedKeyUsageFor([]string{certstore.PurposeSMIME})) {
+		t.Error("the property set on published intermediates should be recognised")
+	}
+	both := enhancedKeyUsageFor([]string{certstore.PurposeServerAuth, certstore.PurposeSMIME})
+	if isSMIMEUsage(both) {
+		t.Error("a property also allowing server authentication isn't S/MIME only")
+	}
+	var usages []asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(both, &usages); err != nil || len(usages) != 2 || usages[0].String() != "1.3.6.1.5.5.7.3.1" {
+		t.Errorf("usages = %v, %v", usages, err)
+	}
+	if isSMIMEUsage(nil) {
+		t.Error("a certificate without the property isn't S/MIME only")
+	}
+}
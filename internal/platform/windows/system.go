@@ -1,16 +1,25 @@
 package windows
 
 import (
+	"crypto"
+	"crypto/rand"
 	"crypto/x509"
+	"encoding/hex"
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
 	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/pkcs12"
 )
 
 // SystemStore implements certificate store operations for Windows system stores
 type SystemStore struct {
 	target  string
 	options map[string]string
+	runner  certstore.Runner
+	stores  cryptoStores
 	verbose bool
 }
 
@@ -19,6 +28,8 @@ func NewSystemStore(target string, options map[string]string, verbose bool) (cer
 	store := &SystemStore{
 		target:  target,
 		options: options,
+		runner:  &certstore.CommandRunner{Verbose: verbose},
+		stores:  systemStores{},
 		verbose: verbose,
 	}
 
@@ -46,6 +57,8 @@ func (s *SystemStore) IsSupported() bool {
 		return true // Personal certificate store is always available
 	case "trust":
 		return true // Enterprise Trust store is always available
+	case "smime":
+		return true // Intermediate CA store is always available
 	default:
 		return false
 	}
@@ -59,9 +72,11 @@ func (s *SystemStore) RequiresRoot() bool {
 	case "ca":
 		return true // System CA store requires admin privileges
 	case "my":
-		return false // Personal store doesn't require admin
+		return s.machineScope() // The user's Personal store doesn't require admin
 	case "trust":
 		return true // Enterprise Trust store requires admin privileges
+	case "smime":
+		return s.machineScope() // The user's Intermediate CA store doesn't
 	default:
 		return false
 	}
@@ -70,14 +85,10 @@ func (s *SystemStore) RequiresRoot() bool {
 // ListCertificates returns all certificates currently in the store
 func (s *SystemStore) ListCertificates() ([]*x509.Certificate, error) {
 	switch s.target {
-	case "root":
-		return s.listRootCertificates()
-	case "ca":
-		return s.listCACertificates()
-	case "my":
-		return s.listPersonalCertificates()
-	case "trust":
-		return s.listTrustCertificates()
+	case "root", "ca", "my", "trust":
+		return s.listStoreCertificates()
+	case "smime":
+		return s.listSMIMECertificates()
 	default:
 		return nil, fmt.Errorf("unsupported target: %s", s.target)
 	}
@@ -86,14 +97,22 @@ func (s *SystemStore) ListCertificates() ([]*x509.Certificate, error) {
 // AddCertificate adds a certificate to the store
 func (s *SystemStore) AddCertificate(cert *x509.Certificate) error {
 	switch s.target {
-	case "root":
-		return s.addRootCertificate(cert)
-	case "ca":
-		return s.addCACertificate(cert)
-	case "my":
-		return s.addPersonalCertificate(cert)
-	case "trust":
-		return s.addTrustCertificate(cert)
+	case "root", "ca", "my", "trust":
+		return s.addStoreCertificate(cert, "")
+	case "smime":
+		return s.addSMIMECertificate(cert, "")
+	default:
+		return fmt.Errorf("unsupported target: %s", s.target)
+	}
+}
+
+// AddCertificateWithLabel adds a certificate with label as its friendly name
+func (s *SystemStore) AddCertificateWithLabel(cert *x509.Certificate, label string) error {
+	switch s.target {
+	case "root", "ca", "my", "trust":
+		return s.addStoreCertificate(cert, label)
+	case "smime":
+		return s.addSMIMECertificate(cert, label)
 	default:
 		return fmt.Errorf("unsupported target: %s", s.target)
 	}
@@ -102,30 +121,70 @@ func (s *SystemStore) AddCertificate(cert *x509.Certificate) error {
 // RemoveCertificate removes a certificate from the store
 func (s *SystemStore) RemoveCertificate(cert *x509.Certificate) error {
 	switch s.target {
-	case "root":
-		return s.removeRootCertificate(cert)
-	case "ca":
-		return s.removeCACertificate(cert)
-	case "my":
-		return s.removePersonalCertificate(cert)
-	case "trust":
-		return s.removeTrustCertificate(cert)
+	case "root", "ca", "my", "trust":
+		return s.removeStoreCertificate(cert)
+	case "smime":
+		return s.removeSMIMECertificate(cert)
 	default:
 		return fmt.Errorf("unsupported target: %s", s.target)
 	}
 }
 
+// AddCertificateWithKey imports a leaf certificate and its key into the
+// Personal store with certutil, for IIS and other services that find their
+// certificate there. The certificate it replaces stays until removed, as
+// bindings refer to it by hash until they are updated.
+func (s *SystemStore) AddCertificateWithKey(chain []*x509.Certificate, key crypto.Signer, label string) error {
+	if s.target != "my" {
+		return fmt.Errorf("%s can't hold private keys", s.Name())
+	}
+	if label == "" {
+		label = chain[0].Subject.CommonName
+	}
+	// The PFX only lives in a temporary file, so a one-off password on
+	// certutil's command line protects nothing lasting
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	password := hex.EncodeToString(secret)
+	data, err := pkcs12.Encode(key, chain, label, password)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "trust-store-updater-*.pfx")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	args := []string{"-f", "-p", password}
+	if !s.machineScope() {
+		args = append(args, "-user")
+	}
+	// NoRoot keeps the chain's root out of the Root store; roots are
+	// installed through the root target
+	args = append(args, "-importPFX", "MY", tmp.Name(), "NoRoot")
+	if _, err := s.runner.Run("certutil", args...); err != nil {
+		return fmt.Errorf("failed to import %s into the Personal store: %w", chain[0].Subject, err)
+	}
+	return nil
+}
+
 // Backup creates a backup of the current store state
 func (s *SystemStore) Backup(backupPath string) error {
 	switch s.target {
-	case "root":
-		return s.backupRootStore(backupPath)
-	case "ca":
-		return s.backupCAStore(backupPath)
-	case "my":
-		return s.backupPersonalStore(backupPath)
-	case "trust":
-		return s.backupTrustStore(backupPath)
+	case "root", "ca", "my", "trust":
+		return s.backupStore(backupPath)
+	case "smime":
+		return s.backupSMIMEStore(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", s.target)
 	}
@@ -134,14 +193,10 @@ func (s *SystemStore) Backup(backupPath string) error {
 // Restore restores the store from a backup
 func (s *SystemStore) Restore(backupPath string) error {
 	switch s.target {
-	case "root":
-		return s.restoreRootStore(backupPath)
-	case "ca":
-		return s.restoreCAStore(backupPath)
-	case "my":
-		return s.restorePersonalStore(backupPath)
-	case "trust":
-		return s.restoreTrustStore(backupPath)
+	case "root", "ca", "my", "trust":
+		return s.restoreStore(backupPath)
+	case "smime":
+		return s.restoreSMIMEStore(backupPath)
 	default:
 		return fmt.Errorf("unsupported target: %s", s.target)
 	}
@@ -157,9 +212,14 @@ func (s *SystemStore) Validate() error {
 
 // Helper methods
 
+// SystemTargets returns every system store target known on this platform,
+// whether or not it is available on this machine
+func SystemTargets() []string {
+	return []string{"root", "ca", "my", "trust", "smime"}
+}
+
 func isValidSystemTarget(target string) bool {
-	validTargets := []string{"root", "ca", "my", "trust"}
-	for _, valid := range validTargets {
+	for _, valid := range SystemTargets() {
 		if target == valid {
 			return true
 		}
@@ -167,98 +227,107 @@ func isValidSystemTarget(target string) bool {
 	return false
 }
 
-// Root certificate store operations
-func (s *SystemStore) listRootCertificates() ([]*x509.Certificate, error) {
-	// Use Windows Certificate Store API to list certificates
-	// This would use syscalls to CertOpenSystemStore and CertEnumCertificatesInStore
-	return nil, fmt.Errorf("root certificate listing not implemented")
-}
-
-func (s *SystemStore) addRootCertificate(cert *x509.Certificate) error {
-	// Use Windows Certificate Store API to add certificate
-	// This would use CertAddCertificateContextToStore
-	return fmt.Errorf("root certificate addition not implemented")
+// systemStoreNames are the CryptoAPI names of the system store targets
+var systemStoreNames = map[string]string{
+	"root":  "ROOT",
+	"ca":    "CA",
+	"my":    "MY",
+	"trust": "Trust",
+	"smime": "CA",
 }
 
-func (s *SystemStore) removeRootCertificate(cert *x509.Certificate) error {
-	// Use Windows Certificate Store API to remove certificate
-	return fmt.Errorf("root certificate removal not implemented")
+// cryptoStores reaches the CryptoAPI certificate stores by name, in the
+// machine's or the running user's scope
+type cryptoStores interface {
+	certificates(name string, machine bool, match func(usage []byte) bool) ([]*x509.Certificate, error)
+	add(name string, machine bool, cert *x509.Certificate, usage []byte, label string) error
+	remove(name string, machine bool, cert *x509.Certificate) error
 }
 
-func (s *SystemStore) backupRootStore(backupPath string) error {
-	// Export root certificate store
-	return fmt.Errorf("root store backup not implemented")
-}
-
-func (s *SystemStore) restoreRootStore(backupPath string) error {
-	// Import root certificate store
-	return fmt.Errorf("root store restore not implemented")
-}
-
-// CA certificate store operations
-func (s *SystemStore) listCACertificates() ([]*x509.Certificate, error) {
-	return nil, fmt.Errorf("CA certificate listing not implemented")
-}
-
-func (s *SystemStore) addCACertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("CA certificate addition not implemented")
-}
-
-func (s *SystemStore) removeCACertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("CA certificate removal not implemented")
-}
+// systemStores are the stores of the running system. The syscalls behind
+// them only build on Windows; elsewhere every call fails, and tests
+// substitute an in-memory cryptoStores.
+type systemStores struct{}
 
-func (s *SystemStore) backupCAStore(backupPath string) error {
-	return fmt.Errorf("CA store backup not implemented")
+func (systemStores) certificates(name string, machine bool, match func(usage []byte) bool) ([]*x509.Certificate, error) {
+	return storeCertificates(name, machine, match)
 }
 
-func (s *SystemStore) restoreCAStore(backupPath string) error {
-	return fmt.Errorf("CA store restore not implemented")
+func (systemStores) add(name string, machine bool, cert *x509.Certificate, usage []byte, label string) error {
+	return addToStore(name, machine, cert, usage, label)
 }
 
-// Personal certificate store operations
-func (s *SystemStore) listPersonalCertificates() ([]*x509.Certificate, error) {
-	return nil, fmt.Errorf("personal certificate listing not implemented")
+func (systemStores) remove(name string, machine bool, cert *x509.Certificate) error {
+	return deleteFromStore(name, machine, cert)
 }
 
-func (s *SystemStore) addPersonalCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("personal certificate addition not implemented")
-}
-
-func (s *SystemStore) removePersonalCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("personal certificate removal not implemented")
-}
-
-func (s *SystemStore) backupPersonalStore(backupPath string) error {
-	return fmt.Errorf("personal store backup not implemented")
-}
-
-func (s *SystemStore) restorePersonalStore(backupPath string) error {
-	return fmt.Errorf("personal store restore not implemented")
+// machineScope reports whether the machine's store rather than the running
+// user's is managed. options.scope is machine or user; the Personal store
+// defaults to the user's, the others to the machine's.
+func (s *SystemStore) machineScope() bool {
+	if scope := s.options["scope"]; scope != "" {
+		return scope == "machine"
+	}
+	return s.target != "my"
 }
 
-// Trust certificate store operations
-func (s *SystemStore) listTrustCertificates() ([]*x509.Certificate, error) {
-	return nil, fmt.Errorf("trust certificate listing not implemented")
+func (s *SystemStore) listStoreCertificates() ([]*x509.Certificate, error) {
+	return s.stores.certificates(systemStoreNames[s.target], s.machineScope(), nil)
 }
 
-func (s *SystemStore) addTrustCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("trust certificate addition not implemented")
+func (s *SystemStore) addStoreCertificate(cert *x509.Certificate, label string) error {
+	return s.stores.add(systemStoreNames[s.target], s.machineScope(), cert, nil, label)
 }
 
-func (s *SystemStore) removeTrustCertificate(cert *x509.Certificate) error {
-	return fmt.Errorf("trust certificate removal not implemented")
+func (s *SystemStore) removeStoreCertificate(cert *x509.Certificate) error {
+	return s.stores.remove(systemStoreNames[s.target], s.machineScope(), cert)
 }
 
-func (s *SystemStore) backupTrustStore(backupPath string) error {
-	return fmt.Errorf("trust store backup not implemented")
+// backupStore saves the store's certificates as a PEM bundle
+func (s *SystemStore) backupStore(backupPath string) error {
+	certs, err := s.listStoreCertificates()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupPath, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return atomicfile.WriteFile(filepath.Join(backupPath, s.target+".pem"), certstore.EncodePEMBundle(certs), 0600)
 }
 
-func (s *SystemStore) restoreTrustStore(backupPath string) error {
-	return fmt.Errorf("trust store restore not implemented")
+// restoreStore returns the store to the backed up certificates. Properties
+// such as enhanced key usage aren't part of the backup.
+func (s *SystemStore) restoreStore(backupPath string) error {
+	data, err := os.ReadFile(filepath.Join(backupPath, s.target+".pem"))
+	if err != nil {
+		return fmt.Errorf("not a %s store backup: %w", s.target, err)
+	}
+	saved, err := certstore.ParsePEMBundle(data)
+	if err != nil {
+		return err
+	}
+	current, err := s.listStoreCertificates()
+	if err != nil {
+		return err
+	}
+	for _, c := range current {
+		if !certstore.ContainsCertificate(saved, c) {
+			if err := s.removeStoreCertificate(c); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range saved {
+		if !certstore.ContainsCertificate(current, c) {
+			if err := s.addStoreCertificate(c, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // SupportedStores returns the list of supported stores for Windows
 func SupportedStores() []string {
-	return []string{"root", "ca", "my", "trust"}
+	return []string{"root", "ca", "my", "trust", "smime"}
 }
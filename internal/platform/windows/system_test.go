@@ -0,0 +1,177 @@
+package windows
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+// memoryStores is an in-memory cryptoStores, so store logic can be tested
+// off Windows
+type memoryStores struct {
+	certs  map[string][]*x509.Certificate // by store name and scope
+	usage  map[string][]byte              // by DER encoding
+	labels map[string]string              // friendly names by DER encoding
+}
+
+func newMemoryStores() *memoryStores {
+	return &memoryStores{certs: make(map[string][]*x509.Certificate), usage: make(map[string][]byte), labels: make(map[string]string)}
+}
+
+func storeKey(name string, machine bool) string {
+	if machine {
+		return "machine/" + name
+	}
+	return "user/" + name
+}
+
+func (m *memoryStores) certificates(name string, machine bool, match func(usage []byte) bool) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, c := range m.certs[storeKey(name, machine)] {
+		if match == nil || match(m.usage[string(c.Raw)]) {
+			certs = append(certs, c)
+		}
+	}
+	return certs, nil
+}
+
+func (m *memoryStores) add(name string, machine bool, cert *x509.Certificate, usage []byte, label string) error {
+	key := storeKey(name, machine)
+	if !certstore.ContainsCertificate(m.certs[key], cert) {
+		m.certs[key] = append(m.certs[key], cert)
+	}
+	m.usage[string(cert.Raw)] = usage
+	if label != "" {
+		m.labels[string(cert.Raw)] = label
+	}
+	return nil
+}
+
+func (m *memoryStores) remove(name string, machine bool, cert *x509.Certificate) error {
+	key := storeKey(name, machine)
+	var kept []*x509.Certificate
+	for _, c := range m.certs[key] {
+		if !c.Equal(cert) {
+			kept = append(kept, c)
+		}
+	}
+	m.certs[key] = kept
+	return nil
+}
+
+func TestSystemStoreRestore(t *testing.T) {
+	stores := newMemoryStores()
+	store := &SystemStore{target: "root", stores: stores}
+	kept := certstoretest.NewCertificate(t, "Kept Root")
+	removed := certstoretest.NewCertificate(t, "Removed Root")
+	added := certstoretest.NewCertificate(t, "Added Root")
+
+	for _, c := range []*x509.Certificate{kept, removed} {
+		if err := store.AddCertificate(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backup := t.TempDir()
+	if err := store.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RemoveCertificate(removed); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddCertificate(added); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Restore(backup); err != nil {
+		t.Fatal(err)
+	}
+	certs, _ := store.ListCertificates()
+	if len(certs) != 2 || !certstore.ContainsCertificate(certs, kept) || !certstore.ContainsCertificate(certs, removed) {
+		t.Errorf("restored store holds %d certificates", len(certs))
+	}
+	if len(stores.certs["machine/ROOT"]) != 2 || len(stores.certs["user/ROOT"]) != 0 {
+		t.Error("the machine's Root store should have been restored")
+	}
+}
+
+func TestSystemStoreAddCertificateWithLabel(t *testing.T) {
+	stores := newMemoryStores()
+	store := &SystemStore{target: "root", stores: stores}
+	root := certstoretest.NewCertificate(t, "Corp Root")
+
+	var adder certstore.LabeledAdder = store
+	if err := adder.AddCertificateWithLabel(root, "corp-root"); err != nil {
+		t.Fatal(err)
+	}
+	if got := stores.labels[string(root.Raw)]; got != "corp-root" {
+		t.Errorf("friendly name = %q, want corp-root", got)
+	}
+	if err := store.AddCertificateForPurposes(root, "corp-root-tls", []string{certstore.PurposeServerAuth}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stores.labels[string(root.Raw)]; got != "corp-root-tls" {
+		t.Errorf("friendly name = %q after a purpose-limited add, want corp-root-tls", got)
+	}
+}
+
+func TestSystemStoreSMIMEListsPublishedIntermediates(t *testing.T) {
+	stores := newMemoryStores()
+	root := certstoretest.NewCertificate(t, "Mail Root")
+	published := certstoretest.NewCertificate(t, "Mail Intermediate")
+	published.RawIssuer = root.RawSubject // not self-signed
+	other := certstoretest.NewCertificate(t, "Windows Update Intermediate")
+	stores.add("CA", true, other, nil, "")
+
+	store := &SystemStore{target: "smime", stores: stores}
+	if err := store.AddCertificate(root); err == nil {
+		t.Error("a root was published as an S/MIME intermediate")
+	}
+	if err := store.AddCertificate(published); err != nil {
+		t.Fatal(err)
+	}
+	certs, _ := store.ListCertificates()
+	if len(certs) != 1 || !certs[0].Equal(published) {
+		t.Errorf("expected only the published intermediate, got %d certificates", len(certs))
+	}
+}
+
+func TestAddCertificateWithKeyRunsCertutil(t *testing.T) {
+	leaf := certstoretest.NewCertificate(t, "web.example.com")
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pfx string
+	var data []byte
+	runner := &certstoretest.Runner{Handle: func(call certstoretest.Call) certstoretest.Response {
+		pfx = call.Args[len(call.Args)-2]
+		data, _ = os.ReadFile(pfx)
+		return certstoretest.Response{}
+	}}
+	store := &SystemStore{target: "my", options: map[string]string{}, runner: runner}
+	if err := store.AddCertificateWithKey([]*x509.Certificate{leaf}, key, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := runner.Calls()
+	if len(calls) != 1 || calls[0].Name != "certutil" {
+		t.Fatalf("ran %v", calls)
+	}
+	if len(data) == 0 || data[0] != 0x30 {
+		t.Error("certutil was not given a PKCS#12 file")
+	}
+	if line := calls[0].String(); !strings.Contains(line, " -user -importPFX MY ") || !strings.HasSuffix(line, " NoRoot") {
+		t.Errorf("certutil ran as %q", line)
+	}
+	if _, err := os.Stat(pfx); !os.IsNotExist(err) {
+		t.Errorf("the PFX file %s was left behind", pfx)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package windows
+
+import "context"
+
+func WatchSystemStores(ctx context.Context) (<-chan struct{}, error) {
+	return nil, errNotWindows
+}
@@ -0,0 +1,108 @@
+//go:build windows
+
+package windows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// watchedKeys hold the machine's certificate stores: its own, those set by
+// Group Policy and those published from Active Directory
+var watchedKeys = []string{
+	`SOFTWARE\Microsoft\SystemCertificates`,
+	`SOFTWARE\Policies\Microsoft\SystemCertificates`,
+	`SOFTWARE\Microsoft\EnterpriseCertificates`,
+}
+
+const notifyFilter = windows.REG_NOTIFY_CHANGE_NAME | windows.REG_NOTIFY_CHANGE_LAST_SET
+
+// WatchSystemStores signals on the returned channel whenever a machine
+// certificate store changes, until ctx is done. Bursts of changes may be
+// signalled once.
+func WatchSystemStores(ctx context.Context) (<-chan struct{}, error) {
+	changed := make(chan struct{}, 1)
+	ready := make(chan error, 1)
+	go func() {
+		// Registry notifications are cancelled when the thread that asked
+		// for them exits, so keep them all on this one
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		stop, err := windows.CreateEvent(nil, 1, 0, nil)
+		if err != nil {
+			ready <- err
+			return
+		}
+		defer windows.CloseHandle(stop)
+		handles := []windows.Handle{stop}
+		var keys []registry.Key
+		var paths []string
+		defer func() {
+			for _, key := range keys {
+				key.Close()
+			}
+			for _, event := range handles[1:] {
+				windows.CloseHandle(event)
+			}
+		}()
+
+		for _, path := range watchedKeys {
+			key, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.NOTIFY)
+			if errors.Is(err, registry.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				ready <- fmt.Errorf("failed to open HKLM\\%s: %w", path, err)
+				return
+			}
+			keys, paths = append(keys, key), append(paths, path)
+			event, err := windows.CreateEvent(nil, 0, 0, nil)
+			if err != nil {
+				ready <- err
+				return
+			}
+			handles = append(handles, event)
+			if err := windows.RegNotifyChangeKeyValue(windows.Handle(key), true, notifyFilter, event, true); err != nil {
+				ready <- fmt.Errorf("failed to watch HKLM\\%s: %w", path, err)
+				return
+			}
+		}
+		ready <- nil
+
+		go func() {
+			<-ctx.Done()
+			windows.SetEvent(stop)
+		}()
+		for {
+			i, err := windows.WaitForMultipleObjects(handles, false, windows.INFINITE)
+			if err != nil {
+				certstore.LogWarnf("Stopped watching the certificate stores: %v", err)
+				return
+			}
+			n := int(i - windows.WAIT_OBJECT_0)
+			if n <= 0 || n >= len(handles) {
+				return
+			}
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+			// Each notification fires once; ask for the next
+			if err := windows.RegNotifyChangeKeyValue(windows.Handle(keys[n-1]), true, notifyFilter, handles[n], true); err != nil {
+				certstore.LogWarnf("Stopped watching HKLM\\%s: %v", paths[n-1], err)
+				return
+			}
+		}
+	}()
+	if err := <-ready; err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
@@ -0,0 +1,170 @@
+package windows
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/platform/linux"
+)
+
+// WSL operations. Certificates are applied inside every selected distro with
+// the Linux anchor layout, so corporate roots work for tools running in WSL.
+
+func (a *ApplicationStore) hasWSL() bool {
+	if _, err := exec.LookPath("wsl.exe"); err != nil {
+		return false
+	}
+	distros, err := a.wslDistros()
+	return err == nil && len(distros) > 0
+}
+
+// wslDistros returns options["distros"] (comma separated) or every installed
+// distro except Docker Desktop's internal ones
+func (a *ApplicationStore) wslDistros() ([]string, error) {
+	if configured := a.options["distros"]; configured != "" {
+		var distros []string
+		for _, d := range strings.Split(configured, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				distros = append(distros, d)
+			}
+		}
+		return distros, nil
+	}
+
+	output, err := a.runner.Run("wsl.exe", "--list", "--quiet")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WSL distributions: %w", err)
+	}
+	return parseWSLDistros(output), nil
+}
+
+// wslRun runs a shell script as root inside distro with the tooling prelude.
+// args are available to the script as $1, $2, ...
+func (a *ApplicationStore) wslRun(distro string, input []byte, script string, args ...string) ([]byte, error) {
+	cmdArgs := append([]string{"-d", distro, "-u", "root", "--", "sh", "-c", linux.AnchorScriptPrelude + script, "sh"}, args...)
+	output, err := a.runner.RunWithInput(input, "wsl.exe", cmdArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("WSL distro %s: %w", distro, err)
+	}
+	return output, nil
+}
+
+// listWSLCertificates returns the anchor certificates present in every
+// selected distro, so a distro that is missing one gets it on the next update
+func (a *ApplicationStore) listWSLCertificates() ([]*x509.Certificate, error) {
+	distros, err := a.wslDistros()
+	if err != nil {
+		return nil, err
+	}
+
+	var common []*x509.Certificate
+	for i, distro := range distros {
+		output, err := a.wslRun(distro, nil, `for f in "$dir"/*; do [ -f "$f" ] && cat "$f"; echo; done`)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := certstore.ParsePEMBundle(output)
+		if err != nil {
+			return nil, fmt.Errorf("WSL distro %s: %w", distro, err)
+		}
+
+		if i == 0 {
+			common = certs
+			continue
+		}
+		var kept []*x509.Certificate
+		for _, c := range common {
+			if certstore.ContainsCertificate(certs, c) {
+				kept = append(kept, c)
+			}
+		}
+		common = kept
+	}
+	return common, nil
+}
+
+func (a *ApplicationStore) addWSLCertificate(cert *x509.Certificate) error {
+	return a.forEachDistro("Adding certificate to", func(distro string) error {
+		_, err := a.wslRun(distro, linux.ManagedCertificatePEM(cert), `cat > "$dir/$1"; $update >/dev/null`, linux.CertificateFilename(cert))
+		return err
+	})
+}
+
+func (a *ApplicationStore) removeWSLCertificate(cert *x509.Certificate) error {
+	return a.forEachDistro("Removing certificate from", func(distro string) error {
+		_, err := a.wslRun(distro, nil, `rm -f "$dir/$1"; $update >/dev/null`, linux.CertificateFilename(cert))
+		return err
+	})
+}
+
+// backupWSL saves each distro's anchor directory as <backupPath>/<distro>.tar
+func (a *ApplicationStore) backupWSL(backupPath string) error {
+	if err := os.MkdirAll(backupPath, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return a.forEachDistro("Backing up", func(distro string) error {
+		archive, err := a.wslRun(distro, nil, `tar -C "$dir" -cf - .`)
+		if err != nil {
+			return err
+		}
+		return atomicfile.WriteFile(filepath.Join(backupPath, distro+".tar"), archive, 0600)
+	})
+}
+
+func (a *ApplicationStore) restoreWSL(backupPath string) error {
+	return a.forEachDistro("Restoring", func(distro string) error {
+		archive, err := os.ReadFile(filepath.Join(backupPath, distro+".tar"))
+		if err != nil {
+			return fmt.Errorf("no backup for WSL distro %s: %w", distro, err)
+		}
+		_, err = a.wslRun(distro, archive, `tar -C "$dir" -xf -; $update >/dev/null`)
+		return err
+	})
+}
+
+func (a *ApplicationStore) forEachDistro(action string, fn func(distro string) error) error {
+	distros, err := a.wslDistros()
+	if err != nil {
+		return err
+	}
+	for _, distro := range distros {
+		if a.verbose {
+			fmt.Printf("%s WSL distro %s\n", action, distro)
+		}
+		if err := fn(distro); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseWSLDistros decodes `wsl.exe --list --quiet` output, which is UTF-16LE
+// on most Windows builds
+func parseWSLDistros(output []byte) []string {
+	text := string(output)
+	if len(output) >= 2 && len(output)%2 == 0 && strings.ContainsRune(text, 0) {
+		units := make([]uint16, 0, len(output)/2)
+		for i := 0; i+1 < len(output); i += 2 {
+			units = append(units, uint16(output[i])|uint16(output[i+1])<<8)
+		}
+		text = string(utf16.Decode(units))
+	}
+	text = strings.TrimPrefix(text, "\ufeff")
+
+	var distros []string
+	for _, line := range strings.Split(text, "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" || strings.HasPrefix(name, "docker-desktop") {
+			continue
+		}
+		distros = append(distros, name)
+	}
+	return distros
+}
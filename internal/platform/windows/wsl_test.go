@@ -0,0 +1,22 @@
+package windows
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestParseWSLDistros(t *testing.T) {
+	var utf16le []byte
+	for _, u := range utf16.Encode([]rune("Ubuntu-22.04\r\ndocker-desktop\r\nDebian\r\n\r\n")) {
+		utf16le = append(utf16le, byte(u), byte(u>>8))
+	}
+
+	want := []string{"Ubuntu-22.04", "Debian"}
+	if got := parseWSLDistros(utf16le); !reflect.DeepEqual(got, want) {
+		t.Errorf("UTF-16 output: got %v, want %v", got, want)
+	}
+	if got := parseWSLDistros([]byte("Ubuntu-22.04\nDebian\n")); !reflect.DeepEqual(got, want) {
+		t.Errorf("UTF-8 output: got %v, want %v", got, want)
+	}
+}
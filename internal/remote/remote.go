@@ -0,0 +1,233 @@
+// Package remote runs the tool on hosts without an agent installed. For each
+// host it connects with the host's transport, detects the platform, uploads a
+// matching binary (kept between runs) and the configuration, and runs an
+// update there, collecting each host's output and outcome.
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDir is where state, backups and the uploaded binary are kept on a
+// host that doesn't set its own directory
+const DefaultDir = "/var/lib/trust-store-updater"
+
+// Transports
+const (
+	TransportSSH   = "ssh"
+	TransportWinRM = "winrm"
+)
+
+// Host is a machine to update
+type Host struct {
+	Name         string `yaml:"name,omitempty"`
+	Address      string `yaml:"address"`
+	User         string `yaml:"user,omitempty"`
+	Port         int    `yaml:"port,omitempty"`
+	IdentityFile string `yaml:"identity_file,omitempty"`
+	Transport    string `yaml:"transport,omitempty"` // "ssh" (default) or "winrm"
+	Sudo         bool   `yaml:"sudo,omitempty"`      // run the update with sudo -n
+	Dir          string `yaml:"dir,omitempty"`       // working directory; DefaultDir when empty
+
+	// WinRM hosts
+	UseSSL      bool   `yaml:"use_ssl,omitempty"`      // connect over HTTPS
+	PasswordEnv string `yaml:"password_env,omitempty"` // environment variable holding User's password
+}
+
+// Inventory lists the hosts to update and the binaries to upload to hosts
+// whose platform differs from this one's
+type Inventory struct {
+	Hosts []Host `yaml:"hosts"`
+	// Binaries maps a platform such as "linux/arm64" to a local binary
+	Binaries map[string]string `yaml:"binaries,omitempty"`
+}
+
+// ParseHost parses a host given as [user@]address[:port]
+func ParseHost(spec string) (Host, error) {
+	var h Host
+	rest := spec
+	if user, addr, ok := strings.Cut(rest, "@"); ok {
+		h.User, rest = user, addr
+	}
+	if addr, port, ok := strings.Cut(rest, ":"); ok {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return Host{}, fmt.Errorf("host %q: invalid port %q", spec, port)
+		}
+		rest, h.Port = addr, p
+	}
+	if rest == "" {
+		return Host{}, fmt.Errorf("host %q: no address", spec)
+	}
+	h.Address = rest
+	return h, nil
+}
+
+// LoadInventory reads an inventory file
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+	var inv Inventory
+	if err := yaml.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory %s: %w", path, err)
+	}
+	for i, h := range inv.Hosts {
+		if h.Address == "" {
+			return nil, fmt.Errorf("inventory %s: host %d has no address", path, i+1)
+		}
+	}
+	return &inv, nil
+}
+
+// label returns the name the host is reported under
+func (h Host) label() string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return h.Address
+}
+
+func (h Host) dir() string {
+	if h.Dir != "" {
+		return h.Dir
+	}
+	return DefaultDir
+}
+
+// Transport reaches hosts of one kind
+type Transport interface {
+	// Platform returns the host's platform as GOOS/GOARCH
+	Platform(h Host) (string, error)
+	// Install makes binary available on the host and returns its path there.
+	// checksum is the hex SHA-256 of binary: a copy from an earlier run is
+	// reused only if its contents hash to it, and the upload is checked
+	// against it before it is used.
+	Install(h Host, binary []byte, checksum string) (string, error)
+	// Run runs the installed tool with config as its configuration file and
+	// args, returning its combined output
+	Run(h Host, tool string, config []byte, args []string) ([]byte, error)
+}
+
+// Result is the outcome of updating one host
+type Result struct {
+	Host     string
+	Platform string
+	Output   string
+	Err      error
+	Duration time.Duration
+}
+
+// Runner updates hosts
+type Runner struct {
+	Transports map[string]Transport
+	// Binaries maps platforms other than this one's to local binaries
+	Binaries map[string]string
+	// Parallel bounds how many hosts are updated at once
+	Parallel int
+}
+
+// NewRunner returns a runner with the built-in transports
+func NewRunner(timeout time.Duration, verbose bool) *Runner {
+	return &Runner{
+		Transports: map[string]Transport{
+			TransportSSH:   &SSH{Timeout: timeout, Verbose: verbose},
+			TransportWinRM: &WinRM{Timeout: timeout, Verbose: verbose},
+		},
+		Parallel: 4,
+	}
+}
+
+// Run updates every host with config and args, calling done as each host
+// finishes, and returns the results in host order
+func (r *Runner) Run(hosts []Host, config []byte, args []string, done func(Result)) []Result {
+	results := make([]Result, len(hosts))
+	sem := make(chan struct{}, max(r.Parallel, 1))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h Host) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result := r.runHost(h, config, args)
+			results[i] = result
+			if done != nil {
+				mu.Lock()
+				done(result)
+				mu.Unlock()
+			}
+		}(i, h)
+	}
+	wg.Wait()
+	return results
+}
+
+func (r *Runner) runHost(h Host, config []byte, args []string) (result Result) {
+	started := time.Now()
+	result = Result{Host: h.label()}
+	defer func() { result.Duration = time.Since(started) }()
+
+	name := h.Transport
+	if name == "" {
+		name = TransportSSH
+	}
+	transport, ok := r.Transports[name]
+	if !ok {
+		result.Err = fmt.Errorf("unknown transport %q", name)
+		return result
+	}
+
+	var err error
+	if result.Platform, err = transport.Platform(h); err != nil {
+		result.Err = fmt.Errorf("failed to detect platform: %w", err)
+		return result
+	}
+	binary, err := r.binary(result.Platform)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	sum := sha256.Sum256(binary)
+	tool, err := transport.Install(h, binary, hex.EncodeToString(sum[:]))
+	if err != nil {
+		result.Err = fmt.Errorf("failed to upload the tool: %w", err)
+		return result
+	}
+	output, err := transport.Run(h, tool, config, args)
+	result.Output, result.Err = string(output), err
+	return result
+}
+
+// binary returns the tool to upload to a host of platform: this binary when
+// the platforms match, otherwise the one configured for the platform
+func (r *Runner) binary(platform string) ([]byte, error) {
+	path := r.Binaries[platform]
+	if path == "" {
+		if platform != runtime.GOOS+"/"+runtime.GOARCH {
+			return nil, fmt.Errorf("no binary for %s; add one under binaries in the inventory", platform)
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		path = exe
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read binary for %s: %w", platform, err)
+	}
+	return data, nil
+}
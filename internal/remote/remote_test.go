@@ -0,0 +1,93 @@
+package remote
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseHost(t *testing.T) {
+	h, err := ParseHost("admin@web1.example:2222")
+	if err != nil || h.User != "admin" || h.Address != "web1.example" || h.Port != 2222 {
+		t.Errorf("ParseHost = %+v, %v", h, err)
+	}
+	if h, err := ParseHost("web2"); err != nil || h.Address != "web2" || h.Port != 0 {
+		t.Errorf("ParseHost(web2) = %+v, %v", h, err)
+	}
+	for _, bad := range []string{"web1:ssh", "admin@", ""} {
+		if _, err := ParseHost(bad); err == nil {
+			t.Errorf("ParseHost(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestLoadInventory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.yaml")
+	data := `hosts:
+  - name: pi
+    address: 10.0.0.5
+    user: pi
+    sudo: true
+binaries:
+  linux/arm64: ./dist/trust-store-updater-linux-arm64
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inv, err := LoadInventory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Hosts) != 1 || !inv.Hosts[0].Sudo || inv.Hosts[0].dir() != DefaultDir || inv.Binaries["linux/arm64"] == "" {
+		t.Errorf("inventory = %+v", inv)
+	}
+}
+
+// fakeTransport records what the runner asks of each host
+type fakeTransport struct {
+	platforms map[string]string
+	installed map[string]string
+}
+
+func (f *fakeTransport) Platform(h Host) (string, error) {
+	if p, ok := f.platforms[h.Address]; ok {
+		return p, nil
+	}
+	return "", fmt.Errorf("connection refused")
+}
+
+func (f *fakeTransport) Install(h Host, binary []byte, checksum string) (string, error) {
+	f.installed[h.Address] = checksum
+	return "/opt/tsu-" + checksum, nil
+}
+
+func (f *fakeTransport) Run(h Host, tool string, config []byte, args []string) ([]byte, error) {
+	return []byte(fmt.Sprintf("%s %s with %s\n", tool, strings.Join(args, " "), config)), nil
+}
+
+func TestRunnerRun(t *testing.T) {
+	local := runtime.GOOS + "/" + runtime.GOARCH
+	transport := &fakeTransport{
+		platforms: map[string]string{"a": local, "b": "plan9/mips"},
+		installed: make(map[string]string),
+	}
+	r := &Runner{Transports: map[string]Transport{TransportSSH: transport}, Parallel: 2}
+
+	var done int
+	results := r.Run([]Host{{Address: "a"}, {Address: "b"}, {Address: "c"}}, []byte("cfg"), []string{"update", "--dry-run"}, func(Result) { done++ })
+	if done != 3 || len(results) != 3 {
+		t.Fatalf("done = %d, results = %d", done, len(results))
+	}
+	if results[0].Err != nil || !strings.Contains(results[0].Output, "update --dry-run with cfg") || transport.installed["a"] == "" {
+		t.Errorf("host a: %+v", results[0])
+	}
+	if results[1].Err == nil || !strings.Contains(results[1].Err.Error(), "no binary for plan9/mips") {
+		t.Errorf("host b: expected a missing binary error, got %v", results[1].Err)
+	}
+	if results[2].Err == nil || results[2].Platform != "" {
+		t.Errorf("host c: expected a connection error, got %+v", results[2])
+	}
+}
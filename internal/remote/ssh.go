@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// SSH reaches Linux and macOS hosts with the ssh client, running each step as
+// a sh script. Hosts with sudo set run their scripts with sudo -n.
+type SSH struct {
+	// Command replaces the ssh client, e.g. with a wrapper
+	Command string
+	Timeout time.Duration
+	Verbose bool
+}
+
+// unameOS and unameArch map uname -s and uname -m to Go platform names
+var (
+	unameOS   = map[string]string{"Linux": "linux", "Darwin": "darwin", "FreeBSD": "freebsd"}
+	unameArch = map[string]string{
+		"x86_64": "amd64", "amd64": "amd64", "aarch64": "arm64", "arm64": "arm64",
+		"armv7l": "arm", "armv6l": "arm", "i686": "386", "i386": "386",
+	}
+)
+
+// run runs script with sh on the host. args are available to the script as
+// $1, $2, ...
+func (s *SSH) run(h Host, input []byte, script string, args ...string) ([]byte, error) {
+	remote := []string{"sh", "-c", certstore.ShellQuote("set -e\n" + script), "sh"}
+	if h.Sudo {
+		remote = append([]string{"sudo", "-n"}, remote...)
+	}
+	for _, arg := range args {
+		remote = append(remote, certstore.ShellQuote(arg))
+	}
+
+	sshArgs := []string{"-o", "BatchMode=yes"}
+	if h.Port != 0 {
+		sshArgs = append(sshArgs, "-p", strconv.Itoa(h.Port))
+	}
+	if h.IdentityFile != "" {
+		sshArgs = append(sshArgs, "-i", h.IdentityFile)
+	}
+	dest := h.Address
+	if h.User != "" {
+		dest = h.User + "@" + h.Address
+	}
+	sshArgs = append(sshArgs, dest, strings.Join(remote, " "))
+
+	command := s.Command
+	if command == "" {
+		command = "ssh"
+	}
+	runner := certstore.CommandRunner{Timeout: s.Timeout, Verbose: s.Verbose}
+	output, err := runner.RunWithInput(input, command, sshArgs...)
+	// The script makes the command line unreadable; report what failed
+	var cmdErr *certstore.CommandError
+	if errors.As(err, &cmdErr) {
+		err = fmt.Errorf("ssh %s: %w", dest, cmdErr.Err)
+		if stderr := strings.TrimSpace(cmdErr.Stderr); stderr != "" {
+			err = fmt.Errorf("%w: %s", err, strings.Join(strings.Fields(stderr), " "))
+		}
+	}
+	return output, err
+}
+
+// Platform runs uname on the host
+func (s *SSH) Platform(h Host) (string, error) {
+	output, err := s.run(h, nil, "uname -s; uname -m")
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unexpected uname output %q", strings.TrimSpace(string(output)))
+	}
+	goos, goarch := unameOS[fields[0]], unameArch[fields[1]]
+	if goos == "" || goarch == "" {
+		return "", fmt.Errorf("unsupported platform %s %s", fields[0], fields[1])
+	}
+	return goos + "/" + goarch, nil
+}
+
+// sha256Func defines sha256, which prints the hex SHA-256 of its input with
+// sha256sum, or shasum on macOS
+const sha256Func = `sha256() { if command -v sha256sum >/dev/null 2>&1; then sha256sum; else shasum -a 256; fi | cut -d' ' -f1; }
+`
+
+// Install uploads binary to <dir>/bin unless the same build is already
+// there, removing earlier builds. A copy is only reused when its hash
+// matches, and an upload is checked before it replaces anything.
+func (s *SSH) Install(h Host, binary []byte, checksum string) (string, error) {
+	bin := path.Join(h.dir(), "bin")
+	tool := path.Join(bin, "trust-store-updater-"+checksum[:12])
+	output, err := s.run(h, nil, sha256Func+`if [ -x "$1" ] && [ "$(sha256 < "$1")" = "$2" ]; then echo present; fi`, tool, checksum)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(string(output)) == "present" {
+		return tool, nil
+	}
+	_, err = s.run(h, binary, sha256Func+`mkdir -p "$1"; upload="$1/.upload.$$"; cat > "$upload"
+if [ "$(sha256 < "$upload")" != "$3" ]; then rm -f "$upload"; echo "checksum mismatch after upload" >&2; exit 1; fi
+rm -f "$1"/trust-store-updater-*; chmod 755 "$upload"; mv "$upload" "$2"`, bin, tool, checksum)
+	return tool, err
+}
+
+// Run writes config next to the host's state and runs the tool from its
+// directory, so relative paths such as ./backups stay on the host between
+// runs. The configuration is removed afterwards; it may hold secrets.
+func (s *SSH) Run(h Host, tool string, config []byte, args []string) ([]byte, error) {
+	script := `dir=$1; tool=$2; shift 2
+mkdir -p "$dir"; cd "$dir"
+cfg="$dir/.remote-config.$$.yaml"
+trap 'rm -f "$cfg"' EXIT
+(umask 077; cat > "$cfg")
+exec 2>&1
+"$tool" --config "$cfg" "$@"`
+	return s.run(h, config, script, append([]string{h.dir(), tool}, args...)...)
+}
@@ -0,0 +1,79 @@
+//go:build unix
+
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSHInstallAndRun(t *testing.T) {
+	// An ssh stand-in that runs the remote command locally
+	fakeSSH := filepath.Join(t.TempDir(), "ssh")
+	if err := os.WriteFile(fakeSSH, []byte("#!/bin/sh\nfor arg; do remote=$arg; done\nexec sh -c \"$remote\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s := &SSH{Command: fakeSSH}
+	h := Host{Address: "web1", Dir: t.TempDir()}
+
+	if _, err := s.Platform(h); err != nil && !strings.Contains(err.Error(), "unsupported platform") {
+		t.Fatalf("Platform: %v", err)
+	}
+
+	tool := []byte("#!/bin/sh\necho \"config $2: $(cat \"$2\")\"\necho \"args $3 $4\"\n")
+	sum := sha256.Sum256(tool)
+	checksum := hex.EncodeToString(sum[:])
+	path, err := s.Install(h, tool, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != filepath.Join(h.Dir, "bin") {
+		t.Errorf("installed at %s", path)
+	}
+	// A second install of the same build keeps the existing copy
+	if err := os.Chmod(filepath.Dir(path), 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Dir(path), 0755)
+	if _, err := s.Install(h, tool, checksum); err != nil {
+		t.Errorf("reinstall of the same build: %v", err)
+	}
+	if err := os.Chmod(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy whose contents don't match its name is replaced
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho tampered\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Install(h, tool, checksum); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(tool) {
+		t.Errorf("tampered copy kept: %q", data)
+	}
+
+	// An upload that doesn't match the checksum is not installed
+	other := strings.Repeat("0", 64)
+	if _, err := s.Install(h, tool, other); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("install with a wrong checksum: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(h.Dir, "bin", "trust-store-updater-"+other[:12])); !os.IsNotExist(err) {
+		t.Errorf("mismatched upload installed: %v", err)
+	}
+
+	output, err := s.Run(h, path, []byte("trust_stores: []"), []string{"update", "--dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "trust_stores: []") || !strings.Contains(string(output), "args update --dry-run") {
+		t.Errorf("output = %q", output)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(h.Dir, ".remote-config.*")); len(leftovers) != 0 {
+		t.Errorf("configuration left on the host: %v", leftovers)
+	}
+}
@@ -0,0 +1,229 @@
+package remote
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// DefaultWindowsDir is DefaultDir on Windows hosts
+const DefaultWindowsDir = `C:\ProgramData\trust-store-updater`
+
+// WinRM reaches Windows hosts through PowerShell remoting (WinRM) from this
+// machine's PowerShell: powershell.exe on Windows, pwsh elsewhere. Sessions
+// authenticate as the current user (Kerberos in a domain) unless the host
+// sets a user, whose password is read from the environment variable named
+// by password_env.
+type WinRM struct {
+	// Command replaces the PowerShell executable
+	Command string
+	Timeout time.Duration
+	Verbose bool
+}
+
+// windowsArch maps PROCESSOR_ARCHITECTURE to Go architecture names
+var windowsArch = map[string]string{"AMD64": "amd64", "ARM64": "arm64", "x86": "386"}
+
+// envName matches the environment variable names put into scripts
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (w *WinRM) dir(h Host) string {
+	if h.Dir != "" {
+		return h.Dir
+	}
+	return DefaultWindowsDir
+}
+
+// session returns PowerShell that opens the remote session as $s
+func (w *WinRM) session(h Host) (string, error) {
+	var b strings.Builder
+	b.WriteString("$ErrorActionPreference = 'Stop'\n")
+	b.WriteString("$opts = @{ ComputerName = " + psQuote(h.Address))
+	if h.Port != 0 {
+		b.WriteString("; Port = " + strconv.Itoa(h.Port))
+	}
+	if h.UseSSL {
+		b.WriteString("; UseSSL = $true")
+	}
+	b.WriteString(" }\n")
+	if h.User != "" {
+		if h.PasswordEnv == "" {
+			return "", fmt.Errorf("host %s: a user needs password_env", h.label())
+		}
+		if !envName.MatchString(h.PasswordEnv) {
+			return "", fmt.Errorf("host %s: invalid password_env %q", h.label(), h.PasswordEnv)
+		}
+		if os.Getenv(h.PasswordEnv) == "" {
+			return "", fmt.Errorf("host %s: %s is not set", h.label(), h.PasswordEnv)
+		}
+		b.WriteString("$password = ConvertTo-SecureString $env:" + h.PasswordEnv + " -AsPlainText -Force\n")
+		b.WriteString("$opts.Credential = New-Object System.Management.Automation.PSCredential(" + psQuote(h.User) + ", $password)\n")
+	}
+	b.WriteString("$s = New-PSSession @opts\n")
+	return b.String(), nil
+}
+
+// run runs script with the remote session open as $s, closing it afterwards
+func (w *WinRM) run(h Host, script string) ([]byte, error) {
+	open, err := w.session(h)
+	if err != nil {
+		return nil, err
+	}
+	full := open + "try {\n" + script + "\n} finally { Remove-PSSession $s }\n"
+
+	command := w.Command
+	if command == "" {
+		command = "pwsh"
+		if runtime.GOOS == "windows" {
+			command = "powershell.exe"
+		}
+	}
+	runner := certstore.CommandRunner{Timeout: w.Timeout, Verbose: w.Verbose}
+	output, err := runner.Run(command, "-NoProfile", "-NonInteractive", "-EncodedCommand", encodeCommand(full))
+	// The encoded script makes the command line unreadable; report what failed
+	var cmdErr *certstore.CommandError
+	if errors.As(err, &cmdErr) {
+		err = fmt.Errorf("winrm %s: %w", h.Address, cmdErr.Err)
+		if stderr := strings.TrimSpace(cmdErr.Stderr); stderr != "" {
+			err = fmt.Errorf("%w: %s", err, strings.Join(strings.Fields(stderr), " "))
+		}
+	}
+	return output, err
+}
+
+// Platform reads the host's processor architecture
+func (w *WinRM) Platform(h Host) (string, error) {
+	output, err := w.run(h, "Invoke-Command -Session $s { $env:PROCESSOR_ARCHITECTURE }")
+	if err != nil {
+		return "", err
+	}
+	arch := windowsArch[strings.TrimSpace(string(output))]
+	if arch == "" {
+		return "", fmt.Errorf("unsupported processor architecture %q", strings.TrimSpace(string(output)))
+	}
+	return "windows/" + arch, nil
+}
+
+// protectDirScript creates the directory $d, readable only by SYSTEM and
+// Administrators: the configuration copied there may hold secrets and the
+// binaries there run as an administrator. Inherited permissions are removed,
+// so a directory created under a looser parent doesn't keep them.
+const protectDirScript = `if (-not (Test-Path -LiteralPath $d)) { New-Item -ItemType Directory -Path $d | Out-Null }
+  $acl = New-Object System.Security.AccessControl.DirectorySecurity
+  $acl.SetAccessRuleProtection($true, $false)
+  foreach ($sid in 'S-1-5-18', 'S-1-5-32-544') {
+    $id = New-Object System.Security.Principal.SecurityIdentifier($sid)
+    $acl.AddAccessRule((New-Object System.Security.AccessControl.FileSystemAccessRule($id, 'FullControl', 'ContainerInherit,ObjectInherit', 'None', 'Allow')))
+  }
+  $acl.SetOwner((New-Object System.Security.Principal.SecurityIdentifier('S-1-5-32-544')))
+  Set-Acl -LiteralPath $d -AclObject $acl`
+
+// Install copies binary to <dir>\bin unless the same build is already
+// there, removing earlier builds. A copy is only reused when its hash
+// matches, and an upload is checked before it is used.
+func (w *WinRM) Install(h Host, binary []byte, checksum string) (string, error) {
+	dir := w.dir(h)
+	bin := dir + `\bin`
+	tool := bin + `\trust-store-updater-` + checksum[:12] + ".exe"
+	upload := bin + `\.upload.exe`
+	local, cleanup, err := tempFile(binary)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	_, err = w.run(h, fmt.Sprintf(`$present = Invoke-Command -Session $s {
+  param($d, $b, $t, $sum)
+  %s
+  New-Item -ItemType Directory -Force -Path $b | Out-Null
+  (Test-Path -LiteralPath $t) -and ((Get-FileHash -Algorithm SHA256 -LiteralPath $t).Hash -eq $sum)
+} -ArgumentList %s, %s, %s, %s
+if (-not $present) {
+  Copy-Item -ToSession $s -LiteralPath %s -Destination %s -Force
+  Invoke-Command -Session $s {
+    param($b, $u, $t, $sum)
+    if ((Get-FileHash -Algorithm SHA256 -LiteralPath $u).Hash -ne $sum) {
+      Remove-Item -LiteralPath $u -Force
+      throw "checksum mismatch after upload of $t"
+    }
+    Remove-Item -Path "$b\trust-store-updater-*" -Force -ErrorAction SilentlyContinue
+    Move-Item -LiteralPath $u -Destination $t
+  } -ArgumentList %s, %s, %s, %s
+}`, protectDirScript, psQuote(dir), psQuote(bin), psQuote(tool), psQuote(checksum),
+		psQuote(local), psQuote(upload), psQuote(bin), psQuote(upload), psQuote(tool), psQuote(checksum)))
+	return tool, err
+}
+
+// Run copies config next to the host's state and runs the tool from its
+// directory, so relative paths such as ./backups stay on the host between
+// runs. The configuration is removed afterwards; it may hold secrets.
+func (w *WinRM) Run(h Host, tool string, config []byte, args []string) ([]byte, error) {
+	local, cleanup, err := tempFile(config)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	dir := w.dir(h)
+	cfg := fmt.Sprintf(`%s\.remote-config-%d.yaml`, dir, time.Now().UnixNano())
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = psQuote(arg)
+	}
+	return w.run(h, fmt.Sprintf(`Invoke-Command -Session $s { param($d) New-Item -ItemType Directory -Force -Path $d | Out-Null } -ArgumentList %s
+Copy-Item -ToSession $s -LiteralPath %s -Destination %s
+Invoke-Command -Session $s {
+  param($d, $tool, $cfg, $toolArgs)
+  Set-Location -LiteralPath $d
+  try {
+    & $tool --config $cfg @toolArgs 2>&1 | ForEach-Object { "$_" }
+    if ($LASTEXITCODE -ne 0) { throw "trust-store-updater exited with $LASTEXITCODE" }
+  } finally {
+    Remove-Item -LiteralPath $cfg -Force -ErrorAction SilentlyContinue
+  }
+} -ArgumentList %s, %s, %s, @(%s)`,
+		psQuote(dir), psQuote(local), psQuote(cfg), psQuote(dir), psQuote(tool), psQuote(cfg), strings.Join(quoted, ", ")))
+}
+
+// tempFile writes data to a private local file for Copy-Item
+func tempFile(data []byte) (string, func(), error) {
+	f, err := os.CreateTemp("", "trust-store-updater-remote-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, err
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return f.Name(), cleanup, nil
+}
+
+// psQuote quotes s as a PowerShell single quoted string
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// encodeCommand encodes a script for powershell -EncodedCommand
+func encodeCommand(script string) string {
+	units := utf16.Encode([]rune(script))
+	b := make([]byte, 0, len(units)*2)
+	for _, u := range units {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
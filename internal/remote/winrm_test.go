@@ -0,0 +1,109 @@
+//go:build unix
+
+package remote
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// decodeCommand reverses encodeCommand
+func decodeCommand(t *testing.T, encoded string) string {
+	t.Helper()
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+	}
+	return string(utf16.Decode(units))
+}
+
+func TestWinRMPlatform(t *testing.T) {
+	// A PowerShell stand-in that records the script and answers for the host
+	dir := t.TempDir()
+	fakePwsh := filepath.Join(dir, "pwsh")
+	script := "#!/bin/sh\nfor arg; do last=$arg; done\necho \"$last\" > " + filepath.Join(dir, "script") + "\necho ARM64\n"
+	if err := os.WriteFile(fakePwsh, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	w := &WinRM{Command: fakePwsh}
+	t.Setenv("TSU_WINRM_PASSWORD", "secret")
+	h := Host{Address: "win1", Port: 5986, UseSSL: true, User: `CORP\svc'ca`, PasswordEnv: "TSU_WINRM_PASSWORD"}
+
+	platform, err := w.Platform(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if platform != "windows/arm64" {
+		t.Errorf("platform = %s", platform)
+	}
+
+	encoded, err := os.ReadFile(filepath.Join(dir, "script"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := decodeCommand(t, strings.TrimSpace(string(encoded)))
+	for _, want := range []string{"ComputerName = 'win1'", "Port = 5986", "UseSSL = $true", `'CORP\svc''ca'`, "$env:TSU_WINRM_PASSWORD", "Remove-PSSession $s"} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("script is missing %q:\n%s", want, sent)
+		}
+	}
+	if strings.Contains(sent, "secret") {
+		t.Error("the password is on the command line")
+	}
+}
+
+func TestWinRMInstall(t *testing.T) {
+	dir := t.TempDir()
+	fakePwsh := filepath.Join(dir, "pwsh")
+	script := "#!/bin/sh\nfor arg; do last=$arg; done\necho \"$last\" > " + filepath.Join(dir, "script") + "\n"
+	if err := os.WriteFile(fakePwsh, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	w := &WinRM{Command: fakePwsh}
+	checksum := strings.Repeat("ab", 32)
+
+	tool, err := w.Install(Host{Address: "win1"}, []byte("binary"), checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool != DefaultWindowsDir+`\bin\trust-store-updater-abababababab.exe` {
+		t.Errorf("tool = %s", tool)
+	}
+
+	encoded, err := os.ReadFile(filepath.Join(dir, "script"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := decodeCommand(t, strings.TrimSpace(string(encoded)))
+	for _, want := range []string{
+		// The directory is limited to SYSTEM and Administrators, without inheritance
+		"SetAccessRuleProtection($true, $false)", "'S-1-5-18', 'S-1-5-32-544'", "Set-Acl -LiteralPath $d",
+		// An existing copy and the upload are both checked against the full hash
+		"(Get-FileHash -Algorithm SHA256 -LiteralPath $t).Hash -eq $sum",
+		"(Get-FileHash -Algorithm SHA256 -LiteralPath $u).Hash -ne $sum",
+		"'" + checksum + "'",
+	} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("install script is missing %q:\n%s", want, sent)
+		}
+	}
+}
+
+func TestWinRMCredentials(t *testing.T) {
+	w := &WinRM{Command: "/nonexistent"}
+	if _, err := w.Platform(Host{Address: "win1", User: "admin"}); err == nil || !strings.Contains(err.Error(), "password_env") {
+		t.Errorf("user without password_env: %v", err)
+	}
+	t.Setenv("TSU_WINRM_UNSET", "")
+	if _, err := w.Platform(Host{Address: "win1", User: "admin", PasswordEnv: "TSU_WINRM_UNSET"}); err == nil || !strings.Contains(err.Error(), "not set") {
+		t.Errorf("unset password: %v", err)
+	}
+}
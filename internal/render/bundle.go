@@ -0,0 +1,28 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// BundleFilename is the file written by Bundle
+const BundleFilename = "ca-bundle.pem"
+
+// Bundle writes the trust set as a single annotated PEM bundle. Each
+// certificate is preceded by a comment header and the order is stable, so the
+// file can be committed and reviewed as a diff.
+func Bundle(entries []certstore.BundleEntry, outputDir string) ([]string, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", outputDir, err)
+	}
+
+	path := filepath.Join(outputDir, BundleFilename)
+	if err := atomicfile.WriteFile(path, certstore.EncodeAnnotatedBundle(entries), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return []string{path}, nil
+}
@@ -0,0 +1,51 @@
+package render
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestBundleIsOrderedAndAnnotated(t *testing.T) {
+	zulu := certstoretest.NewCertificate(t, "Zulu Root")
+	alpha := certstoretest.NewCertificate(t, "Alpha Root")
+
+	dir := t.TempDir()
+	files, err := Bundle([]certstore.BundleEntry{
+		{Certificate: zulu, Source: "corp"},
+		{Certificate: alpha, Source: "mozilla"},
+	}, dir)
+	if err != nil {
+		t.Fatalf("Bundle: %v", err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := string(data)
+	if strings.Index(text, "CN=Alpha Root") > strings.Index(text, "CN=Zulu Root") {
+		t.Error("bundle is not ordered by subject")
+	}
+	if !strings.Contains(text, "# Source: mozilla\n") || !strings.Contains(text, "# SHA256 Fingerprint: ") {
+		t.Errorf("missing headers:\n%s", text)
+	}
+
+	certs, err := certstore.ParsePEMBundle(data)
+	if err != nil || len(certs) != 2 || !certs[0].Equal(alpha) {
+		t.Errorf("annotated bundle did not round-trip: %d certs, %v", len(certs), err)
+	}
+
+	// Input order must not affect the output
+	again := t.TempDir()
+	if _, err := Bundle([]certstore.BundleEntry{{Certificate: alpha, Source: "mozilla"}, {Certificate: zulu, Source: "corp"}}, again); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := os.ReadFile(again + "/" + BundleFilename); !bytes.Equal(data, other) {
+		t.Error("output depends on input order")
+	}
+}
@@ -0,0 +1,70 @@
+package render
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// Docker base image families and where their CA tooling expects anchors
+var dockerDistros = map[string]struct {
+	anchorDir string
+	update    string
+}{
+	"debian": {"/usr/local/share/ca-certificates/trust-store-updater/", "update-ca-certificates"},
+	"alpine": {"/usr/local/share/ca-certificates/trust-store-updater/", "update-ca-certificates"},
+	"rhel":   {"/etc/pki/ca-trust/source/anchors/", "update-ca-trust extract"},
+}
+
+// DockerBuild writes a build context fragment for baking certs into an image:
+// a certs/ directory with one PEM file per certificate and a Dockerfile
+// snippet that copies them in and refreshes the image's trust store. Output
+// depends only on the certificate set, so identical inputs produce identical
+// image layers.
+func DockerBuild(certs []*x509.Certificate, outputDir, distro string) ([]string, error) {
+	layout, ok := dockerDistros[distro]
+	if !ok {
+		return nil, fmt.Errorf("unsupported docker base distro %q (expected debian, alpine or rhel)", distro)
+	}
+
+	certDir := filepath.Join(outputDir, "certs")
+	// Start from an empty directory so certificates dropped from the set don't linger
+	if err := os.RemoveAll(certDir); err != nil {
+		return nil, fmt.Errorf("failed to clean %s: %w", certDir, err)
+	}
+	if err := os.MkdirAll(certDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", certDir, err)
+	}
+
+	var files []string
+	for _, c := range certs {
+		name := "tsu-" + cert.GetCertificateFingerprint(c)[:16] + ".crt"
+		path := filepath.Join(certDir, name)
+		if err := atomicfile.WriteFile(path, certstore.EncodePEMBundle([]*x509.Certificate{c}), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	snippet := strings.Join([]string{
+		"# Generated by trust-store-updater render --target docker-build",
+		fmt.Sprintf("# %d certificates; regenerate rather than editing", len(certs)),
+		"COPY certs/ " + layout.anchorDir,
+		"RUN " + layout.update,
+		"",
+	}, "\n")
+	snippetPath := filepath.Join(outputDir, "Dockerfile.snippet")
+	if err := atomicfile.WriteFile(snippetPath, []byte(snippet), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", snippetPath, err)
+	}
+
+	return append(files, snippetPath), nil
+}
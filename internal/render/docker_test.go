@@ -0,0 +1,46 @@
+package render
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestDockerBuild(t *testing.T) {
+	dir := t.TempDir()
+	certs := []*x509.Certificate{certstoretest.NewCertificate(t, "Root A"), certstoretest.NewCertificate(t, "Root B")}
+
+	// A stale file from a previous render must be removed
+	if err := os.MkdirAll(filepath.Join(dir, "certs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "certs", "stale.crt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DockerBuild(certs, dir, "rhel"); err != nil {
+		t.Fatalf("DockerBuild: %v", err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(dir, "certs"))
+	if len(entries) != 2 {
+		t.Errorf("expected 2 certificate files, got %d", len(entries))
+	}
+
+	snippet, err := os.ReadFile(filepath.Join(dir, "Dockerfile.snippet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(snippet), "COPY certs/ /etc/pki/ca-trust/source/anchors/") ||
+		!strings.Contains(string(snippet), "RUN update-ca-trust extract") {
+		t.Errorf("unexpected snippet:\n%s", snippet)
+	}
+
+	if _, err := DockerBuild(certs, dir, "windows"); err == nil {
+		t.Error("expected error for unsupported distro")
+	}
+}
@@ -0,0 +1,150 @@
+package render
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+)
+
+// Files written by GPO
+const (
+	RegistryPolFilename = "Registry.pol"
+	DSCFilename         = "TrustStoreUpdaterRoots.ps1"
+)
+
+// regBinary is the REG_BINARY value type
+const regBinary = 3
+
+// Serialized certificate store element property IDs (wincrypt.h)
+const (
+	certSHA1HashPropID = 3
+	certCertPropID     = 32
+)
+
+// gpoCertificate is a certificate with the Windows store it belongs in
+type gpoCertificate struct {
+	cert       *x509.Certificate
+	thumbprint string // upper-case SHA-1, as Windows names certificates
+	store      string // "Root" or "CA"
+}
+
+// GPO writes the trust set for distribution to Windows machines without an
+// agent: a Registry.pol to place in a Group Policy object's Machine folder,
+// and a PowerShell DSC configuration using the CertificateDsc module. Both put
+// self-signed roots in the Root store and intermediates in the CA store, and
+// list certificates in thumbprint order so output is reproducible.
+func GPO(certs []*x509.Certificate, outputDir string) ([]string, error) {
+	entries := make([]gpoCertificate, 0, len(certs))
+	for _, c := range certs {
+		sum := sha1.Sum(c.Raw)
+		store := "CA"
+		if isSelfSigned(c) {
+			store = "Root"
+		}
+		entries = append(entries, gpoCertificate{cert: c, thumbprint: fmt.Sprintf("%X", sum), store: store})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].thumbprint < entries[j].thumbprint })
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", outputDir, err)
+	}
+
+	polPath := filepath.Join(outputDir, RegistryPolFilename)
+	if err := atomicfile.WriteFile(polPath, registryPol(entries), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", polPath, err)
+	}
+	dscPath := filepath.Join(outputDir, DSCFilename)
+	if err := atomicfile.WriteFile(dscPath, []byte(dscConfiguration(entries)), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", dscPath, err)
+	}
+	return []string{polPath, dscPath}, nil
+}
+
+// registryPol encodes the policy file read by the Group Policy registry
+// extension: a PReg header followed by [key;value;type;size;data] records
+func registryPol(entries []gpoCertificate) []byte {
+	var b bytes.Buffer
+	b.WriteString("PReg")
+	_ = binary.Write(&b, binary.LittleEndian, uint32(1))
+
+	for _, e := range entries {
+		key := `Software\Policies\Microsoft\SystemCertificates\` + e.store + `\Certificates\` + e.thumbprint
+		blob := certificateBlob(e.cert)
+
+		writeUTF16(&b, "[")
+		writeUTF16(&b, key+"\x00")
+		writeUTF16(&b, ";")
+		writeUTF16(&b, "Blob\x00")
+		writeUTF16(&b, ";")
+		_ = binary.Write(&b, binary.LittleEndian, uint32(regBinary))
+		writeUTF16(&b, ";")
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(blob)))
+		writeUTF16(&b, ";")
+		b.Write(blob)
+		writeUTF16(&b, "]")
+	}
+	return b.Bytes()
+}
+
+// certificateBlob serializes a certificate as a store element, the format of
+// the Blob value Windows reads certificates from
+func certificateBlob(c *x509.Certificate) []byte {
+	sum := sha1.Sum(c.Raw)
+
+	var b bytes.Buffer
+	for _, prop := range []struct {
+		id   uint32
+		data []byte
+	}{
+		{certSHA1HashPropID, sum[:]},
+		{certCertPropID, c.Raw},
+	} {
+		_ = binary.Write(&b, binary.LittleEndian, prop.id)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(1)) // reserved
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(prop.data)))
+		b.Write(prop.data)
+	}
+	return b.Bytes()
+}
+
+func writeUTF16(b *bytes.Buffer, s string) {
+	for _, u := range utf16.Encode([]rune(s)) {
+		_ = binary.Write(b, binary.LittleEndian, u)
+	}
+}
+
+// dscConfiguration renders a DSC configuration with one CertificateImport
+// resource per certificate, each carrying the certificate inline
+func dscConfiguration(entries []gpoCertificate) string {
+	var b strings.Builder
+	b.WriteString("# Generated by trust-store-updater render --target gpo\n")
+	fmt.Fprintf(&b, "# %d certificates; regenerate rather than editing\n", len(entries))
+	b.WriteString(`Configuration TrustStoreUpdaterRoots
+{
+    Import-DscResource -ModuleName CertificateDsc
+
+    Node 'localhost'
+    {
+`)
+	for _, e := range entries {
+		fmt.Fprintf(&b, "        # %s\n", strings.ReplaceAll(displayName(e.cert), "\n", " "))
+		fmt.Fprintf(&b, "        CertificateImport '%s'\n        {\n", e.thumbprint)
+		fmt.Fprintf(&b, "            Thumbprint = '%s'\n", e.thumbprint)
+		b.WriteString("            Location   = 'LocalMachine'\n")
+		fmt.Fprintf(&b, "            Store      = '%s'\n", e.store)
+		fmt.Fprintf(&b, "            Content    = '%s'\n", base64.StdEncoding.EncodeToString(e.cert.Raw))
+		b.WriteString("            Ensure     = 'Present'\n        }\n\n")
+	}
+	b.WriteString("    }\n}\n")
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func utf16Bytes(s string) []byte {
+	var b bytes.Buffer
+	for _, u := range utf16.Encode([]rune(s)) {
+		_ = binary.Write(&b, binary.LittleEndian, u)
+	}
+	return b.Bytes()
+}
+
+func TestGPO(t *testing.T) {
+	root := certstoretest.NewCertificate(t, "Example Root")
+	thumbprint := fmt.Sprintf("%X", sha1.Sum(root.Raw))
+
+	files, err := GPO([]*x509.Certificate{root}, t.TempDir())
+	if err != nil {
+		t.Fatalf("GPO: %v", err)
+	}
+
+	pol, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pol, []byte("PReg\x01\x00\x00\x00")) {
+		t.Fatalf("missing Registry.pol header: %x", pol[:8])
+	}
+	key := `Software\Policies\Microsoft\SystemCertificates\Root\Certificates\` + thumbprint
+	if !bytes.Contains(pol, utf16Bytes("["+key+"\x00;Blob\x00;")) {
+		t.Error("Registry.pol has no Blob value for the root certificate")
+	}
+	blob := certificateBlob(root)
+	if !bytes.Contains(pol, blob) || !bytes.HasSuffix(pol, append(blob, utf16Bytes("]")...)) {
+		t.Error("Registry.pol does not end with the certificate blob record")
+	}
+	if !bytes.HasSuffix(blob, root.Raw) {
+		t.Error("blob does not end with the certificate property")
+	}
+
+	dsc, err := os.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"CertificateImport '" + thumbprint + "'", "Store      = 'Root'", "Import-DscResource -ModuleName CertificateDsc"} {
+		if !strings.Contains(string(dsc), want) {
+			t.Errorf("DSC configuration missing %q", want)
+		}
+	}
+}
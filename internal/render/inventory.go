@@ -0,0 +1,107 @@
+package render
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"gopkg.in/yaml.v3"
+)
+
+// InventoryVariable is the top-level variable holding the certificate list,
+// named to be usable directly as an Ansible/Puppet/Chef variable
+const InventoryVariable = "trust_store_updater_certificates"
+
+// InventoryCertificate describes one managed certificate for config-management tools
+type InventoryCertificate struct {
+	Name       string `json:"name" yaml:"name"`
+	Filename   string `json:"filename" yaml:"filename"`
+	Subject    string `json:"subject" yaml:"subject"`
+	Issuer     string `json:"issuer" yaml:"issuer"`
+	Serial     string `json:"serial" yaml:"serial"`
+	SHA256     string `json:"sha256" yaml:"sha256"`
+	SHA1       string `json:"sha1" yaml:"sha1"`
+	NotBefore  string `json:"not_before" yaml:"not_before"`
+	NotAfter   string `json:"not_after" yaml:"not_after"`
+	SelfSigned bool   `json:"self_signed" yaml:"self_signed"`
+	Source     string `json:"source,omitempty" yaml:"source,omitempty"`
+	PEM        string `json:"pem" yaml:"pem"`
+}
+
+// Inventory writes the trust set as a variables file (format "yaml" or
+// "json") so config-management pipelines can install certificates themselves
+// while this tool only decides what to trust. Certificates are ordered by
+// subject, then fingerprint, so regenerated files diff cleanly.
+func Inventory(entries []certstore.BundleEntry, outputDir, format string) ([]string, error) {
+	sorted := append([]certstore.BundleEntry(nil), entries...)
+	certstore.SortBundleEntries(sorted)
+
+	certs := make([]InventoryCertificate, 0, len(sorted))
+	for _, e := range sorted {
+		certs = append(certs, inventoryCertificate(e))
+	}
+	vars := map[string][]InventoryCertificate{InventoryVariable: certs}
+
+	var data []byte
+	var err error
+	switch format {
+	case "yaml":
+		var buf bytes.Buffer
+		buf.WriteString("# Generated by trust-store-updater render --target inventory; regenerate rather than editing\n")
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(vars)
+		data = buf.Bytes()
+	case "json":
+		data, err = json.MarshalIndent(vars, "", "  ")
+		data = append(data, '\n')
+	default:
+		return nil, fmt.Errorf("unsupported inventory format %q (expected yaml or json)", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode inventory: %w", err)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", outputDir, err)
+	}
+	path := filepath.Join(outputDir, "trust-store-certificates."+format)
+	if err := atomicfile.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return []string{path}, nil
+}
+
+func inventoryCertificate(e certstore.BundleEntry) InventoryCertificate {
+	c := e.Certificate
+	fingerprint := cert.GetCertificateFingerprint(c)
+	sha1Sum := sha1.Sum(c.Raw)
+
+	name := e.Label
+	if name == "" {
+		name = displayName(c)
+	}
+	return InventoryCertificate{
+		Name:       name,
+		Filename:   "tsu-" + fingerprint[:16] + ".crt",
+		Subject:    c.Subject.String(),
+		Issuer:     c.Issuer.String(),
+		Serial:     c.SerialNumber.Text(16),
+		SHA256:     fingerprint,
+		SHA1:       hex.EncodeToString(sha1Sum[:]),
+		NotBefore:  c.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:   c.NotAfter.UTC().Format(time.RFC3339),
+		SelfSigned: isSelfSigned(c),
+		Source:     e.Source,
+		PEM:        string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})),
+	}
+}
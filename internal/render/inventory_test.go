@@ -0,0 +1,61 @@
+package render
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestInventory(t *testing.T) {
+	entries := []certstore.BundleEntry{
+		{Certificate: certstoretest.NewCertificate(t, "Zeta Root"), Source: "corp"},
+		{Certificate: certstoretest.NewCertificate(t, "Alpha Root"), Source: "mozilla", Label: "alpha"},
+	}
+	dir := t.TempDir()
+
+	for _, format := range []string{"yaml", "json"} {
+		files, err := Inventory(entries, dir, format)
+		if err != nil {
+			t.Fatalf("Inventory(%s): %v", format, err)
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var vars map[string][]InventoryCertificate
+		if format == "yaml" {
+			err = yaml.Unmarshal(data, &vars)
+		} else {
+			err = json.Unmarshal(data, &vars)
+		}
+		if err != nil {
+			t.Fatalf("%s inventory does not parse: %v", format, err)
+		}
+
+		certs := vars[InventoryVariable]
+		if len(certs) != 2 || certs[0].Name != "alpha" || certs[1].Name != "Zeta Root" {
+			t.Fatalf("%s: unexpected certificates %+v", format, certs)
+		}
+		block, _ := pem.Decode([]byte(certs[1].PEM))
+		if block == nil {
+			t.Fatalf("%s: PEM does not decode", format)
+		}
+		if c, err := x509.ParseCertificate(block.Bytes); err != nil || !c.Equal(entries[0].Certificate) {
+			t.Errorf("%s: PEM is not the original certificate (%v)", format, err)
+		}
+		if !certs[1].SelfSigned || certs[1].Source != "corp" || len(certs[1].SHA256) != 64 {
+			t.Errorf("%s: unexpected metadata %+v", format, certs[1])
+		}
+	}
+
+	if _, err := Inventory(entries, dir, "toml"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
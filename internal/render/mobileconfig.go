@@ -0,0 +1,131 @@
+package render
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+)
+
+// MobileconfigFilename is the file written by Mobileconfig
+const MobileconfigFilename = "trust-store-updater.mobileconfig"
+
+// DefaultProfileIdentifier is the PayloadIdentifier used when none is given.
+// MDM replaces an installed profile that has the same identifier.
+const DefaultProfileIdentifier = "com.webprofusion.trust-store-updater.roots"
+
+// Mobileconfig writes the trust set as an Apple configuration profile for
+// macOS and iOS devices managed by MDM. Self-signed roots become
+// com.apple.security.root payloads and intermediates com.apple.security.pkcs1.
+// Payload UUIDs are derived from the identifier and fingerprints, so the same
+// set renders the same profile. With a signing identity the profile is
+// wrapped in CMS SignedData so devices show it as verified.
+func Mobileconfig(certs []*x509.Certificate, outputDir, identifier string, signer *SigningIdentity) ([]string, error) {
+	if identifier == "" {
+		identifier = DefaultProfileIdentifier
+	}
+
+	profile := mobileconfigProfile(certs, identifier)
+	if signer != nil {
+		signed, err := SignCMS(profile, signer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign profile: %w", err)
+		}
+		profile = signed
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", outputDir, err)
+	}
+	path := filepath.Join(outputDir, MobileconfigFilename)
+	if err := atomicfile.WriteFile(path, profile, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return []string{path}, nil
+}
+
+// mobileconfigProfile renders the unsigned profile property list
+func mobileconfigProfile(certs []*x509.Certificate, identifier string) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+`)
+	for _, c := range certs {
+		fingerprint := cert.GetCertificateFingerprint(c)
+		payloadType := "com.apple.security.pkcs1"
+		if isSelfSigned(c) {
+			payloadType = "com.apple.security.root"
+		}
+		payloadID := identifier + "." + fingerprint[:16]
+
+		b.WriteString("\t\t<dict>\n")
+		plistString(&b, 3, "PayloadCertificateFileName", fingerprint[:16]+".cer")
+		plistKey(&b, 3, "PayloadContent")
+		fmt.Fprintf(&b, "\t\t\t<data>%s</data>\n", base64.StdEncoding.EncodeToString(c.Raw))
+		plistString(&b, 3, "PayloadDescription", "Adds a CA certificate managed by trust-store-updater")
+		plistString(&b, 3, "PayloadDisplayName", displayName(c))
+		plistString(&b, 3, "PayloadIdentifier", payloadID)
+		plistString(&b, 3, "PayloadType", payloadType)
+		plistString(&b, 3, "PayloadUUID", payloadUUID(payloadID))
+		plistKey(&b, 3, "PayloadVersion")
+		b.WriteString("\t\t\t<integer>1</integer>\n")
+		b.WriteString("\t\t</dict>\n")
+	}
+	b.WriteString("\t</array>\n")
+	plistString(&b, 1, "PayloadDescription", fmt.Sprintf("%d CA certificates managed by trust-store-updater", len(certs)))
+	plistString(&b, 1, "PayloadDisplayName", "Trusted CA Certificates")
+	plistString(&b, 1, "PayloadIdentifier", identifier)
+	plistKey(&b, 1, "PayloadRemovalDisallowed")
+	b.WriteString("\t<false/>\n")
+	plistString(&b, 1, "PayloadType", "Configuration")
+	plistString(&b, 1, "PayloadUUID", payloadUUID(identifier))
+	plistKey(&b, 1, "PayloadVersion")
+	b.WriteString("\t<integer>1</integer>\n")
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+func plistKey(b *bytes.Buffer, depth int, key string) {
+	fmt.Fprintf(b, "%s<key>%s</key>\n", tabs(depth), key)
+}
+
+func plistString(b *bytes.Buffer, depth int, key, value string) {
+	plistKey(b, depth, key)
+	b.WriteString(tabs(depth) + "<string>")
+	_ = xml.EscapeText(b, []byte(value))
+	b.WriteString("</string>\n")
+}
+
+func tabs(n int) string {
+	return string(bytes.Repeat([]byte{'\t'}, n))
+}
+
+// payloadUUID derives a stable, version 4 formatted UUID from a payload identifier
+func payloadUUID(identifier string) string {
+	h := sha256.Sum256([]byte(identifier))
+	h[6] = h[6]&0x0f | 0x40
+	h[8] = h[8]&0x3f | 0x80
+	return fmt.Sprintf("%X-%X-%X-%X-%X", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+func isSelfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawSubject, c.RawIssuer) && c.CheckSignatureFrom(c) == nil
+}
+
+func displayName(c *x509.Certificate) string {
+	if c.Subject.CommonName != "" {
+		return c.Subject.CommonName
+	}
+	return c.Subject.String()
+}
@@ -0,0 +1,120 @@
+package render
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/xml"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func newTestSigningIdentity(t *testing.T) *SigningIdentity {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Profile Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return &SigningIdentity{Certificate: c, Key: key}
+}
+
+func TestMobileconfig(t *testing.T) {
+	root := certstoretest.NewCertificate(t, "Example <Root>")
+	dir := t.TempDir()
+
+	files, err := Mobileconfig([]*x509.Certificate{root}, dir, "", nil)
+	if err != nil {
+		t.Fatalf("Mobileconfig: %v", err)
+	}
+	profile, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The property list must be well-formed XML
+	decoder := xml.NewDecoder(strings.NewReader(string(profile)))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("profile is not well-formed: %v\n%s", err, profile)
+		}
+	}
+	for _, want := range []string{
+		"<string>com.apple.security.root</string>",
+		"<string>Example &lt;Root&gt;</string>",
+		"<string>" + DefaultProfileIdentifier + "</string>",
+	} {
+		if !strings.Contains(string(profile), want) {
+			t.Errorf("profile missing %s", want)
+		}
+	}
+
+	again, err := Mobileconfig([]*x509.Certificate{root}, dir, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(again[0]); string(data) != string(profile) {
+		t.Error("rendering the same set twice produced different profiles")
+	}
+}
+
+func TestSignCMS(t *testing.T) {
+	id := newTestSigningIdentity(t)
+	content := []byte("<plist/>")
+
+	signed, err := SignCMS(content, id)
+	if err != nil {
+		t.Fatalf("SignCMS: %v", err)
+	}
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(signed, &ci); err != nil || !ci.ContentType.Equal(oidSignedData) {
+		t.Fatalf("not a SignedData ContentInfo: %v", err)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatalf("failed to parse SignedData: %v", err)
+	}
+	var embedded []byte
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &embedded); err != nil || string(embedded) != string(content) {
+		t.Errorf("embedded content = %q (%v)", embedded, err)
+	}
+	var si signerInfo
+	if _, err := asn1.Unmarshal(sd.SignerInfos.Bytes, &si); err != nil {
+		t.Fatalf("failed to parse SignerInfo: %v", err)
+	}
+
+	// Verify as a relying party would: over the attributes re-tagged as a SET
+	attrs, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := id.Certificate.CheckSignature(x509.SHA256WithRSA, attrs, si.Signature); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+)
+
+// ONCFilename is the file written by ONC
+const ONCFilename = "trust-store-updater.onc"
+
+// oncGUIDPrefix identifies certificates from this tool in ONC policy
+const oncGUIDPrefix = "trust-store-updater-"
+
+// oncConfiguration is an unencrypted Open Network Configuration
+type oncConfiguration struct {
+	Type                  string           `json:"Type"`
+	NetworkConfigurations []any            `json:"NetworkConfigurations"`
+	Certificates          []oncCertificate `json:"Certificates"`
+}
+
+type oncCertificate struct {
+	GUID      string   `json:"GUID"`
+	Type      string   `json:"Type"`
+	X509      string   `json:"X509"`
+	TrustBits []string `json:"TrustBits,omitempty"`
+}
+
+// ONC writes the trust set as an Open Network Configuration file for ChromeOS,
+// to upload in the Google Admin console or push as the OpenNetworkConfiguration
+// policy. Self-signed roots are trusted for web (TLS) server authentication;
+// intermediates are only made available for path building. GUIDs are derived
+// from fingerprints, so a regenerated file updates the same entries, and
+// certificates are listed in GUID order so output is reproducible.
+func ONC(certs []*x509.Certificate, outputDir string) ([]string, error) {
+	onc := oncConfiguration{
+		Type:                  "UnencryptedConfiguration",
+		NetworkConfigurations: []any{},
+		Certificates:          make([]oncCertificate, 0, len(certs)),
+	}
+	for _, c := range certs {
+		entry := oncCertificate{
+			GUID: oncGUIDPrefix + cert.GetCertificateFingerprint(c),
+			Type: "Authority",
+			X509: base64.StdEncoding.EncodeToString(c.Raw),
+		}
+		if isSelfSigned(c) {
+			entry.TrustBits = []string{"Web"}
+		}
+		onc.Certificates = append(onc.Certificates, entry)
+	}
+	sort.Slice(onc.Certificates, func(i, j int) bool { return onc.Certificates[i].GUID < onc.Certificates[j].GUID })
+
+	data, err := json.MarshalIndent(onc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", outputDir, err)
+	}
+	path := filepath.Join(outputDir, ONCFilename)
+	if err := atomicfile.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return []string{path}, nil
+}
@@ -0,0 +1,39 @@
+package render
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func TestONC(t *testing.T) {
+	root := certstoretest.NewCertificate(t, "Example Root")
+
+	files, err := ONC([]*x509.Certificate{root}, t.TempDir())
+	if err != nil {
+		t.Fatalf("ONC: %v", err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var onc oncConfiguration
+	if err := json.Unmarshal(data, &onc); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if onc.Type != "UnencryptedConfiguration" || len(onc.Certificates) != 1 {
+		t.Fatalf("unexpected configuration: %+v", onc)
+	}
+	c := onc.Certificates[0]
+	if c.Type != "Authority" || len(c.TrustBits) != 1 || c.TrustBits[0] != "Web" {
+		t.Errorf("root entry = %+v, want an Authority trusted for Web", c)
+	}
+	if der, err := base64.StdEncoding.DecodeString(c.X509); err != nil || string(der) != string(root.Raw) {
+		t.Errorf("X509 doesn't hold the certificate: %v", err)
+	}
+}
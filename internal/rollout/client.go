@@ -0,0 +1,160 @@
+package rollout
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// syncTimeout bounds one agent's sync, which fetches every source and
+// updates every store
+const syncTimeout = 30 * time.Minute
+
+// agentClient calls the agents' APIs with the controller's credentials
+type agentClient struct {
+	http   *http.Client
+	apiKey string
+}
+
+func newAgentClient(cfg config.Rollout) (*agentClient, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rollout CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in rollout CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.ClientCert != "" {
+		pair, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rollout client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	c := &agentClient{
+		http: &http.Client{Timeout: syncTimeout, Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+	}
+	if cfg.APIKeyEnv != "" {
+		if c.apiKey = os.Getenv(cfg.APIKeyEnv); c.apiKey == "" {
+			return nil, fmt.Errorf("environment variable %s holding the rollout API key is not set", cfg.APIKeyEnv)
+		}
+	}
+	if c.apiKey == "" && cfg.ClientCert == "" {
+		return nil, fmt.Errorf("rollout needs api_key_env or client_cert to authenticate to agents")
+	}
+	return c, nil
+}
+
+// syncResult is the part of an agent's sync response the controller checks
+type syncResult struct {
+	BundleDigest string `json:"bundle_digest"`
+	Stores       []struct {
+		Name   string `json:"Name"`
+		Failed int    `json:"Failed"`
+		Error  string `json:"Error"`
+	} `json:"stores"`
+	Error string `json:"error"`
+}
+
+// sync runs an update on the agent and returns the digest of the bundle it
+// fetched. A pinned digest makes the agent refuse any other bundle; a store
+// that failed fails the agent.
+func (c *agentClient) sync(agent config.RolloutAgent, pinned string) (string, error) {
+	var request []byte
+	if pinned != "" {
+		request, _ = json.Marshal(map[string]string{"bundle_digest": pinned})
+	}
+	body, status, err := c.do(agent, http.MethodPost, "/v1/sync", request)
+	if err != nil {
+		return "", err
+	}
+	var result syncResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("sync returned %d with an unreadable body", status)
+	}
+	if status != http.StatusOK {
+		return result.BundleDigest, fmt.Errorf("sync failed (%d): %s", status, result.Error)
+	}
+	// An agent that ignored the pin must not count as synced
+	if result.BundleDigest == "" {
+		return "", fmt.Errorf("agent did not report the digest of the bundle it installed")
+	}
+	if pinned != "" && result.BundleDigest != pinned {
+		return result.BundleDigest, fmt.Errorf("agent installed bundle %s, not the pinned %s", result.BundleDigest, pinned)
+	}
+	var failed []string
+	for _, store := range result.Stores {
+		if store.Failed > 0 || store.Error != "" {
+			failed = append(failed, store.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return result.BundleDigest, fmt.Errorf("sync failed for stores %s", strings.Join(failed, ", "))
+	}
+	return result.BundleDigest, nil
+}
+
+// ready checks the agent's readiness probe, which verifies its stores and
+// the outcome of the sync
+func (c *agentClient) ready(agent config.RolloutAgent) error {
+	body, status, err := c.do(agent, http.MethodGet, "/readyz", nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		return nil
+	}
+	var resp struct {
+		Checks []struct {
+			Name   string `json:"name"`
+			OK     bool   `json:"ok"`
+			Detail string `json:"detail"`
+		} `json:"checks"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	var failing []string
+	for _, check := range resp.Checks {
+		if !check.OK {
+			failing = append(failing, strings.TrimSpace(check.Name+" "+check.Detail))
+		}
+	}
+	return fmt.Errorf("not ready (%d): %s", status, strings.Join(failing, "; "))
+}
+
+func (c *agentClient) do(agent config.RolloutAgent, method, path string, request []byte) ([]byte, int, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(agent.URL, "/")+path, bytes.NewReader(request))
+	if err != nil {
+		return nil, 0, err
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, resp.StatusCode, nil
+}
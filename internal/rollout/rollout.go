@@ -0,0 +1,271 @@
+// Package rollout syncs a fleet of agents in stages through their APIs. Each
+// stage syncs a larger share of the agents, waits, then checks that they
+// are healthy; too many failures halt the rollout before the rest of the
+// fleet gets a bad bundle.
+package rollout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// Rollout statuses
+const (
+	StatusRunning   = "running"
+	StatusHalted    = "halted"
+	StatusCompleted = "completed"
+)
+
+// ErrHalted is returned when a stage had more failed agents than allowed
+var ErrHalted = errors.New("rollout halted")
+
+// State is the progress of a rollout, kept so that a halted rollout can be
+// resumed once the cause is fixed. BundleDigest pins the rollout to the
+// bundle its first canary installed; every later agent must install the same.
+type State struct {
+	Version      string                  `json:"version"`
+	BundleDigest string                  `json:"bundle_digest,omitempty"`
+	Status       string                  `json:"status"`
+	Stage        int                     `json:"stage"` // stages completed
+	StartedAt    time.Time               `json:"started_at"`
+	UpdatedAt    time.Time               `json:"updated_at"`
+	Agents       map[string]*AgentResult `json:"agents"`
+}
+
+// AgentResult is the outcome of syncing one agent
+type AgentResult struct {
+	Stage    int       `json:"stage"`
+	SyncedAt time.Time `json:"synced_at"`
+	Healthy  bool      `json:"healthy"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Controller runs rollouts over the configured agents
+type Controller struct {
+	cfg    config.Rollout
+	client *agentClient
+	// Sleep waits between a stage's syncs and its health checks
+	Sleep func(time.Duration)
+}
+
+// New returns a controller for cfg, checking the stages and agents
+func New(cfg config.Rollout) (*Controller, error) {
+	if len(cfg.Agents) == 0 {
+		return nil, fmt.Errorf("no rollout agents configured")
+	}
+	if len(cfg.Stages) == 0 || cfg.Stages[len(cfg.Stages)-1] != 100 {
+		return nil, fmt.Errorf("rollout stages must end at 100 percent")
+	}
+	for i, pct := range cfg.Stages {
+		if pct <= 0 || pct > 100 || i > 0 && pct <= cfg.Stages[i-1] {
+			return nil, fmt.Errorf("rollout stages must be increasing percentages, got %v", cfg.Stages)
+		}
+	}
+	names := make(map[string]bool)
+	for _, agent := range cfg.Agents {
+		if names[agent.Name] || agent.Name == "" {
+			return nil, fmt.Errorf("rollout agent names must be unique and not empty: %q", agent.Name)
+		}
+		names[agent.Name] = true
+		if u, err := url.Parse(agent.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("rollout agent %s: %q is not an http(s) URL", agent.Name, agent.URL)
+		}
+	}
+	client, err := newAgentClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Controller{cfg: cfg, client: client, Sleep: time.Sleep}, nil
+}
+
+// Order returns the agents in the order a rollout of version reaches them.
+// The order is stable for a version, so a resumed rollout reuses its canary
+// agents, and differs between versions, so the same agents aren't always
+// first.
+func (c *Controller) Order(version string) []config.RolloutAgent {
+	agents := append([]config.RolloutAgent(nil), c.cfg.Agents...)
+	rank := func(a config.RolloutAgent) string {
+		sum := sha256.Sum256([]byte(version + "\x00" + a.Name))
+		return hex.EncodeToString(sum[:])
+	}
+	sort.Slice(agents, func(i, j int) bool { return rank(agents[i]) < rank(agents[j]) })
+	return agents
+}
+
+// stageSize returns how many agents the stages up to and including stage cover
+func (c *Controller) stageSize(stage int) int {
+	n := (len(c.cfg.Agents)*c.cfg.Stages[stage] + 99) / 100
+	return max(n, 1)
+}
+
+// Plan returns the agents each stage of a rollout of version adds
+func (c *Controller) Plan(version string) [][]config.RolloutAgent {
+	order := c.Order(version)
+	plan := make([][]config.RolloutAgent, len(c.cfg.Stages))
+	done := 0
+	for stage := range c.cfg.Stages {
+		n := c.stageSize(stage)
+		plan[stage] = order[done:n]
+		done = n
+	}
+	return plan
+}
+
+// Run rolls version out stage by stage. The first canary syncs alone and
+// the digest of the bundle it installed pins the rest of the rollout, so a
+// source that changes mid-rollout can't reach the fleet unstaged. A rollout
+// of the same version that was halted or interrupted resumes with the same
+// pin, skipping agents already healthy; restart starts over.
+func (c *Controller) Run(version string, restart bool) (*State, error) {
+	st, err := c.Load()
+	if err != nil {
+		return nil, err
+	}
+	if st == nil || restart || st.Version != version || st.Status == StatusCompleted {
+		st = &State{Version: version, StartedAt: time.Now(), Agents: make(map[string]*AgentResult)}
+	}
+	st.Status = StatusRunning
+	if err := c.save(st); err != nil {
+		return nil, err
+	}
+
+	order := c.Order(version)
+	for stage := range c.cfg.Stages {
+		var pending []config.RolloutAgent
+		for _, agent := range order[:c.stageSize(stage)] {
+			if r := st.Agents[agent.Name]; r == nil || !r.Healthy {
+				pending = append(pending, agent)
+			}
+		}
+		if len(pending) > 0 {
+			certstore.LogInfof("Rollout %s stage %d (%d%%): syncing %d agents", version, stage+1, c.cfg.Stages[stage], len(pending))
+			failed := c.runStage(st, stage, pending)
+			if err := c.save(st); err != nil {
+				return st, err
+			}
+			if failed > c.cfg.MaxFailures || st.BundleDigest == "" {
+				st.Status = StatusHalted
+				if err := c.save(st); err != nil {
+					return st, err
+				}
+				if st.BundleDigest == "" {
+					return st, fmt.Errorf("%w at stage %d: canary %s failed, so no bundle was pinned", ErrHalted, stage+1, pending[0].Name)
+				}
+				return st, fmt.Errorf("%w at stage %d: %d of %d agents failed (max_failures %d)", ErrHalted, stage+1, failed, len(pending), c.cfg.MaxFailures)
+			}
+		}
+		st.Stage = stage + 1
+		if err := c.save(st); err != nil {
+			return st, err
+		}
+	}
+	st.Status = StatusCompleted
+	return st, c.save(st)
+}
+
+// runStage syncs the agents concurrently, waits out the soak time and then
+// checks each synced agent's readiness, returning how many failed. Until the
+// rollout is pinned to a bundle the first agent syncs alone to pin it; if it
+// fails the others are left for the next run.
+func (c *Controller) runStage(st *State, stage int, agents []config.RolloutAgent) int {
+	results := make([]*AgentResult, len(agents))
+	syncAgent := func(i int, pinned string) string {
+		r := &AgentResult{Stage: stage + 1, SyncedAt: time.Now()}
+		digest, err := c.client.sync(agents[i], pinned)
+		if err != nil {
+			r.Error = err.Error()
+		}
+		results[i] = r
+		return digest
+	}
+
+	start := 0
+	if st.BundleDigest == "" {
+		if digest := syncAgent(0, ""); results[0].Error == "" {
+			st.BundleDigest = digest
+			certstore.LogInfof("Rollout %s pinned to bundle %s by %s", st.Version, digest, agents[0].Name)
+		}
+		start = 1
+	}
+	if st.BundleDigest != "" {
+		var wg sync.WaitGroup
+		for i := start; i < len(agents); i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				syncAgent(i, st.BundleDigest)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	c.Sleep(time.Duration(c.cfg.SoakSeconds) * time.Second)
+
+	failed := 0
+	for i, agent := range agents {
+		r := results[i]
+		if r == nil {
+			continue
+		}
+		if r.Error == "" {
+			if err := c.client.ready(agent); err != nil {
+				r.Error = err.Error()
+			} else {
+				r.Healthy = true
+			}
+		}
+		if !r.Healthy {
+			failed++
+			certstore.LogWarnf("Rollout %s: agent %s failed: %s", st.Version, agent.Name, r.Error)
+		}
+		st.Agents[agent.Name] = r
+	}
+	return failed
+}
+
+// Load returns the last rollout's state, nil if there was none
+func (c *Controller) Load() (*State, error) {
+	data, err := os.ReadFile(c.cfg.StateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollout state: %w", err)
+	}
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("failed to parse rollout state %s: %w", c.cfg.StateFile, err)
+	}
+	if st.Agents == nil {
+		st.Agents = make(map[string]*AgentResult)
+	}
+	return &st, nil
+}
+
+func (c *Controller) save(st *State) error {
+	st.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.cfg.StateFile), 0755); err != nil {
+		return fmt.Errorf("failed to create rollout state directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(c.cfg.StateFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write rollout state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package rollout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// fakeFleet serves the agent API for a set of agents, some of which fail.
+// Every agent fetches bundle, refusing a sync pinned to another.
+type fakeFleet struct {
+	mu      sync.Mutex
+	failing map[string]bool
+	synced  map[string]int
+	bundle  string
+	pinned  map[string]string
+}
+
+func newFakeFleet() *fakeFleet {
+	return &fakeFleet{failing: make(map[string]bool), synced: make(map[string]int), bundle: "bundle-1", pinned: make(map[string]string)}
+}
+
+func (f *fakeFleet) agent(t *testing.T, name string) config.RolloutAgent {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			BundleDigest string `json:"bundle_digest"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		failing, bundle := f.failing[name], f.bundle
+		if r.URL.Path == "/v1/sync" {
+			f.synced[name]++
+			f.pinned[name] = req.BundleDigest
+		}
+		f.mu.Unlock()
+		switch {
+		case r.URL.Path == "/v1/sync" && req.BundleDigest != "" && req.BundleDigest != bundle:
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, `{"bundle_digest":%q,"error":"fetched bundle does not match the pinned bundle"}`, bundle)
+		case r.URL.Path == "/v1/sync" && failing:
+			fmt.Fprintf(w, `{"bundle_digest":%q,"stores":[{"Name":"system","Failed":1}]}`, bundle)
+		case r.URL.Path == "/v1/sync":
+			fmt.Fprintf(w, `{"bundle_digest":%q,"stores":[{"Name":"system","Added":2}]}`, bundle)
+		case r.URL.Path == "/readyz":
+			fmt.Fprint(w, `{"status":"ready"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return config.RolloutAgent{Name: name, URL: srv.URL}
+}
+
+func TestRunHaltsAndResumes(t *testing.T) {
+	t.Setenv("ROLLOUT_KEY", "secret")
+	fleet := newFakeFleet()
+	cfg := config.Rollout{
+		Stages:    []int{25, 100},
+		APIKeyEnv: "ROLLOUT_KEY",
+		StateFile: filepath.Join(t.TempDir(), "rollout", "state.json"),
+	}
+	for i := 0; i < 4; i++ {
+		cfg.Agents = append(cfg.Agents, fleet.agent(t, fmt.Sprintf("agent-%d", i)))
+	}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Sleep = func(time.Duration) {}
+
+	// The canary fails, so no other agent is synced
+	canary := c.Order("v1")[0].Name
+	fleet.failing[canary] = true
+	st, err := c.Run("v1", false)
+	if !errors.Is(err, ErrHalted) {
+		t.Fatalf("err = %v, want ErrHalted", err)
+	}
+	if st.Status != StatusHalted || st.Stage != 0 || len(fleet.synced) != 1 {
+		t.Fatalf("status %s stage %d, synced %v", st.Status, st.Stage, fleet.synced)
+	}
+
+	// Resuming after the fix completes the rollout, syncing each agent once more
+	fleet.failing[canary] = false
+	if st, err = c.Run("v1", false); err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != StatusCompleted || st.Stage != 2 {
+		t.Fatalf("status %s stage %d", st.Status, st.Stage)
+	}
+	for _, agent := range cfg.Agents {
+		if fleet.synced[agent.Name] != 1+btoi(agent.Name == canary) || !st.Agents[agent.Name].Healthy {
+			t.Errorf("agent %s synced %d times, result %+v", agent.Name, fleet.synced[agent.Name], st.Agents[agent.Name])
+		}
+	}
+
+	saved, err := c.Load()
+	if err != nil || saved.Status != StatusCompleted || saved.Version != "v1" || saved.BundleDigest != "bundle-1" {
+		t.Errorf("saved state = %+v, %v", saved, err)
+	}
+}
+
+func TestRunPinsBundle(t *testing.T) {
+	t.Setenv("ROLLOUT_KEY", "secret")
+	fleet := newFakeFleet()
+	cfg := config.Rollout{
+		Stages:    []int{25, 100},
+		APIKeyEnv: "ROLLOUT_KEY",
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+	}
+	for i := 0; i < 4; i++ {
+		cfg.Agents = append(cfg.Agents, fleet.agent(t, fmt.Sprintf("agent-%d", i)))
+	}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The source changes once the canary has synced; the rest of the fleet
+	// refuses the new bundle instead of installing it unstaged
+	c.Sleep = func(time.Duration) {
+		fleet.mu.Lock()
+		fleet.bundle = "bundle-2"
+		fleet.mu.Unlock()
+	}
+	st, err := c.Run("v1", false)
+	if !errors.Is(err, ErrHalted) {
+		t.Fatalf("err = %v, want ErrHalted", err)
+	}
+	canary := c.Order("v1")[0].Name
+	if st.BundleDigest != "bundle-1" || !st.Agents[canary].Healthy || st.Stage != 1 {
+		t.Fatalf("state = %+v", st)
+	}
+	for _, agent := range cfg.Agents {
+		if agent.Name != canary && fleet.pinned[agent.Name] != "bundle-1" {
+			t.Errorf("agent %s synced without the pin: %q", agent.Name, fleet.pinned[agent.Name])
+		}
+	}
+
+	// --restart pins the bundle the new canary installs
+	if st, err = c.Run("v1", true); err != nil {
+		t.Fatal(err)
+	}
+	if st.BundleDigest != "bundle-2" || st.Status != StatusCompleted {
+		t.Errorf("state after restart = %+v", st)
+	}
+}
+
+func TestNewValidatesStages(t *testing.T) {
+	t.Setenv("ROLLOUT_KEY", "secret")
+	agents := []config.RolloutAgent{{Name: "a", URL: "https://a.example.com"}}
+	for _, stages := range [][]int{nil, {5, 25}, {25, 5, 100}, {0, 100}} {
+		if _, err := New(config.Rollout{Agents: agents, Stages: stages, APIKeyEnv: "ROLLOUT_KEY"}); err == nil {
+			t.Errorf("stages %v accepted", stages)
+		}
+	}
+	if _, err := New(config.Rollout{Agents: agents, Stages: []int{100}}); err == nil {
+		t.Error("rollout without credentials accepted")
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
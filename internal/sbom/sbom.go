@@ -0,0 +1,315 @@
+// Package sbom describes the trust anchors in a host's stores in the
+// inventory formats security tooling already ingests alongside software
+// bills of materials: CycloneDX, with each certificate as a cryptographic
+// asset component, and SPDX, with each certificate as a package.
+package sbom
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+)
+
+// Formats
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+)
+
+// toolName identifies this tool in documents
+const toolName = "trust-store-updater"
+
+// propertyPrefix namespaces this tool's CycloneDX properties
+const propertyPrefix = "trust-store-updater:"
+
+// Entry is a certificate found in a store
+type Entry struct {
+	Store       string
+	Certificate *x509.Certificate
+	// Source is the certificate source that installed it, empty when this
+	// tool didn't
+	Source string
+}
+
+// Document describes a host's trust anchors
+type Document struct {
+	Host        string
+	ToolVersion string
+	Created     time.Time
+	Entries     []Entry
+}
+
+// anchor is a certificate with every store holding it
+type anchor struct {
+	fingerprint string
+	cert        *x509.Certificate
+	stores      []string
+	sources     []string
+}
+
+// anchors groups the entries by certificate, in fingerprint order so that
+// documents for an unchanged host differ only in their identifiers and times
+func (d *Document) anchors() []*anchor {
+	byFingerprint := make(map[string]*anchor)
+	for _, e := range d.Entries {
+		fp := cert.GetCertificateFingerprint(e.Certificate)
+		a := byFingerprint[fp]
+		if a == nil {
+			a = &anchor{fingerprint: fp, cert: e.Certificate}
+			byFingerprint[fp] = a
+		}
+		a.stores = appendUnique(a.stores, e.Store)
+		if e.Source != "" {
+			a.sources = appendUnique(a.sources, e.Source)
+		}
+	}
+	anchors := make([]*anchor, 0, len(byFingerprint))
+	for _, a := range byFingerprint {
+		sort.Strings(a.stores)
+		sort.Strings(a.sources)
+		anchors = append(anchors, a)
+	}
+	sort.Slice(anchors, func(i, j int) bool { return anchors[i].fingerprint < anchors[j].fingerprint })
+	return anchors
+}
+
+func appendUnique(values []string, v string) []string {
+	for _, existing := range values {
+		if existing == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+// name is the certificate's common name, or its subject without one
+func (a *anchor) name() string {
+	if a.cert.Subject.CommonName != "" {
+		return a.cert.Subject.CommonName
+	}
+	return a.cert.Subject.String()
+}
+
+// Marshal encodes d in format
+func (d *Document) Marshal(format string) ([]byte, error) {
+	var v any
+	switch format {
+	case FormatCycloneDX:
+		v = d.cycloneDX()
+	case FormatSPDX:
+		v = d.spdx()
+	default:
+		return nil, fmt.Errorf("unsupported inventory format %q (expected %s or %s)", format, FormatCycloneDX, FormatSPDX)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s document: %w", format, err)
+	}
+	return append(data, '\n'), nil
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// CycloneDX 1.6
+
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cdxComponent `json:"components"`
+	} `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxComponent struct {
+	Type             string        `json:"type"`
+	BOMRef           string        `json:"bom-ref,omitempty"`
+	Name             string        `json:"name"`
+	Version          string        `json:"version,omitempty"`
+	Hashes           []cdxHash     `json:"hashes,omitempty"`
+	CryptoProperties *cdxCrypto    `json:"cryptoProperties,omitempty"`
+	Properties       []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxCrypto struct {
+	AssetType             string         `json:"assetType"`
+	CertificateProperties cdxCertificate `json:"certificateProperties"`
+}
+
+type cdxCertificate struct {
+	SubjectName          string `json:"subjectName"`
+	IssuerName           string `json:"issuerName"`
+	NotValidBefore       string `json:"notValidBefore"`
+	NotValidAfter        string `json:"notValidAfter"`
+	CertificateFormat    string `json:"certificateFormat"`
+	CertificateExtension string `json:"certificateExtension"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (d *Document) cycloneDX() *cdxBOM {
+	bom := &cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.6",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Components:   []cdxComponent{},
+	}
+	bom.Metadata.Timestamp = d.Created.UTC().Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []cdxComponent{{Type: "application", Name: toolName, Version: d.ToolVersion}}
+	bom.Metadata.Component = cdxComponent{Type: "device", BOMRef: "host", Name: d.Host}
+
+	for _, a := range d.anchors() {
+		c := cdxComponent{
+			Type:    "cryptographic-asset",
+			BOMRef:  "certificate:" + a.fingerprint,
+			Name:    a.name(),
+			Version: a.cert.SerialNumber.Text(16),
+			Hashes:  []cdxHash{{Alg: "SHA-256", Content: a.fingerprint}},
+			CryptoProperties: &cdxCrypto{
+				AssetType: "certificate",
+				CertificateProperties: cdxCertificate{
+					SubjectName:          a.cert.Subject.String(),
+					IssuerName:           a.cert.Issuer.String(),
+					NotValidBefore:       a.cert.NotBefore.UTC().Format(time.RFC3339),
+					NotValidAfter:        a.cert.NotAfter.UTC().Format(time.RFC3339),
+					CertificateFormat:    "X.509",
+					CertificateExtension: "crt",
+				},
+			},
+		}
+		c.Properties = append(c.Properties,
+			cdxProperty{Name: propertyPrefix + "signature-algorithm", Value: a.cert.SignatureAlgorithm.String()},
+			cdxProperty{Name: propertyPrefix + "public-key-algorithm", Value: a.cert.PublicKeyAlgorithm.String()},
+			cdxProperty{Name: propertyPrefix + "ca", Value: fmt.Sprint(a.cert.IsCA)})
+		for _, store := range a.stores {
+			c.Properties = append(c.Properties, cdxProperty{Name: propertyPrefix + "store", Value: store})
+		}
+		for _, source := range a.sources {
+			c.Properties = append(c.Properties, cdxProperty{Name: propertyPrefix + "source", Value: source})
+		}
+		bom.Components = append(bom.Components, c)
+	}
+	return bom
+}
+
+// SPDX 2.3
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID                string         `json:"SPDXID"`
+	Name                  string         `json:"name"`
+	VersionInfo           string         `json:"versionInfo,omitempty"`
+	DownloadLocation      string         `json:"downloadLocation"`
+	FilesAnalyzed         bool           `json:"filesAnalyzed"`
+	Checksums             []spdxChecksum `json:"checksums,omitempty"`
+	PrimaryPackagePurpose string         `json:"primaryPackagePurpose,omitempty"`
+	ValidUntilDate        string         `json:"validUntilDate,omitempty"`
+	Supplier              string         `json:"supplier,omitempty"`
+	Comment               string         `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+func (d *Document) spdx() *spdxDocument {
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              toolName + "-" + d.Host,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + toolName + "-" + d.Host + "-" + newUUID(),
+		CreationInfo: spdxCreationInfo{
+			Created:  d.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + toolName + "-" + d.ToolVersion},
+		},
+		Packages: []spdxPackage{{
+			SPDXID:                "SPDXRef-Host",
+			Name:                  d.Host,
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "DEVICE",
+		}},
+		Relationships: []spdxRelationship{{Element: "SPDXRef-DOCUMENT", Type: "DESCRIBES", Related: "SPDXRef-Host"}},
+	}
+	for _, a := range d.anchors() {
+		id := "SPDXRef-Certificate-" + a.fingerprint
+		comment := "Subject: " + a.cert.Subject.String() + "\nIssuer: " + a.cert.Issuer.String() +
+			"\nStores: " + strings.Join(a.stores, ", ")
+		if len(a.sources) > 0 {
+			comment += "\nInstalled by trust-store-updater from: " + strings.Join(a.sources, ", ")
+		}
+		doc.Packages = append(doc.Packages, spdxPackage{
+			SPDXID:                id,
+			Name:                  a.name(),
+			VersionInfo:           a.cert.SerialNumber.Text(16),
+			DownloadLocation:      "NOASSERTION",
+			Checksums:             []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: a.fingerprint}},
+			PrimaryPackagePurpose: "OTHER",
+			ValidUntilDate:        a.cert.NotAfter.UTC().Format(time.RFC3339),
+			Supplier:              issuerSupplier(a.cert),
+			Comment:               comment,
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{Element: "SPDXRef-Host", Type: "CONTAINS", Related: id})
+	}
+	return doc
+}
+
+// issuerSupplier names the organization that issued the certificate
+func issuerSupplier(c *x509.Certificate) string {
+	if len(c.Issuer.Organization) > 0 && c.Issuer.Organization[0] != "" {
+		return "Organization: " + c.Issuer.Organization[0]
+	}
+	return "NOASSERTION"
+}
@@ -0,0 +1,94 @@
+package sbom
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore/certstoretest"
+)
+
+func testDocument(t *testing.T) (*Document, *x509.Certificate) {
+	root := certstoretest.NewCertificateWithSubject(t, pkix.Name{CommonName: "Corp Root", Organization: []string{"Corp"}})
+	other := certstoretest.NewCertificateWithSubject(t, pkix.Name{CommonName: "Other Root", Organization: []string{"Other"}})
+	return &Document{
+		Host:        "web1",
+		ToolVersion: "1.2.3",
+		Created:     time.Now(),
+		Entries: []Entry{
+			{Store: "system", Certificate: root, Source: "corp"},
+			{Store: "java", Certificate: root},
+			{Store: "system", Certificate: other},
+		},
+	}, root
+}
+
+func TestCycloneDX(t *testing.T) {
+	doc, root := testDocument(t)
+	data, err := doc.Marshal(FormatCycloneDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom cdxBOM
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if bom.BOMFormat != "CycloneDX" || bom.Metadata.Component.Name != "web1" || len(bom.Components) != 2 {
+		t.Fatalf("unexpected BOM: %s", data)
+	}
+
+	fp := cert.GetCertificateFingerprint(root)
+	var found *cdxComponent
+	for i := range bom.Components {
+		if bom.Components[i].BOMRef == "certificate:"+fp {
+			found = &bom.Components[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("no component for the root: %s", data)
+	}
+	if found.Type != "cryptographic-asset" || found.CryptoProperties.AssetType != "certificate" || found.Name != "Corp Root" {
+		t.Errorf("component = %+v", found)
+	}
+	var stores, sources []string
+	for _, p := range found.Properties {
+		switch p.Name {
+		case propertyPrefix + "store":
+			stores = append(stores, p.Value)
+		case propertyPrefix + "source":
+			sources = append(sources, p.Value)
+		}
+	}
+	if len(stores) != 2 || stores[0] != "java" || stores[1] != "system" || len(sources) != 1 || sources[0] != "corp" {
+		t.Errorf("stores = %v, sources = %v", stores, sources)
+	}
+}
+
+func TestSPDX(t *testing.T) {
+	doc, root := testDocument(t)
+	data, err := doc.Marshal(FormatSPDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spdx spdxDocument
+	if err := json.Unmarshal(data, &spdx); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	// The host and one package per certificate, each contained by the host
+	if spdx.SPDXVersion != "SPDX-2.3" || len(spdx.Packages) != 3 || len(spdx.Relationships) != 3 {
+		t.Fatalf("unexpected document: %s", data)
+	}
+	id := "SPDXRef-Certificate-" + cert.GetCertificateFingerprint(root)
+	for _, p := range spdx.Packages {
+		if p.SPDXID == id && p.Supplier != "Organization: Corp" {
+			t.Errorf("supplier = %q", p.Supplier)
+		}
+	}
+
+	if _, err := doc.Marshal("swid"); err == nil {
+		t.Error("Marshal accepted an unknown format")
+	}
+}
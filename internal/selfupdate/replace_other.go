@@ -0,0 +1,18 @@
+//go:build !windows
+
+package selfupdate
+
+import (
+	"fmt"
+	"os"
+)
+
+// replaceExecutable swaps the new binary into place with a single rename,
+// so the path always holds either the old or the new binary. The running
+// process keeps the old one open until it exits.
+func replaceExecutable(exePath, newPath string) error {
+	if err := os.Rename(newPath, exePath); err != nil {
+		return fmt.Errorf("failed to install new executable: %w", err)
+	}
+	return nil
+}
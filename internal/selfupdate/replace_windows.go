@@ -0,0 +1,30 @@
+package selfupdate
+
+import (
+	"fmt"
+	"os"
+)
+
+// replaceExecutable swaps the new binary into place. Windows does not allow
+// replacing a running binary, so it is moved aside first and put back if the
+// new one can't be installed.
+func replaceExecutable(exePath, newPath string) error {
+	oldPath := exePath + ".old"
+	_ = os.Remove(oldPath)
+
+	if err := os.Rename(exePath, oldPath); err != nil {
+		return fmt.Errorf("failed to move current executable aside: %w", err)
+	}
+
+	if err := os.Rename(newPath, exePath); err != nil {
+		// Put the original binary back
+		if rbErr := os.Rename(oldPath, exePath); rbErr != nil {
+			return fmt.Errorf("failed to install new executable: %v (rollback failed: %w)", err, rbErr)
+		}
+		return fmt.Errorf("failed to install new executable: %w", err)
+	}
+
+	// Best effort; the old binary stays locked until this process exits
+	_ = os.Remove(oldPath)
+	return nil
+}
@@ -0,0 +1,288 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release channels
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+// maxReleaseSize bounds a release download, well above the size of a build
+const maxReleaseSize = 256 << 20
+
+// Release describes a single published build in the release manifest
+type Release struct {
+	Version   string `json:"version"`
+	Channel   string `json:"channel"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"` // base64 ed25519 signature over SignedData
+}
+
+// SignedData returns the canonical manifest entry a release signature covers.
+// It binds the checksum to the version, channel and platform, so a signed
+// build can't be replayed as a different version or for another platform.
+func (r *Release) SignedData() []byte {
+	return []byte(fmt.Sprintf("trust-store-updater release\nversion: %s\nchannel: %s\nos: %s\narch: %s\nsha256: %s\n",
+		r.Version, r.Channel, r.OS, r.Arch, strings.ToLower(strings.TrimSpace(r.SHA256))))
+}
+
+// Manifest is the document served by the release endpoint
+type Manifest struct {
+	Releases []Release `json:"releases"`
+}
+
+// Updater checks for and applies new releases of the running binary
+type Updater struct {
+	endpoint   string
+	publicKey  ed25519.PublicKey
+	httpClient *http.Client
+	verbose    bool
+	// executable locates the binary to replace; os.Executable outside tests
+	executable func() (string, error)
+}
+
+// New creates a new self-updater. publicKey is the base64 encoded ed25519 key
+// used to verify release signatures.
+func New(endpoint, publicKey string, timeoutSeconds int, verbose bool) (*Updater, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("no release endpoint configured")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid release public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+
+	return &Updater{
+		endpoint:  endpoint,
+		publicKey: ed25519.PublicKey(key),
+		httpClient: &http.Client{
+			Timeout: time.Duration(timeoutSeconds) * time.Second,
+		},
+		verbose:    verbose,
+		executable: os.Executable,
+	}, nil
+}
+
+// Check fetches the release manifest and returns the newest release for the
+// current platform on the given channel, and whether it is newer than currentVersion
+func (u *Updater) Check(currentVersion, channel string) (*Release, bool, error) {
+	if channel != ChannelStable && channel != ChannelBeta {
+		return nil, false, fmt.Errorf("unsupported release channel: %s", channel)
+	}
+
+	if u.verbose {
+		fmt.Printf("Checking for updates at %s (channel: %s)\n", u.endpoint, channel)
+	}
+
+	resp, err := u.httpClient.Get(u.endpoint)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch release manifest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("release manifest request failed with status %d", resp.StatusCode)
+	}
+
+	var manifest Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, false, fmt.Errorf("failed to parse release manifest: %w", err)
+	}
+
+	var latest *Release
+	for i := range manifest.Releases {
+		rel := &manifest.Releases[i]
+		if rel.OS != runtime.GOOS || rel.Arch != runtime.GOARCH {
+			continue
+		}
+		// The beta channel also receives stable releases
+		if rel.Channel != channel && !(channel == ChannelBeta && rel.Channel == ChannelStable) {
+			continue
+		}
+		if latest == nil || CompareVersions(rel.Version, latest.Version) > 0 {
+			latest = rel
+		}
+	}
+
+	if latest == nil {
+		return nil, false, fmt.Errorf("no %s release available for %s/%s", channel, runtime.GOOS, runtime.GOARCH)
+	}
+
+	return latest, CompareVersions(latest.Version, currentVersion) > 0, nil
+}
+
+// Apply downloads the release, verifies its checksum and signature, and
+// atomically replaces the running executable. Releases for another platform,
+// or not newer than currentVersion, are refused.
+func (u *Updater) Apply(rel *Release, currentVersion string) error {
+	if rel.OS != runtime.GOOS || rel.Arch != runtime.GOARCH {
+		return fmt.Errorf("release %s is for %s/%s, not %s/%s", rel.Version, rel.OS, rel.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+	if CompareVersions(rel.Version, currentVersion) <= 0 {
+		return fmt.Errorf("release %s is not newer than the current version %s", rel.Version, currentVersion)
+	}
+
+	exePath, err := u.executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate running executable: %w", err)
+	}
+	exePath, err = filepath.EvalSymlinks(exePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable path: %w", err)
+	}
+
+	if u.verbose {
+		fmt.Printf("Downloading release %s from %s\n", rel.Version, rel.URL)
+	}
+
+	// Download next to the executable so the final rename stays on one filesystem
+	tmp, err := os.CreateTemp(filepath.Dir(exePath), ".trust-store-updater-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	digest, err := u.download(rel.URL, tmp)
+	if err == nil {
+		if err = tmp.Sync(); err != nil {
+			err = fmt.Errorf("failed to write release: %w", err)
+		}
+	}
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := u.verify(rel, digest); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmpPath, 0755); err != nil {
+		return fmt.Errorf("failed to set permissions on new binary: %w", err)
+	}
+
+	return replaceExecutable(exePath, tmpPath)
+}
+
+func (u *Updater) download(url string, w io.Writer) ([]byte, error) {
+	resp, err := u.httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download release: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release download failed with status %d", resp.StatusCode)
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, hash), io.LimitReader(resp.Body, maxReleaseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write release: %w", err)
+	}
+	if n > maxReleaseSize {
+		return nil, fmt.Errorf("release is larger than %d MB", maxReleaseSize>>20)
+	}
+
+	return hash.Sum(nil), nil
+}
+
+func (u *Updater) verify(rel *Release, digest []byte) error {
+	expected, err := hex.DecodeString(strings.TrimSpace(rel.SHA256))
+	if err != nil {
+		return fmt.Errorf("invalid checksum in release manifest: %w", err)
+	}
+	if !strings.EqualFold(hex.EncodeToString(digest), hex.EncodeToString(expected)) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", rel.SHA256, hex.EncodeToString(digest))
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(rel.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature in release manifest: %w", err)
+	}
+	if !ed25519.Verify(u.publicKey, rel.SignedData(), sig) {
+		return fmt.Errorf("signature verification failed for release %s", rel.Version)
+	}
+
+	return nil
+}
+
+// CompareVersions compares two dotted version strings (an optional leading "v"
+// and pre-release suffix are allowed). It returns -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	aParts, aPre := splitVersion(a)
+	bParts, bPre := splitVersion(b)
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x = aParts[i]
+		}
+		if i < len(bParts) {
+			y = bParts[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A release without a pre-release suffix sorts after one with it
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	case aPre < bPre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func splitVersion(v string) ([]int, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	pre := ""
+	if idx := strings.IndexAny(v, "-+"); idx >= 0 {
+		pre = v[idx+1:]
+		v = v[:idx]
+	}
+
+	var parts []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			n = 0
+		}
+		parts = append(parts, n)
+	}
+	return parts, pre
+}
@@ -0,0 +1,229 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.0", "1.2.0", 0},
+		{"v1.2.1", "1.2.0", 1},
+		{"1.2", "1.10", -1},
+		{"1.3.0-beta.1", "1.3.0", -1},
+		{"1.3.0", "dev", 1},
+	}
+
+	for _, c := range cases {
+		if got := CompareVersions(c.a, c.b); got != c.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	u, err := New("https://example.invalid/releases.json", base64.StdEncoding.EncodeToString(pub), 5, false)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	digest := sha256.Sum256([]byte("binary"))
+	rel := signedRelease(priv, "1.0.0", ChannelStable, "", []byte("binary"))
+
+	if err := u.verify(rel, digest[:]); err != nil {
+		t.Fatalf("expected valid release to verify: %v", err)
+	}
+
+	tampered := sha256.Sum256([]byte("tampered"))
+	if err := u.verify(rel, tampered[:]); err == nil {
+		t.Fatalf("expected checksum mismatch for tampered binary")
+	}
+
+	// The signature covers the manifest entry, not just the digest
+	for name, edit := range map[string]func(r *Release){
+		"version": func(r *Release) { r.Version = "9.0.0" },
+		"channel": func(r *Release) { r.Channel = ChannelBeta },
+		"os":      func(r *Release) { r.OS = "plan9" },
+		"arch":    func(r *Release) { r.Arch = "mips" },
+	} {
+		replayed := *rel
+		edit(&replayed)
+		if err := u.verify(&replayed, digest[:]); err == nil {
+			t.Errorf("expected signature over a different %s to be rejected", name)
+		}
+	}
+}
+
+// signedRelease returns a release of binary for this platform, signed with priv
+func signedRelease(priv ed25519.PrivateKey, version, channel, url string, binary []byte) *Release {
+	digest := sha256.Sum256(binary)
+	rel := &Release{
+		Version: version,
+		Channel: channel,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		URL:     url,
+		SHA256:  hex.EncodeToString(digest[:]),
+	}
+	rel.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, rel.SignedData()))
+	return rel
+}
+
+// newReleaseServer serves the manifest at / and binary at /binary
+func newReleaseServer(t *testing.T, manifest *Manifest, binary []byte) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(manifest)
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(binary)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestUpdater(t *testing.T, endpoint string, pub ed25519.PublicKey) *Updater {
+	t.Helper()
+	u, err := New(endpoint, base64.StdEncoding.EncodeToString(pub), 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestCheck(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{Releases: []Release{
+		*signedRelease(priv, "1.1.0", ChannelStable, "", []byte("stable")),
+		*signedRelease(priv, "1.2.0-beta.1", ChannelBeta, "", []byte("beta")),
+	}}
+	other := *signedRelease(priv, "2.0.0", ChannelStable, "", []byte("other"))
+	other.OS = "plan9"
+	manifest.Releases = append(manifest.Releases, other)
+	server := newReleaseServer(t, manifest, nil)
+	u := newTestUpdater(t, server.URL, pub)
+
+	cases := []struct {
+		current, channel string
+		want             string
+		newer            bool
+	}{
+		{"1.0.0", ChannelStable, "1.1.0", true},
+		{"1.1.0", ChannelStable, "1.1.0", false},
+		{"1.0.0", ChannelBeta, "1.2.0-beta.1", true},
+		{"1.2.0", ChannelBeta, "1.2.0-beta.1", false},
+	}
+	for _, c := range cases {
+		rel, newer, err := u.Check(c.current, c.channel)
+		if err != nil {
+			t.Fatalf("Check(%s, %s): %v", c.current, c.channel, err)
+		}
+		if rel.Version != c.want || newer != c.newer {
+			t.Errorf("Check(%s, %s) = %s, %v; want %s, %v", c.current, c.channel, rel.Version, newer, c.want, c.newer)
+		}
+	}
+
+	if _, _, err := u.Check("1.0.0", "nightly"); err == nil {
+		t.Error("expected an unsupported channel to be rejected")
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	if _, _, err := newTestUpdater(t, failing.URL, pub).Check("1.0.0", ChannelStable); err == nil {
+		t.Error("expected a failed manifest request to be reported")
+	}
+}
+
+func TestApply(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("new binary")
+	server := newReleaseServer(t, &Manifest{}, binary)
+
+	install := func(t *testing.T, rel *Release, current string) (string, error) {
+		t.Helper()
+		exePath := filepath.Join(t.TempDir(), "trust-store-updater")
+		if err := os.WriteFile(exePath, []byte("old binary"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		u := newTestUpdater(t, server.URL, pub)
+		u.executable = func() (string, error) { return exePath, nil }
+		err := u.Apply(rel, current)
+		data, readErr := os.ReadFile(exePath)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		return string(data), err
+	}
+
+	t.Run("installs a newer signed release", func(t *testing.T) {
+		got, err := install(t, signedRelease(priv, "1.1.0", ChannelStable, server.URL+"/binary", binary), "1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != string(binary) {
+			t.Errorf("executable = %q, want the new binary", got)
+		}
+	})
+
+	refused := map[string]func() (*Release, string){
+		"same version": func() (*Release, string) {
+			return signedRelease(priv, "1.0.0", ChannelStable, server.URL+"/binary", binary), "1.0.0"
+		},
+		"older version": func() (*Release, string) {
+			return signedRelease(priv, "0.9.0", ChannelStable, server.URL+"/binary", binary), "1.0.0"
+		},
+		"replayed version": func() (*Release, string) {
+			rel := signedRelease(priv, "0.9.0", ChannelStable, server.URL+"/binary", binary)
+			rel.Version = "1.1.0"
+			return rel, "1.0.0"
+		},
+		"other platform": func() (*Release, string) {
+			rel := signedRelease(priv, "1.1.0", ChannelStable, server.URL+"/binary", binary)
+			rel.OS = "plan9"
+			return rel, "1.0.0"
+		},
+		"checksum mismatch": func() (*Release, string) {
+			return signedRelease(priv, "1.1.0", ChannelStable, server.URL+"/binary", []byte("other binary")), "1.0.0"
+		},
+	}
+	for name, build := range refused {
+		t.Run(name, func(t *testing.T) {
+			rel, current := build()
+			got, err := install(t, rel, current)
+			if err == nil {
+				t.Fatal("expected the release to be refused")
+			}
+			if !strings.Contains(got, "old binary") {
+				t.Errorf("executable replaced after a refused update: %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/history"
+)
+
+// readinessTTL is how long readiness results are reused, so frequent probes
+// don't validate every store each time
+const readinessTTL = 30 * time.Second
+
+// Check is one condition reported by /readyz
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// runStatus summarizes the last update run for health probes
+type runStatus struct {
+	FinishedAt time.Time `json:"finished_at"`
+	Outcome    string    `json:"outcome"`
+	Fetched    int       `json:"fetched"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// healthResponse is the body of /healthz and /readyz
+type healthResponse struct {
+	Status  string     `json:"status"`
+	LastRun *runStatus `json:"last_run,omitempty"`
+	Checks  []Check    `json:"checks,omitempty"`
+}
+
+// handleHealth reports that the agent is serving, with the last run's
+// outcome. It doesn't fail on store problems, which restarting won't fix.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthResponse{Status: "ok", LastRun: s.lastRun()})
+}
+
+// handleReady reports whether the agent can do its job: the configuration is
+// valid, every store is reachable and the last run didn't fail
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	last := s.lastRun()
+	checks := s.readiness()
+	if last != nil {
+		checks = append(checks, Check{Name: "last_run", OK: last.Outcome != history.OutcomeFailure, Detail: last.Error})
+	}
+
+	resp := healthResponse{Status: "ready", LastRun: last, Checks: checks}
+	status := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			resp.Status = "not ready"
+			status = http.StatusServiceUnavailable
+			break
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+// readiness returns the backend's checks, cached for readinessTTL
+func (s *Server) readiness() []Check {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	if s.checks == nil || time.Since(s.checkedAt) > readinessTTL {
+		s.checks = s.backend.Readiness()
+		s.checkedAt = time.Now()
+	}
+	return append([]Check(nil), s.checks...)
+}
+
+func (s *Server) lastRun() *runStatus {
+	run, err := s.backend.LastRun()
+	if err != nil || run == nil {
+		return nil
+	}
+	return &runStatus{FinishedAt: run.FinishedAt, Outcome: run.Outcome, Fetched: run.Fetched, Error: run.Error}
+}
+
+// probe serves an unauthenticated GET endpoint for orchestrators and load
+// balancers, which can't present API keys
+func probe(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h(w, r)
+	})
+}
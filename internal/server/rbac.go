@@ -0,0 +1,117 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// Permission is an API operation that a role may be granted
+type Permission string
+
+const (
+	PermReadInventory  Permission = "read_inventory"
+	PermTriggerSync    Permission = "trigger_sync"
+	PermRestoreBackups Permission = "restore_backups"
+)
+
+// rolePermissions lists what each role may do. Only admin can roll a store
+// back, so dashboards given viewer keys can never change trust.
+var rolePermissions = map[string][]Permission{
+	"viewer":   {PermReadInventory},
+	"operator": {PermReadInventory, PermTriggerSync},
+	"admin":    {PermReadInventory, PermTriggerSync, PermRestoreBackups},
+}
+
+// Roles returns the names of the built-in roles
+func Roles() []string {
+	return []string{"viewer", "operator", "admin"}
+}
+
+// Principal is an authenticated caller
+type Principal struct {
+	Name string
+	Role string
+}
+
+// Can reports whether the principal's role grants perm
+func (p *Principal) Can(perm Permission) bool {
+	for _, granted := range rolePermissions[p.Role] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticator maps credentials to principals
+type authenticator struct {
+	keys  []config.APIKey
+	certs []config.ClientCertificate
+}
+
+func newAuthenticator(cfg config.Server) (*authenticator, error) {
+	for _, k := range cfg.APIKeys {
+		if _, ok := rolePermissions[k.Role]; !ok {
+			return nil, fmt.Errorf("api key %s: unknown role %q (expected %s)", k.Name, k.Role, strings.Join(Roles(), ", "))
+		}
+		if digest, err := hex.DecodeString(k.SHA256); err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("api key %s: sha256 must be a hex SHA-256 digest", k.Name)
+		}
+	}
+	for _, c := range cfg.ClientCertificates {
+		if _, ok := rolePermissions[c.Role]; !ok {
+			return nil, fmt.Errorf("client certificate %s: unknown role %q (expected %s)", c.Name, c.Role, strings.Join(Roles(), ", "))
+		}
+		if c.Fingerprint == "" && c.CommonName == "" {
+			return nil, fmt.Errorf("client certificate %s: fingerprint or common_name is required", c.Name)
+		}
+	}
+	return &authenticator{keys: cfg.APIKeys, certs: cfg.ClientCertificates}, nil
+}
+
+// authenticate identifies the caller from a verified client certificate or a
+// bearer API key, returning nil when neither matches
+func (a *authenticator) authenticate(r *http.Request) *Principal {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if p := a.matchCertificate(r.TLS.VerifiedChains[0][0]); p != nil {
+			return p
+		}
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil
+	}
+	digest := sha256.Sum256([]byte(token))
+	for _, k := range a.keys {
+		want, _ := hex.DecodeString(k.SHA256)
+		if subtle.ConstantTimeCompare(digest[:], want) == 1 {
+			return &Principal{Name: k.Name, Role: k.Role}
+		}
+	}
+	return nil
+}
+
+func (a *authenticator) matchCertificate(c *x509.Certificate) *Principal {
+	sum := sha256.Sum256(c.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	for _, cc := range a.certs {
+		if cc.Fingerprint != "" {
+			if strings.EqualFold(strings.ReplaceAll(cc.Fingerprint, ":", ""), fingerprint) {
+				return &Principal{Name: cc.Name, Role: cc.Role}
+			}
+			continue
+		}
+		if cc.CommonName == c.Subject.CommonName {
+			return &Principal{Name: cc.Name, Role: cc.Role}
+		}
+	}
+	return nil
+}
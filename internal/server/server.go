@@ -0,0 +1,268 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/history"
+	"github.com/webprofusion/trust-store-updater/internal/lock"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+// Backend performs the operations exposed by the API
+type Backend interface {
+	// Inventory returns the managed certificates of each configured store
+	Inventory() (map[string][]*state.ManagedCertificate, error)
+	// Sync runs an update of all stores. A bundleDigest pins the update to
+	// that bundle; another fetched bundle fails with updater.ErrBundleMismatch.
+	Sync(bundleDigest string) (*updater.Report, error)
+	// Restore restores a store from a backup
+	Restore(store, backup string) error
+	// LastRun returns the most recent update run, nil if none is known
+	LastRun() (*history.Run, error)
+	// Readiness checks the configuration and that each store is reachable
+	Readiness() []Check
+}
+
+// Server is the HTTP API used by dashboards and fleet controllers to query
+// and drive this agent. Every request is authenticated and checked against
+// the caller's role; mutating operations run one at a time.
+type Server struct {
+	cfg     config.Server
+	backend Backend
+	auth    *authenticator
+	mu      sync.Mutex // serializes sync and restore
+	paused  atomic.Bool
+	httpSrv *http.Server
+
+	healthMu  sync.Mutex // guards the cached readiness checks
+	checks    []Check
+	checkedAt time.Time
+}
+
+// New creates a server for cfg. At least one API key or client certificate
+// must be configured; there is no anonymous access.
+func New(cfg config.Server, backend Backend) (*Server, error) {
+	if len(cfg.APIKeys) == 0 && len(cfg.ClientCertificates) == 0 {
+		return nil, fmt.Errorf("no api_keys or client_certificates configured; refusing to serve without authentication")
+	}
+	if len(cfg.ClientCertificates) > 0 && cfg.ClientCA == "" {
+		return nil, fmt.Errorf("client_certificates require client_ca")
+	}
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{cfg: cfg, backend: backend, auth: auth}
+	s.httpSrv = &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// Handler returns the API routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/v1/inventory", s.route(http.MethodGet, PermReadInventory, s.handleInventory))
+	mux.Handle("/v1/sync", s.route(http.MethodPost, PermTriggerSync, s.handleSync))
+	mux.Handle("/v1/restore", s.route(http.MethodPost, PermRestoreBackups, s.handleRestore))
+	mux.Handle("/healthz", probe(s.handleHealth))
+	mux.Handle("/readyz", probe(s.handleReady))
+	return mux
+}
+
+// ListenAndServe serves the API, over TLS when a certificate is configured,
+// until Shutdown is called
+func (s *Server) ListenAndServe() error {
+	srv := s.httpSrv
+
+	if s.cfg.TLSCert == "" {
+		certstore.LogWarnf("Serving the API without TLS on %s; API keys are sent in clear text", s.cfg.Listen)
+		return srv.ListenAndServe()
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.cfg.ClientCA != "" {
+		data, err := os.ReadFile(s.cfg.ClientCA)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in client CA %s", s.cfg.ClientCA)
+		}
+		tlsConfig.ClientCAs = pool
+		// API key callers don't present certificates
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	srv.TLSConfig = tlsConfig
+	return srv.ListenAndServeTLS(s.cfg.TLSCert, s.cfg.TLSKey)
+}
+
+// Shutdown stops serving, waiting for requests in flight until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpSrv.Shutdown(ctx)
+}
+
+// SetPaused suspends or resumes syncs and restores, for example while a
+// service manager has the agent paused. Reads and probes keep working.
+func (s *Server) SetPaused(paused bool) {
+	s.paused.Store(paused)
+}
+
+// Paused reports whether syncs and restores are suspended
+func (s *Server) Paused() bool {
+	return s.paused.Load()
+}
+
+// Sync runs an update through the backend, one at a time with API requests.
+// bundleDigest pins the update to a bundle when not empty.
+func (s *Server) Sync(bundleDigest string) (*updater.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.backend.Sync(bundleDigest)
+}
+
+// route checks the method, authenticates the caller and enforces perm
+func (s *Server) route(method string, perm Permission, h func(http.ResponseWriter, *http.Request, *Principal)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		principal := s.auth.authenticate(r)
+		if principal == nil {
+			certstore.LogWarnf("API: unauthenticated %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		if !principal.Can(perm) {
+			certstore.LogWarnf("API: %s (role %s) denied %s", principal.Name, principal.Role, perm)
+			writeError(w, http.StatusForbidden, fmt.Sprintf("role %s does not grant %s", principal.Role, perm))
+			return
+		}
+		certstore.LogInfof("API: %s (role %s) %s %s", principal.Name, principal.Role, r.Method, r.URL.Path)
+		h(w, r, principal)
+	})
+}
+
+func (s *Server) handleInventory(w http.ResponseWriter, r *http.Request, _ *Principal) {
+	inventory, err := s.backend.Inventory()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"stores": inventory})
+}
+
+// syncRequest optionally pins a sync to the bundle with a given digest, so
+// that a staged rollout installs the same bundle on every agent
+type syncRequest struct {
+	BundleDigest string `json:"bundle_digest"`
+}
+
+// syncResponse summarizes a sync for API callers
+type syncResponse struct {
+	Fetched      int                    `json:"fetched"`
+	Rejected     int                    `json:"rejected"`
+	BundleDigest string                 `json:"bundle_digest,omitempty"`
+	Stores       []*updater.StoreReport `json:"stores"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request, _ *Principal) {
+	// The body is optional; callers that don't pin a bundle send none
+	var req syncRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "expected an empty body or a JSON body with bundle_digest")
+		return
+	}
+
+	if s.paused.Load() {
+		writeError(w, http.StatusServiceUnavailable, "agent is paused")
+		return
+	}
+
+	report, err := s.Sync(req.BundleDigest)
+	resp := syncResponse{}
+	if report != nil {
+		resp.Fetched = report.Fetched
+		resp.Rejected = len(report.Rejected)
+		resp.BundleDigest = report.BundleDigest
+		resp.Stores = report.Stores
+	}
+	status := http.StatusOK
+	if err != nil {
+		resp.Error = err.Error()
+		status = http.StatusInternalServerError
+		if errors.Is(err, lock.ErrHeld) || errors.Is(err, updater.ErrBundleMismatch) {
+			status = http.StatusConflict
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+// restoreRequest names the store and backup to restore
+type restoreRequest struct {
+	Store  string `json:"store"`
+	Backup string `json:"backup"`
+}
+
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request, _ *Principal) {
+	var req restoreRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil || req.Store == "" || req.Backup == "" {
+		writeError(w, http.StatusBadRequest, "expected a JSON body with store and backup")
+		return
+	}
+	// Backups are named, never given as paths
+	if strings.Contains(req.Backup, "..") || strings.ContainsAny(req.Backup, `/\`) {
+		writeError(w, http.StatusBadRequest, "backup must be the name of a backup in the backup directory")
+		return
+	}
+
+	if s.paused.Load() {
+		writeError(w, http.StatusServiceUnavailable, "agent is paused")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.backend.Restore(req.Store, req.Backup); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, certstore.ErrReadOnly) || errors.Is(err, lock.ErrHeld) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"restored": req.Store})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/history"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+	"github.com/webprofusion/trust-store-updater/internal/updater"
+)
+
+type fakeBackend struct {
+	synced   int
+	restored []string
+	lastRun  *history.Run
+	checks   []Check
+}
+
+func (f *fakeBackend) Inventory() (map[string][]*state.ManagedCertificate, error) {
+	return map[string][]*state.ManagedCertificate{"system": {{Subject: "CN=Example Root"}}}, nil
+}
+
+func (f *fakeBackend) Sync(bundleDigest string) (*updater.Report, error) {
+	f.synced++
+	report := &updater.Report{Fetched: 3, BundleDigest: "abc123"}
+	if bundleDigest != "" && bundleDigest != report.BundleDigest {
+		return report, updater.ErrBundleMismatch
+	}
+	return report, nil
+}
+
+func (f *fakeBackend) Restore(store, backup string) error {
+	f.restored = append(f.restored, store+"="+backup)
+	return nil
+}
+
+func (f *fakeBackend) LastRun() (*history.Run, error) {
+	return f.lastRun, nil
+}
+
+func (f *fakeBackend) Readiness() []Check {
+	return f.checks
+}
+
+func keyDigest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestRolePermissions(t *testing.T) {
+	backend := &fakeBackend{}
+	srv, err := New(config.Server{APIKeys: []config.APIKey{
+		{Name: "dashboard", SHA256: keyDigest("viewer-key"), Role: "viewer"},
+		{Name: "controller", SHA256: keyDigest("operator-key"), Role: "operator"},
+		{Name: "oncall", SHA256: keyDigest("admin-key"), Role: "admin"},
+	}}, backend)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		method, path, key string
+		want              int
+	}{
+		{http.MethodGet, "/v1/inventory", "", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/inventory", "wrong-key", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/inventory", "viewer-key", http.StatusOK},
+		{http.MethodPost, "/v1/sync", "viewer-key", http.StatusForbidden},
+		{http.MethodPost, "/v1/restore", "viewer-key", http.StatusForbidden},
+		{http.MethodGet, "/v1/sync", "operator-key", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/v1/sync", "operator-key", http.StatusOK},
+		{http.MethodPost, "/v1/restore", "operator-key", http.StatusForbidden},
+		{http.MethodPost, "/v1/restore", "admin-key", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(`{"store":"system","backup":"system_backup_1"}`))
+		if tt.key != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s with %q: status %d, want %d", tt.method, tt.path, tt.key, resp.StatusCode, tt.want)
+		}
+	}
+
+	if backend.synced != 1 || len(backend.restored) != 1 {
+		t.Errorf("expected one sync and one restore, got %d and %v", backend.synced, backend.restored)
+	}
+
+	// Backups are restored by name only
+	for _, backup := range []string{"/etc/ssl/evil.pem", "../system_backup_1", `..\system_backup_1`} {
+		body, _ := json.Marshal(map[string]string{"store": "system", "backup": backup})
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/restore", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("restore from %q: status %d, want 400", backup, resp.StatusCode)
+		}
+	}
+	if len(backend.restored) != 1 {
+		t.Errorf("a backup path reached the backend: %v", backend.restored)
+	}
+}
+
+func TestSyncPinnedBundle(t *testing.T) {
+	backend := &fakeBackend{}
+	srv, err := New(config.Server{APIKeys: []config.APIKey{
+		{Name: "controller", SHA256: keyDigest("operator-key"), Role: "operator"},
+	}}, backend)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"", http.StatusOK},
+		{`{"bundle_digest":"abc123"}`, http.StatusOK},
+		{`{"bundle_digest":"def456"}`, http.StatusConflict},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/sync", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer operator-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got syncResponse
+		_ = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("sync with %q: status %d, want %d", tt.body, resp.StatusCode, tt.want)
+		}
+		if tt.want != http.StatusBadRequest && got.BundleDigest != "abc123" {
+			t.Errorf("sync with %q: bundle_digest %q, want the fetched bundle's", tt.body, got.BundleDigest)
+		}
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	backend := &fakeBackend{
+		lastRun: &history.Run{FinishedAt: time.Now(), Outcome: history.OutcomeSuccess, Fetched: 3},
+		checks:  []Check{{Name: "config", OK: true}, {Name: "store:system", OK: true}},
+	}
+	srv, err := New(config.Server{APIKeys: []config.APIKey{{Name: "k", SHA256: keyDigest("k"), Role: "viewer"}}}, backend)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	get := func(path string) (int, healthResponse) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body healthResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, body
+	}
+
+	// Probes need no credentials
+	if status, body := get("/healthz"); status != http.StatusOK || body.LastRun == nil || body.LastRun.Fetched != 3 {
+		t.Errorf("healthz: status %d, last run %+v", status, body.LastRun)
+	}
+	if status, body := get("/readyz"); status != http.StatusOK || len(body.Checks) != 3 {
+		t.Errorf("readyz: status %d, checks %+v", status, body.Checks)
+	}
+
+	// A failed run makes the agent unready but not unhealthy
+	backend.lastRun = &history.Run{FinishedAt: time.Now(), Outcome: history.OutcomeFailure, Error: "fetch failed"}
+	if status, _ := get("/healthz"); status != http.StatusOK {
+		t.Errorf("healthz after a failed run: status %d", status)
+	}
+	if status, body := get("/readyz"); status != http.StatusServiceUnavailable || body.Status != "not ready" {
+		t.Errorf("readyz after a failed run: status %d (%s)", status, body.Status)
+	}
+
+	// Readiness checks are cached between probes
+	backend.lastRun = nil
+	backend.checks = []Check{{Name: "store:system", Detail: "unreachable"}}
+	if status, _ := get("/readyz"); status != http.StatusOK {
+		t.Errorf("readyz within the cache period: status %d", status)
+	}
+	srv.checkedAt = time.Time{}
+	if status, _ := get("/readyz"); status != http.StatusServiceUnavailable {
+		t.Errorf("readyz with an unreachable store: status %d", status)
+	}
+}
+
+func TestPausedRejectsChanges(t *testing.T) {
+	backend := &fakeBackend{}
+	srv, err := New(config.Server{APIKeys: []config.APIKey{{Name: "oncall", SHA256: keyDigest("admin-key"), Role: "admin"}}}, backend)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	srv.SetPaused(true)
+	for _, path := range []string{"/v1/sync", "/v1/restore"} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(`{"store":"system","backup":"system_backup_1"}`))
+		req.Header.Set("Authorization", "Bearer admin-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s while paused: status %d, want 503", path, resp.StatusCode)
+		}
+	}
+	if backend.synced != 0 || len(backend.restored) != 0 {
+		t.Errorf("expected no changes while paused, got %d syncs and %v", backend.synced, backend.restored)
+	}
+
+	srv.SetPaused(false)
+	if _, err := srv.Sync(""); err != nil || backend.synced != 1 {
+		t.Errorf("expected a sync after resuming, got %d (%v)", backend.synced, err)
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]config.Server{
+		"no credentials": {},
+		"unknown role":   {APIKeys: []config.APIKey{{Name: "k", SHA256: keyDigest("k"), Role: "root"}}},
+		"plain key":      {APIKeys: []config.APIKey{{Name: "k", SHA256: "k", Role: "viewer"}}},
+		"no client CA":   {ClientCertificates: []config.ClientCertificate{{Name: "c", CommonName: "c", Role: "viewer"}}},
+	} {
+		if _, err := New(cfg, &fakeBackend{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func newTestCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, key
+}
+
+func TestClientCertificateRole(t *testing.T) {
+	ca, caKey := newTestCert(t, "Client CA", true, nil, nil)
+	client, clientKey := newTestCert(t, "fleet-controller", false, ca, caKey)
+
+	srv, err := New(config.Server{
+		ClientCA:           "unused-in-test",
+		ClientCertificates: []config.ClientCertificate{{Name: "fleet", CommonName: "fleet-controller", Role: "viewer"}},
+	}, &fakeBackend{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(srv.Handler())
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	ts.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	ts.StartTLS()
+	defer ts.Close()
+
+	httpClient := ts.Client()
+	httpClient.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{{
+		Certificate: [][]byte{client.Raw},
+		PrivateKey:  clientKey,
+	}}
+
+	resp, err := httpClient.Get(ts.URL + "/v1/inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("inventory with client certificate: status %d", resp.StatusCode)
+	}
+
+	resp, err = httpClient.Post(ts.URL+"/v1/sync", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("viewer certificate triggering sync: status %d, want 403", resp.StatusCode)
+	}
+}
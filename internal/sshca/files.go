@@ -0,0 +1,146 @@
+package sshca
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+)
+
+// Markers delimiting the section of a file owned by this tool. Lines outside
+// the block are left untouched.
+const (
+	beginMarker = "# BEGIN trust-store-updater managed SSH CAs"
+	endMarker   = "# END trust-store-updater managed SSH CAs"
+)
+
+// TrustedUserCAKeysLines renders keys for an sshd TrustedUserCAKeys file
+func TrustedUserCAKeysLines(keys []PublicKey) []string {
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k.String())
+	}
+	return lines
+}
+
+// KnownHostsLines renders keys as known_hosts @cert-authority lines for the given host patterns
+func KnownHostsLines(keys []PublicKey, hosts string) []string {
+	if hosts == "" {
+		hosts = "*"
+	}
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, "@cert-authority "+hosts+" "+k.String())
+	}
+	return lines
+}
+
+// ManagedLines returns the lines currently inside the managed block of path
+func ManagedLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, managed, _ := splitManagedBlock(string(data))
+	return managed, nil
+}
+
+// WriteManagedBlock replaces the managed block in path with lines, creating the
+// file if needed. It reports whether the file content changed; when dryRun is
+// set nothing is written.
+func WriteManagedBlock(path string, lines []string, dryRun bool) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	before, current, after := splitManagedBlock(string(data))
+	if equalLines(current, lines) && (len(lines) > 0 || !strings.Contains(string(data), beginMarker)) {
+		return false, nil
+	}
+
+	var b strings.Builder
+	b.WriteString(before)
+	if len(lines) > 0 {
+		if before != "" && !strings.HasSuffix(before, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString(beginMarker + "\n")
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+		b.WriteString(endMarker + "\n")
+	}
+	b.WriteString(after)
+
+	if dryRun {
+		return true, nil
+	}
+	if err := writeFile(path, []byte(b.String())); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// writeFile replaces path, or the file a symlink at path points to, keeping
+// the existing file's mode and owner. New files are created 0644.
+func writeFile(path string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return atomicfile.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFileFunc(path, data, info.Mode().Perm(), func(tmp string) error {
+		return atomicfile.KeepOwner(tmp, info)
+	})
+}
+
+// splitManagedBlock returns the text before the block, the lines inside it and the text after it
+func splitManagedBlock(content string) (string, []string, string) {
+	start := strings.Index(content, beginMarker+"\n")
+	if start < 0 {
+		return content, nil, ""
+	}
+	rest := content[start+len(beginMarker)+1:]
+	end := strings.Index(rest, endMarker)
+	if end < 0 {
+		// Unterminated block: treat everything after the marker as managed
+		return content[:start], splitLines(rest), ""
+	}
+	after := strings.TrimPrefix(rest[end+len(endMarker):], "\n")
+	return content[:start], splitLines(rest[:end]), after
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
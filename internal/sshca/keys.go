@@ -0,0 +1,97 @@
+package sshca
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// supportedKeyTypes are the public key algorithms accepted for SSH CAs
+var supportedKeyTypes = map[string]bool{
+	"ssh-ed25519":                        true,
+	"ssh-rsa":                            true,
+	"ecdsa-sha2-nistp256":                true,
+	"ecdsa-sha2-nistp384":                true,
+	"ecdsa-sha2-nistp521":                true,
+	"sk-ssh-ed25519@openssh.com":         true,
+	"sk-ecdsa-sha2-nistp256@openssh.com": true,
+}
+
+// PublicKey is an SSH CA public key in authorized_keys format
+type PublicKey struct {
+	Type    string
+	Blob    []byte // wire format key, base64 encoded in the line
+	Comment string
+}
+
+// Fingerprint returns the OpenSSH SHA256 fingerprint of the key
+func (k PublicKey) Fingerprint() string {
+	sum := sha256.Sum256(k.Blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// String returns the key as a single authorized_keys style line
+func (k PublicKey) String() string {
+	line := k.Type + " " + base64.StdEncoding.EncodeToString(k.Blob)
+	if k.Comment != "" {
+		line += " " + k.Comment
+	}
+	return line
+}
+
+// ParsePublicKeys parses one key per line, skipping blank lines and comments.
+// Each key's declared type must match the type embedded in its blob.
+func ParsePublicKeys(data []byte) ([]PublicKey, error) {
+	var keys []PublicKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected \"<type> <base64 key> [comment]\"", lineNo)
+		}
+		if !supportedKeyTypes[fields[0]] {
+			return nil, fmt.Errorf("line %d: unsupported key type %s", lineNo, fields[0])
+		}
+
+		blob, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid base64 key: %w", lineNo, err)
+		}
+		if embedded, ok := blobKeyType(blob); !ok || embedded != fields[0] {
+			return nil, fmt.Errorf("line %d: key data does not match type %s", lineNo, fields[0])
+		}
+
+		keys = append(keys, PublicKey{
+			Type:    fields[0],
+			Blob:    blob,
+			Comment: strings.Join(fields[2:], " "),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// blobKeyType reads the algorithm name that prefixes an SSH wire format key
+func blobKeyType(blob []byte) (string, bool) {
+	if len(blob) < 4 {
+		return "", false
+	}
+	n := binary.BigEndian.Uint32(blob)
+	if uint64(n) > uint64(len(blob)-4) {
+		return "", false
+	}
+	return string(blob[4 : 4+n]), true
+}
@@ -0,0 +1,107 @@
+package sshca
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestKeyLine returns an ssh-ed25519 authorized_keys line for a fresh key
+func newTestKeyLine(t *testing.T, comment string) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blob []byte
+	for _, field := range [][]byte{[]byte("ssh-ed25519"), pub} {
+		blob = binary.BigEndian.AppendUint32(blob, uint32(len(field)))
+		blob = append(blob, field...)
+	}
+	return "ssh-ed25519 " + base64.StdEncoding.EncodeToString(blob) + " " + comment
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	data := "# user CA\n" + newTestKeyLine(t, "user-ca@corp") + "\n\n"
+	keys, err := ParsePublicKeys([]byte(data))
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("ParsePublicKeys = %d keys, %v", len(keys), err)
+	}
+	if keys[0].Comment != "user-ca@corp" || !strings.HasPrefix(keys[0].Fingerprint(), "SHA256:") {
+		t.Errorf("unexpected key %+v", keys[0])
+	}
+
+	mismatched := strings.Replace(newTestKeyLine(t, "x"), "ssh-ed25519", "ssh-rsa", 1)
+	if _, err := ParsePublicKeys([]byte(mismatched)); err == nil {
+		t.Error("expected error when declared type does not match key data")
+	}
+}
+
+func TestWriteManagedBlockPreservesOtherLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh_known_hosts")
+	if err := os.WriteFile(path, []byte("github.com ssh-ed25519 AAAA\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ParsePublicKeys([]byte(newTestKeyLine(t, "host-ca")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := KnownHostsLines(keys, "*.corp.example.com")
+
+	changed, err := WriteManagedBlock(path, lines, false)
+	if err != nil || !changed {
+		t.Fatalf("WriteManagedBlock = %v, %v; want changed", changed, err)
+	}
+	if changed, _ := WriteManagedBlock(path, lines, false); changed {
+		t.Error("rewriting identical lines should be a no-op")
+	}
+
+	managed, _ := ManagedLines(path)
+	if len(managed) != 1 || !strings.HasPrefix(managed[0], "@cert-authority *.corp.example.com ssh-ed25519 ") {
+		t.Errorf("unexpected managed lines %v", managed)
+	}
+
+	// Removing every key drops the block but keeps unmanaged entries
+	if _, err := WriteManagedBlock(path, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "github.com ssh-ed25519 AAAA\n" {
+		t.Errorf("unexpected file content after removal:\n%s", data)
+	}
+}
+
+func TestWriteManagedBlockKeepsModeAndSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "trusted_user_ca_keys")
+	if err := os.WriteFile(target, []byte("# local\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	if _, err := WriteManagedBlock(link, []string{newTestKeyLine(t, "user-ca")}, false); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink replaced by a regular file: %v", err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	if managed, _ := ManagedLines(target); len(managed) != 1 {
+		t.Errorf("symlink target not updated: %v", managed)
+	}
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrTampered is returned when the state file does not match its signature
+var ErrTampered = errors.New("state file signature verification failed")
+
+// Signer signs the serialized state on save and verifies it on load
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+	Verify(data, sig []byte) error
+}
+
+// NewSigner returns the signer for a settings.state_signing_key value:
+// "tpm:<handle>" for a persistent TPM key, otherwise the path of an Ed25519
+// private key, which is generated when it does not exist yet
+func NewSigner(spec string) (Signer, error) {
+	if handle, ok := strings.CutPrefix(spec, "tpm:"); ok {
+		return newTPMSigner(handle)
+	}
+	return loadOrCreateKey(spec)
+}
+
+// keySigner signs with an Ed25519 key held in a local file
+type keySigner struct {
+	key ed25519.PrivateKey
+}
+
+func loadOrCreateKey(path string) (*keySigner, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return createKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in state signing key %s", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state signing key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("state signing key %s is not an Ed25519 key", path)
+	}
+	return &keySigner{key: key}, nil
+}
+
+func createKey(path string) (*keySigner, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate state signing key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state signing key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state signing key directory: %w", err)
+	}
+	// O_EXCL so a key created concurrently is never overwritten
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create state signing key: %w", err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, fmt.Errorf("failed to write state signing key: %w", err)
+	}
+	return &keySigner{key: key}, nil
+}
+
+func (k *keySigner) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(k.key, data), nil
+}
+
+func (k *keySigner) Verify(data, sig []byte) error {
+	if !ed25519.Verify(k.key.Public().(ed25519.PublicKey), data, sig) {
+		return ErrTampered
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package state
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// tpmTimeout bounds each tpm2-tools command
+const tpmTimeout = time.Minute
+
+// tpmSigner signs with a persistent TPM key through tpm2-tools, so the
+// private key never leaves the TPM. The key is created once by the operator,
+// e.g. tpm2_createprimary -C o -g sha256 -G ecc256 -c primary.ctx &&
+// tpm2_evictcontrol -C o -c primary.ctx 0x81010010
+type tpmSigner struct {
+	handle string
+	public interface{}
+	runner certstore.Runner
+}
+
+func newTPMSigner(handle string) (*tpmSigner, error) {
+	if _, err := strconv.ParseUint(strings.TrimPrefix(handle, "0x"), 16, 32); err != nil || !strings.HasPrefix(handle, "0x") {
+		return nil, fmt.Errorf("invalid TPM key handle %q: expected a persistent handle such as 0x81010010", handle)
+	}
+
+	dir, err := os.MkdirTemp("", "tsu-tpm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	runner := certstore.CommandRunner{Timeout: tpmTimeout}
+	pubPath := filepath.Join(dir, "public.pem")
+	if _, err := runner.Run("tpm2_readpublic", "-c", handle, "-f", "pem", "-o", pubPath); err != nil {
+		return nil, fmt.Errorf("failed to read TPM key %s: %w", handle, err)
+	}
+	data, err := os.ReadFile(pubPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("tpm2_readpublic returned no PEM public key for %s", handle)
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TPM public key: %w", err)
+	}
+	switch public.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported TPM key type %T", public)
+	}
+	return &tpmSigner{handle: handle, public: public, runner: runner}, nil
+}
+
+func (t *tpmSigner) Sign(data []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "tsu-tpm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	scheme := "ecdsa"
+	if _, ok := t.public.(*rsa.PublicKey); ok {
+		scheme = "rsassa"
+	}
+	dataPath := filepath.Join(dir, "state.json")
+	sigPath := filepath.Join(dir, "state.sig")
+	if err := atomicfile.WriteFile(dataPath, data, 0600); err != nil {
+		return nil, err
+	}
+	// plain output is an ASN.1 signature for ECDSA and PKCS#1 v1.5 for RSA
+	args := []string{"-c", t.handle, "-g", "sha256", "-s", scheme, "-f", "plain", "-o", sigPath, dataPath}
+	if _, err := t.runner.Run("tpm2_sign", args...); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(sigPath)
+}
+
+// Verify needs only the public key read when the signer was created
+func (t *tpmSigner) Verify(data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	switch pub := t.public.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+	}
+	return ErrTampered
+}
@@ -0,0 +1,269 @@
+package state
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// State is the persisted manifest of everything this tool manages, keyed by store name
+type State struct {
+	path   string
+	signer Signer
+	Stores map[string]*StoreState `json:"stores"`
+	// Scan caches the certificates found in store directories between runs
+	Scan *certstore.ScanCache `json:"scan_cache,omitempty"`
+	// Versions are the trust sets evaluated by updates, keyed by ID
+	Versions map[string]*Version `json:"versions,omitempty"`
+}
+
+// StoreState holds the managed certificates for a single store
+type StoreState struct {
+	Managed  map[string]*ManagedCertificate `json:"managed"` // keyed by SHA-256 fingerprint
+	Baseline *Baseline                      `json:"baseline,omitempty"`
+	Version  string                         `json:"version,omitempty"` // ID of the version last applied
+	Staged   string                         `json:"staged,omitempty"`  // SHA-256 of the change staged for commit
+}
+
+// Baseline is a snapshot of a store's full contents, taken after a successful
+// run, that later listings are compared with to detect changes made outside the tool
+type Baseline struct {
+	TakenAt      time.Time         `json:"taken_at"`
+	Certificates map[string]string `json:"certificates"` // subject keyed by SHA-256 fingerprint
+	// TrustSettings digests the trust settings of certificates that have
+	// any, keyed by fingerprint, for stores that keep them separately
+	TrustSettings map[string]string `json:"trust_settings,omitempty"`
+	// TrustSettingsTaken is set when TrustSettings was recorded, even if empty
+	TrustSettingsTaken bool `json:"trust_settings_taken,omitempty"`
+}
+
+// ManagedCertificate records a certificate installed by this tool
+type ManagedCertificate struct {
+	Fingerprint string      `json:"fingerprint"`
+	Subject     string      `json:"subject"`
+	Source      string      `json:"source"`
+	NotAfter    time.Time   `json:"not_after"`
+	InstalledAt time.Time   `json:"installed_at"`
+	Provenance  *Provenance `json:"provenance,omitempty"`
+}
+
+// Provenance records where an installed certificate was obtained
+type Provenance struct {
+	Source       string    `json:"source"`
+	Location     string    `json:"location,omitempty"` // URL or file path of the bundle, or "aia" for fetched issuers
+	RetrievedAt  time.Time `json:"retrieved_at"`
+	BundleSHA256 string    `json:"bundle_sha256,omitempty"` // digest of the downloaded bundle or file
+}
+
+// Load reads the state file at path. A missing file yields an empty state.
+func Load(path string) (*State, error) {
+	return LoadSigned(path, nil)
+}
+
+// LoadSigned reads the state file at path and, when signer is not nil,
+// verifies it against the detached signature written by Save, so edits made
+// to hide an injected certificate are detected. Saves are signed with signer.
+// A missing state file next to a signature was deleted, which would wipe the
+// managed set and drift baselines, so it counts as tampering too.
+func LoadSigned(path string, signer Signer) (*State, error) {
+	s := &State{
+		path:   path,
+		signer: signer,
+		Stores: make(map[string]*StoreState),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if signer != nil {
+			if _, sigErr := os.Stat(SignaturePath(path)); sigErr == nil {
+				return nil, fmt.Errorf("%w: %s was deleted but its signature remains", ErrTampered, path)
+			}
+		}
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	if signer != nil {
+		if err := verifySignature(path, data, signer); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if s.Stores == nil {
+		s.Stores = make(map[string]*StoreState)
+	}
+
+	return s, nil
+}
+
+// SetSigner signs subsequent saves with signer, for example to sign a state
+// file that predates signing
+func (s *State) SetSigner(signer Signer) {
+	s.signer = signer
+}
+
+// Save writes the state back to the file it was loaded from
+func (s *State) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	var sig []byte
+	if s.signer != nil {
+		if sig, err = s.signer.Sign(data); err != nil {
+			return fmt.Errorf("failed to sign state: %w", err)
+		}
+	}
+
+	// The signature is written once the data it covers is in place
+	if err := atomicfile.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if sig != nil {
+		if err := atomicfile.WriteFile(SignaturePath(s.path), []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0600); err != nil {
+			return fmt.Errorf("failed to write state signature: %w", err)
+		}
+	}
+	return nil
+}
+
+// SignaturePath returns the detached signature file for a state file
+func SignaturePath(path string) string {
+	return path + ".sig"
+}
+
+func verifySignature(path string, data []byte, signer Signer) error {
+	encoded, err := os.ReadFile(SignaturePath(path))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s has no signature (run 'trust-store-updater state sign' after reviewing it if signing was just enabled)", ErrTampered, path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state signature: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature for %s", ErrTampered, path)
+	}
+	if err := signer.Verify(data, sig); err != nil {
+		return fmt.Errorf("%w: %s was modified outside trust-store-updater", ErrTampered, path)
+	}
+	return nil
+}
+
+// Store returns the state for the named store, creating it if needed
+func (s *State) Store(name string) *StoreState {
+	st, exists := s.Stores[name]
+	if !exists {
+		st = &StoreState{Managed: make(map[string]*ManagedCertificate)}
+		s.Stores[name] = st
+	}
+	if st.Managed == nil {
+		st.Managed = make(map[string]*ManagedCertificate)
+	}
+	return st
+}
+
+// ScanCache returns the persisted directory scan cache, creating it if needed
+func (s *State) ScanCache() *certstore.ScanCache {
+	if s.Scan == nil {
+		s.Scan = certstore.NewScanCache()
+	}
+	return s.Scan
+}
+
+// RecordManaged marks a certificate as installed into a store by this tool;
+// provenance may be nil when the origin is unknown
+func (s *State) RecordManaged(storeName string, c *x509.Certificate, source string, provenance *Provenance) {
+	fp := cert.GetCertificateFingerprint(c)
+	s.Store(storeName).Managed[fp] = &ManagedCertificate{
+		Fingerprint: fp,
+		Subject:     c.Subject.String(),
+		Source:      source,
+		NotAfter:    c.NotAfter,
+		InstalledAt: time.Now().UTC(),
+		Provenance:  provenance,
+	}
+}
+
+// Forget removes a certificate from a store's managed set
+func (s *State) Forget(storeName, fingerprint string) {
+	if st, exists := s.Stores[storeName]; exists {
+		delete(st.Managed, fingerprint)
+	}
+}
+
+// IsManaged reports whether the certificate with the given fingerprint is managed in the store
+func (s *State) IsManaged(storeName, fingerprint string) bool {
+	st, exists := s.Stores[storeName]
+	if !exists {
+		return false
+	}
+	_, managed := st.Managed[fingerprint]
+	return managed
+}
+
+// SetBaseline records certs as the expected contents of a store
+func (s *State) SetBaseline(storeName string, certs []*x509.Certificate) {
+	baseline := &Baseline{TakenAt: time.Now().UTC(), Certificates: make(map[string]string, len(certs))}
+	for _, c := range certs {
+		baseline.Certificates[cert.GetCertificateFingerprint(c)] = c.Subject.String()
+	}
+	s.Store(storeName).Baseline = baseline
+}
+
+// SetBaselineTrustSettings records settings as the expected trust settings
+// of a store, after SetBaseline
+func (s *State) SetBaselineTrustSettings(storeName string, settings map[string]string) {
+	if baseline := s.Baseline(storeName); baseline != nil {
+		baseline.TrustSettings = settings
+		baseline.TrustSettingsTaken = true
+	}
+}
+
+// Baseline returns the last snapshot of a store, or nil if none was taken
+func (s *State) Baseline(storeName string) *Baseline {
+	if st, exists := s.Stores[storeName]; exists {
+		return st.Baseline
+	}
+	return nil
+}
+
+// ManagedList returns the managed certificates for a store sorted by subject
+func (s *State) ManagedList(storeName string) []*ManagedCertificate {
+	st, exists := s.Stores[storeName]
+	if !exists {
+		return nil
+	}
+
+	list := make([]*ManagedCertificate, 0, len(st.Managed))
+	for _, mc := range st.Managed {
+		list = append(list, mc)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Subject != list[j].Subject {
+			return list[i].Subject < list[j].Subject
+		}
+		return list[i].Fingerprint < list[j].Fingerprint
+	})
+	return list
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignedState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	signer, err := NewSigner(filepath.Join(dir, "keys", "state.key"))
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+
+	st, err := LoadSigned(path, signer)
+	if err != nil {
+		t.Fatalf("LoadSigned of missing file: %v", err)
+	}
+	st.Store("system").Managed["abc"] = &ManagedCertificate{Fingerprint: "abc", Subject: "CN=Managed Root"}
+	if err := st.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// the generated key is reused rather than replaced
+	reloaded, err := NewSigner(filepath.Join(dir, "keys", "state.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSigned(path, reloaded); err != nil {
+		t.Fatalf("LoadSigned of untouched state: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), "CN=Managed Root", "CN=Hidden Root", 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSigned(path, reloaded); !errors.Is(err, ErrTampered) {
+		t.Errorf("expected ErrTampered for edited state, got %v", err)
+	}
+
+	os.Remove(SignaturePath(path))
+	if _, err := LoadSigned(path, reloaded); !errors.Is(err, ErrTampered) {
+		t.Errorf("expected ErrTampered for missing signature, got %v", err)
+	}
+	if _, err := Load(path); err != nil {
+		t.Errorf("unsigned Load: %v", err)
+	}
+
+	// Deleting the state file would wipe the managed set and baselines
+	if err := st.Save(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path)
+	if _, err := LoadSigned(path, reloaded); !errors.Is(err, ErrTampered) {
+		t.Errorf("expected ErrTampered for deleted state, got %v", err)
+	}
+}
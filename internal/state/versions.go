@@ -0,0 +1,152 @@
+package state
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// maxVersions is how many versions are kept besides those stores are at
+const maxVersions = 20
+
+// Version is an evaluated trust set. Its ID is the SHA-256 of the set's PEM
+// bundle, kept in the versions directory next to the state file, so the
+// same certificates always get the same ID and the bundle can be checked
+// against the (possibly signed) state.
+type Version struct {
+	ID           string    `json:"id"`
+	Label        string    `json:"label,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	Certificates int       `json:"certificates"`
+}
+
+// ShortID returns the abbreviated ID shown to users
+func (v *Version) ShortID() string {
+	return v.ID[:min(12, len(v.ID))]
+}
+
+// versionsDir holds the version bundles
+func (s *State) versionsDir() string {
+	return filepath.Join(filepath.Dir(s.path), "versions")
+}
+
+// RecordVersion stores certs as a version, giving it label when set, and
+// returns it. Recording a set that is already a version returns that
+// version, relabelled when label is set.
+func (s *State) RecordVersion(certs []*x509.Certificate, label string) (*Version, error) {
+	sorted := append([]*x509.Certificate(nil), certs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return cert.GetCertificateFingerprint(sorted[i]) < cert.GetCertificateFingerprint(sorted[j])
+	})
+	bundle := certstore.EncodePEMBundle(sorted)
+	sum := sha256.Sum256(bundle)
+	id := hex.EncodeToString(sum[:])
+
+	if s.Versions == nil {
+		s.Versions = make(map[string]*Version)
+	}
+	if v, ok := s.Versions[id]; ok {
+		if label != "" {
+			v.Label = label
+		}
+		return v, nil
+	}
+
+	if err := os.MkdirAll(s.versionsDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create versions directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(filepath.Join(s.versionsDir(), id+".pem"), bundle, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write version bundle: %w", err)
+	}
+	v := &Version{ID: id, Label: label, CreatedAt: time.Now().UTC(), Certificates: len(certs)}
+	s.Versions[id] = v
+	s.pruneVersions()
+	return v, nil
+}
+
+// pruneVersions drops the oldest versions beyond maxVersions that no store
+// is at, with their bundles
+func (s *State) pruneVersions() {
+	inUse := make(map[string]bool)
+	for _, st := range s.Stores {
+		inUse[st.Version] = true
+	}
+	list := s.VersionList()
+	for i := len(list) - 1; i >= maxVersions; i-- {
+		if v := list[i]; !inUse[v.ID] {
+			delete(s.Versions, v.ID)
+			os.Remove(filepath.Join(s.versionsDir(), v.ID+".pem"))
+		}
+	}
+}
+
+// VersionList returns the versions, newest first
+func (s *State) VersionList() []*Version {
+	list := make([]*Version, 0, len(s.Versions))
+	for _, v := range s.Versions {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// FindVersion returns the version with the given label, the newest when
+// several have it, or whose ID starts with ref
+func (s *State) FindVersion(ref string) (*Version, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("no version given")
+	}
+	var matches []*Version
+	for _, v := range s.VersionList() {
+		if v.Label == ref {
+			return v, nil
+		}
+		if strings.HasPrefix(v.ID, strings.ToLower(ref)) {
+			matches = append(matches, v)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no version matches %q", ref)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("%q matches %d versions; give more of the ID", ref, len(matches))
+}
+
+// VersionCertificates reads a version's certificates, checking the bundle
+// still matches the version's ID
+func (s *State) VersionCertificates(v *Version) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(filepath.Join(s.versionsDir(), v.ID+".pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle of version %s: %w", v.ShortID(), err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != v.ID {
+		return nil, fmt.Errorf("%w: the bundle of version %s was modified", ErrTampered, v.ShortID())
+	}
+	return certstore.ParsePEMBundle(data)
+}
+
+// SetStoreVersion records that a store holds version id
+func (s *State) SetStoreVersion(storeName, id string) {
+	s.Store(storeName).Version = id
+}
+
+// StoreVersion returns the version a store is at, nil if none was recorded
+func (s *State) StoreVersion(storeName string) *Version {
+	if st, exists := s.Stores[storeName]; exists && st.Version != "" {
+		return s.Versions[st.Version]
+	}
+	return nil
+}
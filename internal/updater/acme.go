@@ -0,0 +1,244 @@
+package updater
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/acme"
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/audit"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// RenewACMECertificates obtains or renews the configured ACME certificates
+// that are missing or due, all of them with force, and installs them into
+// their stores with a backup, audit entry and manifest update
+func (s *Service) RenewACMECertificates(force bool) error {
+	if len(s.config.ACME.Certificates) == 0 {
+		return fmt.Errorf("no ACME certificates configured")
+	}
+	if err := config.ValidateConfig(s.config); err != nil {
+		return fmt.Errorf("configuration validation failed: %w", err)
+	}
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	if err := s.initializeTrustStores(); err != nil {
+		return fmt.Errorf("failed to initialize trust stores: %w", err)
+	}
+	s.deferStores(time.Now())
+	failed := s.renewACMECertificates(force, nil)
+	for name := range s.changing {
+		s.finishChange(name, nil)
+	}
+	if !s.dryRun {
+		if err := s.state.Save(); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+	}
+	s.report.FinishedAt = time.Now()
+	s.report.Print(os.Stdout)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d ACME certificates failed", failed, len(s.config.ACME.Certificates))
+	}
+	return nil
+}
+
+// renewACMECertificates keeps each ACME certificate current and installed,
+// returning how many failed. The ACME server is only contacted for
+// certificates that are missing, due or forced. Stores whose backup failed
+// in backups are left alone; without backups each store is backed up before
+// its first change.
+func (s *Service) renewACMECertificates(force bool, backups *certstore.OperationResult) int {
+	cfg := s.config.ACME
+	if len(cfg.Certificates) == 0 {
+		return 0
+	}
+	storage := &acme.Storage{Dir: cfg.StorageDir}
+	before := time.Duration(cfg.RenewBeforeDays) * 24 * time.Hour
+
+	var client *acme.Client
+	failed := 0
+	for _, certConfig := range cfg.Certificates {
+		issued, err := storage.Load(certConfig.Name)
+		if err == nil && (issued == nil || force || issued.Due(certConfig.Domains, before)) {
+			if s.dryRun {
+				fmt.Printf("DRY RUN: would obtain ACME certificate %s for %s\n", certConfig.Name, strings.Join(certConfig.Domains, ", "))
+				continue
+			}
+			if client == nil {
+				client, err = s.acmeClient(storage)
+			}
+			if err == nil {
+				issued, err = s.obtainACMECertificate(client, storage, certConfig)
+			}
+		}
+		if err != nil {
+			failed++
+			certstore.LogWarnf("Failed to obtain ACME certificate %s: %v", certConfig.Name, err)
+			for _, name := range certConfig.Stores {
+				s.report.storeReport(name).Error = fmt.Sprintf("acme certificate %s: %v", certConfig.Name, err)
+			}
+			continue
+		}
+		if issued == nil {
+			continue
+		}
+
+		installFailed := false
+		for _, name := range certConfig.Stores {
+			if err := s.installACMECertificate(name, certConfig, issued, backups); err != nil {
+				installFailed = true
+				s.report.storeReport(name).Error = fmt.Sprintf("acme certificate %s: %v", certConfig.Name, err)
+				certstore.LogWarnf("Failed to install ACME certificate %s into store %s: %v", certConfig.Name, name, err)
+			}
+		}
+		if installFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// acmeClient registers (or finds) the account and returns a client for it
+func (s *Service) acmeClient(storage *acme.Storage) (*acme.Client, error) {
+	key, err := storage.AccountKey()
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(s.config.Settings.TimeoutSeconds) * time.Second
+	client := acme.NewClient(s.config.ACME.Directory, key, &http.Client{Timeout: timeout})
+	if err := client.Register(s.config.ACME.Email); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// obtainACMECertificate orders a certificate with a new key and stores it
+func (s *Service) obtainACMECertificate(client *acme.Client, storage *acme.Storage, certConfig config.ACMECertificate) (*acme.Certificate, error) {
+	key, err := acme.NewKey(certConfig.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := client.Obtain(certConfig.Domains, key, s.acmeSolver(certConfig))
+	if err != nil {
+		return nil, err
+	}
+	issued := &acme.Certificate{Chain: chain, Key: key}
+	if err := storage.Save(certConfig.Name, issued); err != nil {
+		return nil, err
+	}
+	certstore.LogInfof("Obtained ACME certificate %s for %s, valid until %s",
+		certConfig.Name, strings.Join(certConfig.Domains, ", "), issued.Leaf().NotAfter.Format("2006-01-02"))
+	return issued, nil
+}
+
+// acmeSolver returns the solver configured for a certificate
+func (s *Service) acmeSolver(certConfig config.ACMECertificate) acme.Solver {
+	switch {
+	case certConfig.Solver == acme.DNS01:
+		return &acme.DNSCommandSolver{
+			Command:     certConfig.DNSCommand,
+			Propagation: time.Duration(certConfig.DNSPropagationSeconds) * time.Second,
+			Runner:      certstore.CommandRunner{Timeout: s.commandTimeout(config.TrustStore{}), Verbose: s.verbose},
+		}
+	case certConfig.Webroot != "":
+		return &acme.WebrootSolver{Root: certConfig.Webroot}
+	}
+	return &acme.StandaloneSolver{Addr: certConfig.Listen}
+}
+
+// installACMECertificate adds the certificate and its key to a store that
+// doesn't hold the current leaf yet
+func (s *Service) installACMECertificate(name string, certConfig config.ACMECertificate, issued *acme.Certificate, backups *certstore.OperationResult) error {
+	store, ok := s.storeManager.GetStore(name)
+	if !ok {
+		return nil
+	}
+	adder, ok := store.(certstore.KeyedAdder)
+	if !ok {
+		return fmt.Errorf("store %s can't hold private keys", name)
+	}
+	current, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list current certificates: %w", err)
+	}
+	leaf := issued.Leaf()
+	if certstore.ContainsCertificate(current, leaf) {
+		return nil
+	}
+	if s.dryRun {
+		fmt.Printf("DRY RUN: Would install ACME certificate %s (%s) into store %s\n", certConfig.Name, cert.GetCertificateFingerprint(leaf), name)
+		return nil
+	}
+	if err := s.checkOperationApproval(approval.OpACME, name, acmeApprovalItems(certConfig)); err != nil {
+		return err
+	}
+	if s.deferChanges(name, 1, fmt.Sprintf("install ACME certificate %s", certConfig.Name)) {
+		return nil
+	}
+	if backups != nil && backups.Failed(name) {
+		return fmt.Errorf("skipped: backup failed")
+	}
+	if backups == nil {
+		if err := s.backupStore(name); err != nil {
+			return err
+		}
+	}
+	if err := s.beginChange(name); err != nil {
+		return err
+	}
+
+	label := certConfig.Label
+	if label == "" {
+		label = "acme-" + certConfig.Name
+	}
+	source := "acme:" + certConfig.Name
+	err = adder.AddCertificateWithKey(issued.Chain, issued.Key, label)
+	s.auditChange(name, store, newAuditEntry(audit.OpAdd, name, leaf, source), err)
+	if err == nil {
+		err = s.commitStore(name, store)
+	}
+	if err != nil {
+		return err
+	}
+	s.state.RecordManaged(name, leaf, source, nil)
+
+	storeReport := s.report.storeReport(name)
+	storeReport.Added++
+	storeReport.Installed = append(storeReport.Installed, Installation{
+		Fingerprint: cert.GetCertificateFingerprint(leaf),
+		Subject:     leaf.Subject.String(),
+		Source:      source,
+	})
+	certstore.LogInfof("Installed ACME certificate %s (%s) into store %s", certConfig.Name, cert.GetCertificateFingerprint(leaf), name)
+	return nil
+}
+
+// acmeCertificate returns the configured ACME certificate with the given name
+func (s *Service) acmeCertificate(name string) (config.ACMECertificate, bool) {
+	for _, certConfig := range s.config.ACME.Certificates {
+		if certConfig.Name == name {
+			return certConfig, true
+		}
+	}
+	return config.ACMECertificate{}, false
+}
+
+// acmeApprovalItems identifies an ACME certificate for approvals. Each
+// renewal has a new key and fingerprint, so its name and domains are
+// approved instead.
+func acmeApprovalItems(certConfig config.ACMECertificate) []string {
+	items := []string{"name:" + certConfig.Name}
+	for _, domain := range certConfig.Domains {
+		items = append(items, "domain:"+strings.ToLower(domain))
+	}
+	return items
+}
@@ -0,0 +1,92 @@
+package updater
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/acme"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// keyedStore is a memoryStore that also takes certificates with keys
+type keyedStore struct {
+	memoryStore
+	labels []string
+}
+
+func (k *keyedStore) AddCertificateWithKey(chain []*x509.Certificate, key crypto.Signer, label string) error {
+	k.certs = append(k.certs, chain[0])
+	k.labels = append(k.labels, label)
+	return nil
+}
+
+func TestRenewACMECertificatesInstallsStored(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{ACME: config.ACME{
+		StorageDir:      filepath.Join(t.TempDir(), "acme"),
+		RenewBeforeDays: 30,
+		Certificates: []config.ACMECertificate{{
+			Name:    "web",
+			Domains: []string{"www.example.com"},
+			Solver:  "http-01",
+			Stores:  []string{"keystore", "bundle"},
+		}},
+	}}
+	manager := certstore.NewStoreManager(nil, false)
+	keyed, plain := &keyedStore{}, &memoryStore{}
+	manager.AddStore("keystore", keyed)
+	manager.AddStore("bundle", plain)
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}}
+
+	// A stored certificate that isn't due is installed without contacting
+	// the ACME server, which isn't configured here
+	caKey := newTestKey(t)
+	ca := newTestCA(t, "ACME Test CA", caKey, time.Now().Add(365*24*time.Hour), nil, nil)
+	key := newTestKey(t)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	storage := &acme.Storage{Dir: cfg.ACME.StorageDir}
+	if err := storage.Save("web", &acme.Certificate{Chain: []*x509.Certificate{leaf, ca}, Key: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	if failed := s.renewACMECertificates(false, nil); failed != 1 {
+		t.Errorf("failed = %d, want 1 for the store that can't hold keys", failed)
+	}
+	if len(keyed.certs) != 1 || keyed.labels[0] != "acme-web" {
+		t.Fatalf("keyed store has %d certificates, labels %v", len(keyed.certs), keyed.labels)
+	}
+	if !strings.Contains(s.report.storeReport("bundle").Error, "can't hold private keys") {
+		t.Errorf("bundle error = %q", s.report.storeReport("bundle").Error)
+	}
+	if m := st.Store("keystore").Managed; len(m) != 1 {
+		t.Errorf("managed = %v", m)
+	}
+
+	// The next run finds the leaf in the store and leaves it alone
+	cfg.ACME.Certificates[0].Stores = []string{"keystore"}
+	if failed := s.renewACMECertificates(false, nil); failed != 0 || len(keyed.certs) != 1 {
+		t.Errorf("second run: failed = %d, %d certificates", failed, len(keyed.certs))
+	}
+}
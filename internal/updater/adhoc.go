@@ -0,0 +1,361 @@
+package updater
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// manualSource is the source recorded for certificates added from the command line
+const manualSource = "manual"
+
+// AddToStore installs the certificates in a PEM or DER file into one store
+// through the same validation, sealed anchor, approval, maintenance window,
+// confirmation, hook, backup, audit and manifest paths as an update.
+// Certificates already in the store are skipped.
+func (s *Service) AddToStore(name, path string) error {
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	store, err := s.adhocStore(name)
+	if err != nil {
+		return err
+	}
+	certs, provenance, err := s.readAdhocFile(path, manualSource)
+	if err != nil {
+		return err
+	}
+	err = s.addToAdhocStore(name, store, certs, provenance)
+	s.finishChange(name, err)
+	return err
+}
+
+// AddToAllStores installs the certificates in a PEM or DER file into every
+// configured store available on this host, as AddToStore does for one, with
+// source recorded as their source. A store that fails doesn't stop the others.
+func (s *Service) AddToAllStores(path, source string) error {
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	if s.config.Anchors.Sealed {
+		if err := s.openAnchors(); err != nil {
+			return err
+		}
+	}
+	if err := s.initializeTrustStores(); err != nil {
+		return fmt.Errorf("failed to initialize trust stores: %w", err)
+	}
+	s.deferStores(time.Now())
+	certs, provenance, err := s.readAdhocFile(path, source)
+	if err != nil {
+		return err
+	}
+
+	names := s.storeManager.StoreNames()
+	if len(names) == 0 {
+		return fmt.Errorf("no configured stores are available on this host")
+	}
+	var errs []error
+	for _, name := range names {
+		store, _ := s.storeManager.GetStore(name)
+		err := s.addToAdhocStore(name, store, certs, provenance)
+		s.finishChange(name, err)
+		if err != nil {
+			if errors.Is(err, ErrAborted) {
+				return err
+			}
+			errs = append(errs, fmt.Errorf("store %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readAdhocFile reads the certificates of a file given on the command line
+// with its provenance
+func (s *Service) readAdhocFile(path, source string) ([]*x509.Certificate, *state.Provenance, error) {
+	bundle, err := s.fetcher.FetchFileBundle(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	location, _ := filepath.Abs(path)
+	return bundle.Certificates, &state.Provenance{
+		Source:       source,
+		Location:     location,
+		RetrievedAt:  bundle.RetrievedAt,
+		BundleSHA256: bundle.SHA256,
+	}, nil
+}
+
+// addToAdhocStore validates certs against the store's policy and adds those
+// it doesn't hold yet, backing the store up first. A certificate that fails
+// doesn't stop the others, and the manifest is saved either way.
+func (s *Service) addToAdhocStore(name string, store certstore.CertificateStore, certs []*x509.Certificate, provenance *state.Provenance) error {
+	storeConfig, _ := s.storeConfig(name)
+	policy := s.policy
+	policy.RequireCA = storeConfig.RequiresCA()
+
+	var candidates []*Certificate
+	for _, c := range certs {
+		if err := s.fetcher.ValidateCertificate(c, policy); err != nil {
+			return fmt.Errorf("certificate %s rejected: %w", c.Subject.String(), err)
+		}
+		candidates = append(candidates, &Certificate{
+			X509Cert:   c,
+			Source:     provenance.Source,
+			Info:       cert.GetCertificateInfo(c),
+			Provenance: provenance,
+		})
+	}
+
+	current, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list current certificates: %w", err)
+	}
+	toAdd := s.findCertificatesToAdd(current, candidates)
+	toAdd, blocked := s.sealedOnly(name, toAdd)
+	if blocked > 0 {
+		return fmt.Errorf("%d certificate(s) are not in the sealed trust anchor list", blocked)
+	}
+	if len(toAdd) == 0 {
+		fmt.Printf("All certificates in %s are already in store %s\n", provenance.Location, name)
+		return nil
+	}
+
+	if s.dryRun {
+		for _, c := range toAdd {
+			fmt.Printf("DRY RUN: Would add %s (%s) to store %s\n", c.X509Cert.Subject.String(), cert.GetCertificateFingerprint(c.X509Cert), name)
+		}
+		return nil
+	}
+	if err := checkWritable(store); err != nil {
+		return err
+	}
+	if err := s.checkOperationApproval(approval.OpAdd, name, adhocApprovalItems(candidates)); err != nil {
+		return err
+	}
+	if s.deferChanges(name, len(toAdd), fmt.Sprintf("add %d certificates", len(toAdd))) {
+		return nil
+	}
+	if s.confirm != nil {
+		approved, err := s.confirm(StorePlan{Store: name, Add: toAdd})
+		if err != nil {
+			return err
+		}
+		if !approved {
+			fmt.Printf("Store %s left unchanged: not confirmed\n", name)
+			return nil
+		}
+	}
+	if err := s.backupStore(name); err != nil {
+		return err
+	}
+	if err := s.beginChange(name); err != nil {
+		return err
+	}
+
+	var errs []error
+	var added []*Certificate
+	for _, c := range toAdd {
+		if err := s.addCertificate(name, store, c); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add %s to store %s: %w", c.X509Cert.Subject.String(), name, err))
+			continue
+		}
+		added = append(added, c)
+		certstore.LogDebugf("Added certificate %s (%s) to store %s from %s",
+			c.X509Cert.Subject.CommonName, cert.GetCertificateFingerprint(c.X509Cert), name, provenance.Location)
+	}
+	if err := s.commitStore(name, store); err != nil {
+		for _, c := range added {
+			s.state.Forget(name, cert.GetCertificateFingerprint(c.X509Cert))
+		}
+		errs = append(errs, err)
+	}
+	if err := s.state.Save(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save state: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveFromStore removes one certificate from a store, identified by its
+// SHA-256 fingerprint (or a unique prefix of it) or by its subject, through
+// the same approval, maintenance window, confirmation and hook paths as an
+// addition, with a backup, audit entry and manifest update
+func (s *Service) RemoveFromStore(name, fingerprint, subject string) error {
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	store, err := s.adhocStore(name)
+	if err != nil {
+		return err
+	}
+
+	current, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list current certificates: %w", err)
+	}
+	target, err := matchCertificate(current, fingerprint, subject)
+	if err != nil {
+		return fmt.Errorf("store %s: %w", name, err)
+	}
+
+	fp := cert.GetCertificateFingerprint(target)
+	if s.dryRun {
+		fmt.Printf("DRY RUN: Would remove %s (%s) from store %s\n", target.Subject.String(), fp, name)
+		return nil
+	}
+	if err := checkWritable(store); err != nil {
+		return err
+	}
+	if err := s.checkOperationApproval(approval.OpRemove, name, []string{fp}); err != nil {
+		return err
+	}
+	if s.deferChanges(name, 1, "remove "+target.Subject.String()) {
+		return nil
+	}
+	if s.confirm != nil {
+		source := manualSource
+		if managed, ok := s.state.Store(name).Managed[fp]; ok {
+			source = managed.Source
+		}
+		approved, err := s.confirm(StorePlan{Store: name, Remove: []*Certificate{{X509Cert: target, Source: source}}})
+		if err != nil {
+			return err
+		}
+		if !approved {
+			fmt.Printf("Store %s left unchanged: not confirmed\n", name)
+			return nil
+		}
+	}
+	if err := s.backupStore(name); err != nil {
+		return err
+	}
+	if err := s.beginChange(name); err != nil {
+		return err
+	}
+	err = s.removeAdhoc(name, store, target)
+	s.finishChange(name, err)
+	return err
+}
+
+// removeAdhoc removes target from a store, saving the manifest whether or
+// not the removal is published
+func (s *Service) removeAdhoc(name string, store certstore.CertificateStore, target *x509.Certificate) error {
+	fp := cert.GetCertificateFingerprint(target)
+	source := manualSource
+	managed, wasManaged := s.state.Store(name).Managed[fp]
+	if wasManaged {
+		source = managed.Source
+	}
+	if err := s.removeCertificate(name, store, target, source); err != nil {
+		return fmt.Errorf("failed to remove %s from store %s: %w", target.Subject.String(), name, err)
+	}
+	var errs []error
+	if err := s.commitStore(name, store); err != nil {
+		// Nothing was published, so the certificate is still in the store
+		if wasManaged {
+			s.state.Store(name).Managed[fp] = managed
+		}
+		errs = append(errs, err)
+	} else {
+		certstore.LogInfof("Removed certificate %s (%s) from store %s", target.Subject.CommonName, fp, name)
+	}
+	if err := s.state.Save(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save state: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// adhocApprovalItems returns the fingerprints an ad hoc addition is approved
+// by: every certificate in the file, so the approver can compute them
+// without knowing what the store already holds
+func adhocApprovalItems(certs []*Certificate) []string {
+	items := make([]string, len(certs))
+	for i, c := range certs {
+		items[i] = cert.GetCertificateFingerprint(c.X509Cert)
+	}
+	return items
+}
+
+// adhocStore opens the named store for a one-off change
+func (s *Service) adhocStore(name string) (certstore.CertificateStore, error) {
+	if s.config.Anchors.Sealed {
+		if err := s.openAnchors(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.initializeTrustStores(); err != nil {
+		return nil, fmt.Errorf("failed to initialize trust stores: %w", err)
+	}
+	s.deferStores(time.Now())
+	store, exists := s.storeManager.GetStore(name)
+	if !exists {
+		return nil, fmt.Errorf("store %s is not configured or not available on this platform", name)
+	}
+	return store, nil
+}
+
+// backupStore backs up one store before a change when backups are enabled,
+// unless this run backed it up already
+func (s *Service) backupStore(name string) error {
+	if !s.config.Settings.BackupEnabled || s.backedUp[name] {
+		return nil
+	}
+	backupPath, err := s.storeManager.BackupStore(name, s.config.Settings.BackupDirectory)
+	if err != nil {
+		return fmt.Errorf("backup of store %s failed, not modifying it: %w", name, err)
+	}
+	if s.backedUp != nil {
+		s.backedUp[name] = true
+	}
+	certstore.LogInfof("Backed up store %s to %s", name, backupPath)
+	return nil
+}
+
+// matchCertificate finds the single certificate with the given fingerprint
+// prefix, or whose subject or common name equals subject
+func matchCertificate(certs []*x509.Certificate, fingerprint, subject string) (*x509.Certificate, error) {
+	fingerprint = normalizeFingerprint(fingerprint)
+
+	var matches []*x509.Certificate
+	seen := make(map[string]bool)
+	for _, c := range certs {
+		fp := cert.GetCertificateFingerprint(c)
+		if seen[fp] {
+			continue
+		}
+		switch {
+		case fingerprint != "" && strings.HasPrefix(fp, fingerprint):
+		case fingerprint == "" && (c.Subject.String() == subject || c.Subject.CommonName == subject):
+		default:
+			continue
+		}
+		seen[fp] = true
+		matches = append(matches, c)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no matching certificate")
+	case 1:
+		return matches[0], nil
+	}
+	descriptions := make([]string, len(matches))
+	for i, c := range matches {
+		descriptions[i] = fmt.Sprintf("%s (%s)", c.Subject.String(), cert.GetCertificateFingerprint(c))
+	}
+	return nil, fmt.Errorf("%d certificates match, use a longer --fingerprint: %s", len(matches), strings.Join(descriptions, ", "))
+}
@@ -0,0 +1,156 @@
+package updater
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+func TestMatchCertificate(t *testing.T) {
+	expiry := time.Now().Add(24 * time.Hour)
+	first := newTestCA(t, "Example Root", newTestKey(t), expiry, nil, nil)
+	second := newTestCA(t, "Example Root", newTestKey(t), expiry, nil, nil)
+	other := newTestCA(t, "Other Root", newTestKey(t), expiry, nil, nil)
+	certs := []*x509.Certificate{first, second, other, other}
+
+	fp := cert.GetCertificateFingerprint(other)
+	colons := strings.ToUpper(fp[0:2] + ":" + fp[2:4] + ":" + fp[4:12])
+	for _, query := range []string{fp, fp[:12], colons} {
+		if got, err := matchCertificate(certs, query, ""); err != nil || got != other {
+			t.Errorf("fingerprint %q: got %v, %v", query, got, err)
+		}
+	}
+	if got, err := matchCertificate(certs, "", "CN=Other Root"); err != nil || got != other {
+		t.Errorf("subject: got %v, %v", got, err)
+	}
+
+	if _, err := matchCertificate(certs, "", "Example Root"); err == nil || !strings.Contains(err.Error(), "2 certificates match") {
+		t.Errorf("expected an ambiguous subject to fail, got %v", err)
+	}
+	if _, err := matchCertificate(certs, strings.Repeat("0", 64), ""); err == nil {
+		t.Error("expected no match for an unknown fingerprint")
+	}
+}
+
+// rejectingStore is a memoryStore that refuses one certificate
+type rejectingStore struct {
+	memoryStore
+	reject *x509.Certificate
+}
+
+func (r *rejectingStore) AddCertificate(c *x509.Certificate) error {
+	if c.Equal(r.reject) {
+		return errors.New("rejected")
+	}
+	return r.memoryStore.AddCertificate(c)
+}
+
+func TestAddToAdhocStoreSavesPartialChanges(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	st, err := state.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{config: &config.Config{}, state: st, report: &Report{}, fetcher: cert.NewFetcher(5, false)}
+	expiry := time.Now().Add(24 * time.Hour)
+	good := newTestCA(t, "Good Root", newTestKey(t), expiry, nil, nil)
+	bad := newTestCA(t, "Bad Root", newTestKey(t), expiry, nil, nil)
+	store := &rejectingStore{reject: bad}
+	provenance := &state.Provenance{Source: manualSource, Location: "roots.pem"}
+
+	var planned []StorePlan
+	s.SetConfirm(func(plan StorePlan) (bool, error) {
+		planned = append(planned, plan)
+		return false, nil
+	})
+	if err := s.addToAdhocStore("memory", store, []*x509.Certificate{good, bad}, provenance); err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 1 || len(planned[0].Add) != 2 || len(store.certs) != 0 {
+		t.Fatalf("a declined ad-hoc add changed the store: %v", planned)
+	}
+
+	s.SetConfirm(nil)
+	err = s.addToAdhocStore("memory", store, []*x509.Certificate{bad, good}, provenance)
+	if err == nil || !strings.Contains(err.Error(), "Bad Root") {
+		t.Fatalf("expected the rejected certificate to be reported, got %v", err)
+	}
+	if len(store.certs) != 1 || !store.certs[0].Equal(good) {
+		t.Fatal("a failed certificate stopped the others being added")
+	}
+
+	saved, err := state.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.IsManaged("memory", cert.GetCertificateFingerprint(good)) || saved.IsManaged("memory", cert.GetCertificateFingerprint(bad)) {
+		t.Error("the saved manifest doesn't match what was added")
+	}
+}
+
+func TestRemoveFromStoreAsksForConfirmation(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := certstore.NewStoreManager(nil, false)
+	root := newTestCA(t, "Removed Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	store := &removingStore{memoryStore{certs: []*x509.Certificate{root}}}
+	manager.AddStore("memory", store)
+	s := &Service{config: &config.Config{}, state: st, storeManager: manager, report: &Report{}}
+
+	var planned []StorePlan
+	s.SetConfirm(func(plan StorePlan) (bool, error) {
+		planned = append(planned, plan)
+		return false, nil
+	})
+	if err := s.RemoveFromStore("memory", cert.GetCertificateFingerprint(root), ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 1 || len(planned[0].Remove) != 1 || len(planned[0].Add) != 0 {
+		t.Fatalf("removal plan = %v", planned)
+	}
+	if len(store.certs) != 1 {
+		t.Fatal("a declined removal changed the store")
+	}
+
+	s.SetConfirm(func(StorePlan) (bool, error) { return true, nil })
+	if err := s.RemoveFromStore("memory", cert.GetCertificateFingerprint(root), ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.certs) != 0 {
+		t.Error("a confirmed removal left the certificate in the store")
+	}
+}
+
+func TestAdhocApprovalsBindOperationAndStore(t *testing.T) {
+	root := newTestCA(t, "Approved Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	fp := cert.GetCertificateFingerprint(root)
+	add := approval.OperationDigest(approval.OpAdd, "system", adhocApprovalItems([]*Certificate{{X509Cert: root}}))
+	if add == approval.OperationDigest(approval.OpRemove, "system", []string{fp}) {
+		t.Error("an approval to add a certificate also approves removing it")
+	}
+
+	s := &Service{config: &config.Config{}, fetcher: cert.NewFetcher(5, false)}
+	path := filepath.Join(t.TempDir(), "root.pem")
+	if err := os.WriteFile(path, certstore.EncodePEMBundle([]*x509.Certificate{root}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digests, err := s.OperationDigests(OperationApproval{Op: approval.OpAdd, Stores: []string{"system"}, Arg: path})
+	if err != nil || len(digests) != 1 || digests[0] != add {
+		t.Errorf("approve --add digests = %v, %v; want %s", digests, err, add)
+	}
+	if _, err := s.OperationDigests(OperationApproval{Op: approval.OpRemove, Stores: []string{"system"}, Arg: fp[:12]}); err == nil {
+		t.Error("a fingerprint prefix was accepted for a removal approval")
+	}
+}
@@ -0,0 +1,45 @@
+package updater
+
+import (
+	"fmt"
+
+	"github.com/webprofusion/trust-store-updater/internal/anchors"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// openAnchors loads the sealed trust anchor list, failing closed when it is
+// missing or does not match its sealed digest
+func (s *Service) openAnchors() error {
+	sealer, err := anchors.NewSealer(s.config.Anchors.Backend, s.config.Anchors.NVIndex)
+	if err != nil {
+		return err
+	}
+	list, err := anchors.Open(s.config.Anchors.File, sealer)
+	if err != nil {
+		return fmt.Errorf("sealed trust anchors: %w", err)
+	}
+	if s.verbose {
+		fmt.Printf("Sealed trust anchor list: %d fingerprints verified against %s\n", list.Len(), sealer.Name())
+	}
+	s.anchors = list
+	return nil
+}
+
+// sealedOnly drops certificates missing from the sealed trust anchor list
+func (s *Service) sealedOnly(storeName string, certs []*Certificate) (allowed []*Certificate, blocked int) {
+	if s.anchors == nil {
+		return certs, 0
+	}
+	for _, c := range certs {
+		fp := cert.GetCertificateFingerprint(c.X509Cert)
+		if s.anchors.Contains(fp) {
+			allowed = append(allowed, c)
+			continue
+		}
+		blocked++
+		certstore.LogWarnf("Not installing %s (%s) into store %s: not in the sealed trust anchor list",
+			c.X509Cert.Subject.CommonName, fp, storeName)
+	}
+	return allowed, blocked
+}
@@ -0,0 +1,28 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/platform/darwin"
+)
+
+// fetchAppleRoots snapshots the local macOS root store for an apple source
+func (s *Service) fetchAppleRoots() (*cert.Bundle, error) {
+	runner := certstore.CommandRunner{Timeout: s.commandTimeout(config.TrustStore{}), Verbose: s.verbose}
+	roots, err := darwin.AppleRoots(runner)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(certstore.EncodePEMBundle(roots))
+	return &cert.Bundle{
+		Location:     darwin.SystemRootsKeychain,
+		SHA256:       hex.EncodeToString(digest[:]),
+		RetrievedAt:  time.Now().UTC(),
+		Certificates: roots,
+	}, nil
+}
@@ -0,0 +1,169 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// bundleDigest identifies the merged certificate set for approvals
+func bundleDigest(certs []*Certificate) string {
+	fingerprints := make([]string, len(certs))
+	for i, c := range certs {
+		fingerprints[i] = cert.GetCertificateFingerprint(c.X509Cert)
+	}
+	return approval.BundleDigest(fingerprints)
+}
+
+// approvalRequired reports whether changes on this host need a signed approval
+func (s *Service) approvalRequired() bool {
+	return approval.Required(s.config.Settings.HostTags, s.config.Approval.RequiredForTags)
+}
+
+// checkApproval refuses to continue on hosts that require approval unless
+// the configured approval file covers exactly certs
+func (s *Service) checkApproval(certs []*Certificate) error {
+	if !s.approvalRequired() {
+		return nil
+	}
+	// A signed plan approves exactly the changes it lists
+	if s.plan != nil && s.plan.approver != "" {
+		return nil
+	}
+	return s.verifyApproval(bundleDigest(certs), "the certificate bundle")
+}
+
+// checkOperationApproval refuses a one-off change to a store on hosts that
+// require approval unless the approval file lists the operation's digest,
+// see approval.OperationDigest
+func (s *Service) checkOperationApproval(op, store string, items []string) error {
+	if !s.approvalRequired() {
+		return nil
+	}
+	return s.verifyApproval(approval.OperationDigest(op, store, items), fmt.Sprintf("%s on store %s", op, store))
+}
+
+// verifyApproval checks the configured approval file against digest
+func (s *Service) verifyApproval(digest, what string) error {
+	cfg := s.config.Approval
+	if cfg.AllowedSigners == "" {
+		return fmt.Errorf("%w: host tags %v require approval but approval.allowed_signers is not configured",
+			approval.ErrNotApproved, s.config.Settings.HostTags)
+	}
+
+	a, err := approval.Verify(cfg.File, cfg.AllowedSigners, digest, time.Now())
+	if err != nil {
+		return fmt.Errorf("%w (needed for %s, digest %s)", err, what, digest)
+	}
+	certstore.LogInfof("Trust changes approved by %s at %s (expires %s)",
+		a.Approver, a.ApprovedAt.Format(time.RFC3339), a.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// NewApproval fetches the merged bundle and returns an unsigned approval of
+// it by approver, valid for validFor
+func (s *Service) NewApproval(approver string, validFor time.Duration) (*approval.Approval, error) {
+	certs, err := s.MergedCertificates()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &approval.Approval{
+		BundleDigest: bundleDigest(certs),
+		Certificates: len(certs),
+		Approver:     approver,
+		ApprovedAt:   now,
+		ExpiresAt:    now.Add(validFor),
+	}, nil
+}
+
+// NewOperationApproval returns an unsigned approval of a one-off change by
+// approver, valid for validFor
+func (s *Service) NewOperationApproval(approver string, validFor time.Duration, op OperationApproval) (*approval.Approval, error) {
+	digests, err := s.OperationDigests(op)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &approval.Approval{
+		Operations: digests,
+		Approver:   approver,
+		ApprovedAt: now,
+		ExpiresAt:  now.Add(validFor),
+	}, nil
+}
+
+// OperationApproval names a one-off change for OperationDigests: Op is one
+// of the approval.Op constants and Arg what it applies, i.e. a certificate
+// file to add, a fingerprint to remove, a backup name to restore, a version
+// to roll back to or an ACME certificate name
+type OperationApproval struct {
+	Op     string
+	Stores []string
+	Arg    string
+}
+
+// OperationDigests returns the approval digests of a one-off change, one per
+// store. ACME changes without stores apply to every store the certificate is
+// configured for.
+func (s *Service) OperationDigests(op OperationApproval) ([]string, error) {
+	stores := op.Stores
+	var items []string
+	switch op.Op {
+	case approval.OpAdd:
+		bundle, err := s.fetcher.FetchFileBundle(op.Arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range bundle.Certificates {
+			items = append(items, cert.GetCertificateFingerprint(c))
+		}
+	case approval.OpRemove:
+		fp := normalizeFingerprint(op.Arg)
+		if len(fp) != 64 {
+			return nil, fmt.Errorf("removals are approved by full SHA-256 fingerprint")
+		}
+		items = []string{fp}
+	case approval.OpRestore:
+		var err error
+		if items, err = s.restoreItems(op.Arg); err != nil {
+			return nil, err
+		}
+	case approval.OpRollback:
+		// Version IDs are content digests, so a full ID can be approved
+		// without this host's state
+		id := strings.ToLower(op.Arg)
+		if len(id) != 64 {
+			v, err := s.state.FindVersion(op.Arg)
+			if err != nil {
+				return nil, err
+			}
+			id = v.ID
+		}
+		items = []string{id}
+	case approval.OpACME:
+		certConfig, ok := s.acmeCertificate(op.Arg)
+		if !ok {
+			return nil, fmt.Errorf("no ACME certificate %s is configured", op.Arg)
+		}
+		items = acmeApprovalItems(certConfig)
+		if len(stores) == 0 {
+			stores = certConfig.Stores
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+	if len(stores) == 0 {
+		return nil, fmt.Errorf("the stores to approve %s for are required", op.Op)
+	}
+
+	digests := make([]string, len(stores))
+	for i, store := range stores {
+		digests[i] = approval.OperationDigest(op.Op, store, items)
+	}
+	return digests, nil
+}
@@ -0,0 +1,33 @@
+package updater
+
+import (
+	"path/filepath"
+
+	"github.com/webprofusion/trust-store-updater/internal/authroot"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// fetchAuthRoot mirrors Microsoft's trusted root program for an authroot
+// source; source defaults to Windows Update's authrootstl.cab
+func (s *Service) fetchAuthRoot(source config.CertificateSource) (*cert.Bundle, error) {
+	url := source.Source
+	if url == "" {
+		url = authroot.DefaultURL
+	}
+	purposes, err := authroot.ParsePurposes(source.Purposes)
+	if err != nil {
+		return nil, err
+	}
+	opts := cert.AuthRootOptions{Headers: source.Headers, Purposes: purposes, InsecureSkipVerify: source.InsecureSkipVerify}
+	if source.SignerCA != "" {
+		if opts.SignerCAs, err = cert.LoadPinnedCAs(source.SignerCA); err != nil {
+			return nil, err
+		}
+	}
+	// Roots are kept next to the AIA cache, e.g. ./cache/authroot
+	if dir := s.config.Settings.AIACacheDir; dir != "" {
+		opts.CacheDir = filepath.Join(filepath.Dir(filepath.Clean(dir)), "authroot")
+	}
+	return s.fetcher.FetchAuthRoot(url, opts)
+}
@@ -0,0 +1,121 @@
+package updater
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// Composition modes for combining root programs
+const (
+	CompositionUnion        = "union"        // trusted by any program
+	CompositionIntersection = "intersection" // trusted by every program
+	CompositionWeighted     = "weighted"     // trusted by programs weighing at least the threshold
+)
+
+// composeSources applies the composition to the fetched certificates of each
+// source, dropping CAs the composed programs don't agree on. A composed
+// source that failed to fetch fails the run, rather than an intersection
+// silently widening or a weighted vote losing a voter.
+func (s *Service) composeSources(allCerts map[string][]*Certificate) (map[string][]*Certificate, error) {
+	c := s.config.Composition
+	if c.Mode == "" || c.Mode == CompositionUnion {
+		return allCerts, nil
+	}
+
+	composed := c.Sources
+	if len(composed) == 0 {
+		for _, source := range s.config.CertificateSources {
+			composed = append(composed, source.Name)
+		}
+	}
+	var programs []string
+	for _, name := range composed {
+		source, ok := s.sourceConfig(name)
+		if !ok || !source.Enabled || !s.conditions.source(name) {
+			continue // not part of this run
+		}
+		if _, fetched := allCerts[name]; !fetched {
+			return nil, fmt.Errorf("composition: source %s could not be fetched", name)
+		}
+		programs = append(programs, name)
+	}
+
+	weight := func(name string) int {
+		if c.Mode == CompositionIntersection {
+			return 1
+		}
+		if w, ok := c.Weights[name]; ok {
+			return w
+		}
+		return 1
+	}
+	threshold := c.Threshold
+	if c.Mode == CompositionIntersection {
+		threshold = len(programs)
+	}
+
+	// Programs including each CA, by public key
+	members := make(map[string]map[string]bool)
+	for _, name := range programs {
+		for _, certificate := range allCerts[name] {
+			spki := cert.GetSPKIFingerprint(certificate.X509Cert)
+			if members[spki] == nil {
+				members[spki] = make(map[string]bool)
+			}
+			members[spki][name] = true
+		}
+	}
+	trusted := func(spki string) (bool, string) {
+		total := 0
+		var in []string
+		for name := range members[spki] {
+			total += weight(name)
+			in = append(in, name)
+		}
+		sort.Strings(in)
+		return total >= threshold, fmt.Sprintf("composition: only in %s (weight %d, %s needs %d)", strings.Join(in, ", "), total, c.Mode, threshold)
+	}
+
+	result := make(map[string][]*Certificate, len(allCerts))
+	for name, certs := range allCerts {
+		result[name] = certs
+	}
+	excluded := 0
+	for _, name := range programs {
+		var kept []*Certificate
+		for _, certificate := range allCerts[name] {
+			ok, reason := trusted(cert.GetSPKIFingerprint(certificate.X509Cert))
+			if ok {
+				kept = append(kept, certificate)
+				continue
+			}
+			excluded++
+			s.report.Rejected = append(s.report.Rejected, Rejection{
+				Subject:     certificate.X509Cert.Subject.String(),
+				Fingerprint: cert.GetCertificateFingerprint(certificate.X509Cert),
+				Source:      name,
+				Reason:      reason,
+			})
+		}
+		result[name] = kept
+	}
+
+	if s.verbose {
+		fmt.Printf("Composition (%s of %s) excluded %d certificates\n", c.Mode, strings.Join(programs, ", "), excluded)
+	}
+	return result, nil
+}
+
+// sourceConfig returns the configuration of the named source
+func (s *Service) sourceConfig(name string) (config.CertificateSource, bool) {
+	for _, source := range s.config.CertificateSources {
+		if source.Name == name {
+			return source, true
+		}
+	}
+	return config.CertificateSource{}, false
+}
@@ -0,0 +1,69 @@
+package updater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+func TestComposeSources(t *testing.T) {
+	expiry := time.Now().Add(24 * time.Hour)
+	sharedKey := newTestKey(t)
+	shared := newTestCA(t, "Shared Root", sharedKey, expiry, nil, nil)
+	// A re-issued copy of the same CA still counts as present in both programs
+	reissued := newTestCA(t, "Shared Root", sharedKey, expiry.Add(time.Hour), nil, nil)
+	mozillaOnly := newTestCA(t, "Mozilla Only Root", newTestKey(t), expiry, nil, nil)
+	microsoftOnly := newTestCA(t, "Microsoft Only Root", newTestKey(t), expiry, nil, nil)
+	local := newTestCA(t, "Local Root", newTestKey(t), expiry, nil, nil)
+
+	fetched := func() map[string][]*Certificate {
+		return map[string][]*Certificate{
+			"mozilla":   {{X509Cert: shared, Source: "mozilla"}, {X509Cert: mozillaOnly, Source: "mozilla"}},
+			"microsoft": {{X509Cert: reissued, Source: "microsoft"}, {X509Cert: microsoftOnly, Source: "microsoft"}},
+			"local":     {{X509Cert: local, Source: "local"}},
+		}
+	}
+	sources := []config.CertificateSource{
+		{Name: "mozilla", Enabled: true}, {Name: "microsoft", Enabled: true}, {Name: "local", Enabled: true},
+	}
+	count := func(certs map[string][]*Certificate) int {
+		n := 0
+		for _, c := range certs {
+			n += len(c)
+		}
+		return n
+	}
+
+	cases := []struct {
+		name        string
+		composition config.Composition
+		want        int
+	}{
+		{"union", config.Composition{}, 5},
+		{"intersection", config.Composition{Mode: "intersection", Sources: []string{"mozilla", "microsoft"}}, 3},
+		{"intersection of all", config.Composition{Mode: "intersection"}, 0},
+		{"weighted", config.Composition{Mode: "weighted", Sources: []string{"mozilla", "microsoft"},
+			Weights: map[string]int{"mozilla": 2}, Threshold: 2}, 4},
+	}
+	for _, c := range cases {
+		s := &Service{config: &config.Config{CertificateSources: sources, Composition: c.composition}, report: &Report{}}
+		got, err := s.composeSources(fetched())
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if n := count(got); n != c.want {
+			t.Errorf("%s: kept %d certificates, want %d", c.name, n, c.want)
+		}
+		if len(got["local"]) != 1 && c.composition.Sources != nil {
+			t.Errorf("%s: uncomposed source was filtered", c.name)
+		}
+	}
+
+	s := &Service{config: &config.Config{CertificateSources: sources, Composition: config.Composition{Mode: "intersection"}}, report: &Report{}}
+	partial := fetched()
+	delete(partial, "microsoft")
+	if _, err := s.composeSources(partial); err == nil {
+		t.Error("expected a failed composed source to fail the composition")
+	}
+}
@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"fmt"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/facts"
+)
+
+// conditions holds the compiled when: conditions of stores and sources and
+// the host facts they are evaluated against, gathered on first use
+type conditions struct {
+	stores  map[string]*facts.Condition // by store name
+	sources map[string]*facts.Condition // by source name
+	facts   *facts.Facts
+}
+
+func compileConditions(cfg *config.Config) (*conditions, error) {
+	c := &conditions{stores: make(map[string]*facts.Condition), sources: make(map[string]*facts.Condition)}
+	for _, store := range cfg.TrustStores {
+		if store.When == "" {
+			continue
+		}
+		cond, err := facts.Compile(store.When)
+		if err != nil {
+			return nil, fmt.Errorf("trust store %s: %w", store.Name, err)
+		}
+		c.stores[store.Name] = cond
+	}
+	for _, source := range cfg.CertificateSources {
+		if source.When == "" {
+			continue
+		}
+		cond, err := facts.Compile(source.When)
+		if err != nil {
+			return nil, fmt.Errorf("certificate source %s: %w", source.Name, err)
+		}
+		c.sources[source.Name] = cond
+	}
+	return c, nil
+}
+
+func (c *conditions) eval(cond *facts.Condition) bool {
+	if cond == nil {
+		return true
+	}
+	if c.facts == nil {
+		c.facts = facts.Gather()
+	}
+	return cond.Eval(c.facts)
+}
+
+// store reports whether the named store's condition holds on this host
+func (c *conditions) store(name string) bool {
+	if c == nil {
+		return true
+	}
+	return c.eval(c.stores[name])
+}
+
+// source reports whether the named source's condition holds on this host
+func (c *conditions) source(name string) bool {
+	if c == nil {
+		return true
+	}
+	return c.eval(c.sources[name])
+}
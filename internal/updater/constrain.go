@@ -0,0 +1,63 @@
+package updater
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/constrain"
+)
+
+// constrainCertificates replaces the source's self-signed roots with copies
+// cross-signed by the local name constraints root, and adds that root.
+// Intermediates and end-entity certificates are kept as they are.
+func (s *Service) constrainCertificates(source config.CertificateSource, certs []*Certificate) ([]*Certificate, error) {
+	nc := source.NameConstraints
+	w, err := constrain.Open(nc.Directory, constrain.Constraints{
+		PermittedDNSDomains: nc.PermittedDNSDomains,
+		ExcludedDNSDomains:  nc.ExcludedDNSDomains,
+		PermittedIPRanges:   nc.PermittedIPRanges,
+		ExcludedIPRanges:    nc.ExcludedIPRanges,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("certificate source %s: %w", source.Name, err)
+	}
+
+	wrapped := false
+	for _, c := range certs {
+		if !c.X509Cert.IsCA || !isSelfSigned(c.X509Cert) {
+			continue
+		}
+		cross, err := w.Wrap(c.X509Cert)
+		if err != nil {
+			return nil, fmt.Errorf("certificate source %s: %w", source.Name, err)
+		}
+		if s.verbose {
+			fmt.Printf("Name constraining %s\n", c.X509Cert.Subject.CommonName)
+		}
+		c.X509Cert = cross
+		wrapped = true
+	}
+	if !wrapped {
+		return certs, nil
+	}
+
+	root := w.Root()
+	label, err := s.labelers[source.Name].Label(root, source.Name)
+	if err != nil {
+		return nil, err
+	}
+	return append(certs, &Certificate{
+		X509Cert: root,
+		Source:   source.Name,
+		Label:    label,
+		Purposes: source.TrustPurposes,
+		Info:     cert.GetCertificateInfo(root),
+	}), nil
+}
+
+func isSelfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawSubject, c.RawIssuer) && c.CheckSignatureFrom(c) == nil
+}
@@ -0,0 +1,49 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+func TestConstrainCertificates(t *testing.T) {
+	dir := t.TempDir()
+	root := newTestCA(t, "Internal Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	if err := os.WriteFile(filepath.Join(dir, "root.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{CertificateSources: []config.CertificateSource{{
+		Name: "internal", Type: "directory", Source: dir, Enabled: true,
+		NameConstraints: &config.NameConstraints{
+			Directory:           filepath.Join(t.TempDir(), "constraints"),
+			PermittedDNSDomains: []string{"corp.example"},
+		},
+	}}}
+	s := &Service{config: cfg, fetcher: cert.NewFetcher(5, false), report: &Report{}}
+
+	results, err := s.TestSources(nil)
+	if err != nil {
+		t.Fatalf("TestSources: %v", err)
+	}
+	accepted := results[0].Accepted
+	if len(accepted) != 2 {
+		t.Fatalf("expected the cross-signed root and the constraining root, got %d certificates", len(accepted))
+	}
+	cross, local := accepted[0].X509Cert, accepted[1].X509Cert
+	if cross.Equal(root) || cross.Subject.String() != root.Subject.String() || !bytes.Equal(cross.RawSubjectPublicKeyInfo, root.RawSubjectPublicKeyInfo) {
+		t.Error("root was not replaced by a cross-signed copy with its subject and key")
+	}
+	if err := cross.CheckSignatureFrom(local); err != nil {
+		t.Errorf("cross-signed root not issued by the constraining root: %v", err)
+	}
+	if len(cross.PermittedDNSDomains) != 1 || len(local.PermittedDNSDomains) != 1 {
+		t.Error("name constraints missing")
+	}
+}
@@ -0,0 +1,114 @@
+package updater
+
+import (
+	"crypto/x509"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+)
+
+// Duplicate handling policies for certificates sharing the same public key
+const (
+	DuplicatePolicyAll      = "all"      // install every variant
+	DuplicatePolicyShortest = "shortest" // keep the variant that expires first
+	DuplicatePolicyLongest  = "longest"  // keep the variant that expires last
+)
+
+// DuplicateGroup describes certificates from the fetched sources that share a
+// SubjectPublicKeyInfo, i.e. exact duplicates or cross-signed/re-issued variants
+type DuplicateGroup struct {
+	SPKI         string
+	Subject      string
+	Variants     []*Certificate
+	Kept         []*Certificate
+	CrossSigned  bool // variants differ by issuer
+	ExactCopies  int  // number of byte-identical copies that were collapsed
+	SourceCounts map[string]int
+}
+
+// dedupeCertificates collapses exact duplicates and applies the duplicate
+// policy to SPKI variants. Input order is preserved for the kept certificates.
+func dedupeCertificates(certs []*Certificate, policy string) ([]*Certificate, []DuplicateGroup) {
+	var order []string
+	groups := make(map[string]*DuplicateGroup)
+	seen := make(map[string]bool)
+
+	for _, c := range certs {
+		spki := cert.GetSPKIFingerprint(c.X509Cert)
+		group, exists := groups[spki]
+		if !exists {
+			group = &DuplicateGroup{
+				SPKI:         spki,
+				Subject:      c.X509Cert.Subject.String(),
+				SourceCounts: make(map[string]int),
+			}
+			groups[spki] = group
+			order = append(order, spki)
+		}
+		group.SourceCounts[c.Source]++
+
+		fp := cert.GetCertificateFingerprint(c.X509Cert)
+		if seen[fp] {
+			group.ExactCopies++
+			continue
+		}
+		seen[fp] = true
+		group.Variants = append(group.Variants, c)
+	}
+
+	var kept []*Certificate
+	var duplicates []DuplicateGroup
+	for _, spki := range order {
+		group := groups[spki]
+		group.Kept = selectVariants(group.Variants, policy)
+		group.CrossSigned = hasDistinctIssuers(group.Variants)
+		kept = append(kept, group.Kept...)
+
+		if len(group.Variants) > 1 || group.ExactCopies > 0 {
+			duplicates = append(duplicates, *group)
+		}
+	}
+
+	return kept, duplicates
+}
+
+// selectVariants picks which SPKI variants to install according to the policy
+func selectVariants(variants []*Certificate, policy string) []*Certificate {
+	if len(variants) <= 1 || policy == DuplicatePolicyAll || policy == "" {
+		return variants
+	}
+
+	best := variants[0]
+	for _, v := range variants[1:] {
+		switch policy {
+		case DuplicatePolicyShortest:
+			if v.X509Cert.NotAfter.Before(best.X509Cert.NotAfter) {
+				best = v
+			}
+		case DuplicatePolicyLongest:
+			if v.X509Cert.NotAfter.After(best.X509Cert.NotAfter) {
+				best = v
+			}
+		}
+	}
+	return []*Certificate{best}
+}
+
+func hasDistinctIssuers(variants []*Certificate) bool {
+	for _, v := range variants[1:] {
+		if v.X509Cert.Issuer.String() != variants[0].X509Cert.Issuer.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSPKIVariant reports whether the store already holds a certificate with the same public key
+func hasSPKIVariant(current []*x509.Certificate, c *x509.Certificate) bool {
+	spki := cert.GetSPKIFingerprint(c)
+	for _, existing := range current {
+		if cert.GetSPKIFingerprint(existing) == spki {
+			return true
+		}
+	}
+	return false
+}
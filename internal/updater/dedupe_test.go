@@ -0,0 +1,87 @@
+package updater
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+// newTestCA issues a CA certificate for key, signed by parent (self-signed when parent is nil)
+func newTestCA(t *testing.T, cn string, key *ecdsa.PrivateKey, notAfter time.Time, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return c
+}
+
+func TestDedupeCertificates(t *testing.T) {
+	rootKey := newTestKey(t)
+	otherKey := newTestKey(t)
+	otherRoot := newTestCA(t, "Other Root", otherKey, time.Now().Add(48*time.Hour), nil, nil)
+
+	selfSigned := newTestCA(t, "Example Root", rootKey, time.Now().Add(24*time.Hour), nil, nil)
+	crossSigned := newTestCA(t, "Example Root", rootKey, time.Now().Add(72*time.Hour), otherRoot, otherKey)
+
+	certs := []*Certificate{
+		{X509Cert: selfSigned, Source: "a"},
+		{X509Cert: selfSigned, Source: "b"},
+		{X509Cert: crossSigned, Source: "b"},
+		{X509Cert: otherRoot, Source: "a"},
+	}
+
+	kept, duplicates := dedupeCertificates(certs, DuplicatePolicyAll)
+	if len(kept) != 3 {
+		t.Fatalf("policy all: expected 3 certificates, got %d", len(kept))
+	}
+	if len(duplicates) != 1 {
+		t.Fatalf("expected 1 duplicate group, got %d", len(duplicates))
+	}
+	if !duplicates[0].CrossSigned || duplicates[0].ExactCopies != 1 || len(duplicates[0].Variants) != 2 {
+		t.Fatalf("unexpected duplicate group: %+v", duplicates[0])
+	}
+
+	kept, _ = dedupeCertificates(certs, DuplicatePolicyLongest)
+	if len(kept) != 2 || !kept[0].X509Cert.Equal(crossSigned) {
+		t.Fatalf("policy longest: expected cross-signed variant to be kept")
+	}
+
+	kept, _ = dedupeCertificates(certs, DuplicatePolicyShortest)
+	if len(kept) != 2 || !kept[0].X509Cert.Equal(selfSigned) {
+		t.Fatalf("policy shortest: expected self-signed variant to be kept")
+	}
+}
@@ -0,0 +1,260 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// distrustList holds the reasons certificates are distrusted, by fingerprint
+// and by subject or common name
+type distrustList struct {
+	fingerprints map[string]string
+	subjects     map[string]string
+}
+
+// match returns why c is distrusted, if it is
+func (d *distrustList) match(c *x509.Certificate) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+	if reason, ok := d.fingerprints[cert.GetCertificateFingerprint(c)]; ok {
+		return reason, true
+	}
+	if reason, ok := d.subjects[c.Subject.String()]; ok {
+		return reason, true
+	}
+	if reason, ok := d.subjects[c.Subject.CommonName]; ok && c.Subject.CommonName != "" {
+		return reason, true
+	}
+	return "", false
+}
+
+func (d *distrustList) len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.fingerprints) + len(d.subjects)
+}
+
+// loadDistrusted resolves the distrusted_certificates section, fetching URL
+// lists. A list that can't be fetched is reported but doesn't stop the
+// configured entries from being enforced.
+func (s *Service) loadDistrusted() (*distrustList, error) {
+	d := &distrustList{fingerprints: make(map[string]string), subjects: make(map[string]string)}
+	var failed []string
+	for _, entry := range s.config.Distrusted {
+		reason := entry.Reason
+		if reason == "" {
+			reason = "distrusted"
+		}
+		switch {
+		case entry.Fingerprint != "":
+			d.fingerprints[normalizeFingerprint(entry.Fingerprint)] = reason
+		case entry.Subject != "":
+			d.subjects[entry.Subject] = reason
+		case entry.URL != "":
+			data, err := s.fetcher.FetchRaw(entry.URL, nil)
+			if err == nil {
+				err = s.parseDistrustList(d, data, reason)
+			}
+			if err != nil {
+				certstore.LogWarnf("Failed to fetch distrust list %s: %v", entry.URL, err)
+				failed = append(failed, entry.URL)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return d, fmt.Errorf("failed to fetch distrust lists: %s", strings.Join(failed, ", "))
+	}
+	return d, nil
+}
+
+// parseDistrustList adds the certificates in a fetched list: PEM certificates,
+// or one fingerprint per line optionally followed by "# reason"
+func (s *Service) parseDistrustList(d *distrustList, data []byte, reason string) error {
+	if bytes.Contains(data, []byte("-----BEGIN CERTIFICATE-----")) {
+		certs, err := s.fetcher.ParseCertificates(data)
+		if err != nil {
+			return err
+		}
+		for _, c := range certs {
+			d.fingerprints[cert.GetCertificateFingerprint(c)] = reason
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		lineReason := reason
+		if fp, comment, found := strings.Cut(text, "#"); found {
+			text, lineReason = strings.TrimSpace(fp), strings.TrimSpace(comment)
+		}
+		fp := normalizeFingerprint(text)
+		if len(fp) != 64 || strings.Trim(fp, "0123456789abcdef") != "" {
+			return fmt.Errorf("line %d: %q is not a SHA-256 fingerprint", line, text)
+		}
+		d.fingerprints[fp] = lineReason
+	}
+	return scanner.Err()
+}
+
+// withoutDistrusted drops distrusted certificates from the fetched set so
+// they are never installed, recording them as rejected
+func (s *Service) withoutDistrusted(certs []*Certificate, distrusted *distrustList) []*Certificate {
+	if distrusted.len() == 0 {
+		return certs
+	}
+	var kept []*Certificate
+	for _, c := range certs {
+		if reason, ok := distrusted.match(c.X509Cert); ok {
+			s.report.Rejected = append(s.report.Rejected, Rejection{
+				Subject:     c.X509Cert.Subject.String(),
+				Fingerprint: cert.GetCertificateFingerprint(c.X509Cert),
+				Source:      c.Source,
+				Reason:      "distrusted: " + reason,
+			})
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// removeDistrusted removes every distrusted certificate from a store,
+// whether or not this tool installed it, through the guards of an update:
+// read-only stores get their read_only_output instead, critical stores have
+// the removals staged, and the rest wait for a maintenance window, approval
+// and confirmation and follow a backup. The removals are confirmed together
+// before any is made; ErrAborted from the confirmation stops the update.
+func (s *Service) removeDistrusted(name string, store certstore.CertificateStore, distrusted *distrustList) error {
+	if distrusted.len() == 0 {
+		return nil
+	}
+	current, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list current certificates: %w", err)
+	}
+
+	storeReport := s.report.storeReport(name)
+	seen := make(map[string]bool)
+	var removals []*Certificate
+	reasons := make(map[*x509.Certificate]string)
+	for _, c := range current {
+		reason, ok := distrusted.match(c)
+		fp := cert.GetCertificateFingerprint(c)
+		if !ok || seen[fp] {
+			continue
+		}
+		seen[fp] = true
+		if !s.inPlan(OpRemove, name, c) {
+			storeReport.Unplanned++
+			continue
+		}
+
+		source := "distrusted"
+		if managed, ok := s.state.Store(name).Managed[fp]; ok {
+			source = managed.Source
+		}
+		if s.dryRun {
+			fmt.Printf("DRY RUN: Would remove distrusted certificate %s (%s) from store %s: %s\n", c.Subject.String(), fp, name, reason)
+			storeReport.Removed++
+			s.recordChange(OpRemove, name, c, source, "distrusted: "+reason)
+			continue
+		}
+		removals = append(removals, &Certificate{X509Cert: c, Source: source})
+		reasons[c] = reason
+	}
+	if len(removals) == 0 {
+		return nil
+	}
+
+	if err := checkWritable(store); err != nil {
+		return s.readOnlyFallback(name, withoutCertificates(current, removals), nil, err)
+	}
+	if s.isCritical(name) {
+		if s.removals == nil {
+			s.removals = make(map[string][]*Certificate)
+		}
+		s.removals[name] = removals
+		return s.stageChanges(name, current, nil, removals)
+	}
+	if s.deferChanges(name, len(removals), fmt.Sprintf("remove %d distrusted certificates", len(removals))) {
+		return nil
+	}
+	if err := s.checkRemovalApproval(name, removals); err != nil {
+		return err
+	}
+	if s.confirm != nil {
+		approved, err := s.confirm(StorePlan{Store: name, Remove: removals})
+		if err != nil {
+			return err
+		}
+		if !approved {
+			certstore.LogWarnf("%d distrusted certificates left in store %s: not confirmed", len(removals), name)
+			return nil
+		}
+	}
+	if err := s.backupStore(name); err != nil {
+		return err
+	}
+	if err := s.beginChange(name); err != nil {
+		return err
+	}
+	for _, r := range removals {
+		c := r.X509Cert
+		if err := s.removeCertificate(name, store, c, r.Source); err != nil {
+			storeReport.Failed++
+			certstore.LogWarnf("Failed to remove distrusted certificate %s from store %s: %v", c.Subject.CommonName, name, err)
+			continue
+		}
+		storeReport.Removed++
+		certstore.LogWarnf("Removed distrusted certificate %s (%s) from store %s: %s", c.Subject.String(), cert.GetCertificateFingerprint(c), name, reasons[c])
+	}
+	return s.commitStore(name, store)
+}
+
+// checkRemovalApproval requires, on hosts that need approval, an approval of
+// removing each certificate from the store, as the remove command does,
+// unless a signed plan lists the removals
+func (s *Service) checkRemovalApproval(name string, certs []*Certificate) error {
+	if !s.approvalRequired() || (s.plan != nil && s.plan.approver != "") {
+		return nil
+	}
+	for _, c := range certs {
+		if err := s.checkOperationApproval(approval.OpRemove, name, []string{cert.GetCertificateFingerprint(c.X509Cert)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutCertificates returns certs less those in removed
+func withoutCertificates(certs []*x509.Certificate, removed []*Certificate) []*x509.Certificate {
+	skip := make(map[string]bool)
+	for _, c := range removed {
+		skip[cert.GetCertificateFingerprint(c.X509Cert)] = true
+	}
+	var kept []*x509.Certificate
+	for _, c := range certs {
+		if !skip[cert.GetCertificateFingerprint(c)] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// normalizeFingerprint lower-cases a hex fingerprint and strips colons
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
@@ -0,0 +1,194 @@
+package updater
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+func TestDistrustedCertificates(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := time.Now().Add(24 * time.Hour)
+	kept := newTestCA(t, "Kept Root", newTestKey(t), expiry, nil, nil)
+	byFingerprint := newTestCA(t, "Compromised Root", newTestKey(t), expiry, nil, nil)
+	bySubject := newTestCA(t, "Retired Root", newTestKey(t), expiry, nil, nil)
+	fromList := newTestCA(t, "Listed Root", newTestKey(t), expiry, nil, nil)
+
+	cfg := &config.Config{Distrusted: []config.DistrustedCertificate{
+		{Fingerprint: strings.ToUpper(cert.GetCertificateFingerprint(byFingerprint)), Reason: "key compromise"},
+		{Subject: "Retired Root"},
+	}}
+	s := &Service{config: cfg, fetcher: cert.NewFetcher(5, false), state: st, report: &Report{}}
+	distrusted, err := s.loadDistrusted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := cert.GetCertificateFingerprint(fromList) + "  # mis-issuance\n# comment\n"
+	if err := s.parseDistrustList(distrusted, []byte(list), "listed"); err != nil {
+		t.Fatalf("fingerprint list: %v", err)
+	}
+	if err := s.parseDistrustList(distrusted, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: fromList.Raw}), "listed"); err != nil {
+		t.Fatalf("PEM list: %v", err)
+	}
+	if err := s.parseDistrustList(distrusted, []byte("not-a-fingerprint\n"), "listed"); err == nil {
+		t.Error("expected an invalid list line to fail")
+	}
+
+	fetched := []*Certificate{{X509Cert: kept, Source: "test"}, {X509Cert: byFingerprint, Source: "test"}}
+	if got := s.withoutDistrusted(fetched, distrusted); len(got) != 1 || got[0].X509Cert != kept {
+		t.Errorf("expected only the kept root to remain, got %d", len(got))
+	}
+	if len(s.report.Rejected) != 1 || s.report.Rejected[0].Reason != "distrusted: key compromise" {
+		t.Errorf("rejected = %+v", s.report.Rejected)
+	}
+
+	store := &memoryStore{certs: []*x509.Certificate{kept, byFingerprint, bySubject, fromList, fromList}}
+	if err := s.removeDistrusted("system", store, distrusted); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.report.storeReport("system").Removed; got != 3 {
+		t.Errorf("removed %d distrusted certificates, want 3", got)
+	}
+}
+
+func TestRemoveDistrustedAsksForConfirmation(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := time.Now().Add(24 * time.Hour)
+	kept := newTestCA(t, "Kept Root", newTestKey(t), expiry, nil, nil)
+	compromised := newTestCA(t, "Compromised Root", newTestKey(t), expiry, nil, nil)
+	cfg := &config.Config{Distrusted: []config.DistrustedCertificate{{Subject: "Compromised Root"}}}
+	s := &Service{config: cfg, fetcher: cert.NewFetcher(5, false), state: st, report: &Report{}}
+	distrusted, err := s.loadDistrusted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &memoryStore{certs: []*x509.Certificate{kept, compromised}}
+
+	var planned []StorePlan
+	s.SetConfirm(func(plan StorePlan) (bool, error) {
+		planned = append(planned, plan)
+		return false, nil
+	})
+	if err := s.removeDistrusted("system", store, distrusted); err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 1 || len(planned[0].Remove) != 1 || planned[0].Remove[0].X509Cert != compromised {
+		t.Fatalf("confirmation not asked for the distrusted certificate: %+v", planned)
+	}
+	if got := s.report.storeReport("system").Removed; got != 0 {
+		t.Errorf("removed %d certificates after the removal was declined", got)
+	}
+
+	s.SetConfirm(func(StorePlan) (bool, error) { return false, ErrAborted })
+	if err := s.removeDistrusted("system", store, distrusted); !errors.Is(err, ErrAborted) {
+		t.Errorf("expected ErrAborted, got %v", err)
+	}
+
+	s.SetConfirm(func(StorePlan) (bool, error) { return true, nil })
+	if err := s.removeDistrusted("system", store, distrusted); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.report.storeReport("system").Removed; got != 1 {
+		t.Errorf("removed %d certificates after the removal was confirmed, want 1", got)
+	}
+}
+
+func TestRemoveDistrustedGuards(t *testing.T) {
+	defer func(orig func([]string) (string, bool)) { readOnlyPath = orig }(readOnlyPath)
+	readOnlyPath = func(paths []string) (string, bool) { return paths[0], true }
+
+	dir := t.TempDir()
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out", "bundle.pem")
+	cfg := &config.Config{
+		Settings: config.Settings{StagingDirectory: filepath.Join(dir, "staged")},
+		TrustStores: []config.TrustStore{
+			{Name: "system"},
+			{Name: "critical", Critical: true},
+			{Name: "readonly", ReadOnlyOutput: output},
+		},
+		Distrusted: []config.DistrustedCertificate{{Subject: "Compromised Root"}},
+	}
+	expiry := time.Now().Add(24 * time.Hour)
+	kept := newTestCA(t, "Kept Root", newTestKey(t), expiry, nil, nil)
+	compromised := newTestCA(t, "Compromised Root", newTestKey(t), expiry, nil, nil)
+	manager := certstore.NewStoreManager(nil, false)
+	system := &memoryStore{certs: []*x509.Certificate{kept, compromised}}
+	critical := &memoryStore{certs: []*x509.Certificate{kept, compromised}}
+	readonly := &fileStore{memoryStore: memoryStore{certs: []*x509.Certificate{kept, compromised}}, paths: []string{"/etc/ssl/certs"}}
+	manager.AddStore("system", system)
+	manager.AddStore("critical", critical)
+	manager.AddStore("readonly", readonly)
+	s := &Service{config: cfg, fetcher: cert.NewFetcher(5, false), state: st, storeManager: manager, report: &Report{}}
+	distrusted, err := s.loadDistrusted()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Critical stores have the removal staged for commit
+	if err := s.removeDistrusted("critical", critical, distrusted); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.report.storeReport("critical"); got.Removed != 0 || got.Staged != 1 {
+		t.Errorf("critical store report %+v, want the removal staged", got)
+	}
+	data, err := os.ReadFile(s.StagedBundlePath("critical"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle, _ := certstore.ParsePEMBundle(data); len(bundle) != 1 || !bundle[0].Equal(kept) {
+		t.Errorf("staged bundle holds %d certificates, want only the kept root", len(bundle))
+	}
+	changes, err := s.StagedChanges()
+	if err != nil || len(changes) != 1 || len(changes[0].Remove) != 1 {
+		t.Fatalf("StagedChanges = %+v, %v; want one staged removal", changes, err)
+	}
+	if err := s.commitStaged(changes[0], distrusted); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.report.storeReport("critical").Removed; got != 1 {
+		t.Errorf("commit removed %d certificates, want 1", got)
+	}
+
+	// Read-only stores get their output without the distrusted certificate
+	if err := s.removeDistrusted("readonly", readonly, distrusted); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle, _ := certstore.ParsePEMBundle(data); len(bundle) != 1 || !bundle[0].Equal(kept) {
+		t.Errorf("read_only_output holds %d certificates, want only the kept root", len(bundle))
+	}
+
+	// Hosts that need approval don't remove without one
+	s.config.Settings.HostTags = []string{"production"}
+	s.config.Approval.RequiredForTags = []string{"production"}
+	if err := s.removeDistrusted("system", system, distrusted); !errors.Is(err, approval.ErrNotApproved) {
+		t.Errorf("unapproved removal = %v, want ErrNotApproved", err)
+	}
+	if got := s.report.storeReport("system").Removed; got != 0 {
+		t.Errorf("removed %d certificates without an approval", got)
+	}
+}
@@ -0,0 +1,247 @@
+package updater
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// Issue is a problem found by Diagnose. Fix is nil when the problem cannot be
+// repaired safely without operator involvement.
+type Issue struct {
+	Store   string
+	Check   string
+	Message string
+	Fix     func() error
+}
+
+// Diagnose checks each configured store for common problems: missing update
+// tooling, platform specific issues such as broken symlinks, duplicate
+// certificates, expired managed certificates and managed files missing from
+// the state manifest
+func (s *Service) Diagnose() ([]Issue, error) {
+	if err := s.initializeTrustStores(); err != nil {
+		return nil, fmt.Errorf("failed to initialize trust stores: %w", err)
+	}
+
+	// Stores that could not be created are still worth reporting on
+	var issues []Issue
+	for _, storeConfig := range s.config.OrderedTrustStores() {
+		if !storeConfig.Enabled {
+			continue
+		}
+		if _, exists := s.storeManager.GetStore(storeConfig.Name); !exists {
+			issues = append(issues, Issue{
+				Store:   storeConfig.Name,
+				Check:   "availability",
+				Message: fmt.Sprintf("store target %s is not available on this host (missing tooling, privileges or platform)", storeConfig.Target),
+			})
+		}
+	}
+
+	for _, name := range s.storeManager.StoreNames() {
+		store, _ := s.storeManager.GetStore(name)
+		issues = append(issues, s.diagnoseStore(name, store)...)
+	}
+
+	return issues, nil
+}
+
+// Repair applies the fixes of issues found by Diagnose under the
+// single-writer lock, reporting each outcome to done, then commits buffered
+// store changes and persists the managed state
+func (s *Service) Repair(issues []Issue, done func(Issue, error)) error {
+	if s.dryRun {
+		return nil
+	}
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	s.report = &Report{StartedAt: time.Now()}
+	s.changing = make(map[string]error)
+	s.deferStores(time.Now())
+	for _, issue := range issues {
+		if issue.Fix == nil {
+			continue
+		}
+		err := issue.Fix()
+		if errors.Is(err, ErrAborted) {
+			return err
+		}
+		done(issue, err)
+	}
+
+	var errs []error
+	for _, name := range s.storeManager.StoreNames() {
+		store, _ := s.storeManager.GetStore(name)
+		err := s.commitStore(name, store)
+		s.finishChange(name, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("store %s: %w", name, err))
+		}
+	}
+	if err := s.state.Save(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) diagnoseStore(name string, store certstore.CertificateStore) []Issue {
+	var issues []Issue
+
+	if err := store.Validate(); err != nil {
+		issues = append(issues, Issue{Store: name, Check: "tooling", Message: err.Error()})
+		return issues
+	}
+
+	if checker, ok := store.(certstore.HealthChecker); ok {
+		for _, hi := range checker.CheckHealth() {
+			issues = append(issues, Issue{Store: name, Check: hi.Check, Message: hi.Message, Fix: hi.Fix})
+		}
+	}
+
+	current, err := store.ListCertificates()
+	if err != nil {
+		issues = append(issues, Issue{Store: name, Check: "list", Message: fmt.Sprintf("failed to list certificates: %v", err)})
+	} else {
+		issues = append(issues, findDuplicates(name, current)...)
+		issues = append(issues, s.findExpiredManaged(name, store, current)...)
+	}
+
+	if lister, ok := store.(certstore.ManagedFileLister); ok {
+		issues = append(issues, s.findOrphanedFiles(name, lister)...)
+	}
+
+	return issues
+}
+
+func findDuplicates(name string, certs []*x509.Certificate) []Issue {
+	counts := make(map[string]int)
+	subjects := make(map[string]string)
+	for _, c := range certs {
+		fp := cert.GetCertificateFingerprint(c)
+		counts[fp]++
+		subjects[fp] = c.Subject.String()
+	}
+
+	var issues []Issue
+	for fp, count := range counts {
+		if count > 1 {
+			issues = append(issues, Issue{
+				Store:   name,
+				Check:   "duplicate",
+				Message: fmt.Sprintf("certificate %s (%s) is present %d times", subjects[fp], fp, count),
+			})
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Message < issues[j].Message })
+	return issues
+}
+
+func (s *Service) findExpiredManaged(name string, store certstore.CertificateStore, current []*x509.Certificate) []Issue {
+	byFingerprint := make(map[string]*x509.Certificate)
+	for _, c := range current {
+		byFingerprint[cert.GetCertificateFingerprint(c)] = c
+	}
+
+	var issues []Issue
+	now := time.Now()
+	for _, mc := range s.state.ManagedList(name) {
+		if now.Before(mc.NotAfter) {
+			continue
+		}
+
+		mc := mc
+		issue := Issue{
+			Store:   name,
+			Check:   "expired",
+			Message: fmt.Sprintf("managed certificate %s expired on %s", mc.Subject, mc.NotAfter.Format("2006-01-02")),
+		}
+		if x509Cert, present := byFingerprint[mc.Fingerprint]; present {
+			issue.Fix = func() error {
+				return s.removeExpired(name, store, x509Cert, mc.Source)
+			}
+		} else {
+			// Already gone from the store; just drop it from the manifest
+			issue.Fix = func() error {
+				s.state.Forget(name, mc.Fingerprint)
+				return nil
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// removeExpired removes an expired managed certificate through the guards of
+// an update: critical stores are left to the operator, and the removal waits
+// for a maintenance window, approval and confirmation and follows a backup
+func (s *Service) removeExpired(name string, store certstore.CertificateStore, c *x509.Certificate, source string) error {
+	if err := checkWritable(store); err != nil {
+		return err
+	}
+	if s.isCritical(name) {
+		return fmt.Errorf("store %s is critical; review the certificate and remove it with the remove command", name)
+	}
+	fp := cert.GetCertificateFingerprint(c)
+	if err := s.checkOperationApproval(approval.OpRemove, name, []string{fp}); err != nil {
+		return err
+	}
+	if s.deferChanges(name, 1, "remove expired "+c.Subject.String()) {
+		return fmt.Errorf("store %s is outside its maintenance windows", name)
+	}
+	if s.confirm != nil {
+		approved, err := s.confirm(StorePlan{Store: name, Remove: []*Certificate{{X509Cert: c, Source: source}}})
+		if err != nil {
+			return err
+		}
+		if !approved {
+			return fmt.Errorf("not confirmed")
+		}
+	}
+	if err := s.backupStore(name); err != nil {
+		return err
+	}
+	if err := s.beginChange(name); err != nil {
+		return err
+	}
+	return s.removeCertificate(name, store, c, source)
+}
+
+// findOrphanedFiles reports managed files the manifest doesn't record. They
+// are not adopted: whatever put them there, trusting them is for an operator
+// to decide.
+func (s *Service) findOrphanedFiles(name string, lister certstore.ManagedFileLister) []Issue {
+	files, err := lister.ManagedFiles()
+	if err != nil {
+		return []Issue{{Store: name, Check: "orphaned", Message: fmt.Sprintf("failed to list managed files: %v", err)}}
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var issues []Issue
+	for _, path := range paths {
+		x509Cert := files[path]
+		if s.state.IsManaged(name, cert.GetCertificateFingerprint(x509Cert)) {
+			continue
+		}
+		issues = append(issues, Issue{
+			Store:   name,
+			Check:   "orphaned",
+			Message: fmt.Sprintf("managed file %s (%s) is not recorded in the manifest; review it and remove it if it isn't wanted", path, x509Cert.Subject.String()),
+		})
+	}
+	return issues
+}
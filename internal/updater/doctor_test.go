@@ -0,0 +1,68 @@
+package updater
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+func TestRepairExpiredManaged(t *testing.T) {
+	dir := t.TempDir()
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Settings:    config.Settings{LockFile: filepath.Join(dir, "updater.lock")},
+		TrustStores: []config.TrustStore{{Name: "system"}, {Name: "critical", Critical: true}},
+	}
+	manager := certstore.NewStoreManager(nil, false)
+	expired := newTestCA(t, "Expired Root", newTestKey(t), time.Now().Add(-time.Hour), nil, nil)
+	system := &memoryStore{certs: []*x509.Certificate{expired}}
+	critical := &memoryStore{certs: []*x509.Certificate{expired}}
+	manager.AddStore("system", system)
+	manager.AddStore("critical", critical)
+	st.RecordManaged("system", expired, "test", nil)
+	st.RecordManaged("critical", expired, "test", nil)
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}}
+
+	issues := append(s.findExpiredManaged("system", system, system.certs), s.findExpiredManaged("critical", critical, critical.certs)...)
+	if len(issues) != 2 || issues[0].Fix == nil || issues[1].Fix == nil {
+		t.Fatalf("issues = %+v, want a fixable expiry in each store", issues)
+	}
+
+	results := make(map[string]error)
+	done := func(issue Issue, err error) { results[issue.Store] = err }
+	s.SetConfirm(func(StorePlan) (bool, error) { return false, nil })
+	if err := s.Repair(issues, done); err != nil {
+		t.Fatal(err)
+	}
+	if results["system"] == nil || !st.IsManaged("system", cert.GetCertificateFingerprint(expired)) {
+		t.Errorf("declined removal = %v, want it refused and the certificate kept", results["system"])
+	}
+	if err := results["critical"]; err == nil || !strings.Contains(err.Error(), "critical") {
+		t.Errorf("critical store removal = %v, want it left to the operator", err)
+	}
+
+	locked := false
+	s.SetConfirm(func(StorePlan) (bool, error) {
+		locked = s.writeLock != nil
+		return true, nil
+	})
+	if err := s.Repair(issues[:1], done); err != nil {
+		t.Fatal(err)
+	}
+	if results["system"] != nil || st.IsManaged("system", cert.GetCertificateFingerprint(expired)) {
+		t.Errorf("confirmed removal = %v, want the certificate forgotten", results["system"])
+	}
+	if !locked {
+		t.Error("repair ran without the update lock")
+	}
+}
@@ -0,0 +1,178 @@
+package updater
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// DriftChange is a certificate added to or removed from a store since its
+// baseline was taken, i.e. by something other than this tool
+type DriftChange struct {
+	Store       string
+	Fingerprint string
+	Subject     string
+	Added       bool // false when the certificate was removed
+	// TrustChanged is set instead when the certificate stayed but its trust
+	// settings changed
+	TrustChanged bool
+}
+
+// Action describes the change: added, removed or trust changed
+func (c DriftChange) Action() string {
+	switch {
+	case c.TrustChanged:
+		return "trust changed"
+	case c.Added:
+		return "added"
+	}
+	return "removed"
+}
+
+func (c DriftChange) String() string {
+	change := "removed from"
+	switch {
+	case c.TrustChanged:
+		change = "had its trust settings changed in"
+	case c.Added:
+		change = "added to"
+	}
+	return fmt.Sprintf("%s (%s) %s store %s outside trust-store-updater", c.Subject, c.Fingerprint, change, c.Store)
+}
+
+// DetectDrift compares every available store with its baseline. Stores
+// without a baseline are skipped; they get one on the next successful run or
+// from AcceptDrift.
+func (s *Service) DetectDrift() ([]DriftChange, error) {
+	if err := s.initializeTrustStores(); err != nil {
+		return nil, fmt.Errorf("failed to initialize trust stores: %w", err)
+	}
+	return s.detectDrift(), nil
+}
+
+// AcceptDrift takes a new baseline of every available store, accepting its
+// current contents as expected, and saves the state under the single-writer
+// lock
+func (s *Service) AcceptDrift() error {
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	if err := s.initializeTrustStores(); err != nil {
+		return fmt.Errorf("failed to initialize trust stores: %w", err)
+	}
+	for _, name := range s.storeManager.StoreNames() {
+		store, _ := s.storeManager.GetStore(name)
+		if err := s.snapshotStore(name, store); err != nil {
+			return err
+		}
+	}
+	return s.state.Save()
+}
+
+func (s *Service) detectDrift() []DriftChange {
+	var changes []DriftChange
+	for _, name := range s.storeManager.StoreNames() {
+		store, _ := s.storeManager.GetStore(name)
+		storeChanges, err := s.compareBaseline(name, store)
+		if err != nil {
+			certstore.LogWarnf("Drift check failed for store %s: %v", name, err)
+			continue
+		}
+		for _, change := range storeChanges {
+			certstore.LogWarnf("Drift: %s", change)
+		}
+		changes = append(changes, storeChanges...)
+	}
+	return changes
+}
+
+// compareBaseline lists a store and returns how it differs from its baseline
+func (s *Service) compareBaseline(name string, store certstore.CertificateStore) ([]DriftChange, error) {
+	baseline := s.state.Baseline(name)
+	if baseline == nil {
+		return nil, nil
+	}
+
+	current, err := store.ListCertificates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %w", err)
+	}
+
+	var changes []DriftChange
+	seen := make(map[string]bool, len(current))
+	for _, c := range current {
+		fp := cert.GetCertificateFingerprint(c)
+		if seen[fp] {
+			continue
+		}
+		seen[fp] = true
+		if _, expected := baseline.Certificates[fp]; !expected {
+			changes = append(changes, DriftChange{Store: name, Fingerprint: fp, Subject: c.Subject.String(), Added: true})
+		}
+	}
+	for fp, subject := range baseline.Certificates {
+		if !seen[fp] {
+			changes = append(changes, DriftChange{Store: name, Fingerprint: fp, Subject: subject})
+		}
+	}
+
+	// Certificates in both can still have had their trust changed
+	if lister, ok := store.(certstore.TrustSettingsLister); ok && baseline.TrustSettingsTaken {
+		settings, err := lister.TrustSettings()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trust settings: %w", err)
+		}
+		for fp, subject := range baseline.Certificates {
+			if seen[fp] && settings[fp] != baseline.TrustSettings[fp] {
+				changes = append(changes, DriftChange{Store: name, Fingerprint: fp, Subject: subject, TrustChanged: true})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Added != changes[j].Added {
+			return changes[i].Added
+		}
+		return changes[i].Subject < changes[j].Subject
+	})
+	return changes, nil
+}
+
+// snapshotStore records a store's current contents as its baseline
+func (s *Service) snapshotStore(name string, store certstore.CertificateStore) error {
+	current, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot store %s: %w", name, err)
+	}
+	s.state.SetBaseline(name, current)
+	if lister, ok := store.(certstore.TrustSettingsLister); ok {
+		settings, err := lister.TrustSettings()
+		if err != nil {
+			return fmt.Errorf("failed to snapshot trust settings of store %s: %w", name, err)
+		}
+		s.state.SetBaselineTrustSettings(name, settings)
+	}
+	return nil
+}
+
+// snapshotUpdatedStores re-baselines every store updated without error, so
+// the next run only reports changes made after this one
+func (s *Service) snapshotUpdatedStores() {
+	failed := make(map[string]bool)
+	for _, sr := range s.report.Stores {
+		failed[sr.Name] = sr.Error != "" || sr.Failed > 0
+	}
+	for _, name := range s.storeManager.StoreNames() {
+		if failed[name] {
+			continue
+		}
+		store, _ := s.storeManager.GetStore(name)
+		if err := s.snapshotStore(name, store); err != nil {
+			certstore.LogWarnf("%v", err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package updater
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+func TestCompareBaseline(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{config: &config.Config{}, state: st, report: &Report{}}
+	expiry := time.Now().Add(24 * time.Hour)
+	kept := newTestCA(t, "Kept Root", newTestKey(t), expiry, nil, nil)
+	removed := newTestCA(t, "Removed Root", newTestKey(t), expiry, nil, nil)
+	rogue := newTestCA(t, "Rogue Root", newTestKey(t), expiry, nil, nil)
+
+	store := &memoryStore{certs: []*x509.Certificate{kept, removed}}
+	if changes, err := s.compareBaseline("system", store); err != nil || changes != nil {
+		t.Fatalf("store without a baseline reported drift: %v, %v", changes, err)
+	}
+
+	if err := s.snapshotStore("system", store); err != nil {
+		t.Fatal(err)
+	}
+	store.certs = []*x509.Certificate{kept, rogue, rogue}
+
+	changes, err := s.compareBaseline("system", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %v", changes)
+	}
+	if !changes[0].Added || changes[0].Fingerprint != cert.GetCertificateFingerprint(rogue) {
+		t.Errorf("expected rogue root added first, got %+v", changes[0])
+	}
+	if changes[1].Added || changes[1].Subject != removed.Subject.String() {
+		t.Errorf("expected removed root, got %+v", changes[1])
+	}
+}
+
+// trustStore is a memoryStore that keeps trust settings
+type trustStore struct {
+	memoryStore
+	settings map[string]string
+}
+
+func (s *trustStore) TrustSettings() (map[string]string, error) { return s.settings, nil }
+
+func TestCompareBaselineTrustSettings(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{config: &config.Config{}, state: st, report: &Report{}}
+	expiry := time.Now().Add(24 * time.Hour)
+	root := newTestCA(t, "Corp Root", newTestKey(t), expiry, nil, nil)
+	other := newTestCA(t, "Other Root", newTestKey(t), expiry, nil, nil)
+	fp := cert.GetCertificateFingerprint(root)
+
+	store := &trustStore{memoryStore: memoryStore{certs: []*x509.Certificate{root, other}}, settings: map[string]string{}}
+	if err := s.snapshotStore("keychain", store); err != nil {
+		t.Fatal(err)
+	}
+	if changes, _ := s.compareBaseline("keychain", store); len(changes) != 0 {
+		t.Fatalf("unchanged store reported drift: %v", changes)
+	}
+
+	// Trust set on a certificate that had none is drift, though the
+	// certificates themselves didn't change
+	store.settings = map[string]string{fp: "deny"}
+	changes, err := s.compareBaseline("keychain", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || !changes[0].TrustChanged || changes[0].Fingerprint != fp || changes[0].Action() != "trust changed" {
+		t.Fatalf("expected Corp Root's trust changed, got %+v", changes)
+	}
+
+	// Baselines taken before trust settings were recorded don't report them
+	st.Baseline("keychain").TrustSettingsTaken = false
+	if changes, _ := s.compareBaseline("keychain", store); len(changes) != 0 {
+		t.Errorf("baseline without trust settings reported %v", changes)
+	}
+}
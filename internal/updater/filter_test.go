@@ -0,0 +1,86 @@
+package updater
+
+import (
+	"crypto/x509"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// intermediateStore accepts only certificates it didn't name as roots
+type intermediateStore struct {
+	memoryStore
+	roots map[string]bool
+}
+
+func (s *intermediateStore) Accepts(c *x509.Certificate) bool {
+	return !s.roots[c.Subject.CommonName]
+}
+
+func TestCertificatesForStoreFilter(t *testing.T) {
+	s := &Service{config: &config.Config{}, report: &Report{}}
+	expiry := time.Now().Add(24 * time.Hour)
+	root := newTestCA(t, "Mail Root", newTestKey(t), expiry, nil, nil)
+	intermediate := newTestCA(t, "Mail Issuing CA", newTestKey(t), expiry, nil, nil)
+	certs := []*Certificate{{X509Cert: root, Source: "test"}, {X509Cert: intermediate, Source: "test"}}
+
+	store := &intermediateStore{roots: map[string]bool{"Mail Root": true}}
+	applicable := s.certificatesForStore("mail", store, certs)
+	if len(applicable) != 1 || applicable[0].X509Cert != intermediate {
+		t.Errorf("applicable = %d certificates, want only the intermediate", len(applicable))
+	}
+	if got := s.certificatesForStore("other", &memoryStore{}, certs); len(got) != 2 {
+		t.Errorf("a store without a filter should get every CA, got %d", len(got))
+	}
+}
+
+// scopedStore records the purposes certificates were added for
+type scopedStore struct {
+	memoryStore
+	purposes [][]string
+}
+
+func (s *scopedStore) SupportedPurposes() []string { return []string{"server-auth", "smime"} }
+
+func (s *scopedStore) AddCertificateForPurposes(c *x509.Certificate, label string, purposes []string) error {
+	s.purposes = append(s.purposes, purposes)
+	return s.AddCertificate(c)
+}
+
+func TestTrustPurposes(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{TrustStores: []config.TrustStore{{Name: "mail", TrustPurposes: []string{"smime"}}}}
+	s := &Service{config: cfg, state: st, report: &Report{}}
+	expiry := time.Now().Add(24 * time.Hour)
+	tlsAndMail := &Certificate{X509Cert: newTestCA(t, "Internal CA", newTestKey(t), expiry, nil, nil), Source: "internal", Purposes: []string{"server-auth", "smime"}}
+	signing := &Certificate{X509Cert: newTestCA(t, "Signing CA", newTestKey(t), expiry, nil, nil), Source: "internal", Purposes: []string{"code-signing"}}
+	certs := []*Certificate{tlsAndMail, signing}
+
+	// The store narrows the internal CA to smime and rules out the signing CA
+	store := &scopedStore{}
+	applicable := s.certificatesForStore("mail", store, certs)
+	if len(applicable) != 1 || applicable[0] != tlsAndMail {
+		t.Fatalf("applicable = %d certificates, want only the internal CA", len(applicable))
+	}
+	if err := s.addCertificate("mail", store, tlsAndMail); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(store.purposes, [][]string{{"smime"}}) {
+		t.Errorf("added for %v, want [[smime]]", store.purposes)
+	}
+
+	// A store that can't limit trust gets no purpose-limited certificates
+	if got := s.certificatesForStore("other", &memoryStore{}, certs); len(got) != 0 {
+		t.Errorf("got %d certificates for a store that can't limit trust", len(got))
+	}
+	if err := s.addCertificate("other", &memoryStore{}, signing); err == nil {
+		t.Error("adding a purpose-limited certificate to a store that can't limit trust should fail")
+	}
+}
@@ -0,0 +1,142 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/pgp"
+)
+
+// defaultAptKeyringDir is where apt reads additional trusted keys from
+const defaultAptKeyringDir = "/etc/apt/trusted.gpg.d"
+
+// updateGPGStores installs the configured package signing keys into each
+// keyring. In read-only mode the keyrings are only compared, and one that is
+// out of date reports ErrReadOnly.
+func (s *Service) updateGPGStores() {
+	if len(s.config.GPG.Stores) == 0 {
+		return
+	}
+
+	// Removing a key because its source was unreachable could break package
+	// updates, so keyrings are left alone unless every key was fetched
+	keys, fetchErr := s.fetchGPGKeys()
+
+	for _, storeConfig := range s.config.GPG.Stores {
+		if !storeConfig.Enabled {
+			continue
+		}
+
+		storeReport := s.report.storeReport(storeConfig.Name)
+		if fetchErr != nil {
+			storeReport.Error = "skipped: " + fetchErr.Error()
+			continue
+		}
+		if err := s.updateGPGStore(storeConfig, keys, storeReport); err != nil {
+			storeReport.Error = err.Error()
+			certstore.LogWarnf("Failed to update keyring %s: %v", storeConfig.Name, err)
+		}
+	}
+}
+
+// fetchGPGKeys fetches each enabled key and checks it against its pinned fingerprint
+func (s *Service) fetchGPGKeys() (map[string]*pgp.PublicKey, error) {
+	keys := make(map[string]*pgp.PublicKey)
+	var failed []string
+	for _, keyConfig := range s.config.GPG.Keys {
+		if !keyConfig.Enabled {
+			continue
+		}
+
+		key, err := s.fetchGPGKey(keyConfig)
+		if err != nil {
+			certstore.LogWarnf("Failed to fetch signing key %s: %v", keyConfig.Name, err)
+			failed = append(failed, keyConfig.Name)
+			continue
+		}
+		keys[keyConfig.Name] = key
+	}
+
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("failed to fetch signing keys: %s", strings.Join(failed, ", "))
+	}
+	return keys, nil
+}
+
+func (s *Service) fetchGPGKey(keyConfig config.GPGKey) (*pgp.PublicKey, error) {
+	var data []byte
+	var err error
+	switch keyConfig.Type {
+	case "url":
+		data, err = s.fetcher.FetchRaw(keyConfig.Source, keyConfig.Headers)
+	case "file":
+		data, err = os.ReadFile(keyConfig.Source)
+	default:
+		err = fmt.Errorf("unsupported key type: %s", keyConfig.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := pgp.ParseArmoredKey(data)
+	if err != nil {
+		return nil, err
+	}
+	if want := pgp.NormalizeFingerprint(keyConfig.Fingerprint); key.Fingerprint != want {
+		return nil, fmt.Errorf("fingerprint mismatch: got %s, expected %s", key.Fingerprint, want)
+	}
+	return key, nil
+}
+
+func (s *Service) updateGPGStore(storeConfig config.GPGStore, keys map[string]*pgp.PublicKey, storeReport *StoreReport) error {
+	selected := keys
+	if len(storeConfig.Keys) > 0 {
+		selected = make(map[string]*pgp.PublicKey)
+		for _, name := range storeConfig.Keys {
+			key, exists := keys[name]
+			if !exists {
+				return fmt.Errorf("unknown or disabled signing key: %s", name)
+			}
+			selected[name] = key
+		}
+	}
+
+	readOnly := s.config.Settings.ReadOnly
+	preview := s.dryRun || readOnly
+	var result pgp.SyncResult
+	var err error
+	switch storeConfig.Type {
+	case "apt":
+		dir := storeConfig.Path
+		if dir == "" {
+			dir = defaultAptKeyringDir
+		}
+		result, err = pgp.SyncAptDir(dir, selected, preview)
+	case "rpm":
+		runner := certstore.CommandRunner{Timeout: s.commandTimeout(config.TrustStore{}), Verbose: s.verbose}
+		result, err = pgp.ImportRPM(runner, selected, preview)
+	default:
+		return fmt.Errorf("unsupported keyring type: %s", storeConfig.Type)
+	}
+
+	storeReport.Added = result.Added
+	storeReport.Skipped = result.Unchanged
+	if err != nil {
+		return err
+	}
+
+	if result.Added > 0 || result.Removed > 0 {
+		if readOnly && !s.dryRun {
+			return fmt.Errorf("%d signing keys not installed and %d not removed in %s: %w", result.Added, result.Removed, storeConfig.Name, certstore.ErrReadOnly)
+		}
+		if s.dryRun {
+			fmt.Printf("DRY RUN: Would install %d and remove %d signing keys in %s\n", result.Added, result.Removed, storeConfig.Name)
+		} else {
+			certstore.LogInfof("Installed %d and removed %d signing keys in %s", result.Added, result.Removed, storeConfig.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package updater
+
+import (
+	"fmt"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/platform"
+)
+
+// StoreReachability is whether a configured store can be used on this host
+type StoreReachability struct {
+	Store     string `json:"store"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CheckStores creates each store that applies to this host and validates it,
+// without listing or changing certificates. Stores for other platforms,
+// hosts or conditions are left out.
+func (s *Service) CheckStores() ([]StoreReachability, error) {
+	if err := s.initializeTrustStores(); err != nil {
+		return nil, err
+	}
+
+	var results []StoreReachability
+	for _, storeConfig := range s.config.OrderedTrustStores() {
+		if !s.appliesHere(storeConfig) {
+			continue
+		}
+		result := StoreReachability{Store: storeConfig.Name}
+		if store, exists := s.storeManager.GetStore(storeConfig.Name); !exists {
+			result.Error = fmt.Sprintf("store target %s is not available (missing tooling, privileges or platform)", storeConfig.Target)
+		} else if err := store.Validate(); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Reachable = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// appliesHere reports whether an enabled store is meant for this host
+func (s *Service) appliesHere(storeConfig config.TrustStore) bool {
+	return storeConfig.Enabled && platform.IsPlatformSupported(storeConfig.Platform) &&
+		appliesToHost(storeConfig) && s.conditions.store(storeConfig.Name)
+}
@@ -0,0 +1,57 @@
+package updater
+
+import (
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/history"
+)
+
+// recordHistory adds the last run to the history database. Failing to record
+// is logged but does not fail the run.
+func (s *Service) recordHistory(runErr error) {
+	path := s.config.Settings.HistoryDatabase
+	if path == "" {
+		return
+	}
+	db, err := history.Open(path)
+	if err != nil {
+		certstore.LogWarnf("Run not recorded in history: %v", err)
+		return
+	}
+	defer db.Close()
+
+	if _, err := db.Record(HistoryRun(s.report, runErr)); err != nil {
+		certstore.LogWarnf("Run not recorded in history: %v", err)
+	}
+}
+
+// HistoryRun converts a report into a history record
+func HistoryRun(report *Report, runErr error) *history.Run {
+	run := &history.Run{
+		StartedAt:  report.StartedAt,
+		FinishedAt: report.FinishedAt,
+		Outcome:    history.OutcomeSuccess,
+		Fetched:    report.Fetched,
+	}
+	if run.FinishedAt.IsZero() {
+		run.FinishedAt = time.Now()
+	}
+
+	for _, sr := range report.Stores {
+		result := history.StoreResult{Store: sr.Name, Added: sr.Added, Skipped: sr.Skipped, Failed: sr.Failed, Error: sr.Error}
+		for _, in := range sr.Installed {
+			result.Installed = append(result.Installed, history.Install{Fingerprint: in.Fingerprint, Subject: in.Subject, Source: in.Source})
+		}
+		if sr.Error != "" || sr.Failed > 0 {
+			run.Outcome = history.OutcomePartial
+		}
+		run.Stores = append(run.Stores, result)
+	}
+
+	if runErr != nil {
+		run.Outcome = history.OutcomeFailure
+		run.Error = runErr.Error()
+	}
+	return run
+}
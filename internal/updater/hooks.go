@@ -0,0 +1,114 @@
+package updater
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// maxHookOutput bounds the hook output kept in the report; the end of the
+// output usually says what went wrong
+const maxHookOutput = 4096
+
+// HookResult records a store hook run
+type HookResult struct {
+	Hook     string // "pre_update" or "post_update"
+	Command  string
+	Output   string // combined stdout and stderr, truncated to the last 4 KiB
+	Error    string
+	Duration time.Duration
+}
+
+// beginChange is called before an update run first changes a store. It runs
+// the store's pre_update hook once per run; an error means the store must be
+// left unchanged.
+func (s *Service) beginChange(name string) error {
+	if s.changing == nil {
+		s.changing = make(map[string]error)
+	}
+	if err, started := s.changing[name]; started {
+		return err
+	}
+	var err error
+	if s.storeManager != nil {
+		if store, ok := s.storeManager.GetStore(name); ok {
+			err = checkWritable(store)
+		}
+	}
+	if storeConfig, ok := s.storeConfig(name); ok && err == nil && storeConfig.PreUpdate != nil {
+		if err = s.runHook(name, "pre_update", storeConfig.PreUpdate, nil); err != nil {
+			err = fmt.Errorf("pre_update hook failed: %w", err)
+		}
+	}
+	s.changing[name] = err
+	return err
+}
+
+// finishChange runs the post_update hook of a store the run changed or tried
+// to change, telling it what happened through the environment
+func (s *Service) finishChange(name string, updateErr error) {
+	if err, started := s.changing[name]; !started || err != nil {
+		return
+	}
+	storeConfig, ok := s.storeConfig(name)
+	if !ok || storeConfig.PostUpdate == nil {
+		return
+	}
+	sr := s.report.storeReport(name)
+	env := map[string]string{
+		"TRUST_STORE_UPDATER_ADDED":   strconv.Itoa(sr.Added),
+		"TRUST_STORE_UPDATER_REMOVED": strconv.Itoa(sr.Removed),
+		"TRUST_STORE_UPDATER_FAILED":  strconv.Itoa(sr.Failed),
+	}
+	if updateErr != nil {
+		env["TRUST_STORE_UPDATER_ERROR"] = updateErr.Error()
+	}
+	if err := s.runHook(name, "post_update", storeConfig.PostUpdate, env); err != nil {
+		certstore.LogWarnf("post_update hook for store %s failed: %v", name, err)
+	}
+}
+
+// runHook runs a store hook and records its output in the store's report
+func (s *Service) runHook(name, hook string, h *config.Hook, env map[string]string) error {
+	timeout := time.Duration(h.TimeoutSeconds) * time.Second
+	if h.TimeoutSeconds <= 0 {
+		timeout = s.commandTimeout(config.TrustStore{})
+	}
+	vars := []string{"TRUST_STORE_UPDATER_STORE=" + name, "TRUST_STORE_UPDATER_HOOK=" + hook}
+	for k, v := range h.Env {
+		vars = append(vars, k+"="+v)
+	}
+	for k, v := range env {
+		vars = append(vars, k+"="+v)
+	}
+	sort.Strings(vars[2:])
+
+	if s.verbose {
+		fmt.Printf("Running %s hook for store %s\n", hook, name)
+	}
+	runner := certstore.CommandRunner{Timeout: timeout, Verbose: s.verbose, Env: vars}
+	started := time.Now()
+	stdout, stderr, err := runner.RunCaptured(h.Command[0], h.Command[1:]...)
+
+	output := strings.TrimSpace(string(stdout) + string(stderr))
+	if len(output) > maxHookOutput {
+		output = "..." + output[len(output)-maxHookOutput:]
+	}
+	result := HookResult{
+		Hook:     hook,
+		Command:  strings.Join(h.Command, " "),
+		Output:   output,
+		Duration: time.Since(started),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	sr := s.report.storeReport(name)
+	sr.Hooks = append(sr.Hooks, result)
+	return err
+}
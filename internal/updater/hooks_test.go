@@ -0,0 +1,67 @@
+//go:build unix
+
+package updater
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+func TestStoreHooks(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "post.env")
+	cfg := &config.Config{TrustStores: []config.TrustStore{
+		{
+			Name:      "nginx",
+			PreUpdate: &config.Hook{Command: []string{"sh", "-c", "echo draining $TRUST_STORE_UPDATER_STORE"}},
+			PostUpdate: &config.Hook{
+				Command: []string{"sh", "-c", `echo "$TRUST_STORE_UPDATER_ADDED $TRUST_STORE_UPDATER_ERROR $SITE" > "$OUT"`},
+				Env:     map[string]string{"OUT": out, "SITE": "www"},
+			},
+		},
+		{
+			Name:       "blocked",
+			PreUpdate:  &config.Hook{Command: []string{"sh", "-c", "echo busy >&2; exit 1"}},
+			PostUpdate: &config.Hook{Command: []string{"sh", "-c", "exit 0"}},
+		},
+		{Name: "unchanged", PostUpdate: &config.Hook{Command: []string{"sh", "-c", "exit 1"}}},
+	}}
+	s := &Service{config: cfg, report: &Report{}}
+
+	if err := s.beginChange("nginx"); err != nil {
+		t.Fatalf("pre_update: %v", err)
+	}
+	if err := s.beginChange("nginx"); err != nil {
+		t.Fatal(err)
+	}
+	s.report.storeReport("nginx").Added = 2
+	s.finishChange("nginx", errors.New("commit failed"))
+	hooks := s.report.storeReport("nginx").Hooks
+	if len(hooks) != 2 || hooks[0].Output != "draining nginx" {
+		t.Fatalf("hooks = %+v", hooks)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "2 commit failed www" {
+		t.Errorf("post_update saw %q", got)
+	}
+
+	if err := s.beginChange("blocked"); err == nil || !strings.Contains(err.Error(), "busy") {
+		t.Errorf("expected the failing pre_update hook to block the store, got %v", err)
+	}
+	s.finishChange("blocked", nil)
+	if hooks := s.report.storeReport("blocked").Hooks; len(hooks) != 1 || hooks[0].Error == "" {
+		t.Errorf("post_update should not run after a failed pre_update: %+v", hooks)
+	}
+
+	s.finishChange("unchanged", nil)
+	if hooks := s.report.storeReport("unchanged").Hooks; len(hooks) != 0 {
+		t.Errorf("post_update ran for an unchanged store: %+v", hooks)
+	}
+}
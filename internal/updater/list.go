@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// ListedCertificate is a certificate found in a store, with its manifest entry
+// when this tool installed it
+type ListedCertificate struct {
+	Store       string                    `json:"store"`
+	Fingerprint string                    `json:"fingerprint"`
+	Subject     string                    `json:"subject"`
+	NotAfter    string                    `json:"not_after"`
+	Managed     *state.ManagedCertificate `json:"managed,omitempty"`
+	// Certificate is the certificate itself, nil when only the manifest was listed
+	Certificate *x509.Certificate `json:"-"`
+}
+
+// List returns the certificates in every available store, or only the named
+// one. With managedOnly the manifest is listed instead, without opening the
+// stores.
+func (s *Service) List(storeName string, managedOnly bool) ([]ListedCertificate, error) {
+	if managedOnly {
+		var listed []ListedCertificate
+		for name, managed := range s.Inventory() {
+			if storeName != "" && name != storeName {
+				continue
+			}
+			for _, m := range managed {
+				listed = append(listed, ListedCertificate{
+					Store:       name,
+					Fingerprint: m.Fingerprint,
+					Subject:     m.Subject,
+					NotAfter:    m.NotAfter.Format("2006-01-02"),
+					Managed:     m,
+				})
+			}
+		}
+		sortListing(listed)
+		return listed, nil
+	}
+
+	if err := s.initializeTrustStores(); err != nil {
+		return nil, fmt.Errorf("failed to initialize trust stores: %w", err)
+	}
+
+	var listed []ListedCertificate
+	for _, name := range s.storeManager.StoreNames() {
+		if storeName != "" && name != storeName {
+			continue
+		}
+		store, _ := s.storeManager.GetStore(name)
+		certs, err := store.ListCertificates()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list store %s: %w", name, err)
+		}
+		listed = append(listed, s.listStore(name, certs)...)
+	}
+	sortListing(listed)
+	return listed, nil
+}
+
+// listStore describes a store's certificates, attaching manifest entries
+func (s *Service) listStore(name string, certs []*x509.Certificate) []ListedCertificate {
+	managed := s.state.Store(name).Managed
+	seen := make(map[string]bool, len(certs))
+	var listed []ListedCertificate
+	for _, c := range certs {
+		fp := cert.GetCertificateFingerprint(c)
+		if seen[fp] {
+			continue
+		}
+		seen[fp] = true
+		listed = append(listed, ListedCertificate{
+			Store:       name,
+			Fingerprint: fp,
+			Subject:     c.Subject.String(),
+			NotAfter:    c.NotAfter.Format("2006-01-02"),
+			Managed:     managed[fp],
+			Certificate: c,
+		})
+	}
+	return listed
+}
+
+func sortListing(listed []ListedCertificate) {
+	sort.Slice(listed, func(i, j int) bool {
+		if listed[i].Store != listed[j].Store {
+			return listed[i].Store < listed[j].Store
+		}
+		return listed[i].Subject < listed[j].Subject
+	})
+}
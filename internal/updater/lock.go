@@ -0,0 +1,37 @@
+package updater
+
+import (
+	"github.com/webprofusion/trust-store-updater/internal/lock"
+)
+
+// acquireLock takes the single-writer lock before stores are changed. Dry
+// runs and read-only deployments change nothing and don't take it.
+func (s *Service) acquireLock() error {
+	path := s.config.Settings.LockFile
+	if path == "" || s.dryRun || s.config.Settings.ReadOnly {
+		return nil
+	}
+	instanceID := s.config.Settings.InstanceID
+	if instanceID == "" {
+		instanceID = lock.DefaultInstanceID()
+	}
+	l, err := lock.Acquire(path, instanceID)
+	if err != nil {
+		return err
+	}
+	s.writeLock = l
+	return nil
+}
+
+// verifyLock checks the lock is still ours before stores are changed
+func (s *Service) verifyLock() error {
+	if s.writeLock == nil {
+		return nil
+	}
+	return s.writeLock.Verify()
+}
+
+func (s *Service) releaseLock() {
+	_ = s.writeLock.Release()
+	s.writeLock = nil
+}
@@ -0,0 +1,60 @@
+package updater
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/maintenance"
+)
+
+// deferStores records the stores that have maintenance windows, none of
+// them open at now, with when the next one opens. Changes to those stores
+// are reported as deferred instead of applied.
+func (s *Service) deferStores(now time.Time) {
+	s.deferred = make(map[string]time.Time)
+	if len(s.config.MaintenanceWindows) == 0 {
+		return
+	}
+	for _, name := range s.storeManager.StoreNames() {
+		storeConfig, _ := s.storeConfig(name)
+		restricted, open := false, false
+		var next time.Time
+		for _, w := range s.config.MaintenanceWindows {
+			if !w.Covers(storeConfig) {
+				continue
+			}
+			restricted = true
+			// Validated with the configuration; a window that can't be
+			// parsed never opens
+			window, err := maintenance.New(w.Spec())
+			if err != nil {
+				certstore.LogWarnf("Maintenance window %s: %v", w.Name, err)
+				continue
+			}
+			if window.Open(now) {
+				open = true
+				break
+			}
+			if n := window.Next(now); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+				next = n
+			}
+		}
+		if restricted && !open {
+			s.deferred[name] = next
+			s.report.storeReport(name).NextWindow = next
+			certstore.LogInfof("Store %s is outside its maintenance windows; changes will only be reported", name)
+		}
+	}
+}
+
+// deferChanges reports n changes to a store outside its maintenance windows
+// instead of making them, returning false when they may go ahead
+func (s *Service) deferChanges(name string, n int, change string) bool {
+	if _, deferred := s.deferred[name]; !deferred {
+		return false
+	}
+	fmt.Printf("OUTSIDE MAINTENANCE WINDOW: Would %s in store %s\n", change, name)
+	s.report.storeReport(name).Deferred += n
+	return true
+}
@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+func TestDeferStoresOutsideMaintenanceWindow(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		TrustStores: []config.TrustStore{
+			{Name: "browsers", Groups: []string{"browsers"}},
+			{Name: "system"},
+		},
+		MaintenanceWindows: []config.MaintenanceWindow{{
+			Name:     "weekend",
+			Groups:   []string{"browsers"},
+			Days:     []string{"sat"},
+			Start:    "22:00",
+			End:      "04:00",
+			Timezone: "UTC",
+		}},
+	}
+	manager := certstore.NewStoreManager(nil, false)
+	browsers, system := &memoryStore{}, &memoryStore{}
+	manager.AddStore("browsers", browsers)
+	manager.AddStore("system", system)
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}}
+
+	// Wednesday noon: the browsers group is outside its window, the system
+	// store has none and is always updated
+	s.deferStores(time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC))
+	root := newTestCA(t, "Window Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	certs := []*Certificate{{X509Cert: root, Source: "test"}}
+	for name, store := range map[string]*memoryStore{"browsers": browsers, "system": system} {
+		if err := s.updateStore(name, store, certs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(browsers.certs) != 0 || s.report.storeReport("browsers").Deferred != 1 {
+		t.Errorf("browsers store changed outside its window (%d certificates)", len(browsers.certs))
+	}
+	if want := time.Date(2026, 10, 17, 22, 0, 0, 0, time.UTC); !s.report.storeReport("browsers").NextWindow.Equal(want) {
+		t.Errorf("next window = %s, want %s", s.report.storeReport("browsers").NextWindow, want)
+	}
+	if len(system.certs) != 1 {
+		t.Errorf("system store not updated")
+	}
+
+	// Inside the window the change goes ahead
+	s.report = &Report{}
+	s.deferStores(time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC))
+	if err := s.updateStore("browsers", browsers, certs); err != nil {
+		t.Fatal(err)
+	}
+	if len(browsers.certs) != 1 {
+		t.Errorf("browsers store not updated inside its window")
+	}
+}
@@ -0,0 +1,237 @@
+package updater
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// ErrAborted is returned by a ConfirmFunc to stop the update without applying
+// changes to the remaining stores
+var ErrAborted = errors.New("update aborted")
+
+// StorePlan is the set of changes computed for one store before it is modified
+type StorePlan struct {
+	Store  string
+	Add    []*Certificate
+	Remove []*Certificate
+}
+
+// ConfirmFunc is asked to approve each store's plan before it is applied.
+// Returning false skips the store; returning ErrAborted stops the update.
+type ConfirmFunc func(plan StorePlan) (bool, error)
+
+// SetConfirm installs a confirmation gate between planning and applying
+// changes. It is not consulted for dry runs or stores with nothing to change.
+func (s *Service) SetConfirm(confirm ConfirmFunc) {
+	s.confirm = confirm
+}
+
+// PlanFormat is the version of the plan document; it changes only when a
+// field changes meaning or is removed
+const PlanFormat = 1
+
+// Plan operations
+const (
+	OpAdd    = "add"
+	OpRemove = "remove"
+)
+
+// Plan is the changes to trust stores a dry run found, in a stable JSON
+// form that can be reviewed and then applied with SetPlan
+type Plan struct {
+	Format int `json:"format"`
+	// ConfigSHA256 is the digest of the configuration file the plan was
+	// made with, set by the caller
+	ConfigSHA256 string   `json:"config_sha256,omitempty"`
+	Changes      []Change `json:"changes"`
+	// Stores are the preconditions: the digest (see approval.BundleDigest)
+	// of each changed store's certificates when the plan was made
+	Stores map[string]string `json:"stores"`
+	// Approver signed the plan with approve --plan, valid until ExpiresAt
+	Approver   string     `json:"approver,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// appliedPlan is the plan an update is limited to
+type appliedPlan struct {
+	changes  map[string]bool   // by Change.key
+	stores   map[string]string // preconditions
+	approver string            // set once the plan's signature is verified
+}
+
+// Change is one planned change to a store's certificates, like a JSON Patch
+// operation
+type Change struct {
+	Op          string `json:"op"` // OpAdd or OpRemove
+	Store       string `json:"store"`
+	Fingerprint string `json:"fingerprint"` // SHA-256
+	Subject     string `json:"subject"`
+	Source      string `json:"source,omitempty"`
+	Reason      string `json:"reason"`
+}
+
+// key identifies the change regardless of its description
+func (c Change) key() string {
+	return c.Op + "\x00" + c.Store + "\x00" + c.Fingerprint
+}
+
+// Plan returns the changes the last dry run would have made
+func (s *Service) Plan() *Plan {
+	plan := &Plan{Format: PlanFormat, Changes: []Change{}, Stores: map[string]string{}}
+	if s.planned == nil {
+		return plan
+	}
+	plan.Changes = append(plan.Changes, s.planned.Changes...)
+	for _, c := range plan.Changes {
+		plan.Stores[c.Store] = s.planned.Stores[c.Store]
+	}
+	return plan
+}
+
+// LoadPlan reads a plan saved by diff and limits updates to it. A plan
+// naming an approver must carry that approver's valid signature and not have
+// expired. Hosts that require approval, or set approval.signed_plans, refuse
+// unsigned plans; a signed plan stands in for their bundle approval.
+func (s *Service) LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+
+	cfg := s.config.Approval
+	if plan.Approver == "" {
+		if cfg.SignedPlans || approval.Required(s.config.Settings.HostTags, cfg.RequiredForTags) {
+			return nil, fmt.Errorf("%w: plan %s is not signed; sign it with approve --plan", approval.ErrNotApproved, path)
+		}
+		return &plan, s.SetPlan(&plan)
+	}
+	if cfg.AllowedSigners == "" {
+		return nil, fmt.Errorf("%w: plan %s is signed but approval.allowed_signers is not configured", approval.ErrNotApproved, path)
+	}
+	if err := approval.VerifyData(data, path, cfg.AllowedSigners, plan.Approver, approval.PlanNamespace); err != nil {
+		return nil, err
+	}
+	if plan.ExpiresAt == nil || time.Now().After(*plan.ExpiresAt) {
+		return nil, fmt.Errorf("%w: plan approval by %s has expired", approval.ErrNotApproved, plan.Approver)
+	}
+	if err := s.SetPlan(&plan); err != nil {
+		return nil, err
+	}
+	s.plan.approver = plan.Approver
+	return &plan, nil
+}
+
+// SetPlan limits updates to the changes in plan. Changes the update finds
+// that aren't in the plan are left out and counted as unplanned; planned
+// changes that no longer apply are ignored. SSH and GPG stores and ACME
+// certificates aren't part of plans and are left alone.
+func (s *Service) SetPlan(plan *Plan) error {
+	if plan.Format != PlanFormat {
+		return fmt.Errorf("unsupported plan format %d (expected %d)", plan.Format, PlanFormat)
+	}
+	applied := &appliedPlan{changes: make(map[string]bool, len(plan.Changes)), stores: plan.Stores}
+	for _, c := range plan.Changes {
+		if c.Op != OpAdd && c.Op != OpRemove {
+			return fmt.Errorf("plan: unknown operation %q for store %s", c.Op, c.Store)
+		}
+		c.Fingerprint = normalizeFingerprint(c.Fingerprint)
+		applied.changes[c.key()] = true
+	}
+	s.plan = applied
+	return nil
+}
+
+// storeDigest identifies a store's contents for plan preconditions
+func storeDigest(certs []*x509.Certificate) string {
+	fingerprints := make([]string, len(certs))
+	for i, c := range certs {
+		fingerprints[i] = cert.GetCertificateFingerprint(c)
+	}
+	return approval.BundleDigest(fingerprints)
+}
+
+// checkPreconditions refuses to apply a plan to stores that changed since
+// it was made. Stores this run doesn't update, e.g. outside --group, are
+// not checked.
+func (s *Service) checkPreconditions() error {
+	for name, digest := range s.plan.stores {
+		store, ok := s.storeManager.GetStore(name)
+		if !ok {
+			continue
+		}
+		current, err := store.ListCertificates()
+		if err != nil {
+			return fmt.Errorf("failed to check plan preconditions for store %s: %w", name, err)
+		}
+		if storeDigest(current) != digest {
+			return fmt.Errorf("store %s changed since the plan was made; run diff again", name)
+		}
+	}
+	if s.plan.approver != "" {
+		certstore.LogInfof("Applying plan approved by %s", s.plan.approver)
+	}
+	return nil
+}
+
+// recordStore notes a store's contents as the precondition of its planned changes
+func (s *Service) recordStore(name string, current []*x509.Certificate) {
+	s.recording().Stores[name] = storeDigest(current)
+}
+
+// recording returns the plan this run records its changes in
+func (s *Service) recording() *Plan {
+	if s.planned == nil {
+		s.planned = &Plan{Stores: make(map[string]string)}
+	}
+	return s.planned
+}
+
+// recordChange adds a change a dry run found to the plan
+func (s *Service) recordChange(op, store string, c *x509.Certificate, source, reason string) {
+	plan := s.recording()
+	plan.Changes = append(plan.Changes, Change{
+		Op:          op,
+		Store:       store,
+		Fingerprint: cert.GetCertificateFingerprint(c),
+		Subject:     c.Subject.String(),
+		Source:      source,
+		Reason:      reason,
+	})
+}
+
+// inPlan reports whether a change may be made: always without a plan,
+// otherwise only if the plan has it
+func (s *Service) inPlan(op, store string, c *x509.Certificate) bool {
+	if s.plan == nil {
+		return true
+	}
+	return s.plan.changes[Change{Op: op, Store: store, Fingerprint: cert.GetCertificateFingerprint(c)}.key()]
+}
+
+// plannedOnly drops the additions that aren't in the plan, returning how
+// many were dropped
+func (s *Service) plannedOnly(store string, toAdd []*Certificate) ([]*Certificate, int) {
+	if s.plan == nil {
+		return toAdd, 0
+	}
+	var kept []*Certificate
+	for _, c := range toAdd {
+		if s.inPlan(OpAdd, store, c.X509Cert) {
+			kept = append(kept, c)
+		}
+	}
+	return kept, len(toAdd) - len(kept)
+}
@@ -0,0 +1,260 @@
+package updater
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// memoryStore is an in-memory CertificateStore
+type memoryStore struct {
+	certs []*x509.Certificate
+}
+
+func (m *memoryStore) Name() string                                   { return "memory" }
+func (m *memoryStore) IsSupported() bool                              { return true }
+func (m *memoryStore) RequiresRoot() bool                             { return false }
+func (m *memoryStore) ListCertificates() ([]*x509.Certificate, error) { return m.certs, nil }
+func (m *memoryStore) AddCertificate(c *x509.Certificate) error {
+	m.certs = append(m.certs, c)
+	return nil
+}
+func (m *memoryStore) RemoveCertificate(*x509.Certificate) error { return nil }
+func (m *memoryStore) Backup(string) error                       { return nil }
+func (m *memoryStore) Restore(string) error                      { return nil }
+func (m *memoryStore) Validate() error                           { return nil }
+
+func TestUpdateStoreConfirmation(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{config: &config.Config{}, state: st, report: &Report{}}
+	root := newTestCA(t, "Confirm Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	certs := []*Certificate{{X509Cert: root, Source: "test"}}
+
+	var planned []StorePlan
+	s.SetConfirm(func(plan StorePlan) (bool, error) {
+		planned = append(planned, plan)
+		return false, nil
+	})
+	declined := &memoryStore{}
+	if err := s.updateStore("declined", declined, certs); err != nil {
+		t.Fatalf("updateStore: %v", err)
+	}
+	if len(declined.certs) != 0 || len(planned) != 1 || len(planned[0].Add) != 1 {
+		t.Errorf("declined plan was applied (store has %d certs, %d plans)", len(declined.certs), len(planned))
+	}
+	if got := s.report.storeReport("declined").Error; got != "skipped: not confirmed" {
+		t.Errorf("report error = %q", got)
+	}
+
+	s.SetConfirm(func(StorePlan) (bool, error) { return false, ErrAborted })
+	if err := s.updateStore("aborted", &memoryStore{}, certs); !errors.Is(err, ErrAborted) {
+		t.Errorf("expected ErrAborted, got %v", err)
+	}
+
+	s.SetConfirm(func(StorePlan) (bool, error) { return true, nil })
+	approved := &memoryStore{}
+	if err := s.updateStore("approved", approved, certs); err != nil || len(approved.certs) != 1 {
+		t.Errorf("approved plan not applied: %d certs, %v", len(approved.certs), err)
+	}
+}
+
+// newProviderService returns a service that fetches one root from a file
+// into in-memory stores registered under provider
+func newProviderService(t *testing.T, provider string, names ...string) (*Service, map[string]*memoryStore) {
+	t.Helper()
+	dir := t.TempDir()
+	root := newTestCA(t, "Provider Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	bundle := filepath.Join(dir, "roots.pem")
+	if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stores := make(map[string]*memoryStore)
+	certstore.RegisterStoreProvider(provider, func(target string, _ map[string]string, _ bool) (certstore.CertificateStore, error) {
+		return stores[target], nil
+	})
+	cfg := &config.Config{CertificateSources: []config.CertificateSource{{Name: "local", Type: "file", Source: bundle, Enabled: true}}}
+	for _, name := range names {
+		stores[name] = &memoryStore{}
+		cfg.TrustStores = append(cfg.TrustStores, config.TrustStore{Name: name, Type: "custom", Provider: provider, Target: name, Platform: []string{runtime.GOOS}, Enabled: true})
+	}
+	cfg.Settings.StateFile = filepath.Join(dir, "state.json")
+	s, err := New(cfg, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, stores
+}
+
+func TestAbortKeepsAppliedStores(t *testing.T) {
+	s, stores := newProviderService(t, "abort-test", "first", "second", "third")
+	cfg := s.config
+	s.SetConfirm(func(plan StorePlan) (bool, error) {
+		if plan.Store == "second" {
+			return false, ErrAborted
+		}
+		return true, nil
+	})
+
+	if err := s.UpdateTrustStores(); !errors.Is(err, ErrAborted) {
+		t.Fatalf("expected ErrAborted, got %v", err)
+	}
+	if len(stores["first"].certs) != 1 || len(stores["second"].certs) != 0 || len(stores["third"].certs) != 0 {
+		t.Errorf("stores hold %d, %d and %d certificates, want 1, 0 and 0",
+			len(stores["first"].certs), len(stores["second"].certs), len(stores["third"].certs))
+	}
+	if got := s.report.storeReport("third").Error; got != "skipped: update aborted" {
+		t.Errorf("third store report error = %q", got)
+	}
+
+	// The store changed before the abort is recorded in the saved state
+	saved, err := state.Load(cfg.Settings.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Store("first").Managed) != 1 || saved.Store("first").Version == "" {
+		t.Errorf("applied store not saved: %+v", saved.Store("first"))
+	}
+	if saved.Store("second").Version != "" || saved.Store("third").Version != "" {
+		t.Error("stores left unchanged by the abort were recorded at the new version")
+	}
+}
+
+func TestPinnedBundleMismatch(t *testing.T) {
+	s, stores := newProviderService(t, "pin-test", "system")
+	s.SetBundleDigest(approval.BundleDigest([]string{"0000"}))
+	if err := s.UpdateTrustStores(); !errors.Is(err, ErrBundleMismatch) {
+		t.Fatalf("expected ErrBundleMismatch, got %v", err)
+	}
+	if len(stores["system"].certs) != 0 {
+		t.Error("store changed although the bundle did not match the pin")
+	}
+
+	s.SetBundleDigest(s.Report().BundleDigest)
+	if err := s.UpdateTrustStores(); err != nil {
+		t.Fatal(err)
+	}
+	if len(stores["system"].certs) != 1 {
+		t.Error("store not updated with the pinned bundle")
+	}
+}
+
+func TestPlanRecordAndApply(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	planned := newTestCA(t, "Planned Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	later := newTestCA(t, "Later Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+
+	s := &Service{config: &config.Config{}, state: st, report: &Report{}, dryRun: true}
+	if err := s.updateStore("memory", &memoryStore{}, []*Certificate{{X509Cert: planned, Source: "corp"}}); err != nil {
+		t.Fatal(err)
+	}
+	plan := s.Plan()
+	if len(plan.Changes) != 1 || plan.Changes[0].Op != OpAdd || plan.Changes[0].Store != "memory" || plan.Changes[0].Source != "corp" {
+		t.Fatalf("plan = %+v", plan.Changes)
+	}
+
+	// Applying the plan adds only the planned certificate
+	s = &Service{config: &config.Config{}, state: st, report: &Report{}}
+	if err := s.SetPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	store := &memoryStore{}
+	certs := []*Certificate{{X509Cert: planned, Source: "corp"}, {X509Cert: later, Source: "corp"}}
+	if err := s.updateStore("memory", store, certs); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.certs) != 1 || !store.certs[0].Equal(planned) {
+		t.Errorf("store holds %d certificates, want the planned one", len(store.certs))
+	}
+	if sr := s.report.storeReport("memory"); sr.Unplanned != 1 || reachedVersion(sr) {
+		t.Errorf("unplanned = %d, reached version = %v", sr.Unplanned, reachedVersion(sr))
+	}
+
+	if err := s.SetPlan(&Plan{Format: PlanFormat + 1}); err == nil {
+		t.Error("SetPlan accepted an unknown format")
+	}
+}
+
+func TestPlanPreconditions(t *testing.T) {
+	root := newTestCA(t, "Precondition Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	other := newTestCA(t, "Other Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	store := &memoryStore{certs: []*x509.Certificate{other}}
+	manager := certstore.NewStoreManager(nil, false)
+	manager.AddStore("memory", store)
+
+	s := &Service{config: &config.Config{}, storeManager: manager, report: &Report{}}
+	plan := &Plan{Format: PlanFormat, Stores: map[string]string{"memory": storeDigest(store.certs)}}
+	if err := s.SetPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkPreconditions(); err != nil {
+		t.Errorf("unchanged store: %v", err)
+	}
+	store.certs = append(store.certs, root)
+	if err := s.checkPreconditions(); err == nil || !strings.Contains(err.Error(), "changed since the plan") {
+		t.Errorf("changed store: %v", err)
+	}
+}
+
+func TestLoadSignedPlan(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	dir := t.TempDir()
+	key := filepath.Join(dir, "approver")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	pub, _ := os.ReadFile(key + ".pub")
+	signers := filepath.Join(dir, "allowed_signers")
+	os.WriteFile(signers, []byte("alice@example.com "+string(pub)), 0644)
+
+	cfg := &config.Config{Approval: config.Approval{AllowedSigners: signers, SignedPlans: true}}
+	s := &Service{config: cfg, report: &Report{}}
+
+	unsigned := filepath.Join(dir, "unsigned.json")
+	data, _ := json.Marshal(&Plan{Format: PlanFormat})
+	os.WriteFile(unsigned, data, 0644)
+	if _, err := s.LoadPlan(unsigned); !errors.Is(err, approval.ErrNotApproved) {
+		t.Errorf("unsigned plan: %v", err)
+	}
+
+	expires := time.Now().Add(time.Hour)
+	signed := filepath.Join(dir, "plan.json")
+	data, _ = json.Marshal(&Plan{Format: PlanFormat, Approver: "alice@example.com", ExpiresAt: &expires,
+		Changes: []Change{{Op: OpAdd, Store: "memory", Fingerprint: "AA:BB"}}})
+	if err := approval.SignData(data, signed, key, approval.PlanNamespace); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LoadPlan(signed); err != nil {
+		t.Fatalf("signed plan: %v", err)
+	}
+	if s.plan.approver != "alice@example.com" || !s.plan.changes[Change{Op: OpAdd, Store: "memory", Fingerprint: "aabb"}.key()] {
+		t.Errorf("plan not applied: %+v", s.plan)
+	}
+
+	// Any edit of the plan invalidates its signature
+	os.WriteFile(signed, []byte(strings.Replace(string(data), `"memory"`, `"system"`, 1)), 0644)
+	if _, err := s.LoadPlan(signed); !errors.Is(err, approval.ErrNotApproved) {
+		t.Errorf("edited plan: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package updater
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// trustPurposes returns what the named store may trust c for: its source's
+// trust purposes narrowed by the store's. None means unrestricted; ok is
+// false when the two don't overlap, so the store shouldn't trust c at all.
+func (s *Service) trustPurposes(name string, c *Certificate) (purposes []string, ok bool) {
+	storeConfig, _ := s.storeConfig(name)
+	switch {
+	case len(storeConfig.TrustPurposes) == 0:
+		return c.Purposes, true
+	case len(c.Purposes) == 0:
+		return storeConfig.TrustPurposes, true
+	}
+	for _, p := range c.Purposes {
+		if slices.Contains(storeConfig.TrustPurposes, p) {
+			purposes = append(purposes, p)
+		}
+	}
+	return purposes, len(purposes) > 0
+}
+
+// canScope reports whether the named store can hold c with its trust
+// limited as configured, logging why not
+func (s *Service) canScope(name string, store certstore.CertificateStore, c *Certificate) bool {
+	purposes, ok := s.trustPurposes(name, c)
+	if !ok {
+		if s.verbose {
+			fmt.Printf("Skipping certificate %s for store %s: none of its trust purposes are allowed in the store\n", c.X509Cert.Subject.CommonName, name)
+		}
+		return false
+	}
+	if len(purposes) == 0 {
+		return true
+	}
+	if adder, scoped := store.(certstore.PurposeAdder); scoped && supportsPurposes(adder, purposes) {
+		return true
+	}
+	if s.verbose {
+		fmt.Printf("Skipping certificate %s for store %s: the store can't limit trust to %s\n", c.X509Cert.Subject.CommonName, name, strings.Join(purposes, ", "))
+	}
+	return false
+}
+
+// supportsPurposes reports whether the store can limit trust to every one
+// of purposes
+func supportsPurposes(adder certstore.PurposeAdder, purposes []string) bool {
+	supported := adder.SupportedPurposes()
+	for _, p := range purposes {
+		if !slices.Contains(supported, p) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/pgp"
+	"github.com/webprofusion/trust-store-updater/internal/sshca"
+)
+
+func TestReadOnlyModeLeavesSSHAndGPGStores(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "trusted_user_ca_keys")
+	if err := os.WriteFile(caFile, []byte("# local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keyringDir := filepath.Join(dir, "trusted.gpg.d")
+
+	cfg := &config.Config{}
+	cfg.Settings.ReadOnly = true
+	cfg.Settings.BackupEnabled = true
+	cfg.Settings.BackupDirectory = filepath.Join(dir, "backups")
+	s := &Service{config: cfg, report: &Report{}}
+
+	sshStore := config.SSHStore{Name: "sshd", Type: "trusted_user_ca_keys", Path: caFile, Enabled: true}
+	sshKeys := map[string][]sshca.PublicKey{"corp": {{Type: "ssh-ed25519", Blob: []byte("key"), Comment: "user-ca"}}}
+	cfg.SSH.Authorities = []config.SSHAuthority{{Name: "corp", Enabled: true}}
+	err := s.updateSSHStore(sshStore, sshKeys, s.report.storeReport("sshd"))
+	if !errors.Is(err, certstore.ErrReadOnly) {
+		t.Errorf("SSH store error = %v, want ErrReadOnly", err)
+	}
+	if data, _ := os.ReadFile(caFile); string(data) != "# local\n" {
+		t.Errorf("read-only run rewrote %s:\n%s", caFile, data)
+	}
+	if _, err := os.Stat(cfg.Settings.BackupDirectory); !os.IsNotExist(err) {
+		t.Errorf("read-only run took a backup: %v", err)
+	}
+
+	gpgStore := config.GPGStore{Name: "apt", Type: "apt", Path: keyringDir, Enabled: true}
+	gpgKeys := map[string]*pgp.PublicKey{"vendor": {Armored: []byte("key"), Fingerprint: "0123456789ABCDEF0123456789ABCDEF01234567"}}
+	err = s.updateGPGStore(gpgStore, gpgKeys, s.report.storeReport("apt"))
+	if !errors.Is(err, certstore.ErrReadOnly) {
+		t.Errorf("keyring error = %v, want ErrReadOnly", err)
+	}
+	if _, err := os.Stat(keyringDir); !os.IsNotExist(err) {
+		t.Errorf("read-only run wrote the keyring directory: %v", err)
+	}
+}
+
+func TestSSHBackupCreatesDirectory(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "trusted_user_ca_keys")
+	if err := os.WriteFile(caFile, []byte("# local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Settings.BackupDirectory = filepath.Join(dir, "backups", "ssh")
+	s := &Service{config: cfg, report: &Report{}}
+
+	if err := s.backupSSHStore(config.SSHStore{Name: "sshd", Path: caFile}); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := os.ReadDir(cfg.Settings.BackupDirectory)
+	if err != nil || len(backups) != 1 {
+		t.Errorf("backups = %v, %v; want one backup", backups, err)
+	}
+}
@@ -0,0 +1,68 @@
+package updater
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// readOnlyHint suggests what to do about a store on a read-only filesystem
+const readOnlyHint = "bake the certificates into the image with render --target docker-build or bundle, or set read_only_output to a writable path"
+
+// readOnlyPath finds read-only paths; tests replace it
+var readOnlyPath = certstore.ReadOnlyPath
+
+// checkWritable returns ErrReadOnlyFilesystem when the files a store changes
+// are on a read-only filesystem
+func checkWritable(store certstore.CertificateStore) error {
+	pather, ok := store.(certstore.WritePather)
+	if !ok {
+		return nil
+	}
+	if path, readOnly := readOnlyPath(pather.WritePaths()); readOnly {
+		return fmt.Errorf("%w at %s; %s", certstore.ErrReadOnlyFilesystem, path, readOnlyHint)
+	}
+	return nil
+}
+
+// readOnlyFallback handles an update of a store on a read-only filesystem:
+// with read_only_output configured the certificates the store would hold,
+// less any the run distrusts, are written there as a PEM bundle, otherwise
+// the store is skipped
+func (s *Service) readOnlyFallback(name string, current []*x509.Certificate, toAdd []*Certificate, readOnlyErr error) error {
+	storeReport := s.report.storeReport(name)
+	storeConfig, _ := s.storeConfig(name)
+	output := storeConfig.ReadOnlyOutput
+	if output == "" {
+		storeReport.Error = "skipped: " + readOnlyErr.Error()
+		certstore.LogWarnf("Not updating store %s: %v", name, readOnlyErr)
+		return nil
+	}
+
+	storeReport.ReadOnlyOutput = output
+	if s.dryRun {
+		fmt.Printf("DRY RUN: Store %s is on a read-only filesystem; would write its %d certificates to %s\n", name, len(current)+len(toAdd), output)
+		return nil
+	}
+	var bundle []*x509.Certificate
+	for _, c := range current {
+		if _, distrusted := s.distrusted.match(c); !distrusted {
+			bundle = append(bundle, c)
+		}
+	}
+	for _, c := range toAdd {
+		bundle = append(bundle, c.X509Cert)
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("failed to create read_only_output directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(output, certstore.EncodePEMBundle(bundle), certstore.DefaultFileMode); err != nil {
+		return fmt.Errorf("failed to write read_only_output: %w", err)
+	}
+	certstore.LogInfof("Store %s is on a read-only filesystem; wrote its %d certificates to %s instead", name, len(bundle), output)
+	return nil
+}
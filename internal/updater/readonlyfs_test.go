@@ -0,0 +1,81 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// fileStore is a memoryStore that reports the files it would change
+type fileStore struct {
+	memoryStore
+	paths []string
+}
+
+func (f *fileStore) WritePaths() []string { return f.paths }
+
+func TestReadOnlyFilesystemStores(t *testing.T) {
+	defer func(orig func([]string) (string, bool)) { readOnlyPath = orig }(readOnlyPath)
+	readOnlyPath = func(paths []string) (string, bool) { return paths[0], true }
+
+	dir := t.TempDir()
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out", "bundle.pem")
+	cfg := &config.Config{TrustStores: []config.TrustStore{
+		{Name: "skipped"},
+		{Name: "redirected", ReadOnlyOutput: output},
+	}}
+	manager := certstore.NewStoreManager(nil, false)
+	skipped := &fileStore{paths: []string{"/etc/ssl/certs/ca-certificates.crt"}}
+	redirected := &fileStore{paths: []string{"/etc/pki/ca-trust/source/anchors"}}
+	manager.AddStore("skipped", skipped)
+	manager.AddStore("redirected", redirected)
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}}
+
+	existing := newTestCA(t, "Existing Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	redirected.certs = append(redirected.certs, existing)
+	root := newTestCA(t, "New Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	certs := []*Certificate{{X509Cert: root, Source: "test"}}
+
+	if err := s.updateStore("skipped", skipped, certs); err != nil {
+		t.Fatal(err)
+	}
+	sr := s.report.storeReport("skipped")
+	if len(skipped.certs) != 0 || !strings.Contains(sr.Error, "read-only filesystem at /etc/ssl/certs/ca-certificates.crt") {
+		t.Errorf("skipped store: %d certificates, error %q", len(skipped.certs), sr.Error)
+	}
+
+	if err := s.updateStore("redirected", redirected, certs); err != nil {
+		t.Fatal(err)
+	}
+	if len(redirected.certs) != 1 || s.report.storeReport("redirected").ReadOnlyOutput != output {
+		t.Errorf("redirected store: %d certificates, report %+v", len(redirected.certs), s.report.storeReport("redirected"))
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle, _ := certstore.ParsePEMBundle(data); len(bundle) != 2 {
+		t.Errorf("read_only_output holds %d certificates, want 2", len(bundle))
+	}
+
+	// Direct changes are refused rather than failing part way through
+	if err := s.beginChange("skipped"); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("beginChange = %v, want a read-only filesystem error", err)
+	}
+}
+
+func TestReadOnlyPathWritable(t *testing.T) {
+	if path, ok := certstore.ReadOnlyPath([]string{filepath.Join(t.TempDir(), "missing", "bundle.pem")}); ok {
+		t.Errorf("ReadOnlyPath found %s read-only in a temporary directory", path)
+	}
+}
@@ -0,0 +1,109 @@
+package updater
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// ServiceReload records a service reloaded because a store it uses changed
+type ServiceReload struct {
+	Service string
+	Action  string   // "reload" or "restart"
+	Stores  []string // the changed stores that asked for it
+	Error   string
+}
+
+// reloadServices reloads, once each, the services of every store the run
+// changed. Stores whose contents are unchanged bounce nothing, so scheduled
+// no-op runs leave services alone.
+func (s *Service) reloadServices() {
+	var changed []string
+	for _, sr := range s.report.Stores {
+		if sr.Added > 0 || sr.Removed > 0 {
+			changed = append(changed, sr.Name)
+		}
+	}
+	s.reloadServicesOf(changed)
+}
+
+// reloadServicesOf reloads, once each, the services of the named stores
+func (s *Service) reloadServicesOf(stores []string) {
+	var order []string
+	reloads := make(map[string]*ServiceReload)
+	for _, name := range stores {
+		storeConfig, ok := s.storeConfig(name)
+		if !ok {
+			continue
+		}
+		action := storeConfig.ReloadAction
+		if action == "" {
+			action = "reload"
+		}
+		for _, service := range storeConfig.ReloadServices {
+			reload, seen := reloads[service]
+			if !seen {
+				reload = &ServiceReload{Service: service, Action: action}
+				reloads[service] = reload
+				order = append(order, service)
+			}
+			// A restart requested by any store wins over a reload
+			if action == "restart" {
+				reload.Action = action
+			}
+			reload.Stores = append(reload.Stores, name)
+		}
+	}
+
+	for _, service := range order {
+		reload := reloads[service]
+		if s.dryRun {
+			fmt.Printf("DRY RUN: Would %s %s (changed: %s)\n", reload.Action, service, strings.Join(reload.Stores, ", "))
+		} else if err := s.reloadService(reload.Service, reload.Action); err != nil {
+			reload.Error = err.Error()
+			certstore.LogWarnf("Failed to %s service %s: %v", reload.Action, service, err)
+		} else {
+			certstore.LogInfof("Ran %s of service %s after changes to %s", reload.Action, service, strings.Join(reload.Stores, ", "))
+		}
+		s.report.Reloads = append(s.report.Reloads, *reload)
+	}
+}
+
+// reloadService reloads or restarts a service with the platform's service manager
+func (s *Service) reloadService(service, action string) error {
+	runner := certstore.CommandRunner{Timeout: s.commandTimeout(config.TrustStore{}), Verbose: s.verbose}
+	name, args := reloadCommand(runtime.GOOS, service, action)
+	if name == "" {
+		return fmt.Errorf("reloading services is not supported on %s", runtime.GOOS)
+	}
+	if runtime.GOOS == "windows" {
+		// The service name goes through the environment, not the script text
+		runner.Env = []string{"TRUST_STORE_UPDATER_SERVICE=" + service}
+	}
+	_, err := runner.Run(name, args...)
+	return err
+}
+
+// reloadCommand returns the command that reloads or restarts service on goos
+func reloadCommand(goos, service, action string) (string, []string) {
+	switch goos {
+	case "linux":
+		if action == "restart" {
+			return "systemctl", []string{"restart", "--", service}
+		}
+		return "systemctl", []string{"reload-or-restart", "--", service}
+	case "darwin":
+		target := service
+		if !strings.Contains(target, "/") {
+			target = "system/" + target
+		}
+		return "launchctl", []string{"kickstart", "-k", target}
+	case "windows":
+		return "powershell.exe", []string{"-NoProfile", "-NonInteractive", "-Command",
+			"Restart-Service -Name $env:TRUST_STORE_UPDATER_SERVICE -Force -ErrorAction Stop"}
+	}
+	return "", nil
+}
@@ -0,0 +1,50 @@
+package updater
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+func TestReloadServicesOnlyForChangedStores(t *testing.T) {
+	cfg := &config.Config{TrustStores: []config.TrustStore{
+		{Name: "system", ReloadServices: []string{"nginx", "haproxy"}},
+		{Name: "java", ReloadServices: []string{"nginx", "tomcat"}, ReloadAction: "restart"},
+		{Name: "firefox", ReloadServices: []string{"squid"}},
+	}}
+	s := &Service{config: cfg, report: &Report{DryRun: true}, dryRun: true}
+	s.report.storeReport("system").Added = 1
+	s.report.storeReport("java").Removed = 1
+	s.report.storeReport("firefox").Skipped = 40
+
+	s.reloadServices()
+	want := []ServiceReload{
+		{Service: "nginx", Action: "restart", Stores: []string{"system", "java"}},
+		{Service: "haproxy", Action: "reload", Stores: []string{"system"}},
+		{Service: "tomcat", Action: "restart", Stores: []string{"java"}},
+	}
+	if !reflect.DeepEqual(s.report.Reloads, want) {
+		t.Errorf("reloads = %+v", s.report.Reloads)
+	}
+}
+
+func TestReloadCommand(t *testing.T) {
+	cases := []struct {
+		goos, action string
+		want         []string
+	}{
+		{"linux", "reload", []string{"systemctl", "reload-or-restart", "--", "nginx"}},
+		{"linux", "restart", []string{"systemctl", "restart", "--", "nginx"}},
+		{"darwin", "reload", []string{"launchctl", "kickstart", "-k", "system/nginx"}},
+	}
+	for _, c := range cases {
+		name, args := reloadCommand(c.goos, "nginx", c.action)
+		if got := append([]string{name}, args...); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s %s: %v", c.goos, c.action, got)
+		}
+	}
+	if name, _ := reloadCommand("plan9", "nginx", "reload"); name != "" {
+		t.Error("expected no reload command on an unsupported platform")
+	}
+}
@@ -0,0 +1,227 @@
+package updater
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// Report summarizes the outcome of an update run
+type Report struct {
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	DryRun       bool
+	Fetched      int
+	BundleDigest string // digest of the fetched bundle, see approval.BundleDigest
+	Version      string // trust set version recorded by the run
+	Stores       []*StoreReport
+	Duplicates   []DuplicateGroup
+	Rejected     []Rejection
+	Drift        []DriftChange                // changes made outside the tool since the last baseline
+	Operations   []*certstore.OperationResult // store-wide operations such as backup and validation
+	Reloads      []ServiceReload              // services reloaded because their stores changed
+}
+
+// Rejection records a fetched certificate that failed validation
+type Rejection struct {
+	Subject     string
+	Fingerprint string
+	Source      string
+	Reason      string
+}
+
+// StoreReport summarizes the changes made to a single store
+type StoreReport struct {
+	Name     string
+	Added    int
+	Skipped  int
+	Excluded int // not applicable to the store, e.g. end-entity certificates for a CA-only store
+	Blocked  int // missing from the sealed trust anchor list
+	Removed  int // distrusted certificates removed
+	Failed   int
+	Deferred int // changes held back outside the store's maintenance windows
+	Staged   int // additions to a critical store waiting for commit
+	Error    string
+	// Unplanned counts changes left out because the applied plan lacks them
+	Unplanned int
+	// RolledBack counts additions removed again after a verification probe failed
+	RolledBack int
+	// Verify are the results of the store's verification probes
+	Verify []ProbeResult
+	// ReadOnlyOutput is the bundle written instead of a store on a
+	// read-only filesystem
+	ReadOnlyOutput string
+	// NextWindow is when a maintenance window next opens for a store
+	// outside its windows, zero if none opens within a week
+	NextWindow time.Time
+	// Installed lists the certificates added to the store
+	Installed []Installation
+	// Rebuild is what the system bundle rebuild tool reported, for stores that run one
+	Rebuild *certstore.RebuildSummary
+	// Reboot is why a reboot or deployment switch is needed for the store's
+	// changes to take full effect, e.g. a pending OSTree deployment
+	Reboot string
+	// Targets is the outcome for each underlying target, e.g. each JVM's cacerts
+	Targets []certstore.TargetResult
+	// Hooks are the pre_update and post_update hooks run for the store
+	Hooks []HookResult
+}
+
+// Installation identifies a certificate added to a store
+type Installation struct {
+	Fingerprint string
+	Subject     string
+	Source      string
+}
+
+// storeReport returns the report entry for the named store, creating it if needed
+func (r *Report) storeReport(name string) *StoreReport {
+	for _, sr := range r.Stores {
+		if sr.Name == name {
+			return sr
+		}
+	}
+	sr := &StoreReport{Name: name}
+	r.Stores = append(r.Stores, sr)
+	return sr
+}
+
+// Print writes a human readable summary of the run
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Summary (%s):\n", r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond))
+	fmt.Fprintf(w, "  Certificates fetched: %d\n", r.Fetched)
+	if r.Version != "" {
+		fmt.Fprintf(w, "  Trust set version: %s\n", r.Version)
+	}
+
+	for _, sr := range r.Stores {
+		line := fmt.Sprintf("  Store %s: %d added, %d already present, %d failed", sr.Name, sr.Added, sr.Skipped, sr.Failed)
+		if r.DryRun {
+			line = fmt.Sprintf("  Store %s: %d would be added, %d already present", sr.Name, sr.Added, sr.Skipped)
+		}
+		if sr.Excluded > 0 {
+			line += fmt.Sprintf(", %d excluded by store policy", sr.Excluded)
+		}
+		if sr.Blocked > 0 {
+			line += fmt.Sprintf(", %d blocked by sealed trust anchors", sr.Blocked)
+		}
+		if sr.Removed > 0 {
+			line += fmt.Sprintf(", %d distrusted removed", sr.Removed)
+		}
+		if sr.ReadOnlyOutput != "" {
+			line += fmt.Sprintf(", read-only filesystem: written to %s", sr.ReadOnlyOutput)
+		}
+		if sr.RolledBack > 0 {
+			line += fmt.Sprintf(", %d rolled back", sr.RolledBack)
+		}
+		if sr.Staged > 0 {
+			line += fmt.Sprintf(", %d staged for commit", sr.Staged)
+		}
+		if sr.Unplanned > 0 {
+			line += fmt.Sprintf(", %d not in the plan", sr.Unplanned)
+		}
+		if sr.Deferred > 0 {
+			line += fmt.Sprintf(", %d deferred to the next maintenance window", sr.Deferred)
+			if !sr.NextWindow.IsZero() {
+				line += fmt.Sprintf(" at %s", sr.NextWindow.Format("2006-01-02 15:04 MST"))
+			}
+		}
+		if sr.Error != "" {
+			line += fmt.Sprintf(" (error: %s)", sr.Error)
+		}
+		fmt.Fprintln(w, line)
+		if rb := sr.Rebuild; rb != nil {
+			fmt.Fprintf(w, "    %s: %d added, %d removed over %d run(s)\n", rb.Tool, rb.Added, rb.Removed, rb.Runs)
+			for _, warning := range rb.Warnings {
+				fmt.Fprintf(w, "      warning: %s\n", warning)
+			}
+		}
+		if sr.Reboot != "" {
+			fmt.Fprintf(w, "    reboot required: %s\n", sr.Reboot)
+		}
+		for _, t := range sr.Targets {
+			target := t.Target
+			if t.Detail != "" {
+				target += " (" + t.Detail + ")"
+			}
+			fmt.Fprintf(w, "    %s: %d added, %d removed, %d failed\n", target, t.Added, t.Removed, t.Failed)
+			for _, e := range t.Errors {
+				fmt.Fprintf(w, "      error: %s\n", e)
+			}
+		}
+		for _, p := range sr.Verify {
+			status := "ok"
+			if !p.OK {
+				status = "failed: " + p.Detail
+			}
+			fmt.Fprintf(w, "    verify %s (%s): %s\n", p.Name, p.Duration.Round(time.Millisecond), status)
+		}
+		for _, h := range sr.Hooks {
+			status := "ok"
+			if h.Error != "" {
+				status = "failed: " + h.Error
+			}
+			fmt.Fprintf(w, "    %s hook (%s): %s\n", h.Hook, h.Duration.Round(time.Millisecond), status)
+		}
+	}
+
+	for _, reload := range r.Reloads {
+		status := "ok"
+		if r.DryRun {
+			status = "dry run"
+		}
+		if reload.Error != "" {
+			status = "failed: " + reload.Error
+		}
+		fmt.Fprintf(w, "  Service %s %s (%s): %s\n", reload.Service, reload.Action, strings.Join(reload.Stores, ", "), status)
+	}
+
+	for _, op := range r.Operations {
+		if len(op.Failures) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  %s failed for %d of %d stores:\n", op.Operation, len(op.Failures), len(op.Failures)+len(op.Succeeded))
+		for _, f := range op.Failures {
+			fmt.Fprintf(w, "    %s: %v\n", f.Store, f.Err)
+		}
+	}
+
+	if len(r.Drift) > 0 {
+		fmt.Fprintf(w, "  Changed outside trust-store-updater: %d\n", len(r.Drift))
+		for _, d := range r.Drift {
+			fmt.Fprintf(w, "    %s %s: %s (%s)\n", d.Store, d.Action(), d.Subject, d.Fingerprint)
+		}
+	}
+
+	if len(r.Rejected) > 0 {
+		fmt.Fprintf(w, "  Rejected by validation: %d\n", len(r.Rejected))
+		for _, rej := range r.Rejected {
+			fmt.Fprintf(w, "    %s [%s]: %s\n", rej.Subject, rej.Source, rej.Reason)
+		}
+	}
+
+	if len(r.Duplicates) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "  Duplicate public keys: %d\n", len(r.Duplicates))
+	for _, d := range r.Duplicates {
+		kind := "duplicate"
+		if d.CrossSigned {
+			kind = "cross-signed"
+		}
+
+		sources := make([]string, 0, len(d.SourceCounts))
+		for source, count := range d.SourceCounts {
+			sources = append(sources, fmt.Sprintf("%s x%d", source, count))
+		}
+		sort.Strings(sources)
+
+		fmt.Fprintf(w, "    %s (%s): %d variants, %d exact copies, kept %d [%s]\n",
+			d.Subject, kind, len(d.Variants), d.ExactCopies, len(d.Kept), strings.Join(sources, ", "))
+	}
+}
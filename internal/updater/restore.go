@@ -0,0 +1,222 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/audit"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+)
+
+// restoreSource is the source recorded for certificates a restore brings back
+const restoreSource = "restore"
+
+// backupPath resolves the name of one of a store's backups in the backup
+// directory. Only names are accepted, so a restore can't load trust anchors
+// from anywhere else on the host.
+func (s *Service) backupPath(store, backup string) (string, error) {
+	if backup == "" || backup == "." || strings.Contains(backup, "..") || strings.ContainsAny(backup, `/\:`) {
+		return "", fmt.Errorf("invalid backup name %q: give the name of a backup in %s", backup, s.config.Settings.BackupDirectory)
+	}
+	if !strings.HasPrefix(backup, store+"_backup_") {
+		return "", fmt.Errorf("backup %s is not a backup of store %s", backup, store)
+	}
+	path := filepath.Join(s.config.Settings.BackupDirectory, backup)
+	if _, err := os.Lstat(path); err != nil {
+		return "", fmt.Errorf("backup %s: %w", backup, err)
+	}
+	return path, nil
+}
+
+// restoreItems identifies a backup for approvals by its name and the digest
+// of its contents
+func (s *Service) restoreItems(backup string) ([]string, error) {
+	store, _, found := strings.Cut(backup, "_backup_")
+	if !found {
+		return nil, fmt.Errorf("%s is not a backup name", backup)
+	}
+	path, err := s.backupPath(store, backup)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := hashBackup(path)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"backup:" + backup, "sha256:" + digest}, nil
+}
+
+// hashBackup returns the hex SHA-256 of a backup file, or of the relative
+// paths and contents of the files in a backup directory
+func hashBackup(path string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h.Write([]byte(filepath.ToSlash(rel) + "\n"))
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// RestoreStore restores a single configured store from one of its backups,
+// named as in the backup directory. The restore needs the same approval and
+// maintenance window as other changes, runs the store's hooks, and the
+// certificates it brings back must pass validation and the sealed trust
+// anchor list; otherwise the store is returned to how it was. The manifest
+// is updated to match.
+func (s *Service) RestoreStore(name, backup string) error {
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	store, err := s.adhocStore(name)
+	if err != nil {
+		return err
+	}
+	backupPath, err := s.backupPath(name, backup)
+	if err != nil {
+		return err
+	}
+
+	if s.dryRun {
+		fmt.Printf("DRY RUN: Would restore store %s from %s\n", name, backup)
+		return nil
+	}
+	if err := checkWritable(store); err != nil {
+		return err
+	}
+	items, err := s.restoreItems(backup)
+	if err != nil {
+		return err
+	}
+	if err := s.checkOperationApproval(approval.OpRestore, name, items); err != nil {
+		return err
+	}
+	if s.deferChanges(name, 1, "restore from "+backup) {
+		return nil
+	}
+
+	before, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list current certificates: %w", err)
+	}
+	// Always kept, so a restore that brings back refused certificates can
+	// be undone
+	undoPath, err := s.storeManager.BackupStore(name, s.config.Settings.BackupDirectory)
+	if err != nil {
+		return fmt.Errorf("backup of store %s failed, not restoring it: %w", name, err)
+	}
+	if err := s.beginChange(name); err != nil {
+		return err
+	}
+	err = s.restoreStore(name, store, backupPath, before, undoPath)
+	s.finishChange(name, err)
+	if saveErr := s.state.Save(); saveErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to save state: %w", saveErr))
+	}
+	return err
+}
+
+// restoreStore restores backupPath into a store, checks what it brought back
+// and updates the manifest
+func (s *Service) restoreStore(name string, store certstore.CertificateStore, backupPath string, before []*x509.Certificate, undoPath string) error {
+	err := store.Restore(backupPath)
+	if err == nil {
+		err = s.commitStore(name, store)
+	}
+	s.recordAudit(audit.Entry{Operation: audit.OpRestore, Store: name, Source: filepath.Base(backupPath)}, err)
+	if err != nil {
+		certstore.LogErrorf("Failed to restore store %s from %s: %v", name, backupPath, err)
+		return fmt.Errorf("failed to restore store %s: %w", name, err)
+	}
+
+	after, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list restored certificates: %w", err)
+	}
+	var restored []*Certificate
+	for _, c := range after {
+		if !certstore.ContainsCertificate(before, c) {
+			restored = append(restored, &Certificate{X509Cert: c, Source: restoreSource, Info: cert.GetCertificateInfo(c)})
+		}
+	}
+	if err := s.checkRestored(name, restored); err != nil {
+		if undoErr := store.Restore(undoPath); undoErr != nil {
+			return fmt.Errorf("%w; undoing the restore from %s failed: %v", err, undoPath, undoErr)
+		}
+		if undoErr := s.commitStore(name, store); undoErr != nil {
+			return fmt.Errorf("%w; undoing the restore from %s failed: %v", err, undoPath, undoErr)
+		}
+		return fmt.Errorf("%w; store %s was returned to its state before the restore", err, name)
+	}
+
+	for _, managed := range s.state.ManagedList(name) {
+		if !containsFingerprint(after, managed.Fingerprint) {
+			s.state.Forget(name, managed.Fingerprint)
+		}
+	}
+	for _, c := range restored {
+		if !s.state.IsManaged(name, cert.GetCertificateFingerprint(c.X509Cert)) {
+			s.state.RecordManaged(name, c.X509Cert, restoreSource+":"+filepath.Base(backupPath), nil)
+		}
+	}
+	// The store no longer holds a recorded trust set version
+	s.state.SetStoreVersion(name, "")
+
+	certstore.LogInfof("Restored store %s from %s: %d certificates brought back", name, filepath.Base(backupPath), len(restored))
+	return nil
+}
+
+// checkRestored applies the store's validation policy and the sealed trust
+// anchor list to the certificates a restore brought back
+func (s *Service) checkRestored(name string, restored []*Certificate) error {
+	storeConfig, _ := s.storeConfig(name)
+	policy := s.policy
+	policy.RequireCA = storeConfig.RequiresCA()
+	for _, c := range restored {
+		if err := s.fetcher.ValidateCertificate(c.X509Cert, policy); err != nil {
+			return fmt.Errorf("restored certificate %s rejected: %w", c.X509Cert.Subject.String(), err)
+		}
+	}
+	if _, blocked := s.sealedOnly(name, restored); blocked > 0 {
+		return fmt.Errorf("%d restored certificate(s) are not in the sealed trust anchor list", blocked)
+	}
+	return nil
+}
+
+// containsFingerprint reports whether certs holds the certificate with the
+// given SHA-256 fingerprint
+func containsFingerprint(certs []*x509.Certificate, fingerprint string) bool {
+	for _, c := range certs {
+		if cert.GetCertificateFingerprint(c) == fingerprint {
+			return true
+		}
+	}
+	return false
+}
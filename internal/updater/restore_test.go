@@ -0,0 +1,92 @@
+package updater
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// bundleStore is a memoryStore backed up to and restored from PEM bundles
+type bundleStore struct {
+	memoryStore
+}
+
+func (b *bundleStore) Backup(path string) error {
+	return os.WriteFile(path, certstore.EncodePEMBundle(b.certs), 0600)
+}
+
+func (b *bundleStore) Restore(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	b.certs, err = certstore.ParsePEMBundle(data)
+	return err
+}
+
+func TestRestoreStore(t *testing.T) {
+	dir := t.TempDir()
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.Settings.BackupDirectory = filepath.Join(dir, "backups")
+	os.Mkdir(cfg.Settings.BackupDirectory, 0700)
+	manager := certstore.NewStoreManager(nil, false)
+	current := newTestCA(t, "Current Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	store := &bundleStore{memoryStore{certs: []*x509.Certificate{current}}}
+	manager.AddStore("system", store)
+	st.RecordManaged("system", current, "test", nil)
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}, fetcher: cert.NewFetcher(5, false)}
+
+	writeBackup := func(name string, certs ...*x509.Certificate) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(cfg.Settings.BackupDirectory, name), certstore.EncodePEMBundle(certs), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := filepath.Join(dir, "system_backup_1")
+	os.WriteFile(outside, certstore.EncodePEMBundle([]*x509.Certificate{current}), 0600)
+	writeBackup("java_backup_1", current)
+	for _, backup := range []string{outside, "../system_backup_1", "java_backup_1", "system_backup_missing"} {
+		if err := s.RestoreStore("system", backup); err == nil {
+			t.Errorf("restore from %q was accepted", backup)
+		}
+	}
+
+	// A backup bringing back an expired root is refused and undone
+	expired := newTestCA(t, "Expired Root", newTestKey(t), time.Now().Add(-time.Minute), nil, nil)
+	writeBackup("system_backup_2", expired)
+	err = s.RestoreStore("system", "system_backup_2")
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("restore of an expired root = %v", err)
+	}
+	if len(store.certs) != 1 || !store.certs[0].Equal(current) {
+		t.Fatal("a refused restore was not undone")
+	}
+
+	restored := newTestCA(t, "Restored Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	writeBackup("system_backup_3", restored)
+	if err := s.RestoreStore("system", "system_backup_3"); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.certs) != 1 || !store.certs[0].Equal(restored) {
+		t.Fatal("store does not hold the restored root")
+	}
+	saved, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.IsManaged("system", cert.GetCertificateFingerprint(current)) || !saved.IsManaged("system", cert.GetCertificateFingerprint(restored)) {
+		t.Error("the saved manifest doesn't match the restored store")
+	}
+}
@@ -2,42 +2,170 @@ package updater
 
 import (
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
+	"time"
 
+	"github.com/webprofusion/trust-store-updater/internal/anchors"
+	"github.com/webprofusion/trust-store-updater/internal/audit"
 	"github.com/webprofusion/trust-store-updater/internal/cert"
 	"github.com/webprofusion/trust-store-updater/internal/certstore"
 	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/lock"
 	"github.com/webprofusion/trust-store-updater/internal/platform"
+	"github.com/webprofusion/trust-store-updater/internal/state"
 )
 
+// defaultAIAMaxDepth limits how many issuers are fetched per chain when a source does not set aia_max_depth
+const defaultAIAMaxDepth = 4
+
 // Service handles the certificate trust store update process
 type Service struct {
 	config       *config.Config
 	storeManager *certstore.StoreManager
 	fetcher      *cert.Fetcher
+	auditLog     *audit.Logger
+	state        *state.State
+	report       *Report
+	policy       cert.ValidationPolicy
+	labelers     map[string]*cert.Labeler // by source name
+	anchors      *anchors.List            // sealed allow-list, when enabled
+	conditions   *conditions
+	confirm      ConfirmFunc
+	plan         *appliedPlan              // the plan updates are limited to, see SetPlan
+	planned      *Plan                     // changes found by this run, for Plan
+	writeLock    *lock.Lock                // single-writer lock while stores are changed
+	changing     map[string]error          // stores changed this run, with their pre_update hook's result
+	deferred     map[string]time.Time      // stores outside their maintenance windows, with when one next opens
+	approved     string                    // digest of the bundle this run's approval covers, if one was needed
+	distrusted   *distrustList             // certificates this run removes and never installs
+	removals     map[string][]*Certificate // distrusted certificates staged for removal from critical stores this run
+	backedUp     map[string]bool           // stores backed up this run
+	pinned       string                    // digest the fetched bundle must have, see SetBundleDigest
+	uncommitted  map[string][]audit.Entry  // audit entries of buffered changes, by store, until commitStore
+	versionLabel string                    // label for the trust set version the next update records
+	version      *state.Version            // trust set version recorded by this run
 	verbose      bool
 	dryRun       bool
 }
 
 // New creates a new updater service
-func New(cfg *config.Config, verbose, dryRun bool) *Service {
+func New(cfg *config.Config, verbose, dryRun bool) (*Service, error) {
 	factory := platform.NewFactory(verbose)
 	storeManager := certstore.NewStoreManager(factory, verbose)
+	storeManager.SetReadOnly(cfg.Settings.ReadOnly)
 	fetcher := cert.NewFetcher(cfg.Settings.TimeoutSeconds, verbose)
+	fetcher.SetMaxBundleSize(int64(cfg.Settings.MaxBundleSizeMB) << 20)
+	fetcher.SetUserAgent(cfg.Settings.UserAgent)
+	fetcher.SetRateLimit(cfg.Settings.RequestsPerMinute)
+	fetcher.SetRetries(cfg.Settings.MaxRetries, time.Duration(cfg.Settings.MaxRetryAfterSeconds)*time.Second)
+	if cfg.Settings.AIACacheDir != "" {
+		fetcher.SetAIACache(cfg.Settings.AIACacheDir, time.Duration(cfg.Settings.AIACacheHours)*time.Hour)
+	}
+	if cfg.Settings.LowMemory {
+		fetcher.SetWorkers(1)
+	}
+
+	var auditLog *audit.Logger
+	if cfg.Audit.Enabled && !dryRun {
+		var err error
+		auditLog, err = audit.NewLogger(cfg.Audit.Path, cfg.Audit.ForwardSyslog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize audit log: %w", err)
+		}
+	}
+
+	var signer state.Signer
+	if cfg.Settings.StateSigningKey != "" {
+		var err error
+		if signer, err = state.NewSigner(cfg.Settings.StateSigningKey); err != nil {
+			return nil, err
+		}
+	}
+	st, err := state.LoadSigned(cfg.Settings.StateFile, signer)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Settings.LowMemory {
+		// A scan cache kept from before holds every listed certificate
+		st.Scan = nil
+	}
+
+	allowedEKUs, err := cert.ParseExtKeyUsages(cfg.Validation.AllowedEKUs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validation policy: %w", err)
+	}
+
+	labelers := make(map[string]*cert.Labeler)
+	for _, source := range cfg.CertificateSources {
+		labeler, err := cert.NewLabeler(source.Label, source.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("certificate source %s: %w", source.Name, err)
+		}
+		labelers[source.Name] = labeler
+	}
+
+	conds, err := compileConditions(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Service{
 		config:       cfg,
 		storeManager: storeManager,
 		fetcher:      fetcher,
-		verbose:      verbose,
-		dryRun:       dryRun,
-	}
+		auditLog:     auditLog,
+		state:        st,
+		report:       &Report{},
+		policy: cert.ValidationPolicy{
+			RejectSHA1:        cfg.Validation.RejectSHA1,
+			MinRSAKeyBits:     cfg.Validation.MinRSAKeyBits,
+			RejectUnusualEKUs: cfg.Validation.RejectUnusualEKUs,
+			AllowedEKUs:       allowedEKUs,
+			AllowList:         cfg.Validation.AllowList,
+		},
+		labelers:   labelers,
+		conditions: conds,
+		verbose:    verbose,
+		dryRun:     dryRun,
+	}, nil
+}
+
+// Close releases resources held by the service
+func (s *Service) Close() error {
+	return s.auditLog.Close()
 }
 
-// UpdateTrustStores performs the trust store update process
+// Report returns the summary of the most recent update run
+func (s *Service) Report() *Report {
+	return s.report
+}
+
+// UpdateTrustStores performs the trust store update process and records the
+// run in the history database
 func (s *Service) UpdateTrustStores() error {
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	err := s.updateTrustStores()
+	if !s.dryRun {
+		s.recordHistory(err)
+	}
+	return err
+}
+
+func (s *Service) updateTrustStores() error {
+	s.report = &Report{StartedAt: time.Now(), DryRun: s.dryRun}
+	s.changing = make(map[string]error)
+	s.planned = nil
+	s.removals = nil
+	s.backedUp = make(map[string]bool)
+
 	if s.verbose {
 		fmt.Printf("Starting trust store update process (dry-run: %v)\n", s.dryRun)
 		fmt.Printf("Platform: %s\n", runtime.GOOS)
@@ -48,41 +176,167 @@ func (s *Service) UpdateTrustStores() error {
 		return fmt.Errorf("configuration validation failed: %w", err)
 	}
 
+	// Refuse to run at all if the sealed trust anchor list can't be verified
+	if s.config.Anchors.Sealed {
+		if err := s.openAnchors(); err != nil {
+			return err
+		}
+	}
+
 	// Initialize trust stores
 	if err := s.initializeTrustStores(); err != nil {
 		return fmt.Errorf("failed to initialize trust stores: %w", err)
 	}
+	s.deferStores(time.Now())
+	if s.plan != nil {
+		if err := s.checkPreconditions(); err != nil {
+			return err
+		}
+	}
+
+	// Compare stores with the baseline from the last run before changing them
+	if s.config.Settings.DriftDetection {
+		s.report.Drift = s.detectDrift()
+	}
 
-	// Create backup if enabled
+	// Create backup if enabled. Stores whose backup failed are not modified.
+	var backupResult *certstore.OperationResult
 	if s.config.Settings.BackupEnabled && !s.dryRun {
-		if err := s.createBackups(); err != nil {
-			return fmt.Errorf("failed to create backups: %w", err)
+		backupResult = s.createBackups()
+		s.report.Operations = append(s.report.Operations, backupResult)
+		for _, failure := range backupResult.Failures {
+			certstore.LogWarnf("%v; store will not be updated", failure)
+		}
+		for _, name := range s.storeManager.StoreNames() {
+			s.backedUp[name] = !backupResult.Failed(name)
 		}
 	}
 
-	// Fetch certificates from all sources
-	allCerts, err := s.fetchAllCertificates()
+	// Fetch, validate and merge certificates from all sources
+	newCerts, err := s.mergedCertificates()
 	if err != nil {
-		return fmt.Errorf("failed to fetch certificates: %w", err)
+		return err
 	}
 
-	if s.verbose {
-		fmt.Printf("Fetched %d certificates from all sources\n", len(allCerts))
+	// A rollout pins every agent after its canary to the canary's bundle
+	s.report.BundleDigest = bundleDigest(newCerts)
+	if s.pinned != "" && s.report.BundleDigest != s.pinned {
+		return fmt.Errorf("%w: fetched %s, pinned %s", ErrBundleMismatch, s.report.BundleDigest, s.pinned)
+	}
+
+	// Tagged hosts only change trust with a signed approval of this bundle
+	s.approved = ""
+	if !s.dryRun && !s.config.Settings.ReadOnly {
+		if err := s.checkApproval(newCerts); err != nil {
+			return err
+		}
+		if s.approvalRequired() {
+			s.approved = bundleDigest(newCerts)
+		}
+	}
+
+	// Compromised CAs are never installed and are removed from every store.
+	// Entries that did load are enforced even if a list couldn't be fetched.
+	distrusted, distrustErr := s.loadDistrusted()
+	newCerts = s.withoutDistrusted(newCerts, distrusted)
+	s.distrusted = distrusted
+
+	s.version = nil
+	if !s.dryRun {
+		s.version = s.recordVersion(newCerts)
+	}
+
+	// Fetching can take a while; make sure no other instance took over
+	if err := s.verifyLock(); err != nil {
+		return err
+	}
+
+	// Keep application certificates current first, so that a store they
+	// go into runs its post_update hook once for both changes
+	if !s.config.Settings.ReadOnly && s.plan == nil {
+		s.renewACMECertificates(false, backupResult)
 	}
 
-	// Update each trust store
-	for name, store := range s.storeManager.ListStores() {
-		if err := s.updateStore(name, store, allCerts); err != nil {
-			fmt.Printf("Warning: Failed to update store %s: %v\n", name, err)
+	// Update each trust store. Stores changed before an abort are still
+	// saved, reloaded and snapshotted below.
+	var aborted error
+	for _, name := range s.storeManager.StoreNames() {
+		if aborted != nil {
+			s.report.storeReport(name).Error = "skipped: update aborted"
+			continue
+		}
+		store, _ := s.storeManager.GetStore(name)
+		if backupResult != nil && backupResult.Failed(name) {
+			s.report.storeReport(name).Error = "skipped: backup failed"
+			continue
+		}
+		if err := s.removeDistrusted(name, store, distrusted); err != nil {
+			if errors.Is(err, ErrAborted) {
+				aborted = err
+				s.report.storeReport(name).Error = "skipped: update aborted"
+				continue
+			}
+			certstore.LogWarnf("Failed to remove distrusted certificates from store %s: %v", name, err)
+		}
+		err := s.updateStore(name, store, newCerts)
+		s.finishChange(name, err)
+		if err != nil {
+			if errors.Is(err, ErrAborted) {
+				aborted = err
+				s.report.storeReport(name).Error = "skipped: update aborted"
+				continue
+			}
+			s.report.storeReport(name).Error = err.Error()
+			certstore.LogWarnf("Failed to update store %s: %v", name, err)
 			continue
 		}
 	}
 
+	s.reloadServices()
+	if !s.dryRun {
+		s.verifyStores()
+	}
+	if s.version != nil {
+		for _, name := range s.storeManager.StoreNames() {
+			if reachedVersion(s.report.storeReport(name)) {
+				s.state.SetStoreVersion(name, s.version.ID)
+			}
+		}
+	}
+	if s.plan == nil && aborted == nil {
+		s.updateSSHStores()
+		s.updateGPGStores()
+	}
+
+	if !s.dryRun {
+		if s.config.Settings.DriftDetection {
+			s.snapshotUpdatedStores()
+		}
+		if err := s.state.Save(); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+	}
+
 	// Validate stores after update
+	var validationErr error
 	if s.config.Settings.ValidateAfter && !s.dryRun {
-		if err := s.storeManager.ValidateAllStores(); err != nil {
-			return fmt.Errorf("post-update validation failed: %w", err)
-		}
+		validationResult := s.storeManager.ValidateAllStores()
+		s.report.Operations = append(s.report.Operations, validationResult)
+		validationErr = validationResult.Err()
+	}
+
+	s.report.FinishedAt = time.Now()
+	s.report.Print(os.Stdout)
+
+	if aborted != nil {
+		return aborted
+	}
+
+	if validationErr != nil {
+		return fmt.Errorf("post-update validation failed: %w", validationErr)
+	}
+	if distrustErr != nil {
+		return distrustErr
 	}
 
 	if s.verbose {
@@ -96,7 +350,7 @@ func (s *Service) UpdateTrustStores() error {
 func (s *Service) initializeTrustStores() error {
 	currentPlatform := platform.GetCurrentPlatform()
 
-	for _, storeConfig := range s.config.TrustStores {
+	for _, storeConfig := range s.config.OrderedTrustStores() {
 		if !storeConfig.Enabled {
 			if s.verbose {
 				fmt.Printf("Skipping disabled store: %s\n", storeConfig.Name)
@@ -112,20 +366,46 @@ func (s *Service) initializeTrustStores() error {
 			continue
 		}
 
+		if !appliesToHost(storeConfig) {
+			if s.verbose {
+				fmt.Printf("Skipping store %s: host does not match its include/exclude constraints\n", storeConfig.Name)
+			}
+			continue
+		}
+		if !s.conditions.store(storeConfig.Name) {
+			if s.verbose {
+				fmt.Printf("Skipping store %s: condition %q is false on this host\n", storeConfig.Name, storeConfig.When)
+			}
+			continue
+		}
+
 		// Check root privileges if required
 		if storeConfig.RequireRoot && os.Geteuid() != 0 {
-			fmt.Printf("Warning: Store %s requires root privileges, skipping\n", storeConfig.Name)
+			certstore.LogWarnf("Store %s requires root privileges, skipping", storeConfig.Name)
 			continue
 		}
 
 		// Create store
 		storeType := certstore.StoreType(storeConfig.Type)
-		err := s.storeManager.CreateAndAddStore(storeConfig.Name, storeType, storeConfig.Target, storeConfig.Options)
+		var err error
+		if storeType == certstore.StoreTypeCustom {
+			err = s.storeManager.CreateAndAddProviderStore(storeConfig.Name, storeConfig.Provider, storeConfig.Target, storeConfig.Options)
+		} else {
+			err = s.storeManager.CreateAndAddStore(storeConfig.Name, storeType, storeConfig.Target, storeConfig.Options)
+		}
 		if err != nil {
-			fmt.Printf("Warning: Failed to create store %s: %v\n", storeConfig.Name, err)
+			certstore.LogWarnf("Failed to create store %s: %v", storeConfig.Name, err)
 			continue
 		}
 
+		store, _ := s.storeManager.GetStore(storeConfig.Name)
+		if setter, ok := store.(certstore.CommandTimeoutSetter); ok {
+			setter.SetCommandTimeout(s.commandTimeout(storeConfig))
+		}
+		if setter, ok := store.(certstore.ScanCacheSetter); ok && !s.config.Settings.LowMemory {
+			setter.SetScanCache(s.state.ScanCache())
+		}
+
 		if s.verbose {
 			fmt.Printf("Initialized store: %s (%s)\n", storeConfig.Name, storeConfig.Target)
 		}
@@ -134,8 +414,80 @@ func (s *Service) initializeTrustStores() error {
 	return nil
 }
 
+// appliesToHost evaluates a store's include/exclude constraints on this host
+func appliesToHost(storeConfig config.TrustStore) bool {
+	return platform.Applies(platform.CurrentHost(), hostConstraints(storeConfig.Include), hostConstraints(storeConfig.Exclude))
+}
+
+// hostConstraints converts configured constraints for the platform package
+func hostConstraints(constraints []config.HostConstraint) []platform.Constraint {
+	converted := make([]platform.Constraint, len(constraints))
+	for i, c := range constraints {
+		converted[i] = platform.Constraint{OS: c.OS, Arch: c.Arch, Distro: c.Distro, DistroVersion: c.DistroVersion}
+	}
+	return converted
+}
+
+// commandTimeout returns the limit for external commands run by a store
+func (s *Service) commandTimeout(storeConfig config.TrustStore) time.Duration {
+	seconds := storeConfig.CommandTimeout
+	if seconds <= 0 {
+		seconds = s.config.Settings.CommandTimeout
+	}
+	if seconds <= 0 {
+		return certstore.DefaultCommandTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// MergedCertificates fetches every enabled source and returns the validated,
+// de-duplicated trust set without touching any store
+func (s *Service) MergedCertificates() ([]*Certificate, error) {
+	s.report = &Report{StartedAt: time.Now(), DryRun: true}
+	return s.mergedCertificates()
+}
+
+// Inventory returns the certificates this tool manages in each enabled store,
+// as recorded in the state manifest
+func (s *Service) Inventory() map[string][]*state.ManagedCertificate {
+	inventory := make(map[string][]*state.ManagedCertificate)
+	for _, storeConfig := range s.config.OrderedTrustStores() {
+		if storeConfig.Enabled && platform.IsPlatformSupported(storeConfig.Platform) && appliesToHost(storeConfig) && s.conditions.store(storeConfig.Name) {
+			inventory[storeConfig.Name] = s.state.ManagedList(storeConfig.Name)
+		}
+	}
+	return inventory
+}
+
+// mergedCertificates fetches all sources, applies the composition, merges
+// them in configuration order and collapses duplicate public keys according to the duplicate policy
+func (s *Service) mergedCertificates() ([]*Certificate, error) {
+	allCerts, err := s.fetchAllCertificates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch certificates: %w", err)
+	}
+	if allCerts, err = s.composeSources(allCerts); err != nil {
+		return nil, err
+	}
+
+	var merged []*Certificate
+	for _, source := range s.config.CertificateSources {
+		merged = append(merged, allCerts[source.Name]...)
+	}
+	s.report.Fetched = len(merged)
+
+	certs, duplicates := dedupeCertificates(merged, s.config.Settings.DuplicatePolicy)
+	s.report.Duplicates = duplicates
+
+	if s.verbose {
+		fmt.Printf("Fetched %d certificates from all sources (%d after removing duplicates)\n", len(merged), len(certs))
+	}
+
+	return certs, nil
+}
+
 // createBackups creates backups of all stores
-func (s *Service) createBackups() error {
+func (s *Service) createBackups() *certstore.OperationResult {
 	if s.verbose {
 		fmt.Printf("Creating backups in directory: %s\n", s.config.Settings.BackupDirectory)
 	}
@@ -147,6 +499,10 @@ func (s *Service) createBackups() error {
 func (s *Service) fetchAllCertificates() (map[string][]*Certificate, error) {
 	allCerts := make(map[string][]*Certificate)
 
+	if err := s.captivePortalPreflight(); err != nil {
+		return nil, err
+	}
+
 	for _, source := range s.config.CertificateSources {
 		if !source.Enabled {
 			if s.verbose {
@@ -154,10 +510,16 @@ func (s *Service) fetchAllCertificates() (map[string][]*Certificate, error) {
 			}
 			continue
 		}
+		if !s.conditions.source(source.Name) {
+			if s.verbose {
+				fmt.Printf("Skipping source %s: condition %q is false on this host\n", source.Name, source.When)
+			}
+			continue
+		}
 
 		certs, err := s.fetchFromSource(source)
 		if err != nil {
-			fmt.Printf("Warning: Failed to fetch from source %s: %v\n", source.Name, err)
+			certstore.LogWarnf("Failed to fetch from source %s: %v", source.Name, err)
 			continue
 		}
 
@@ -171,96 +533,429 @@ func (s *Service) fetchAllCertificates() (map[string][]*Certificate, error) {
 	return allCerts, nil
 }
 
+// captivePortalPreflight refuses to fetch url sources when the configured
+// connectivity check shows a captive portal or intercepting proxy
+func (s *Service) captivePortalPreflight() error {
+	checkURL := s.config.Settings.CaptivePortalCheckURL
+	if checkURL == "" {
+		return nil
+	}
+	for _, source := range s.config.CertificateSources {
+		if source.Enabled && (source.Type == "url" || source.Type == "authroot") {
+			if err := s.fetcher.CheckCaptivePortal(checkURL); err != nil {
+				return fmt.Errorf("preflight failed, not fetching url sources: %w", err)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
 // fetchFromSource fetches certificates from a single source
 func (s *Service) fetchFromSource(source config.CertificateSource) ([]*Certificate, error) {
-	var rawCerts []*x509.Certificate
+	rawCerts, provenance, err := s.fetchRawCertificates(source)
+	if err != nil {
+		return nil, err
+	}
+	return s.acceptCertificates(source, rawCerts, provenance)
+}
+
+// fetchRawCertificates fetches a source's certificates, completing chains via
+// AIA when enabled, before any filtering or validation. The provenance of each
+// certificate is indexed by fingerprint.
+func (s *Service) fetchRawCertificates(source config.CertificateSource) ([]*x509.Certificate, map[string]*state.Provenance, error) {
+	var bundles []*cert.Bundle
 	var err error
 
 	switch source.Type {
 	case "url":
-		rawCerts, err = s.fetcher.FetchFromURL(source.Source, source.Headers, source.VerifyTLS)
+		opts := cert.FetchOptions{
+			Headers:      source.Headers,
+			VerifyTLS:    source.VerifyTLS,
+			MaxBytes:     int64(source.MaxSizeMB) << 20,
+			ContentTypes: source.ContentTypes,
+			SHA256:       source.SHA256,
+
+			RequestsPerMinute: source.RequestsPerMinute,
+			DoHResolver:       source.DoHResolver,
+		}
+		if len(source.Resolve) > 0 {
+			opts.Resolve = make(map[string]string, len(source.Resolve))
+			for host, addr := range source.Resolve {
+				opts.Resolve[strings.ToLower(host)] = addr
+			}
+		}
+		if source.PinnedCA != "" {
+			if opts.PinnedCAs, err = cert.LoadPinnedCAs(source.PinnedCA); err != nil {
+				return nil, nil, err
+			}
+		}
+		var bundle *cert.Bundle
+		bundle, err = s.fetcher.FetchURLBundle(source.Source, opts)
+		bundles = []*cert.Bundle{bundle}
 	case "file":
-		rawCerts, err = s.fetcher.FetchFromFile(source.Source)
+		var bundle *cert.Bundle
+		bundle, err = s.fetcher.FetchFileBundle(source.Source)
+		bundles = []*cert.Bundle{bundle}
 	case "directory":
-		rawCerts, err = s.fetcher.FetchFromDirectory(source.Source, source.Filters)
+		bundles, err = s.fetcher.FetchDirectoryBundles(source.Source, source.Filters)
+	case "authroot":
+		var bundle *cert.Bundle
+		bundle, err = s.fetchAuthRoot(source)
+		bundles = []*cert.Bundle{bundle}
+	case "apple":
+		var bundle *cert.Bundle
+		bundle, err = s.fetchAppleRoots()
+		bundles = []*cert.Bundle{bundle}
 	default:
-		return nil, fmt.Errorf("unsupported source type: %s", source.Type)
+		return nil, nil, fmt.Errorf("unsupported source type: %s", source.Type)
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	var rawCerts []*x509.Certificate
+	provenance := make(map[string]*state.Provenance)
+	for _, bundle := range bundles {
+		p := &state.Provenance{
+			Source:       source.Name,
+			Location:     bundle.Location,
+			RetrievedAt:  bundle.RetrievedAt,
+			BundleSHA256: bundle.SHA256,
+		}
+		for _, c := range bundle.Certificates {
+			provenance[cert.GetCertificateFingerprint(c)] = p
+		}
+		rawCerts = append(rawCerts, bundle.Certificates...)
+	}
+
+	// Complete partial chains by following AIA issuer URLs
+	if source.AIAChasing {
+		maxDepth := source.AIAMaxDepth
+		if maxDepth <= 0 {
+			maxDepth = defaultAIAMaxDepth
+		}
+		chased := s.fetcher.CompleteChain(rawCerts, maxDepth)
+		retrievedAt := time.Now().UTC()
+		for _, c := range chased {
+			fp := cert.GetCertificateFingerprint(c)
+			if provenance[fp] == nil {
+				provenance[fp] = &state.Provenance{Source: source.Name, Location: "aia", RetrievedAt: retrievedAt}
+			}
+		}
+		rawCerts = append(rawCerts, chased...)
 	}
 
+	return rawCerts, provenance, nil
+}
+
+// acceptCertificates applies a source's filters and the validation policy,
+// recording rejected certificates in the report, and labels the rest
+func (s *Service) acceptCertificates(source config.CertificateSource, rawCerts []*x509.Certificate, provenance map[string]*state.Provenance) ([]*Certificate, error) {
 	// Filter certificates
 	filteredCerts := cert.FilterCertificates(rawCerts, source.Filters)
 
+	// Sources may opt out of the CA requirement to supply end-entity certificates
+	policy := s.policy
+	policy.RequireCA = source.RequiresCA()
+
 	// Convert to our certificate type and validate
 	var validCerts []*Certificate
 	for _, rawCert := range filteredCerts {
-		if err := s.fetcher.ValidateCertificate(rawCert); err != nil {
+		if err := s.fetcher.ValidateCertificate(rawCert, policy); err != nil {
+			s.report.Rejected = append(s.report.Rejected, Rejection{
+				Subject:     rawCert.Subject.String(),
+				Fingerprint: cert.GetCertificateFingerprint(rawCert),
+				Source:      source.Name,
+				Reason:      err.Error(),
+			})
 			if s.verbose {
 				fmt.Printf("Warning: Certificate validation failed for %s: %v\n", rawCert.Subject.CommonName, err)
 			}
 			continue
 		}
 
+		label, err := s.labelers[source.Name].Label(rawCert, source.Name)
+		if err != nil {
+			return nil, err
+		}
+
 		certInfo := &Certificate{
-			X509Cert: rawCert,
-			Source:   source.Name,
-			Info:     cert.GetCertificateInfo(rawCert),
+			X509Cert:   rawCert,
+			Source:     source.Name,
+			Label:      label,
+			Purposes:   source.TrustPurposes,
+			Info:       cert.GetCertificateInfo(rawCert),
+			Provenance: provenance[cert.GetCertificateFingerprint(rawCert)],
 		}
 		validCerts = append(validCerts, certInfo)
 	}
 
+	if source.NameConstraints != nil {
+		return s.constrainCertificates(source, validCerts)
+	}
 	return validCerts, nil
 }
 
 // updateStore updates a single trust store with certificates
-func (s *Service) updateStore(name string, store certstore.CertificateStore, allCerts map[string][]*Certificate) error {
+func (s *Service) updateStore(name string, store certstore.CertificateStore, newCerts []*Certificate) error {
 	if s.verbose {
 		fmt.Printf("Updating store: %s\n", name)
 	}
 
-	if s.dryRun {
-		fmt.Printf("DRY RUN: Would update store %s with certificates\n", name)
-		return nil
-	}
+	storeReport := s.report.storeReport(name)
 
 	// Get current certificates in store
 	currentCerts, err := store.ListCertificates()
 	if err != nil {
 		return fmt.Errorf("failed to list current certificates: %w", err)
 	}
-
-	// Collect all new certificates
-	var newCerts []*Certificate
-	for _, sourceCerts := range allCerts {
-		newCerts = append(newCerts, sourceCerts...)
+	if s.dryRun {
+		s.recordStore(name, currentCerts)
 	}
 
+	// Apply the store's own policy before comparing with its contents
+	applicable := s.certificatesForStore(name, store, newCerts)
+	storeReport.Excluded = len(newCerts) - len(applicable)
+
 	// Determine which certificates to add
-	toAdd := s.findCertificatesToAdd(currentCerts, newCerts)
+	toAdd := s.findCertificatesToAdd(currentCerts, applicable)
+	storeReport.Skipped = len(applicable) - len(toAdd)
+	toAdd, storeReport.Blocked = s.sealedOnly(name, toAdd)
+	toAdd, storeReport.Unplanned = s.plannedOnly(name, toAdd)
+
+	if len(toAdd) > 0 {
+		if err := checkWritable(store); err != nil {
+			return s.readOnlyFallback(name, currentCerts, toAdd, err)
+		}
+	}
+
+	if s.dryRun {
+		fmt.Printf("DRY RUN: Would add %d certificates to store %s\n", len(toAdd), name)
+		storeReport.Added = len(toAdd)
+		for _, c := range toAdd {
+			s.recordChange(OpAdd, name, c.X509Cert, c.Source, "in source "+c.Source)
+		}
+		return nil
+	}
+	if len(toAdd) > 0 && s.isCritical(name) {
+		return s.stageChanges(name, currentCerts, toAdd, s.removals[name])
+	}
+	if len(toAdd) > 0 && s.deferChanges(name, len(toAdd), fmt.Sprintf("add %d certificates", len(toAdd))) {
+		return nil
+	}
+
+	if s.confirm != nil && len(toAdd) > 0 {
+		approved, err := s.confirm(StorePlan{Store: name, Add: toAdd})
+		if err != nil {
+			return err
+		}
+		if !approved {
+			storeReport.Error = "skipped: not confirmed"
+			return nil
+		}
+	}
+
+	if len(toAdd) > 0 {
+		if err := s.beginChange(name); err != nil {
+			return err
+		}
+	}
 
 	if s.verbose {
 		fmt.Printf("Adding %d new certificates to store %s\n", len(toAdd), name)
 	}
 
 	// Add new certificates
+	var added []*Certificate
 	for _, certToAdd := range toAdd {
-		if err := store.AddCertificate(certToAdd.X509Cert); err != nil {
-			fmt.Printf("Warning: Failed to add certificate %s to store %s: %v\n",
+		if err := s.addCertificate(name, store, certToAdd); err != nil {
+			storeReport.Failed++
+			certstore.LogWarnf("Failed to add certificate %s to store %s: %v",
 				certToAdd.X509Cert.Subject.CommonName, name, err)
-		} else if s.verbose {
-			fmt.Printf("Added certificate: %s\n", certToAdd.X509Cert.Subject.CommonName)
+		} else {
+			storeReport.Added++
+			added = append(added, certToAdd)
+			storeReport.Installed = append(storeReport.Installed, Installation{
+				Fingerprint: cert.GetCertificateFingerprint(certToAdd.X509Cert),
+				Subject:     certToAdd.X509Cert.Subject.String(),
+				Source:      certToAdd.Source,
+			})
+			certstore.LogDebugf("Added certificate %s (%s) to store %s from source %s",
+				certToAdd.X509Cert.Subject.CommonName, cert.GetCertificateFingerprint(certToAdd.X509Cert), name, certToAdd.Source)
+		}
+	}
+
+	if rebuilder, ok := store.(certstore.Rebuilder); ok {
+		storeReport.Rebuild = rebuilder.RebuildSummary()
+	}
+	if notifier, ok := store.(certstore.RebootNotifier); ok {
+		if storeReport.Reboot = notifier.PendingReboot(); storeReport.Reboot != "" {
+			certstore.LogWarnf("Store %s: reboot required: %s", name, storeReport.Reboot)
+		}
+	}
+	if reporter, ok := store.(certstore.TargetReporter); ok {
+		storeReport.Targets = reporter.TargetResults()
+	}
+
+	if err := s.commitStore(name, store); err != nil {
+		// Nothing was published, so none of the additions took effect
+		for _, c := range added {
+			s.state.Forget(name, cert.GetCertificateFingerprint(c.X509Cert))
 		}
+		storeReport.Failed += storeReport.Added
+		storeReport.Added = 0
+		storeReport.Installed = nil
+		return err
 	}
 
 	return nil
 }
 
-// findCertificatesToAdd determines which certificates need to be added
+// commitStore applies changes buffered by stores that publish in one step,
+// then records their audit entries with the outcome of the commit
+func (s *Service) commitStore(name string, store certstore.CertificateStore) error {
+	committer, ok := store.(certstore.Committer)
+	if !ok {
+		return nil
+	}
+	err := committer.Commit()
+	if err != nil {
+		err = fmt.Errorf("failed to commit changes: %w", err)
+	}
+	for _, entry := range s.uncommitted[name] {
+		s.recordAudit(entry, err)
+	}
+	delete(s.uncommitted, name)
+	return err
+}
+
+// storeConfig returns the configuration for the named store
+func (s *Service) storeConfig(name string) (config.TrustStore, bool) {
+	for _, storeConfig := range s.config.TrustStores {
+		if storeConfig.Name == name {
+			return storeConfig, true
+		}
+	}
+	return config.TrustStore{}, false
+}
+
+// certificatesForStore filters certificates by the store's policy. Stores
+// require CA certificates unless configured with require_ca: false, stores
+// holding only some kinds of certificate filter the rest, and certificates
+// with trust purposes need a store that can limit trust to them.
+func (s *Service) certificatesForStore(name string, store certstore.CertificateStore, certs []*Certificate) []*Certificate {
+	storeConfig, _ := s.storeConfig(name)
+	filter, _ := store.(certstore.CertificateFilter)
+
+	var applicable []*Certificate
+	for _, c := range certs {
+		if storeConfig.RequiresCA() && !c.X509Cert.IsCA {
+			if s.verbose {
+				fmt.Printf("Skipping end-entity certificate %s for store %s: store requires CA certificates\n", c.X509Cert.Subject.CommonName, name)
+			}
+			continue
+		}
+		if filter != nil && !filter.Accepts(c.X509Cert) {
+			if s.verbose {
+				fmt.Printf("Skipping certificate %s for store %s: the store doesn't hold this kind of certificate\n", c.X509Cert.Subject.CommonName, name)
+			}
+			continue
+		}
+		if !s.canScope(name, store, c) {
+			continue
+		}
+		applicable = append(applicable, c)
+	}
+	return applicable
+}
+
+// addCertificate adds a certificate to a store and records the outcome in the audit log
+func (s *Service) addCertificate(name string, store certstore.CertificateStore, c *Certificate) error {
+	var err error
+	purposes, _ := s.trustPurposes(name, c)
+	adder, scoped := store.(certstore.PurposeAdder)
+	if len(purposes) > 0 && !(scoped && supportsPurposes(adder, purposes)) {
+		err = fmt.Errorf("store %s can't limit trust to %s", name, strings.Join(purposes, ", "))
+	} else if len(purposes) > 0 {
+		err = adder.AddCertificateForPurposes(c.X509Cert, c.Label, purposes)
+	} else if labeled, ok := store.(certstore.LabeledAdder); ok && c.Label != "" {
+		err = labeled.AddCertificateWithLabel(c.X509Cert, c.Label)
+	} else {
+		err = store.AddCertificate(c.X509Cert)
+	}
+	entry := newAuditEntry(audit.OpAdd, name, c.X509Cert, c.Source)
+	if p := c.Provenance; p != nil {
+		entry.SourceLocation = p.Location
+		entry.RetrievedAt = &p.RetrievedAt
+		entry.BundleSHA256 = p.BundleSHA256
+	}
+	s.auditChange(name, store, entry, err)
+	if err == nil {
+		s.state.RecordManaged(name, c.X509Cert, c.Source, c.Provenance)
+	}
+	return err
+}
+
+// removeCertificate removes a certificate from a store, records the outcome in
+// the audit log and drops it from the managed state
+func (s *Service) removeCertificate(name string, store certstore.CertificateStore, x509Cert *x509.Certificate, source string) error {
+	err := store.RemoveCertificate(x509Cert)
+	s.auditChange(name, store, newAuditEntry(audit.OpRemove, name, x509Cert, source), err)
+	if err == nil {
+		s.state.Forget(name, cert.GetCertificateFingerprint(x509Cert))
+	}
+	return err
+}
+
+func newAuditEntry(op audit.Operation, storeName string, x509Cert *x509.Certificate, source string) audit.Entry {
+	return audit.Entry{
+		Operation:   op,
+		Store:       storeName,
+		Fingerprint: cert.GetCertificateFingerprint(x509Cert),
+		Subject:     x509Cert.Subject.String(),
+		Source:      source,
+	}
+}
+
+// auditChange records the outcome of adding or removing a certificate. A
+// store that buffers changes hasn't published a successful one yet, so its
+// entry waits for commitStore to record the commit's outcome.
+func (s *Service) auditChange(name string, store certstore.CertificateStore, entry audit.Entry, opErr error) {
+	if _, buffered := store.(certstore.Committer); buffered && opErr == nil {
+		if s.uncommitted == nil {
+			s.uncommitted = make(map[string][]audit.Entry)
+		}
+		s.uncommitted[name] = append(s.uncommitted[name], entry)
+		return
+	}
+	s.recordAudit(entry, opErr)
+}
+
+// recordAudit writes an audit entry with the outcome derived from opErr
+func (s *Service) recordAudit(entry audit.Entry, opErr error) {
+	if s.auditLog == nil {
+		return
+	}
+
+	entry.Outcome = audit.OutcomeSuccess
+	if opErr != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = opErr.Error()
+	}
+
+	if err := s.auditLog.Record(entry); err != nil {
+		certstore.LogErrorf("Failed to write audit log: %v", err)
+	}
+}
+
+// findCertificatesToAdd determines which certificates need to be added. Unless
+// every duplicate variant is wanted, a certificate whose public key is already
+// trusted by the store is not added again.
 func (s *Service) findCertificatesToAdd(currentCerts []*x509.Certificate, newCerts []*Certificate) []*Certificate {
 	var toAdd []*Certificate
+	skipVariants := s.config.Settings.DuplicatePolicy != DuplicatePolicyAll && s.config.Settings.DuplicatePolicy != ""
 
 	for _, newCert := range newCerts {
 		found := false
@@ -271,6 +966,13 @@ func (s *Service) findCertificatesToAdd(currentCerts []*x509.Certificate, newCer
 			}
 		}
 
+		if !found && skipVariants && hasSPKIVariant(currentCerts, newCert.X509Cert) {
+			if s.verbose {
+				fmt.Printf("Skipping %s: store already trusts a variant with the same public key\n", newCert.X509Cert.Subject.CommonName)
+			}
+			found = true
+		}
+
 		if !found {
 			toAdd = append(toAdd, newCert)
 		}
@@ -281,7 +983,10 @@ func (s *Service) findCertificatesToAdd(currentCerts []*x509.Certificate, newCer
 
 // Certificate represents a certificate with metadata
 type Certificate struct {
-	X509Cert *x509.Certificate
-	Source   string
-	Info     map[string]interface{}
+	X509Cert   *x509.Certificate
+	Source     string
+	Label      string   // alias/friendly name for stores that support one; may be empty
+	Purposes   []string // trust purposes the source limits the certificate to; none means unrestricted
+	Info       map[string]interface{}
+	Provenance *state.Provenance // where and when the certificate was retrieved; nil if unknown
 }
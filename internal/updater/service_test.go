@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/audit"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// committingStore is a memoryStore that buffers changes until Commit
+type committingStore struct {
+	memoryStore
+	commitErr error
+	commits   int
+}
+
+func (c *committingStore) Commit() error {
+	c.commits++
+	return c.commitErr
+}
+
+func TestAuditWaitsForCommit(t *testing.T) {
+	dir := t.TempDir()
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditPath := filepath.Join(dir, "audit.jsonl")
+	auditLog, err := audit.NewLogger(auditPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{config: &config.Config{}, state: st, auditLog: auditLog, report: &Report{}}
+	root := newTestCA(t, "Buffered Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	certs := []*Certificate{{X509Cert: root, Source: "test"}}
+
+	failing := &committingStore{commitErr: errors.New("upload failed")}
+	if err := s.updateStore("failing", failing, certs); err == nil {
+		t.Fatal("expected the failed commit to be reported")
+	}
+	published := &committingStore{}
+	if err := s.updateStore("published", published, certs); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := audit.Read(auditPath, audit.Filter{Operation: audit.OpAdd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outcomes := make(map[string]string)
+	for _, e := range entries {
+		if _, seen := outcomes[e.Store]; seen {
+			t.Errorf("store %s has more than one add entry", e.Store)
+		}
+		outcomes[e.Store] = e.Outcome
+	}
+	if outcomes["failing"] != audit.OutcomeFailure || outcomes["published"] != audit.OutcomeSuccess {
+		t.Errorf("audit outcomes = %v, want a failure for the failed commit only", outcomes)
+	}
+	if len(s.uncommitted) != 0 {
+		t.Errorf("entries left waiting for a commit: %v", s.uncommitted)
+	}
+}
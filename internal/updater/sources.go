@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// SourceResult is the outcome of fetching one certificate source without
+// touching any store
+type SourceResult struct {
+	Name     string
+	Type     string
+	Source   string
+	Duration time.Duration
+	Err      error
+	Fetched  int // certificates retrieved, including AIA issuers
+	Filtered int // certificates dropped by the source's filters
+	Accepted []*Certificate
+	Rejected []Rejection
+	Warnings []string
+}
+
+// TestSources fetches the named sources, or every enabled source when names
+// is empty, and reports reachability, latency, certificate counts, policy
+// results and parse warnings for each. Stores are never initialized or
+// modified, so this is safe to run while authoring configuration.
+func (s *Service) TestSources(names []string) ([]SourceResult, error) {
+	sources, err := s.selectSources(names)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.captivePortalPreflight(); err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	s.fetcher.SetWarningHandler(func(message string) {
+		warnings = append(warnings, message)
+	})
+	defer s.fetcher.SetWarningHandler(nil)
+
+	results := make([]SourceResult, 0, len(sources))
+	for _, source := range sources {
+		warnings = nil
+		result := SourceResult{Name: source.Name, Type: source.Type, Source: source.Source}
+		rejectedBefore := len(s.report.Rejected)
+
+		start := time.Now()
+		rawCerts, provenance, err := s.fetchRawCertificates(source)
+		result.Duration = time.Since(start)
+		if err == nil {
+			result.Fetched = len(rawCerts)
+			result.Accepted, err = s.acceptCertificates(source, rawCerts, provenance)
+			result.Rejected = s.report.Rejected[rejectedBefore:]
+			result.Filtered = result.Fetched - len(result.Accepted) - len(result.Rejected)
+		}
+		result.Err = err
+		result.Warnings = warnings
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// selectSources returns the enabled sources, or the named ones in
+// configuration order whether enabled or not
+func (s *Service) selectSources(names []string) ([]config.CertificateSource, error) {
+	if len(names) == 0 {
+		var enabled []config.CertificateSource
+		for _, source := range s.config.CertificateSources {
+			if source.Enabled {
+				enabled = append(enabled, source)
+			}
+		}
+		return enabled, nil
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var selected []config.CertificateSource
+	for _, source := range s.config.CertificateSources {
+		if wanted[source.Name] {
+			selected = append(selected, source)
+			delete(wanted, source.Name)
+		}
+	}
+	for _, name := range names {
+		if wanted[name] {
+			return nil, fmt.Errorf("unknown certificate source: %s", name)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+func TestTestSources(t *testing.T) {
+	dir := t.TempDir()
+	valid := newTestCA(t, "Valid Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	expired := newTestCA(t, "Expired Root", newTestKey(t), time.Now().Add(-time.Minute), nil, nil)
+	var bundle []byte
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: valid.Raw})...)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: expired.Raw})...)
+	bundle = append(bundle, "-----BEGIN CERTIFICATE-----\n!!!!\n-----END CERTIFICATE-----\n"...)
+	if err := os.WriteFile(filepath.Join(dir, "bundle.pem"), bundle, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{CertificateSources: []config.CertificateSource{
+		{Name: "local", Type: "directory", Source: dir, Enabled: true},
+		{Name: "missing", Type: "file", Source: filepath.Join(dir, "missing.pem")},
+	}}
+	s := &Service{config: cfg, fetcher: cert.NewFetcher(5, false), report: &Report{}}
+
+	results, err := s.TestSources(nil)
+	if err != nil {
+		t.Fatalf("TestSources: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected only the enabled source, got %d results", len(results))
+	}
+	local := results[0]
+	if local.Err != nil || local.Fetched != 2 || len(local.Accepted) != 1 || len(local.Rejected) != 1 {
+		t.Errorf("local: err=%v fetched=%d accepted=%d rejected=%d", local.Err, local.Fetched, len(local.Accepted), len(local.Rejected))
+	}
+	if len(local.Warnings) != 1 || !strings.Contains(local.Warnings[0], "decode") {
+		t.Errorf("warnings = %q", local.Warnings)
+	}
+
+	// Named sources are tested even when disabled
+	results, err = s.TestSources([]string{"missing"})
+	if err != nil {
+		t.Fatalf("TestSources: %v", err)
+	}
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("expected the missing file to fail, got %+v", results)
+	}
+
+	if _, err := s.TestSources([]string{"nope"}); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+}
+
+func TestProvenanceReachesManifest(t *testing.T) {
+	dir := t.TempDir()
+	root := newTestCA(t, "Provenance Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+	path := filepath.Join(dir, "roots.pem")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := config.CertificateSource{Name: "local", Type: "file", Source: path, Enabled: true}
+	s := &Service{config: &config.Config{}, fetcher: cert.NewFetcher(5, false), state: st, report: &Report{}}
+	certs, err := s.fetchFromSource(source)
+	if err != nil || len(certs) != 1 {
+		t.Fatalf("fetchFromSource = %d, %v", len(certs), err)
+	}
+
+	digest := sha256.Sum256(data)
+	p := certs[0].Provenance
+	if p == nil || p.Source != "local" || p.Location != path || p.BundleSHA256 != hex.EncodeToString(digest[:]) || p.RetrievedAt.IsZero() {
+		t.Fatalf("provenance = %+v", p)
+	}
+
+	if err := s.addCertificate("memory", &memoryStore{}, certs[0]); err != nil {
+		t.Fatalf("addCertificate: %v", err)
+	}
+	managed := st.ManagedList("memory")
+	if len(managed) != 1 || managed[0].Provenance != p {
+		t.Errorf("manifest provenance = %+v", managed)
+	}
+}
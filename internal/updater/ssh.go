@@ -0,0 +1,186 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/sshca"
+)
+
+// updateSSHStores syncs the managed block of each SSH CA file with the keys
+// from the configured authorities. Unlike X.509 stores the block is replaced
+// as a whole, so rotated-out CA keys are removed. In read-only mode the files
+// are only compared, and a store that is out of date reports ErrReadOnly.
+func (s *Service) updateSSHStores() {
+	if len(s.config.SSH.Stores) == 0 {
+		return
+	}
+
+	// A failed authority must not wipe its keys from the managed files, so
+	// nothing is changed unless every authority was fetched
+	keys, fetchErr := s.fetchSSHAuthorities()
+
+	for _, storeConfig := range s.config.SSH.Stores {
+		if !storeConfig.Enabled {
+			continue
+		}
+
+		storeReport := s.report.storeReport(storeConfig.Name)
+		if fetchErr != nil {
+			storeReport.Error = "skipped: " + fetchErr.Error()
+			continue
+		}
+		if err := s.updateSSHStore(storeConfig, keys, storeReport); err != nil {
+			storeReport.Error = err.Error()
+			certstore.LogWarnf("Failed to update SSH store %s: %v", storeConfig.Name, err)
+		}
+	}
+}
+
+// fetchSSHAuthorities returns the keys of each enabled authority, keyed by authority name
+func (s *Service) fetchSSHAuthorities() (map[string][]sshca.PublicKey, error) {
+	keys := make(map[string][]sshca.PublicKey)
+	var failed []string
+	for _, authority := range s.config.SSH.Authorities {
+		if !authority.Enabled {
+			continue
+		}
+
+		var data []byte
+		var err error
+		switch authority.Type {
+		case "url":
+			data, err = s.fetcher.FetchRaw(authority.Source, authority.Headers)
+		case "file":
+			data, err = os.ReadFile(authority.Source)
+		default:
+			err = fmt.Errorf("unsupported SSH authority type: %s", authority.Type)
+		}
+		if err == nil {
+			keys[authority.Name], err = sshca.ParsePublicKeys(data)
+		}
+		if err != nil {
+			certstore.LogWarnf("Failed to fetch SSH authority %s: %v", authority.Name, err)
+			failed = append(failed, authority.Name)
+			continue
+		}
+
+		if s.verbose {
+			fmt.Printf("Fetched %d SSH CA keys from %s\n", len(keys[authority.Name]), authority.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("failed to fetch SSH authorities: %s", strings.Join(failed, ", "))
+	}
+	return keys, nil
+}
+
+func (s *Service) updateSSHStore(storeConfig config.SSHStore, keys map[string][]sshca.PublicKey, storeReport *StoreReport) error {
+	selected := storeConfig.Authorities
+	if len(selected) == 0 {
+		for _, authority := range s.config.SSH.Authorities {
+			if authority.Enabled {
+				selected = append(selected, authority.Name)
+			}
+		}
+	}
+
+	var storeKeys []sshca.PublicKey
+	seen := make(map[string]bool)
+	for _, name := range selected {
+		authorityKeys, exists := keys[name]
+		if !exists {
+			return fmt.Errorf("unknown or disabled SSH authority: %s", name)
+		}
+		for _, k := range authorityKeys {
+			if fp := k.Fingerprint(); !seen[fp] {
+				seen[fp] = true
+				storeKeys = append(storeKeys, k)
+			}
+		}
+	}
+
+	var lines []string
+	switch storeConfig.Type {
+	case "trusted_user_ca_keys":
+		lines = sshca.TrustedUserCAKeysLines(storeKeys)
+	case "known_hosts":
+		lines = sshca.KnownHostsLines(storeKeys, storeConfig.Hosts)
+	default:
+		return fmt.Errorf("unsupported SSH store type: %s", storeConfig.Type)
+	}
+
+	current, err := sshca.ManagedLines(storeConfig.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", storeConfig.Path, err)
+	}
+
+	readOnly := s.config.Settings.ReadOnly
+	if s.config.Settings.BackupEnabled && !s.dryRun && !readOnly {
+		if err := s.backupSSHStore(storeConfig); err != nil {
+			return err
+		}
+	}
+
+	changed, err := sshca.WriteManagedBlock(storeConfig.Path, lines, s.dryRun || readOnly)
+	if err != nil {
+		return err
+	}
+
+	storeReport.Skipped = len(lines)
+	if changed {
+		storeReport.Added, storeReport.Skipped = countNewLines(current, lines)
+		if readOnly && !s.dryRun {
+			return fmt.Errorf("%d SSH CA entries not written to %s: %w", len(lines), storeConfig.Path, certstore.ErrReadOnly)
+		}
+		if s.dryRun {
+			fmt.Printf("DRY RUN: Would write %d SSH CA entries to %s\n", len(lines), storeConfig.Path)
+		} else {
+			certstore.LogInfof("Updated %s with %d SSH CA entries", storeConfig.Path, len(lines))
+		}
+	}
+	return nil
+}
+
+// backupSSHStore copies the file aside before it is rewritten
+func (s *Service) backupSSHStore(storeConfig config.SSHStore) error {
+	data, err := os.ReadFile(storeConfig.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s for backup: %w", storeConfig.Path, err)
+	}
+
+	if err := os.MkdirAll(s.config.Settings.BackupDirectory, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	backupPath := filepath.Join(s.config.Settings.BackupDirectory, fmt.Sprintf("%s_backup_%d", storeConfig.Name, time.Now().Unix()))
+	if err := atomicfile.WriteFile(backupPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", storeConfig.Path, err)
+	}
+	return nil
+}
+
+// countNewLines returns how many of lines are new and how many were already present
+func countNewLines(current, lines []string) (added, present int) {
+	existing := make(map[string]bool, len(current))
+	for _, line := range current {
+		existing[line] = true
+	}
+	for _, line := range lines {
+		if existing[line] {
+			present++
+		} else {
+			added++
+		}
+	}
+	return added, present
+}
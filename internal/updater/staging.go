@@ -0,0 +1,424 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/atomicfile"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// StagedChange is an update of a critical store waiting for commit. Its
+// digest is kept in the (possibly signed) state, so a staged change edited
+// outside the tool is refused.
+type StagedChange struct {
+	Store        string              `json:"store"`
+	StagedAt     time.Time           `json:"staged_at"`
+	Version      string              `json:"version,omitempty"`       // trust set version the store reaches on commit
+	BundleDigest string              `json:"bundle_digest,omitempty"` // approved bundle the change came from, on hosts that need approval
+	Certificates []stagedCertificate `json:"certificates"`
+	Remove       []stagedCertificate `json:"remove,omitempty"` // distrusted certificates to remove
+
+	digest string // SHA-256 of the staged file as read
+}
+
+// stagedCertificate is a certificate to add or remove with what
+// addCertificate and removeCertificate need
+type stagedCertificate struct {
+	PEM        string            `json:"pem"`
+	Source     string            `json:"source"`
+	Label      string            `json:"label,omitempty"`
+	Purposes   []string          `json:"purposes,omitempty"`
+	Provenance *state.Provenance `json:"provenance,omitempty"`
+}
+
+// isCritical reports whether a store's changes are staged for commit
+func (s *Service) isCritical(name string) bool {
+	storeConfig, _ := s.storeConfig(name)
+	return storeConfig.Critical
+}
+
+// stagedPath returns the file holding a store's staged change
+func (s *Service) stagedPath(name string) string {
+	return filepath.Join(s.config.Settings.StagingDirectory, name+".json")
+}
+
+// StagedBundlePath returns the PEM bundle of the certificates a critical
+// store will hold once its staged change is committed, for smoke tests
+func (s *Service) StagedBundlePath(name string) string {
+	return filepath.Join(s.config.Settings.StagingDirectory, name+".pem")
+}
+
+// stageChanges writes a critical store's additions and removals to the
+// staging directory instead of making them, replacing any earlier staged
+// change
+func (s *Service) stageChanges(name string, current []*x509.Certificate, toAdd, toRemove []*Certificate) error {
+	change := &StagedChange{Store: name, StagedAt: time.Now().UTC(), BundleDigest: s.approved}
+	if s.version != nil {
+		change.Version = s.version.ID
+	}
+	for _, c := range toRemove {
+		change.Remove = append(change.Remove, newStagedCertificate(c))
+	}
+	bundle := withoutCertificates(current, toRemove)
+	for _, c := range toAdd {
+		change.Certificates = append(change.Certificates, newStagedCertificate(c))
+		bundle = append(bundle, c.X509Cert)
+	}
+	data, err := json.MarshalIndent(change, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.config.Settings.StagingDirectory, 0700); err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(s.StagedBundlePath(name), certstore.EncodePEMBundle(bundle), 0644); err != nil {
+		return fmt.Errorf("failed to write staged bundle: %w", err)
+	}
+	if err := atomicfile.WriteFile(s.stagedPath(name), data, 0600); err != nil {
+		return fmt.Errorf("failed to stage changes: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	s.state.Store(name).Staged = hex.EncodeToString(sum[:])
+
+	s.report.storeReport(name).Staged = len(toAdd) + len(toRemove)
+	fmt.Printf("Staged %d additions and %d removals for critical store %s in %s; run commit to apply them\n", len(toAdd), len(toRemove), name, s.StagedBundlePath(name))
+	return nil
+}
+
+func newStagedCertificate(c *Certificate) stagedCertificate {
+	return stagedCertificate{
+		PEM:        string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.X509Cert.Raw})),
+		Source:     c.Source,
+		Label:      c.Label,
+		Purposes:   c.Purposes,
+		Provenance: c.Provenance,
+	}
+}
+
+// decodeStaged parses staged certificates
+func decodeStaged(staged []stagedCertificate) ([]*Certificate, error) {
+	var certs []*Certificate
+	for _, c := range staged {
+		block, _ := pem.Decode([]byte(c.PEM))
+		if block == nil {
+			return nil, fmt.Errorf("staged change holds a malformed certificate")
+		}
+		x509Cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("staged change holds a malformed certificate: %w", err)
+		}
+		certs = append(certs, &Certificate{X509Cert: x509Cert, Source: c.Source, Label: c.Label, Purposes: c.Purposes, Provenance: c.Provenance, Info: cert.GetCertificateInfo(x509Cert)})
+	}
+	return certs, nil
+}
+
+// StagedChanges returns the changes waiting for commit, by store name
+func (s *Service) StagedChanges() ([]*StagedChange, error) {
+	paths, err := filepath.Glob(filepath.Join(s.config.Settings.StagingDirectory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var changes []*StagedChange
+	for _, path := range paths {
+		change, err := readStagedChange(path)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Store < changes[j].Store })
+	return changes, nil
+}
+
+func readStagedChange(path string) (*StagedChange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staged change: %w", err)
+	}
+	var change StagedChange
+	if err := json.Unmarshal(data, &change); err != nil {
+		return nil, fmt.Errorf("failed to parse staged change %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	change.digest = hex.EncodeToString(sum[:])
+	return &change, nil
+}
+
+// CommitStaged applies the changes staged for the named stores, or for
+// every store with one, with a backup, hooks, audit entries and manifest
+// update. Stores that buffer their changes publish them in one step.
+func (s *Service) CommitStaged(names []string) error {
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	changes, err := s.selectStaged(names)
+	if err != nil {
+		return err
+	}
+	if s.config.Anchors.Sealed {
+		if err := s.openAnchors(); err != nil {
+			return err
+		}
+	}
+	if err := s.initializeTrustStores(); err != nil {
+		return fmt.Errorf("failed to initialize trust stores: %w", err)
+	}
+	s.report = &Report{StartedAt: time.Now(), DryRun: s.dryRun}
+	s.changing = make(map[string]error)
+	s.deferStores(time.Now())
+
+	// A certificate distrusted since staging is never committed
+	distrusted, err := s.loadDistrusted()
+	if err != nil {
+		certstore.LogWarnf("%v; enforcing the entries that loaded", err)
+	}
+
+	var failed []string
+	for _, change := range changes {
+		err := s.commitStaged(change, distrusted)
+		s.finishChange(change.Store, err)
+		if err != nil {
+			failed = append(failed, change.Store)
+			s.report.storeReport(change.Store).Error = err.Error()
+			certstore.LogWarnf("Failed to commit staged changes to store %s: %v", change.Store, err)
+		}
+	}
+	s.reloadServices()
+
+	if !s.dryRun {
+		if err := s.state.Save(); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+	}
+	s.report.FinishedAt = time.Now()
+	s.report.Print(os.Stdout)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to commit stores %s; their changes stay staged", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// commitStaged applies one store's staged change and removes it. The change
+// must be the one this tool staged, and its certificates go through
+// validation, the distrust list, the sealed trust anchor list, approval,
+// maintenance windows and confirmation again, since policy or time may have
+// moved on since staging.
+func (s *Service) commitStaged(change *StagedChange, distrusted *distrustList) error {
+	store, ok := s.storeManager.GetStore(change.Store)
+	if !ok {
+		return fmt.Errorf("store %s is not configured or not available on this platform", change.Store)
+	}
+	if recorded := s.state.Store(change.Store).Staged; recorded == "" || recorded != change.digest {
+		return fmt.Errorf("staged change for store %s does not match the one recorded in the state file; discard it and stage again", change.Store)
+	}
+	staged, err := decodeStaged(change.Certificates)
+	if err != nil {
+		return err
+	}
+	stagedRemovals, err := decodeStaged(change.Remove)
+	if err != nil {
+		return err
+	}
+
+	// Certificates added or removed since staging, e.g. by an earlier partial
+	// commit, are skipped
+	current, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list current certificates: %w", err)
+	}
+	toAdd := s.findCertificatesToAdd(current, staged)
+	present := make(map[string]bool)
+	for _, c := range current {
+		present[cert.GetCertificateFingerprint(c)] = true
+	}
+	var toRemove []*Certificate
+	for _, c := range stagedRemovals {
+		if present[cert.GetCertificateFingerprint(c.X509Cert)] {
+			toRemove = append(toRemove, c)
+		}
+	}
+	storeReport := s.report.storeReport(change.Store)
+	storeReport.Skipped = len(staged) - len(toAdd)
+	if err := s.checkStaged(change, toAdd, toRemove, distrusted); err != nil {
+		return err
+	}
+
+	if s.dryRun {
+		fmt.Printf("DRY RUN: Would commit %d staged additions and %d removals to store %s\n", len(toAdd), len(toRemove), change.Store)
+		storeReport.Added = len(toAdd)
+		storeReport.Removed = len(toRemove)
+		return nil
+	}
+	n := len(toAdd) + len(toRemove)
+	if n > 0 {
+		if err := checkWritable(store); err != nil {
+			return err
+		}
+		if s.deferChanges(change.Store, n, fmt.Sprintf("commit %d staged changes", n)) {
+			return nil
+		}
+	}
+	if s.confirm != nil && n > 0 {
+		approved, err := s.confirm(StorePlan{Store: change.Store, Add: toAdd, Remove: toRemove})
+		if err != nil {
+			return err
+		}
+		if !approved {
+			storeReport.Error = "skipped: not confirmed"
+			return nil
+		}
+	}
+	if n > 0 {
+		if err := s.backupStore(change.Store); err != nil {
+			return err
+		}
+		if err := s.beginChange(change.Store); err != nil {
+			return err
+		}
+	}
+	for _, c := range toRemove {
+		if err := s.removeCertificate(change.Store, store, c.X509Cert, c.Source); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", c.X509Cert.Subject.String(), err)
+		}
+		storeReport.Removed++
+	}
+	for _, c := range toAdd {
+		if err := s.addCertificate(change.Store, store, c); err != nil {
+			return fmt.Errorf("failed to add %s: %w", c.X509Cert.Subject.String(), err)
+		}
+		storeReport.Added++
+		storeReport.Installed = append(storeReport.Installed, Installation{
+			Fingerprint: cert.GetCertificateFingerprint(c.X509Cert),
+			Subject:     c.X509Cert.Subject.String(),
+			Source:      c.Source,
+		})
+	}
+	if err := s.commitStore(change.Store, store); err != nil {
+		for _, c := range toAdd {
+			s.state.Forget(change.Store, cert.GetCertificateFingerprint(c.X509Cert))
+		}
+		storeReport.Added = 0
+		storeReport.Removed = 0
+		storeReport.Installed = nil
+		return err
+	}
+
+	if change.Version != "" && s.state.Versions[change.Version] != nil {
+		s.state.SetStoreVersion(change.Store, change.Version)
+	}
+	certstore.LogInfof("Committed %d staged additions and %d removals to store %s", len(toAdd), len(toRemove), change.Store)
+	return s.removeStaged(change.Store)
+}
+
+// checkStaged applies the store's validation policy, the distrust list, the
+// sealed trust anchor list and the approval of the bundle the change was
+// staged from to the certificates a commit would add, and requires an
+// approval of the removals on hosts that need one
+func (s *Service) checkStaged(change *StagedChange, toAdd, toRemove []*Certificate, distrusted *distrustList) error {
+	storeConfig, _ := s.storeConfig(change.Store)
+	policy := s.policy
+	policy.RequireCA = storeConfig.RequiresCA()
+	for _, c := range toAdd {
+		if err := s.fetcher.ValidateCertificate(c.X509Cert, policy); err != nil {
+			return fmt.Errorf("staged certificate %s rejected: %w", c.X509Cert.Subject.String(), err)
+		}
+		if reason, ok := distrusted.match(c.X509Cert); ok {
+			return fmt.Errorf("staged certificate %s rejected: distrusted: %s", c.X509Cert.Subject.String(), reason)
+		}
+	}
+	if _, blocked := s.sealedOnly(change.Store, toAdd); blocked > 0 {
+		return fmt.Errorf("%d staged certificate(s) are not in the sealed trust anchor list", blocked)
+	}
+	if s.dryRun {
+		return nil
+	}
+	if err := s.checkRemovalApproval(change.Store, toRemove); err != nil {
+		return err
+	}
+	if len(toAdd) == 0 || !s.approvalRequired() {
+		return nil
+	}
+	if change.BundleDigest == "" {
+		return fmt.Errorf("%w: change for store %s was staged without an approval", approval.ErrNotApproved, change.Store)
+	}
+	return s.verifyApproval(change.BundleDigest, "the bundle the change was staged from")
+}
+
+// DiscardStaged drops the changes staged for the named stores, or for every
+// store with one
+func (s *Service) DiscardStaged(names []string) error {
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	changes, err := s.selectStaged(names)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if s.dryRun {
+			fmt.Printf("DRY RUN: Would discard %d staged certificates for store %s\n", len(change.Certificates), change.Store)
+			continue
+		}
+		if err := s.removeStaged(change.Store); err != nil {
+			return err
+		}
+		certstore.LogInfof("Discarded %d staged certificates for store %s", len(change.Certificates), change.Store)
+	}
+	if s.dryRun {
+		return nil
+	}
+	return s.state.Save()
+}
+
+// selectStaged returns the staged changes of the named stores, all of them
+// when names is empty
+func (s *Service) selectStaged(names []string) ([]*StagedChange, error) {
+	if len(names) == 0 {
+		changes, err := s.StagedChanges()
+		if err == nil && len(changes) == 0 {
+			err = fmt.Errorf("no changes are staged")
+		}
+		return changes, err
+	}
+	var changes []*StagedChange
+	for _, name := range names {
+		change, err := readStagedChange(s.stagedPath(name))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no changes are staged for store %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func (s *Service) removeStaged(name string) error {
+	s.state.Store(name).Staged = ""
+	for _, path := range []string{s.stagedPath(name), s.StagedBundlePath(name)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove staged change: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package updater
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+func TestCriticalStoreStagesUntilCommit(t *testing.T) {
+	dir := t.TempDir()
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Settings:    config.Settings{StagingDirectory: filepath.Join(dir, "staged")},
+		TrustStores: []config.TrustStore{{Name: "critical", Critical: true}},
+	}
+	manager := certstore.NewStoreManager(nil, false)
+	store := &memoryStore{}
+	manager.AddStore("critical", store)
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}}
+
+	existing := newTestCA(t, "Existing Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	store.certs = append(store.certs, existing)
+	root := newTestCA(t, "Staged Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	if err := s.updateStore("critical", store, []*Certificate{{X509Cert: root, Source: "test", Label: "staged"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.certs) != 1 || s.report.storeReport("critical").Staged != 1 {
+		t.Fatalf("update changed the critical store: %d certificates, report %+v", len(store.certs), s.report.storeReport("critical"))
+	}
+	data, err := os.ReadFile(s.StagedBundlePath("critical"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle, _ := certstore.ParsePEMBundle(data); len(bundle) != 2 {
+		t.Errorf("staged bundle holds %d certificates, want 2", len(bundle))
+	}
+
+	changes, err := s.StagedChanges()
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("StagedChanges = %v, %v", changes, err)
+	}
+	if err := s.commitStaged(changes[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.certs) != 2 || !st.IsManaged("critical", cert.GetCertificateFingerprint(root)) {
+		t.Errorf("commit didn't add the staged certificate: %d certificates", len(store.certs))
+	}
+	if changes, _ := s.StagedChanges(); len(changes) != 0 {
+		t.Errorf("%d changes still staged after commit", len(changes))
+	}
+}
+
+func TestCommitRefusesEditedStagedChange(t *testing.T) {
+	dir := t.TempDir()
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Settings:    config.Settings{StagingDirectory: filepath.Join(dir, "staged")},
+		TrustStores: []config.TrustStore{{Name: "critical", Critical: true}},
+	}
+	manager := certstore.NewStoreManager(nil, false)
+	store := &memoryStore{}
+	manager.AddStore("critical", store)
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}, fetcher: cert.NewFetcher(5, false)}
+
+	root := newTestCA(t, "Staged Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	if err := s.updateStore("critical", store, []*Certificate{{X509Cert: root, Source: "test"}}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(cfg.Settings.StagingDirectory); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("staging directory mode = %v, %v; want 0700", info.Mode().Perm(), err)
+	}
+
+	// Swap in another root, as someone able to write the staging directory could
+	planted := newTestCA(t, "Planted Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	data, _ := os.ReadFile(s.stagedPath("critical"))
+	edited := strings.Replace(string(data), strings.ReplaceAll(string(certstore.EncodePEMBundle([]*x509.Certificate{root})), "\n", `\n`),
+		strings.ReplaceAll(string(certstore.EncodePEMBundle([]*x509.Certificate{planted})), "\n", `\n`), 1)
+	if edited == string(data) {
+		t.Fatal("test did not edit the staged change")
+	}
+	os.WriteFile(s.stagedPath("critical"), []byte(edited), 0600)
+
+	changes, err := s.StagedChanges()
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("StagedChanges = %v, %v", changes, err)
+	}
+	if err := s.commitStaged(changes[0], nil); err == nil {
+		t.Fatal("an edited staged change was committed")
+	}
+	if len(store.certs) != 0 {
+		t.Errorf("store holds %d certificates after a refused commit", len(store.certs))
+	}
+}
+
+func TestCommitStagedChecksDistrustAndConfirmation(t *testing.T) {
+	dir := t.TempDir()
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Settings:    config.Settings{StagingDirectory: filepath.Join(dir, "staged")},
+		TrustStores: []config.TrustStore{{Name: "critical", Critical: true}},
+	}
+	manager := certstore.NewStoreManager(nil, false)
+	store := &memoryStore{}
+	manager.AddStore("critical", store)
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}, fetcher: cert.NewFetcher(5, false)}
+
+	root := newTestCA(t, "Staged Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+	if err := s.updateStore("critical", store, []*Certificate{{X509Cert: root, Source: "test"}}); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := s.StagedChanges()
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("StagedChanges = %v, %v", changes, err)
+	}
+
+	// Distrusted after it was staged
+	s.config.Distrusted = []config.DistrustedCertificate{{Subject: "Staged Root", Reason: "key compromise"}}
+	distrusted, err := s.loadDistrusted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commitStaged(changes[0], distrusted); err == nil || !strings.Contains(err.Error(), "key compromise") {
+		t.Errorf("commit of a distrusted certificate = %v, want it rejected", err)
+	}
+
+	var planned []StorePlan
+	s.SetConfirm(func(plan StorePlan) (bool, error) {
+		planned = append(planned, plan)
+		return false, nil
+	})
+	if err := s.commitStaged(changes[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != 1 || len(planned[0].Add) != 1 || planned[0].Add[0].X509Cert.Subject.CommonName != "Staged Root" {
+		t.Fatalf("confirmation not asked for the staged certificate: %+v", planned)
+	}
+	if len(store.certs) != 0 {
+		t.Errorf("store holds %d certificates after the commit was declined", len(store.certs))
+	}
+	if changes, _ := s.StagedChanges(); len(changes) != 1 {
+		t.Errorf("%d changes staged after a declined commit, want the change kept", len(changes))
+	}
+}
@@ -0,0 +1,146 @@
+package updater
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+)
+
+// defaultProbeTimeout bounds a probe without timeout_seconds
+const defaultProbeTimeout = 30 * time.Second
+
+// ProbeResult is the outcome of a verification probe
+type ProbeResult struct {
+	Name     string
+	OK       bool
+	Detail   string
+	Duration time.Duration
+}
+
+// verifyStores runs the verification probes of every store the run changed
+// and, unless the store only reports failures, removes the run's additions
+// from stores that failed one. The services of rolled back stores are
+// reloaded again.
+func (s *Service) verifyStores() {
+	var rolledBack []string
+	for _, sr := range s.report.Stores {
+		storeConfig, ok := s.storeConfig(sr.Name)
+		if !ok || len(storeConfig.Verify) == 0 || sr.Added == 0 && sr.Removed == 0 {
+			continue
+		}
+		store, ok := s.storeManager.GetStore(sr.Name)
+		if !ok {
+			continue
+		}
+
+		var failed []string
+		for _, probe := range storeConfig.Verify {
+			result := s.runProbe(store, probe)
+			sr.Verify = append(sr.Verify, result)
+			if !result.OK {
+				failed = append(failed, probe.Name)
+				certstore.LogWarnf("Verification probe %s failed for store %s: %s", probe.Name, sr.Name, result.Detail)
+			}
+		}
+		if len(failed) == 0 {
+			continue
+		}
+
+		sr.Error = fmt.Sprintf("verification failed: %s", strings.Join(failed, ", "))
+		if storeConfig.VerifyFailure == "report" {
+			continue
+		}
+		if err := s.rollbackAdditions(sr, store); err != nil {
+			sr.Error += fmt.Sprintf("; rollback failed: %v", err)
+			certstore.LogErrorf("Failed to roll back store %s after failed verification: %v", sr.Name, err)
+			continue
+		}
+		rolledBack = append(rolledBack, sr.Name)
+	}
+	if len(rolledBack) > 0 {
+		s.reloadServicesOf(rolledBack)
+	}
+}
+
+// runProbe runs one probe against a store
+func (s *Service) runProbe(store certstore.CertificateStore, probe config.VerifyProbe) ProbeResult {
+	timeout := defaultProbeTimeout
+	if probe.TimeoutSeconds > 0 {
+		timeout = time.Duration(probe.TimeoutSeconds) * time.Second
+	}
+	start := time.Now()
+	var err error
+	if len(probe.Command) > 0 {
+		runner := certstore.CommandRunner{Timeout: timeout, Verbose: s.verbose}
+		_, err = runner.Run(probe.Command[0], probe.Command[1:]...)
+	} else {
+		err = probeTLS(store, probe, timeout)
+	}
+
+	result := ProbeResult{Name: probe.Name, OK: err == nil, Duration: time.Since(start)}
+	if err != nil {
+		result.Detail = err.Error()
+	}
+	return result
+}
+
+// probeTLS connects to the probe's address and verifies the server's chain
+// against the store's current certificates, which the process's cached
+// system roots wouldn't reflect
+func probeTLS(store certstore.CertificateStore, probe config.VerifyProbe, timeout time.Duration) error {
+	certs, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list store certificates: %w", err)
+	}
+	roots := x509.NewCertPool()
+	for _, c := range certs {
+		roots.AddCert(c)
+	}
+	serverName := probe.ServerName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(probe.TLS)
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", probe.TLS, &tls.Config{
+		RootCAs:    roots,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// rollbackAdditions removes the certificates the run added to a store
+func (s *Service) rollbackAdditions(sr *StoreReport, store certstore.CertificateStore) error {
+	current, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list current certificates: %w", err)
+	}
+	byFingerprint := make(map[string]*x509.Certificate, len(current))
+	for _, c := range current {
+		byFingerprint[cert.GetCertificateFingerprint(c)] = c
+	}
+	for _, installed := range sr.Installed {
+		c, ok := byFingerprint[installed.Fingerprint]
+		if !ok {
+			continue
+		}
+		if err := s.removeCertificate(sr.Name, store, c, installed.Source); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", installed.Subject, err)
+		}
+		sr.RolledBack++
+	}
+	if err := s.commitStore(sr.Name, store); err != nil {
+		return err
+	}
+	certstore.LogInfof("Removed the %d certificates added to store %s after failed verification", sr.RolledBack, sr.Name)
+	return nil
+}
@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+func TestVerifyStoresRollsBackOnFailedProbe(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe := config.VerifyProbe{Name: "intranet", TLS: addr, ServerName: "example.com", TimeoutSeconds: 5}
+	cfg := &config.Config{TrustStores: []config.TrustStore{
+		{Name: "trusting", Verify: []config.VerifyProbe{probe}},
+		{Name: "broken", Verify: []config.VerifyProbe{probe}},
+		{Name: "reported", Verify: []config.VerifyProbe{probe}, VerifyFailure: "report"},
+	}}
+	manager := certstore.NewStoreManager(nil, false)
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}}
+
+	// Each store got a new root this run; only "trusting" also holds the
+	// server's certificate
+	stores := make(map[string]*removingStore)
+	for _, storeConfig := range cfg.TrustStores {
+		root := newTestCA(t, "New Root", newTestKey(t), time.Now().Add(24*time.Hour), nil, nil)
+		store := &removingStore{memoryStore{certs: []*x509.Certificate{root}}}
+		if storeConfig.Name == "trusting" {
+			store.certs = append(store.certs, srv.Certificate())
+		}
+		stores[storeConfig.Name] = store
+		manager.AddStore(storeConfig.Name, store)
+		st.RecordManaged(storeConfig.Name, root, "test", nil)
+		sr := s.report.storeReport(storeConfig.Name)
+		sr.Added = 1
+		sr.Installed = []Installation{{Fingerprint: cert.GetCertificateFingerprint(root), Source: "test"}}
+	}
+
+	s.verifyStores()
+
+	if sr := s.report.storeReport("trusting"); sr.Error != "" || len(sr.Verify) != 1 || !sr.Verify[0].OK {
+		t.Errorf("trusting: error %q, results %+v", sr.Error, sr.Verify)
+	}
+	if sr := s.report.storeReport("broken"); sr.RolledBack != 1 || len(stores["broken"].certs) != 0 || !strings.Contains(sr.Error, "intranet") {
+		t.Errorf("broken: rolled back %d, %d certificates left, error %q", sr.RolledBack, len(stores["broken"].certs), sr.Error)
+	}
+	if len(st.ManagedList("broken")) != 0 {
+		t.Error("rolled back certificate still managed")
+	}
+	if sr := s.report.storeReport("reported"); sr.RolledBack != 0 || len(stores["reported"].certs) != 1 || sr.Error == "" {
+		t.Errorf("reported: rolled back %d, error %q", sr.RolledBack, sr.Error)
+	}
+}
@@ -0,0 +1,210 @@
+package updater
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// versionSource is the source recorded for certificates a rollback adds
+const versionSource = "version"
+
+// SetVersionLabel labels the trust set version recorded by the next update
+func (s *Service) SetVersionLabel(label string) {
+	s.versionLabel = label
+}
+
+// ErrBundleMismatch is returned when the fetched bundle isn't the one an
+// update was pinned to with SetBundleDigest
+var ErrBundleMismatch = errors.New("fetched bundle does not match the pinned bundle")
+
+// SetBundleDigest pins the next update to a bundle: one whose fetched
+// certificates have another digest (see approval.BundleDigest) fails with
+// ErrBundleMismatch before any store is changed
+func (s *Service) SetBundleDigest(digest string) {
+	s.pinned = digest
+}
+
+// recordVersion records the evaluated trust set as a version
+func (s *Service) recordVersion(certs []*Certificate) *state.Version {
+	x509Certs := make([]*x509.Certificate, 0, len(certs))
+	for _, c := range certs {
+		x509Certs = append(x509Certs, c.X509Cert)
+	}
+	v, err := s.state.RecordVersion(x509Certs, s.versionLabel)
+	if err != nil {
+		certstore.LogWarnf("Failed to record trust set version: %v", err)
+		return nil
+	}
+	s.report.Version = v.ShortID()
+	if v.Label != "" {
+		s.report.Version += " (" + v.Label + ")"
+	}
+	return v
+}
+
+// reachedVersion reports whether a store's update applied the whole trust
+// set, so the store is now at the run's version
+func reachedVersion(sr *StoreReport) bool {
+	return sr.Failed == 0 && sr.Deferred == 0 && sr.Staged == 0 && sr.Unplanned == 0 && sr.ReadOnlyOutput == "" && sr.Error == ""
+}
+
+// Versions returns the recorded trust set versions, newest first
+func (s *Service) Versions() []*state.Version {
+	return s.state.VersionList()
+}
+
+// StoreVersion returns the version a store is at, nil if none is recorded
+func (s *Service) StoreVersion(name string) *state.Version {
+	return s.state.StoreVersion(name)
+}
+
+// RollbackToVersion returns stores to an earlier trust set version by
+// applying the reverse delta from the version each store is at: managed
+// certificates the earlier version didn't have are removed and its
+// certificates the store no longer holds are added back. Certificates the
+// tool doesn't manage and ad hoc additions are left alone. Without names
+// every store with a recorded version is rolled back.
+func (s *Service) RollbackToVersion(ref string, names []string) error {
+	if err := s.acquireLock(); err != nil {
+		return err
+	}
+	defer s.releaseLock()
+
+	target, err := s.state.FindVersion(ref)
+	if err != nil {
+		return err
+	}
+	targetCerts, err := s.state.VersionCertificates(target)
+	if err != nil {
+		return err
+	}
+
+	if s.config.Anchors.Sealed {
+		if err := s.openAnchors(); err != nil {
+			return err
+		}
+	}
+	if err := s.initializeTrustStores(); err != nil {
+		return fmt.Errorf("failed to initialize trust stores: %w", err)
+	}
+	if len(names) == 0 {
+		for _, name := range s.storeManager.StoreNames() {
+			if s.state.StoreVersion(name) != nil {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no store has a recorded version")
+		}
+	}
+
+	// A certificate distrusted since the version was recorded stays out
+	distrusted, err := s.loadDistrusted()
+	if err != nil {
+		certstore.LogWarnf("%v; enforcing the entries that loaded", err)
+	}
+	wanted := make([]*Certificate, 0, len(targetCerts))
+	for _, c := range targetCerts {
+		wanted = append(wanted, &Certificate{X509Cert: c, Source: versionSource + ":" + target.ShortID(), Info: cert.GetCertificateInfo(c)})
+	}
+	wanted = s.withoutDistrusted(wanted, distrusted)
+
+	for _, name := range names {
+		if err := s.rollbackStore(name, target, wanted); err != nil {
+			return fmt.Errorf("store %s: %w", name, err)
+		}
+	}
+	if s.dryRun {
+		return nil
+	}
+	return s.state.Save()
+}
+
+// rollbackStore applies the delta from a store's current version to target
+func (s *Service) rollbackStore(name string, target *state.Version, wanted []*Certificate) error {
+	store, ok := s.storeManager.GetStore(name)
+	if !ok {
+		return fmt.Errorf("not configured or not available on this platform")
+	}
+	currentVersion := s.state.StoreVersion(name)
+	if currentVersion == nil {
+		return fmt.Errorf("no recorded version to roll back from; use restore with a backup")
+	}
+	if currentVersion.ID == target.ID {
+		fmt.Printf("Store %s is already at version %s\n", name, target.ShortID())
+		return nil
+	}
+	fromCerts, err := s.state.VersionCertificates(currentVersion)
+	if err != nil {
+		return err
+	}
+	current, err := store.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list current certificates: %w", err)
+	}
+
+	inTarget := make(map[string]bool, len(wanted))
+	for _, c := range wanted {
+		inTarget[cert.GetCertificateFingerprint(c.X509Cert)] = true
+	}
+	var toRemove []*x509.Certificate
+	for _, c := range fromCerts {
+		fp := cert.GetCertificateFingerprint(c)
+		if !inTarget[fp] && s.state.IsManaged(name, fp) && certstore.ContainsCertificate(current, c) {
+			toRemove = append(toRemove, c)
+		}
+	}
+	toAdd := s.findCertificatesToAdd(current, s.certificatesForStore(name, store, wanted))
+	toAdd, blocked := s.sealedOnly(name, toAdd)
+	if blocked > 0 {
+		certstore.LogWarnf("Not restoring %d certificate(s) to store %s: not in the sealed trust anchor list", blocked, name)
+	}
+
+	if s.dryRun {
+		fmt.Printf("DRY RUN: Would roll store %s back from version %s to %s: remove %d, add %d certificates\n",
+			name, currentVersion.ShortID(), target.ShortID(), len(toRemove), len(toAdd))
+		return nil
+	}
+	if len(toRemove) > 0 || len(toAdd) > 0 {
+		if err := checkWritable(store); err != nil {
+			return err
+		}
+		if err := s.checkOperationApproval(approval.OpRollback, name, []string{target.ID}); err != nil {
+			return err
+		}
+		if err := s.backupStore(name); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range toRemove {
+		source := versionSource + ":" + currentVersion.ShortID()
+		if managed, ok := s.state.Store(name).Managed[cert.GetCertificateFingerprint(c)]; ok {
+			source = managed.Source
+		}
+		if err := s.removeCertificate(name, store, c, source); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", c.Subject.String(), err)
+		}
+	}
+	for _, c := range toAdd {
+		if err := s.addCertificate(name, store, c); err != nil {
+			return fmt.Errorf("failed to add %s: %w", c.X509Cert.Subject.String(), err)
+		}
+	}
+	if err := s.commitStore(name, store); err != nil {
+		for _, c := range toAdd {
+			s.state.Forget(name, cert.GetCertificateFingerprint(c.X509Cert))
+		}
+		return err
+	}
+	s.state.SetStoreVersion(name, target.ID)
+	certstore.LogInfof("Rolled store %s back from version %s to %s: removed %d, added %d certificates",
+		name, currentVersion.ShortID(), target.ShortID(), len(toRemove), len(toAdd))
+	return nil
+}
@@ -0,0 +1,126 @@
+package updater
+
+import (
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/webprofusion/trust-store-updater/internal/approval"
+	"github.com/webprofusion/trust-store-updater/internal/cert"
+	"github.com/webprofusion/trust-store-updater/internal/certstore"
+	"github.com/webprofusion/trust-store-updater/internal/config"
+	"github.com/webprofusion/trust-store-updater/internal/state"
+)
+
+// removingStore is a memoryStore whose removals take effect
+type removingStore struct {
+	memoryStore
+}
+
+func (r *removingStore) RemoveCertificate(c *x509.Certificate) error {
+	for i, held := range r.certs {
+		if held.Equal(c) {
+			r.certs = append(r.certs[:i], r.certs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func TestRollbackStoreAppliesReverseDelta(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := certstore.NewStoreManager(nil, false)
+	store := &removingStore{}
+	manager.AddStore("system", store)
+	s := &Service{config: &config.Config{}, state: st, storeManager: manager, report: &Report{}}
+
+	notAfter := time.Now().Add(24 * time.Hour)
+	a := newTestCA(t, "Root A", newTestKey(t), notAfter, nil, nil)
+	b := newTestCA(t, "Root B", newTestKey(t), notAfter, nil, nil)
+	c := newTestCA(t, "Root C", newTestKey(t), notAfter, nil, nil)
+	local := newTestCA(t, "Local Root", newTestKey(t), notAfter, nil, nil)
+
+	// v1 had A and B, v2 has A and C. The store also holds a root added by
+	// hand, which a rollback leaves alone.
+	v1, err := st.RecordVersion([]*x509.Certificate{a, b}, "2026.09")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := st.RecordVersion([]*x509.Certificate{c, a}, "2026.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, managed := range []*x509.Certificate{a, c} {
+		st.RecordManaged("system", managed, "test", nil)
+	}
+	store.certs = []*x509.Certificate{a, c, local}
+	st.SetStoreVersion("system", v2.ID)
+
+	if again, _ := st.RecordVersion([]*x509.Certificate{a, c}, ""); again.ID != v2.ID {
+		t.Fatalf("the same set got a new version %s", again.ShortID())
+	}
+	if found, err := st.FindVersion("2026.09"); err != nil || found.ID != v1.ID {
+		t.Fatalf("FindVersion by label = %v, %v", found, err)
+	}
+
+	certs, err := st.VersionCertificates(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wanted []*Certificate
+	for _, x := range certs {
+		wanted = append(wanted, &Certificate{X509Cert: x, Source: "version:" + v1.ShortID()})
+	}
+	if err := s.rollbackStore("system", v1, wanted); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]bool)
+	for _, held := range store.certs {
+		got[held.Subject.CommonName] = true
+	}
+	if len(store.certs) != 3 || !got["Root A"] || !got["Root B"] || !got["Local Root"] {
+		t.Errorf("store holds %v, want Root A, Root B and Local Root", got)
+	}
+	if st.IsManaged("system", cert.GetCertificateFingerprint(c)) {
+		t.Error("removed certificate still managed")
+	}
+	if v := st.StoreVersion("system"); v == nil || v.ID != v1.ID {
+		t.Errorf("store version = %v, want %s", v, v1.ShortID())
+	}
+}
+
+func TestRollbackStoreRequiresApproval(t *testing.T) {
+	st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := certstore.NewStoreManager(nil, false)
+	store := &removingStore{}
+	manager.AddStore("system", store)
+	cfg := &config.Config{}
+	cfg.Settings.HostTags = []string{"production"}
+	cfg.Approval.RequiredForTags = []string{"production"}
+	s := &Service{config: cfg, state: st, storeManager: manager, report: &Report{}}
+
+	notAfter := time.Now().Add(24 * time.Hour)
+	a := newTestCA(t, "Root A", newTestKey(t), notAfter, nil, nil)
+	b := newTestCA(t, "Root B", newTestKey(t), notAfter, nil, nil)
+	v1, _ := st.RecordVersion([]*x509.Certificate{a, b}, "")
+	v2, _ := st.RecordVersion([]*x509.Certificate{a}, "")
+	st.SetStoreVersion("system", v2.ID)
+	store.certs = []*x509.Certificate{a}
+
+	wanted := []*Certificate{{X509Cert: a}, {X509Cert: b}}
+	if err := s.rollbackStore("system", v1, wanted); !errors.Is(err, approval.ErrNotApproved) {
+		t.Fatalf("rollback without approval = %v, want ErrNotApproved", err)
+	}
+	if len(store.certs) != 1 {
+		t.Errorf("store changed without approval: %d certificates", len(store.certs))
+	}
+}
@@ -0,0 +1,37 @@
+// Package certstore is the public extension point for builds of
+// trust-store-updater that compile in their own certificate store
+// implementations. A store implements CertificateStore and is registered
+// under a provider name with RegisterStoreProvider.
+package certstore
+
+import "crypto/x509"
+
+// CertificateStore defines the interface for certificate store operations
+type CertificateStore interface {
+	// Name returns the name of the certificate store
+	Name() string
+
+	// IsSupported checks if this store is supported on the current platform
+	IsSupported() bool
+
+	// RequiresRoot returns true if root privileges are required
+	RequiresRoot() bool
+
+	// ListCertificates returns all certificates currently in the store
+	ListCertificates() ([]*x509.Certificate, error)
+
+	// AddCertificate adds a certificate to the store
+	AddCertificate(cert *x509.Certificate) error
+
+	// RemoveCertificate removes a certificate from the store
+	RemoveCertificate(cert *x509.Certificate) error
+
+	// Backup creates a backup of the current store state
+	Backup(backupPath string) error
+
+	// Restore restores the store from a backup
+	Restore(backupPath string) error
+
+	// Validate checks if the store is in a valid state
+	Validate() error
+}
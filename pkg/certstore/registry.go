@@ -0,0 +1,61 @@
+package certstore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// StoreConstructor creates a store instance for a registered provider. It
+// receives the store's configured target and options.
+type StoreConstructor func(target string, options map[string]string, verbose bool) (CertificateStore, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]StoreConstructor)
+)
+
+// RegisterStoreProvider makes a custom store implementation available to
+// configuration as type "custom" with the given provider name. It is intended
+// to be called from an init function in downstream builds and panics if the
+// name is empty, already registered or the constructor is nil.
+func RegisterStoreProvider(name string, constructor StoreConstructor) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if name == "" {
+		panic("certstore: RegisterStoreProvider with empty name")
+	}
+	if constructor == nil {
+		panic("certstore: RegisterStoreProvider constructor is nil for " + name)
+	}
+	if _, exists := providers[name]; exists {
+		panic("certstore: RegisterStoreProvider called twice for " + name)
+	}
+	providers[name] = constructor
+}
+
+// StoreProviders returns the names of all registered providers, sorted
+func StoreProviders() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProviderStore creates a store using a registered provider
+func NewProviderStore(provider, target string, options map[string]string, verbose bool) (CertificateStore, error) {
+	providersMu.RLock()
+	constructor, exists := providers[provider]
+	providersMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown store provider %q (registered: %v)", provider, StoreProviders())
+	}
+	return constructor(target, options, verbose)
+}
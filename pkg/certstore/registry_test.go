@@ -0,0 +1,52 @@
+package certstore
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+type fakeStore struct {
+	target string
+}
+
+func (f *fakeStore) Name() string                                   { return "fake-" + f.target }
+func (f *fakeStore) IsSupported() bool                              { return true }
+func (f *fakeStore) RequiresRoot() bool                             { return false }
+func (f *fakeStore) ListCertificates() ([]*x509.Certificate, error) { return nil, nil }
+func (f *fakeStore) AddCertificate(*x509.Certificate) error         { return nil }
+func (f *fakeStore) RemoveCertificate(*x509.Certificate) error      { return nil }
+func (f *fakeStore) Backup(string) error                            { return nil }
+func (f *fakeStore) Restore(string) error                           { return nil }
+func (f *fakeStore) Validate() error                                { return nil }
+
+func TestRegisterStoreProvider(t *testing.T) {
+	RegisterStoreProvider("pkg-test-appliance", func(target string, options map[string]string, verbose bool) (CertificateStore, error) {
+		return &fakeStore{target: target}, nil
+	})
+
+	store, err := NewProviderStore("pkg-test-appliance", "lb01", nil, false)
+	if err != nil {
+		t.Fatalf("NewProviderStore: %v", err)
+	}
+	if store.Name() != "fake-lb01" {
+		t.Errorf("store name = %s", store.Name())
+	}
+	if _, err := NewProviderStore("not-registered", "", nil, false); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+
+	found := false
+	for _, name := range StoreProviders() {
+		found = found || name == "pkg-test-appliance"
+	}
+	if !found {
+		t.Errorf("StoreProviders() = %v", StoreProviders())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on duplicate registration")
+		}
+	}()
+	RegisterStoreProvider("pkg-test-appliance", func(string, map[string]string, bool) (CertificateStore, error) { return nil, nil })
+}